@@ -10,12 +10,14 @@ import (
 	"runtime"
 
 	"cdr.dev/coder-cli/internal/cmd"
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/internal/version"
 	"cdr.dev/coder-cli/internal/x/xterminal"
 	"cdr.dev/coder-cli/pkg/clog"
 )
 
 func main() {
+	defer cmd.RecoverCrash()
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// If requested, spin up the pprof webserver.
@@ -32,7 +34,7 @@ func main() {
 	if len(os.Args) >= 2 && os.Args[1] != "tunnel" {
 		state, err := xterminal.MakeOutputRaw(os.Stdout.Fd())
 		if err != nil {
-			clog.Log(clog.Fatal(fmt.Sprintf("set output to raw: %s", err)))
+			clog.Log(clog.Fatal(i18n.Sprintf("set output to raw: %s", err)))
 			cancel()
 			os.Exit(1)
 		}
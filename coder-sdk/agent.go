@@ -4,8 +4,55 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 )
 
+// WorkspaceAgent is an agent serving connections to a workspace. Workspaces
+// may run several agents, such as one in the main container and one in a
+// GPU sidecar, told apart by their label.
+type WorkspaceAgent struct {
+	// Label is empty for the main agent of the workspace.
+	Label       string    `json:"label"        table:"Label"`
+	Version     string    `json:"version"      table:"Version"`
+	Hostname    string    `json:"hostname"     table:"Hostname"`
+	ConnectedAt time.Time `json:"connected_at" table:"ConnectedAt"`
+}
+
+// WorkspaceAgents returns the agents connected to the workspace.
+func (c *DefaultClient) WorkspaceAgents(ctx context.Context, workspaceID string) ([]WorkspaceAgent, error) {
+	var agents []WorkspaceAgent
+	if err := c.requestBody(ctx, http.MethodGet, "/api/private/workspaces/"+workspaceID+"/agents", nil, &agents); err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
+// DiskPressure is how close the home volume of a workspace is to full.
+type DiskPressure string
+
+// The following are the disk pressures agents report.
+const (
+	DiskPressureOK       DiskPressure = "ok"
+	DiskPressureWarning  DiskPressure = "warning"
+	DiskPressureCritical DiskPressure = "critical"
+)
+
+// AgentDisk is the pressure an agent reports on the home volume of its
+// workspace. The usage of the volume is in WorkspaceStat.DiskTotal and
+// DiskUsed, and the highest pressure reported in WorkspaceStat.DiskPressure.
+type AgentDisk struct {
+	// Label is empty for the main agent of the workspace.
+	Label    string       `json:"label"`
+	Path     string       `json:"path"`
+	Pressure DiskPressure `json:"pressure"`
+}
+
+// ReportAgentDisk reports the disk pressure seen by the agent the client is
+// authenticated as, with its agent token.
+func (c *DefaultClient) ReportAgentDisk(ctx context.Context, disk AgentDisk) error {
+	return c.requestBody(ctx, http.MethodPost, "/api/private/envagent/disk", disk, nil)
+}
+
 // UpdateLastConnectionAt updates the last connection at attribute of a workspace.
 func (c *DefaultClient) UpdateLastConnectionAt(ctx context.Context, workspaceID string) error {
 	reqURL := fmt.Sprintf("/api/private/envagent/%s/update-last-connection-at", workspaceID)
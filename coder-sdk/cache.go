@@ -0,0 +1,220 @@
+package coder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// cacheablePaths match the API paths whose responses are cached: resources
+// that rarely change and that most commands look up. Secrets, such as the
+// SSH key, and what commands poll, such as workspaces and image prepulls,
+// are never cached.
+var cacheablePaths = []*regexp.Regexp{
+	regexp.MustCompile(`^/api/v0/images(/[^/]+)?$`),
+	regexp.MustCompile(`^/api/v0/images/[^/]+/tags(/[^/]+)?$`),
+	regexp.MustCompile(`^/api/v0/orgs(/[^/]+)?$`),
+	regexp.MustCompile(`^/api/private/resource-pools(/[^/]+)?$`),
+}
+
+func cacheablePath(path string) bool {
+	for _, rx := range cacheablePaths {
+		if rx.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Limits of the disk cache, past which the oldest responses are evicted.
+const (
+	diskCacheMaxAge   = 24 * time.Hour
+	diskCacheMaxBytes = 16 << 20
+)
+
+// ResponseCache stores the responses to GET requests that carry an ETag, so
+// that the client can revalidate them with If-None-Match instead of
+// downloading them again. Implementations must be safe for concurrent use.
+type ResponseCache interface {
+	// Get returns the response cached under key, if any.
+	Get(key string) (CachedResponse, bool)
+	// Set caches the response under key.
+	Set(key string, r CachedResponse)
+	// Purge removes all cached responses. The client calls it after
+	// requests that may change resources.
+	Purge()
+}
+
+// CachedResponse is a response stored in a ResponseCache.
+type CachedResponse struct {
+	ETag string `json:"etag"`
+	Body []byte `json:"body"`
+	// StoredAt is when the response was last received or revalidated.
+	StoredAt time.Time `json:"stored_at"`
+}
+
+// NewMemoryCache returns a ResponseCache that lives as long as the process.
+func NewMemoryCache() ResponseCache {
+	return &memoryCache{responses: make(map[string]CachedResponse)}
+}
+
+type memoryCache struct {
+	mu        sync.Mutex
+	responses map[string]CachedResponse
+}
+
+func (m *memoryCache) Get(key string) (CachedResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.responses[key]
+	return r, ok
+}
+
+func (m *memoryCache) Set(key string, r CachedResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses[key] = r
+}
+
+func (m *memoryCache) Purge() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses = make(map[string]CachedResponse)
+}
+
+// NewDiskCache returns a ResponseCache that stores responses as files in
+// dir, to be shared by the successive runs of a program. The responses
+// hold API data of the authenticated user, so dir should only be readable
+// by them. Responses are kept for a day at most, and the oldest are evicted
+// once they take more than 16MB. Errors reading and writing the files are
+// treated as cache misses.
+func NewDiskCache(dir string) ResponseCache {
+	return diskCache{dir: dir}
+}
+
+type diskCache struct {
+	dir string
+}
+
+// path returns the file of key, named after its hash since keys are URLs.
+func (d diskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (d diskCache) Get(key string) (CachedResponse, bool) {
+	raw, err := ioutil.ReadFile(d.path(key))
+	if err != nil {
+		return CachedResponse{}, false
+	}
+	var r CachedResponse
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return CachedResponse{}, false
+	}
+	if time.Since(r.StoredAt) > diskCacheMaxAge {
+		_ = os.Remove(d.path(key))
+		return CachedResponse{}, false
+	}
+	return r, true
+}
+
+func (d diskCache) Set(key string, r CachedResponse) {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(d.dir, 0700); err != nil {
+		return
+	}
+	// Renaming a temporary file keeps concurrent runs from reading a
+	// partial response.
+	f, err := ioutil.TempFile(d.dir, ".tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(raw)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return
+	}
+	if err := os.Rename(f.Name(), d.path(key)); err != nil {
+		_ = os.Remove(f.Name())
+		return
+	}
+	d.evict()
+}
+
+// evict removes the responses older than diskCacheMaxAge, then the oldest
+// ones until the rest fit in diskCacheMaxBytes.
+func (d diskCache) evict() {
+	files, _ := filepath.Glob(filepath.Join(d.dir, "*.json"))
+	infos := make([]os.FileInfo, 0, len(files))
+	var total int64
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) > diskCacheMaxAge {
+			_ = os.Remove(f)
+			continue
+		}
+		infos = append(infos, info)
+		total += info.Size()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+	for _, info := range infos {
+		if total <= diskCacheMaxBytes {
+			return
+		}
+		_ = os.Remove(filepath.Join(d.dir, info.Name()))
+		total -= info.Size()
+	}
+}
+
+func (d diskCache) Purge() {
+	files, _ := filepath.Glob(filepath.Join(d.dir, "*.json"))
+	for _, f := range files {
+		_ = os.Remove(f)
+	}
+}
+
+// cacheKey returns the key of the response to a GET of url, which differs
+// by session and impersonated user since they see different resources.
+func (c *DefaultClient) cacheKey(url string) string {
+	return c.token + "\n" + c.impersonate + "\n" + url
+}
+
+// cachedResponse returns a response made of the cached one, as if the API
+// had returned it, keeping the headers of resp if it isn't nil.
+func cachedResponse(req *http.Request, resp *http.Response, cached CachedResponse) *http.Response {
+	header := http.Header{}
+	if resp != nil {
+		header = resp.Header.Clone()
+	}
+	header.Set("ETag", cached.ETag)
+	header.Set("Content-Type", "application/json")
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(cached.Body)),
+		ContentLength: int64(len(cached.Body)),
+		Request:       req,
+	}
+}
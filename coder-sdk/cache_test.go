@@ -0,0 +1,166 @@
+package coder_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+)
+
+func TestResponseCache(t *testing.T) {
+	t.Parallel()
+
+	// orgsServer serves the organizations with an ETag, counting the
+	// requests and the responses with a body.
+	orgsServer := func(t *testing.T) (u *url.URL, requests, bodies *int32) {
+		requests, bodies = new(int32), new(int32)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(requests, 1)
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			atomic.AddInt32(bodies, 1)
+			err := json.NewEncoder(w).Encode([]coder.Organization{{ID: "org-1", Name: "default"}})
+			assert.Success(t, "encode orgs", err)
+		}))
+		t.Cleanup(server.Close)
+		u, err := url.Parse(server.URL)
+		assert.Success(t, "parse server URL", err)
+		return u, requests, bodies
+	}
+
+	t.Run("Revalidate", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		u, requests, bodies := orgsServer(t)
+		client, err := coder.NewClient(coder.ClientOptions{BaseURL: u, Token: "token", Cache: coder.NewMemoryCache()})
+		assert.Success(t, "create client", err)
+
+		for i := 0; i < 3; i++ {
+			orgs, err := client.Organizations(ctx)
+			assert.Success(t, "get orgs", err)
+			assert.Equal(t, "orgs from cache", "org-1", orgs[0].ID)
+		}
+		assert.Equal(t, "every request revalidated", int32(3), atomic.LoadInt32(requests))
+		assert.Equal(t, "body downloaded once", int32(1), atomic.LoadInt32(bodies))
+
+		err = client.UpdateOrganization(ctx, "org-1", coder.UpdateOrganizationReq{})
+		assert.Success(t, "update org", err)
+		_, err = client.Organizations(ctx)
+		assert.Success(t, "get orgs", err)
+		assert.Equal(t, "purged by the update", int32(2), atomic.LoadInt32(bodies))
+	})
+
+	t.Run("Fresh", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		u, requests, _ := orgsServer(t)
+		dir := t.TempDir()
+		for i := 0; i < 2; i++ {
+			// A new client for each run, sharing the cache on disk.
+			client, err := coder.NewClient(coder.ClientOptions{
+				BaseURL:       u,
+				Token:         "token",
+				Cache:         coder.NewDiskCache(dir),
+				CacheFreshFor: time.Minute,
+			})
+			assert.Success(t, "create client", err)
+			orgs, err := client.Organizations(ctx)
+			assert.Success(t, "get orgs", err)
+			assert.Equal(t, "orgs", "default", orgs[0].Name)
+		}
+		assert.Equal(t, "second run served from disk", int32(1), atomic.LoadInt32(requests))
+
+		other, err := coder.NewClient(coder.ClientOptions{
+			BaseURL:       u,
+			Token:         "other",
+			Cache:         coder.NewDiskCache(dir),
+			CacheFreshFor: time.Minute,
+		})
+		assert.Success(t, "create client", err)
+		_, err = other.Organizations(ctx)
+		assert.Success(t, "get orgs", err)
+		assert.Equal(t, "not shared between sessions", int32(2), atomic.LoadInt32(requests))
+	})
+
+	t.Run("UncachedGet", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		u, requests, _ := orgsServer(t)
+		dir := t.TempDir()
+		for i := 0; i < 2; i++ {
+			// Like every command, check the session before the lookup.
+			client, err := coder.NewClient(coder.ClientOptions{
+				BaseURL:       u,
+				Token:         "token",
+				Cache:         coder.NewDiskCache(dir),
+				CacheFreshFor: time.Minute,
+			})
+			assert.Success(t, "create client", err)
+			_, err = client.APIVersion(ctx)
+			assert.Success(t, "get api version", err)
+			_, err = client.Organizations(ctx)
+			assert.Success(t, "get orgs", err)
+		}
+		// Two version checks, and the orgs of the first run only.
+		assert.Equal(t, "second run orgs served from disk", int32(3), atomic.LoadInt32(requests))
+	})
+
+	t.Run("Allowlist", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.Header().Set("ETag", `"v1"`)
+			err := json.NewEncoder(w).Encode(coder.SSHKey{PrivateKey: "secret"})
+			assert.Success(t, "encode key", err)
+		}))
+		t.Cleanup(server.Close)
+		u, err := url.Parse(server.URL)
+		assert.Success(t, "parse server URL", err)
+
+		dir := t.TempDir()
+		client, err := coder.NewClient(coder.ClientOptions{
+			BaseURL:       u,
+			Token:         "token",
+			Cache:         coder.NewDiskCache(dir),
+			CacheFreshFor: time.Minute,
+		})
+		assert.Success(t, "create client", err)
+		for i := 0; i < 2; i++ {
+			_, err := client.SSHKey(ctx)
+			assert.Success(t, "get ssh key", err)
+		}
+		assert.Equal(t, "not served from cache", int32(2), atomic.LoadInt32(&requests))
+		files, err := filepath.Glob(filepath.Join(dir, "*"))
+		assert.Success(t, "glob", err)
+		assert.Equal(t, "secret not written to disk", 0, len(files))
+	})
+
+	t.Run("MaxAge", func(t *testing.T) {
+		t.Parallel()
+		cache := coder.NewDiskCache(t.TempDir())
+		cache.Set("old", coder.CachedResponse{ETag: `"v1"`, StoredAt: time.Now().Add(-48 * time.Hour)})
+		_, ok := cache.Get("old")
+		assert.True(t, "expired", !ok)
+		cache.Set("new", coder.CachedResponse{ETag: `"v1"`, StoredAt: time.Now()})
+		_, ok = cache.Get("new")
+		assert.True(t, "kept", ok)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"time"
 
+	"cdr.dev/slog"
 	"golang.org/x/xerrors"
 )
 
@@ -50,8 +51,65 @@ type ClientOptions struct {
 	// provider. The client will not retain these credentials in
 	// memory after NewClient returns.
 	Password string
+
+	// Logger receives a debug log for every API request (optional).
+	Logger *slog.Logger
+
+	// Impersonate is the email or ID of a user to act on behalf of (optional).
+	//
+	// Requests are then authorized as that user, and Me refers to them.
+	// The deployment records both users in its audit log. Only site
+	// admins may impersonate other users.
+	Impersonate string
+
+	// ImpersonationReason is recorded in the audit log along with
+	// impersonated requests (optional).
+	ImpersonationReason string
+
+	// ClientInfo describes where requests come from, so that the
+	// deployment's audit log can tell them apart from requests made by
+	// the dashboard (optional). Empty fields are not sent.
+	ClientInfo ClientInfo
+
+	// OnDeprecation is called when a response announces that the request
+	// used a deprecated API (optional). It may be called concurrently.
+	OnDeprecation func(Deprecation)
+
+	// Cache stores the responses to GET requests that carry an ETag, which
+	// are then revalidated with If-None-Match (optional). Only resources
+	// that rarely change are cached, such as images, organizations and
+	// workspace providers. The cache is purged after every successful
+	// request that isn't a GET or HEAD.
+	Cache ResponseCache
+
+	// CacheFreshFor is how long cached responses are reused without
+	// revalidating them (optional). Zero revalidates them on every request.
+	CacheFreshFor time.Duration
 }
 
+// ClientInfo describes the program making requests.
+type ClientInfo struct {
+	// User is the local user running the program.
+	User string
+	// Host is the hostname of the machine running the program.
+	Host string
+	// Command is the command being run, such as "coder workspaces ls".
+	Command string
+}
+
+// Headers used to act on behalf of another user.
+const (
+	ImpersonateHeader         = "Coder-Impersonate"
+	ImpersonationReasonHeader = "Coder-Impersonation-Reason"
+)
+
+// Headers carrying the ClientInfo of requests.
+const (
+	ClientUserHeader    = "Coder-Client-User"
+	ClientHostHeader    = "Coder-Client-Host"
+	ClientCommandHeader = "Coder-Client-Command"
+)
+
 // NewClient creates a new default Coder SDK client.
 func NewClient(opts ClientOptions) (*DefaultClient, error) {
 	httpClient := opts.HTTPClient
@@ -95,6 +153,16 @@ func NewClient(opts ClientOptions) (*DefaultClient, error) {
 		baseURL:    opts.BaseURL,
 		httpClient: httpClient,
 		token:      token,
+
+		impersonate:         opts.Impersonate,
+		impersonationReason: opts.ImpersonationReason,
+		clientInfo:          opts.ClientInfo,
+		onDeprecation:       opts.OnDeprecation,
+		cache:               opts.Cache,
+		cacheFreshFor:       opts.CacheFreshFor,
+	}
+	if opts.Logger != nil {
+		client.log = *opts.Logger
 	}
 
 	return client, nil
@@ -115,6 +183,45 @@ type DefaultClient struct {
 
 	// token is the API Token credential.
 	token string
+
+	// log receives request logs. The zero value discards them.
+	log slog.Logger
+
+	// impersonate is the user requests are made on behalf of, if any.
+	impersonate         string
+	impersonationReason string
+
+	// clientInfo attributes requests in the audit log.
+	clientInfo ClientInfo
+
+	// onDeprecation is called for responses announcing a deprecation.
+	onDeprecation func(Deprecation)
+
+	// cache, if set, stores the responses to GET requests.
+	cache         ResponseCache
+	cacheFreshFor time.Duration
+}
+
+// setAuthHeaders sets the headers authenticating and attributing requests
+// made by the client.
+func (c *DefaultClient) setAuthHeaders(h http.Header) {
+	h.Set("Session-Token", c.token)
+	for header, value := range map[string]string{
+		ClientUserHeader:    c.clientInfo.User,
+		ClientHostHeader:    c.clientInfo.Host,
+		ClientCommandHeader: c.clientInfo.Command,
+	} {
+		if value != "" {
+			h.Set(header, value)
+		}
+	}
+	if c.impersonate == "" {
+		return
+	}
+	h.Set(ImpersonateHeader, c.impersonate)
+	if c.impersonationReason != "" {
+		h.Set(ImpersonationReasonHeader, c.impersonationReason)
+	}
 }
 
 // Token returns the API Token used to authenticate.
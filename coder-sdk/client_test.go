@@ -1,14 +1,18 @@
 package coder_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
+	"cdr.dev/slog"
+	"cdr.dev/slog/sloggers/sloghuman"
 	"cdr.dev/slog/sloggers/slogtest/assert"
 
 	"cdr.dev/coder-cli/coder-sdk"
@@ -153,3 +157,139 @@ func TestContextRoot(t *testing.T) {
 		assert.Error(t, "expected 503 error", err)
 	}
 }
+
+func TestRequestLogging(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	u, err := url.Parse(server.URL)
+	assert.Success(t, "failed to parse test server URL", err)
+
+	var buf bytes.Buffer
+	log := slog.Make(sloghuman.Sink(&buf)).Leveled(slog.LevelDebug)
+	client, err := coder.NewClient(coder.ClientOptions{
+		BaseURL: u,
+		Token:   "FrOgA6xhpM-p5nTfsupmvzYJA6DJSOUoE",
+		Logger:  &log,
+	})
+	assert.Success(t, "failed to create coder.Client", err)
+
+	_, err = client.Users(context.Background())
+	assert.Error(t, "expected 503 error", err)
+
+	out := buf.String()
+	assert.True(t, "request logged", strings.Contains(out, "api request"))
+	assert.True(t, "path logged", strings.Contains(out, "/api/v0/users"))
+	assert.True(t, "status logged", strings.Contains(out, "503"))
+	assert.True(t, "token not logged", !strings.Contains(out, "FrOgA6xhpM"))
+}
+
+func TestImpersonation(t *testing.T) {
+	t.Parallel()
+
+	const token = "g4mtIPUaKt-pPl9Q0xmgKs7acSypHt4Jf"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token", token, r.Header.Get("Session-Token"))
+		assert.Equal(t, "impersonated user", "charlie@coder.com", r.Header.Get(coder.ImpersonateHeader))
+		assert.Equal(t, "reason", "support ticket 1234", r.Header.Get(coder.ImpersonationReasonHeader))
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	u, err := url.Parse(server.URL)
+	assert.Success(t, "failed to parse test server URL", err)
+
+	client, err := coder.NewClient(coder.ClientOptions{
+		BaseURL:             u,
+		Token:               token,
+		Impersonate:         "charlie@coder.com",
+		ImpersonationReason: "support ticket 1234",
+	})
+	assert.Success(t, "failed to create coder.Client", err)
+
+	_, err = client.APIVersion(context.Background())
+	assert.Success(t, "failed to get API version information", err)
+}
+
+func TestClientInfo(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "user", "alice", r.Header.Get(coder.ClientUserHeader))
+		assert.Equal(t, "host", "", r.Header.Get(coder.ClientHostHeader))
+		_, sent := r.Header[coder.ClientHostHeader]
+		assert.False(t, "empty host not sent", sent)
+		assert.Equal(t, "command", "coder workspaces ls", r.Header.Get(coder.ClientCommandHeader))
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	u, err := url.Parse(server.URL)
+	assert.Success(t, "failed to parse test server URL", err)
+
+	client, err := coder.NewClient(coder.ClientOptions{
+		BaseURL: u,
+		Token:   "g4mtIPUaKt-pPl9Q0xmgKs7acSypHt4Jf",
+		ClientInfo: coder.ClientInfo{
+			User:    "alice",
+			Command: "coder workspaces ls",
+		},
+	})
+	assert.Success(t, "failed to create coder.Client", err)
+
+	_, err = client.APIVersion(context.Background())
+	assert.Success(t, "failed to get API version information", err)
+}
+
+func TestDeprecation(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" {
+			w.Header().Set("Deprecation", "@1625097600")
+			w.Header().Set("Sunset", "Fri, 31 Dec 2021 23:59:59 GMT")
+			w.Header().Add("Link", `<https://coder.com/docs/api>; rel="alternate", <https://coder.com/docs/changelog>; rel="deprecation"`)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	u, err := url.Parse(server.URL)
+	assert.Success(t, "failed to parse test server URL", err)
+
+	var deprecations []coder.Deprecation
+	client, err := coder.NewClient(coder.ClientOptions{
+		BaseURL: u,
+		Token:   "g4mtIPUaKt-pPl9Q0xmgKs7acSypHt4Jf",
+		OnDeprecation: func(d coder.Deprecation) {
+			deprecations = append(deprecations, d)
+		},
+	})
+	assert.Success(t, "failed to create coder.Client", err)
+
+	_, err = client.APIVersion(context.Background())
+	assert.Success(t, "failed to get API version information", err)
+	assert.Equal(t, "one deprecation", 1, len(deprecations))
+	assert.Equal(t, "deprecation", coder.Deprecation{
+		Method: http.MethodGet,
+		Path:   "/api",
+		Date:   time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC),
+		Sunset: time.Date(2021, 12, 31, 23, 59, 59, 0, time.UTC),
+		Link:   "https://coder.com/docs/changelog",
+	}, deprecations[0])
+}
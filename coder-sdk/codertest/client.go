@@ -0,0 +1,1375 @@
+package codertest
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"cdr.dev/wsep"
+	"github.com/pion/webrtc/v3"
+	"golang.org/x/xerrors"
+	"nhooyr.io/websocket"
+
+	"cdr.dev/coder-cli/coder-sdk"
+)
+
+// PushActivity records the call.
+func (f *Fake) PushActivity(_ context.Context, source, workspaceID string) error {
+	_, err := f.call("PushActivity", source, workspaceID)
+	return err
+}
+
+// Me returns the authenticated user.
+func (f *Fake) Me(_ context.Context) (*coder.User, error) {
+	if _, err := f.call("Me"); err != nil {
+		return nil, err
+	}
+	return f.userByID(coder.Me)
+}
+
+// UserByID returns the user with the given ID.
+func (f *Fake) UserByID(_ context.Context, id string) (*coder.User, error) {
+	if _, err := f.call("UserByID", id); err != nil {
+		return nil, err
+	}
+	return f.userByID(id)
+}
+
+func (f *Fake) userByID(id string) (*coder.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u := f.user(id)
+	if u == nil {
+		return nil, coder.ErrNotFound
+	}
+	user := *u
+	return &user, nil
+}
+
+// SSHKey returns a placeholder keypair.
+func (f *Fake) SSHKey(_ context.Context) (*coder.SSHKey, error) {
+	if _, err := f.call("SSHKey"); err != nil {
+		return nil, err
+	}
+	return &coder.SSHKey{PublicKey: "ssh-ed25519 AAAA fake", PrivateKey: "fake"}, nil
+}
+
+// Users returns all users.
+func (f *Fake) Users(_ context.Context) ([]coder.User, error) {
+	if _, err := f.call("Users"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]coder.User(nil), f.users...), nil
+}
+
+// UserByEmail returns the user with the given email.
+func (f *Fake) UserByEmail(_ context.Context, email string) (*coder.User, error) {
+	if _, err := f.call("UserByEmail", email); err != nil {
+		return nil, err
+	}
+	if email == coder.Me {
+		return f.userByID(coder.Me)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, u := range f.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, coder.ErrNotFound
+}
+
+// UpdateUser applies the non-nil fields of req to the user.
+func (f *Fake) UpdateUser(_ context.Context, userID string, req coder.UpdateUserReq) error {
+	if _, err := f.call("UpdateUser", userID, req); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u := f.user(userID)
+	if u == nil {
+		return coder.ErrNotFound
+	}
+	if req.Roles != nil {
+		u.Roles = *req.Roles
+	}
+	if req.LoginType != nil {
+		u.LoginType = string(*req.LoginType)
+	}
+	if req.Name != nil {
+		u.Name = *req.Name
+	}
+	if req.Username != nil {
+		u.Username = *req.Username
+	}
+	if req.Email != nil {
+		u.Email = *req.Email
+	}
+	if req.Revoked != nil {
+		u.Revoked = *req.Revoked
+	}
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateUXState records the call.
+func (f *Fake) UpdateUXState(_ context.Context, userID string, uxsPartial map[string]interface{}) error {
+	_, err := f.call("UpdateUXState", userID, uxsPartial)
+	return err
+}
+
+// CreateUser adds a user to the given organizations.
+func (f *Fake) CreateUser(_ context.Context, req coder.CreateUserReq) error {
+	if _, err := f.call("CreateUser", req); err != nil {
+		return err
+	}
+	f.AddUser(coder.User{
+		Email:             req.Email,
+		Username:          req.Username,
+		Name:              req.Name,
+		LoginType:         string(req.LoginType),
+		TemporaryPassword: req.TemporaryPassword,
+		Roles:             []coder.Role{coder.SiteMember},
+	}, req.OrganizationsIDs...)
+	return nil
+}
+
+// DeleteUser removes the user and its organization memberships.
+func (f *Fake) DeleteUser(_ context.Context, userID string) error {
+	if _, err := f.call("DeleteUser", userID); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	userID = f.resolveUserID(userID)
+	for i, u := range f.users {
+		if u.ID != userID {
+			continue
+		}
+		f.users = append(f.users[:i], f.users[i+1:]...)
+		for j := range f.orgs {
+			members := f.orgs[j].Members[:0]
+			for _, m := range f.orgs[j].Members {
+				if m.ID != userID {
+					members = append(members, m)
+				}
+			}
+			f.orgs[j].Members = members
+		}
+		return nil
+	}
+	return coder.ErrNotFound
+}
+
+// SiteConfigAuth is not modelled.
+func (f *Fake) SiteConfigAuth(_ context.Context) (*coder.ConfigAuth, error) {
+	return nil, f.unimplemented("SiteConfigAuth")
+}
+
+// PutSiteConfigAuth is not modelled.
+func (f *Fake) PutSiteConfigAuth(_ context.Context, req coder.ConfigAuth) error {
+	return f.unimplemented("PutSiteConfigAuth", req)
+}
+
+// SiteConfigOAuth is not modelled.
+func (f *Fake) SiteConfigOAuth(_ context.Context) (*coder.ConfigOAuth, error) {
+	return nil, f.unimplemented("SiteConfigOAuth")
+}
+
+// PutSiteConfigOAuth is not modelled.
+func (f *Fake) PutSiteConfigOAuth(_ context.Context, req coder.ConfigOAuth) error {
+	return f.unimplemented("PutSiteConfigOAuth", req)
+}
+
+// SiteSetupModeEnabled always reports that setup mode is disabled.
+func (f *Fake) SiteSetupModeEnabled(_ context.Context) (bool, error) {
+	_, err := f.call("SiteSetupModeEnabled")
+	return false, err
+}
+
+// SiteConfigExtensionMarketplace is not modelled.
+func (f *Fake) SiteConfigExtensionMarketplace(_ context.Context) (*coder.ConfigExtensionMarketplace, error) {
+	return nil, f.unimplemented("SiteConfigExtensionMarketplace")
+}
+
+// PutSiteConfigExtensionMarketplace is not modelled.
+func (f *Fake) PutSiteConfigExtensionMarketplace(_ context.Context, req coder.ConfigExtensionMarketplace) error {
+	return f.unimplemented("PutSiteConfigExtensionMarketplace", req)
+}
+
+// SiteConfigWorkspaces is not modelled.
+func (f *Fake) SiteConfigWorkspaces(_ context.Context) (*coder.ConfigWorkspaces, error) {
+	return nil, f.unimplemented("SiteConfigWorkspaces")
+}
+
+// SiteConfigCLIRollout returns the configuration set with
+// PutSiteConfigCLIRollout, or ErrNotFound if none was set, like deployments
+// that don't support staged rollouts.
+func (f *Fake) SiteConfigCLIRollout(_ context.Context) (*coder.ConfigCLIRollout, error) {
+	if _, err := f.call("SiteConfigCLIRollout"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cliRollout == nil {
+		return nil, coder.ErrNotFound
+	}
+	conf := *f.cliRollout
+	return &conf, nil
+}
+
+// PutSiteConfigCLIRollout stores the CLI rollout configuration.
+func (f *Fake) PutSiteConfigCLIRollout(_ context.Context, req coder.ConfigCLIRollout) error {
+	if _, err := f.call("PutSiteConfigCLIRollout", req); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cliRollout = &req
+	return nil
+}
+
+// DeleteDevURL removes a DevURL from the workspace.
+func (f *Fake) DeleteDevURL(_ context.Context, workspaceID, urlID string) error {
+	if _, err := f.call("DeleteDevURL", workspaceID, urlID); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	urls := f.devURLs[workspaceID]
+	for i, u := range urls {
+		if u.ID == urlID {
+			f.devURLs[workspaceID] = append(urls[:i], urls[i+1:]...)
+			return nil
+		}
+	}
+	return coder.ErrNotFound
+}
+
+// CreateDevURL adds a DevURL to the workspace.
+func (f *Fake) CreateDevURL(_ context.Context, workspaceID string, req coder.CreateDevURLReq) error {
+	if _, err := f.call("CreateDevURL", workspaceID, req); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.workspace(workspaceID) == nil {
+		return coder.ErrNotFound
+	}
+	id := f.newID("devurl")
+	f.devURLs[workspaceID] = append(f.devURLs[workspaceID], coder.DevURL{
+		ID:     id,
+		URL:    fmt.Sprintf("%s-%d.%s", id, req.Port, f.baseURL.Host),
+		Port:   req.Port,
+		Access: req.Access,
+		Name:   req.Name,
+		Scheme: req.Scheme,
+	})
+	return nil
+}
+
+// DevURLs returns the DevURLs of the workspace.
+func (f *Fake) DevURLs(_ context.Context, workspaceID string) ([]coder.DevURL, error) {
+	if _, err := f.call("DevURLs", workspaceID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]coder.DevURL(nil), f.devURLs[workspaceID]...), nil
+}
+
+// CreateTunnelShare adds a share link to the workspace.
+func (f *Fake) CreateTunnelShare(_ context.Context, workspaceID string, req coder.CreateTunnelShareReq) (*coder.TunnelShare, error) {
+	if _, err := f.call("CreateTunnelShare", workspaceID, req); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.workspace(workspaceID) == nil {
+		return nil, coder.ErrNotFound
+	}
+	id := f.newID("share")
+	now := time.Now()
+	share := coder.TunnelShare{
+		ID:          id,
+		WorkspaceID: workspaceID,
+		Port:        req.Port,
+		URL:         fmt.Sprintf("https://%s/share/%s", f.baseURL.Host, id),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Duration(req.ExpiresIn)),
+	}
+	f.shares[workspaceID] = append(f.shares[workspaceID], share)
+	return &share, nil
+}
+
+// TunnelShares returns the share links of the workspace that haven't
+// expired.
+func (f *Fake) TunnelShares(_ context.Context, workspaceID string) ([]coder.TunnelShare, error) {
+	if _, err := f.call("TunnelShares", workspaceID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var shares []coder.TunnelShare
+	for _, share := range f.shares[workspaceID] {
+		if time.Now().Before(share.ExpiresAt) {
+			shares = append(shares, share)
+		}
+	}
+	return shares, nil
+}
+
+// RevokeTunnelShare removes a share link from the workspace.
+func (f *Fake) RevokeTunnelShare(_ context.Context, workspaceID, shareID string) error {
+	if _, err := f.call("RevokeTunnelShare", workspaceID, shareID); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	shares := f.shares[workspaceID]
+	for i, share := range shares {
+		if share.ID == shareID {
+			f.shares[workspaceID] = append(shares[:i], shares[i+1:]...)
+			return nil
+		}
+	}
+	return coder.ErrNotFound
+}
+
+// PutDevURL updates a DevURL of the workspace.
+func (f *Fake) PutDevURL(_ context.Context, workspaceID, urlID string, req coder.PutDevURLReq) error {
+	if _, err := f.call("PutDevURL", workspaceID, urlID, req); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, u := range f.devURLs[workspaceID] {
+		if u.ID == urlID {
+			u.Port, u.Access, u.Name, u.Scheme = req.Port, req.Access, req.Name, req.Scheme
+			f.devURLs[workspaceID][i] = u
+			return nil
+		}
+	}
+	return coder.ErrNotFound
+}
+
+// CreateWorkspace adds a running workspace owned by the authenticated user.
+func (f *Fake) CreateWorkspace(_ context.Context, req coder.CreateWorkspaceRequest) (*coder.Workspace, error) {
+	if _, err := f.call("CreateWorkspace", req); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	if f.org(req.OrgID) == nil {
+		f.mu.Unlock()
+		return nil, xerrors.Errorf("organization %q: %w", req.OrgID, coder.ErrNotFound)
+	}
+	for _, w := range f.workspaces {
+		if w.UserID == f.meID && w.Name == req.Name {
+			f.mu.Unlock()
+			return nil, xerrors.Errorf("workspace %q already exists", req.Name)
+		}
+	}
+	f.mu.Unlock()
+
+	now := time.Now()
+	id := f.AddWorkspace(coder.Workspace{
+		Name:           req.Name,
+		ImageID:        req.ImageID,
+		ImageTag:       req.ImageTag,
+		ImageDigest:    req.ImageDigest,
+		OrganizationID: req.OrgID,
+		CPUCores:       req.CPUCores,
+		MemoryGB:       req.MemoryGB,
+		DiskGB:         req.DiskGB,
+		GPUs:           req.GPUs,
+		UseContainerVM: req.UseContainerVM,
+		ResourcePoolID: req.ResourcePoolID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		LastBuiltAt:    now,
+	})
+	w, _ := f.Workspace(id)
+	return &w, nil
+}
+
+// ParseTemplate is not modelled.
+func (f *Fake) ParseTemplate(_ context.Context, req coder.ParseTemplateRequest) (*coder.TemplateVersion, error) {
+	return nil, f.unimplemented("ParseTemplate", req)
+}
+
+// CreateWorkspaceFromRepo is not modelled.
+func (f *Fake) CreateWorkspaceFromRepo(_ context.Context, orgID string, req coder.TemplateVersion) (*coder.Workspace, error) {
+	return nil, f.unimplemented("CreateWorkspaceFromRepo", orgID, req)
+}
+
+// Workspaces returns all workspaces.
+func (f *Fake) Workspaces(_ context.Context) ([]coder.Workspace, error) {
+	if _, err := f.call("Workspaces"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]coder.Workspace(nil), f.workspaces...), nil
+}
+
+// EachWorkspace calls fn with each workspace, stopping at its first error.
+func (f *Fake) EachWorkspace(_ context.Context, fn func(coder.Workspace) error) error {
+	if _, err := f.call("EachWorkspace"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	workspaces := append([]coder.Workspace(nil), f.workspaces...)
+	f.mu.Unlock()
+	for _, w := range workspaces {
+		if err := fn(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UserWorkspacesByOrganization returns the user's workspaces in the organization.
+func (f *Fake) UserWorkspacesByOrganization(_ context.Context, userID, orgID string) ([]coder.Workspace, error) {
+	if _, err := f.call("UserWorkspacesByOrganization", userID, orgID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	userID = f.resolveUserID(userID)
+	var workspaces []coder.Workspace
+	for _, w := range f.workspaces {
+		if w.UserID == userID && w.OrganizationID == orgID {
+			workspaces = append(workspaces, w)
+		}
+	}
+	return workspaces, nil
+}
+
+// DeleteWorkspace removes the workspace.
+func (f *Fake) DeleteWorkspace(_ context.Context, workspaceID string) error {
+	if _, err := f.call("DeleteWorkspace", workspaceID); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, w := range f.workspaces {
+		if w.ID == workspaceID {
+			f.workspaces = append(f.workspaces[:i], f.workspaces[i+1:]...)
+			delete(f.devURLs, workspaceID)
+			return nil
+		}
+	}
+	return coder.ErrNotFound
+}
+
+// StopWorkspace turns the workspace off.
+func (f *Fake) StopWorkspace(_ context.Context, workspaceID string) error {
+	if _, err := f.call("StopWorkspace", workspaceID); err != nil {
+		return err
+	}
+	return f.setStatus(workspaceID, coder.WorkspaceOff, nil)
+}
+
+// RebuildWorkspace rebuilds the workspace, which immediately turns on.
+func (f *Fake) RebuildWorkspace(_ context.Context, workspaceID string) error {
+	if _, err := f.call("RebuildWorkspace", workspaceID); err != nil {
+		return err
+	}
+	return f.setStatus(workspaceID, coder.WorkspaceOn, func(w *coder.Workspace) {
+		w.LastBuiltAt = time.Now()
+		w.RebuildMessages = nil
+	})
+}
+
+// EditWorkspace applies the non-nil fields of req and rebuilds the workspace.
+func (f *Fake) EditWorkspace(_ context.Context, workspaceID string, req coder.UpdateWorkspaceReq) error {
+	if _, err := f.call("EditWorkspace", workspaceID, req); err != nil {
+		return err
+	}
+	return f.setStatus(workspaceID, coder.WorkspaceOn, func(w *coder.Workspace) {
+		if req.ImageID != nil {
+			w.ImageID = *req.ImageID
+		}
+		if req.ImageTag != nil {
+			w.ImageTag = *req.ImageTag
+			w.ImageDigest = ""
+		}
+		if req.ImageDigest != nil {
+			w.ImageDigest = *req.ImageDigest
+		}
+		if req.CPUCores != nil {
+			w.CPUCores = *req.CPUCores
+		}
+		if req.MemoryGB != nil {
+			w.MemoryGB = *req.MemoryGB
+		}
+		if req.DiskGB != nil {
+			w.DiskGB = *req.DiskGB
+		}
+		if req.GPUs != nil {
+			w.GPUs = *req.GPUs
+		}
+		w.LastBuiltAt = time.Now()
+	})
+}
+
+func (f *Fake) setStatus(workspaceID string, status coder.WorkspaceStatus, update func(*coder.Workspace)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := f.workspace(workspaceID)
+	if w == nil {
+		return coder.ErrNotFound
+	}
+	w.LatestStat.ContainerStatus = status
+	w.LatestStat.Time = time.Now()
+	w.UpdatedAt = w.LatestStat.Time
+	if update != nil {
+		update(w)
+	}
+	return nil
+}
+
+// DialWsep is not modelled.
+func (f *Fake) DialWsep(_ context.Context, baseURL *url.URL, workspaceID string) (*websocket.Conn, error) {
+	return nil, f.unimplemented("DialWsep", baseURL, workspaceID)
+}
+
+// DialExecutor is not modelled.
+func (f *Fake) DialExecutor(_ context.Context, baseURL *url.URL, workspaceID string) (wsep.Execer, error) {
+	return nil, f.unimplemented("DialExecutor", baseURL, workspaceID)
+}
+
+// DialIDEStatus is not modelled.
+func (f *Fake) DialIDEStatus(_ context.Context, baseURL *url.URL, workspaceID string) (*websocket.Conn, error) {
+	return nil, f.unimplemented("DialIDEStatus", baseURL, workspaceID)
+}
+
+// DialWorkspaceBuildLog is not modelled. Use FollowWorkspaceBuildLog instead.
+func (f *Fake) DialWorkspaceBuildLog(_ context.Context, workspaceID string) (*websocket.Conn, error) {
+	return nil, f.unimplemented("DialWorkspaceBuildLog", workspaceID)
+}
+
+// FollowWorkspaceBuildLog emits the build log set with SetBuildLog.
+func (f *Fake) FollowWorkspaceBuildLog(ctx context.Context, workspaceID string) (<-chan coder.BuildLogFollowMsg, error) {
+	if _, err := f.call("FollowWorkspaceBuildLog", workspaceID); err != nil {
+		return nil, err
+	}
+	logs, err := f.buildLog(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan coder.BuildLogFollowMsg)
+	go func() {
+		defer close(ch)
+		for _, l := range logs {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- coder.BuildLogFollowMsg{BuildLog: l}:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// WorkspaceBuildLogs returns the build log set with SetBuildLog.
+func (f *Fake) WorkspaceBuildLogs(_ context.Context, workspaceID string) ([]coder.BuildLog, error) {
+	if _, err := f.call("WorkspaceBuildLogs", workspaceID); err != nil {
+		return nil, err
+	}
+	return f.buildLog(workspaceID)
+}
+
+// buildLog returns the build log of the workspace, a successful start/done
+// log unless one was set with SetBuildLog.
+func (f *Fake) buildLog(workspaceID string) ([]coder.BuildLog, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.workspace(workspaceID) == nil {
+		return nil, coder.ErrNotFound
+	}
+	if logs, ok := f.buildLogs[workspaceID]; ok {
+		return append([]coder.BuildLog(nil), logs...), nil
+	}
+	now := time.Now()
+	return []coder.BuildLog{
+		{WorkspaceID: workspaceID, Time: now, Type: coder.BuildLogTypeStart, Msg: "Starting build"},
+		{WorkspaceID: workspaceID, Time: now, Type: coder.BuildLogTypeDone, Msg: "Build complete"},
+	}, nil
+}
+
+// WorkspaceLogs returns the output added with AddWorkspaceLogs selected by
+// req.
+func (f *Fake) WorkspaceLogs(_ context.Context, workspaceID string, req coder.WorkspaceLogsReq) ([]coder.WorkspaceLog, error) {
+	if _, err := f.call("WorkspaceLogs", workspaceID, req); err != nil {
+		return nil, err
+	}
+	return f.workspaceLogs(workspaceID, req)
+}
+
+func (f *Fake) workspaceLogs(workspaceID string, req coder.WorkspaceLogsReq) ([]coder.WorkspaceLog, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.workspace(workspaceID) == nil {
+		return nil, coder.ErrNotFound
+	}
+	var logs []coder.WorkspaceLog
+	for _, l := range f.logs[workspaceID] {
+		if !l.Time.Before(req.Since) {
+			logs = append(logs, l)
+		}
+	}
+	if req.Tail > 0 && len(logs) > req.Tail {
+		logs = logs[len(logs)-req.Tail:]
+	}
+	return logs, nil
+}
+
+// DialWorkspaceLogs is not modelled. Use FollowWorkspaceLogs instead.
+func (f *Fake) DialWorkspaceLogs(_ context.Context, workspaceID string, req coder.WorkspaceLogsReq) (*websocket.Conn, error) {
+	return nil, f.unimplemented("DialWorkspaceLogs", workspaceID, req)
+}
+
+// FollowWorkspaceLogs emits the output returned by WorkspaceLogs, then
+// closes the channel once ctx is done, as if nothing else was written.
+func (f *Fake) FollowWorkspaceLogs(ctx context.Context, workspaceID string, req coder.WorkspaceLogsReq) (<-chan coder.WorkspaceLogFollowMsg, error) {
+	if _, err := f.call("FollowWorkspaceLogs", workspaceID, req); err != nil {
+		return nil, err
+	}
+	logs, err := f.workspaceLogs(workspaceID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan coder.WorkspaceLogFollowMsg)
+	go func() {
+		defer close(ch)
+		for _, l := range logs {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- coder.WorkspaceLogFollowMsg{WorkspaceLog: l}:
+			}
+		}
+		<-ctx.Done()
+	}()
+	return ch, nil
+}
+
+// SubscribeEvents streams the events added with AddEvents that match the
+// filter, then blocks until ctx is done, as if no other event happened.
+func (f *Fake) SubscribeEvents(ctx context.Context, filter coder.EventFilter, handlers coder.EventHandlers) error {
+	if _, err := f.call("SubscribeEvents", filter); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	events := append([]coder.Event(nil), f.events...)
+	f.mu.Unlock()
+	for _, ev := range events {
+		if filter.Matches(ev) {
+			handlers.Handle(ev)
+		}
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// DialWorkspaceStats is not modelled.
+func (f *Fake) DialWorkspaceStats(_ context.Context, workspaceID string) (*websocket.Conn, error) {
+	return nil, f.unimplemented("DialWorkspaceStats", workspaceID)
+}
+
+// DialResourceLoad is not modelled.
+func (f *Fake) DialResourceLoad(_ context.Context, workspaceID string) (*websocket.Conn, error) {
+	return nil, f.unimplemented("DialResourceLoad", workspaceID)
+}
+
+// WaitForWorkspaceReady returns once the workspace exists.
+// Workspaces in the fake are ready as soon as they are built.
+func (f *Fake) WaitForWorkspaceReady(_ context.Context, workspaceID string) error {
+	if _, err := f.call("WaitForWorkspaceReady", workspaceID); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.workspace(workspaceID) == nil {
+		return coder.ErrNotFound
+	}
+	return nil
+}
+
+// WorkspaceByID returns the workspace with the given ID.
+func (f *Fake) WorkspaceByID(_ context.Context, id string) (*coder.Workspace, error) {
+	if _, err := f.call("WorkspaceByID", id); err != nil {
+		return nil, err
+	}
+	w, ok := f.Workspace(id)
+	if !ok {
+		return nil, coder.ErrNotFound
+	}
+	return &w, nil
+}
+
+// WorkspacesByWorkspaceProvider returns the workspaces deployed to the provider.
+func (f *Fake) WorkspacesByWorkspaceProvider(_ context.Context, wpID string) ([]coder.Workspace, error) {
+	if _, err := f.call("WorkspacesByWorkspaceProvider", wpID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var workspaces []coder.Workspace
+	for _, w := range f.workspaces {
+		if w.ResourcePoolID == wpID {
+			workspaces = append(workspaces, w)
+		}
+	}
+	return workspaces, nil
+}
+
+// ImportImage adds an image with the requested tag.
+func (f *Fake) ImportImage(_ context.Context, req coder.ImportImageReq) (*coder.Image, error) {
+	if _, err := f.call("ImportImage", req); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	id := f.AddImage(coder.Image{
+		OrganizationID:  req.OrgID,
+		Repository:      req.Repository,
+		Description:     req.Description,
+		URL:             req.URL,
+		DefaultCPUCores: req.DefaultCPUCores,
+		DefaultMemoryGB: float32(req.DefaultMemoryGB),
+		DefaultDiskGB:   req.DefaultDiskGB,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}, req.Tag)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img := *f.image(id)
+	return &img, nil
+}
+
+// ImageByID returns the image with the given ID.
+func (f *Fake) ImageByID(_ context.Context, id string) (*coder.Image, error) {
+	if _, err := f.call("ImageByID", id); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img := f.image(id)
+	if img == nil {
+		return nil, coder.ErrNotFound
+	}
+	i := *img
+	return &i, nil
+}
+
+// OrganizationImages returns the images imported into the organization.
+func (f *Fake) OrganizationImages(_ context.Context, orgID string) ([]coder.Image, error) {
+	if _, err := f.call("OrganizationImages", orgID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var imgs []coder.Image
+	for _, img := range f.images {
+		if img.OrganizationID == orgID {
+			imgs = append(imgs, img)
+		}
+	}
+	return imgs, nil
+}
+
+// UpdateImage applies the non-nil fields of req to the image.
+func (f *Fake) UpdateImage(_ context.Context, imageID string, req coder.UpdateImageReq) error {
+	if _, err := f.call("UpdateImage", imageID, req); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img := f.image(imageID)
+	if img == nil {
+		return coder.ErrNotFound
+	}
+	if req.DefaultCPUCores != nil {
+		img.DefaultCPUCores = *req.DefaultCPUCores
+	}
+	if req.DefaultMemoryGB != nil {
+		img.DefaultMemoryGB = *req.DefaultMemoryGB
+	}
+	if req.DefaultDiskGB != nil {
+		img.DefaultDiskGB = *req.DefaultDiskGB
+	}
+	if req.Description != nil {
+		img.Description = *req.Description
+	}
+	if req.URL != nil {
+		img.URL = *req.URL
+	}
+	if req.Deprecated != nil {
+		img.Deprecated = *req.Deprecated
+	}
+	if req.DefaultTag != nil {
+		tag := f.tag(imageID, *req.DefaultTag)
+		if tag == nil {
+			return xerrors.Errorf("tag %q: %w", *req.DefaultTag, coder.ErrNotFound)
+		}
+		t := *tag
+		img.DefaultTag = &t
+	}
+	img.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateImageTags marks the digests of all tags of the image as refreshed.
+func (f *Fake) UpdateImageTags(_ context.Context, imageID string) error {
+	if _, err := f.call("UpdateImageTags", imageID); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.image(imageID) == nil {
+		return coder.ErrNotFound
+	}
+	now := time.Now()
+	for i := range f.tags[imageID] {
+		f.tags[imageID][i].HashLastUpdatedAt = now
+	}
+	return nil
+}
+
+// PrepullImage records a pre-pull that completes immediately on every
+// targeted provider.
+func (f *Fake) PrepullImage(_ context.Context, imageID string, req coder.PrepullImageReq) (*coder.ImagePrepull, error) {
+	if _, err := f.call("PrepullImage", imageID, req); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.image(imageID) == nil {
+		return nil, coder.ErrNotFound
+	}
+	nodes := len(req.ProviderIDs)
+	if nodes == 0 {
+		nodes = len(f.providers)
+	}
+	now := time.Now()
+	p := coder.ImagePrepull{
+		ID:             f.newID("prepull"),
+		ImageID:        imageID,
+		Tag:            req.Tag,
+		State:          coder.PrepullStateDone,
+		TotalNodes:     nodes,
+		CompletedNodes: nodes,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	f.prepulls[p.ID] = p
+	return &p, nil
+}
+
+// ImagePrepullByID returns a pre-pull started with PrepullImage.
+func (f *Fake) ImagePrepullByID(_ context.Context, imageID, prepullID string) (*coder.ImagePrepull, error) {
+	if _, err := f.call("ImagePrepullByID", imageID, prepullID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.prepulls[prepullID]
+	if !ok || p.ImageID != imageID {
+		return nil, coder.ErrNotFound
+	}
+	return &p, nil
+}
+
+// Organizations returns all organizations.
+func (f *Fake) Organizations(_ context.Context) ([]coder.Organization, error) {
+	if _, err := f.call("Organizations"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]coder.Organization(nil), f.orgs...), nil
+}
+
+// OrganizationByID returns the organization with the given ID.
+func (f *Fake) OrganizationByID(_ context.Context, orgID string) (*coder.Organization, error) {
+	if _, err := f.call("OrganizationByID", orgID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	org := f.org(orgID)
+	if org == nil {
+		return nil, coder.ErrNotFound
+	}
+	o := *org
+	return &o, nil
+}
+
+// OrganizationMembers returns the members of the organization.
+func (f *Fake) OrganizationMembers(_ context.Context, orgID string) ([]coder.OrganizationUser, error) {
+	if _, err := f.call("OrganizationMembers", orgID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	org := f.org(orgID)
+	if org == nil {
+		return nil, coder.ErrNotFound
+	}
+	return append([]coder.OrganizationUser(nil), org.Members...), nil
+}
+
+// UpdateOrganization applies the non-nil fields of req to the organization.
+func (f *Fake) UpdateOrganization(_ context.Context, orgID string, req coder.UpdateOrganizationReq) error {
+	if _, err := f.call("UpdateOrganization", orgID, req); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	org := f.org(orgID)
+	if org == nil {
+		return coder.ErrNotFound
+	}
+	if req.Name != nil {
+		org.Name = *req.Name
+	}
+	if req.Description != nil {
+		org.Description = *req.Description
+	}
+	if req.Default != nil {
+		org.Default = *req.Default
+	}
+	if req.AutoOffThreshold != nil {
+		org.AutoOffThreshold = *req.AutoOffThreshold
+	}
+	if req.CPUProvisioningRate != nil {
+		org.CPUProvisioningRate = *req.CPUProvisioningRate
+	}
+	if req.MemoryProvisioningRate != nil {
+		org.MemoryProvisioningRate = *req.MemoryProvisioningRate
+	}
+	org.UpdatedAt = time.Now()
+	return nil
+}
+
+// CreateOrganization adds an organization.
+func (f *Fake) CreateOrganization(_ context.Context, req coder.CreateOrganizationReq) error {
+	if _, err := f.call("CreateOrganization", req); err != nil {
+		return err
+	}
+	now := time.Now()
+	f.AddOrganization(coder.Organization{
+		Name:                   req.Name,
+		Description:            req.Description,
+		Default:                req.Default,
+		ResourceNamespace:      req.ResourceNamespace,
+		AutoOffThreshold:       req.AutoOffThreshold,
+		CPUProvisioningRate:    req.CPUProvisioningRate,
+		MemoryProvisioningRate: req.MemoryProvisioningRate,
+		CreatedAt:              now,
+		UpdatedAt:              now,
+	})
+	return nil
+}
+
+// DeleteOrganization removes the organization.
+func (f *Fake) DeleteOrganization(_ context.Context, orgID string) error {
+	if _, err := f.call("DeleteOrganization", orgID); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, org := range f.orgs {
+		if org.ID == orgID {
+			f.orgs = append(f.orgs[:i], f.orgs[i+1:]...)
+			return nil
+		}
+	}
+	return coder.ErrNotFound
+}
+
+// Registries is not modelled.
+func (f *Fake) Registries(_ context.Context, orgID string) ([]coder.Registry, error) {
+	return nil, f.unimplemented("Registries", orgID)
+}
+
+// RegistryByID is not modelled.
+func (f *Fake) RegistryByID(_ context.Context, registryID string) (*coder.Registry, error) {
+	return nil, f.unimplemented("RegistryByID", registryID)
+}
+
+// UpdateRegistry is not modelled.
+func (f *Fake) UpdateRegistry(_ context.Context, registryID string, req coder.UpdateRegistryReq) error {
+	return f.unimplemented("UpdateRegistry", registryID, req)
+}
+
+// DeleteRegistry is not modelled.
+func (f *Fake) DeleteRegistry(_ context.Context, registryID string) error {
+	return f.unimplemented("DeleteRegistry", registryID)
+}
+
+// CreateImageTag adds a tag to the image.
+func (f *Fake) CreateImageTag(_ context.Context, imageID string, req coder.CreateImageTagReq) (*coder.ImageTag, error) {
+	if _, err := f.call("CreateImageTag", imageID, req); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img := f.image(imageID)
+	if img == nil {
+		return nil, coder.ErrNotFound
+	}
+	if f.tag(imageID, req.Tag) != nil {
+		return nil, xerrors.Errorf("tag %q already exists", req.Tag)
+	}
+	now := time.Now()
+	tag := coder.ImageTag{ImageID: imageID, Tag: req.Tag, CreatedAt: now, UpdatedAt: now}
+	f.tags[imageID] = append(f.tags[imageID], tag)
+	if req.Default {
+		t := tag
+		img.DefaultTag = &t
+	}
+	return &tag, nil
+}
+
+// DeleteImageTag removes a tag from the image.
+func (f *Fake) DeleteImageTag(_ context.Context, imageID, tag string) error {
+	if _, err := f.call("DeleteImageTag", imageID, tag); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tags := f.tags[imageID]
+	for i, t := range tags {
+		if t.Tag == tag {
+			f.tags[imageID] = append(tags[:i], tags[i+1:]...)
+			return nil
+		}
+	}
+	return coder.ErrNotFound
+}
+
+// ImageTags returns the tags of the image.
+func (f *Fake) ImageTags(_ context.Context, imageID string) ([]coder.ImageTag, error) {
+	if _, err := f.call("ImageTags", imageID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.image(imageID) == nil {
+		return nil, coder.ErrNotFound
+	}
+	return append([]coder.ImageTag(nil), f.tags[imageID]...), nil
+}
+
+// ImageTagByID returns the tag of the image with the given name.
+func (f *Fake) ImageTagByID(_ context.Context, imageID, tagID string) (*coder.ImageTag, error) {
+	if _, err := f.call("ImageTagByID", imageID, tagID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tag := f.tag(imageID, tagID)
+	if tag == nil {
+		return nil, coder.ErrNotFound
+	}
+	t := *tag
+	return &t, nil
+}
+
+func (f *Fake) tag(imageID, tag string) *coder.ImageTag {
+	tags := f.tags[imageID]
+	for i := range tags {
+		if tags[i].Tag == tag {
+			return &tags[i]
+		}
+	}
+	return nil
+}
+
+// CreateAPIToken adds an API token for the user and returns its secret.
+func (f *Fake) CreateAPIToken(_ context.Context, userID string, req coder.CreateAPITokenReq) (string, error) {
+	if _, err := f.call("CreateAPIToken", userID, req); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.user(userID) == nil {
+		return "", coder.ErrNotFound
+	}
+	userID = f.resolveUserID(userID)
+	token := coder.APIToken{ID: f.newID("token"), Name: req.Name, UserID: userID}
+	f.tokens[userID] = append(f.tokens[userID], token)
+	return token.ID + "-" + f.newID("secret"), nil
+}
+
+// APITokens returns the user's API tokens.
+func (f *Fake) APITokens(_ context.Context, userID string) ([]coder.APIToken, error) {
+	if _, err := f.call("APITokens", userID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]coder.APIToken(nil), f.tokens[f.resolveUserID(userID)]...), nil
+}
+
+// APITokenByID returns the user's API token with the given ID.
+func (f *Fake) APITokenByID(_ context.Context, userID, tokenID string) (*coder.APIToken, error) {
+	if _, err := f.call("APITokenByID", userID, tokenID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.tokens[f.resolveUserID(userID)] {
+		if t.ID == tokenID {
+			return &t, nil
+		}
+	}
+	return nil, coder.ErrNotFound
+}
+
+// DeleteAPIToken removes the user's API token.
+func (f *Fake) DeleteAPIToken(_ context.Context, userID, tokenID string) error {
+	if _, err := f.call("DeleteAPIToken", userID, tokenID); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	userID = f.resolveUserID(userID)
+	tokens := f.tokens[userID]
+	for i, t := range tokens {
+		if t.ID == tokenID {
+			f.tokens[userID] = append(tokens[:i], tokens[i+1:]...)
+			return nil
+		}
+	}
+	return coder.ErrNotFound
+}
+
+// RegenerateAPIToken returns a new secret for the user's API token.
+func (f *Fake) RegenerateAPIToken(_ context.Context, userID, tokenID string) (string, error) {
+	if _, err := f.call("RegenerateAPIToken", userID, tokenID); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.tokens[f.resolveUserID(userID)] {
+		if t.ID == tokenID {
+			return t.ID + "-" + f.newID("secret"), nil
+		}
+	}
+	return "", coder.ErrNotFound
+}
+
+// RegenerateWorkspaceAgentToken returns a new agent token for the workspace.
+func (f *Fake) RegenerateWorkspaceAgentToken(_ context.Context, workspaceID string) (string, error) {
+	if _, err := f.call("RegenerateWorkspaceAgentToken", workspaceID); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.workspace(workspaceID) == nil {
+		return "", coder.ErrNotFound
+	}
+	return workspaceID + "-" + f.newID("agent-token"), nil
+}
+
+// WorkspaceAgents returns the agents added with AddWorkspaceAgent.
+func (f *Fake) WorkspaceAgents(_ context.Context, workspaceID string) ([]coder.WorkspaceAgent, error) {
+	if _, err := f.call("WorkspaceAgents", workspaceID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.workspace(workspaceID) == nil {
+		return nil, coder.ErrNotFound
+	}
+	return append([]coder.WorkspaceAgent(nil), f.agents[workspaceID]...), nil
+}
+
+// ReportAgentDisk records the call.
+func (f *Fake) ReportAgentDisk(_ context.Context, disk coder.AgentDisk) error {
+	_, err := f.call("ReportAgentDisk", disk)
+	return err
+}
+
+// APIVersion returns the version set with SetAPIVersion.
+func (f *Fake) APIVersion(_ context.Context) (string, error) {
+	if _, err := f.call("APIVersion"); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.version, nil
+}
+
+// WorkspaceProviderByID returns the workspace provider with the given ID.
+func (f *Fake) WorkspaceProviderByID(_ context.Context, id string) (*coder.KubernetesProvider, error) {
+	if _, err := f.call("WorkspaceProviderByID", id); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.provider(id)
+	if p == nil {
+		return nil, coder.ErrNotFound
+	}
+	wp := *p
+	return &wp, nil
+}
+
+// WorkspaceProviders returns all workspace providers.
+func (f *Fake) WorkspaceProviders(_ context.Context) (*coder.WorkspaceProviders, error) {
+	if _, err := f.call("WorkspaceProviders"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &coder.WorkspaceProviders{
+		Kubernetes: append([]coder.KubernetesProvider(nil), f.providers...),
+	}, nil
+}
+
+// CreateWorkspaceProvider adds a pending workspace provider.
+func (f *Fake) CreateWorkspaceProvider(_ context.Context, req coder.CreateWorkspaceProviderReq) (*coder.CreateWorkspaceProviderRes, error) {
+	if _, err := f.call("CreateWorkspaceProvider", req); err != nil {
+		return nil, err
+	}
+	id := f.AddProvider(coder.KubernetesProvider{
+		Name:               req.Name,
+		Status:             coder.WorkspaceProviderPending,
+		EnvproxyAccessURL:  req.Hostname,
+		KubeProviderConfig: coder.KubeProviderConfig{ClusterAddress: req.ClusterAddress},
+	})
+	return &coder.CreateWorkspaceProviderRes{
+		ID:            id,
+		Name:          req.Name,
+		Status:        coder.WorkspaceProviderPending,
+		EnvproxyToken: "fake-envproxy-token",
+	}, nil
+}
+
+// DeleteWorkspaceProviderByID removes the workspace provider.
+func (f *Fake) DeleteWorkspaceProviderByID(_ context.Context, id string) error {
+	if _, err := f.call("DeleteWorkspaceProviderByID", id); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, p := range f.providers {
+		if p.ID == id {
+			f.providers = append(f.providers[:i], f.providers[i+1:]...)
+			return nil
+		}
+	}
+	return coder.ErrNotFound
+}
+
+// Token returns the token set with SetToken.
+func (f *Fake) Token() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.token
+}
+
+// BaseURL returns the URL set with SetBaseURL.
+func (f *Fake) BaseURL() url.URL {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.baseURL
+}
+
+// CordonWorkspaceProvider records the call. Cordoning is not reflected in
+// the provider, since KubernetesProvider does not expose it.
+func (f *Fake) CordonWorkspaceProvider(_ context.Context, id, reason string) error {
+	if _, err := f.call("CordonWorkspaceProvider", id, reason); err != nil {
+		return err
+	}
+	return f.checkProvider(id)
+}
+
+// UnCordonWorkspaceProvider records the call.
+func (f *Fake) UnCordonWorkspaceProvider(_ context.Context, id string) error {
+	if _, err := f.call("UnCordonWorkspaceProvider", id); err != nil {
+		return err
+	}
+	return f.checkProvider(id)
+}
+
+// RenameWorkspaceProvider renames the workspace provider.
+func (f *Fake) RenameWorkspaceProvider(_ context.Context, id string, name string) error {
+	if _, err := f.call("RenameWorkspaceProvider", id, name); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.provider(id)
+	if p == nil {
+		return coder.ErrNotFound
+	}
+	p.Name = name
+	return nil
+}
+
+func (f *Fake) checkProvider(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.provider(id) == nil {
+		return coder.ErrNotFound
+	}
+	return nil
+}
+
+// SetPolicyTemplate is not modelled.
+func (f *Fake) SetPolicyTemplate(_ context.Context, templateID string, templateScope coder.TemplateScope, dryRun bool) (*coder.SetPolicyTemplateResponse, error) {
+	return nil, f.unimplemented("SetPolicyTemplate", templateID, templateScope, dryRun)
+}
+
+// Satellites returns the satellites added with AddSatellite.
+func (f *Fake) Satellites(_ context.Context) ([]coder.Satellite, error) {
+	if _, err := f.call("Satellites"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]coder.Satellite(nil), f.satellites...), nil
+}
+
+// CreateSatellite is not modelled.
+func (f *Fake) CreateSatellite(_ context.Context, req coder.CreateSatelliteReq) (*coder.Satellite, error) {
+	return nil, f.unimplemented("CreateSatellite", req)
+}
+
+// DeleteSatelliteByID is not modelled.
+func (f *Fake) DeleteSatelliteByID(_ context.Context, id string) error {
+	return f.unimplemented("DeleteSatelliteByID", id)
+}
+
+// UpdateLastConnectionAt sets the workspace's last connection time to now.
+func (f *Fake) UpdateLastConnectionAt(_ context.Context, workspaceID string) error {
+	if _, err := f.call("UpdateLastConnectionAt", workspaceID); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := f.workspace(workspaceID)
+	if w == nil {
+		return coder.ErrNotFound
+	}
+	w.LastConnectionAt = time.Now()
+	return nil
+}
+
+// ICEServers returns no ICE servers.
+func (f *Fake) ICEServers(_ context.Context) ([]webrtc.ICEServer, error) {
+	_, err := f.call("ICEServers")
+	return nil, err
+}
@@ -0,0 +1,17 @@
+// Package codertest provides an in-memory fake of the coder.Client interface
+// for testing code built on top of the coder-sdk.
+//
+// Users, organizations, workspaces, images, image tags, API tokens and
+// workspace providers are modelled in memory, so reads observe earlier writes
+// the same way they would against a real deployment. Behavior can be scripted
+// per method with Fake.On, and every call is recorded for later assertions.
+//
+//	fake := codertest.New()
+//	fake.AddWorkspace(coder.Workspace{Name: "backend", UserID: fake.MeID(), OrganizationID: fake.DefaultOrgID()})
+//	fake.On("StopWorkspace", func(args ...interface{}) error {
+//		return xerrors.New("boom")
+//	})
+//
+// Methods that need a live connection, such as the websocket dialers, return
+// ErrNotImplemented unless a hook is registered for them.
+package codertest
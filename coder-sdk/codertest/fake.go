@@ -0,0 +1,407 @@
+package codertest
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+)
+
+// ErrNotImplemented is returned by methods the fake does not model
+// when no hook has been registered for them.
+var ErrNotImplemented = xerrors.New("not implemented by codertest.Fake")
+
+// Hook scripts the behavior of a single Fake method. It receives the
+// arguments of the call, excluding the context. Returning a non-nil error
+// makes the method fail with that error without touching the fake's state.
+type Hook func(args ...interface{}) error
+
+// Call records a single invocation of a Fake method.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Fake is an in-memory implementation of coder.Client.
+// It is safe for concurrent use.
+type Fake struct {
+	mu sync.Mutex
+
+	baseURL url.URL
+	token   string
+	version string
+
+	meID         string
+	defaultOrgID string
+
+	users      []coder.User
+	orgs       []coder.Organization
+	workspaces []coder.Workspace
+	images     []coder.Image
+	tags       map[string][]coder.ImageTag
+	tokens     map[string][]coder.APIToken
+	devURLs    map[string][]coder.DevURL
+	providers  []coder.KubernetesProvider
+	buildLogs  map[string][]coder.BuildLog
+	logs       map[string][]coder.WorkspaceLog
+	prepulls   map[string]coder.ImagePrepull
+	agents     map[string][]coder.WorkspaceAgent
+	shares     map[string][]coder.TunnelShare
+	cliRollout *coder.ConfigCLIRollout
+	events     []coder.Event
+	satellites []coder.Satellite
+
+	hooks map[string]Hook
+	calls []Call
+	ids   int
+}
+
+var _ coder.Client = &Fake{}
+
+// New returns a Fake seeded with an authenticated user who is a member
+// of a single default organization.
+func New() *Fake {
+	f := &Fake{
+		baseURL:   url.URL{Scheme: "https", Host: "coder.example.com"},
+		token:     "fake-session-token",
+		version:   "1.21.0",
+		tags:      make(map[string][]coder.ImageTag),
+		tokens:    make(map[string][]coder.APIToken),
+		devURLs:   make(map[string][]coder.DevURL),
+		buildLogs: make(map[string][]coder.BuildLog),
+		logs:      make(map[string][]coder.WorkspaceLog),
+		prepulls:  make(map[string]coder.ImagePrepull),
+		agents:    make(map[string][]coder.WorkspaceAgent),
+		shares:    make(map[string][]coder.TunnelShare),
+		hooks:     make(map[string]Hook),
+	}
+	f.defaultOrgID = f.AddOrganization(coder.Organization{Name: "default", Default: true})
+	f.meID = f.AddUser(coder.User{
+		Email:    "me@coder.com",
+		Username: "me",
+		Name:     "Me",
+		Roles:    []coder.Role{coder.SiteMember},
+	}, f.defaultOrgID)
+	return f
+}
+
+// MeID returns the ID of the authenticated user.
+func (f *Fake) MeID() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.meID
+}
+
+// DefaultOrgID returns the ID of the organization created by New.
+func (f *Fake) DefaultOrgID() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.defaultOrgID
+}
+
+// SetToken sets the value returned by Token.
+func (f *Fake) SetToken(token string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.token = token
+}
+
+// SetBaseURL sets the value returned by BaseURL.
+func (f *Fake) SetBaseURL(u url.URL) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.baseURL = u
+}
+
+// SetAPIVersion sets the value returned by APIVersion.
+func (f *Fake) SetAPIVersion(version string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.version = version
+}
+
+// AddUser stores u, making it a member of the given organizations.
+// An ID is assigned if u has none. The user's ID is returned.
+func (f *Fake) AddUser(u coder.User, orgIDs ...string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if u.ID == "" {
+		u.ID = f.newID("user")
+	}
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+		u.UpdatedAt = u.CreatedAt
+	}
+	f.users = append(f.users, u)
+	for _, id := range orgIDs {
+		if org := f.org(id); org != nil {
+			org.Members = append(org.Members, coder.OrganizationUser{User: u})
+		}
+	}
+	return u.ID
+}
+
+// AddOrganization stores org, assigning an ID if it has none.
+// The organization's ID is returned.
+func (f *Fake) AddOrganization(org coder.Organization) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if org.ID == "" {
+		org.ID = f.newID("org")
+	}
+	f.orgs = append(f.orgs, org)
+	return org.ID
+}
+
+// AddWorkspace stores w, assigning an ID if it has none. Workspaces
+// default to being owned by the authenticated user in the default
+// organization, and to being on. The workspace's ID is returned.
+func (f *Fake) AddWorkspace(w coder.Workspace) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if w.ID == "" {
+		w.ID = f.newID("workspace")
+	}
+	if w.UserID == "" {
+		w.UserID = f.meID
+	}
+	if w.OrganizationID == "" {
+		w.OrganizationID = f.defaultOrgID
+	}
+	if w.LatestStat.ContainerStatus == "" {
+		w.LatestStat.ContainerStatus = coder.WorkspaceOn
+	}
+	f.workspaces = append(f.workspaces, w)
+	return w.ID
+}
+
+// AddImage stores img along with the given tags, assigning an ID if it has
+// none. The first tag becomes the default tag unless img sets one.
+// The image's ID is returned.
+func (f *Fake) AddImage(img coder.Image, tags ...string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if img.ID == "" {
+		img.ID = f.newID("image")
+	}
+	if img.OrganizationID == "" {
+		img.OrganizationID = f.defaultOrgID
+	}
+	for _, t := range tags {
+		f.tags[img.ID] = append(f.tags[img.ID], coder.ImageTag{ImageID: img.ID, Tag: t, CreatedAt: time.Now()})
+	}
+	if img.DefaultTag == nil && len(tags) > 0 {
+		tag := f.tags[img.ID][0]
+		img.DefaultTag = &tag
+	}
+	f.images = append(f.images, img)
+	return img.ID
+}
+
+// SetTagScan sets the vulnerability scan of the tag of the image, and of
+// the image's default tag if it's that one.
+func (f *Fake) SetTagScan(imageID, tag string, scan coder.ImageScan) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t := f.tag(imageID, tag); t != nil {
+		s := scan
+		t.Scan = &s
+	}
+	if img := f.image(imageID); img != nil && img.DefaultTag != nil && img.DefaultTag.Tag == tag {
+		s := scan
+		img.DefaultTag.Scan = &s
+	}
+}
+
+// AddProvider stores p, assigning an ID if it has none.
+// The provider's ID is returned.
+func (f *Fake) AddProvider(p coder.KubernetesProvider) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p.ID == "" {
+		p.ID = f.newID("provider")
+	}
+	if p.Status == "" {
+		p.Status = coder.WorkspaceProviderReady
+	}
+	f.providers = append(f.providers, p)
+	return p.ID
+}
+
+// SetBuildLog sets the build log emitted by FollowWorkspaceBuildLog for
+// the given workspace. Without one, a successful start/done log is emitted.
+func (f *Fake) SetBuildLog(workspaceID string, logs []coder.BuildLog) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.buildLogs[workspaceID] = logs
+}
+
+// AddWorkspaceLogs appends to the output of the workspace returned by
+// WorkspaceLogs and FollowWorkspaceLogs.
+func (f *Fake) AddWorkspaceLogs(workspaceID string, logs ...coder.WorkspaceLog) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logs[workspaceID] = append(f.logs[workspaceID], logs...)
+}
+
+// AddEvents records events streamed by SubscribeEvents, in order.
+func (f *Fake) AddEvents(events ...coder.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, events...)
+}
+
+// AddSatellite records a satellite returned by Satellites, and returns its
+// ID.
+func (f *Fake) AddSatellite(s coder.Satellite) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s.ID == "" {
+		s.ID = f.newID("satellite")
+	}
+	f.satellites = append(f.satellites, s)
+	return s.ID
+}
+
+// AddWorkspaceAgent records an agent connected to the given workspace,
+// returned by WorkspaceAgents.
+func (f *Fake) AddWorkspaceAgent(workspaceID string, agent coder.WorkspaceAgent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.agents[workspaceID] = append(f.agents[workspaceID], agent)
+}
+
+// On registers a hook that runs whenever method is called, replacing
+// any hook already registered for it. Passing a nil hook removes it.
+func (f *Fake) On(method string, hook Hook) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if hook == nil {
+		delete(f.hooks, method)
+		return
+	}
+	f.hooks[method] = hook
+}
+
+// FailOn makes method fail with err until the hook is removed.
+func (f *Fake) FailOn(method string, err error) {
+	f.On(method, func(...interface{}) error { return err })
+}
+
+// Calls returns every call made to the fake, in order.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// CallsTo returns the calls made to method, in order.
+func (f *Fake) CallsTo(method string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []Call
+	for _, c := range f.calls {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Workspace returns a copy of the stored workspace with the given ID,
+// for asserting on state changes.
+func (f *Fake) Workspace(id string) (coder.Workspace, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if w := f.workspace(id); w != nil {
+		return *w, true
+	}
+	return coder.Workspace{}, false
+}
+
+// call records the call and runs its hook, if any. The hook is run
+// without holding the lock so it may call back into the fake.
+func (f *Fake) call(method string, args ...interface{}) (hooked bool, _ error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+	hook, ok := f.hooks[method]
+	f.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, hook(args...)
+}
+
+// unimplemented is used by methods the fake does not model.
+func (f *Fake) unimplemented(method string, args ...interface{}) error {
+	hooked, err := f.call(method, args...)
+	if err != nil {
+		return err
+	}
+	if !hooked {
+		return xerrors.Errorf("%s: %w", method, ErrNotImplemented)
+	}
+	return nil
+}
+
+func (f *Fake) newID(prefix string) string {
+	f.ids++
+	return fmt.Sprintf("%s-%d", prefix, f.ids)
+}
+
+func (f *Fake) resolveUserID(id string) string {
+	if id == coder.Me {
+		return f.meID
+	}
+	return id
+}
+
+func (f *Fake) user(id string) *coder.User {
+	id = f.resolveUserID(id)
+	for i := range f.users {
+		if f.users[i].ID == id {
+			return &f.users[i]
+		}
+	}
+	return nil
+}
+
+func (f *Fake) org(id string) *coder.Organization {
+	for i := range f.orgs {
+		if f.orgs[i].ID == id {
+			return &f.orgs[i]
+		}
+	}
+	return nil
+}
+
+func (f *Fake) workspace(id string) *coder.Workspace {
+	for i := range f.workspaces {
+		if f.workspaces[i].ID == id {
+			return &f.workspaces[i]
+		}
+	}
+	return nil
+}
+
+func (f *Fake) image(id string) *coder.Image {
+	for i := range f.images {
+		if f.images[i].ID == id {
+			return &f.images[i]
+		}
+	}
+	return nil
+}
+
+func (f *Fake) provider(id string) *coder.KubernetesProvider {
+	for i := range f.providers {
+		if f.providers[i].ID == id {
+			return &f.providers[i]
+		}
+	}
+	return nil
+}
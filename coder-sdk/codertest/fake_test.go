@@ -0,0 +1,130 @@
+package codertest_test
+
+import (
+	"context"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func TestFakeWorkspaces(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := codertest.New()
+	imgID := fake.AddImage(coder.Image{Repository: "codercom/ubuntu"}, "latest")
+
+	w, err := fake.CreateWorkspace(ctx, coder.CreateWorkspaceRequest{
+		Name:     "backend",
+		ImageID:  imgID,
+		ImageTag: "latest",
+		OrgID:    fake.DefaultOrgID(),
+	})
+	assert.Success(t, "create workspace", err)
+	assert.Equal(t, "owned by me", fake.MeID(), w.UserID)
+
+	_, err = fake.CreateWorkspace(ctx, coder.CreateWorkspaceRequest{Name: "backend", OrgID: fake.DefaultOrgID()})
+	assert.Error(t, "duplicate name", err)
+
+	workspaces, err := fake.UserWorkspacesByOrganization(ctx, coder.Me, fake.DefaultOrgID())
+	assert.Success(t, "list workspaces", err)
+	assert.Equal(t, "one workspace", 1, len(workspaces))
+
+	err = fake.StopWorkspace(ctx, w.ID)
+	assert.Success(t, "stop workspace", err)
+	got, _ := fake.Workspace(w.ID)
+	assert.Equal(t, "workspace is off", coder.WorkspaceOff, got.LatestStat.ContainerStatus)
+
+	err = fake.RebuildWorkspace(ctx, w.ID)
+	assert.Success(t, "rebuild workspace", err)
+	got, _ = fake.Workspace(w.ID)
+	assert.Equal(t, "workspace is on", coder.WorkspaceOn, got.LatestStat.ContainerStatus)
+
+	logs, err := fake.FollowWorkspaceBuildLog(ctx, w.ID)
+	assert.Success(t, "follow build log", err)
+	var last coder.BuildLogFollowMsg
+	for l := range logs {
+		last = l
+	}
+	assert.Equal(t, "build log ends with done", coder.BuildLogTypeDone, last.Type)
+
+	err = fake.DeleteWorkspace(ctx, w.ID)
+	assert.Success(t, "delete workspace", err)
+	_, err = fake.WorkspaceByID(ctx, w.ID)
+	assert.True(t, "workspace is gone", xerrors.Is(err, coder.ErrNotFound))
+}
+
+func TestFakeUsersAndImages(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := codertest.New()
+	err := fake.CreateUser(ctx, coder.CreateUserReq{
+		Email:            "jane@coder.com",
+		OrganizationsIDs: []string{fake.DefaultOrgID()},
+	})
+	assert.Success(t, "create user", err)
+
+	jane, err := fake.UserByEmail(ctx, "jane@coder.com")
+	assert.Success(t, "get user", err)
+	members, err := fake.OrganizationMembers(ctx, fake.DefaultOrgID())
+	assert.Success(t, "get members", err)
+	assert.Equal(t, "two members", 2, len(members))
+	assert.Equal(t, "jane is a member", jane.ID, members[1].ID)
+
+	me, err := fake.UserByEmail(ctx, coder.Me)
+	assert.Success(t, "get me", err)
+	assert.Equal(t, "me resolves", fake.MeID(), me.ID)
+
+	img, err := fake.ImportImage(ctx, coder.ImportImageReq{
+		Repository: "codercom/ubuntu",
+		OrgID:      fake.DefaultOrgID(),
+		Tag:        "20.04",
+	})
+	assert.Success(t, "import image", err)
+	assert.Equal(t, "default tag", "20.04", img.DefaultTag.Tag)
+
+	_, err = fake.CreateImageTag(ctx, img.ID, coder.CreateImageTagReq{Tag: "22.04", Default: true})
+	assert.Success(t, "create tag", err)
+	img, err = fake.ImageByID(ctx, img.ID)
+	assert.Success(t, "get image", err)
+	assert.Equal(t, "default tag updated", "22.04", img.DefaultTag.Tag)
+
+	tags, err := fake.ImageTags(ctx, img.ID)
+	assert.Success(t, "list tags", err)
+	assert.Equal(t, "two tags", 2, len(tags))
+}
+
+func TestFakeHooks(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := codertest.New()
+	id := fake.AddWorkspace(coder.Workspace{Name: "frontend"})
+
+	boom := xerrors.New("boom")
+	fake.FailOn("StopWorkspace", boom)
+	err := fake.StopWorkspace(ctx, id)
+	assert.True(t, "hook error is returned", xerrors.Is(err, boom))
+	w, _ := fake.Workspace(id)
+	assert.Equal(t, "state untouched", coder.WorkspaceOn, w.LatestStat.ContainerStatus)
+
+	fake.On("StopWorkspace", nil)
+	err = fake.StopWorkspace(ctx, id)
+	assert.Success(t, "hook removed", err)
+
+	calls := fake.CallsTo("StopWorkspace")
+	assert.Equal(t, "two calls recorded", 2, len(calls))
+	assert.Equal(t, "args recorded", []interface{}{id}, calls[0].Args)
+
+	err = fake.DeleteSatelliteByID(ctx, "satellite-1")
+	assert.True(t, "unmodelled method", xerrors.Is(err, codertest.ErrNotImplemented))
+
+	fake.On("DeleteSatelliteByID", func(...interface{}) error { return nil })
+	err = fake.DeleteSatelliteByID(ctx, "satellite-1")
+	assert.Success(t, "hooked unmodelled method", err)
+}
@@ -155,3 +155,31 @@ func (c *DefaultClient) SiteConfigWorkspaces(ctx context.Context) (*ConfigWorksp
 	}
 	return &conf, nil
 }
+
+// ConfigCLIRollout describes the CLI version site admins roll out to users in
+// stages, rather than everyone updating at once.
+type ConfigCLIRollout struct {
+	// Version is the CLI version being rolled out. When empty, users are
+	// offered the version of the deployment.
+	Version string `json:"version"`
+	// Percent is the share of users offered Version, from 0 to 100.
+	Percent int `json:"percent"`
+	// PreviousVersion is offered to the users outside the rollout. When
+	// empty, they are offered the version of the deployment.
+	PreviousVersion string `json:"previous_version"`
+}
+
+// SiteConfigCLIRollout fetches the CLI rollout configuration. Any
+// authenticated user may read it.
+func (c *DefaultClient) SiteConfigCLIRollout(ctx context.Context) (*ConfigCLIRollout, error) {
+	var conf ConfigCLIRollout
+	if err := c.requestBody(ctx, http.MethodGet, "/api/v0/configs/cli-rollout", nil, &conf); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+// PutSiteConfigCLIRollout sets the CLI rollout configuration.
+func (c *DefaultClient) PutSiteConfigCLIRollout(ctx context.Context, req ConfigCLIRollout) error {
+	return c.requestBody(ctx, http.MethodPut, "/api/v0/configs/cli-rollout", req, nil)
+}
@@ -0,0 +1,95 @@
+package coder
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Deprecation is announced by the API in the headers of responses to
+// requests that use deprecated endpoints or authentication methods.
+type Deprecation struct {
+	// Method and Path are those of the request.
+	Method string
+	Path   string
+
+	// Date is when the deprecation took effect, or the zero time if the
+	// API didn't say.
+	Date time.Time
+	// Sunset is when the deprecated API stops working, or the zero time if
+	// the API didn't say.
+	Sunset time.Time
+	// Link documents the deprecation and what to use instead, if any.
+	Link string
+}
+
+// parseDeprecation returns the deprecation announced by the headers, in the
+// Deprecation, Sunset and Link headers of RFC 8594 and its successors.
+func parseDeprecation(h http.Header) (Deprecation, bool) {
+	value := strings.TrimSpace(h.Get("Deprecation"))
+	sunset := strings.TrimSpace(h.Get("Sunset"))
+	if value == "" && sunset == "" {
+		return Deprecation{}, false
+	}
+
+	var d Deprecation
+	switch {
+	case value == "", strings.EqualFold(value, "true"):
+	case strings.HasPrefix(value, "@"):
+		// A structured field date, in seconds since the epoch.
+		if secs, err := strconv.ParseInt(value[1:], 10, 64); err == nil {
+			d.Date = time.Unix(secs, 0).UTC()
+		}
+	default:
+		d.Date, _ = http.ParseTime(value)
+	}
+	d.Sunset, _ = http.ParseTime(sunset)
+
+	links := map[string]string{}
+	for _, header := range h.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			target, rel := parseLink(link)
+			if target != "" && rel != "" {
+				links[rel] = target
+			}
+		}
+	}
+	d.Link = links["deprecation"]
+	if d.Link == "" {
+		d.Link = links["sunset"]
+	}
+	return d, true
+}
+
+// parseLink returns the target and relation type of a Link header value,
+// such as `<https://coder.com/docs>; rel="deprecation"`.
+func parseLink(link string) (target, rel string) {
+	parts := strings.Split(link, ";")
+	target = strings.TrimSpace(parts[0])
+	if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+		return "", ""
+	}
+	target = target[1 : len(target)-1]
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 && strings.EqualFold(kv[0], "rel") {
+			rel = strings.ToLower(strings.Trim(kv[1], `"`))
+		}
+	}
+	return target, rel
+}
+
+// checkDeprecation passes the deprecation announced in the response to the
+// request, if any, to the client's OnDeprecation handler.
+func (c *DefaultClient) checkDeprecation(method, path string, resp *http.Response) {
+	if c.onDeprecation == nil || resp == nil {
+		return
+	}
+	d, ok := parseDeprecation(resp.Header)
+	if !ok {
+		return
+	}
+	d.Method, d.Path = method, path
+	c.onDeprecation(d)
+}
@@ -0,0 +1,232 @@
+package coder
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"golang.org/x/xerrors"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+// EventType is the kind of an event streamed by SubscribeEvents.
+type EventType string
+
+// EventType enums.
+const (
+	// EventTypeWorkspace is sent when a workspace is created, changes or is
+	// deleted.
+	EventTypeWorkspace EventType = "workspace"
+	// EventTypeBuild is sent for each build log line of a workspace.
+	EventTypeBuild EventType = "build"
+	// EventTypeAgent is sent when an agent connects to or disconnects from
+	// a workspace.
+	EventTypeAgent EventType = "agent"
+)
+
+// Event is a message of the event stream of the deployment. Only the field
+// matching its type is set.
+type Event struct {
+	// ID tells apart the events that happened at the same time.
+	ID        string          `json:"id"`
+	Type      EventType       `json:"type"`
+	Time      time.Time       `json:"time"`
+	Workspace *WorkspaceEvent `json:"workspace,omitempty"`
+	Build     *BuildLog       `json:"build,omitempty"`
+	Agent     *AgentEvent     `json:"agent,omitempty"`
+}
+
+// WorkspaceEvent describes a change of a workspace.
+type WorkspaceEvent struct {
+	Workspace Workspace `json:"workspace"`
+	// Deleted is set when the workspace was deleted, in which case
+	// Workspace is its last state.
+	Deleted bool `json:"deleted"`
+}
+
+// AgentEvent describes an agent connecting to or disconnecting from a
+// workspace.
+type AgentEvent struct {
+	WorkspaceID string         `json:"workspace_id"`
+	Agent       WorkspaceAgent `json:"agent"`
+	Connected   bool           `json:"connected"`
+}
+
+// EventFilter restricts the events streamed by SubscribeEvents.
+type EventFilter struct {
+	// WorkspaceIDs restricts the events to these workspaces. Events of all
+	// the workspaces the user can access are streamed otherwise.
+	WorkspaceIDs []string
+	// Types restricts the events to these types. Events of all types are
+	// streamed otherwise.
+	Types []EventType
+}
+
+// EventHandlers are the callbacks of SubscribeEvents. They're called one at
+// a time, in the order of the events, and nil ones are skipped.
+type EventHandlers struct {
+	Workspace func(time.Time, WorkspaceEvent)
+	Build     func(BuildLog)
+	Agent     func(time.Time, AgentEvent)
+	// Reconnect is called when the stream is lost, with the error that
+	// ended it, before reconnecting.
+	Reconnect func(err error)
+}
+
+const (
+	eventsMinBackoff = time.Second
+	eventsMaxBackoff = 30 * time.Second
+)
+
+// SubscribeEvents streams the events matching the filter to the handlers
+// until ctx is done, reconnecting whenever the stream is lost. After a
+// reconnect, the stream resumes from the time of the last event received,
+// so no event is missed, and the events of that time already received are
+// skipped by ID. It returns ctx.Err(), or the error of a request the
+// deployment rejected, such as with an expired session.
+func (c *DefaultClient) SubscribeEvents(ctx context.Context, filter EventFilter, handlers EventHandlers) error {
+	var (
+		cursor  eventCursor
+		backoff = eventsMinBackoff
+	)
+	for {
+		received, err := c.streamEvents(ctx, filter, &cursor, handlers)
+		if received {
+			backoff = eventsMinBackoff
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var httpErr *HTTPError
+		if xerrors.As(err, &httpErr) && httpErr.StatusCode() >= 400 && httpErr.StatusCode() < 500 {
+			return err
+		}
+		if handlers.Reconnect != nil {
+			handlers.Reconnect(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > eventsMaxBackoff {
+			backoff = eventsMaxBackoff
+		}
+	}
+}
+
+// eventCursor is where a resumed event stream picks up: the time of the last
+// event received, and the IDs of the events received at that time, which the
+// resumed stream sends again.
+type eventCursor struct {
+	time time.Time
+	ids  map[string]struct{}
+}
+
+// seen reports whether the event was received before the stream resumed.
+// Events without an ID are never considered seen, so none is missed.
+func (c *eventCursor) seen(ev Event) bool {
+	if c.time.IsZero() || ev.Time.After(c.time) {
+		return false
+	}
+	if ev.Time.Before(c.time) {
+		return true
+	}
+	_, ok := c.ids[ev.ID]
+	return ok && ev.ID != ""
+}
+
+// advance records the event as received.
+func (c *eventCursor) advance(ev Event) {
+	if !ev.Time.Equal(c.time) {
+		c.time = ev.Time
+		c.ids = make(map[string]struct{})
+	}
+	if ev.ID != "" {
+		c.ids[ev.ID] = struct{}{}
+	}
+}
+
+// streamEvents dispatches the events of a single connection to the event
+// stream, resuming from the cursor and advancing it, and reports whether any
+// event was received.
+func (c *DefaultClient) streamEvents(ctx context.Context, filter EventFilter, cursor *eventCursor, handlers EventHandlers) (bool, error) {
+	query := url.Values{}
+	for _, id := range filter.WorkspaceIDs {
+		query.Add("workspace_id", id)
+	}
+	for _, t := range filter.Types {
+		query.Add("type", string(t))
+	}
+	if !cursor.time.IsZero() {
+		query.Set("since", cursor.time.Format(time.RFC3339Nano))
+	}
+	conn, err := c.dialWebsocket(ctx, "/api/private/events", withQueryParams(query))
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = conn.Close(websocket.StatusNormalClosure, "normal closure") }() // Best effort.
+
+	var received bool
+	for {
+		var ev Event
+		if err := wsjson.Read(ctx, conn, &ev); err != nil {
+			return received, xerrors.Errorf("read event: %w", err)
+		}
+		if cursor.seen(ev) {
+			continue
+		}
+		cursor.advance(ev)
+		received = true
+		handlers.Handle(ev)
+	}
+}
+
+// Handle calls the handler of the type of the event.
+func (h EventHandlers) Handle(ev Event) {
+	switch {
+	case ev.Type == EventTypeWorkspace && ev.Workspace != nil && h.Workspace != nil:
+		h.Workspace(ev.Time, *ev.Workspace)
+	case ev.Type == EventTypeBuild && ev.Build != nil && h.Build != nil:
+		h.Build(*ev.Build)
+	case ev.Type == EventTypeAgent && ev.Agent != nil && h.Agent != nil:
+		h.Agent(ev.Time, *ev.Agent)
+	}
+}
+
+// WorkspaceID returns the ID of the workspace the event is about.
+func (e Event) WorkspaceID() string {
+	switch {
+	case e.Workspace != nil:
+		return e.Workspace.Workspace.ID
+	case e.Build != nil:
+		return e.Build.WorkspaceID
+	case e.Agent != nil:
+		return e.Agent.WorkspaceID
+	}
+	return ""
+}
+
+// Matches reports whether the event passes the filter.
+func (f EventFilter) Matches(ev Event) bool {
+	return (len(f.WorkspaceIDs) == 0 || containsString(f.WorkspaceIDs, ev.WorkspaceID())) &&
+		(len(f.Types) == 0 || containsString(eventTypeStrings(f.Types), string(ev.Type)))
+}
+
+func eventTypeStrings(types []EventType) []string {
+	s := make([]string, len(types))
+	for i, t := range types {
+		s[i] = string(t)
+	}
+	return s
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
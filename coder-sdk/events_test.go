@@ -0,0 +1,91 @@
+package coder_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+
+	"cdr.dev/coder-cli/coder-sdk"
+)
+
+func TestSubscribeEvents(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+	var conns int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "path", "/api/private/events", r.URL.Path)
+		assert.Equal(t, "workspace filter", []string{"ws-1"}, r.URL.Query()["workspace_id"])
+		conn, err := websocket.Accept(w, r, nil)
+		assert.Success(t, "accept", err)
+
+		switch atomic.AddInt32(&conns, 1) {
+		case 1:
+			assert.Equal(t, "no resume", "", r.URL.Query().Get("since"))
+			_ = wsjson.Write(r.Context(), conn, coder.Event{ID: "1", Type: coder.EventTypeBuild, Time: start, Build: &coder.BuildLog{WorkspaceID: "ws-1", Msg: "pulling image"}})
+			_ = wsjson.Write(r.Context(), conn, coder.Event{ID: "2", Type: coder.EventTypeAgent, Time: start.Add(time.Second), Agent: &coder.AgentEvent{WorkspaceID: "ws-1", Connected: true}})
+			// Drop the connection, the client resumes from the last event.
+			_ = conn.Close(websocket.StatusInternalError, "restarting")
+		default:
+			assert.Equal(t, "resumed", start.Add(time.Second).Format(time.RFC3339Nano), r.URL.Query().Get("since"))
+			// The last event is sent again, as it happened at the resumed
+			// time, along with one of the same time the client missed.
+			_ = wsjson.Write(r.Context(), conn, coder.Event{ID: "2", Type: coder.EventTypeAgent, Time: start.Add(time.Second), Agent: &coder.AgentEvent{WorkspaceID: "ws-1", Connected: true}})
+			_ = wsjson.Write(r.Context(), conn, coder.Event{ID: "3", Type: coder.EventTypeBuild, Time: start.Add(time.Second), Build: &coder.BuildLog{WorkspaceID: "ws-1", Msg: "starting"}})
+			_ = wsjson.Write(r.Context(), conn, coder.Event{ID: "4", Type: coder.EventTypeWorkspace, Time: start.Add(2 * time.Second), Workspace: &coder.WorkspaceEvent{Workspace: coder.Workspace{ID: "ws-1", Name: "backend"}}})
+			<-r.Context().Done()
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	assert.Success(t, "failed to parse test server URL", err)
+	client, err := coder.NewClient(coder.ClientOptions{BaseURL: u, Token: "JcmErkJjju-KSrztst0IJX7xGJhKQPtfv"})
+	assert.Success(t, "failed to create coder.Client", err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var (
+		got        []string
+		reconnects int
+	)
+	err = client.SubscribeEvents(ctx, coder.EventFilter{WorkspaceIDs: []string{"ws-1"}}, coder.EventHandlers{
+		Build: func(l coder.BuildLog) { got = append(got, "build "+l.Msg) },
+		Agent: func(_ time.Time, e coder.AgentEvent) { got = append(got, "agent connected") },
+		Workspace: func(_ time.Time, e coder.WorkspaceEvent) {
+			got = append(got, "workspace "+e.Workspace.Name)
+			cancel()
+		},
+		Reconnect: func(error) { reconnects++ },
+	})
+	assert.ErrorContains(t, "canceled", err, context.Canceled.Error())
+	assert.Equal(t, "events", []string{"build pulling image", "agent connected", "build starting", "workspace backend"}, got)
+	assert.Equal(t, "reconnects", 1, reconnects)
+}
+
+func TestSubscribeEventsRejected(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	assert.Success(t, "failed to parse test server URL", err)
+	client, err := coder.NewClient(coder.ClientOptions{BaseURL: u, Token: "JcmErkJjju-KSrztst0IJX7xGJhKQPtfv"})
+	assert.Success(t, "failed to create coder.Client", err)
+
+	err = client.SubscribeEvents(context.Background(), coder.EventFilter{}, coder.EventHandlers{
+		Reconnect: func(error) { t.Error("reconnected after the request was rejected") },
+	})
+	assert.ErrorContains(t, "rejected", err, "401")
+}
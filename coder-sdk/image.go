@@ -99,3 +99,60 @@ func (c *DefaultClient) UpdateImage(ctx context.Context, imageID string, req Upd
 func (c *DefaultClient) UpdateImageTags(ctx context.Context, imageID string) error {
 	return c.requestBody(ctx, http.MethodPost, "/api/v0/images/"+imageID+"/tags/update", nil, nil)
 }
+
+// PrepullState is the state of an image pre-pull operation.
+type PrepullState string
+
+// PrepullState enums.
+const (
+	PrepullStatePending PrepullState = "pending"
+	PrepullStatePulling PrepullState = "pulling"
+	PrepullStateDone    PrepullState = "done"
+	PrepullStateFailed  PrepullState = "failed"
+)
+
+// PrepullImageReq defines the request parameters for pre-pulling an image tag onto provider nodes.
+type PrepullImageReq struct {
+	Tag string `json:"tag"`
+	// ProviderIDs limits the pre-pull to the given workspace providers.
+	// All providers are targeted if empty.
+	ProviderIDs []string `json:"provider_ids,omitempty"`
+}
+
+// PrepullNodeError describes a node that failed to pull the image.
+type PrepullNodeError struct {
+	ProviderID string `json:"provider_id"`
+	Node       string `json:"node"`
+	Message    string `json:"message"`
+}
+
+// ImagePrepull describes the progress of an image pre-pull operation.
+type ImagePrepull struct {
+	ID             string             `json:"id"`
+	ImageID        string             `json:"image_id"`
+	Tag            string             `json:"tag"`
+	State          PrepullState       `json:"state"`
+	TotalNodes     int                `json:"total_nodes"`
+	CompletedNodes int                `json:"completed_nodes"`
+	Errors         []PrepullNodeError `json:"errors"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+// PrepullImage asks workspace providers to pull an image tag onto their nodes ahead of use.
+func (c *DefaultClient) PrepullImage(ctx context.Context, imageID string, req PrepullImageReq) (*ImagePrepull, error) {
+	var prepull ImagePrepull
+	if err := c.requestBody(ctx, http.MethodPost, "/api/v0/images/"+imageID+"/prepull", req, &prepull); err != nil {
+		return nil, err
+	}
+	return &prepull, nil
+}
+
+// ImagePrepullByID fetches the progress of an image pre-pull operation.
+func (c *DefaultClient) ImagePrepullByID(ctx context.Context, imageID, prepullID string) (*ImagePrepull, error) {
+	var prepull ImagePrepull
+	if err := c.requestBody(ctx, http.MethodGet, "/api/v0/images/"+imageID+"/prepull/"+prepullID, nil, &prepull); err != nil {
+		return nil, err
+	}
+	return &prepull, nil
+}
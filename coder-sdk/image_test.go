@@ -0,0 +1,76 @@
+package coder_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+)
+
+func TestPrepullImage(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PrepullImage is a POST", http.MethodPost, r.Method)
+		assert.Equal(t, "Path matches", "/api/v0/images/img-1/prepull", r.URL.Path)
+
+		var req coder.PrepullImageReq
+		err := json.NewDecoder(r.Body).Decode(&req)
+		assert.Success(t, "decode request", err)
+		assert.Equal(t, "tag matches", "latest", req.Tag)
+		assert.Equal(t, "providers match", []string{"p-1"}, req.ProviderIDs)
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(coder.ImagePrepull{
+			ID:         "pp-1",
+			ImageID:    "img-1",
+			Tag:        req.Tag,
+			State:      coder.PrepullStatePending,
+			TotalNodes: 3,
+		})
+		assert.Success(t, "error encoding JSON", err)
+	}))
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	u, err := url.Parse(server.URL)
+	assert.Success(t, "failed to parse test server URL", err)
+
+	client, err := coder.NewClient(coder.ClientOptions{
+		BaseURL: u,
+		Token:   "JcmErkJjju-KSrztst0IJX7xGJhKQPtfv",
+	})
+	assert.Success(t, "failed to create coder.Client", err)
+
+	prepull, err := client.PrepullImage(context.Background(), "img-1", coder.PrepullImageReq{
+		Tag:         "latest",
+		ProviderIDs: []string{"p-1"},
+	})
+	assert.Success(t, "error starting pre-pull", err)
+	assert.Equal(t, "prepull id", "pp-1", prepull.ID)
+	assert.Equal(t, "total nodes", 3, prepull.TotalNodes)
+}
+
+func TestImageScanString(t *testing.T) {
+	t.Parallel()
+
+	var none *coder.ImageScan
+	assert.Equal(t, "not scanned", "not scanned", none.String())
+	assert.Equal(t, "pending", "pending", (&coder.ImageScan{Status: coder.ImageScanPending}).String())
+
+	scan := &coder.ImageScan{
+		Status:          coder.ImageScanComplete,
+		Vulnerabilities: coder.VulnerabilityCounts{Critical: 2, High: 5, Unknown: 1},
+	}
+	assert.Equal(t, "counts", "2 critical, 5 high, 1 unknown", scan.String())
+	assert.Equal(t, "highest", "critical", scan.Vulnerabilities.HighestSeverity())
+	assert.Equal(t, "total", 8, scan.Vulnerabilities.Total())
+	assert.Equal(t, "clean", "none", coder.VulnerabilityCounts{}.String())
+}
@@ -66,6 +66,12 @@ type Client interface {
 	// SiteConfigWorkspaces fetches the workspace configuration.
 	SiteConfigWorkspaces(ctx context.Context) (*ConfigWorkspaces, error)
 
+	// SiteConfigCLIRollout fetches the CLI rollout configuration.
+	SiteConfigCLIRollout(ctx context.Context) (*ConfigCLIRollout, error)
+
+	// PutSiteConfigCLIRollout sets the CLI rollout configuration.
+	PutSiteConfigCLIRollout(ctx context.Context, req ConfigCLIRollout) error
+
 	// DeleteDevURL deletes the specified devurl.
 	DeleteDevURL(ctx context.Context, workspaceID, urlID string) error
 
@@ -78,6 +84,15 @@ type Client interface {
 	// PutDevURL updates an existing devurl for the authenticated user.
 	PutDevURL(ctx context.Context, workspaceID, urlID string, req PutDevURLReq) error
 
+	// CreateTunnelShare creates a share link to a port of the workspace.
+	CreateTunnelShare(ctx context.Context, workspaceID string, req CreateTunnelShareReq) (*TunnelShare, error)
+
+	// TunnelShares fetches the unexpired share links of the workspace.
+	TunnelShares(ctx context.Context, workspaceID string) ([]TunnelShare, error)
+
+	// RevokeTunnelShare revokes a share link of the workspace before it expires.
+	RevokeTunnelShare(ctx context.Context, workspaceID, shareID string) error
+
 	// CreateWorkspace sends a request to create a workspace.
 	CreateWorkspace(ctx context.Context, req CreateWorkspaceRequest) (*Workspace, error)
 
@@ -91,6 +106,10 @@ type Client interface {
 	// Workspaces lists workspaces returned by the given filter.
 	Workspaces(ctx context.Context) ([]Workspace, error)
 
+	// EachWorkspace calls fn with each workspace Workspaces would return, as
+	// they are decoded from the response.
+	EachWorkspace(ctx context.Context, fn func(Workspace) error) error
+
 	// UserWorkspacesByOrganization gets the list of workspaces owned by the given user.
 	UserWorkspacesByOrganization(ctx context.Context, userID, orgID string) ([]Workspace, error)
 
@@ -122,6 +141,22 @@ type Client interface {
 	// FollowWorkspaceBuildLog trails the build log of a Coder workspace.
 	FollowWorkspaceBuildLog(ctx context.Context, workspaceID string) (<-chan BuildLogFollowMsg, error)
 
+	// WorkspaceBuildLogs returns the build log of the latest build of the workspace so far.
+	WorkspaceBuildLogs(ctx context.Context, workspaceID string) ([]BuildLog, error)
+
+	// WorkspaceLogs returns the output of the workspace.
+	WorkspaceLogs(ctx context.Context, workspaceID string, req WorkspaceLogsReq) ([]WorkspaceLog, error)
+
+	// DialWorkspaceLogs opens a websocket connection for the output of the workspace.
+	DialWorkspaceLogs(ctx context.Context, workspaceID string, req WorkspaceLogsReq) (*websocket.Conn, error)
+
+	// FollowWorkspaceLogs streams the output of the workspace as it's written.
+	FollowWorkspaceLogs(ctx context.Context, workspaceID string, req WorkspaceLogsReq) (<-chan WorkspaceLogFollowMsg, error)
+
+	// SubscribeEvents streams workspace, build and agent events to the handlers until ctx is done,
+	// reconnecting whenever the stream is lost.
+	SubscribeEvents(ctx context.Context, filter EventFilter, handlers EventHandlers) error
+
 	// DialWorkspaceStats opens a websocket connection for workspace stats.
 	DialWorkspaceStats(ctx context.Context, workspaceID string) (*websocket.Conn, error)
 
@@ -152,6 +187,12 @@ type Client interface {
 	// UpdateImageTags refreshes the latest digests for all tags of the image.
 	UpdateImageTags(ctx context.Context, imageID string) error
 
+	// PrepullImage asks workspace providers to pull an image tag onto their nodes ahead of use.
+	PrepullImage(ctx context.Context, imageID string, req PrepullImageReq) (*ImagePrepull, error)
+
+	// ImagePrepullByID fetches the progress of an image pre-pull operation.
+	ImagePrepullByID(ctx context.Context, imageID, prepullID string) (*ImagePrepull, error)
+
 	// Organizations gets all Organizations.
 	Organizations(ctx context.Context) ([]Organization, error)
 
@@ -209,6 +250,17 @@ type Client interface {
 	// RegenerateAPIToken regenerates the given APIToken and returns the new value.
 	RegenerateAPIToken(ctx context.Context, userID, tokenID string) (string, error)
 
+	// RegenerateWorkspaceAgentToken mints a new token for the agent of the given
+	// workspace and returns its value. The previous agent token stops working.
+	RegenerateWorkspaceAgentToken(ctx context.Context, workspaceID string) (string, error)
+
+	// WorkspaceAgents returns the agents connected to the given workspace.
+	WorkspaceAgents(ctx context.Context, workspaceID string) ([]WorkspaceAgent, error)
+
+	// ReportAgentDisk reports the disk pressure seen by the agent the client
+	// is authenticated as.
+	ReportAgentDisk(ctx context.Context, disk AgentDisk) error
+
 	// APIVersion parses the coder-version http header from an authenticated request.
 	APIVersion(ctx context.Context) (string, error)
 
@@ -6,11 +6,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
+	"cdr.dev/slog"
 	"golang.org/x/xerrors"
 )
 
@@ -91,15 +94,93 @@ func (c *DefaultClient) request(ctx context.Context, method, path string, in int
 	}
 
 	// Provide the session token in a header
-	req.Header.Set("Session-Token", c.token)
+	c.setAuthHeaders(req.Header)
 
 	customAuthHeader, ok := os.LookupEnv("ENDPOINT_AUTH_HEADER")
 	if ok {
 		req.Header.Set("Authorization", customAuthHeader)
 	}
 
+	// Only plain GETs of the resources allowed by cacheablePaths are cached,
+	// not downloads with a custom body.
+	cacheable := c.cache != nil && method == http.MethodGet && payload == nil && cacheablePath(path)
+	var (
+		cacheKey string
+		cached   CachedResponse
+		isCached bool
+	)
+	if cacheable {
+		cacheKey = c.cacheKey(url.String())
+		cached, isCached = c.cache.Get(cacheKey)
+		if isCached && c.cacheFreshFor > 0 && time.Since(cached.StoredAt) < c.cacheFreshFor {
+			c.log.Debug(ctx, "api request served from cache",
+				slog.F("method", method),
+				slog.F("url", url.String()),
+				slog.F("age", time.Since(cached.StoredAt)),
+			)
+			return cachedResponse(req, nil, cached), nil
+		}
+		if isCached && req.Header.Get("If-None-Match") == "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+	}
+
 	// Execute the request.
-	return c.httpClient.Do(req)
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	fields := []slog.Field{
+		slog.F("method", method),
+		slog.F("url", url.String()),
+		slog.F("took", time.Since(start)),
+	}
+	if err != nil {
+		c.log.Debug(ctx, "api request failed", append(fields, slog.Error(err))...)
+		return nil, err
+	}
+	c.log.Debug(ctx, "api request", append(fields, slog.F("status", resp.StatusCode))...)
+	c.checkDeprecation(method, path, resp)
+
+	if c.cache != nil {
+		resp, err = c.updateCache(req, resp, cacheable, cacheKey, cached, isCached)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// updateCache caches the response to a cacheable request if it has an
+// ETag, and replaces a 304 Not Modified with the cached response. Other
+// successful requests that aren't GET or HEAD purge the cache since they
+// may have changed what it holds.
+func (c *DefaultClient) updateCache(req *http.Request, resp *http.Response, cacheable bool, key string, cached CachedResponse, isCached bool) (*http.Response, error) {
+	switch {
+	case !cacheable:
+		if resp.StatusCode < 300 && req.Method != http.MethodGet && req.Method != http.MethodHead {
+			c.cache.Purge()
+		}
+		return resp, nil
+	case resp.StatusCode == http.StatusNotModified && isCached:
+		_ = resp.Body.Close()
+		cached.StoredAt = time.Now()
+		c.cache.Set(key, cached)
+		return cachedResponse(req, resp, cached), nil
+	case resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "":
+		body, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, xerrors.Errorf("read response body: %w", err)
+		}
+		c.cache.Set(key, CachedResponse{
+			ETag:     resp.Header.Get("ETag"),
+			Body:     body,
+			StoredAt: time.Now(),
+		})
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	default:
+		return resp, nil
+	}
 }
 
 // requestBody is a helper extending the Client.request helper, checking the response code
@@ -125,3 +206,35 @@ func (c *DefaultClient) requestBody(ctx context.Context, method, path string, in
 	}
 	return nil
 }
+
+// requestEach is like requestBody for responses that are a JSON array, but
+// decodes the elements one at a time and calls each with a decoder whose
+// next value is the element, so that the whole array is never held in
+// memory. It stops at the first error each returns.
+func (c *DefaultClient) requestEach(ctx context.Context, method, path string, in interface{}, each func(*json.Decoder) error, opts ...requestOption) error {
+	resp, err := c.request(ctx, method, path, in, opts...)
+	if err != nil {
+		return xerrors.Errorf("Execute request: %q", err)
+	}
+	defer func() { _ = resp.Body.Close() }() // Best effort, likely connection dropped.
+
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d: %w", resp.StatusCode, NewHTTPError(resp))
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	if tok, err := dec.Token(); err != nil {
+		return xerrors.Errorf("decode response body: %w", err)
+	} else if tok != json.Delim('[') {
+		return xerrors.Errorf("decode response body: expected an array, got %v", tok)
+	}
+	for dec.More() {
+		if err := each(dec); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return xerrors.Errorf("decode response body: %w", err)
+	}
+	return nil
+}
@@ -5,10 +5,15 @@ import (
 	"net/http"
 )
 
+// Satellite is a deployment that workspace connections can be routed through
+// instead of the control plane.
 type Satellite struct {
 	ID          string `json:"id"`
 	Name        string `json:"name"`
 	Fingerprint string `json:"fingerprint"`
+	// AccessURL is where the satellite is reached, the URL it was created
+	// with.
+	AccessURL string `json:"access_url,omitempty"`
 }
 
 type satellites struct {
@@ -33,6 +38,7 @@ func (c *DefaultClient) Satellites(ctx context.Context) ([]Satellite, error) {
 type CreateSatelliteReq struct {
 	Name      string `json:"name"`
 	PublicKey string `json:"public_key"`
+	AccessURL string `json:"access_url,omitempty"`
 }
 
 // CreateSatellite creates a new satellite entity.
@@ -0,0 +1,49 @@
+package coder
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// TunnelShare is a short-lived, tokenized URL through the deployment to a
+// port of a workspace, which anyone holding it can reach until it expires or
+// is revoked.
+type TunnelShare struct {
+	ID          string    `json:"id"           table:"ID"`
+	WorkspaceID string    `json:"workspace_id" table:"-"`
+	Port        int       `json:"port"         table:"Port"`
+	URL         string    `json:"url"          table:"URL"`
+	CreatedAt   time.Time `json:"created_at"   table:"-"`
+	ExpiresAt   time.Time `json:"expires_at"   table:"ExpiresAt"`
+}
+
+// CreateTunnelShareReq defines the request parameters for creating a
+// TunnelShare.
+type CreateTunnelShareReq struct {
+	Port      int      `json:"port"`
+	ExpiresIn Duration `json:"expires_in"`
+}
+
+// CreateTunnelShare creates a share link to a port of the workspace.
+func (c *DefaultClient) CreateTunnelShare(ctx context.Context, workspaceID string, req CreateTunnelShareReq) (*TunnelShare, error) {
+	var share TunnelShare
+	if err := c.requestBody(ctx, http.MethodPost, "/api/v0/workspaces/"+workspaceID+"/shares", req, &share); err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// TunnelShares fetches the unexpired share links of the workspace.
+func (c *DefaultClient) TunnelShares(ctx context.Context, workspaceID string) ([]TunnelShare, error) {
+	var shares []TunnelShare
+	if err := c.requestBody(ctx, http.MethodGet, "/api/v0/workspaces/"+workspaceID+"/shares", nil, &shares); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// RevokeTunnelShare revokes a share link of the workspace before it expires.
+func (c *DefaultClient) RevokeTunnelShare(ctx context.Context, workspaceID, shareID string) error {
+	return c.requestBody(ctx, http.MethodDelete, "/api/v0/workspaces/"+workspaceID+"/shares/"+shareID, nil, nil)
+}
@@ -2,7 +2,9 @@ package coder
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -16,6 +18,8 @@ type ImageTag struct {
 	Workspaces        []*Workspace `json:"workspaces"         table:"-"`
 	UpdatedAt         time.Time    `json:"updated_at"           table:"UpdatedAt"`
 	CreatedAt         time.Time    `json:"created_at"           table:"-"`
+	// Scan is nil unless the deployment integrates a vulnerability scanner.
+	Scan *ImageScan `json:"scan,omitempty" table:"Vulnerabilities"`
 }
 
 func (i ImageTag) String() string {
@@ -33,6 +37,93 @@ func (o OSRelease) String() string {
 	return o.PrettyName
 }
 
+// ImageScanStatus is the state of the vulnerability scan of an image tag.
+type ImageScanStatus string
+
+// ImageScanStatus enums.
+const (
+	ImageScanPending  ImageScanStatus = "pending"
+	ImageScanComplete ImageScanStatus = "complete"
+	ImageScanFailed   ImageScanStatus = "failed"
+)
+
+// ImageScan is the vulnerability scan of the latest hash of an image tag.
+type ImageScan struct {
+	Status          ImageScanStatus     `json:"status"`
+	Scanner         string              `json:"scanner"`
+	Hash            string              `json:"hash"`
+	ScannedAt       time.Time           `json:"scanned_at"`
+	Vulnerabilities VulnerabilityCounts `json:"vulnerabilities"`
+	Error           string              `json:"error,omitempty"`
+}
+
+// String summarizes the scan, such as "2 critical, 5 high".
+func (s *ImageScan) String() string {
+	switch {
+	case s == nil:
+		return "not scanned"
+	case s.Status != ImageScanComplete:
+		return string(s.Status)
+	default:
+		return s.Vulnerabilities.String()
+	}
+}
+
+// VulnerabilityCounts are the vulnerabilities found by severity.
+type VulnerabilityCounts struct {
+	Critical int `json:"critical"`
+	High     int `json:"high"`
+	Medium   int `json:"medium"`
+	Low      int `json:"low"`
+	Unknown  int `json:"unknown"`
+}
+
+// Total returns the number of vulnerabilities.
+func (c VulnerabilityCounts) Total() int {
+	return c.Critical + c.High + c.Medium + c.Low + c.Unknown
+}
+
+// HighestSeverity returns the severity of the worst vulnerability, or "none".
+func (c VulnerabilityCounts) HighestSeverity() string {
+	for _, s := range c.bySeverity() {
+		if s.count > 0 {
+			return s.name
+		}
+	}
+	return "none"
+}
+
+// String lists the non-zero counts from the highest severity, such as
+// "2 critical, 5 high", or "none".
+func (c VulnerabilityCounts) String() string {
+	var parts []string
+	for _, s := range c.bySeverity() {
+		if s.count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", s.count, s.name))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (c VulnerabilityCounts) bySeverity() []struct {
+	name  string
+	count int
+} {
+	return []struct {
+		name  string
+		count int
+	}{
+		{"critical", c.Critical},
+		{"high", c.High},
+		{"medium", c.Medium},
+		{"low", c.Low},
+		{"unknown", c.Unknown},
+	}
+}
+
 // CreateImageTagReq defines the request parameters for creating a new image tag.
 type CreateImageTagReq struct {
 	Tag     string `json:"tag"`
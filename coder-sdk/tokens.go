@@ -65,3 +65,14 @@ func (c *DefaultClient) RegenerateAPIToken(ctx context.Context, userID, tokenID
 	}
 	return resp.Key, nil
 }
+
+// RegenerateWorkspaceAgentToken mints a new token for the agent of the given
+// workspace and returns its value. The previous agent token stops working.
+// Only site admins and managers may do this.
+func (c *DefaultClient) RegenerateWorkspaceAgentToken(ctx context.Context, workspaceID string) (token string, _ error) {
+	var resp createAPITokenResp
+	if err := c.requestBody(ctx, http.MethodPost, "/api/private/workspaces/"+workspaceID+"/agent-token", nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Key, nil
+}
@@ -18,6 +18,7 @@ type User struct {
 	KeyRegeneratedAt  time.Time `json:"key_regenerated_at" table:"-"`
 	CreatedAt         time.Time `json:"created_at"         table:"CreatedAt"`
 	UpdatedAt         time.Time `json:"updated_at"         table:"-"`
+	Revoked           bool      `json:"revoked"            table:"-"`
 }
 
 // Role defines a Coder permissions role group.
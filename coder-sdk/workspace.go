@@ -2,6 +2,7 @@ package coder
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -21,6 +22,7 @@ type Workspace struct {
 	Name             string           `json:"name"               table:"Name"`
 	ImageID          string           `json:"image_id"           table:"-"`
 	ImageTag         string           `json:"image_tag"          table:"ImageTag"`
+	ImageDigest      string           `json:"image_digest"       table:"-"`
 	OrganizationID   string           `json:"organization_id"    table:"-"`
 	UserID           string           `json:"user_id"            table:"-"`
 	LastBuiltAt      time.Time        `json:"last_built_at"      table:"-"`
@@ -38,8 +40,38 @@ type Workspace struct {
 	AutoOffThreshold Duration         `json:"auto_off_threshold" table:"-"`
 	UseContainerVM   bool             `json:"use_container_vm"   table:"CVM"`
 	ResourcePoolID   string           `json:"resource_pool_id"   table:"-"`
+	SchedulingHints  *SchedulingHints `json:"scheduling_hints"   table:"-"`
 }
 
+// SchedulingHints steer where the workspace provider schedules a workspace,
+// such as onto a node pool. They're passed through to the provider.
+type SchedulingHints struct {
+	// NodeSelector holds the labels a node must have.
+	NodeSelector map[string]string `json:"node_selector,omitempty"`
+	// Tolerations let the workspace onto nodes with matching taints.
+	Tolerations []Toleration `json:"tolerations,omitempty"`
+	// Region is the region of the provider to schedule the workspace in.
+	Region string `json:"region,omitempty"`
+}
+
+// Toleration lets a workspace onto nodes with a matching taint.
+type Toleration struct {
+	Key string `json:"key"`
+	// Operator is "Equal" to match the Value of the taint, or "Exists" to
+	// match any value.
+	Operator string `json:"operator"`
+	Value    string `json:"value,omitempty"`
+	// Effect is the effect of the taints to match, NoSchedule,
+	// PreferNoSchedule or NoExecute, or empty to match all effects.
+	Effect string `json:"effect,omitempty"`
+}
+
+// Toleration operators.
+const (
+	TolerationEqual  = "Equal"
+	TolerationExists = "Exists"
+)
+
 // RebuildMessage defines the message shown when a Workspace requires a rebuild for it can be accessed.
 type RebuildMessage struct {
 	Text             string   `json:"text"`
@@ -58,6 +90,9 @@ type WorkspaceStat struct {
 	MemoryUsage     float32         `json:"memory_usage"`
 	DiskTotal       int64           `json:"disk_total"`
 	DiskUsed        int64           `json:"disk_used"`
+	// DiskPressure is the highest pressure the agents of the workspace last
+	// reported on its home volume, if any did.
+	DiskPressure DiskPressure `json:"disk_pressure,omitempty"`
 }
 
 func (e WorkspaceStat) String() string { return string(e.ContainerStatus) }
@@ -89,8 +124,15 @@ type CreateWorkspaceRequest struct {
 	Namespace       string  `json:"namespace"`
 	EnableAutoStart bool    `json:"autostart_enabled"`
 
+	// ImageDigest pins the workspace to an image by digest, such as
+	// "sha256:...", instead of by ImageTag, which may be moved.
+	ImageDigest string `json:"image_digest,omitempty"`
+
 	// TemplateID comes from the parse template route on cemanager.
 	TemplateID string `json:"template_id,omitempty"`
+
+	// SchedulingHints steer where the provider schedules the workspace.
+	SchedulingHints *SchedulingHints `json:"scheduling_hints,omitempty"`
 }
 
 // CreateWorkspace sends a request to create a workspace.
@@ -178,6 +220,19 @@ func (c *DefaultClient) Workspaces(ctx context.Context) ([]Workspace, error) {
 	return workspaces, nil
 }
 
+// EachWorkspace calls fn with each workspace Workspaces would return, as
+// they are decoded from the response, and stops at the first error fn
+// returns.
+func (c *DefaultClient) EachWorkspace(ctx context.Context, fn func(Workspace) error) error {
+	return c.requestEach(ctx, http.MethodGet, "/api/v0/workspaces", nil, func(dec *json.Decoder) error {
+		var w Workspace
+		if err := dec.Decode(&w); err != nil {
+			return xerrors.Errorf("decode workspace: %w", err)
+		}
+		return fn(w)
+	})
+}
+
 // UserWorkspacesByOrganization gets the list of workspaces owned by the given user.
 func (c *DefaultClient) UserWorkspacesByOrganization(ctx context.Context, userID, orgID string) ([]Workspace, error) {
 	var (
@@ -207,13 +262,16 @@ func (c *DefaultClient) StopWorkspace(ctx context.Context, workspaceID string) e
 // UpdateWorkspaceReq defines the update operation, only setting
 // nil-fields.
 type UpdateWorkspaceReq struct {
-	ImageID    *string  `json:"image_id"`
-	ImageTag   *string  `json:"image_tag"`
-	CPUCores   *float32 `json:"cpu_cores"`
-	MemoryGB   *float32 `json:"memory_gb"`
-	DiskGB     *int     `json:"disk_gb"`
-	GPUs       *int     `json:"gpus"`
-	TemplateID *string  `json:"template_id"`
+	ImageID     *string  `json:"image_id"`
+	ImageTag    *string  `json:"image_tag"`
+	ImageDigest *string  `json:"image_digest,omitempty"`
+	CPUCores    *float32 `json:"cpu_cores"`
+	MemoryGB    *float32 `json:"memory_gb"`
+	DiskGB      *int     `json:"disk_gb"`
+	GPUs        *int     `json:"gpus"`
+	TemplateID  *string  `json:"template_id"`
+	// SchedulingHints replace the scheduling hints of the workspace.
+	SchedulingHints *SchedulingHints `json:"scheduling_hints,omitempty"`
 }
 
 // RebuildWorkspace requests that the given workspaceID is rebuilt with no changes to its specification.
@@ -0,0 +1,113 @@
+package coder
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/xerrors"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+// WorkspaceBuildLogs returns the build log of the latest build of the
+// workspace so far, oldest first. Use FollowWorkspaceBuildLog to wait for
+// more.
+func (c *DefaultClient) WorkspaceBuildLogs(ctx context.Context, workspaceID string) ([]BuildLog, error) {
+	var logs []BuildLog
+	if err := c.requestBody(ctx, http.MethodGet, "/api/private/workspaces/"+workspaceID+"/build-log", nil, &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// WorkspaceLogStream is the output stream a workspace log line was written to.
+type WorkspaceLogStream string
+
+// WorkspaceLogStream enums.
+const (
+	WorkspaceLogStdout WorkspaceLogStream = "stdout"
+	WorkspaceLogStderr WorkspaceLogStream = "stderr"
+)
+
+// WorkspaceLog is a line of the output of the workspace's container since
+// it last started.
+type WorkspaceLog struct {
+	Time   time.Time          `json:"time"`
+	Stream WorkspaceLogStream `json:"stream"`
+	Msg    string             `json:"msg"`
+}
+
+// WorkspaceLogsReq selects the workspace log lines to return.
+type WorkspaceLogsReq struct {
+	// Since, if set, omits the lines written before it.
+	Since time.Time
+	// Tail, if positive, returns only the last Tail lines.
+	Tail int
+}
+
+func (r WorkspaceLogsReq) query() url.Values {
+	q := url.Values{}
+	if !r.Since.IsZero() {
+		q.Set("since", r.Since.UTC().Format(time.RFC3339Nano))
+	}
+	if r.Tail > 0 {
+		q.Set("tail", strconv.Itoa(r.Tail))
+	}
+	return q
+}
+
+// WorkspaceLogs returns the output of the workspace, oldest first.
+func (c *DefaultClient) WorkspaceLogs(ctx context.Context, workspaceID string, req WorkspaceLogsReq) ([]WorkspaceLog, error) {
+	var logs []WorkspaceLog
+	if err := c.requestBody(ctx, http.MethodGet, "/api/private/workspaces/"+workspaceID+"/logs", nil, &logs, withQueryParams(req.query())); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// WorkspaceLogFollowMsg wraps WorkspaceLog with the error that ended the
+// stream, if any.
+type WorkspaceLogFollowMsg struct {
+	WorkspaceLog
+	Err error
+}
+
+// DialWorkspaceLogs opens a websocket connection for the output of the
+// workspace.
+func (c *DefaultClient) DialWorkspaceLogs(ctx context.Context, workspaceID string, req WorkspaceLogsReq) (*websocket.Conn, error) {
+	return c.dialWebsocket(ctx, "/api/private/workspaces/"+workspaceID+"/watch-logs", withQueryParams(req.query()))
+}
+
+// FollowWorkspaceLogs streams the output of the workspace selected by req,
+// then the new output as it's written, until ctx is done or the connection
+// fails. The last message carries the error.
+func (c *DefaultClient) FollowWorkspaceLogs(ctx context.Context, workspaceID string, req WorkspaceLogsReq) (<-chan WorkspaceLogFollowMsg, error) {
+	ws, err := c.DialWorkspaceLogs(ctx, workspaceID, req)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan WorkspaceLogFollowMsg)
+	go func() {
+		defer ws.Close(websocket.StatusNormalClosure, "normal closure")
+		defer close(ch)
+		for {
+			var msg WorkspaceLog
+			if err := wsjson.Read(ctx, ws, &msg); err != nil {
+				select {
+				case ch <- WorkspaceLogFollowMsg{Err: xerrors.Errorf("read workspace log: %w", err)}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			select {
+			case ch <- WorkspaceLogFollowMsg{WorkspaceLog: msg}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
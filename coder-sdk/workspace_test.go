@@ -0,0 +1,51 @@
+package coder_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+)
+
+func TestEachWorkspace(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "EachWorkspace is a GET", http.MethodGet, r.Method)
+		assert.Equal(t, "Path matches", "/api/v0/workspaces", r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[{"id":"1","name":"front-end"},` + "\n" + `{"id":"2","name":"back-end"},{"id":"3","name":"ci"}]`))
+	}))
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	assert.Success(t, "failed to parse test server URL", err)
+	client, err := coder.NewClient(coder.ClientOptions{
+		BaseURL: u,
+		Token:   "JcmErkJjju-KSrztst0IJX7xGJhKQPtfv",
+	})
+	assert.Success(t, "failed to create coder.Client", err)
+
+	var names []string
+	err = client.EachWorkspace(context.Background(), func(w coder.Workspace) error {
+		names = append(names, w.Name)
+		return nil
+	})
+	assert.Success(t, "each workspace", err)
+	assert.Equal(t, "every workspace in order", []string{"front-end", "back-end", "ci"}, names)
+
+	stop := xerrors.New("stop")
+	names = nil
+	err = client.EachWorkspace(context.Background(), func(w coder.Workspace) error {
+		names = append(names, w.Name)
+		return stop
+	})
+	assert.True(t, "returns the error of fn", xerrors.Is(err, stop))
+	assert.Equal(t, "stops at the first error", []string{"front-end"}, names)
+}
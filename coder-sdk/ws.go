@@ -19,11 +19,22 @@ func (c *DefaultClient) dialWebsocket(ctx context.Context, path string, options
 		url = *config.BaseURLOverride
 	}
 	url.Path = path
+	if config.Query != nil {
+		url.RawQuery = config.Query.Encode()
+	}
 
 	headers := http.Header{}
-	headers.Set("Session-Token", c.token)
+	c.setAuthHeaders(headers)
+
+	opts := &websocket.DialOptions{HTTPHeader: headers}
+	// Reuse the configured transport (e.g. for proxies). websocket.Dial
+	// rejects clients with a timeout, so those fall back to the default.
+	if c.httpClient.Timeout == 0 {
+		opts.HTTPClient = c.httpClient
+	}
 
-	conn, resp, err := websocket.Dial(ctx, url.String(), &websocket.DialOptions{HTTPHeader: headers})
+	conn, resp, err := websocket.Dial(ctx, url.String(), opts)
+	c.checkDeprecation(http.MethodGet, path, resp)
 	if err != nil {
 		if resp != nil {
 			return nil, NewHTTPError(resp)
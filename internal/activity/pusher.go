@@ -2,12 +2,12 @@ package activity
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"golang.org/x/time/rate"
 
 	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/pkg/clog"
 )
 
@@ -42,6 +42,6 @@ func (p *Pusher) Push(ctx context.Context) {
 	}
 
 	if err := p.client.PushActivity(ctx, p.source, p.workspaceID); err != nil {
-		clog.Log(clog.Error(fmt.Sprintf("push activity: %s", err)))
+		clog.Log(clog.Error(i18n.Sprintf("push activity: %s", err)))
 	}
 }
@@ -0,0 +1,117 @@
+// Package asciicast records terminal sessions in the asciicast v2 format
+// played back by asciinema.
+//
+// See https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md.
+package asciicast
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/xerrors"
+)
+
+// Header is the first line of an asciicast file.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event types.
+const (
+	EventOutput = "o"
+	EventInput  = "i"
+)
+
+// Recorder writes the events of a session as they happen.
+// It is safe for concurrent use.
+type Recorder struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	err   error
+
+	// pending holds the bytes of a multi-byte character split across
+	// writes, per event type, so it isn't recorded as two invalid ones.
+	pending map[string][]byte
+}
+
+// NewRecorder writes the header to w and returns a Recorder that appends
+// events to it. The Version and Timestamp of the header are filled in.
+func NewRecorder(w io.Writer, h Header) (*Recorder, error) {
+	start := time.Now()
+	h.Version = 2
+	h.Timestamp = start.Unix()
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		return nil, xerrors.Errorf("write header: %w", err)
+	}
+	return &Recorder{w: w, start: start, pending: make(map[string][]byte)}, nil
+}
+
+// Record appends an event of the given type. Errors are sticky: once a write
+// fails, further events are dropped and the error is returned by Err.
+func (r *Recorder) Record(typ string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	data = append(r.pending[typ], data...)
+	n := completeUTF8(data)
+	r.pending[typ] = append([]byte(nil), data[n:]...)
+	data = data[:n]
+	if len(data) == 0 {
+		return
+	}
+	elapsed := time.Since(r.start).Seconds()
+	if err := json.NewEncoder(r.w).Encode([]interface{}{elapsed, typ, string(data)}); err != nil {
+		r.err = xerrors.Errorf("write event: %w", err)
+	}
+}
+
+// Err returns the first error encountered while recording.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Writer returns an io.Writer that records everything written to it as
+// events of the given type. Writes never fail, so it can be used with
+// io.MultiWriter without disrupting the session being recorded.
+func (r *Recorder) Writer(typ string) io.Writer {
+	return eventWriter{r: r, typ: typ}
+}
+
+type eventWriter struct {
+	r   *Recorder
+	typ string
+}
+
+func (w eventWriter) Write(p []byte) (int, error) {
+	w.r.Record(w.typ, p)
+	return len(p), nil
+}
+
+// completeUTF8 returns the length of the prefix of p that doesn't end in
+// an incomplete UTF-8 sequence.
+func completeUTF8(p []byte) int {
+	// A character is at most utf8.UTFMax bytes, so only the tail can be incomplete.
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(p[i]) {
+			continue
+		}
+		if utf8.FullRune(p[i:]) {
+			return len(p)
+		}
+		return i
+	}
+	return len(p)
+}
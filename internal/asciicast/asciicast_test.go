@@ -0,0 +1,44 @@
+package asciicast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	r, err := NewRecorder(&buf, Header{Width: 80, Height: 24, Env: map[string]string{"TERM": "xterm"}})
+	assert.Success(t, "new recorder", err)
+
+	out := r.Writer(EventOutput)
+	_, _ = out.Write([]byte("hello "))
+	// "é" split across two writes.
+	_, _ = out.Write([]byte{0xc3})
+	_, _ = out.Write([]byte{0xa9})
+	r.Record(EventInput, []byte("ls\r"))
+	assert.Success(t, "no error", r.Err())
+
+	scanner := bufio.NewScanner(&buf)
+	assert.True(t, "has header", scanner.Scan())
+	var h Header
+	assert.Success(t, "decode header", json.Unmarshal(scanner.Bytes(), &h))
+	assert.Equal(t, "version", 2, h.Version)
+	assert.Equal(t, "width", 80, h.Width)
+
+	var events [][]interface{}
+	for scanner.Scan() {
+		var e []interface{}
+		assert.Success(t, "decode event", json.Unmarshal(scanner.Bytes(), &e))
+		events = append(events, e)
+	}
+	assert.Equal(t, "event count", 3, len(events))
+	assert.Equal(t, "first output", "hello ", events[0][2])
+	assert.Equal(t, "joined character", "é", events[1][2])
+	assert.Equal(t, "input type", EventInput, events[2][1])
+}
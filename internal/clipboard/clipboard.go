@@ -0,0 +1,102 @@
+// Package clipboard writes text to the system clipboard using the
+// platform's clipboard utilities.
+package clipboard
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/cli/safeexec"
+	"golang.org/x/term"
+	"golang.org/x/xerrors"
+)
+
+// ErrUnavailable is returned when no clipboard is accessible, such as on
+// headless systems or over SSH without a display.
+var ErrUnavailable = errors.New("no system clipboard available")
+
+// osc52 is the last candidate, which isn't a command: it writes the OSC 52
+// escape sequence to the terminal, which terminals that support it, over SSH
+// too, copy to the clipboard of the machine they run on.
+const osc52 = "osc52"
+
+// Stubbed in tests, so that the candidates tried don't depend on the host.
+var (
+	lookPath = safeexec.LookPath
+	// terminal returns the terminal OSC 52 sequences are written to, or nil
+	// if there's none.
+	terminal = func() io.Writer {
+		if !term.IsTerminal(int(os.Stderr.Fd())) {
+			return nil
+		}
+		return os.Stderr
+	}
+)
+
+// candidates returns the commands that may write stdin to the clipboard on
+// goos, in order of preference, with getenv looking up the env.
+func candidates(goos string, getenv func(string) string) [][]string {
+	switch goos {
+	case "darwin":
+		return [][]string{{"pbcopy"}, {osc52}}
+	case "windows":
+		return [][]string{{"clip.exe"}}
+	}
+
+	var cmds [][]string
+	if getenv("WAYLAND_DISPLAY") != "" {
+		cmds = append(cmds, []string{"wl-copy"})
+	}
+	if getenv("DISPLAY") != "" {
+		cmds = append(cmds,
+			[]string{"xclip", "-selection", "clipboard"},
+			[]string{"xsel", "--clipboard", "--input"},
+		)
+	}
+	// WSL has access to the Windows clipboard.
+	cmds = append(cmds, []string{"clip.exe"}, []string{osc52})
+	return cmds
+}
+
+// Write places text on the system clipboard.
+func Write(ctx context.Context, text string) error {
+	for _, args := range candidates(runtime.GOOS, os.Getenv) {
+		if args[0] == osc52 {
+			w := terminal()
+			if w == nil {
+				continue
+			}
+			if err := writeOSC52(w, text); err != nil {
+				return xerrors.Errorf("%s: %w", osc52, err)
+			}
+			return nil
+		}
+		path, err := lookPath(args[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.CommandContext(ctx, path, args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		// Stdout and stderr are left unset, since xclip and wl-copy fork a
+		// process that serves the selection and keeps them open, which
+		// would make waiting for their output hang.
+		if err := cmd.Run(); err != nil {
+			return xerrors.Errorf("%s: %w", args[0], err)
+		}
+		return nil
+	}
+	return ErrUnavailable
+}
+
+// writeOSC52 writes the sequence setting the clipboard to text.
+func writeOSC52(w io.Writer, text string) error {
+	_, err := fmt.Fprintf(w, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
@@ -0,0 +1,54 @@
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"golang.org/x/xerrors"
+)
+
+func Test_candidates(t *testing.T) {
+	t.Parallel()
+	env := func(vars map[string]string) func(string) string {
+		return func(key string) string { return vars[key] }
+	}
+	for _, tc := range []struct {
+		name string
+		goos string
+		env  map[string]string
+		want [][]string
+	}{
+		{"macOS", "darwin", nil, [][]string{{"pbcopy"}, {osc52}}},
+		{"Windows", "windows", nil, [][]string{{"clip.exe"}}},
+		{"Wayland", "linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, [][]string{{"wl-copy"}, {"clip.exe"}, {osc52}}},
+		{"X11", "linux", map[string]string{"DISPLAY": ":0"}, [][]string{
+			{"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}, {"clip.exe"}, {osc52},
+		}},
+		{"XWayland", "linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, [][]string{
+			{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}, {"clip.exe"}, {osc52},
+		}},
+		{"headless", "linux", nil, [][]string{{"clip.exe"}, {osc52}}},
+	} {
+		assert.Equal(t, tc.name, tc.want, candidates(tc.goos, env(tc.env)))
+	}
+}
+
+// Not parallel: lookPath and terminal are replaced for the package.
+func TestWrite(t *testing.T) {
+	prevLookPath, prevTerminal := lookPath, terminal
+	t.Cleanup(func() { lookPath, terminal = prevLookPath, prevTerminal })
+	lookPath = func(file string) (string, error) { return "", exec.ErrNotFound }
+
+	terminal = func() io.Writer { return nil }
+	err := Write(context.Background(), "secret")
+	assert.True(t, "no command and no terminal", xerrors.Is(err, ErrUnavailable))
+
+	var buf bytes.Buffer
+	terminal = func() io.Writer { return &buf }
+	assert.Success(t, "no command falls back to OSC 52", Write(context.Background(), "secret"))
+	assert.Equal(t, "OSC 52 sequence", "\x1b]52;c;c2VjcmV0\a", buf.String())
+}
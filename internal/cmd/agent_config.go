@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"cdr.dev/slog"
+	"cdr.dev/slog/sloggers/sloghuman"
+	"cdr.dev/slog/sloggers/slogjson"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/wsnet"
+)
+
+// agentLogLevels are the log levels the deployment can set on running agents.
+var agentLogLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// agentRuntime holds the settings of a running agent the deployment can
+// change over the broker connection, see wsnet.AgentConfig.
+type agentRuntime struct {
+	level int32
+	// metrics is 1 while agent metrics are reported.
+	metrics int32
+}
+
+func newAgentRuntime() *agentRuntime {
+	return &agentRuntime{level: int32(slog.LevelDebug), metrics: 1}
+}
+
+// logger returns a logger writing to each of ws at the current log level,
+// as JSON lines if json is set.
+func (r *agentRuntime) logger(json bool, ws ...io.Writer) slog.Logger {
+	sinks := make([]slog.Sink, 0, len(ws))
+	for _, w := range ws {
+		sink := sloghuman.Sink(w)
+		if json {
+			sink = slogjson.Sink(w)
+		}
+		sinks = append(sinks, levelSink{Sink: sink, level: &r.level})
+	}
+	return slog.Make(sinks...).Leveled(slog.LevelDebug)
+}
+
+// apply applies the configuration pushed by the deployment, after checking
+// all of it.
+func (r *agentRuntime) apply(log slog.Logger, config wsnet.AgentConfig) error {
+	var level slog.Level
+	if config.LogLevel != "" {
+		var ok bool
+		level, ok = agentLogLevels[strings.ToLower(config.LogLevel)]
+		if !ok {
+			return xerrors.Errorf("invalid log level %q: must be debug, info, warn or error", config.LogLevel)
+		}
+	}
+
+	ctx := context.Background()
+	if config.LogLevel != "" {
+		atomic.StoreInt32(&r.level, int32(level))
+		log.Info(ctx, "log level changed", slog.F("level", level))
+	}
+	if config.Metrics != nil {
+		var metrics int32
+		if *config.Metrics {
+			metrics = 1
+		}
+		atomic.StoreInt32(&r.metrics, metrics)
+		log.Info(ctx, "metrics toggled", slog.F("enabled", *config.Metrics))
+	}
+	if config.AllowedPorts != nil {
+		log.Info(ctx, "allowed ports changed", slog.F("policies", config.AllowedPorts))
+	}
+	return nil
+}
+
+// levelSink drops entries below a level that can change while logging.
+type levelSink struct {
+	slog.Sink
+	level *int32
+}
+
+func (s levelSink) LogEntry(ctx context.Context, e slog.SinkEntry) {
+	if e.Level >= slog.Level(atomic.LoadInt32(s.level)) {
+		s.Sink.LogEntry(ctx, e)
+	}
+}
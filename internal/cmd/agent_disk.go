@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"cdr.dev/slog"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+)
+
+// agentDiskPathEnv sets the directory whose volume the agent monitors when
+// no --disk-path flag is given.
+const agentDiskPathEnv = "CODER_AGENT_DISK_PATH"
+
+var (
+	// agentDiskInterval is how often the agent checks the disk usage.
+	agentDiskInterval = time.Minute
+	// agentDiskReportInterval is how often the agent reports the disk
+	// pressure when it didn't change, so the deployment knows it's current.
+	agentDiskReportInterval = 15 * time.Minute
+)
+
+// diskThresholds are the percentages of the volume in use at which its
+// pressure becomes a warning, then critical.
+type diskThresholds struct {
+	warn     float64
+	critical float64
+}
+
+func (t diskThresholds) check() error {
+	if t.warn <= 0 || t.warn > 100 || t.critical <= 0 || t.critical > 100 {
+		return xerrors.New("disk thresholds must be percentages between 0 and 100")
+	}
+	if t.warn > t.critical {
+		return xerrors.Errorf("the disk warning threshold %g%% is above the critical one %g%%", t.warn, t.critical)
+	}
+	return nil
+}
+
+// pressure returns the pressure of a volume of total bytes with used bytes
+// in use.
+func (t diskThresholds) pressure(total, used uint64) coder.DiskPressure {
+	if total == 0 {
+		return coder.DiskPressureOK
+	}
+	percent := float64(used) / float64(total) * 100
+	switch {
+	case percent >= t.critical:
+		return coder.DiskPressureCritical
+	case percent >= t.warn:
+		return coder.DiskPressureWarning
+	default:
+		return coder.DiskPressureOK
+	}
+}
+
+// agentDiskPath returns the directory whose volume the agent monitors: the
+// flag, the env variable, or else the home directory.
+func agentDiskPath(flag string) (string, error) {
+	if flag != "" {
+		return flag, nil
+	}
+	if env := os.Getenv(agentDiskPathEnv); env != "" {
+		return env, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", xerrors.Errorf("find home directory: %w", err)
+	}
+	return home, nil
+}
+
+// agentDiskMonitor reports the pressure on the volume of path to the
+// deployment whenever it changes, and every agentDiskReportInterval
+// otherwise.
+type agentDiskMonitor struct {
+	log        slog.Logger
+	path       string
+	label      string
+	thresholds diskThresholds
+	// enabled reports whether agent metrics are reported, which the
+	// deployment can turn off.
+	enabled func() bool
+	report  func(ctx context.Context, disk coder.AgentDisk) error
+	// usage defaults to diskUsage.
+	usage func(dir string) (total, used uint64, err error)
+
+	last       coder.DiskPressure
+	reported   coder.DiskPressure
+	reportedAt time.Time
+}
+
+// run checks the disk usage every agentDiskInterval until ctx is done.
+func (m *agentDiskMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(agentDiskInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.check(ctx, time.Now()); err != nil {
+			m.log.Warn(ctx, "check disk usage", slog.F("path", m.path), slog.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *agentDiskMonitor) check(ctx context.Context, now time.Time) error {
+	usage := m.usage
+	if usage == nil {
+		usage = diskUsage
+	}
+	total, used, err := usage(m.path)
+	if err != nil {
+		return xerrors.Errorf("get disk usage: %w", err)
+	}
+	pressure := m.thresholds.pressure(total, used)
+	if pressure != m.last {
+		fields := []slog.Field{slog.F("path", m.path), slog.F("pressure", pressure), slog.F("used_bytes", used), slog.F("total_bytes", total)}
+		if pressure == coder.DiskPressureOK {
+			m.log.Info(ctx, "disk pressure changed", fields...)
+		} else {
+			m.log.Warn(ctx, "disk pressure changed", fields...)
+		}
+		m.last = pressure
+	}
+	if m.enabled != nil && !m.enabled() {
+		return nil
+	}
+	if pressure == m.reported && now.Sub(m.reportedAt) < agentDiskReportInterval {
+		return nil
+	}
+	// A failed report isn't retried before the next one is due, so that a
+	// deployment that doesn't take them isn't asked every check.
+	m.reported, m.reportedAt = pressure, now
+	err = m.report(ctx, coder.AgentDisk{
+		Label:    m.label,
+		Path:     m.path,
+		Pressure: pressure,
+	})
+	if err != nil {
+		return xerrors.Errorf("report disk pressure: %w", err)
+	}
+	return nil
+}
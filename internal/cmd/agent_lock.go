@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// errAgentLocked is returned when another agent holds the lock.
+var errAgentLocked = xerrors.New("agent lock held by another process")
+
+// agentTakeoverTimeout is how long --takeover waits for the running agent to
+// stop.
+const agentTakeoverTimeout = 10 * time.Second
+
+// agentLockPath returns the lock file of the agent with the label, next to
+// its logs, so that agents of different labels can run side by side.
+func agentLockPath(label string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", xerrors.Errorf("find home directory: %w", err)
+	}
+	name := "agent.lock"
+	if label != "" {
+		name = "agent-" + label + ".lock"
+	}
+	return filepath.Join(home, ".coder", name), nil
+}
+
+// agentLock keeps other agents from starting in the workspace while it's
+// held. The lock is released by the OS when the process exits, so a crashed
+// agent doesn't leave a stale lock behind.
+type agentLock struct {
+	f *os.File
+}
+
+// lockAgent takes the lock at path and records the pid of the process in
+// it, or returns errAgentLocked if another process holds it.
+func lockAgent(path string) (*agentLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, xerrors.Errorf("create lock directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, xerrors.Errorf("open lock file: %w", err)
+	}
+	if err := tryLockFile(f); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(0); err != nil {
+		_ = f.Close()
+		return nil, xerrors.Errorf("truncate lock file: %w", err)
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		_ = f.Close()
+		return nil, xerrors.Errorf("write lock file: %w", err)
+	}
+	return &agentLock{f: f}, nil
+}
+
+// Close releases the lock. The file is left in place, since removing it
+// would let another agent lock a new file while a third still waits on the
+// removed one.
+func (l *agentLock) Close() error {
+	return l.f.Close()
+}
+
+// agentLockPID returns the pid recorded in the lock file, or 0 if there's
+// none.
+func agentLockPID(path string) int {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil || pid <= 0 {
+		return 0
+	}
+	return pid
+}
+
+// acquireAgentLock takes the lock of the agent at path. With takeover, the
+// agent holding it is stopped first; otherwise an error explains how to.
+func acquireAgentLock(ctx context.Context, path string, takeover bool) (*agentLock, error) {
+	lock, err := lockAgent(path)
+	if !xerrors.Is(err, errAgentLocked) {
+		return lock, err
+	}
+	pid := agentLockPID(path)
+	if !takeover {
+		holder := "another process"
+		if pid != 0 {
+			holder = fmt.Sprintf("process %d", pid)
+		}
+		return nil, clog.Error("another agent is already running in this workspace",
+			fmt.Sprintf("%s holds the lock %s", holder, path),
+			clog.BlankLine,
+			clog.Hintf("check the supervisor of the workspace isn't starting the agent twice"),
+			clog.Tipf("use --takeover to stop the running agent and replace it"),
+		)
+	}
+	if pid == 0 {
+		return nil, xerrors.Errorf("the agent holding %s didn't record its pid, stop it manually", path)
+	}
+	if err := stopAgentProcess(pid); err != nil {
+		return nil, xerrors.Errorf("stop agent process %d: %w", pid, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, agentTakeoverTimeout)
+	defer cancel()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, xerrors.Errorf("agent process %d didn't stop within %s", pid, agentTakeoverTimeout)
+		case <-ticker.C:
+		}
+		lock, err := lockAgent(path)
+		if !xerrors.Is(err, errAgentLocked) {
+			return lock, err
+		}
+	}
+}
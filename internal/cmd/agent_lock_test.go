@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"golang.org/x/xerrors"
+)
+
+func Test_agentLock(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "agent.lock")
+
+	lock, err := lockAgent(path)
+	assert.Success(t, "lock", err)
+	assert.Equal(t, "pid recorded", os.Getpid(), agentLockPID(path))
+
+	_, err = lockAgent(path)
+	assert.True(t, "locked", xerrors.Is(err, errAgentLocked))
+	_, err = acquireAgentLock(context.Background(), path, false)
+	assert.ErrorContains(t, "explains", err, "another agent is already running")
+
+	assert.Success(t, "unlock", lock.Close())
+	lock, err = acquireAgentLock(context.Background(), path, false)
+	assert.Success(t, "lock again", err)
+	assert.Success(t, "unlock", lock.Close())
+}
+
+func Test_agentLockPID(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	assert.Equal(t, "missing", 0, agentLockPID(filepath.Join(dir, "missing.lock")))
+	path := filepath.Join(dir, "agent.lock")
+	assert.Success(t, "write", ioutil.WriteFile(path, []byte("garbage"), 0600))
+	assert.Equal(t, "garbage", 0, agentLockPID(path))
+	assert.Success(t, "write", ioutil.WriteFile(path, []byte("42\n"), 0600))
+	assert.Equal(t, "pid", 42, agentLockPID(path))
+}
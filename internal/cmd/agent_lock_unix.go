@@ -0,0 +1,29 @@
+// +build !windows
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// tryLockFile takes an exclusive flock of f without waiting, returning
+// errAgentLocked if another open file holds it.
+func tryLockFile(f *os.File) error {
+	err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if xerrors.Is(err, unix.EWOULDBLOCK) {
+		return errAgentLocked
+	}
+	if err != nil {
+		return xerrors.Errorf("lock file: %w", err)
+	}
+	return nil
+}
+
+// stopAgentProcess asks the agent to shut down like its supervisor would.
+func stopAgentProcess(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/xerrors"
+)
+
+// tryLockFile locks a byte of f far past its end without waiting, returning
+// errAgentLocked if another handle holds it. Windows locks are mandatory,
+// so locking the pid itself would keep others from reading it.
+func tryLockFile(f *os.File) error {
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, 1, 0, &windows.Overlapped{OffsetHigh: 1})
+	if xerrors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errAgentLocked
+	}
+	if err != nil {
+		return xerrors.Errorf("lock file: %w", err)
+	}
+	return nil
+}
+
+// stopAgentProcess terminates the agent, as Windows has no SIGTERM.
+func stopAgentProcess(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
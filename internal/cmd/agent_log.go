@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// agentLogFileEnv sets the log file of the agent when no --log-file flag is
+// given.
+const agentLogFileEnv = "CODER_AGENT_LOG_FILE"
+
+// agentLogPath returns the file the agent logs to on top of stderr, from
+// the flag or else the env variable, defaulting to one in the home
+// directory named after the label. "off" logs to stderr only, for which it
+// returns "", as does the default when there's no home directory.
+func agentLogPath(flag, label string) (path string, isDefault bool) {
+	path = flag
+	if path == "" {
+		path = os.Getenv(agentLogFileEnv)
+	}
+	if path == "off" {
+		return "", false
+	}
+	if path != "" {
+		return path, false
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", true
+	}
+	name := "agent.log"
+	if label != "" {
+		name = "agent-" + label + ".log"
+	}
+	return filepath.Join(home, ".coder", "logs", name), true
+}
+
+// rotatingFile is a log file that's moved aside to a backup named after the
+// time of the move once it grows past maxSize bytes or has been written to
+// for maxAge, keeping the maxBackups most recent backups. Zero values
+// disable the limits.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	now        func() time.Time
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// openRotatingFile opens the log file at path, appending to it if it exists.
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		now:        time.Now,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, xerrors.Errorf("create log directory: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return xerrors.Errorf("open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return xerrors.Errorf("stat log file: %w", err)
+	}
+	r.f, r.size, r.openedAt = f, info.Size(), r.now()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	full := r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize
+	old := r.maxAge > 0 && r.now().Sub(r.openedAt) >= r.maxAge
+	if full || old {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate moves the file aside and opens a new one.
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return xerrors.Errorf("close log file: %w", err)
+	}
+	r.f = nil
+	if r.size > 0 {
+		if err := os.Rename(r.path, r.backupPath(r.now())); err != nil {
+			return xerrors.Errorf("move log file aside: %w", err)
+		}
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	return r.prune()
+}
+
+// backupPath returns the path of the backup made at t, such as
+// agent-20210102T150405.000.log for agent.log.
+func (r *rotatingFile) backupPath(t time.Time) string {
+	ext := filepath.Ext(r.path)
+	return strings.TrimSuffix(r.path, ext) + "-" + t.UTC().Format("20060102T150405.000") + ext
+}
+
+// prune removes the oldest backups beyond maxBackups.
+func (r *rotatingFile) prune() error {
+	if r.maxBackups <= 0 {
+		return nil
+	}
+	ext := filepath.Ext(r.path)
+	// The pattern leaves out the log files of agents with other labels.
+	backups, err := filepath.Glob(strings.TrimSuffix(r.path, ext) + "-[0-9][0-9][0-9][0-9][0-9][0-9][0-9][0-9]T*" + ext)
+	if err != nil {
+		return xerrors.Errorf("list log backups: %w", err)
+	}
+	// The timestamps sort in the order of the backups.
+	sort.Strings(backups)
+	for len(backups) > r.maxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			return xerrors.Errorf("remove log backup: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
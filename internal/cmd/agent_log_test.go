@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_agentLogPath(t *testing.T) {
+	t.Parallel()
+
+	path, isDefault := agentLogPath("", "")
+	assert.True(t, "default", isDefault)
+	assert.True(t, "default", strings.HasSuffix(path, filepath.Join(".coder", "logs", "agent.log")))
+	path, _ = agentLogPath("", "gpu")
+	assert.True(t, "labeled", strings.HasSuffix(path, filepath.Join(".coder", "logs", "agent-gpu.log")))
+
+	path, isDefault = agentLogPath("/var/log/agent.log", "gpu")
+	assert.False(t, "flag", isDefault)
+	assert.Equal(t, "flag", "/var/log/agent.log", path)
+	path, isDefault = agentLogPath("off", "")
+	assert.False(t, "off", isDefault)
+	assert.Equal(t, "off", "", path)
+}
+
+func Test_rotatingFile(t *testing.T) {
+	t.Parallel()
+
+	list := func(t *testing.T, dir string) []string {
+		files, err := ioutil.ReadDir(dir)
+		assert.Success(t, "read dir", err)
+		names := make([]string, 0, len(files))
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		return names
+	}
+
+	t.Run("Size", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		now := time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC)
+		f, err := openRotatingFile(filepath.Join(dir, "agent.log"), 10, 0, 2)
+		assert.Success(t, "open", err)
+		defer f.Close()
+		f.now = func() time.Time { return now }
+
+		// A sibling of another label survives pruning.
+		assert.Success(t, "write sibling", ioutil.WriteFile(filepath.Join(dir, "agent-gpu.log"), []byte("gpu\n"), 0600))
+		for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+			now = now.Add(time.Second)
+			_, err := f.Write([]byte(line))
+			assert.Success(t, "write", err)
+		}
+		assert.Equal(t, "files", []string{
+			"agent-20210102T150408.000.log",
+			"agent-20210102T150409.000.log",
+			"agent-gpu.log",
+			"agent.log",
+		}, list(t, dir))
+		raw, err := ioutil.ReadFile(filepath.Join(dir, "agent.log"))
+		assert.Success(t, "read", err)
+		assert.Equal(t, "current", "fourth\n", string(raw))
+		raw, err = ioutil.ReadFile(filepath.Join(dir, "agent-20210102T150409.000.log"))
+		assert.Success(t, "read", err)
+		assert.Equal(t, "latest backup", "third\n", string(raw))
+	})
+
+	t.Run("Age", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		now := time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC)
+		path := filepath.Join(dir, "agent.log")
+		f, err := openRotatingFile(path, 0, time.Hour, 0)
+		assert.Success(t, "open", err)
+		defer f.Close()
+		f.now = func() time.Time { return now }
+		f.openedAt = now
+
+		_, err = f.Write([]byte("first\n"))
+		assert.Success(t, "write", err)
+		now = now.Add(30 * time.Minute)
+		_, err = f.Write([]byte("second\n"))
+		assert.Success(t, "write", err)
+		assert.Equal(t, "not rotated yet", []string{"agent.log"}, list(t, dir))
+		now = now.Add(30 * time.Minute)
+		_, err = f.Write([]byte("third\n"))
+		assert.Success(t, "write", err)
+		assert.Equal(t, "rotated", []string{"agent-20210102T160405.000.log", "agent.log"}, list(t, dir))
+	})
+}
+
+func Test_agentRuntimeJSON(t *testing.T) {
+	t.Parallel()
+	var a, b strings.Builder
+	log := newAgentRuntime().logger(true, &a, &b)
+	log.Info(context.Background(), "hello")
+	for _, out := range []string{a.String(), b.String()} {
+		var entry map[string]interface{}
+		assert.Success(t, "json line", json.Unmarshal([]byte(out), &entry))
+		assert.Equal(t, "msg", "hello", entry["msg"])
+	}
+}
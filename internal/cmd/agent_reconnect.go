@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"cdr.dev/slog"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/wsnet"
+)
+
+// agentBackoff is how the agent waits between attempts to reconnect to the
+// broker: exponentially longer from initial up to max, with jitter so that
+// the agents of a deployment don't all reconnect at once after an outage.
+type agentBackoff struct {
+	initial time.Duration
+	max     time.Duration
+	// maxRetries is the number of attempts after which the agent gives up
+	// and exits, or 0 to retry for ever.
+	maxRetries int
+	// jitter is the fraction of the delay by which it's randomly shortened
+	// or lengthened.
+	jitter float64
+	// random returns a number in [0, 1).
+	random func() float64
+}
+
+// agentJitter is the jitter of the reconnect delays of the agent.
+const agentJitter = 0.2
+
+func (b agentBackoff) check() error {
+	if b.initial <= 0 {
+		return xerrors.Errorf("--reconnect-delay must be positive, not %s", b.initial)
+	}
+	if b.max < b.initial {
+		return xerrors.Errorf("--reconnect-max-delay %s must not be shorter than --reconnect-delay %s", b.max, b.initial)
+	}
+	if b.maxRetries < 0 {
+		return xerrors.Errorf("--reconnect-max-retries must not be negative, not %d", b.maxRetries)
+	}
+	return nil
+}
+
+// next returns the delay before the reconnect attempt, counting from 1, or
+// false once the retries are exhausted. It's used as
+// wsnet.ListenOptions.NextReconnect.
+func (b agentBackoff) next(attempt int) (time.Duration, bool) {
+	if b.maxRetries > 0 && attempt > b.maxRetries {
+		return 0, false
+	}
+	delay := float64(b.initial) * math.Pow(2, float64(attempt-1))
+	if delay > float64(b.max) {
+		delay = float64(b.max)
+	}
+	random := b.random
+	if random == nil {
+		random = rand.Float64
+	}
+	delay *= 1 + b.jitter*(2*random()-1)
+	return time.Duration(delay), true
+}
+
+// agentConnState logs the transitions of the connection of the agent to
+// the broker, and reports the listener giving up.
+type agentConnState struct {
+	log slog.Logger
+	// failed receives the error of the listener giving up on reconnecting.
+	failed chan error
+
+	mu    sync.Mutex
+	state wsnet.ListenerState
+	// lostAt is when the connection was lost, to log the length of outages.
+	lostAt time.Time
+	// connected, if set, is called as the connection is lost and regained.
+	connected func(bool)
+}
+
+func newAgentConnState(log slog.Logger) *agentConnState {
+	return &agentConnState{log: log, failed: make(chan error, 1)}
+}
+
+// onConnected makes the state call f with whether the agent is connected to
+// the broker, whenever that changes. A nil f stops the calls.
+func (s *agentConnState) onConnected(f func(connected bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connected = f
+}
+
+// change is used as wsnet.ListenOptions.OnStateChange.
+func (s *agentConnState) change(c wsnet.ListenerStateChange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx := context.Background()
+	fields := []slog.Field{
+		slog.F("from", s.state),
+		slog.F("to", c.State),
+	}
+	if c.Attempt > 0 {
+		fields = append(fields, slog.F("attempt", c.Attempt))
+	}
+	if c.Err != nil {
+		fields = append(fields, slog.Error(c.Err))
+	}
+	wasConnected := s.state == wsnet.ListenerConnected
+	s.state = c.State
+	if isConnected := c.State == wsnet.ListenerConnected; s.connected != nil && isConnected != wasConnected {
+		s.connected(isConnected)
+	}
+
+	switch c.State {
+	case wsnet.ListenerConnected:
+		if !s.lostAt.IsZero() {
+			fields = append(fields, slog.F("outage", time.Since(s.lostAt).Round(time.Millisecond).String()))
+			s.lostAt = time.Time{}
+		}
+		s.log.Info(ctx, "broker connection state changed", fields...)
+	case wsnet.ListenerDisconnected:
+		s.lostAt = time.Now()
+		s.log.Warn(ctx, "broker connection state changed", fields...)
+	case wsnet.ListenerReconnecting:
+		fields = append(fields, slog.F("retry_in", c.Wait.Round(time.Millisecond).String()))
+		s.log.Info(ctx, "broker connection state changed", fields...)
+	case wsnet.ListenerGaveUp:
+		s.log.Error(ctx, "broker connection state changed", fields...)
+		select {
+		case s.failed <- c.Err:
+		default:
+		}
+	default:
+		s.log.Info(ctx, "broker connection state changed", fields...)
+	}
+}
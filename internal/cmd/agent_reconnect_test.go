@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"cdr.dev/slog"
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/wsnet"
+)
+
+func Test_agentBackoff(t *testing.T) {
+	t.Parallel()
+
+	b := agentBackoff{initial: time.Second, max: 10 * time.Second, jitter: agentJitter, random: func() float64 { return 0.5 }}
+	assert.Success(t, "valid", b.check())
+	for attempt, want := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		4: 8 * time.Second,
+		5: 10 * time.Second,
+		9: 10 * time.Second,
+	} {
+		got, ok := b.next(attempt)
+		assert.True(t, "retries for ever", ok)
+		assert.Equal(t, "delay", want, got)
+	}
+
+	b.random = func() float64 { return 0 }
+	got, _ := b.next(1)
+	assert.Equal(t, "shortened by the jitter", 800*time.Millisecond, got)
+
+	b.maxRetries = 3
+	_, ok := b.next(3)
+	assert.True(t, "last retry", ok)
+	_, ok = b.next(4)
+	assert.False(t, "gives up", ok)
+
+	assert.Error(t, "max below initial", agentBackoff{initial: time.Minute, max: time.Second}.check())
+	assert.Error(t, "no delay", agentBackoff{max: time.Second}.check())
+}
+
+func Test_agentConnState(t *testing.T) {
+	t.Parallel()
+
+	s := newAgentConnState(slog.Make())
+	s.change(wsnet.ListenerStateChange{State: wsnet.ListenerConnected})
+	var connected []bool
+	s.onConnected(func(c bool) { connected = append(connected, c) })
+	s.change(wsnet.ListenerStateChange{State: wsnet.ListenerDisconnected, Err: errors.New("EOF")})
+	assert.False(t, "outage started", s.lostAt.IsZero())
+	s.change(wsnet.ListenerStateChange{State: wsnet.ListenerReconnecting, Attempt: 1, Wait: time.Second})
+	s.change(wsnet.ListenerStateChange{State: wsnet.ListenerConnected, Attempt: 1})
+	assert.True(t, "outage over", s.lostAt.IsZero())
+	assert.Equal(t, "connection changes", []bool{false, true}, connected)
+	assert.Equal(t, "state", wsnet.ListenerConnected, s.state)
+
+	s.change(wsnet.ListenerStateChange{State: wsnet.ListenerGaveUp, Err: errors.New("gave up")})
+	select {
+	case err := <-s.failed:
+		assert.ErrorContains(t, "reported", err, "gave up")
+	default:
+		t.Fatal("giving up wasn't reported")
+	}
+}
@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// defaultAgentServiceName is the name of the service "coder agent install"
+// registers.
+const defaultAgentServiceName = "coder-agent"
+
+// agentServiceNameRx matches the names of services, which name files.
+var agentServiceNameRx = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+func checkAgentServiceName(name string) error {
+	if !agentServiceNameRx.MatchString(name) {
+		return xerrors.Errorf("invalid service name %q: must be letters, digits, dashes and underscores", name)
+	}
+	return nil
+}
+
+// agentService is an agent run by the service manager of the OS.
+type agentService struct {
+	name string
+	// exe is the absolute path of the coder binary.
+	exe string
+	// envFile holds the environment of the agent, such as its token.
+	envFile string
+	// args are the extra flags of "coder agent start".
+	args []string
+	// user is the account the service runs as, or empty for the default
+	// account of the service manager.
+	user string
+	// home is the home directory of the agent, which service managers
+	// leave unset.
+	home string
+}
+
+// command returns the command line of the service.
+func (s agentService) command() []string {
+	return append([]string{s.exe, "agent", "start", "--env-file", s.envFile}, s.args...)
+}
+
+func agentInstallCmd() *cobra.Command {
+	var (
+		name     string
+		coderURL string
+		token    string
+		label    string
+		user     string
+	)
+	cmd := &cobra.Command{
+		Use:   "install [-- agent start flags...]",
+		Short: "run the agent as a service of this machine",
+		Long: "Register a service running \"coder agent start\", so that the agent starts with the machine and is restarted if it exits: " +
+			"a systemd unit on Linux, a launchd daemon on macOS and a Windows service on Windows.\n\n" +
+			"The access url and agent token are written to an environment file only readable by the administrators, " +
+			"rather than to the command line of the service, which any user can see. " +
+			"They default to the CODER_URL and CODER_AGENT_TOKEN env variables.\n\n" +
+			"On Linux and macOS, the service runs as --user, by default the user who ran sudo, so that it only reaches what they can, " +
+			"such as their docker socket. Pass --user root to run it as root.\n\n" +
+			"It must be run as root, or from an elevated prompt on Windows. Installing a service of the same name again replaces it.",
+		Example: `sudo coder agent install --coder-url https://my-coder.com --token xxxx-xxxx
+
+# pass flags to "coder agent start"
+sudo -E coder agent install -- --disk-path /workspace --status-addr 127.0.0.1:9400`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkAgentServiceName(name); err != nil {
+				return err
+			}
+			if coderURL == "" {
+				coderURL = os.Getenv("CODER_URL")
+			}
+			if token == "" {
+				token = os.Getenv("CODER_AGENT_TOKEN")
+			}
+			if coderURL == "" || token == "" {
+				return clog.Error("the service needs an access url and an agent token",
+					clog.BlankLine,
+					clog.Tipf("pass --coder-url and --token, or set the CODER_URL and CODER_AGENT_TOKEN env variables"),
+				)
+			}
+			if label == "" {
+				label = os.Getenv(agentLabelEnv)
+			}
+			if err := checkAgentLabel(label); err != nil {
+				return err
+			}
+			exe, err := executablePath()
+			if err != nil {
+				return err
+			}
+			account, err := agentServiceAccount(user)
+			if err != nil {
+				return err
+			}
+			envFile, err := agentServiceEnvPath(name)
+			if err != nil {
+				return err
+			}
+			env := map[string]string{
+				"CODER_URL":         coderURL,
+				"CODER_AGENT_TOKEN": token,
+			}
+			if label != "" {
+				env[agentLabelEnv] = label
+			}
+			if err := writeAgentEnvFile(envFile, env); err != nil {
+				return err
+			}
+			if err := grantAgentEnvFile(envFile, account); err != nil {
+				return err
+			}
+			s := agentService{name: name, exe: exe, envFile: envFile, args: args, user: account.name, home: account.home}
+			if err := installAgentService(s); err != nil {
+				return err
+			}
+			clog.LogSuccess(i18n.Sprintf("installed and started the %s service", name),
+				clog.BlankLine,
+				clog.Tipf("run \"coder agent status\" to check that it connected"),
+			)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&name, "name", defaultAgentServiceName, "name of the service")
+	cmd.Flags().StringVar(&coderURL, "coder-url", "", "coder access url (env CODER_URL)")
+	cmd.Flags().StringVar(&token, "token", "", "coder agent token (env CODER_AGENT_TOKEN)")
+	cmd.Flags().StringVar(&label, "label", "", "label of the agent (env "+agentLabelEnv+")")
+	cmd.Flags().StringVar(&user, "user", "", "account the service runs as, by default the user who ran sudo (not supported on Windows)")
+	return cmd
+}
+
+// agentServiceUser is the account an agent service runs as.
+type agentServiceUser struct {
+	// name is empty for the default account of the service manager.
+	name     string
+	home     string
+	uid, gid int
+}
+
+func agentUninstallCmd() *cobra.Command {
+	var name string
+	cmd := &cobra.Command{
+		Use:   "uninstall",
+		Short: "stop and remove the agent service installed by \"coder agent install\"",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkAgentServiceName(name); err != nil {
+				return err
+			}
+			if err := uninstallAgentService(name); err != nil {
+				return err
+			}
+			envFile, err := agentServiceEnvPath(name)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(envFile); err != nil && !os.IsNotExist(err) {
+				return xerrors.Errorf("remove environment file: %w", err)
+			}
+			clog.LogSuccess(i18n.Sprintf("removed the %s service", name))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&name, "name", defaultAgentServiceName, "name of the service")
+	return cmd
+}
+
+// writeAgentEnvFile writes the environment of the agent service as KEY=value
+// lines, readable by systemd and "coder agent start --env-file".
+func writeAgentEnvFile(path string, env map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return xerrors.Errorf("create environment file directory: %w", err)
+	}
+	if err := ioutil.WriteFile(path, formatAgentEnv(env), 0600); err != nil {
+		return xerrors.Errorf("write environment file: %w", err)
+	}
+	// WriteFile keeps the permissions of an existing file.
+	if err := restrictAgentEnvFile(path); err != nil {
+		return xerrors.Errorf("restrict environment file: %w", err)
+	}
+	return nil
+}
+
+func formatAgentEnv(env map[string]string) []byte {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(&b, "%s=%s\n", k, strconv.Quote(env[k]))
+	}
+	return b.Bytes()
+}
+
+// loadAgentEnvFile sets the env variables of the file written by
+// writeAgentEnvFile. Variables already set win.
+func loadAgentEnvFile(path string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return xerrors.Errorf("read environment file: %w", err)
+	}
+	env, err := parseAgentEnv(raw)
+	if err != nil {
+		return xerrors.Errorf("%s: %w", path, err)
+	}
+	for k, v := range env {
+		if _, ok := os.LookupEnv(k); ok {
+			continue
+		}
+		if err := os.Setenv(k, v); err != nil {
+			return xerrors.Errorf("set %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+func parseAgentEnv(raw []byte) (map[string]string, error) {
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, xerrors.Errorf("line %d: expected KEY=value", n)
+		}
+		v := kv[1]
+		if strings.HasPrefix(v, `"`) {
+			var err error
+			if v, err = strconv.Unquote(v); err != nil {
+				return nil, xerrors.Errorf("line %d: unquote value: %w", n, err)
+			}
+		}
+		env[kv[0]] = v
+	}
+	return env, scanner.Err()
+}
+
+// systemdQuote quotes a value of a systemd unit, escaping the % that starts
+// the specifiers systemd expands.
+func systemdQuote(v string) string {
+	return strings.ReplaceAll(strconv.Quote(v), "%", "%%")
+}
+
+// systemdUnit returns the systemd unit of the service.
+func systemdUnit(s agentService) string {
+	args := make([]string, 0, len(s.command()))
+	for _, arg := range s.command() {
+		args = append(args, systemdQuote(arg))
+	}
+	var account strings.Builder
+	if s.user != "" {
+		fmt.Fprintf(&account, "User=%s\n", s.user)
+	}
+	if s.home != "" {
+		fmt.Fprintf(&account, "Environment=%s\n", systemdQuote("HOME="+s.home))
+	}
+	return fmt.Sprintf(`[Unit]
+Description=Coder workspace agent
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+%sExecStart=%s
+Restart=always
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`, account.String(), strings.Join(args, " "))
+}
+
+// launchdLabel is the launchd label of the service.
+func launchdLabel(name string) string {
+	return "com.coder." + name
+}
+
+// launchdPlist returns the launchd property list of the service.
+func launchdPlist(s agentService) string {
+	escape := func(v string) string {
+		var b bytes.Buffer
+		_ = xml.EscapeText(&b, []byte(v))
+		return b.String()
+	}
+	var args strings.Builder
+	for _, arg := range s.command() {
+		_, _ = fmt.Fprintf(&args, "\t\t<string>%s</string>\n", escape(arg))
+	}
+	var account strings.Builder
+	if s.user != "" {
+		_, _ = fmt.Fprintf(&account, "\t<key>UserName</key>\n\t<string>%s</string>\n", escape(s.user))
+	}
+	if s.home != "" {
+		_, _ = fmt.Fprintf(&account, "\t<key>EnvironmentVariables</key>\n\t<dict>\n\t\t<key>HOME</key>\n\t\t<string>%s</string>\n\t</dict>\n", escape(s.home))
+	}
+	logPath := filepath.Join("/var/log", s.name+".log")
+	if s.user != "" {
+		// launchd opens the log as the user, who can't write to /var/log.
+		logPath = filepath.Join(s.home, "Library", "Logs", s.name+".log")
+	}
+	logPath = escape(logPath)
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+%s	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`, escape(launchdLabel(s.name)), args.String(), account.String(), logPath, logPath)
+}
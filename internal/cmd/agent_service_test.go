@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_agentEnvFile(t *testing.T) {
+	t.Parallel()
+	env := map[string]string{
+		"CODER_URL":         "https://my-coder.com",
+		"CODER_AGENT_TOKEN": `xxxx"yyyy`,
+	}
+	raw := formatAgentEnv(env)
+	assert.Equal(t, "format", "CODER_AGENT_TOKEN=\"xxxx\\\"yyyy\"\nCODER_URL=\"https://my-coder.com\"\n", string(raw))
+	got, err := parseAgentEnv(append([]byte("# comment\n\nPLAIN=value\n"), raw...))
+	assert.Success(t, "parse", err)
+	assert.Equal(t, "round trip", map[string]string{
+		"CODER_URL":         "https://my-coder.com",
+		"CODER_AGENT_TOKEN": `xxxx"yyyy`,
+		"PLAIN":             "value",
+	}, got)
+
+	_, err = parseAgentEnv([]byte("CODER_URL\n"))
+	assert.Error(t, "missing value", err)
+	_, err = parseAgentEnv([]byte("CODER_URL=\"unterminated\n"))
+	assert.Error(t, "bad quoting", err)
+}
+
+func Test_loadAgentEnvFile(t *testing.T) {
+	// Not parallel: it sets env variables.
+	path := filepath.Join(t.TempDir(), "agent.env")
+	err := ioutil.WriteFile(path, []byte("CODER_TEST_ENV_FILE_SET=\"from file\"\nCODER_TEST_ENV_FILE_UNSET=\"from file\"\n"), 0600)
+	assert.Success(t, "write env file", err)
+	assert.Success(t, "setenv", os.Setenv("CODER_TEST_ENV_FILE_SET", "from env"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv("CODER_TEST_ENV_FILE_SET")
+		_ = os.Unsetenv("CODER_TEST_ENV_FILE_UNSET")
+	})
+
+	assert.Success(t, "load", loadAgentEnvFile(path))
+	assert.Equal(t, "set variables win", "from env", os.Getenv("CODER_TEST_ENV_FILE_SET"))
+	assert.Equal(t, "unset variables are loaded", "from file", os.Getenv("CODER_TEST_ENV_FILE_UNSET"))
+}
+
+func Test_agentServiceFiles(t *testing.T) {
+	t.Parallel()
+	s := agentService{
+		name:    "coder-agent",
+		exe:     "/usr/local/bin/coder",
+		envFile: "/etc/coder/coder-agent.env",
+		args:    []string{"--disk-path", "/work space"},
+	}
+
+	unit := systemdUnit(s)
+	assert.True(t, "unit runs agent start with the env file",
+		strings.Contains(unit, `ExecStart="/usr/local/bin/coder" "agent" "start" "--env-file" "/etc/coder/coder-agent.env" "--disk-path" "/work space"`))
+	assert.True(t, "unit restarts the agent", strings.Contains(unit, "Restart=always"))
+	assert.True(t, "unit runs as root without a user", !strings.Contains(unit, "User="))
+
+	s.user, s.home = "coder", "/home/coder"
+	s.args = []string{"--disk-path", "/data/%h"}
+	unit = systemdUnit(s)
+	assert.True(t, "unit runs as the user", strings.Contains(unit, "\nUser=coder\n"))
+	assert.True(t, "unit sets HOME", strings.Contains(unit, "\nEnvironment=\"HOME=/home/coder\"\n"))
+	assert.True(t, "unit escapes specifiers", strings.Contains(unit, `"/data/%%h"`))
+	plist := launchdPlist(s)
+	assert.True(t, "plist runs as the user", strings.Contains(plist, "<key>UserName</key>\n\t<string>coder</string>"))
+	assert.True(t, "plist sets HOME", strings.Contains(plist, "<key>HOME</key>\n\t\t<string>/home/coder</string>"))
+	assert.True(t, "plist logs to the user's logs", strings.Contains(plist, "<string>/home/coder/Library/Logs/coder-agent.log</string>"))
+	s.user, s.home = "", ""
+	s.args = []string{"--disk-path", "/work space"}
+
+	plist = launchdPlist(s)
+	assert.True(t, "plist has the label", strings.Contains(plist, "<string>com.coder.coder-agent</string>"))
+	assert.True(t, "plist has the args", strings.Contains(plist, "<string>/work space</string>"))
+	assert.True(t, "plist keeps the token out", !strings.Contains(plist, "CODER_AGENT_TOKEN"))
+
+	assert.Success(t, "valid name", checkAgentServiceName("coder-agent_2"))
+	assert.Error(t, "path in name", checkAgentServiceName("../coder"))
+}
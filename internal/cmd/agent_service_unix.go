@@ -0,0 +1,170 @@
+// +build !windows
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// agentServiceEnvPath returns the path of the environment file of the
+// service.
+func agentServiceEnvPath(name string) (string, error) {
+	return filepath.Join("/etc/coder", name+".env"), nil
+}
+
+func restrictAgentEnvFile(path string) error {
+	return os.Chmod(path, 0600)
+}
+
+// agentServiceAccount returns the account named by --user, or else the user
+// who ran sudo. Without either, the service runs as root.
+func agentServiceAccount(name string) (agentServiceUser, error) {
+	if name == "" {
+		name = os.Getenv("SUDO_USER")
+	}
+	var (
+		u   *user.User
+		err error
+	)
+	if name == "" {
+		u, err = user.Current()
+	} else {
+		u, err = user.Lookup(name)
+	}
+	if err != nil {
+		return agentServiceUser{}, xerrors.Errorf("look up the service user: %w", err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return agentServiceUser{}, xerrors.Errorf("parse uid of %s: %w", u.Username, err)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return agentServiceUser{}, xerrors.Errorf("parse gid of %s: %w", u.Username, err)
+	}
+	return agentServiceUser{name: name, home: u.HomeDir, uid: uid, gid: gid}, nil
+}
+
+// grantAgentEnvFile lets the service user read the environment file, which
+// the agent reads itself.
+func grantAgentEnvFile(path string, account agentServiceUser) error {
+	if account.name == "" {
+		return nil
+	}
+	if err := os.Chmod(filepath.Dir(path), 0755); err != nil {
+		return xerrors.Errorf("open environment file directory: %w", err)
+	}
+	if err := os.Chown(path, account.uid, account.gid); err != nil {
+		return xerrors.Errorf("give %s the environment file: %w", account.name, err)
+	}
+	return nil
+}
+
+// agentServiceStopped is never closed outside of Windows, where the agent is
+// stopped by signals.
+func agentServiceStopped() <-chan struct{} {
+	return nil
+}
+
+func installAgentService(s agentService) error {
+	if err := checkServiceRoot(); err != nil {
+		return err
+	}
+	switch runtime.GOOS {
+	case "linux":
+		path := systemdUnitPath(s.name)
+		if err := ioutil.WriteFile(path, []byte(systemdUnit(s)), 0644); err != nil {
+			return xerrors.Errorf("write systemd unit: %w", err)
+		}
+		if err := runServiceCommand("systemctl", "daemon-reload"); err != nil {
+			return err
+		}
+		if err := runServiceCommand("systemctl", "enable", s.name+".service"); err != nil {
+			return err
+		}
+		// Restarting rather than starting applies a new token to a running
+		// service.
+		return runServiceCommand("systemctl", "restart", s.name+".service")
+	case "darwin":
+		path := launchdPlistPath(s.name)
+		// Unload the service being replaced, if any.
+		_ = exec.Command("launchctl", "unload", path).Run()
+		if err := ioutil.WriteFile(path, []byte(launchdPlist(s)), 0644); err != nil {
+			return xerrors.Errorf("write launchd plist: %w", err)
+		}
+		return runServiceCommand("launchctl", "load", "-w", path)
+	default:
+		return xerrors.Errorf("installing the agent as a service isn't supported on %s", runtime.GOOS)
+	}
+}
+
+func uninstallAgentService(name string) error {
+	if err := checkServiceRoot(); err != nil {
+		return err
+	}
+	switch runtime.GOOS {
+	case "linux":
+		path := systemdUnitPath(name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return xerrors.Errorf("no %s service is installed", name)
+		}
+		if err := runServiceCommand("systemctl", "disable", "--now", name+".service"); err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return xerrors.Errorf("remove systemd unit: %w", err)
+		}
+		return runServiceCommand("systemctl", "daemon-reload")
+	case "darwin":
+		path := launchdPlistPath(name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return xerrors.Errorf("no %s service is installed", name)
+		}
+		if err := runServiceCommand("launchctl", "unload", "-w", path); err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return xerrors.Errorf("remove launchd plist: %w", err)
+		}
+		return nil
+	default:
+		return xerrors.Errorf("installing the agent as a service isn't supported on %s", runtime.GOOS)
+	}
+}
+
+func systemdUnitPath(name string) string {
+	return filepath.Join("/etc/systemd/system", name+".service")
+}
+
+func launchdPlistPath(name string) string {
+	return filepath.Join("/Library/LaunchDaemons", launchdLabel(name)+".plist")
+}
+
+func checkServiceRoot() error {
+	if os.Geteuid() != 0 {
+		return clog.Error("managing services requires root",
+			clog.BlankLine,
+			clog.Tipf("run the command again with sudo"),
+		)
+	}
+	return nil
+}
+
+func runServiceCommand(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return xerrors.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// +build windows
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// agentServiceEnvPath returns the path of the environment file of the
+// service.
+func agentServiceEnvPath(name string) (string, error) {
+	dir := os.Getenv("ProgramData")
+	if dir == "" {
+		return "", xerrors.New("the ProgramData env variable isn't set")
+	}
+	return filepath.Join(dir, "coder", name+".env"), nil
+}
+
+// restrictAgentEnvFile lets only SYSTEM and the administrators access the
+// file, as the file mode is ignored on Windows.
+func restrictAgentEnvFile(path string) error {
+	sd, err := windows.SecurityDescriptorFromString("D:P(A;;FA;;;SY)(A;;FA;;;BA)")
+	if err != nil {
+		return xerrors.Errorf("parse security descriptor: %w", err)
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return xerrors.Errorf("get DACL: %w", err)
+	}
+	return windows.SetNamedSecurityInfo(path, windows.SE_FILE_OBJECT,
+		windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION, nil, nil, dacl, nil)
+}
+
+// agentServiceAccount only supports the default LocalSystem account of
+// Windows services, whose home directory is set.
+func agentServiceAccount(name string) (agentServiceUser, error) {
+	if name != "" {
+		return agentServiceUser{}, xerrors.New("--user isn't supported on Windows")
+	}
+	return agentServiceUser{}, nil
+}
+
+func grantAgentEnvFile(string, agentServiceUser) error {
+	return nil
+}
+
+// agentServiceStopped is closed when the service manager stops the agent, if
+// it's running as a service.
+func agentServiceStopped() <-chan struct{} {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return nil
+	}
+	stopped := make(chan struct{})
+	go func() {
+		_ = svc.Run("", agentServiceHandler{stopped: stopped})
+	}()
+	return stopped
+}
+
+type agentServiceHandler struct {
+	stopped chan struct{}
+}
+
+func (h agentServiceHandler) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for c := range r {
+		switch c.Cmd {
+		case svc.Interrogate:
+			changes <- c.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			changes <- svc.Status{State: svc.StopPending}
+			close(h.stopped)
+			// Give the agent time to close its connections before Run
+			// reports the service stopped.
+			time.Sleep(time.Second)
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+func installAgentService(s agentService) error {
+	m, err := connectServiceManager()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	// Replace the service being reinstalled, if any.
+	if err := removeService(m, s.name); err != nil && err != windows.ERROR_SERVICE_DOES_NOT_EXIST {
+		return err
+	}
+	cmd := s.command()
+	service, err := m.CreateService(s.name, cmd[0], mgr.Config{
+		DisplayName: "Coder agent (" + s.name + ")",
+		Description: "Coder workspace agent",
+		StartType:   mgr.StartAutomatic,
+	}, cmd[1:]...)
+	if err != nil {
+		return xerrors.Errorf("create service: %w", err)
+	}
+	defer service.Close()
+	err = service.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+	}, uint32((24 * time.Hour).Seconds()))
+	if err != nil {
+		return xerrors.Errorf("set recovery actions: %w", err)
+	}
+	if err := service.Start(); err != nil {
+		return xerrors.Errorf("start service: %w", err)
+	}
+	return nil
+}
+
+func uninstallAgentService(name string) error {
+	m, err := connectServiceManager()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	err = removeService(m, name)
+	if err == windows.ERROR_SERVICE_DOES_NOT_EXIST {
+		return xerrors.Errorf("no %s service is installed", name)
+	}
+	return err
+}
+
+func connectServiceManager() (*mgr.Mgr, error) {
+	m, err := mgr.Connect()
+	if err == windows.ERROR_ACCESS_DENIED {
+		return nil, clog.Error("managing services requires administrator rights",
+			clog.BlankLine,
+			clog.Tipf("run the command again from an elevated prompt"),
+		)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("connect to the service manager: %w", err)
+	}
+	return m, nil
+}
+
+// removeService stops and deletes the service. It returns
+// windows.ERROR_SERVICE_DOES_NOT_EXIST as is.
+func removeService(m *mgr.Mgr, name string) error {
+	service, err := m.OpenService(name)
+	if err == windows.ERROR_SERVICE_DOES_NOT_EXIST {
+		return err
+	}
+	if err != nil {
+		return xerrors.Errorf("open service: %w", err)
+	}
+	defer service.Close()
+	status, err := service.Control(svc.Stop)
+	if err != nil && err != windows.ERROR_SERVICE_NOT_ACTIVE {
+		return xerrors.Errorf("stop service: %w", err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); err == nil && status.State != svc.Stopped && time.Now().Before(deadline); {
+		time.Sleep(200 * time.Millisecond)
+		if status, err = service.Query(); err != nil {
+			return xerrors.Errorf("query service: %w", err)
+		}
+	}
+	if err := service.Delete(); err != nil {
+		return xerrors.Errorf("delete service: %w", err)
+	}
+	return nil
+}
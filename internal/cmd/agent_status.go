@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"cdr.dev/slog"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/version"
+	"cdr.dev/coder-cli/wsnet"
+)
+
+// agentStatusAddrEnv sets the address of the status endpoint of the agent
+// when no --status-addr flag is given.
+const agentStatusAddrEnv = "CODER_AGENT_STATUS_ADDR"
+
+// defaultAgentStatusAddr is where the agent serves its status. It's on
+// loopback, so that only the workspace can read it.
+const defaultAgentStatusAddr = "127.0.0.1:9327"
+
+// agentStatusAddr returns the address of the status endpoint, from the flag
+// or else the env variable. "off" disables the endpoint.
+func agentStatusAddr(flag string) string {
+	if flag != "" {
+		return flag
+	}
+	if env := os.Getenv(agentStatusAddrEnv); env != "" {
+		return env
+	}
+	return defaultAgentStatusAddr
+}
+
+// agentHealth is the status of a running agent, served as JSON at /healthz.
+type agentHealth struct {
+	Status    string    `json:"status"`
+	Label     string    `json:"label,omitempty"`
+	Version   string    `json:"version"`
+	StartedAt time.Time `json:"started_at"`
+	wsnet.ListenerStats
+}
+
+// Statuses of agentHealth.
+const (
+	agentHealthy      = "healthy"
+	agentDisconnected = "disconnected"
+)
+
+// agentStatusServer serves the health and metrics of an agent.
+type agentStatusServer struct {
+	label     string
+	startedAt time.Time
+	metrics   *wsnet.ListenerMetrics
+}
+
+func (s *agentStatusServer) health() agentHealth {
+	h := agentHealth{
+		Status:        agentHealthy,
+		Label:         s.label,
+		Version:       version.Version,
+		StartedAt:     s.startedAt,
+		ListenerStats: s.metrics.Stats(),
+	}
+	if !h.Connected {
+		h.Status = agentDisconnected
+	}
+	return h
+}
+
+func (s *agentStatusServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		h := s.health()
+		w.Header().Set("Content-Type", "application/json")
+		// Probes only look at the status code.
+		if h.Status != agentHealthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(h)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeAgentMetrics(w, s.health())
+	})
+	return mux
+}
+
+// serve serves the status on addr until ctx is done.
+func (s *agentStatusServer) serve(ctx context.Context, log slog.Logger, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return xerrors.Errorf("listen on %s: %w", addr, err)
+	}
+	srv := &http.Server{Handler: s.handler()}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() {
+		err := srv.Serve(ln)
+		if err != nil && ctx.Err() == nil {
+			log.Warn(ctx, "status endpoint stopped", slog.Error(err))
+		}
+	}()
+	return nil
+}
+
+// writeAgentMetrics writes the status in the Prometheus text format.
+func writeAgentMetrics(w io.Writer, h agentHealth) {
+	metric := func(name, typ, help string, samples ...string) {
+		_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, sample := range samples {
+			_, _ = fmt.Fprintf(w, "%s%s\n", name, sample)
+		}
+	}
+	value := func(v interface{}) string {
+		return fmt.Sprintf(" %v", v)
+	}
+	var connected int
+	if h.Connected {
+		connected = 1
+	}
+
+	metric("coder_agent_info", "gauge", "Version and label of the agent.",
+		fmt.Sprintf("{label=%q,version=%q} 1", h.Label, h.Version))
+	metric("coder_agent_start_time_seconds", "gauge", "Start time of the agent since the Unix epoch in seconds.",
+		value(h.StartedAt.Unix()))
+	metric("coder_agent_broker_connected", "gauge", "Whether the agent is connected to the broker.",
+		value(connected))
+	metric("coder_agent_broker_reconnects_total", "counter", "Reconnections to the broker after losing the connection.",
+		value(h.Reconnects))
+	metric("coder_agent_sessions_total", "counter", "Dialers that connected to the agent.",
+		value(h.Sessions))
+	metric("coder_agent_sessions_active", "gauge", "Dialers connected to the agent.",
+		value(h.ActiveSessions))
+
+	types := make([]string, 0, len(h.CandidateTypes))
+	for typ := range h.CandidateTypes {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	samples := make([]string, 0, len(types))
+	for _, typ := range types {
+		samples = append(samples, fmt.Sprintf("{candidate_type=%q} %d", typ, h.CandidateTypes[typ]))
+	}
+	metric("coder_agent_sessions_by_candidate_type", "gauge", "Dialers connected to the agent by the ICE candidate type of the agent, or broker when relayed.",
+		samples...)
+
+	metric("coder_agent_connections_active", "gauge", "Connections of dialers open through the agent.",
+		value(h.ActiveConnections))
+	metric("coder_agent_sent_bytes_total", "counter", "Bytes sent to dialers.",
+		value(h.BytesSent))
+	metric("coder_agent_received_bytes_total", "counter", "Bytes received from dialers.",
+		value(h.BytesReceived))
+}
+
+func agentStatusCmd() *cobra.Command {
+	var addr string
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "show the status of the agent running in this workspace",
+		Long: "Show whether the agent running in this workspace is connected to the broker, " +
+			"the dialers connected to it and the traffic it carried, as served by its status endpoint.\n\n" +
+			"The endpoint also serves Prometheus metrics at /metrics, and /healthz answers 503 while the agent is disconnected.",
+		Example: `coder agent status
+
+# read the status of an agent started with --status-addr
+coder agent status --status-addr 127.0.0.1:9400 --output json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(cmd.Context(), 5*time.Second)
+			defer cancel()
+			addr = agentStatusAddr(addr)
+			h, err := readAgentHealth(ctx, addr)
+			if err != nil {
+				return err
+			}
+			return writeOutput(cmd.OutOrStdout(), h, func() error {
+				return writeAgentHealth(cmd.OutOrStdout(), h, time.Now())
+			})
+		},
+	}
+	cmd.Flags().StringVar(&addr, "status-addr", "", "address of the status endpoint of the agent (env "+agentStatusAddrEnv+", default "+defaultAgentStatusAddr+")")
+	addOutputShorthand(cmd)
+	return cmd
+}
+
+// readAgentHealth reads the health of the agent serving its status on addr.
+func readAgentHealth(ctx context.Context, addr string) (agentHealth, error) {
+	var h agentHealth
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/healthz", nil)
+	if err != nil {
+		return h, xerrors.Errorf("create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return h, xerrors.Errorf("read status of the agent at %s, is it running? %w", addr, err)
+	}
+	defer resp.Body.Close()
+	// The status is served with 503 while disconnected.
+	if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+		return h, xerrors.Errorf("decode status (%s): %w", resp.Status, err)
+	}
+	return h, nil
+}
+
+func writeAgentHealth(w io.Writer, h agentHealth, now time.Time) error {
+	broker := "connected"
+	if !h.Connected {
+		broker = "disconnected"
+	}
+	if h.Reconnects > 0 {
+		broker += fmt.Sprintf(", reconnected %d times", h.Reconnects)
+	}
+	types := make([]string, 0, len(h.CandidateTypes))
+	for typ, n := range h.CandidateTypes {
+		types = append(types, fmt.Sprintf("%s %d", typ, n))
+	}
+	sort.Strings(types)
+	candidates := strings.Join(types, ", ")
+	if candidates == "" {
+		candidates = "-"
+	}
+	label := h.Label
+	if label == "" {
+		label = "-"
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	for _, row := range [][2]string{
+		{"Status", h.Status},
+		{"Label", label},
+		{"Version", h.Version},
+		{"Uptime", now.Sub(h.StartedAt).Round(time.Second).String()},
+		{"Broker", broker},
+		{"Sessions", fmt.Sprintf("%d active, %d total", h.ActiveSessions, h.Sessions)},
+		{"Candidates", candidates},
+		{"Connections", fmt.Sprintf("%d active", h.ActiveConnections)},
+		{"Traffic", fmt.Sprintf("%s sent, %s received", formatBytes(h.BytesSent), formatBytes(h.BytesReceived))},
+	} {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", row[0], row[1])
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/wsnet"
+)
+
+func Test_writeAgentMetrics(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	writeAgentMetrics(&buf, agentHealth{
+		Label:     "gpu",
+		Version:   "1.20.0",
+		StartedAt: time.Unix(1620000000, 0),
+		ListenerStats: wsnet.ListenerStats{
+			Connected:      true,
+			Reconnects:     2,
+			Sessions:       5,
+			ActiveSessions: 3,
+			BytesSent:      1024,
+			CandidateTypes: map[string]int{"srflx": 1, "host": 1, wsnet.RelayedCandidateType: 1},
+		},
+	})
+	out := buf.String()
+	for _, line := range []string{
+		`coder_agent_info{label="gpu",version="1.20.0"} 1`,
+		"# TYPE coder_agent_broker_reconnects_total counter",
+		"coder_agent_start_time_seconds 1620000000",
+		"coder_agent_broker_connected 1",
+		"coder_agent_broker_reconnects_total 2",
+		"coder_agent_sessions_active 3",
+		`coder_agent_sessions_by_candidate_type{candidate_type="broker"} 1`,
+		`coder_agent_sessions_by_candidate_type{candidate_type="host"} 1`,
+		"coder_agent_sent_bytes_total 1024",
+	} {
+		assert.True(t, line, strings.Contains(out, line+"\n"))
+	}
+}
+
+// Not parallel: the command sets the global output format.
+func Test_agentStatus(t *testing.T) {
+	t.Cleanup(func() {
+		outputFormat = humanOutput
+	})
+
+	status := &agentStatusServer{
+		label:     "gpu",
+		startedAt: time.Now().Add(-time.Hour),
+		metrics:   &wsnet.ListenerMetrics{},
+	}
+	srv := httptest.NewServer(status.handler())
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	resp, err := http.Get(srv.URL + "/healthz")
+	assert.Success(t, "get health", err)
+	resp.Body.Close()
+	assert.Equal(t, "unavailable while disconnected", http.StatusServiceUnavailable, resp.StatusCode)
+
+	res := execute(t, nil, "agent", "status", "--status-addr", addr)
+	res.success(t)
+	res.stdoutContains(t, "disconnected")
+	res.stdoutContains(t, "1h0m0s")
+
+	res = execute(t, nil, "agent", "status", "--status-addr", addr, "--output", "json")
+	res.success(t)
+	res.stdoutContains(t, `"label":"gpu"`)
+	res.stdoutContains(t, `"active_sessions":0`)
+
+	srv.Close()
+	res = execute(t, nil, "agent", "status", "--status-addr", addr)
+	res.error(t)
+	res.stderrContains(t, "is it running?")
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog"
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/wsnet"
+)
+
+func Test_agentListen(t *testing.T) {
+	agentRetryInterval = 10 * time.Millisecond
+
+	// Nothing listens on port 1, so every attempt fails fast.
+	u, err := url.Parse("http://127.0.0.1:1")
+	assert.Success(t, "parse url", err)
+
+	start := time.Now()
+	_, err = agentListen(context.Background(), slog.Make(), u, "token", "", 100*time.Millisecond, nil)
+	assert.ErrorContains(t, "fail after", err, "could not connect to broker within 100ms")
+	assert.True(t, "retried until deadline", time.Since(start) >= 50*time.Millisecond)
+
+	_, err = agentListen(context.Background(), slog.Make(), u, "token", "", 0, nil)
+	assert.Error(t, "single attempt", err)
+
+	// A broker that accepts connections but never answers.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Success(t, "listen", err)
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Held open until the listener is closed.
+			defer conn.Close()
+		}
+	}()
+	u, err = url.Parse("http://" + l.Addr().String())
+	assert.Success(t, "parse url", err)
+	start = time.Now()
+	_, err = agentListen(context.Background(), slog.Make(), u, "token", "", 200*time.Millisecond, nil)
+	assert.ErrorContains(t, "hung broker", err, "could not connect to broker within 200ms")
+	assert.True(t, "bounded by the deadline", time.Since(start) < 2*time.Second)
+}
+
+// Not parallel: it sets the home directory the lock and the log file are in.
+func Test_agentRunOrder(t *testing.T) {
+	home := t.TempDir()
+	prevHome := os.Getenv("HOME")
+	assert.Success(t, "setenv", os.Setenv("HOME", home))
+	t.Cleanup(func() { _ = os.Setenv("HOME", prevHome) })
+
+	opts := agentOptions{
+		coderURL:   "http://127.0.0.1:1",
+		token:      "token",
+		readyFD:    -1,
+		keyPath:    filepath.Join(home, "identity.key"),
+		statusAddr: "off",
+		diskLimits: diskThresholds{warn: 85, critical: 95},
+		backoff:    agentBackoff{initial: time.Second, max: time.Minute},
+	}
+	assert.Success(t, "resolve", opts.resolve(context.Background()))
+	lockPath, err := agentLockPath("")
+	assert.Success(t, "lock path", err)
+	logPath, _ := agentLogPath("", "")
+
+	var listened bool
+	run := func(opts agentOptions) error {
+		a := &agentRun{opts: opts, rt: newAgentRuntime()}
+		a.listen = func(context.Context, slog.Logger, *url.URL, string, string, time.Duration, *wsnet.ListenOptions) (io.Closer, error) {
+			listened = true
+			assert.Equal(t, "lock held", os.Getpid(), agentLockPID(lockPath))
+			_, err := os.Stat(logPath)
+			assert.Success(t, "log file opened", err)
+			return nil, xerrors.New("broker down")
+		}
+		defer a.close()
+		return a.start(context.Background())
+	}
+
+	// The log file isn't touched while another agent holds the lock.
+	lock, err := lockAgent(lockPath)
+	assert.Success(t, "lock", err)
+	err = run(opts)
+	assert.ErrorContains(t, "locked", err, "another agent is already running")
+	_, err = os.Stat(logPath)
+	assert.True(t, "no log file", os.IsNotExist(err))
+	assert.True(t, "not listening", !listened)
+	assert.Success(t, "unlock", lock.Close())
+
+	// A log file that can't be written stops the agent before it listens.
+	bad := opts
+	bad.log.file = filepath.Join(lockPath, "agent.log")
+	err = run(bad)
+	assert.Error(t, "bad log file", err)
+	assert.True(t, "not listening", !listened)
+
+	err = run(opts)
+	assert.ErrorContains(t, "listen", err, "broker down")
+	assert.True(t, "listened", listened)
+
+	// Closing releases the lock.
+	lock, err = lockAgent(lockPath)
+	assert.Success(t, "lock after close", err)
+	assert.Success(t, "unlock", lock.Close())
+}
+
+func Test_writeReadyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.ready")
+	err := writeReadyFile(path)
+	assert.Success(t, "write ready file", err)
+
+	b, err := ioutil.ReadFile(path)
+	assert.Success(t, "read ready file", err)
+	assert.True(t, "contains pid", strings.HasPrefix(string(b), "pid="))
+}
+
+func Test_parseAgentContainers(t *testing.T) {
+	t.Parallel()
+
+	containers, err := parseAgentContainers([]string{"tools=localhost:2222", " db=/run/db/sshd.sock"})
+	assert.Success(t, "parse", err)
+	assert.Equal(t, "containers", map[string]string{"tools": "localhost:2222", "db": "/run/db/sshd.sock"}, containers)
+
+	containers, err = parseAgentContainers(nil)
+	assert.Success(t, "parse none", err)
+	assert.True(t, "no containers", containers == nil)
+
+	for _, pairs := range [][]string{
+		{"tools"},
+		{"=localhost:2222"},
+		{"tools=2222"},
+		{"tools=run/sshd.sock"},
+		{"tools=localhost:2222", "tools=localhost:2223"},
+	} {
+		_, err := parseAgentContainers(pairs)
+		assert.Error(t, fmt.Sprint(pairs), err)
+	}
+}
+
+func Test_agentRuntime(t *testing.T) {
+	t.Parallel()
+
+	var (
+		buf strings.Builder
+		rt  = newAgentRuntime()
+		log = rt.logger(false, &buf)
+		off = false
+	)
+	log.Debug(context.Background(), "before")
+	assert.Error(t, "invalid level", rt.apply(log, wsnet.AgentConfig{LogLevel: "loud", Metrics: &off}))
+	assert.Equal(t, "metrics kept", int32(1), rt.metrics)
+
+	assert.Success(t, "apply", rt.apply(log, wsnet.AgentConfig{LogLevel: "WARN", Metrics: &off}))
+	assert.Equal(t, "metrics off", int32(0), rt.metrics)
+	log.Info(context.Background(), "after")
+	log.Warn(context.Background(), "warning")
+
+	out := buf.String()
+	assert.True(t, "logged before", strings.Contains(out, "before"))
+	assert.True(t, "dropped after", !strings.Contains(out, "after"))
+	assert.True(t, "logged warning", strings.Contains(out, "warning"))
+}
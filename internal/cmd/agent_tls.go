@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+const (
+	agentCABundleEnv = "CODER_AGENT_CA_BUNDLE"
+	// agentBakedCABundle is read when present so images built for a
+	// self-signed deployment work without extra configuration.
+	agentBakedCABundle = "/etc/coder/ca-bundle.pem"
+)
+
+// agentCABundlePath returns the CA bundle the agent should trust in addition
+// to the system roots: the --ca-bundle flag, then the CODER_AGENT_CA_BUNDLE
+// env variable, then the bundle baked into the image, if any.
+func agentCABundlePath(flag string) string {
+	if flag != "" {
+		return flag
+	}
+	if env := os.Getenv(agentCABundleEnv); env != "" {
+		return env
+	}
+	if _, err := os.Stat(agentBakedCABundle); err == nil {
+		return agentBakedCABundle
+	}
+	return ""
+}
+
+// agentHTTPClient returns the client used to dial the broker, trusting the
+// certificates of the PEM bundle at path on top of the system roots, and
+// connecting through proxy when it's set. Without either, it returns nil so
+// the default client is used.
+func agentHTTPClient(path string, proxy *url.URL) (*http.Client, error) {
+	if path == "" && proxy == nil {
+		return nil, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != nil {
+		// Credentials in the URL are sent as basic auth, to CONNECT too.
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if path == "" {
+		return &http.Client{Transport: transport}, nil
+	}
+
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("read CA bundle: %w", err)
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, xerrors.Errorf("CA bundle %s contains no PEM encoded certificates", path)
+	}
+
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	return &http.Client{Transport: transport}, nil
+}
+
+// explainCertError turns a certificate verification failure into an error
+// that says what was wrong with the certificate and how to fix it. Other
+// errors are returned unchanged.
+func explainCertError(err error, u *url.URL, caBundle string) error {
+	if err == nil {
+		return nil
+	}
+	trustHint := clog.Tipf("pass the deployment's CA with --ca-bundle, set %s, or bake it into the image at %s", agentCABundleEnv, agentBakedCABundle)
+	if caBundle != "" {
+		trustHint = clog.Tipf("check that %s contains the CA that issued the certificate, or its intermediates", caBundle)
+	}
+
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+	)
+	switch {
+	case xerrors.As(err, &unknownAuthority):
+		issuer := "unknown"
+		if unknownAuthority.Cert != nil {
+			issuer = unknownAuthority.Cert.Issuer.String()
+		}
+		return clog.Error(i18n.Sprintf("the certificate of %s is signed by an untrusted authority", u.Host),
+			fmt.Sprintf("issuer: %s", issuer),
+			clog.BlankLine,
+			trustHint,
+		)
+	case xerrors.As(err, &hostname):
+		names := "none"
+		if hostname.Certificate != nil && len(hostname.Certificate.DNSNames) > 0 {
+			names = strings.Join(hostname.Certificate.DNSNames, ", ")
+		}
+		return clog.Error(i18n.Sprintf("the certificate of %s is not valid for that name", u.Host),
+			fmt.Sprintf("certificate names: %s", names),
+			clog.BlankLine,
+			clog.Tipf("use the access URL configured for the deployment with --coder-url"),
+		)
+	case xerrors.As(err, &invalid):
+		detail := invalid.Error()
+		if invalid.Reason == x509.Expired && invalid.Cert != nil {
+			detail = fmt.Sprintf("valid from %s to %s, it is now %s",
+				invalid.Cert.NotBefore.Format(time.RFC3339), invalid.Cert.NotAfter.Format(time.RFC3339), time.Now().Format(time.RFC3339))
+		}
+		return clog.Error(i18n.Sprintf("the certificate of %s is invalid", u.Host),
+			detail,
+		)
+	}
+	return err
+}
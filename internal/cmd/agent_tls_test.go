@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cdr.dev/slog"
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/wsnet"
+)
+
+func Test_agentCABundle(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	assert.Success(t, "parse url", err)
+
+	// Without the bundle, the self-signed certificate is rejected with an explanation.
+	_, err = agentListen(context.Background(), slog.Make(), u, "token", "", 0, nil)
+	err = explainCertError(err, u, "")
+	assert.ErrorContains(t, "untrusted authority", err, "signed by an untrusted authority")
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	err = ioutil.WriteFile(bundle, pemBytes, 0600)
+	assert.Success(t, "write bundle", err)
+
+	hc, err := agentHTTPClient(bundle, nil)
+	assert.Success(t, "create http client", err)
+	_, err = agentListen(context.Background(), slog.Make(), u, "token", "", 0, &wsnet.ListenOptions{HTTPClient: hc})
+	assert.Error(t, "broker rejects the agent", err)
+	assert.True(t, "certificate trusted", !strings.Contains(err.Error(), "certificate"))
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	err = ioutil.WriteFile(empty, []byte("not a certificate"), 0600)
+	assert.Success(t, "write empty bundle", err)
+	_, err = agentHTTPClient(empty, nil)
+	assert.ErrorContains(t, "empty bundle", err, "no PEM encoded certificates")
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"os"
+	"os/user"
+	"strings"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// auditHeadersEnv overrides config.AuditHeaders.
+const auditHeadersEnv = "CODER_AUDIT_HEADERS"
+
+// Attributes that can be sent along with requests so that the deployment's
+// audit log can attribute them to the CLI.
+const (
+	auditUser    = "user"
+	auditHost    = "host"
+	auditCommand = "command"
+)
+
+// invokedCommand is the path of the command being run, such as
+// "coder workspaces ls". Its arguments are left out, as they may be secret.
+var invokedCommand string
+
+// auditClientInfo returns the client info to send with requests. Nothing is
+// sent unless the user opts in, by listing the attributes to send in
+// CODER_AUDIT_HEADERS or the audit_headers config file, such as
+// "user,host,command", or "all".
+func auditClientInfo() (coder.ClientInfo, error) {
+	setting := os.Getenv(auditHeadersEnv)
+	if setting == "" {
+		setting, _ = config.AuditHeaders.Read()
+	}
+	attrs, err := parseAuditAttributes(setting)
+	if err != nil {
+		return coder.ClientInfo{}, err
+	}
+
+	var info coder.ClientInfo
+	if attrs[auditUser] {
+		if u, err := user.Current(); err == nil {
+			info.User = u.Username
+		}
+	}
+	if attrs[auditHost] {
+		info.Host, _ = os.Hostname()
+	}
+	if attrs[auditCommand] {
+		info.Command = invokedCommand
+	}
+	return info, nil
+}
+
+// parseAuditAttributes parses a comma separated list of attributes.
+func parseAuditAttributes(setting string) (map[string]bool, error) {
+	attrs := make(map[string]bool)
+	for _, attr := range strings.Split(setting, ",") {
+		switch attr = strings.ToLower(strings.TrimSpace(attr)); attr {
+		case "", "none":
+		case "all":
+			attrs[auditUser], attrs[auditHost], attrs[auditCommand] = true, true, true
+		case auditUser, auditHost, auditCommand:
+			attrs[attr] = true
+		default:
+			return nil, clog.Error(i18n.Sprintf("invalid audit header attribute %q", attr),
+				clog.BlankLine,
+				clog.Hintf(`%s takes a comma separated list of "user", "host" and "command", or "all"`, auditHeadersEnv),
+			)
+		}
+	}
+	return attrs, nil
+}
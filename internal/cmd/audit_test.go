@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_parseAuditAttributes(t *testing.T) {
+	t.Parallel()
+
+	attrs, err := parseAuditAttributes("")
+	assert.Success(t, "empty", err)
+	assert.Equal(t, "nothing sent by default", 0, len(attrs))
+
+	attrs, err = parseAuditAttributes(" User, command\n")
+	assert.Success(t, "list", err)
+	assert.Equal(t, "listed attributes", map[string]bool{auditUser: true, auditCommand: true}, attrs)
+
+	attrs, err = parseAuditAttributes("all")
+	assert.Success(t, "all", err)
+	assert.Equal(t, "every attribute", 3, len(attrs))
+
+	_, err = parseAuditAttributes("user,args")
+	assert.Error(t, "unknown attribute", err)
+}
@@ -6,11 +6,15 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/xerrors"
 
 	"cdr.dev/coder-cli/coder-sdk"
 	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/proxy"
 	"cdr.dev/coder-cli/internal/version"
 	"cdr.dev/coder-cli/pkg/clog"
 )
@@ -23,23 +27,148 @@ var errNeedLogin = clog.Fatal(
 const tokenEnv = "CODER_TOKEN"
 const urlEnv = "CODER_URL"
 
-func newClient(ctx context.Context, checkVersion bool) (coder.Client, error) {
-	var (
-		err          error
-		sessionToken = os.Getenv(tokenEnv)
-		rawURL       = os.Getenv(urlEnv)
-	)
+// Proxy settings in addition to the standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+const (
+	proxyPACEnv  = "CODER_PROXY_PAC"
+	proxyAuthEnv = "CODER_PROXY_AUTH"
+	// proxyUserEnv holds proxy credentials as "user:password".
+	proxyUserEnv = "CODER_PROXY_USER"
+)
+
+// httpCacheEnv configures the cache of API responses: "off" disables it,
+// and a duration such as "30s" sets how long responses are reused without
+// revalidating them with the deployment.
+const httpCacheEnv = "CODER_HTTP_CACHE"
+
+// httpCacheFreshFor is how long cached API responses are reused without
+// revalidating them by default, enough for the lookups of a command and of
+// shell completions typed in quick succession. Only the resources that rarely
+// change are cached, so polling commands always see the current state.
+const httpCacheFreshFor = 5 * time.Second
+
+// responseCache returns the cache of API responses shared by the runs of
+// the CLI, with how long its responses are reused without revalidation.
+func responseCache() (coder.ResponseCache, time.Duration, error) {
+	freshFor := httpCacheFreshFor
+	switch v := os.Getenv(httpCacheEnv); v {
+	case "":
+	case "off":
+		return nil, 0, nil
+	default:
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, 0, xerrors.Errorf("%s must be \"off\" or a duration such as 30s, not %q", httpCacheEnv, v)
+		}
+		freshFor = d
+	}
+	dir, err := config.Dir("http-cache")
+	if err != nil {
+		// Still save the repeated requests of this run.
+		return coder.NewMemoryCache(), freshFor, nil
+	}
+	return coder.NewDiskCache(dir), freshFor, nil
+}
+
+// purgeResponseCache removes the cached API responses, which hold the data
+// of the logged in user.
+func purgeResponseCache() {
+	if dir, err := config.Dir("http-cache"); err == nil {
+		coder.NewDiskCache(dir).Purge()
+	}
+}
+
+var (
+	httpClientOnce sync.Once
+	httpClient     *http.Client
+	errHTTPClient  error
+)
+
+// newHTTPClient returns the http.Client used for all connections to Coder,
+// configured with the proxy settings from the environment or the config directory.
+func newHTTPClient(ctx context.Context) (*http.Client, error) {
+	httpClientOnce.Do(func() {
+		var opts proxy.Options
+		opts.PAC = os.Getenv(proxyPACEnv)
+		if opts.PAC == "" {
+			opts.PAC, _ = config.ProxyPAC.Read()
+		}
+		opts.PAC = strings.TrimSpace(opts.PAC)
 
-	if sessionToken == "" || rawURL == "" {
-		sessionToken, err = config.Session.Read()
-		if err != nil {
-			return nil, errNeedLogin
+		auth := os.Getenv(proxyAuthEnv)
+		if auth == "" {
+			auth, _ = config.ProxyAuth.Read()
 		}
+		opts.Auth, errHTTPClient = proxy.ParseAuthScheme(auth)
+		if errHTTPClient != nil {
+			return
+		}
+
+		if user := os.Getenv(proxyUserEnv); user != "" {
+			parts := strings.SplitN(user, ":", 2)
+			opts.User = url.User(parts[0])
+			if len(parts) == 2 {
+				opts.User = url.UserPassword(parts[0], parts[1])
+			}
+		}
+
+		opts.Warn = func(err error) {
+			clog.LogWarn("failed to evaluate the proxy auto-config script, connecting directly",
+				clog.Causef(err.Error()),
+			)
+		}
+
+		httpClient, errHTTPClient = proxy.NewHTTPClient(ctx, opts)
+		if errHTTPClient != nil {
+			errHTTPClient = xerrors.Errorf("configure proxy: %w", errHTTPClient)
+		}
+	})
+	return httpClient, errHTTPClient
+}
+
+// validateProxyAuth checks that the proxy-auth setting is a supported scheme.
+func validateProxyAuth(_ context.Context, value string) error {
+	_, err := proxy.ParseAuthScheme(value)
+	return err
+}
+
+// sessionCredentials returns the session token and Coder URL, preferring
+// the environment, then the credential helper, over the config directory.
+func sessionCredentials(ctx context.Context) (sessionToken, rawURL string, err error) {
+	sessionToken = os.Getenv(tokenEnv)
+	rawURL = os.Getenv(urlEnv)
+	if sessionToken != "" && rawURL != "" {
+		return sessionToken, rawURL, nil
+	}
 
-		rawURL, err = config.URL.Read()
-		if err != nil {
-			return nil, errNeedLogin
+	if helper := credentialHelper(); helper != "" {
+		if rawURL == "" {
+			rawURL, _ = config.URL.Read()
 		}
+		return helperSessionCredentials(ctx, helper, rawURL)
+	}
+
+	sessionToken, err = config.Session.Read()
+	if err != nil {
+		return "", "", errNeedLogin
+	}
+	rawURL, err = config.URL.Read()
+	if err != nil {
+		return "", "", errNeedLogin
+	}
+	return sessionToken, rawURL, nil
+}
+
+// clientOverride, when set, is returned by newClient instead of a client for
+// the configured deployment. gen-docs uses it to run examples against a fake.
+var clientOverride coder.Client
+
+func newClient(ctx context.Context, checkVersion bool) (coder.Client, error) {
+	if clientOverride != nil {
+		return clientOverride, nil
+	}
+	sessionToken, rawURL, err := sessionCredentials(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	u, err := url.Parse(rawURL)
@@ -47,40 +176,85 @@ func newClient(ctx context.Context, checkVersion bool) (coder.Client, error) {
 		return nil, xerrors.Errorf("url malformed: %w try running \"coder login\" with a valid URL", err)
 	}
 
+	hc, err := newHTTPClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	clientInfo, err := auditClientInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	cache, cacheFreshFor, err := responseCache()
+	if err != nil {
+		return nil, err
+	}
+
+	sdkLog := subsystemLogger("sdk", verbosityDebug)
 	c, err := coder.NewClient(coder.ClientOptions{
-		BaseURL: u,
-		Token:   sessionToken,
+		BaseURL:             u,
+		HTTPClient:          hc,
+		Token:               sessionToken,
+		Logger:              &sdkLog,
+		Impersonate:         impersonation.user,
+		ImpersonationReason: impersonation.reason,
+		ClientInfo:          clientInfo,
+		OnDeprecation:       warnDeprecation,
+		Cache:               cache,
+		CacheFreshFor:       cacheFreshFor,
 	})
 	if err != nil {
 		return nil, xerrors.Errorf("failed to create new coder.Client: %w", err)
 	}
-
-	if checkVersion {
-		var apiVersion string
-		apiVersion, err = c.APIVersion(ctx)
-		if apiVersion != "" && !version.VersionsMatch(apiVersion) {
-			logVersionMismatchError(apiVersion)
+	if impersonation.user != "" {
+		if err := verifyImpersonation(ctx, c); err != nil {
+			return nil, err
 		}
+		logImpersonation()
 	}
 
+	if !checkVersion {
+		return c, nil
+	}
+	apiVersion, err := checkSession(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if versionCheckEnabled() {
+		checkCLIVersion(ctx, c, u.String(), apiVersion, version.Version, time.Now())
+	}
+	return c, nil
+}
+
+// checkSession returns the API version of the deployment, which also checks
+// the session, so it's requested even when the comparison of the versions is
+// cached or disabled.
+func checkSession(ctx context.Context, c coder.Client) (string, error) {
+	apiVersion, err := c.APIVersion(ctx)
 	if err != nil {
 		var he *coder.HTTPError
 		if xerrors.As(err, &he) {
 			if he.StatusCode() == http.StatusUnauthorized {
-				return nil, xerrors.Errorf("not authenticated: try running \"coder login`\"")
+				return "", xerrors.Errorf("not authenticated: try running \"coder login`\"")
 			}
 		}
-		return nil, err
+		return "", err
 	}
-
-	return c, nil
+	return apiVersion, nil
 }
 
-func logVersionMismatchError(apiVersion string) {
-	clog.LogWarn(
-		"version mismatch detected",
+func logVersionMismatchError(apiVersion, targetVersion string) {
+	lines := []string{
 		fmt.Sprintf("Coder CLI version: %s", version.Version),
-		fmt.Sprintf("Coder API version: %s", apiVersion), clog.BlankLine,
-		clog.Tipf("download the appropriate version here: https://github.com/cdr/coder-cli/releases"),
+		fmt.Sprintf("Coder API version: %s", apiVersion),
+	}
+	if targetVersion != apiVersion {
+		lines = append(lines, fmt.Sprintf("CLI version rolled out to you: %s", targetVersion))
+	}
+	lines = append(lines, clog.BlankLine,
+		clog.Tipf(`run "coder update" to update to version %s`, targetVersion),
+		clog.Tipf("or download the appropriate version here: https://github.com/cdr/coder-cli/releases"),
 	)
+	clog.LogWarn("version mismatch detected", lines...)
 }
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/version"
+	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+const (
+	// bugReportJournals bounds how many of the most recent sync journals
+	// are bundled.
+	bugReportJournals = 5
+	// bugReportJournalTail bounds how much of the end of each sync journal
+	// is bundled.
+	bugReportJournalTail = 1 << 20
+)
+
+func bugReportCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "bug-report",
+		Short: "Bundle diagnostics, crash reports and recent logs for a bug report",
+		Long: "Write a gzipped tarball with what helps investigating a bug, to attach to an issue at https://github.com/cdr/coder-cli/issues:\n\n" +
+			"- diagnostics: the version and platform of coder, and whether the deployment can be reached\n" +
+			"- the crash reports written when coder crashed, with secrets passed as arguments removed\n" +
+			"- the end of the most recent sync journals\n\n" +
+			"Config files are only described by a digest of their content, never included. " +
+			"Review the bundle before sharing it, as logs might mention file names and workspace names.",
+		Args: xcobra.ExactArgs(0),
+		Example: `coder bug-report
+coder bug-report --output /tmp/report.tar.gz`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output == "" {
+				output = fmt.Sprintf("coder-bug-report-%s.tar.gz", time.Now().Format("20060102T150405"))
+			}
+			f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return xerrors.Errorf("create bug report: %w", err)
+			}
+			if err := writeBugReport(f, bugReportDiagnostics(cmd)); err != nil {
+				_ = f.Close()
+				_ = os.Remove(output)
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return xerrors.Errorf("write bug report: %w", err)
+			}
+			clog.LogSuccess(i18n.Sprintf("wrote bug report to %s", output),
+				clog.BlankLine,
+				clog.Tipf("review it with \"tar -tvzf %s\", then attach it to an issue at https://github.com/cdr/coder-cli/issues", output),
+			)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "path of the tarball to write, coder-bug-report-<time>.tar.gz in the current directory by default")
+	_ = cmd.MarkFlagFilename("output", "gz")
+	return cmd
+}
+
+// bugReportDiagnostics describes the install of coder and its deployment.
+func bugReportDiagnostics(cmd *cobra.Command) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "coder: %s %s %s/%s\n", version.Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if exe, err := executablePath(); err == nil {
+		if pm := detectPackageManager(exe, os.Getenv); pm != nil {
+			fmt.Fprintf(&b, "installed with: %s\n", pm.name)
+		}
+	}
+	fmt.Fprintln(&b, "config:")
+	for _, f := range crashConfigFiles {
+		fmt.Fprintf(&b, "  %s: %s\n", f, configDigest(f))
+	}
+
+	ctx := cmd.Context()
+	client, err := newClient(ctx, false)
+	if err != nil {
+		fmt.Fprintf(&b, "deployment: %v\n", err)
+		return b.String()
+	}
+	apiVersion, err := client.APIVersion(ctx)
+	if err != nil {
+		fmt.Fprintf(&b, "deployment: get version: %v\n", err)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "deployment: version %s, matching coder: %t\n", apiVersion, version.VersionsMatch(apiVersion))
+	return b.String()
+}
+
+// writeBugReport writes the bug report tarball to w.
+func writeBugReport(w io.Writer, diagnostics string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	add := func(name string, content []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), ModTime: now, Typeflag: tar.TypeReg}); err != nil {
+			return xerrors.Errorf("write bug report: %w", err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			return xerrors.Errorf("write bug report: %w", err)
+		}
+		return nil
+	}
+
+	if err := add("diagnostics.txt", []byte(diagnostics)); err != nil {
+		return err
+	}
+	reports, err := crashReports()
+	if err != nil {
+		return xerrors.Errorf("list crash reports: %w", err)
+	}
+	for _, path := range reports {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return xerrors.Errorf("read crash report: %w", err)
+		}
+		if err := add("crash-reports/"+filepath.Base(path), content); err != nil {
+			return err
+		}
+	}
+	journals, err := recentSyncJournals(bugReportJournals)
+	if err != nil {
+		return err
+	}
+	for _, path := range journals {
+		content, err := tailFile(path, bugReportJournalTail)
+		if err != nil {
+			return xerrors.Errorf("read sync journal: %w", err)
+		}
+		if err := add("sync-journals/"+filepath.Base(path), content); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return xerrors.Errorf("write bug report: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return xerrors.Errorf("write bug report: %w", err)
+	}
+	return nil
+}
+
+// recentSyncJournals returns the paths of the n most recently modified sync
+// journals.
+func recentSyncJournals(n int) ([]string, error) {
+	dir, err := config.Dir("sync-journals")
+	if err != nil {
+		return nil, xerrors.Errorf("create journal directory: %w", err)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("list sync journals: %w", err)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().After(infos[j].ModTime()) })
+	var paths []string
+	for _, info := range infos {
+		if len(paths) == n {
+			break
+		}
+		if info.Mode().IsRegular() && strings.HasSuffix(info.Name(), ".jsonl") {
+			paths = append(paths, filepath.Join(dir, info.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// tailFile returns the last n bytes of the file, from the start of a line.
+func tailFile(path string, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() <= n {
+		return ioutil.ReadAll(f)
+	}
+	if _, err := f.Seek(-n, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexByte(content, '\n'); i >= 0 {
+		content = content[i+1:]
+	}
+	return content, nil
+}
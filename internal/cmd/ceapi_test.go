@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_findWorkspace(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := codertest.New()
+	fake.AddWorkspace(coder.Workspace{Name: "backend"})
+	other := fake.AddUser(coder.User{Email: "jane@coder.com"}, fake.DefaultOrgID())
+	fake.AddWorkspace(coder.Workspace{Name: "frontend", UserID: other})
+
+	w, err := findWorkspace(ctx, fake, "backend", coder.Me)
+	assert.Success(t, "find own workspace", err)
+	assert.Equal(t, "name matches", "backend", w.Name)
+
+	_, err = findWorkspace(ctx, fake, "frontend", coder.Me)
+	assert.Error(t, "other user's workspace", err)
+
+	w, err = findWorkspace(ctx, fake, "frontend", "jane@coder.com")
+	assert.Success(t, "find workspace by email", err)
+	assert.Equal(t, "owner matches", other, w.UserID)
+}
+
+func Test_findImg(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := codertest.New()
+	fake.AddImage(coder.Image{Repository: "codercom/ubuntu-dev"}, "latest")
+
+	img, err := findImg(ctx, fake, findImgConf{email: coder.Me, imgName: "codercom/ubuntu-dev"})
+	assert.Success(t, "exact match", err)
+	assert.Equal(t, "repository matches", "codercom/ubuntu-dev", img.Repository)
+
+	_, err = findImg(ctx, fake, findImgConf{email: coder.Me, imgName: "ubuntu"})
+	assert.Error(t, "partial match suggests", err)
+}
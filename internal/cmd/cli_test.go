@@ -167,3 +167,15 @@ func execute(t *testing.T, in io.Reader, args ...string) result {
 		exitErr:   err,
 	}
 }
+
+// useFakeClient makes the commands the test executes use fake instead of a
+// client for the deployment, and resets the client and the output format when
+// the test ends. Since both are package state, tests using it can't be parallel.
+func useFakeClient(t *testing.T, fake coder.Client) {
+	t.Helper()
+	clientOverride = fake
+	t.Cleanup(func() {
+		clientOverride = nil
+		outputFormat = humanOutput
+	})
+}
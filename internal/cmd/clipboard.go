@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"context"
+
+	"cdr.dev/coder-cli/internal/clipboard"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// writeClipboard writes to the clipboard. It's a variable so it can be
+// replaced in tests.
+var writeClipboard = clipboard.Write
+
+// copyToClipboard places text on the clipboard and reports the outcome.
+// It returns false if the clipboard could not be written, so callers can fall
+// back to printing the value.
+func copyToClipboard(ctx context.Context, text, what string) bool {
+	if err := writeClipboard(ctx, text); err != nil {
+		clog.LogWarn(i18n.Sprintf("failed to copy %s to clipboard", what),
+			clog.Causef(err.Error()),
+		)
+		return false
+	}
+	clog.LogSuccess(i18n.Sprintf("copied %s to clipboard", what))
+	return true
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/internal/clipboard"
+)
+
+// Not parallel: writeClipboard is replaced for the package.
+func Test_copyToClipboard(t *testing.T) {
+	prev := writeClipboard
+	t.Cleanup(func() { writeClipboard = prev })
+
+	var copied string
+	writeClipboard = func(ctx context.Context, text string) error {
+		copied = text
+		return nil
+	}
+	assert.True(t, "copied", copyToClipboard(context.Background(), "token", "token"))
+	assert.Equal(t, "text", "token", copied)
+
+	writeClipboard = func(context.Context, string) error { return clipboard.ErrUnavailable }
+	assert.False(t, "no clipboard lets the caller print the value", copyToClipboard(context.Background(), "token", "token"))
+}
@@ -2,20 +2,30 @@
 package cmd
 
 import (
+	"os"
+	"runtime"
+
 	"github.com/spf13/cobra"
-	"github.com/spf13/cobra/doc"
+	"github.com/spf13/pflag"
+	"golang.org/x/text/language"
 
-	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
 )
 
-// verbose is a global flag for specifying that a command should give verbose output.
-var verbose bool = false
+// colorFlag is the value of the global --color flag.
+var colorFlag string
 
 // Make constructs the "coder" root command.
 func Make() *cobra.Command {
 	app := &cobra.Command{
-		Use:               "coder",
-		Short:             "coder provides a CLI for working with an existing Coder installation",
+		Use:   "coder",
+		Short: "coder provides a CLI for working with an existing Coder installation",
+		Long: "coder provides a CLI for working with an existing Coder installation.\n\n" +
+			"Messages are shown in the language of the locale, set with LC_ALL, LC_MESSAGES or LANG, " +
+			"or in the language set with the " + i18n.LangEnv + " env variable, where translations are available, and in English otherwise.\n\n" +
+			"When logged in, the examples of --help use the access URL of the deployment and your default workspace, so that they can be run as they are. " +
+			"Run \"coder config set help-examples lookup\" to also look up one of your workspaces when there's no default one, or off to show examples as written.",
 		SilenceErrors:     true,
 		SilenceUsage:      true,
 		DisableAutoGenTag: true,
@@ -23,45 +33,105 @@ func Make() *cobra.Command {
 
 	app.AddCommand(
 		agentCmd(),
+		bugReportCmd(),
+		changelogCmd(),
 		completionCmd(),
+		configCmd(),
 		configSSHCmd(),
+		cpCmd(),
+		downCmd(),
 		envCmd(), // DEPRECATED.
+		envExportsCmd(),
+		execCmd(),
 		genDocsCmd(app),
+		gotoCmd(),
 		imgsCmd(),
 		loginCmd(),
 		logoutCmd(),
+		logsCmd(),
+		portForwardCmd(),
 		providersCmd(),
 		resourceCmd(),
 		satellitesCmd(),
 		sshCmd(),
+		sshProxyCmd(),
 		syncCmd(),
 		tagsCmd(),
 		tokensCmd(),
+		trustCmd(),
 		tunnelCmd(),
+		upCmd(),
+		updateCmd(),
 		urlCmd(),
 		usersCmd(),
+		watchdogCmd(),
 		workspacesCmd(),
+		wsnetCmd(),
 	)
-	app.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "show verbose output")
+	registerFlagCompletions(app)
+	app.PersistentFlags().CountVarP(&verbosity, "verbose", "v", "increase output verbosity (-v, -vv, -vvv)")
+	app.PersistentFlags().StringVar(&logLevelFlag, "log-level", "", "comma separated levels of subsystems, overriding --verbose for them, such as wsnet=debug,sync=info (env "+logLevelEnv+")")
+	app.PersistentFlags().StringVar(&colorFlag, "color", string(clog.ColorAuto), "when to color output: auto, always or never (auto honors NO_COLOR and CLICOLOR_FORCE)")
+	app.PersistentFlags().BoolVar(&noVersionCheck, "no-version-check", false, "don't check whether a newer version of coder-cli is available (env "+noVersionCheckEnv+")")
+	app.PersistentFlags().StringSliceVar(&tableColumns, "columns", nil, "comma separated columns of tables to show, in order, such as name,status")
+	app.PersistentFlags().BoolVar(&saveColumns, "save-columns", false, "remember --columns as the columns of this command, or forget them with an empty --columns")
+	app.PersistentFlags().DurationVar(&progressInterval, "progress-interval", defaultProgressInterval, "how often long operations log their progress when the output isn't a terminal, 0 to never (env "+progressIntervalEnv+")")
+	completeFlagChoices(app, "color", string(clog.ColorAuto), string(clog.ColorAlways), string(clog.ColorNever))
+	clog.SetLocalizer(i18n.Sprintf)
+	if i18n.SetLanguage(i18n.LanguageFromEnv(os.Getenv)) != language.English {
+		localizeHelp(app)
+	}
+	personalizeHelp(app)
+	app.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		mode, err := clog.ParseColorMode(colorFlag)
+		if err != nil {
+			return err
+		}
+		clog.SetColorMode(mode)
+		if err := resolveProgressInterval(cmd); err != nil {
+			return err
+		}
+		if err := resolveLogLevels(cmd); err != nil {
+			return err
+		}
+		if err := resolveTableColumns(cmd); err != nil {
+			return err
+		}
+		invokedCommand = cmd.CommandPath()
+		if err := checkRequiredRoles(cmd); err != nil {
+			return err
+		}
+		if runtime.GOOS == "windows" {
+			if exe, err := executablePath(); err == nil {
+				if err := applyStagedUpdate(exe); err != nil {
+					clog.LogWarn("failed to apply the staged update", clog.Causef("%v", err))
+				}
+			}
+		}
+		return nil
+	}
+	app.PersistentPostRunE = func(cmd *cobra.Command, args []string) error {
+		return saveTableColumns(cmd)
+	}
 	return app
 }
 
-func genDocsCmd(rootCmd *cobra.Command) *cobra.Command {
-	return &cobra.Command{
-		Use:     "gen-docs [dir_path]",
-		Short:   "Generate a markdown documentation tree for the root command.",
-		Args:    xcobra.ExactArgs(1),
-		Example: "coder gen-docs ./docs",
-		Hidden:  true,
-		RunE: func(_ *cobra.Command, args []string) error {
-			return doc.GenMarkdownTree(rootCmd, args[0])
-		},
+// localizeHelp translates the help of the command and its subcommands to the
+// selected language.
+func localizeHelp(cmd *cobra.Command) {
+	cmd.Short = i18n.Text(cmd.Short)
+	cmd.Long = i18n.Text(cmd.Long)
+	// The local flags include the persistent flags of the command.
+	cmd.LocalFlags().VisitAll(func(f *pflag.Flag) { f.Usage = i18n.Text(f.Usage) })
+	for _, c := range cmd.Commands() {
+		localizeHelp(c)
 	}
 }
 
 // reference: https://github.com/spf13/cobra/blob/master/shell_completions.md
 func completionCmd() *cobra.Command {
-	return &cobra.Command{
+	var noDesc bool
+	cmd := &cobra.Command{
 		Use:   "completion [bash|zsh|fish|powershell]",
 		Short: "Generate completion script",
 		Example: `coder completion fish > ~/.config/fish/completions/coder.fish
@@ -102,20 +172,30 @@ $ coder completion fish | source
 To load completions for each session, execute once:
 $ coder completion fish > ~/.config/fish/completions/coder.fish
 `,
-		DisableFlagsInUseLine: true,
-		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
-		Args:                  cobra.ExactValidArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+		Args:      cobra.ExactValidArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
+			root, w := cmd.Root(), cmd.OutOrStdout()
 			switch args[0] {
 			case "bash":
-				_ = cmd.Root().GenBashCompletion(cmd.OutOrStdout()) // Best effort.
+				_ = root.GenBashCompletionV2(w, !noDesc) // Best effort.
 			case "zsh":
-				_ = cmd.Root().GenZshCompletion(cmd.OutOrStdout()) // Best effort.
+				if noDesc {
+					_ = root.GenZshCompletionNoDesc(w) // Best effort.
+				} else {
+					_ = root.GenZshCompletion(w) // Best effort.
+				}
 			case "fish":
-				_ = cmd.Root().GenFishCompletion(cmd.OutOrStdout(), true) // Best effort.
+				_ = root.GenFishCompletion(w, !noDesc) // Best effort.
 			case "powershell":
-				_ = cmd.Root().GenPowerShellCompletion(cmd.OutOrStdout()) // Best effort.
+				if noDesc {
+					_ = root.GenPowerShellCompletion(w) // Best effort.
+				} else {
+					_ = root.GenPowerShellCompletionWithDesc(w) // Best effort.
+				}
 			}
 		},
 	}
+	cmd.Flags().BoolVar(&noDesc, "no-descriptions", false, "complete commands and flags without their descriptions")
+	return cmd
 }
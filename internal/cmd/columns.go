@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/pkg/clog"
+	"cdr.dev/coder-cli/pkg/tablewriter"
+)
+
+// tableColumns and saveColumns are the values of the global --columns and
+// --save-columns flags.
+var (
+	tableColumns []string
+	saveColumns  bool
+)
+
+// selectedColumns are the columns of the tables the command writes, as
+// resolveTableColumns selected them, or nil for all of them.
+var selectedColumns []string
+
+// resolveTableColumns selects the columns of the tables the command writes:
+// those given with --columns, or else those saved for the command.
+func resolveTableColumns(cmd *cobra.Command) error {
+	if cmd.Flags().Changed("columns") {
+		selectedColumns = nonEmptyColumns(tableColumns)
+		return nil
+	}
+	if saveColumns {
+		return xerrors.New("--save-columns requires --columns")
+	}
+	saved, err := readSavedColumns()
+	if err != nil {
+		clog.LogWarn("failed to read the saved table columns",
+			clog.Causef(err.Error()), clog.BlankLine,
+			clog.Tipf(`run "coder <command> --columns= --save-columns" to reset the columns of a command`),
+		)
+		saved = nil
+	}
+	selectedColumns = saved[cmd.CommandPath()]
+	return nil
+}
+
+// writeTable writes a table with tablewriter.WriteTable, showing the columns
+// selected for the command.
+func writeTable(w io.Writer, length int, each func(i int) interface{}) error {
+	return tablewriter.WriteTable(w, length, each, tablewriter.Columns(selectedColumns))
+}
+
+// saveTableColumns saves --columns as the columns of the command when
+// --save-columns is set, or forgets the saved columns if it is empty. It's
+// called once the command succeeded, so that unknown columns aren't saved.
+func saveTableColumns(cmd *cobra.Command) error {
+	if !saveColumns {
+		return nil
+	}
+	saved, err := readSavedColumns()
+	if err != nil {
+		// Start over rather than never saving columns again.
+		saved = nil
+	}
+	if saved == nil {
+		saved = make(map[string][]string)
+	}
+	columns := nonEmptyColumns(tableColumns)
+	if columns == nil {
+		delete(saved, cmd.CommandPath())
+	} else {
+		saved[cmd.CommandPath()] = columns
+	}
+	raw, err := json.Marshal(saved)
+	if err != nil {
+		return xerrors.Errorf("marshal table columns: %w", err)
+	}
+	if err := config.TableColumns.Write(string(raw)); err != nil {
+		return xerrors.Errorf("save table columns: %w", err)
+	}
+	if columns == nil {
+		clog.LogSuccess("forgot the saved columns of \"" + cmd.CommandPath() + "\"")
+	} else {
+		clog.LogSuccess("saved the columns of \"" + cmd.CommandPath() + "\": " + strings.Join(columns, ", "))
+	}
+	return nil
+}
+
+// readSavedColumns returns the saved columns of each command, by command
+// path.
+func readSavedColumns() (map[string][]string, error) {
+	raw, err := config.TableColumns.Read()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved map[string][]string
+	if err := json.Unmarshal([]byte(raw), &saved); err != nil {
+		return nil, xerrors.Errorf("parse table columns: %w", err)
+	}
+	return saved, nil
+}
+
+// nonEmptyColumns drops the empty names of columns, so that "--columns="
+// selects all columns, and returns nil if none is left.
+func nonEmptyColumns(columns []string) []string {
+	var names []string
+	for _, c := range columns {
+		if c = strings.TrimSpace(c); c != "" {
+			names = append(names, c)
+		}
+	}
+	return names
+}
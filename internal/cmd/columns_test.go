@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+	"cdr.dev/coder-cli/internal/config"
+)
+
+// Not parallel: the columns are saved in the config dir.
+func Test_tableColumns(t *testing.T) {
+	fake := codertest.New()
+	providerID := fake.AddProvider(coder.KubernetesProvider{Name: "us-east", BuiltIn: true})
+	imageID := fake.AddImage(coder.Image{Repository: "codercom/ubuntu"}, "20.04")
+	fake.AddWorkspace(coder.Workspace{Name: "my-dev", ImageID: imageID, ImageTag: "20.04", ResourcePoolID: providerID})
+	useFakeClient(t, fake)
+	t.Cleanup(func() {
+		selectedColumns = nil
+		_ = config.TableColumns.Delete()
+	})
+
+	header := func(res result) string {
+		return strings.Fields(strings.SplitN(res.outBuffer.String(), "\n", 2)[0])[0]
+	}
+
+	res := execute(t, nil, "workspaces", "ls", "--columns", "status,name")
+	res.success(t)
+	assert.Equal(t, "first column", "Status", header(res))
+	assert.False(t, "other columns hidden", strings.Contains(res.outBuffer.String(), "20.04"))
+
+	res = execute(t, nil, "workspaces", "ls", "--columns", "nope")
+	res.error(t)
+
+	res = execute(t, nil, "workspaces", "ls", "--columns", "nope", "--save-columns")
+	res.error(t)
+	_, err := config.TableColumns.Read()
+	assert.Error(t, "unknown columns aren't saved", err)
+
+	res = execute(t, nil, "workspaces", "ls", "--columns", "memory-gb,name", "--save-columns")
+	res.success(t)
+	res = execute(t, nil, "workspaces", "ls")
+	res.success(t)
+	assert.Equal(t, "saved columns used", "MemoryGB", header(res))
+
+	res = execute(t, nil, "workspaces", "ls", "--columns=", "--save-columns")
+	res.success(t)
+	res = execute(t, nil, "workspaces", "ls")
+	res.success(t)
+	assert.Equal(t, "all columns again", "Name", header(res))
+
+	res = execute(t, nil, "workspaces", "ls", "--save-columns")
+	res.error(t)
+}
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/proxy"
+	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// setting is a key of "coder config", stored in its own config file.
+type setting struct {
+	file  config.File
+	usage string
+	// validate checks the value before it is stored.
+	validate func(ctx context.Context, value string) error
+}
+
+var settings = map[string]setting{
+	"default-workspace": {
+		file:     config.DefaultWorkspace,
+		usage:    "workspace targeted by ssh, tunnel and workspaces exec-script when given none",
+		validate: validateDefaultWorkspace,
+	},
+	"help-examples": {
+		file:     config.HelpExamples,
+		usage:    "how help fills examples: off, local with the saved URL and default workspace, or lookup to also query the deployment",
+		validate: validateHelpExamples,
+	},
+	"proxy-auth": {
+		file:     config.ProxyAuth,
+		usage:    "scheme used to authenticate to proxies: basic, ntlm or negotiate, unless " + proxyAuthEnv + " is set",
+		validate: validateProxyAuth,
+	},
+	"proxy-pac": {
+		file:     config.ProxyPAC,
+		usage:    "URL or path of the proxy auto-config script choosing the proxy of each connection, unless " + proxyPACEnv + " is set",
+		validate: proxy.CheckPAC,
+	},
+	"satellite": {
+		file:     config.Satellite,
+		usage:    "satellite ssh and tunnel connections go through while it's healthy, failing over to others or the deployment",
+		validate: validateSatellite,
+	},
+	"ssh-banner": {
+		file:     config.SSHBanner,
+		usage:    "whether \"coder ssh\" prints a summary of the workspace before a shell: on or off",
+		validate: validateSSHBanner,
+	},
+	"update-channel": {
+		file:     config.UpdateChannel,
+		usage:    "release channel \"coder update\" tracks: stable, beta or nightly",
+		validate: validateUpdateChannel,
+	},
+}
+
+func lookupSetting(key string) (setting, error) {
+	s, ok := settings[key]
+	if !ok {
+		return setting{}, clog.Error(i18n.Sprintf("unknown setting %q", key),
+			fmt.Sprintf("settings: %s", strings.Join(settingKeys(), ", ")),
+		)
+	}
+	return s, nil
+}
+
+func settingKeys() []string {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func completeSettingKeys(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return settingKeys(), cobra.ShellCompDirectiveNoFileComp
+}
+
+func configCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Get and set preferences of the coder CLI",
+	}
+	cmd.AddCommand(setConfigCmd(), getConfigCmd(), unsetConfigCmd())
+	return cmd
+}
+
+func setConfigCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:               "set [key] [value]",
+		Short:             "Set a preference",
+		Long:              "Set a preference. Settings:\n\n" + settingsUsage(),
+		Example:           `coder config set default-workspace my-dev`,
+		Args:              xcobra.ExactArgs(2),
+		ValidArgsFunction: completeSettingKeys,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := lookupSetting(args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.validate(cmd.Context(), args[1]); err != nil {
+				return err
+			}
+			if err := s.file.Write(args[1]); err != nil {
+				return xerrors.Errorf("write %s: %w", args[0], err)
+			}
+			clog.LogSuccess(i18n.Sprintf("set %s to %q", args[0], args[1]))
+			return nil
+		},
+	}
+}
+
+func getConfigCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:               "get [key]",
+		Short:             "Print a preference",
+		Example:           `coder config get default-workspace`,
+		Args:              xcobra.ExactArgs(1),
+		ValidArgsFunction: completeSettingKeys,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := lookupSetting(args[0])
+			if err != nil {
+				return err
+			}
+			value, err := s.file.Read()
+			if os.IsNotExist(err) {
+				clog.LogInfo(i18n.Sprintf("%s is not set", args[0]))
+				return nil
+			}
+			if err != nil {
+				return xerrors.Errorf("read %s: %w", args[0], err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), value)
+			return nil
+		},
+	}
+}
+
+func unsetConfigCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:               "unset [key]",
+		Short:             "Clear a preference",
+		Example:           `coder config unset default-workspace`,
+		Args:              xcobra.ExactArgs(1),
+		ValidArgsFunction: completeSettingKeys,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := lookupSetting(args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.file.Delete(); err != nil && !os.IsNotExist(err) {
+				return xerrors.Errorf("clear %s: %w", args[0], err)
+			}
+			clog.LogSuccess(i18n.Sprintf("cleared %s", args[0]))
+			return nil
+		},
+	}
+}
+
+func settingsUsage() string {
+	var b strings.Builder
+	for _, key := range settingKeys() {
+		fmt.Fprintf(&b, "  %s: %s\n", key, settings[key].usage)
+	}
+	return b.String()
+}
+
+// validateDefaultWorkspace checks that the default workspace is one of the
+// user's workspaces.
+func validateDefaultWorkspace(ctx context.Context, name string) error {
+	if strings.Contains(name, "/") {
+		return xerrors.Errorf("invalid workspace name %q: the default workspace can't name an agent", name)
+	}
+	client, err := newClient(ctx, true)
+	if err != nil {
+		return err
+	}
+	_, err = findWorkspace(ctx, client, name, coder.Me)
+	return err
+}
+
+// workspaceArg splits the workspace a command targets off its arguments. The
+// workspace is given with --workspace, in which case all the arguments belong
+// to the command, or as the first argument when there are more than rest
+// arguments. Otherwise, the default workspace is targeted.
+func workspaceArg(flag string, args []string, rest int) (string, []string, error) {
+	if flag != "" {
+		return flag, args, nil
+	}
+	if len(args) > rest {
+		return args[0], args[1:], nil
+	}
+	name, err := defaultWorkspace()
+	if err != nil {
+		return "", nil, err
+	}
+	if name == "" {
+		return "", nil, clog.Error("missing [workspace_name] argument",
+			clog.BlankLine,
+			clog.Tipf("run \"coder config set default-workspace <name>\" to target a workspace when given none"),
+		)
+	}
+	return name, args, nil
+}
+
+// defaultWorkspace returns the default workspace, or "" if none is set.
+func defaultWorkspace() (string, error) {
+	name, err := config.DefaultWorkspace.Read()
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", xerrors.Errorf("read default workspace: %w", err)
+	}
+	return strings.TrimSpace(name), nil
+}
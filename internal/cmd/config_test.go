@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+	"cdr.dev/coder-cli/internal/config"
+)
+
+// Not parallel: the default workspace is stored in the config dir.
+func Test_defaultWorkspace(t *testing.T) {
+	fake := codertest.New()
+	fake.AddWorkspace(coder.Workspace{Name: "my-dev", LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOff}})
+	useFakeClient(t, fake)
+	t.Cleanup(func() {
+		_ = config.DefaultWorkspace.Delete()
+	})
+
+	_, _, err := workspaceArg("", []string{"8080", "8080"}, 2)
+	assert.ErrorContains(t, "no default", err, "missing [workspace_name] argument")
+
+	res := execute(t, nil, "config", "set", "default-workspace", "backend")
+	res.error(t)
+	res = execute(t, nil, "config", "set", "default-workspce", "my-dev")
+	res.error(t)
+	res.stderrContains(t, "settings: default-workspace")
+	res = execute(t, nil, "config", "set", "default-workspace", "my-dev")
+	res.success(t)
+	res = execute(t, nil, "config", "get", "default-workspace")
+	res.success(t)
+	res.stdoutContains(t, "my-dev")
+
+	name, rest, err := workspaceArg("", []string{"8080", "8080"}, 2)
+	assert.Success(t, "default", err)
+	assert.Equal(t, "default workspace", "my-dev", name)
+	assert.Equal(t, "rest", []string{"8080", "8080"}, rest)
+	name, rest, err = workspaceArg("", []string{"backend", "8080", "8080"}, 2)
+	assert.Success(t, "argument", err)
+	assert.Equal(t, "workspace argument", "backend", name)
+	assert.Equal(t, "rest", []string{"8080", "8080"}, rest)
+	name, rest, err = workspaceArg("backend", []string{"pwd"}, 0)
+	assert.Success(t, "flag", err)
+	assert.Equal(t, "workspace flag", "backend", name)
+	assert.Equal(t, "rest", []string{"pwd"}, rest)
+
+	res = execute(t, nil, "tunnel", "8080", "8080")
+	res.error(t)
+	res.stderrContains(t, "workspace not available")
+
+	res = execute(t, nil, "config", "unset", "default-workspace")
+	res.success(t)
+	res = execute(t, nil, "config", "get", "default-workspace")
+	res.success(t)
+	res.stderrContains(t, "default-workspace is not set")
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -17,6 +18,8 @@ import (
 
 	"cdr.dev/coder-cli/coder-sdk"
 	"cdr.dev/coder-cli/internal/coderutil"
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/pkg/clog"
 )
 
@@ -31,59 +34,125 @@ const sshStartMessage = `# The following has been auto-generated by "coder confi
 # You should not hand-edit this section, unless you are deleting it.`
 const sshEndToken = "# ------------END-CODER-ENTERPRISE------------"
 
+// sshIncludePrefix starts the name of the file of generated Host entries,
+// which is followed by the name of the ssh config that includes it, next to
+// it. The include file of ~/.ssh/config is ~/.ssh/coder_config.
+const sshIncludePrefix = "coder_"
+const sshIncludeMessage = `# The following has been auto-generated by "coder config-ssh",
+# and is included by %q.
+#
+# Options added to a host above the line
+#
+#    %s
+#
+# are kept when the configuration is regenerated. To remove a workspace, run:
+#
+#    coder config-ssh --remove <workspace_name>`
+
+// sshCustomOptionsMarker separates the options added by the user to a host
+// from the generated ones below. Since ssh uses the first value of an option,
+// the options of the user come first to override the generated ones.
+const sshCustomOptionsMarker = `# Options above this line are kept by "coder config-ssh".`
+
+// sshLegacyCustomOptionsMarker is the marker of the include files written by
+// previous versions, which kept the options of the user below it.
+const sshLegacyCustomOptionsMarker = `# Options below this line are kept by "coder config-ssh".`
+
+// sshRemovedPrefix starts the line listing the workspaces removed with
+// "coder config-ssh --remove <workspace_name>", which aren't added back
+// when the configuration is refreshed.
+const sshRemovedPrefix = "# Removed workspaces: "
+
 func configSSHCmd() *cobra.Command {
 	var (
 		configpath        string
 		remove            = false
 		additionalOptions []string
+		autoRefresh       bool
+		prune             bool
 	)
 
 	cmd := &cobra.Command{
-		Use:   "config-ssh",
+		Use:   "config-ssh [--remove [workspace_name...]]",
 		Short: "Configure SSH to access Coder workspaces",
-		Long:  "Inject the proper OpenSSH configuration into your local SSH config file.",
-		RunE:  configSSH(&configpath, &remove, &additionalOptions),
+		Long: "Inject the proper OpenSSH configuration into your local SSH config file.\n\n" +
+			"The Host entries of your workspaces are written to a file next to the SSH config, named after it with a coder_ prefix " +
+			"(coder_config for ~/.ssh/config), which a short section at the top of the SSH config includes. " +
+			"Options you add to a host above the line marked for them in that file are kept when it's regenerated, " +
+			"and override the generated ones.\n\n" +
+			"With workspace names, --remove only removes those workspaces, which aren't added back until config-ssh runs again without --remove.\n\n" +
+			"With --auto-refresh, the configuration is also regenerated whenever you create or remove " +
+			"workspaces with the CLI, until config-ssh runs with --auto-refresh=false or --remove.\n\n" +
+			"The agents of the running workspaces are checked in parallel. Hosts of deleted workspaces, and of workspaces " +
+			"whose agent never connected, are kept but marked stale, unless --prune is given to remove them.",
+		Example: `coder config-ssh
+coder config-ssh --ssh-config-file ~/.ssh/work_config
+
+# stop generating a host for a workspace
+coder config-ssh --remove my-dev
+
+# remove the hosts of deleted or broken workspaces
+coder config-ssh --prune`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if !remove && len(args) > 0 {
+				return xerrors.New("workspace names are only accepted with --remove")
+			}
+			if remove && prune {
+				return xerrors.New("--prune can't be used with --remove")
+			}
+			return nil
+		},
+		RunE: configSSH(&configpath, &remove, &additionalOptions, &autoRefresh, &prune),
 	}
+	cmd.Flags().StringVar(&configpath, "ssh-config-file", filepath.Join("~", ".ssh", "config"), "override the default path of your ssh config file")
 	cmd.Flags().StringVar(&configpath, "filepath", filepath.Join("~", ".ssh", "config"), "override the default path of your ssh config file")
+	_ = cmd.Flags().MarkDeprecated("filepath", "use --ssh-config-file instead")
 	cmd.Flags().StringSliceVarP(&additionalOptions, "option", "o", []string{}, "additional options injected in the ssh config (ex. disable caching with \"-o ControlPath=none\")")
-	cmd.Flags().BoolVar(&remove, "remove", false, "remove the auto-generated Coder ssh config")
+	cmd.Flags().BoolVar(&remove, "remove", false, "remove the auto-generated Coder ssh config, or only the given workspaces")
+	cmd.Flags().BoolVar(&autoRefresh, "auto-refresh", false, "regenerate the ssh config whenever workspaces are created or removed")
+	cmd.Flags().BoolVar(&prune, "prune", false, "remove the hosts of deleted workspaces and of workspaces whose agent never connected")
+	_ = cmd.MarkFlagFilename("ssh-config-file")
+	_ = cmd.MarkFlagFilename("filepath")
 
 	return cmd
 }
 
-func configSSH(configpath *string, remove *bool, additionalOptions *[]string) func(cmd *cobra.Command, _ []string) error {
-	return func(cmd *cobra.Command, _ []string) error {
+func configSSH(configpath *string, remove *bool, additionalOptions *[]string, autoRefresh *bool, prune *bool) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
 		ctx := cmd.Context()
-		usr, err := user.Current()
+		var (
+			privateKeyFilepath string
+			err                error
+		)
+		*configpath, privateKeyFilepath, err = sshConfigPaths(*configpath)
 		if err != nil {
-			return xerrors.Errorf("get user home directory: %w", err)
-		}
-
-		privateKeyFilepath := filepath.Join(usr.HomeDir, ".ssh", "coder_enterprise")
-
-		if strings.HasPrefix(*configpath, "~") {
-			*configpath = strings.Replace(*configpath, "~", usr.HomeDir, 1)
+			return err
 		}
 
-		currentConfig, err := readStr(*configpath)
-		if os.IsNotExist(err) {
-			// SSH configs are not always already there.
-			currentConfig = ""
-		} else if err != nil {
-			return xerrors.Errorf("read ssh config file %q: %w", *configpath, err)
+		if *remove && len(args) > 0 {
+			if err := removeSSHHosts(*configpath, args); err != nil {
+				return err
+			}
+			clog.LogSuccess(i18n.Sprintf("removed %s from the ssh config", strings.Join(args, ", ")))
+			return nil
 		}
-
-		currentConfig, didRemoveConfig := removeOldConfig(currentConfig)
 		if *remove {
+			currentConfig, err := readSSHConfig(*configpath)
+			if err != nil {
+				return err
+			}
+			currentConfig, didRemoveConfig := removeOldConfig(currentConfig)
 			if !didRemoveConfig {
 				return xerrors.Errorf("the Coder ssh configuration section could not be safely deleted or does not exist")
 			}
 
-			err = writeStr(*configpath, currentConfig)
+			err = writeFileAtomic(*configpath, currentConfig)
 			if err != nil {
 				return xerrors.Errorf("write to ssh config file %q: %s", *configpath, err)
 			}
+			_ = os.Remove(sshIncludePath(*configpath))
 			_ = os.Remove(privateKeyFilepath)
+			_ = config.SSHAutoRefresh.Delete()
 
 			return nil
 		}
@@ -115,20 +184,19 @@ func configSSH(configpath *string, remove *bool, additionalOptions *[]string) fu
 			return xerrors.New("SSH is disabled or not available for any workspaces in your Coder deployment.")
 		}
 
-		binPath, err := binPath()
-		if err != nil {
-			return xerrors.Errorf("Failed to get executable path: %w", err)
+		stale := sshStale{
+			neverConnected: probeSSHHosts(ctx, client, workspacesWithProviders),
+			prune:          *prune,
 		}
-
-		newConfig := makeNewConfigs(binPath, workspacesWithProviders, privateKeyFilepath, *additionalOptions)
-
-		err = os.MkdirAll(filepath.Dir(*configpath), os.ModePerm)
+		// Running config-ssh again configures every workspace, including
+		// the ones removed with --remove.
+		staleHosts, err := writeCoderSSHConfig(*configpath, privateKeyFilepath, workspacesWithProviders, *additionalOptions, false, stale)
 		if err != nil {
-			return xerrors.Errorf("make configuration directory: %w", err)
+			return err
 		}
-		err = writeStr(*configpath, currentConfig+newConfig)
-		if err != nil {
-			return xerrors.Errorf("write new configurations to ssh config file %q: %w", *configpath, err)
+		reportStaleSSHHosts(staleHosts, *prune)
+		if err := setSSHAutoRefresh(cmd, *autoRefresh, sshAutoRefresh{Filepath: *configpath, Options: *additionalOptions}); err != nil {
+			return err
 		}
 		err = writeSSHKey(ctx, client, privateKeyFilepath)
 		if err != nil {
@@ -141,13 +209,349 @@ func configSSH(configpath *string, remove *bool, additionalOptions *[]string) fu
 		}
 
 		writeSSHUXState(ctx, client, user.ID, workspaces)
-		fmt.Printf("An auto-generated ssh config was written to \"%s\"\n", *configpath)
+		fmt.Printf("An auto-generated ssh config was written to \"%s\", and included by \"%s\"\n", sshIncludePath(*configpath), *configpath)
 		fmt.Println("You should now be able to ssh into your workspace")
 		fmt.Printf("For example, try running\n\n\t$ ssh coder.%s\n\n", workspaces[0].Name)
 		return nil
 	}
 }
 
+// writeCoderSSHConfig writes the Host entries of the given workspaces to the
+// include file of the ssh config at configpath, and makes sure the ssh config
+// includes it. The options users added to hosts are kept, and so are the
+// workspaces removed with --remove if keepRemoved is set. The stale hosts
+// that were marked or pruned are returned.
+func writeCoderSSHConfig(configpath, privateKeyFilepath string, workspaces []coderutil.WorkspaceWithWorkspaceProvider, additionalOptions []string, keepRemoved bool, stale sshStale) ([]sshStaleHost, error) {
+	binPath, err := binPath()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get executable path: %w", err)
+	}
+	includePath := sshIncludePath(configpath)
+	previous, err := readSSHInclude(includePath)
+	if err != nil {
+		return nil, err
+	}
+	if !keepRemoved {
+		previous.removed = nil
+	}
+	include, staleHosts := makeSSHInclude(binPath, workspaces, privateKeyFilepath, additionalOptions, previous, stale)
+
+	if err := os.MkdirAll(filepath.Dir(configpath), 0700); err != nil {
+		return nil, xerrors.Errorf("make configuration directory: %w", err)
+	}
+	if err := writeFileAtomic(includePath, include.render(configpath)); err != nil {
+		return nil, xerrors.Errorf("write ssh config include file %q: %w", includePath, err)
+	}
+	return staleHosts, replaceSSHConfig(configpath, sshIncludeSection(includePath))
+}
+
+// removeSSHHosts removes the Host entries of the named workspaces from the
+// include file of the ssh config at configpath, and remembers them so that
+// refreshing the configuration doesn't add them back.
+func removeSSHHosts(configpath string, names []string) error {
+	includePath := sshIncludePath(configpath)
+	include, err := readSSHInclude(includePath)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		i := include.host(name)
+		if i < 0 {
+			return xerrors.Errorf("workspace %q isn't in the ssh config %q", name, includePath)
+		}
+		include.hosts = append(include.hosts[:i], include.hosts[i+1:]...)
+		include.removed = append(include.removed, name)
+	}
+	if err := writeFileAtomic(includePath, include.render(configpath)); err != nil {
+		return xerrors.Errorf("write ssh config include file %q: %w", includePath, err)
+	}
+	return nil
+}
+
+// sshAutoRefresh is what config-ssh stores in config.SSHAutoRefresh to
+// regenerate the ssh config the same way later.
+type sshAutoRefresh struct {
+	Filepath string   `json:"filepath"`
+	Options  []string `json:"options"`
+}
+
+// setSSHAutoRefresh enables or disables refreshing the ssh config, if the
+// --auto-refresh flag was given. Otherwise, a previous setting is updated
+// with conf.
+func setSSHAutoRefresh(cmd *cobra.Command, enable bool, conf sshAutoRefresh) error {
+	if !cmd.Flags().Changed("auto-refresh") {
+		if _, err := config.SSHAutoRefresh.Read(); err != nil {
+			return nil
+		}
+		enable = true
+	}
+	if !enable {
+		if err := config.SSHAutoRefresh.Delete(); err != nil && !os.IsNotExist(err) {
+			return xerrors.Errorf("disable ssh config refresh: %w", err)
+		}
+		return nil
+	}
+	raw, err := json.Marshal(conf)
+	if err != nil {
+		return xerrors.Errorf("marshal ssh config refresh: %w", err)
+	}
+	if err := config.SSHAutoRefresh.Write(string(raw)); err != nil {
+		return xerrors.Errorf("enable ssh config refresh: %w", err)
+	}
+	return nil
+}
+
+// refreshSSHConfig regenerates the ssh config after the workspaces changed,
+// if the user opted in with "coder config-ssh --auto-refresh". Failures are
+// only logged, since the workspaces already changed.
+func refreshSSHConfig(ctx context.Context, client coder.Client) {
+	raw, err := config.SSHAutoRefresh.Read()
+	if err != nil {
+		return
+	}
+	var conf sshAutoRefresh
+	if err := json.Unmarshal([]byte(raw), &conf); err != nil {
+		clog.LogWarn("failed to read the ssh config refresh settings",
+			clog.Causef(err.Error()), clog.BlankLine,
+			clog.Tipf(`run "coder config-ssh --auto-refresh" to reset them`),
+		)
+		return
+	}
+
+	err = func() error {
+		_, privateKeyFilepath, err := sshConfigPaths(conf.Filepath)
+		if err != nil {
+			return err
+		}
+		workspaces, err := getWorkspaces(ctx, client, coder.Me)
+		if err != nil {
+			return err
+		}
+		workspacesWithProviders, err := coderutil.WorkspacesWithProvider(ctx, client, workspaces)
+		if err != nil {
+			return xerrors.Errorf("resolve workspace workspace providers: %w", err)
+		}
+		// The hosts of the workspaces just removed are dropped without
+		// checking the others, which would slow down every command.
+		_, err = writeCoderSSHConfig(conf.Filepath, privateKeyFilepath, workspacesWithProviders, conf.Options, true, sshStale{prune: true})
+		return err
+	}()
+	if err != nil {
+		clog.LogWarn("failed to refresh the ssh config",
+			clog.Causef(err.Error()), clog.BlankLine,
+			clog.Tipf(`run "coder config-ssh" to update it`),
+		)
+		return
+	}
+	clog.LogInfo(i18n.Sprintf("refreshed the ssh config at %q", conf.Filepath))
+}
+
+// sshConfigPaths expands a leading "~" in configpath and returns it along with
+// the path of the private key used by the generated ssh config.
+func sshConfigPaths(configpath string) (config, privateKey string, _ error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", "", xerrors.Errorf("get user home directory: %w", err)
+	}
+	if strings.HasPrefix(configpath, "~") {
+		configpath = strings.Replace(configpath, "~", usr.HomeDir, 1)
+	}
+	return configpath, filepath.Join(usr.HomeDir, ".ssh", "coder_enterprise"), nil
+}
+
+// readSSHConfig reads the ssh config at configpath. A missing file is treated as empty.
+func readSSHConfig(configpath string) (string, error) {
+	currentConfig, err := readStr(configpath)
+	if os.IsNotExist(err) {
+		// SSH configs are not always already there.
+		return "", nil
+	} else if err != nil {
+		return "", xerrors.Errorf("read ssh config file %q: %w", configpath, err)
+	}
+	return currentConfig, nil
+}
+
+// replaceSSHConfig replaces the auto-generated section of the ssh config at
+// configpath with section, leaving the rest of the file untouched. The
+// section goes at the top of the file, since an Include after a Host entry
+// would only apply to that host.
+func replaceSSHConfig(configpath, section string) error {
+	currentConfig, err := readSSHConfig(configpath)
+	if err != nil {
+		return err
+	}
+	rest, _ := removeOldConfig(currentConfig)
+	if rest != "" && !strings.HasPrefix(rest, "\n") {
+		rest = "\n" + rest
+	}
+	newConfig := section + rest
+	if newConfig == currentConfig {
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(configpath), 0700)
+	if err != nil {
+		return xerrors.Errorf("make configuration directory: %w", err)
+	}
+	err = writeFileAtomic(configpath, newConfig)
+	if err != nil {
+		return xerrors.Errorf("write new configurations to ssh config file %q: %w", configpath, err)
+	}
+	return nil
+}
+
+// sshIncludePath returns the path of the include file of the ssh config at
+// configpath, which is named after it so that ssh configs in the same
+// directory don't share it.
+func sshIncludePath(configpath string) string {
+	return filepath.Join(filepath.Dir(configpath), sshIncludePrefix+filepath.Base(configpath))
+}
+
+// sshIncludeSection returns the auto-generated section of the ssh config,
+// which includes the file of generated Host entries.
+func sshIncludeSection(includePath string) string {
+	return fmt.Sprintf("%s\n%s\nInclude %q\n%s\n", sshStartToken, sshStartMessage, includePath, sshEndToken)
+}
+
+// sshHost is a Host entry of the include file.
+type sshHost struct {
+	workspace string
+	generated []string
+	// custom are the options added by the user above
+	// sshCustomOptionsMarker.
+	custom []string
+}
+
+// sshInclude is the content of the include file.
+type sshInclude struct {
+	hosts   []sshHost
+	removed []string
+}
+
+// readSSHInclude reads the include file at path. A missing file is treated as
+// empty.
+func readSSHInclude(path string) (sshInclude, error) {
+	content, err := readStr(path)
+	if os.IsNotExist(err) {
+		return sshInclude{}, nil
+	} else if err != nil {
+		return sshInclude{}, xerrors.Errorf("read ssh config include file %q: %w", path, err)
+	}
+	return parseSSHInclude(content), nil
+}
+
+// parseSSHInclude parses an include file written by render, or by previous
+// versions which rendered the custom options after the generated ones.
+func parseSSHInclude(content string) sshInclude {
+	var (
+		include sshInclude
+		// pending are the options of the current host before a marker,
+		// which it tells apart.
+		pending []string
+		custom  bool
+		marked  bool
+	)
+	endHost := func() {
+		if current := len(include.hosts) - 1; current >= 0 && !marked {
+			include.hosts[current].generated = append(include.hosts[current].generated, pending...)
+		}
+		pending, custom, marked = nil, false, false
+	}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		current := len(include.hosts) - 1
+		switch {
+		case strings.HasPrefix(line, "Host coder."):
+			endHost()
+			include.hosts = append(include.hosts, sshHost{workspace: strings.TrimPrefix(line, "Host coder.")})
+		case current < 0:
+			if names := strings.TrimPrefix(line, sshRemovedPrefix); names != line {
+				for _, name := range strings.Split(names, ",") {
+					if name = strings.TrimSpace(name); name != "" {
+						include.removed = append(include.removed, name)
+					}
+				}
+			}
+		case line == "":
+		case line == sshCustomOptionsMarker && !marked:
+			include.hosts[current].custom = append(include.hosts[current].custom, pending...)
+			pending, marked = nil, true
+		case line == sshLegacyCustomOptionsMarker && !marked:
+			include.hosts[current].generated = append(include.hosts[current].generated, pending...)
+			pending, custom, marked = nil, true, true
+		case !marked:
+			pending = append(pending, line)
+		case custom:
+			include.hosts[current].custom = append(include.hosts[current].custom, line)
+		default:
+			include.hosts[current].generated = append(include.hosts[current].generated, line)
+		}
+	}
+	endHost()
+	return include
+}
+
+// host returns the index of the host of the workspace, or -1.
+func (i sshInclude) host(workspace string) int {
+	for n, h := range i.hosts {
+		if h.workspace == workspace {
+			return n
+		}
+	}
+	return -1
+}
+
+func (i sshInclude) render(configpath string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, sshIncludeMessage+"\n", configpath, sshCustomOptionsMarker)
+	if len(i.removed) > 0 {
+		b.WriteString(sshRemovedPrefix + strings.Join(i.removed, ", ") + "\n")
+	}
+	for _, h := range i.hosts {
+		fmt.Fprintf(&b, "\nHost coder.%s\n", h.workspace)
+		for _, option := range h.custom {
+			b.WriteString("\t" + option + "\n")
+		}
+		b.WriteString("\t" + sshCustomOptionsMarker + "\n")
+		for _, option := range h.generated {
+			b.WriteString("\t" + option + "\n")
+		}
+	}
+	return b.String()
+}
+
+// writeFileAtomic writes content to a temporary file next to path and renames
+// it over path, so that ssh never reads a partially written config. The mode
+// of an existing file is kept, and so is a symlink at path, such as to a
+// config kept in a dotfiles repository, by writing to its target.
+func writeFileAtomic(path, content string) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
 // binPath returns the path to the coder binary suitable for use in ssh
 // ProxyCommand.
 func binPath() (string, error) {
@@ -228,28 +632,71 @@ func writeSSHKey(ctx context.Context, client coder.Client, privateKeyPath string
 	return ioutil.WriteFile(privateKeyPath, []byte(key.PrivateKey), 0600)
 }
 
-func makeNewConfigs(binPath string, workspaces []coderutil.WorkspaceWithWorkspaceProvider, privateKeyFilepath string, additionalOptions []string) string {
-	newConfig := fmt.Sprintf("\n%s\n%s\n\n", sshStartToken, sshStartMessage)
+// makeSSHInclude returns the include file with a Host entry for each
+// workspace whose provider allows SSH, keeping the options users added to the
+// hosts of previous and leaving out the workspaces removed from it. Hosts
+// that are stale are marked, or left out if stale.prune is set, and returned.
+func makeSSHInclude(binPath string, workspaces []coderutil.WorkspaceWithWorkspaceProvider, privateKeyFilepath string, additionalOptions []string, previous sshInclude, stale sshStale) (sshInclude, []sshStaleHost) {
+	include := sshInclude{removed: previous.removed}
+	removed := make(map[string]bool, len(previous.removed))
+	for _, name := range previous.removed {
+		removed[name] = true
+	}
+	var staleHosts []sshStaleHost
+	exists := make(map[string]bool, len(workspaces))
+	for _, workspace := range workspaces {
+		exists[workspace.Workspace.Name] = true
+	}
 
 	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].Workspace.Name < workspaces[j].Workspace.Name })
 
 	for _, workspace := range workspaces {
 		if !workspace.WorkspaceProvider.SSHEnabled {
-			clog.LogWarn(fmt.Sprintf("SSH is not enabled for workspace provider %q", workspace.WorkspaceProvider.Name),
+			clog.LogWarn(i18n.Sprintf("SSH is not enabled for workspace provider %q", workspace.WorkspaceProvider.Name),
 				clog.BlankLine,
 				clog.Tipf("ask an infrastructure administrator to enable SSH for this workspace provider"),
 			)
 			continue
 		}
+		if removed[workspace.Workspace.Name] {
+			continue
+		}
 
-		newConfig += makeSSHConfig(binPath, workspace.Workspace.Name, privateKeyFilepath, additionalOptions)
+		host := sshHost{
+			workspace: workspace.Workspace.Name,
+			generated: makeSSHConfig(binPath, workspace.Workspace.Name, privateKeyFilepath, additionalOptions),
+		}
+		if i := previous.host(host.workspace); i >= 0 {
+			host.custom = previous.hosts[i].custom
+		}
+		if stale.neverConnected[host.workspace] {
+			staleHosts = append(staleHosts, sshStaleHost{workspace: host.workspace, reason: sshStaleNeverConnected})
+			if stale.prune {
+				continue
+			}
+			host.generated = markStale(host.generated, sshStaleNeverConnected)
+		}
+		include.hosts = append(include.hosts, host)
 	}
-	newConfig += fmt.Sprintf("\n%s\n", sshEndToken)
 
-	return newConfig
+	for _, host := range previous.hosts {
+		if exists[host.workspace] {
+			continue
+		}
+		staleHosts = append(staleHosts, sshStaleHost{workspace: host.workspace, reason: sshStaleDeleted})
+		if stale.prune {
+			continue
+		}
+		host.generated = markStale(host.generated, sshStaleDeleted)
+		include.hosts = append(include.hosts, host)
+	}
+	sort.Slice(include.hosts, func(i, j int) bool { return include.hosts[i].workspace < include.hosts[j].workspace })
+	return include, staleHosts
 }
 
-func makeSSHConfig(binPath, workspaceName, privateKeyFilepath string, additionalOptions []string) string {
+// makeSSHConfig returns the generated options of the Host entry of the
+// workspace.
+func makeSSHConfig(binPath, workspaceName, privateKeyFilepath string, additionalOptions []string) []string {
 	// Custom user options come first to maximizessh customization.
 	options := []string{}
 	if len(additionalOptions) > 0 {
@@ -261,7 +708,7 @@ func makeSSHConfig(binPath, workspaceName, privateKeyFilepath string, additional
 	}
 	options = append(options,
 		fmt.Sprintf("HostName coder.%s", workspaceName),
-		fmt.Sprintf("ProxyCommand %q tunnel %s 12213 stdio", binPath, workspaceName),
+		fmt.Sprintf("ProxyCommand %q ssh --stdio %s", binPath, workspaceName),
 		"StrictHostKeyChecking no",
 		"ConnectTimeout=0",
 		"IdentitiesOnly yes",
@@ -276,11 +723,7 @@ func makeSSHConfig(binPath, workspaceName, privateKeyFilepath string, additional
 		)
 	}
 
-	return fmt.Sprintf("Host coder.%s\n\t%s\n\n", workspaceName, strings.Join(options, "\n\t"))
-}
-
-func writeStr(filename, data string) error {
-	return ioutil.WriteFile(filename, []byte(data), 0777)
+	return options
 }
 
 func readStr(filename string) (string, error) {
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/coderutil"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+const (
+	// sshProbeParallelism is how many workspaces config-ssh checks the
+	// agents of at once.
+	sshProbeParallelism = 8
+	// sshProbeTimeout bounds the check of a single workspace, so that a slow
+	// provider doesn't hold up the whole configuration.
+	sshProbeTimeout = 10 * time.Second
+	// sshNeverConnectedAfter is how long after it was created a running
+	// workspace whose agent never connected is considered stale, rather than
+	// still starting up.
+	sshNeverConnectedAfter = 24 * time.Hour
+)
+
+// sshStalePrefix starts the generated line marking a host that likely no
+// longer works, until "coder config-ssh --prune" removes it.
+const sshStalePrefix = "# Stale: "
+
+// Why a host is stale.
+const (
+	sshStaleDeleted        = "the workspace was deleted"
+	sshStaleNeverConnected = "the workspace agent never connected"
+)
+
+// sshStale is what config-ssh does with the hosts that likely no longer
+// work: those of deleted workspaces, and of the workspaces whose agent never
+// connected.
+type sshStale struct {
+	neverConnected map[string]bool
+	// prune drops the stale hosts, instead of keeping them marked.
+	prune bool
+}
+
+// sshStaleHost is a host of the include file that likely no longer works.
+type sshStaleHost struct {
+	workspace string
+	reason    string
+}
+
+// probeSSHHosts checks the agents of the running workspaces in parallel, and
+// returns the names of those whose agent never connected. Workspaces that
+// can't be checked aren't considered stale, but are reported.
+func probeSSHHosts(ctx context.Context, client coder.Client, workspaces []coderutil.WorkspaceWithWorkspaceProvider) map[string]bool {
+	var (
+		mu             sync.Mutex
+		wg             sync.WaitGroup
+		neverConnected = make(map[string]bool)
+		failed         []string
+		sem            = make(chan struct{}, sshProbeParallelism)
+		now            = time.Now()
+	)
+	for _, w := range workspaces {
+		w := w.Workspace
+		if w.LatestStat.ContainerStatus != coder.WorkspaceOn || !w.LastConnectionAt.IsZero() || now.Sub(w.CreatedAt) < sshNeverConnectedAfter {
+			// Stopped workspaces have no agent, and the others either
+			// connected once or may still be starting.
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			ctx, cancel := context.WithTimeout(ctx, sshProbeTimeout)
+			defer cancel()
+			agents, err := client.WorkspaceAgents(ctx, w.ID)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed = append(failed, w.Name)
+				return
+			}
+			if !agentEverConnected(agents) {
+				neverConnected[w.Name] = true
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		clog.LogWarn(i18n.Sprintf("failed to check the agents of %s", strings.Join(failed, ", ")),
+			"their hosts are kept as they are",
+		)
+	}
+	return neverConnected
+}
+
+func agentEverConnected(agents []coder.WorkspaceAgent) bool {
+	for _, a := range agents {
+		if !a.ConnectedAt.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// markStale returns the generated options of a host with the line marking
+// it stale for the reason, replacing any previous mark.
+func markStale(generated []string, reason string) []string {
+	options := []string{sshStalePrefix + reason + `, "coder config-ssh --prune" removes this host`}
+	for _, option := range generated {
+		if !strings.HasPrefix(option, sshStalePrefix) {
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+// reportStaleSSHHosts tells the user about the hosts that were pruned, or
+// that could be.
+func reportStaleSSHHosts(stale []sshStaleHost, pruned bool) {
+	if len(stale) == 0 {
+		return
+	}
+	lines := make([]string, 0, len(stale))
+	for _, h := range stale {
+		lines = append(lines, fmt.Sprintf("coder.%s: %s", h.workspace, h.reason))
+	}
+	if pruned {
+		clog.LogSuccess(i18n.Sprintf("pruned %d stale hosts from the ssh config", len(stale)), lines...)
+		return
+	}
+	lines = append(lines, clog.BlankLine, clog.Tipf(`run "coder config-ssh --prune" to remove them`))
+	clog.LogWarn(i18n.Sprintf("%d hosts in the ssh config are likely stale", len(stale)), lines...)
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+	"cdr.dev/coder-cli/internal/coderutil"
+	"cdr.dev/coder-cli/internal/config"
+)
+
+// Not parallel: the refresh settings live in the shared config directory.
+func Test_refreshSSHConfig(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "coder-ssh")
+	assert.Success(t, "create temp dir", err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	sshConfig := filepath.Join(dir, "config")
+
+	fake := codertest.New()
+	providerID := fake.AddProvider(coder.KubernetesProvider{Name: "us-east", KubeProviderConfig: coder.KubeProviderConfig{SSHEnabled: true}})
+	fake.AddWorkspace(coder.Workspace{Name: "backend", ResourcePoolID: providerID})
+
+	refreshSSHConfig(ctx, fake)
+	_, err = os.Stat(sshConfig)
+	assert.True(t, "not refreshed without opting in", os.IsNotExist(err))
+
+	raw, err := json.Marshal(sshAutoRefresh{Filepath: sshConfig, Options: []string{"ForwardAgent yes"}})
+	assert.Success(t, "marshal settings", err)
+	assert.Success(t, "opt in", config.SSHAutoRefresh.Write(string(raw)))
+	t.Cleanup(func() { _ = config.SSHAutoRefresh.Delete() })
+
+	refreshSSHConfig(ctx, fake)
+	got, err := readStr(sshIncludePath(sshConfig))
+	assert.Success(t, "read ssh config include file", err)
+	assert.True(t, "backend host", strings.Contains(got, "Host coder.backend\n"))
+	assert.True(t, "options", strings.Contains(got, "ForwardAgent yes"))
+
+	fake.AddWorkspace(coder.Workspace{Name: "frontend", ResourcePoolID: providerID})
+	refreshSSHConfig(ctx, fake)
+	got, err = readStr(sshIncludePath(sshConfig))
+	assert.Success(t, "read ssh config include file", err)
+	assert.True(t, "frontend host", strings.Contains(got, "Host coder.frontend\n"))
+	got, err = readStr(sshConfig)
+	assert.Success(t, "read ssh config", err)
+	assert.Equal(t, "single section", 1, strings.Count(got, sshStartToken))
+	assert.True(t, "includes the hosts", strings.Contains(got, fmt.Sprintf("Include %q\n", sshIncludePath(sshConfig))))
+}
+
+func Test_makeSSHConfig(t *testing.T) {
+	t.Parallel()
+
+	options := makeSSHConfig("/usr/local/bin/coder", "my-dev", "/home/me/.ssh/coder_enterprise", nil)
+	assert.True(t, "proxies through ssh --stdio", strings.Contains(strings.Join(options, "\n"), "ProxyCommand \"/usr/local/bin/coder\" ssh --stdio my-dev\n"))
+}
+
+func Test_sshInclude(t *testing.T) {
+	t.Parallel()
+
+	include := sshInclude{
+		hosts: []sshHost{
+			{workspace: "backend", generated: []string{"HostName coder.backend"}, custom: []string{"ForwardAgent yes", "# for the db", "LocalForward 5432 localhost:5432"}},
+			{workspace: "frontend", generated: []string{"HostName coder.frontend"}},
+		},
+		removed: []string{"scratch"},
+	}
+	rendered := include.render("/home/me/.ssh/config")
+	assert.Equal(t, "round trip", include, parseSSHInclude(rendered))
+	// ssh uses the first value of an option, so the custom options come
+	// first to override the generated ones.
+	assert.True(t, "custom options first", strings.Index(rendered, "ForwardAgent yes") < strings.Index(rendered, "HostName coder.backend"))
+
+	legacy := "Host coder.backend\n\tHostName coder.backend\n\t" + sshLegacyCustomOptionsMarker + "\n\tForwardAgent yes\n"
+	assert.Equal(t, "legacy include", sshInclude{
+		hosts: []sshHost{{workspace: "backend", generated: []string{"HostName coder.backend"}, custom: []string{"ForwardAgent yes"}}},
+	}, parseSSHInclude(legacy))
+
+	// Regenerating keeps the custom options, and the removed workspaces
+	// until config-ssh runs without --remove.
+	workspaces := []coderutil.WorkspaceWithWorkspaceProvider{
+		{Workspace: coder.Workspace{Name: "scratch"}, WorkspaceProvider: coder.KubernetesProvider{KubeProviderConfig: coder.KubeProviderConfig{SSHEnabled: true}}},
+		{Workspace: coder.Workspace{Name: "backend"}, WorkspaceProvider: coder.KubernetesProvider{KubeProviderConfig: coder.KubeProviderConfig{SSHEnabled: true}}},
+	}
+	regenerated, _ := makeSSHInclude("coder", workspaces, "key", nil, parseSSHInclude(rendered), sshStale{prune: true})
+	assert.Equal(t, "removed workspace left out", 1, len(regenerated.hosts))
+	assert.Equal(t, "custom options kept", include.hosts[0].custom, regenerated.hosts[0].custom)
+	regenerated, _ = makeSSHInclude("coder", workspaces, "key", nil, sshInclude{}, sshStale{})
+	assert.Equal(t, "every workspace", 2, len(regenerated.hosts))
+}
+
+func Test_configSSHRemoveWorkspace(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	sshConfig := filepath.Join(dir, "config")
+	err := ioutil.WriteFile(sshConfig, []byte("Host example\n\tUser me\n"), 0640)
+	assert.Success(t, "write ssh config", err)
+
+	workspaces := []coderutil.WorkspaceWithWorkspaceProvider{
+		{Workspace: coder.Workspace{Name: "backend"}, WorkspaceProvider: coder.KubernetesProvider{KubeProviderConfig: coder.KubeProviderConfig{SSHEnabled: true}}},
+		{Workspace: coder.Workspace{Name: "frontend"}, WorkspaceProvider: coder.KubernetesProvider{KubeProviderConfig: coder.KubeProviderConfig{SSHEnabled: true}}},
+	}
+	_, err = writeCoderSSHConfig(sshConfig, "key", workspaces, nil, false, sshStale{})
+	assert.Success(t, "write", err)
+	got, err := readStr(sshConfig)
+	assert.Success(t, "read ssh config", err)
+	assert.True(t, "section first", strings.HasPrefix(got, sshStartToken))
+	assert.True(t, "user entries kept", strings.HasSuffix(got, "\nHost example\n\tUser me\n"))
+	info, err := os.Stat(sshConfig)
+	assert.Success(t, "stat ssh config", err)
+	assert.Equal(t, "mode kept", os.FileMode(0640), info.Mode().Perm())
+
+	_, err = writeCoderSSHConfig(sshConfig, "key", workspaces, nil, false, sshStale{})
+	assert.Success(t, "write again", err)
+	again, err := readStr(sshConfig)
+	assert.Success(t, "read ssh config", err)
+	assert.Equal(t, "stable", got, again)
+
+	assert.Success(t, "remove", removeSSHHosts(sshConfig, []string{"frontend"}))
+	assert.Error(t, "remove unknown", removeSSHHosts(sshConfig, []string{"frontend"}))
+	_, err = writeCoderSSHConfig(sshConfig, "key", workspaces, nil, true, sshStale{prune: true})
+	assert.Success(t, "refresh", err)
+	include, err := readSSHInclude(sshIncludePath(sshConfig))
+	assert.Success(t, "read include", err)
+	assert.Equal(t, "removed workspace stays removed", 1, len(include.hosts))
+	assert.Equal(t, "removed", []string{"frontend"}, include.removed)
+}
+
+func Test_configSSHSymlink(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	dotfiles := filepath.Join(dir, "dotfiles")
+	assert.Success(t, "mkdir", os.Mkdir(dotfiles, 0700))
+	target := filepath.Join(dotfiles, "ssh_config")
+	assert.Success(t, "write ssh config", ioutil.WriteFile(target, []byte("Host example\n\tUser me\n"), 0600))
+	sshConfig := filepath.Join(dir, "work_config")
+	assert.Success(t, "symlink", os.Symlink(target, sshConfig))
+
+	workspaces := []coderutil.WorkspaceWithWorkspaceProvider{
+		{Workspace: coder.Workspace{Name: "backend"}, WorkspaceProvider: coder.KubernetesProvider{KubeProviderConfig: coder.KubeProviderConfig{SSHEnabled: true}}},
+	}
+	_, err := writeCoderSSHConfig(sshConfig, "key", workspaces, nil, false, sshStale{})
+	assert.Success(t, "write", err)
+
+	info, err := os.Lstat(sshConfig)
+	assert.Success(t, "lstat ssh config", err)
+	assert.True(t, "symlink kept", info.Mode()&os.ModeSymlink != 0)
+	got, err := readStr(target)
+	assert.Success(t, "read ssh config", err)
+	assert.True(t, "target written", strings.HasPrefix(got, sshStartToken))
+	assert.Equal(t, "include named after the config", filepath.Join(dir, "coder_work_config"), sshIncludePath(sshConfig))
+	_, err = os.Stat(filepath.Join(dir, "coder_work_config"))
+	assert.Success(t, "include written", err)
+}
+
+func Test_makeSSHIncludeStale(t *testing.T) {
+	t.Parallel()
+
+	sshEnabled := coder.KubernetesProvider{KubeProviderConfig: coder.KubeProviderConfig{SSHEnabled: true}}
+	workspaces := []coderutil.WorkspaceWithWorkspaceProvider{
+		{Workspace: coder.Workspace{Name: "backend"}, WorkspaceProvider: sshEnabled},
+		{Workspace: coder.Workspace{Name: "broken"}, WorkspaceProvider: sshEnabled},
+	}
+	previous := sshInclude{hosts: []sshHost{
+		{workspace: "backend", generated: []string{"HostName coder.backend"}},
+		{workspace: "deleted", generated: []string{"HostName coder.deleted"}, custom: []string{"ForwardAgent yes"}},
+	}}
+	neverConnected := map[string]bool{"broken": true}
+
+	include, stale := makeSSHInclude("coder", workspaces, "key", nil, previous, sshStale{neverConnected: neverConnected})
+	assert.Equal(t, "stale hosts", []sshStaleHost{
+		{workspace: "broken", reason: sshStaleNeverConnected},
+		{workspace: "deleted", reason: sshStaleDeleted},
+	}, stale)
+	assert.Equal(t, "stale hosts kept", 3, len(include.hosts))
+	deleted := include.hosts[include.host("deleted")]
+	assert.True(t, "deleted host marked", strings.HasPrefix(deleted.generated[0], sshStalePrefix+sshStaleDeleted))
+	assert.Equal(t, "custom options kept", []string{"ForwardAgent yes"}, deleted.custom)
+	assert.True(t, "broken host marked", strings.HasPrefix(include.hosts[include.host("broken")].generated[0], sshStalePrefix))
+
+	// Marking again doesn't pile up marks.
+	again, _ := makeSSHInclude("coder", workspaces, "key", nil, parseSSHInclude(include.render("/home/me/.ssh/config")), sshStale{neverConnected: neverConnected})
+	assert.Equal(t, "stable", include, again)
+
+	pruned, stale := makeSSHInclude("coder", workspaces, "key", nil, previous, sshStale{neverConnected: neverConnected, prune: true})
+	assert.Equal(t, "pruned", 2, len(stale))
+	assert.Equal(t, "only the live host left", 1, len(pruned.hosts))
+	assert.Equal(t, "live host", "backend", pruned.hosts[0].workspace)
+}
+
+func Test_probeSSHHosts(t *testing.T) {
+	t.Parallel()
+	fake := codertest.New()
+	old := time.Now().Add(-2 * sshNeverConnectedAfter)
+	on := coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOn}
+	var workspaces []coderutil.WorkspaceWithWorkspaceProvider
+	add := func(w coder.Workspace) string {
+		w.ID = fake.AddWorkspace(w)
+		workspaces = append(workspaces, coderutil.WorkspaceWithWorkspaceProvider{Workspace: w})
+		return w.ID
+	}
+	add(coder.Workspace{Name: "broken", CreatedAt: old, LatestStat: on})
+	add(coder.Workspace{Name: "starting", CreatedAt: time.Now(), LatestStat: on})
+	add(coder.Workspace{Name: "stopped", CreatedAt: old, LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOff}})
+	add(coder.Workspace{Name: "used", CreatedAt: old, LastConnectionAt: old, LatestStat: on})
+	id := add(coder.Workspace{Name: "connected", CreatedAt: old, LatestStat: on})
+	fake.AddWorkspaceAgent(id, coder.WorkspaceAgent{ConnectedAt: time.Now()})
+
+	got := probeSSHHosts(context.Background(), fake, workspaces)
+	assert.Equal(t, "never connected", map[string]bool{"broken": true}, got)
+	assert.Equal(t, "only the candidates are checked", 2, len(fake.CallsTo("WorkspaceAgents")))
+}
@@ -0,0 +1,540 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// cpRemoteRx matches the workspace[/agent] prefix of remote paths. Local
+// paths containing a colon can be given as ./path.
+var cpRemoteRx = regexp.MustCompile(`^([a-zA-Z0-9][a-zA-Z0-9_.-]*(?:/[a-zA-Z0-9_.-]+)?):(.*)$`)
+
+// cpPath is a source or destination of "coder cp".
+type cpPath struct {
+	// target is the workspace[/agent] of remote paths, "" for local ones.
+	target string
+	path   string
+}
+
+// parseCPPath parses a local path or a workspace[/agent]:path.
+func parseCPPath(arg string) cpPath {
+	m := cpRemoteRx.FindStringSubmatch(arg)
+	// C:\ is a local path on Windows.
+	if m == nil || (runtime.GOOS == "windows" && len(m[1]) == 1) {
+		return cpPath{path: arg}
+	}
+	return cpPath{target: m[1], path: m[2]}
+}
+
+func cpCmd() *cobra.Command {
+	var (
+		recursive bool
+		container string
+	)
+	cmd := &cobra.Command{
+		Use:   "cp [source]... [destination]",
+		Short: "Copy files between the local machine and a workspace",
+		Long: "Copy files and directories to or from a workspace, like scp, over the same connection as \"coder ssh\", " +
+			"without having to set up \"coder config-ssh\". Remote paths are written workspace:path, or workspace/agent:path " +
+			"for the agents of sidecars, and are relative to the home directory unless absolute.\n\n" +
+			"Either all the sources or the destination are remote. With several sources, the destination must be a directory. " +
+			"Globs are expanded on the side of the sources, so quote remote globs for the local shell to leave them alone.\n\n" +
+			"The workspace needs tar, which the copy is streamed through.",
+		Args: cobra.MinimumNArgs(2),
+		Example: `coder cp notes.txt my-dev:
+coder cp -r ./config my-dev:/home/coder/project/
+coder cp 'my-dev:logs/*.log' ./logs/
+coder cp my-dev/gpu:/tmp/model.bin .`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			sources := make([]cpPath, 0, len(args)-1)
+			for _, arg := range args[:len(args)-1] {
+				sources = append(sources, parseCPPath(arg))
+			}
+			dest := parseCPPath(args[len(args)-1])
+
+			target := dest.target
+			for _, src := range sources {
+				switch {
+				case (src.target == "") == (dest.target == ""):
+					return xerrors.New("either the sources or the destination must be remote, such as my-dev:path")
+				case target == "":
+					target = src.target
+				case src.target != target:
+					return xerrors.New("the sources must all be in the same workspace")
+				}
+			}
+
+			sshClient, closeConn, err := cpConnect(ctx, target, container)
+			if err != nil {
+				return err
+			}
+			defer closeConn()
+
+			progress := newCPProgress(cmd.ErrOrStderr())
+			defer progress.stop()
+			if dest.target != "" {
+				locals := make([]string, 0, len(sources))
+				for _, src := range sources {
+					locals = append(locals, src.path)
+				}
+				err = uploadFiles(sshClient, locals, dest.path, recursive, progress)
+			} else {
+				for _, src := range sources {
+					if err = downloadFiles(sshClient, src.path, dest.path, len(sources) > 1, recursive, progress); err != nil {
+						break
+					}
+				}
+			}
+			progress.stop()
+			if err != nil {
+				return err
+			}
+			clog.LogSuccess(progress.summary())
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "copy directories and their content")
+	cmd.Flags().StringVar(&container, "container", "", "copy to or from another container of the workspace, as served by the agent with --container")
+	return cmd
+}
+
+// cpConnect connects to the SSH server of the workspace[/agent] target
+// through the agent, and returns a func closing the connection.
+func cpConnect(ctx context.Context, target, container string) (*ssh.Client, func(), error) {
+	client, err := newClient(ctx, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	me, err := client.Me(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	workspaceName, agent, err := splitAgentTarget(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	workspace, err := findWorkspace(ctx, client, workspaceName, coder.Me)
+	if err != nil {
+		return nil, nil, err
+	}
+	if workspace.LatestStat.ContainerStatus != coder.WorkspaceOn {
+		return nil, nil, diagnoseWorkspace(ctx, client, workspace)
+	}
+	if err := findAgent(ctx, client, workspace, agent); err != nil {
+		return nil, nil, err
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("get user home directory: %w", err)
+	}
+	privateKeyPath := filepath.Join(usr.HomeDir, ".ssh", "coder_enterprise")
+	if err := writeSSHKey(ctx, client, privateKeyPath); err != nil {
+		return nil, nil, err
+	}
+
+	s, closeDialer, err := newNativeSSHSession(ctx, client, workspace, agent, container, me.Username, privateKeyPath)
+	if err == nil {
+		var sshClient *ssh.Client
+		if sshClient, err = s.connect(ctx); err == nil {
+			return sshClient, func() {
+				_ = sshClient.Close()
+				closeDialer()
+			}, nil
+		}
+		closeDialer()
+	}
+	var connectErr nativeSSHConnectError
+	if xerrors.As(err, &connectErr) {
+		if err := diagnoseWorkspace(ctx, client, workspace); err != nil {
+			clog.Log(err)
+		}
+	}
+	return nil, nil, err
+}
+
+// remoteShellPath quotes a remote path for the shell, leaving a leading ~
+// to be expanded.
+func remoteShellPath(p string) string {
+	switch {
+	case p == "~":
+		return p
+	case strings.HasPrefix(p, "~/"):
+		return "~/" + posixQuote(p[2:])
+	default:
+		return posixQuote(p)
+	}
+}
+
+// remoteShellGlob is like remoteShellPath, but leaves the glob characters
+// of p to be expanded.
+func remoteShellGlob(p string) string {
+	var b strings.Builder
+	for len(p) > 0 {
+		i := strings.IndexAny(p, "*?[]")
+		if i < 0 {
+			b.WriteString(posixQuote(p))
+			break
+		}
+		if i > 0 {
+			b.WriteString(posixQuote(p[:i]))
+		}
+		b.WriteByte(p[i])
+		p = p[i+1:]
+	}
+	return b.String()
+}
+
+// runRemote runs the command in a new session, with stdin and stdout if
+// they aren't nil, and returns its exit status. Its stderr is returned in
+// the error of failed commands.
+func runRemote(client *ssh.Client, command string, stdin io.Reader, stdout io.Writer) (int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, xerrors.Errorf("open session: %w", err)
+	}
+	defer session.Close()
+	var stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = &stderr
+	err = session.Run(command)
+	var exitErr *ssh.ExitError
+	if xerrors.As(err, &exitErr) {
+		msg := strings.TrimSpace(stderr.String())
+		if exitErr.ExitStatus() == 127 {
+			return 127, clog.Error("the workspace is missing tar", msg, clog.BlankLine, clog.Tipf("install tar in the image of the workspace"))
+		}
+		if msg == "" {
+			msg = fmt.Sprintf("exit status %d", exitErr.ExitStatus())
+		}
+		return exitErr.ExitStatus(), xerrors.New(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// uploadFiles copies the local sources to dest in the workspace, as a tar
+// archive extracted by the workspace.
+func uploadFiles(client *ssh.Client, sources []string, dest string, recursive bool, progress *cpProgress) error {
+	var files []string
+	for _, src := range sources {
+		matches, err := filepath.Glob(src)
+		if err != nil {
+			return xerrors.Errorf("glob %s: %w", src, err)
+		}
+		if len(matches) == 0 {
+			return xerrors.Errorf("%s: no such file or directory", src)
+		}
+		for _, m := range matches {
+			info, err := os.Lstat(m)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && !recursive {
+				return xerrors.Errorf("%s is a directory, use -r to copy it", m)
+			}
+		}
+		files = append(files, matches...)
+	}
+
+	if dest == "" {
+		dest = "."
+	}
+	status, err := runRemote(client, "test -d "+remoteShellPath(dest), nil, nil)
+	if err != nil && status != 1 {
+		return xerrors.Errorf("check destination: %w", err)
+	}
+	destIsDir := status == 0
+	dir, names := dest, make([]string, len(files))
+	for i, f := range files {
+		names[i] = filepath.Base(f)
+	}
+	if !destIsDir {
+		if len(files) > 1 {
+			return xerrors.Errorf("%s isn't a directory of the workspace", dest)
+		}
+		dir, names[0] = path.Dir(dest), path.Base(dest)
+	}
+
+	pr, pw := io.Pipe()
+	archived := make(chan error, 1)
+	go func() {
+		err := writeTar(pw, files, names, progress)
+		archived <- err
+		_ = pw.CloseWithError(err)
+	}()
+	_, err = runRemote(client, "tar -xf - -C "+remoteShellPath(dir), pr, nil)
+	_ = pr.CloseWithError(io.ErrClosedPipe)
+	// A local failure cuts the archive short, which the remote tar then
+	// fails on.
+	if archiveErr := <-archived; archiveErr != nil && !xerrors.Is(archiveErr, io.ErrClosedPipe) {
+		return xerrors.Errorf("archive: %w", archiveErr)
+	}
+	if err != nil {
+		return xerrors.Errorf("extract in the workspace: %w", err)
+	}
+	return nil
+}
+
+// writeTar archives the files under the names, and the content of the
+// directories among them.
+func writeTar(w io.Writer, files, names []string, progress *cpProgress) error {
+	tw := tar.NewWriter(w)
+	for i, file := range files {
+		err := filepath.Walk(file, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(file, p)
+			if err != nil {
+				return err
+			}
+			name := path.Join(names[i], filepath.ToSlash(rel))
+			var link string
+			if info.Mode()&os.ModeSymlink != 0 {
+				if link, err = os.Readlink(p); err != nil {
+					return err
+				}
+			}
+			hdr, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			hdr.Name = name
+			if info.IsDir() {
+				hdr.Name += "/"
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(tw, progress.file(name, f))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// downloadFiles copies the remote source, which may be a glob, to the local
+// dest. With several sources, dest must be a directory.
+func downloadFiles(client *ssh.Client, src, dest string, several, recursive bool, progress *cpProgress) error {
+	if src == "" || src == "." || src == "~" {
+		return xerrors.New("the remote source must name a file or directory")
+	}
+	info, err := os.Stat(dest)
+	destIsDir := err == nil && info.IsDir()
+	if !destIsDir && several {
+		return xerrors.Errorf("%s isn't a directory", dest)
+	}
+
+	src = strings.TrimSuffix(src, "/")
+	command := fmt.Sprintf("cd %s && tar -cf - -- %s", remoteShellPath(path.Dir(src)), remoteShellGlob(path.Base(src)))
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := runRemote(client, command, nil, pw)
+		// Sent first, for a failure of the remote tar to be told apart
+		// from one extracting.
+		done <- err
+		_ = pw.CloseWithError(err)
+	}()
+	err = extractTar(pr, dest, destIsDir, recursive, progress)
+	if err == nil {
+		// tar pads archives past their end.
+		_, _ = io.Copy(ioutil.Discard, pr)
+		if remoteErr := <-done; remoteErr != nil {
+			return xerrors.Errorf("archive in the workspace: %w", remoteErr)
+		}
+		return nil
+	}
+	select {
+	case remoteErr := <-done:
+		if remoteErr != nil {
+			return xerrors.Errorf("archive in the workspace: %w", remoteErr)
+		}
+	default:
+		// The remote tar is stopped when the connection is closed.
+		_ = pr.CloseWithError(err)
+	}
+	return err
+}
+
+// extractTar extracts the archive into dest if destIsDir, or else to dest
+// itself, which the single top-level entry of the archive is renamed to.
+func extractTar(r io.Reader, dest string, destIsDir, recursive bool, progress *cpProgress) error {
+	tr := tar.NewReader(r)
+	var top string
+	for {
+		hdr, err := tr.Next()
+		if xerrors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return xerrors.Errorf("refusing to extract %q outside of the destination", hdr.Name)
+		}
+		entryTop := strings.SplitN(name, "/", 2)[0]
+		if hdr.Typeflag == tar.TypeDir && name == entryTop && !recursive {
+			return xerrors.Errorf("%s is a directory, use -r to copy it", name)
+		}
+		if top != "" && entryTop != top && !destIsDir {
+			return xerrors.Errorf("%s isn't a directory", dest)
+		}
+		top = entryTop
+
+		target := filepath.Join(dest, filepath.FromSlash(name))
+		if !destIsDir {
+			target = filepath.Join(dest, filepath.FromSlash(strings.TrimPrefix(name, entryTop)))
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, hdr.FileInfo().Mode().Perm()|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := writeCPFile(target, hdr, progress.file(name, tr)); err != nil {
+				return err
+			}
+		default:
+			// Links could point outside of the destination, where later
+			// entries would then be written.
+			clog.LogWarn(i18n.Sprintf("skipping %s, which isn't a regular file or directory", name))
+		}
+	}
+}
+
+func writeCPFile(target string, hdr *tar.Header, r io.Reader) error {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+}
+
+// cpProgress counts the files and bytes copied, showing the file being
+// copied on terminals.
+type cpProgress struct {
+	w     io.Writer
+	start time.Time
+
+	mu      sync.Mutex
+	files   int
+	bytes   uint64
+	current string
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newCPProgress(w io.Writer) *cpProgress {
+	p := &cpProgress{w: w, start: time.Now(), done: make(chan struct{})}
+	if showInteractiveOutput {
+		go p.show()
+	} else {
+		close(p.done)
+	}
+	return p
+}
+
+func (p *cpProgress) show() {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			_, _ = fmt.Fprint(p.w, "\r\033[K")
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		line := fmt.Sprintf("\r\033[Kcopying %s  %s", p.current, formatBytes(p.bytes))
+		p.mu.Unlock()
+		_, _ = fmt.Fprint(p.w, line)
+	}
+}
+
+// file counts the bytes read from r as those of the file.
+func (p *cpProgress) file(name string, r io.Reader) io.Reader {
+	p.mu.Lock()
+	p.files++
+	p.current = name
+	p.mu.Unlock()
+	return cpCountingReader{r: r, p: p}
+}
+
+func (p *cpProgress) stop() {
+	p.once.Do(func() {
+		if showInteractiveOutput {
+			close(p.done)
+		}
+	})
+}
+
+func (p *cpProgress) summary() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	noun := "files"
+	if p.files == 1 {
+		noun = "file"
+	}
+	return fmt.Sprintf("copied %d %s (%s) in %s", p.files, noun, formatBytes(p.bytes), time.Since(p.start).Round(time.Millisecond))
+}
+
+type cpCountingReader struct {
+	r io.Reader
+	p *cpProgress
+}
+
+func (c cpCountingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.p.mu.Lock()
+	c.p.bytes += uint64(n)
+	c.p.mu.Unlock()
+	return n, err
+}
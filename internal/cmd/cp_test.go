@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func Test_parseCPPath(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "remote", cpPath{target: "my-dev", path: "/tmp/x"}, parseCPPath("my-dev:/tmp/x"))
+	assert.Equal(t, "agent", cpPath{target: "my-dev/gpu", path: "model.bin"}, parseCPPath("my-dev/gpu:model.bin"))
+	assert.Equal(t, "home", cpPath{target: "my-dev", path: ""}, parseCPPath("my-dev:"))
+	assert.Equal(t, "local", cpPath{path: "notes.txt"}, parseCPPath("notes.txt"))
+	assert.Equal(t, "local with colon", cpPath{path: "./a:b"}, parseCPPath("./a:b"))
+}
+
+func Test_remoteShellGlob(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "plain", `'notes.txt'`, remoteShellGlob("notes.txt"))
+	assert.Equal(t, "glob", `'it'\''s '*'.log'`, remoteShellGlob("it's *.log"))
+	assert.Equal(t, "home", `~/'my dir'`, remoteShellPath("~/my dir"))
+}
+
+func Test_cp(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("the test server runs commands with sh")
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.Success(t, "generate key", err)
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.Success(t, "signer", err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s := &nativeSSHSession{
+		log:     slogtest.Make(t, nil),
+		dialer:  directDialer{},
+		network: "tcp",
+		addr:    serveTestSSH(t, signer.PublicKey(), shellSSHCommand),
+		user:    "coder",
+		signer:  signer,
+	}
+	client, err := s.connect(ctx)
+	assert.Success(t, "connect", err)
+	defer client.Close()
+
+	local, remote := t.TempDir(), t.TempDir()
+	write := func(path, content string) {
+		assert.Success(t, "mkdir", os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Success(t, "write", ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	read := func(path string) string {
+		raw, err := ioutil.ReadFile(path)
+		assert.Success(t, "read", err)
+		return string(raw)
+	}
+	write(filepath.Join(local, "project", "main.go"), "package main\n")
+	write(filepath.Join(local, "project", "sub", "notes.txt"), "notes\n")
+	write(filepath.Join(local, "a.log"), "a\n")
+	write(filepath.Join(local, "b.log"), "b\n")
+	progress := newCPProgress(ioutil.Discard)
+	defer progress.stop()
+
+	err = uploadFiles(client, []string{filepath.Join(local, "project")}, remote, false, progress)
+	assert.ErrorContains(t, "directory needs -r", err, "use -r")
+	err = uploadFiles(client, []string{filepath.Join(local, "project")}, remote, true, progress)
+	assert.Success(t, "upload directory", err)
+	assert.Equal(t, "uploaded", "notes\n", read(filepath.Join(remote, "project", "sub", "notes.txt")))
+	err = uploadFiles(client, []string{filepath.Join(local, "*.log")}, remote, false, progress)
+	assert.Success(t, "upload glob", err)
+	assert.Equal(t, "uploaded glob", "b\n", read(filepath.Join(remote, "b.log")))
+	err = uploadFiles(client, []string{filepath.Join(local, "a.log")}, filepath.Join(remote, "renamed.log"), false, progress)
+	assert.Success(t, "upload renamed", err)
+	assert.Equal(t, "renamed", "a\n", read(filepath.Join(remote, "renamed.log")))
+
+	back := t.TempDir()
+	err = downloadFiles(client, filepath.Join(remote, "project"), back, false, false, progress)
+	assert.ErrorContains(t, "directory needs -r", err, "use -r")
+	err = downloadFiles(client, filepath.Join(remote, "project"), filepath.Join(back, "copy"), false, true, progress)
+	assert.Success(t, "download directory", err)
+	assert.Equal(t, "downloaded renamed", "package main\n", read(filepath.Join(back, "copy", "main.go")))
+	err = downloadFiles(client, filepath.Join(remote, "*.log"), back, false, false, progress)
+	assert.Success(t, "download glob", err)
+	assert.Equal(t, "downloaded glob", "a\n", read(filepath.Join(back, "renamed.log")))
+	err = downloadFiles(client, filepath.Join(remote, "*.log"), filepath.Join(back, "one.log"), false, false, progress)
+	assert.ErrorContains(t, "several files to a file", err, "isn't a directory")
+	err = downloadFiles(client, filepath.Join(remote, "missing"), back, false, false, progress)
+	assert.ErrorContains(t, "missing", err, "archive in the workspace")
+}
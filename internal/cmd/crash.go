@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/version"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// crashReportsDir is the subdirectory of the config dir crash reports are
+// written to, for "coder bug-report".
+const crashReportsDir = "crash-reports"
+
+// maxCrashReports bounds how many crash reports are kept, the oldest being
+// removed first.
+const maxCrashReports = 10
+
+// crashReport describes a panic of the CLI. It's redacted, so that it can be
+// attached to issues: secrets passed as arguments are removed, and the
+// config files are only described by a digest of their content.
+type crashReport struct {
+	Time      time.Time `json:"time"`
+	Version   string    `json:"version"`
+	GoVersion string    `json:"go_version"`
+	Platform  string    `json:"platform"`
+	Command   string    `json:"command"`
+	Args      []string  `json:"args"`
+	Panic     string    `json:"panic"`
+	Stack     string    `json:"stack"`
+	// Config describes each config file by the size and SHA-256 prefix of
+	// its content, or as absent.
+	Config map[string]string `json:"config"`
+}
+
+// crashConfigFiles are the config files described in crash reports.
+var crashConfigFiles = []config.File{
+	config.Session, config.URL, config.ProxyPAC, config.ProxyAuth, config.SSHAutoRefresh,
+	config.CredentialHelper, config.AuditHeaders, config.DeprecationWarnings, config.TrustedIdentities,
+	config.AgentIdentityKey, config.DefaultWorkspace, config.UpdateChannel, config.SyncMappings, config.VersionChecks,
+	config.TableColumns,
+}
+
+// RecoverCrash writes a crash report when the CLI panics, and exits. It must
+// be deferred by main, so that it recovers panics of the main goroutine.
+func RecoverCrash() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	report := newCrashReport(r, debug.Stack(), os.Args[1:], time.Now())
+	path, err := writeCrashReport(report)
+	if err != nil {
+		clog.Log(clog.Fatal(i18n.Sprintf("coder crashed: %v", r),
+			clog.Causef("write crash report: %v", err),
+			clog.BlankLine,
+			report.Stack,
+		))
+		os.Exit(2)
+	}
+	clog.Log(clog.Fatal(i18n.Sprintf("coder crashed: %v", r),
+		fmt.Sprintf("a crash report was written to %s", path),
+		clog.BlankLine,
+		clog.Tipf("run \"coder bug-report\" to bundle it for an issue at https://github.com/cdr/coder-cli/issues"),
+	))
+	os.Exit(2)
+}
+
+func newCrashReport(r interface{}, stack []byte, args []string, now time.Time) crashReport {
+	report := crashReport{
+		Time:      now,
+		Version:   version.Version,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Command:   invokedCommand,
+		Args:      redactArgs(args),
+		Panic:     fmt.Sprint(r),
+		Stack:     string(stack),
+		Config:    make(map[string]string),
+	}
+	for _, f := range crashConfigFiles {
+		report.Config[string(f)] = configDigest(f)
+	}
+	return report
+}
+
+// secretFlag matches the names of flags taking secrets.
+var secretFlag = regexp.MustCompile(`(?i)^--?[a-z-]*(token|password|secret|key|auth)[a-z-]*$`)
+
+// redactArgs removes the values of flags taking secrets, and the credentials
+// and query strings of URLs, from the arguments.
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		switch {
+		case i > 0 && secretFlag.MatchString(args[i-1]) && !strings.HasPrefix(arg, "-"):
+			redacted[i] = "REDACTED"
+		case strings.Contains(arg, "=") && secretFlag.MatchString(strings.SplitN(arg, "=", 2)[0]):
+			redacted[i] = strings.SplitN(arg, "=", 2)[0] + "=REDACTED"
+		default:
+			redacted[i] = redactURL(arg)
+		}
+	}
+	return redacted
+}
+
+func redactURL(arg string) string {
+	u, err := url.Parse(arg)
+	if err != nil || u.Scheme == "" || u.Host == "" || (u.User == nil && u.RawQuery == "") {
+		return arg
+	}
+	if u.User != nil {
+		u.User = url.User("REDACTED")
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "REDACTED"
+	}
+	return u.String()
+}
+
+func configDigest(f config.File) string {
+	content, err := f.Read()
+	if os.IsNotExist(err) {
+		return "absent"
+	}
+	if err != nil {
+		return "unreadable"
+	}
+	sum := sha256.Sum256([]byte(content))
+	return fmt.Sprintf("%d bytes, sha256 %x", len(content), sum[:6])
+}
+
+// writeCrashReport writes the report to the crash reports directory, and
+// removes the oldest reports beyond maxCrashReports.
+func writeCrashReport(report crashReport) (string, error) {
+	dir, err := config.Dir(crashReportsDir)
+	if err != nil {
+		return "", xerrors.Errorf("create crash reports directory: %w", err)
+	}
+	raw, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", xerrors.Errorf("encode crash report: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("crash-%s.json", report.Time.UTC().Format("20060102T150405.000000000")))
+	if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+		return "", xerrors.Errorf("write crash report: %w", err)
+	}
+	reports, err := crashReports()
+	if err == nil && len(reports) > maxCrashReports {
+		for _, old := range reports[maxCrashReports:] {
+			_ = os.Remove(old) // Best effort, it's removed with the next report otherwise.
+		}
+	}
+	return path, nil
+}
+
+// crashReports returns the paths of the crash reports, newest first.
+func crashReports() ([]string, error) {
+	dir, err := config.Dir(crashReportsDir)
+	if err != nil {
+		return nil, xerrors.Errorf("create crash reports directory: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "crash-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	// The names sort by the time of the crash.
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	return paths, nil
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// credentialHelperEnv overrides the credential helper set with
+// "coder login --credential-helper".
+const credentialHelperEnv = "CODER_CREDENTIAL_HELPER"
+
+// credentialHelperTimeout bounds how long a helper may take, which includes
+// any interactive sign in it needs.
+const credentialHelperTimeout = 2 * time.Minute
+
+// Credential helpers are external programs that hand out session tokens,
+// such as wrappers around Vault, 1Password or a company SSO, so that no
+// long-lived token is stored locally. They follow the protocol of git
+// credential helpers: the helper is run with an action as its last
+// argument, and key=value lines terminated by a blank line are exchanged
+// over stdin and stdout. Like git, the helper is run by the shell, so paths
+// with spaces must be quoted.
+//
+//   get    receives url, and answers with token, and url if it wasn't given.
+//   erase  receives url, and should forget any cached token.
+//
+// The helper's stderr is passed through, so it can prompt the user there.
+
+// credentialHelper returns the configured credential helper command, if any.
+func credentialHelper() string {
+	if helper := os.Getenv(credentialHelperEnv); helper != "" {
+		return strings.TrimSpace(helper)
+	}
+	helper, _ := config.CredentialHelper.Read()
+	return strings.TrimSpace(helper)
+}
+
+// helperCredentials caches what the credential helper answered for the rest
+// of the process, so commands that create several clients only run it once.
+var helperCredentials = struct {
+	sync.Mutex
+	m map[[2]string][2]string
+}{m: make(map[[2]string][2]string)}
+
+// helperSessionCredentials gets the session token, and the Coder URL if
+// rawURL is empty, from the credential helper.
+func helperSessionCredentials(ctx context.Context, helper, rawURL string) (sessionToken, _ string, err error) {
+	key := [2]string{helper, rawURL}
+	helperCredentials.Lock()
+	defer helperCredentials.Unlock()
+	if cached, ok := helperCredentials.m[key]; ok {
+		return cached[0], cached[1], nil
+	}
+
+	in := map[string]string{}
+	if rawURL != "" {
+		in["url"] = rawURL
+	}
+	out, err := runCredentialHelper(ctx, helper, "get", in)
+	if err != nil {
+		return "", "", err
+	}
+	if rawURL == "" {
+		rawURL = out["url"]
+	}
+	switch {
+	case out["token"] == "":
+		return "", "", clog.Error("the credential helper returned no token",
+			fmt.Sprintf("helper: %s", helper),
+			clog.BlankLine,
+			clog.Hintf(`the helper must print a "token=<session token>" line`),
+		)
+	case rawURL == "":
+		return "", "", clog.Error("no Coder URL is configured",
+			clog.BlankLine,
+			clog.Tipf(`run "coder login --credential-helper %s <Coder URL>", or have the helper print a "url=<Coder URL>" line`, helper),
+		)
+	}
+	helperCredentials.m[key] = [2]string{out["token"], rawURL}
+	return out["token"], rawURL, nil
+}
+
+// runCredentialHelper runs the helper with the action, sending it the
+// attributes and returning the ones it answers with.
+func runCredentialHelper(ctx context.Context, helper, action string, attrs map[string]string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, credentialHelperTimeout)
+	defer cancel()
+
+	if strings.TrimSpace(helper) == "" {
+		return nil, xerrors.New("empty credential helper")
+	}
+	if action == "erase" {
+		helperCredentials.Lock()
+		helperCredentials.m = make(map[[2]string][2]string)
+		helperCredentials.Unlock()
+	}
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", helper+` "$@"`, helper, action)
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", helper+" "+action)
+	}
+	cmd.Stdin = strings.NewReader(formatCredentialAttrs(attrs))
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, clog.Error(i18n.Sprintf("the credential helper failed to %s credentials", action),
+			fmt.Sprintf("helper: %s", helper),
+			clog.Causef(err.Error()),
+		)
+	}
+	return parseCredentialAttrs(&stdout), nil
+}
+
+// formatCredentialAttrs formats the attributes as sorted key=value lines
+// terminated by a blank line.
+func formatCredentialAttrs(attrs map[string]string) string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", k, attrs[k])
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// parseCredentialAttrs parses key=value lines up to a blank line or the end
+// of r. Malformed lines are ignored.
+func parseCredentialAttrs(r io.Reader) map[string]string {
+	attrs := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		attrs[kv[0]] = kv[1]
+	}
+	return attrs
+}
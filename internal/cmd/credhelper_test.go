@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_credentialAttrs(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "format", "token=abc\nurl=https://coder.example.com\n\n",
+		formatCredentialAttrs(map[string]string{"url": "https://coder.example.com", "token": "abc"}))
+
+	attrs := parseCredentialAttrs(strings.NewReader("token=a=b\r\nmalformed\nurl=https://coder.example.com\n\nignored=true\n"))
+	assert.Equal(t, "parse", map[string]string{"token": "a=b", "url": "https://coder.example.com"}, attrs)
+}
+
+func Test_helperSessionCredentials(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("the test helper is a shell script")
+	}
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "coder credhelper")
+	assert.Success(t, "create temp dir", err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	// The helper answers with a token derived from the URL it's given, and
+	// with its own URL if it isn't given one. Its path has a space, so it's
+	// quoted like it would be for git.
+	path := filepath.Join(dir, "helper")
+	helper := "'" + path + "'"
+	calls := filepath.Join(dir, "calls")
+	assert.Success(t, "write helper", ioutil.WriteFile(path, []byte(`#!/bin/sh
+echo "$2" >> "$(dirname "$0")/calls"
+[ "$2" = get ] || exit 1
+url=
+while read -r line && [ -n "$line" ]; do
+	case "$line" in url=*) url="${line#url=}" ;; esac
+done
+if [ -z "$url" ]; then
+	echo "url=https://default.example.com"
+	url=default
+fi
+echo "token=$1-$url"
+`), 0755))
+
+	token, rawURL, err := helperSessionCredentials(ctx, helper+" vault", "https://coder.example.com")
+	assert.Success(t, "get with url", err)
+	assert.Equal(t, "token", "vault-https://coder.example.com", token)
+	assert.Equal(t, "url", "https://coder.example.com", rawURL)
+
+	token, rawURL, err = helperSessionCredentials(ctx, helper+" vault", "")
+	assert.Success(t, "get without url", err)
+	assert.Equal(t, "token", "vault-default", token)
+	assert.Equal(t, "url from helper", "https://default.example.com", rawURL)
+
+	_, _, err = helperSessionCredentials(ctx, helper+" vault", "https://coder.example.com")
+	assert.Success(t, "cached get", err)
+	got, err := ioutil.ReadFile(calls)
+	assert.Success(t, "read calls", err)
+	assert.Equal(t, "helper runs once per url", "get\nget\n", string(got))
+
+	_, err = runCredentialHelper(ctx, helper+" vault", "erase", nil)
+	assert.Error(t, "failing helper", err)
+
+	_, _, err = helperSessionCredentials(ctx, "true", "https://coder.example.com")
+	assert.Error(t, "no token", err)
+}
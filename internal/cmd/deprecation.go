@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// deprecationWarningInterval is how often the same deprecation is warned
+// about, so that scripts calling coder repeatedly aren't flooded.
+const deprecationWarningInterval = 24 * time.Hour
+
+// deprecationWarnings guards config.DeprecationWarnings, since requests are
+// often made concurrently.
+var deprecationWarnings sync.Mutex
+
+// warnDeprecation warns that the API used by the request is deprecated,
+// unless it was already warned about within deprecationWarningInterval.
+func warnDeprecation(d coder.Deprecation) {
+	deprecationWarnings.Lock()
+	defer deprecationWarnings.Unlock()
+
+	// Deprecations are told apart by their link, since paths hold IDs.
+	key := d.Link
+	if key == "" {
+		key = d.Method + " " + d.Path
+	}
+	warned := make(map[string]time.Time)
+	if raw, err := config.DeprecationWarnings.Read(); err == nil {
+		_ = json.Unmarshal([]byte(raw), &warned)
+	}
+	now := time.Now()
+	if now.Sub(warned[key]) < deprecationWarningInterval {
+		return
+	}
+	warned[key] = now
+	for k, t := range warned {
+		if now.Sub(t) >= deprecationWarningInterval {
+			delete(warned, k)
+		}
+	}
+	if raw, err := json.Marshal(warned); err == nil {
+		_ = config.DeprecationWarnings.Write(string(raw))
+	}
+
+	var lines []string
+	if !d.Sunset.IsZero() {
+		verb := "will stop"
+		if now.After(d.Sunset) {
+			verb = "may stop"
+		}
+		lines = append(lines, fmt.Sprintf("it %s working on %s", verb, d.Sunset.Format("2006-01-02")))
+	}
+	lines = append(lines, clog.BlankLine)
+	if d.Link != "" {
+		lines = append(lines, clog.Tipf("see %s for what to change", d.Link))
+	}
+	lines = append(lines, clog.Tipf(`run "coder update" to get the CLI version matching your deployment`))
+	clog.LogWarn(i18n.Sprintf("the API used by this command is deprecated (%s %s)", d.Method, d.Path), lines...)
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// Not parallel: the warnings are recorded in the config dir and logged to
+// the clog output of the package.
+func Test_warnDeprecation(t *testing.T) {
+	var buf bytes.Buffer
+	clog.SetOutput(&buf)
+	t.Cleanup(func() {
+		clog.SetOutput(os.Stderr)
+		_ = config.DeprecationWarnings.Delete()
+	})
+
+	d := coder.Deprecation{
+		Method: "GET",
+		Path:   "/api/v0/workspaces/abc",
+		Sunset: time.Date(2099, 1, 2, 0, 0, 0, 0, time.UTC),
+		Link:   "https://coder.com/docs/changelog",
+	}
+	warnDeprecation(d)
+	assert.True(t, "warned", strings.Contains(buf.String(), "deprecated (GET /api/v0/workspaces/abc)"))
+	assert.True(t, "sunset", strings.Contains(buf.String(), "will stop working on 2099-01-02"))
+	assert.True(t, "link", strings.Contains(buf.String(), "see https://coder.com/docs/changelog"))
+
+	// The same deprecation for another workspace isn't warned about again.
+	buf.Reset()
+	d.Path = "/api/v0/workspaces/def"
+	warnDeprecation(d)
+	assert.Equal(t, "warned once", "", buf.String())
+
+	d.Link = ""
+	warnDeprecation(d)
+	assert.True(t, "other deprecation warned", strings.Contains(buf.String(), "deprecated"))
+}
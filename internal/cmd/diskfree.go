@@ -0,0 +1,25 @@
+// +build !windows
+
+package cmd
+
+import "golang.org/x/sys/unix"
+
+// diskFree returns the bytes available to the user on the filesystem of dir.
+func diskFree(dir string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// diskUsage returns the size of the filesystem of dir and the bytes used on
+// it, counting what's reserved for root as free like df does.
+func diskUsage(dir string) (total, used uint64, err error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, 0, err
+	}
+	used = (uint64(st.Blocks) - uint64(st.Bfree)) * uint64(st.Bsize)
+	return used + uint64(st.Bavail)*uint64(st.Bsize), used, nil
+}
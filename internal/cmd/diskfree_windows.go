@@ -0,0 +1,31 @@
+// +build windows
+
+package cmd
+
+import "golang.org/x/sys/windows"
+
+// diskFree returns the bytes available to the user on the volume of dir.
+func diskFree(dir string) (uint64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
+
+// diskUsage returns the size of the volume of dir and the bytes used on it.
+func diskUsage(dir string) (total, used uint64, err error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, nil, &total, &free); err != nil {
+		return 0, 0, err
+	}
+	return total, total - free, nil
+}
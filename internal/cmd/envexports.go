@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+// sessionTokenEnv is exported alongside tokenEnv for tools that follow the
+// naming used by the Coder API documentation.
+const sessionTokenEnv = "CODER_SESSION_TOKEN"
+
+func envExportsCmd() *cobra.Command {
+	var shellName string
+	cmd := &cobra.Command{
+		Use:   "env-exports",
+		Short: "Print shell exports of the active session's credentials",
+		Long: "Print the URL and session token of the active session as shell variable exports, " +
+			"so other tools that speak the Coder API can reuse the CLI's authentication.\n\n" +
+			"The output contains your session token. Don't paste it anywhere it could be logged.",
+		Example: `# bash / zsh
+eval "$(coder env-exports)"
+
+# fish
+coder env-exports --shell fish | source
+
+# PowerShell
+coder env-exports --shell powershell | Invoke-Expression`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, rawURL, err := sessionCredentials(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if shellName == "" {
+				shellName = detectShell()
+			}
+			out, err := formatExports(shellName, [][2]string{
+				{urlEnv, rawURL},
+				{tokenEnv, token},
+				{sessionTokenEnv, token},
+			})
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprint(cmd.OutOrStdout(), out)
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&shellName, "shell", "", "syntax to print: sh | fish | powershell | cmd (detected from the environment by default)")
+	completeFlagChoices(cmd, "shell", "sh", "fish", "powershell", "cmd")
+	return cmd
+}
+
+// detectShell guesses the syntax the exports should be printed in.
+func detectShell() string {
+	if sh := filepath.Base(os.Getenv("SHELL")); sh == "fish" {
+		return "fish"
+	}
+	if runtime.GOOS == "windows" && os.Getenv("SHELL") == "" {
+		return "powershell"
+	}
+	return "sh"
+}
+
+func formatExports(shellName string, vars [][2]string) (string, error) {
+	var b strings.Builder
+	for _, v := range vars {
+		switch shellName {
+		case "sh", "bash", "zsh":
+			fmt.Fprintf(&b, "export %s=%s\n", v[0], posixQuote(v[1]))
+		case "fish":
+			fmt.Fprintf(&b, "set -gx %s %s;\n", v[0], posixQuote(v[1]))
+		case "powershell", "pwsh":
+			fmt.Fprintf(&b, "$env:%s = '%s'\n", v[0], strings.ReplaceAll(v[1], "'", "''"))
+		case "cmd":
+			fmt.Fprintf(&b, "set \"%s=%s\"\n", v[0], v[1])
+		default:
+			return "", xerrors.Errorf("%q is not a supported value for --shell", shellName)
+		}
+	}
+	return b.String(), nil
+}
+
+// posixQuote single-quotes s for POSIX shells and fish.
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
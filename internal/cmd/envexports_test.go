@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_formatExports(t *testing.T) {
+	t.Parallel()
+
+	vars := [][2]string{{"CODER_URL", "https://coder.example.com"}, {"CODER_TOKEN", "it's"}}
+	tests := []struct {
+		shell string
+		want  string
+	}{
+		{"sh", "export CODER_URL='https://coder.example.com'\nexport CODER_TOKEN='it'\\''s'\n"},
+		{"fish", "set -gx CODER_URL 'https://coder.example.com';\nset -gx CODER_TOKEN 'it'\\''s';\n"},
+		{"powershell", "$env:CODER_URL = 'https://coder.example.com'\n$env:CODER_TOKEN = 'it''s'\n"},
+		{"cmd", "set \"CODER_URL=https://coder.example.com\"\nset \"CODER_TOKEN=it's\"\n"},
+	}
+	for _, test := range tests {
+		got, err := formatExports(test.shell, vars)
+		assert.Success(t, test.shell, err)
+		assert.Equal(t, test.shell, test.want, got)
+	}
+
+	_, err := formatExports("tcsh", vars)
+	assert.Error(t, "unsupported shell", err)
+}
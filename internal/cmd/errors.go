@@ -2,11 +2,11 @@ package cmd
 
 import (
 	"encoding/json"
-	"fmt"
 
 	"golang.org/x/xerrors"
 
 	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/pkg/clog"
 )
 
@@ -61,7 +61,7 @@ func handleAPIError(origError error) error {
 			return origError
 		}
 
-		return clog.Error(fmt.Sprintf("Precondition Error : Status Code=%d", httpError.StatusCode()),
+		return clog.Error(i18n.Sprintf("Precondition Error : Status Code=%d", httpError.StatusCode()),
 			p.Message,
 			clog.BlankLine,
 			clog.Tipf(p.Solution))
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// execOptions are the flags of "coder exec".
+type execOptions struct {
+	stdin     bool
+	tty       bool
+	env       []string
+	workdir   string
+	container string
+	workspace string
+}
+
+func execCmd() *cobra.Command {
+	var opts execOptions
+	cmd := &cobra.Command{
+		Use:   "exec [workspace_name[/agent]] -- <command> [args...]",
+		Short: "Run a command in a workspace",
+		Long: "Run a command in a workspace and exit with its exit code, like kubectl exec. The command connects " +
+			"through the agent, like \"coder ssh\" without an ssh binary, so it works in CI jobs without any setup.\n\n" +
+			"The command and its arguments are passed as is, without being interpreted by a shell; " +
+			"run \"sh -c\" to use one. Stdin isn't read unless -i is given, and -t allocates a terminal, " +
+			"so \"-it\" runs interactive programs.\n\n" +
+			"Without workspace_name, the workspace given with --workspace, or else the default workspace set with " +
+			"\"coder config set default-workspace\", is used.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if cmd.ArgsLenAtDash() < 0 {
+				return xerrors.New("the command must follow \"--\", such as \"coder exec my-dev -- make test\"")
+			}
+			if cmd.ArgsLenAtDash() == len(args) {
+				return xerrors.New("missing <command> argument after \"--\"")
+			}
+			return nil
+		},
+		Example: `coder exec my-dev -- go test ./...
+coder exec my-dev -e CI=true --workdir /home/coder/project -- make test
+coder exec -it my-dev -- htop
+coder exec my-dev/gpu -- nvidia-smi
+
+# with "coder config set default-workspace my-dev"
+coder exec -- sh -c 'echo $HOME'`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			positional := cmd.ArgsLenAtDash()
+			target, extra, err := workspaceArg(opts.workspace, args[:positional], 0)
+			if err != nil {
+				return err
+			}
+			if len(extra) > 0 {
+				return xerrors.Errorf("unexpected arguments before \"--\": %s", strings.Join(extra, " "))
+			}
+			commandLine, err := execCommandLine(args[positional:], opts.env, opts.workdir)
+			if err != nil {
+				return err
+			}
+
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			me, err := client.Me(ctx)
+			if err != nil {
+				return err
+			}
+			workspaceName, agent, err := splitAgentTarget(target)
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, workspaceName, coder.Me)
+			if err != nil {
+				return err
+			}
+			if workspace.LatestStat.ContainerStatus != coder.WorkspaceOn {
+				return diagnoseWorkspace(ctx, client, workspace)
+			}
+			if err := findAgent(ctx, client, workspace, agent); err != nil {
+				return err
+			}
+			usr, err := user.Current()
+			if err != nil {
+				return xerrors.Errorf("get user home directory: %w", err)
+			}
+			privateKeyFilepath := filepath.Join(usr.HomeDir, ".ssh", "coder_enterprise")
+			if err := writeSSHKey(ctx, client, privateKeyFilepath); err != nil {
+				return err
+			}
+
+			s, closeDialer, err := newNativeSSHSession(ctx, client, workspace, agent, opts.container, me.Username, privateKeyFilepath)
+			if err != nil {
+				var connectErr nativeSSHConnectError
+				if xerrors.As(err, &connectErr) {
+					if err := diagnoseWorkspace(ctx, client, workspace); err != nil {
+						clog.Log(err)
+					}
+				}
+				return err
+			}
+			defer closeDialer()
+			s.args = nativeSSHArgs{command: []string{commandLine}, forceTTY: opts.tty, noTTY: !opts.tty}
+			if !opts.stdin {
+				s.stdin = nil
+			}
+			code, err := s.run(ctx)
+			if err != nil {
+				return err
+			}
+			if code != 0 {
+				closeDialer()
+				os.Exit(code)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&opts.stdin, "stdin", "i", false, "pass stdin to the command")
+	cmd.Flags().BoolVarP(&opts.tty, "tty", "t", false, "allocate a terminal for the command")
+	cmd.Flags().StringArrayVarP(&opts.env, "env", "e", nil, "set an environment variable of the command, as KEY=VALUE (repeatable)")
+	cmd.Flags().StringVar(&opts.workdir, "workdir", "", "directory to run the command in, instead of the home directory")
+	cmd.Flags().StringVar(&opts.container, "container", "", "run the command in another container of the workspace, as served by the agent with --container")
+	cmd.Flags().StringVar(&opts.workspace, "workspace", "", "workspace to run the command in, instead of workspace_name")
+	return cmd
+}
+
+// execCommandLine returns the line the shell of the workspace runs for the
+// command, quoting its arguments so that they're passed as is.
+func execCommandLine(command, env []string, workdir string) (string, error) {
+	var parts []string
+	if workdir != "" {
+		parts = append(parts, "cd", remoteShellPath(workdir), "&&")
+	}
+	parts = append(parts, "exec")
+	if len(env) > 0 {
+		parts = append(parts, "env")
+		for _, kv := range env {
+			if strings.Index(kv, "=") <= 0 {
+				return "", xerrors.Errorf("invalid --env %q: expected KEY=VALUE", kv)
+			}
+			parts = append(parts, posixQuote(kv))
+		}
+	}
+	for _, arg := range command {
+		parts = append(parts, posixQuote(arg))
+	}
+	return strings.Join(parts, " "), nil
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_execCommandLine(t *testing.T) {
+	t.Parallel()
+
+	line, err := execCommandLine([]string{"echo", "it's", "$HOME"}, nil, "")
+	assert.Success(t, "command line", err)
+	assert.Equal(t, "quoted", `exec 'echo' 'it'\''s' '$HOME'`, line)
+
+	line, err = execCommandLine([]string{"make", "test"}, []string{"CI=true"}, "~/my project")
+	assert.Success(t, "command line", err)
+	assert.Equal(t, "with env and workdir", `cd ~/'my project' && exec env 'CI=true' 'make' 'test'`, line)
+
+	_, err = execCommandLine([]string{"true"}, []string{"=x"}, "")
+	assert.Error(t, "invalid env", err)
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	line, err = execCommandLine([]string{"sh", "-c", `printf '%s|%s' "$GREETING" "$1"`, "sh", "a b; c"}, []string{"GREETING=hello world"}, "/")
+	assert.Success(t, "command line", err)
+	out, err := exec.Command("sh", "-c", line).Output()
+	assert.Success(t, "run", err)
+	assert.Equal(t, "arguments passed as is", "hello world|a b; c", string(out))
+}
+
+func Test_execArgs(t *testing.T) {
+	t.Parallel()
+
+	res := execute(t, nil, "exec", "my-dev", "make", "test")
+	res.error(t)
+	res.stderrContains(t, `the command must follow "--"`)
+
+	res = execute(t, nil, "exec", "my-dev", "--")
+	res.error(t)
+	res.stderrContains(t, "missing <command> argument")
+
+	res = execute(t, nil, "exec", "my-dev", "extra", "--", "true")
+	res.error(t)
+	res.stderrContains(t, `unexpected arguments before "--": extra`)
+}
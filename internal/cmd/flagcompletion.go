@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/config"
+)
+
+// completionCacheTTL is how long completion lookups are reused for, since
+// the shell runs coder anew on every press of tab.
+const completionCacheTTL = time.Minute
+
+// flagCompleters complete the values of the flags with these names, on every
+// command that has them.
+var flagCompleters = map[string]func(ctx context.Context, cmd *cobra.Command, client coder.Client) ([]string, error){
+	"provider": completeProviders,
+	"image":    completeImages,
+	"tag":      completeTags,
+	"org":      completeOrgs,
+}
+
+// completeFlagChoices completes the value of the flag with the fixed choices.
+func completeFlagChoices(cmd *cobra.Command, name string, choices ...string) {
+	_ = cmd.RegisterFlagCompletionFunc(name, func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		var matches []string
+		for _, c := range choices {
+			if strings.HasPrefix(c, toComplete) {
+				matches = append(matches, c)
+			}
+		}
+		return matches, cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+// registerFlagCompletions registers the flagCompleters on cmd and all its
+// subcommands.
+func registerFlagCompletions(cmd *cobra.Command) {
+	for name, complete := range flagCompleters {
+		if cmd.Flags().Lookup(name) == nil {
+			continue
+		}
+		complete := complete
+		_ = cmd.RegisterFlagCompletionFunc(name, func(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			ctx := cmd.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			client, err := newClient(ctx, false)
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveError
+			}
+			values, err := complete(ctx, cmd, client)
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveError
+			}
+			var matches []string
+			for _, v := range values {
+				if strings.HasPrefix(v, toComplete) {
+					matches = append(matches, v)
+				}
+			}
+			sort.Strings(matches)
+			return matches, cobra.ShellCompDirectiveNoFileComp
+		})
+	}
+	for _, sub := range cmd.Commands() {
+		registerFlagCompletions(sub)
+	}
+}
+
+func completeProviders(ctx context.Context, _ *cobra.Command, client coder.Client) ([]string, error) {
+	var names []string
+	err := cachedLookup(client, "providers", &names, func() error {
+		providers, err := client.WorkspaceProviders(ctx)
+		if err != nil {
+			return err
+		}
+		for _, p := range providers.Kubernetes {
+			names = append(names, p.Name)
+		}
+		return nil
+	})
+	return names, err
+}
+
+func completeOrgs(ctx context.Context, _ *cobra.Command, client coder.Client) ([]string, error) {
+	orgs, err := completionOrgs(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(orgs))
+	for _, org := range orgs {
+		names = append(names, org.Name)
+	}
+	return names, nil
+}
+
+func completeImages(ctx context.Context, cmd *cobra.Command, client coder.Client) ([]string, error) {
+	imgs, err := completionImages(ctx, cmd, client)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(imgs))
+	for _, img := range imgs {
+		names = append(names, img.Repository)
+	}
+	return names, nil
+}
+
+// completeTags completes the tags of the image given with --image, or as the
+// first argument of commands without that flag, such as "images prepull".
+func completeTags(ctx context.Context, cmd *cobra.Command, client coder.Client) ([]string, error) {
+	var repository string
+	if cmd.Flags().Lookup("image") != nil {
+		repository, _ = cmd.Flags().GetString("image")
+	} else if args := cmd.Flags().Args(); len(args) > 0 {
+		repository = args[0]
+	}
+	if repository == "" {
+		return nil, nil
+	}
+
+	imgs, err := completionImages(ctx, cmd, client)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, img := range imgs {
+		if img.Repository != repository {
+			continue
+		}
+		var tags []coder.ImageTag
+		err := cachedLookup(client, "tags-"+img.ID, &tags, func() error {
+			tags, err = client.ImageTags(ctx, img.ID)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			names = append(names, tag.Tag)
+		}
+	}
+	return names, nil
+}
+
+func completionOrgs(ctx context.Context, client coder.Client) ([]coder.Organization, error) {
+	var orgs []coder.Organization
+	err := cachedLookup(client, "orgs", &orgs, func() error {
+		var err error
+		orgs, err = client.Organizations(ctx)
+		return err
+	})
+	return orgs, err
+}
+
+// completionImages returns the images of the organization given with --org,
+// or of all organizations.
+func completionImages(ctx context.Context, cmd *cobra.Command, client coder.Client) ([]coder.Image, error) {
+	orgs, err := completionOrgs(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	orgName, _ := cmd.Flags().GetString("org")
+	var imgs []coder.Image
+	for _, org := range orgs {
+		if orgName != "" && org.Name != orgName {
+			continue
+		}
+		var orgImgs []coder.Image
+		err := cachedLookup(client, "images-"+org.ID, &orgImgs, func() error {
+			orgImgs, err = client.OrganizationImages(ctx, org.ID)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		imgs = append(imgs, orgImgs...)
+	}
+	return imgs, nil
+}
+
+// cachedLookup fills v with the result of fetch, reusing the result cached
+// under key for up to completionCacheTTL. Results are cached separately for
+// each deployment and session.
+func cachedLookup(client coder.Client, key string, v interface{}, fetch func() error) error {
+	u := client.BaseURL()
+	sum := sha256.Sum256([]byte(u.String() + "\n" + client.Token()))
+	dir, err := config.Dir(filepath.Join("completion-cache", hex.EncodeToString(sum[:8])))
+	if err != nil {
+		return fetch()
+	}
+	path := filepath.Join(dir, key+".json")
+
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) < completionCacheTTL {
+		if raw, err := ioutil.ReadFile(path); err == nil && json.Unmarshal(raw, v) == nil {
+			return nil
+		}
+	}
+	if err := fetch(); err != nil {
+		return err
+	}
+	if raw, err := json.Marshal(v); err == nil {
+		_ = ioutil.WriteFile(path, raw, 0600)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+	"cdr.dev/coder-cli/internal/config"
+)
+
+func Test_flagCompletion(t *testing.T) {
+	fake := codertest.New()
+	fake.AddProvider(coder.KubernetesProvider{Name: "us-east"})
+	fake.AddProvider(coder.KubernetesProvider{Name: "eu-west"})
+	fake.AddImage(coder.Image{OrganizationID: fake.DefaultOrgID(), Repository: "codercom/ubuntu"}, "20.04", "22.04")
+	fake.AddImage(coder.Image{OrganizationID: fake.DefaultOrgID(), Repository: "codercom/centos"}, "8")
+	useFakeClient(t, fake)
+	t.Cleanup(func() {
+		dir, _ := config.Dir("completion-cache")
+		_ = os.RemoveAll(dir)
+	})
+
+	complete := func(args ...string) []string {
+		res := execute(t, nil, append([]string{"__complete"}, args...)...)
+		res.success(t)
+		lines := strings.Split(strings.TrimSpace(res.outBuffer.String()), "\n")
+		// The last line is the shell completion directive.
+		return lines[:len(lines)-1]
+	}
+
+	assert.Equal(t, "providers", []string{"eu-west", "us-east"}, complete("workspaces", "create", "--provider", ""))
+	assert.Equal(t, "providers with prefix", []string{"us-east"}, complete("workspaces", "create", "--provider", "us"))
+	assert.Equal(t, "images", []string{"codercom/centos", "codercom/ubuntu"}, complete("workspaces", "create", "--image", ""))
+	assert.Equal(t, "tags of --image", []string{"20.04", "22.04"}, complete("workspaces", "create", "--image", "codercom/ubuntu", "--tag", ""))
+	assert.Equal(t, "tags of image arg", []string{"8"}, complete("images", "prepull", "codercom/centos", "--tag", ""))
+
+	// Lookups are cached.
+	calls := len(fake.CallsTo("WorkspaceProviders"))
+	complete("workspaces", "create", "--provider", "")
+	assert.Equal(t, "cached providers", calls, len(fake.CallsTo("WorkspaceProviders")))
+	dir, err := config.Dir("completion-cache")
+	assert.Success(t, "cache dir", err)
+	entries, err := filepath.Glob(filepath.Join(dir, "*", "providers.json"))
+	assert.Success(t, "glob", err)
+	assert.Equal(t, "cache file", 1, len(entries))
+}
+
+// Not parallel: execute swaps the clog output.
+func Test_flagChoices(t *testing.T) {
+	complete := func(args ...string) (values []string, directive string) {
+		res := execute(t, nil, append([]string{"__complete"}, args...)...)
+		res.success(t)
+		lines := strings.Split(strings.TrimSpace(res.outBuffer.String()), "\n")
+		return lines[:len(lines)-1], lines[len(lines)-1]
+	}
+
+	values, _ := complete("workspaces", "ls", "--output", "")
+	assert.Equal(t, "output", []string{"human", "json", "ndjson", "yaml"}, values)
+	values, _ = complete("workspaces", "ls", "--status", "c")
+	assert.Equal(t, "status with prefix", []string{"creating"}, values)
+	values, _ = complete("urls", "create", "my-dev", "8080", "--access", "")
+	assert.Equal(t, "access", []string{"private", "org", "authed", "public"}, values)
+	values, _ = complete("workspaces", "ls", "--color", "")
+	assert.Equal(t, "inherited color", []string{"auto", "always", "never"}, values)
+
+	values, directive := complete("workspaces", "create-from-config", "--filepath", "")
+	assert.Equal(t, "file extensions", []string{"yaml", "yml"}, values)
+	assert.Equal(t, "filter file extensions", ":8", directive)
+	values, _ = complete("workspaces", "ping", "my-dev", "--trace")
+	assert.Equal(t, "hidden flag", []string{"--trace-wsnet\tappend a trace of the workspace connection's lifecycle to this file"}, values)
+}
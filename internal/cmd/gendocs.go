@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// docsExamplesDir is the directory of the docs holding example output.
+const docsExamplesDir = "examples"
+
+// docsSamplesAnnotation is the annotation of the commands listing the
+// invocations whose output is captured in their examples page.
+const docsSamplesAnnotation = "coder_docs_samples"
+
+// docsSamples has the examples page of cmd show the output of the
+// invocations. They run against the fake deployment from docsFakeClient, so
+// they must only use what codertest models, and their output must not depend
+// on the current time.
+func docsSamples(cmd *cobra.Command, invocations ...string) {
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[docsSamplesAnnotation] = strings.Join(invocations, "\n")
+}
+
+func genDocsCmd(rootCmd *cobra.Command) *cobra.Command {
+	var check bool
+	cmd := &cobra.Command{
+		Use:   "gen-docs [dir_path]",
+		Short: "Generate a markdown documentation tree for the root command.",
+		Long: "Generate a markdown documentation tree for the root command, along with an examples directory " +
+			"holding the examples of every command, and the output of sample invocations run against a fake deployment.\n\n" +
+			"With --check, nothing is written and the command fails if the docs in dir_path are out of date.",
+		Args: xcobra.ExactArgs(1),
+		ValidArgsFunction: func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+			return nil, cobra.ShellCompDirectiveFilterDirs
+		},
+		Example: `coder gen-docs ./docs
+
+# verify that the committed docs match the commands, such as when packaging
+coder gen-docs --check ./docs`,
+		Hidden: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			if !check {
+				return writeDocs(rootCmd, args[0])
+			}
+
+			tmp, err := ioutil.TempDir("", "coder-docs")
+			if err != nil {
+				return xerrors.Errorf("create temp dir: %w", err)
+			}
+			defer os.RemoveAll(tmp)
+			if err := writeDocs(rootCmd, tmp); err != nil {
+				return err
+			}
+			drift, err := diffDocs(args[0], tmp)
+			if err != nil {
+				return err
+			}
+			if len(drift) > 0 {
+				return clog.Error(i18n.Sprintf("docs in %s are out of date", args[0]),
+					append(drift, clog.BlankLine, clog.Tipf(`run "make gendocs" and commit the result`))...,
+				)
+			}
+			clog.LogSuccess(i18n.Sprintf("docs in %s are up to date", args[0]))
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&check, "check", false, "fail if the docs in dir_path differ from the generated docs, without writing anything")
+	return cmd
+}
+
+// writeDocs writes the markdown tree of rootCmd and the examples to dir.
+func writeDocs(rootCmd *cobra.Command, dir string) error {
+	if err := doc.GenMarkdownTree(rootCmd, dir); err != nil {
+		return xerrors.Errorf("generate markdown: %w", err)
+	}
+	return writeDocsExamples(rootCmd, filepath.Join(dir, docsExamplesDir))
+}
+
+// docsCommands returns the runnable commands of the tree of cmd that have
+// docs, skipping the ones doc.GenMarkdownTree skips.
+func docsCommands(cmd *cobra.Command) []*cobra.Command {
+	if cmd.HasParent() && (!cmd.IsAvailableCommand() || cmd.IsAdditionalHelpTopicCommand()) {
+		return nil
+	}
+	var cmds []*cobra.Command
+	if cmd.Runnable() {
+		cmds = append(cmds, cmd)
+	}
+	for _, sub := range cmd.Commands() {
+		cmds = append(cmds, docsCommands(sub)...)
+	}
+	return cmds
+}
+
+// writeDocsExamples writes an examples page for every command of rootCmd
+// with docs, holding its examples followed by the output of its samples run
+// against a fake deployment.
+func writeDocsExamples(rootCmd *cobra.Command, dir string) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return xerrors.Errorf("create examples dir: %w", err)
+	}
+
+	for _, cmd := range docsCommands(rootCmd) {
+		if cmd.Example == "" {
+			continue
+		}
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "## %s\n\n```\n%s\n```\n", cmd.CommandPath(), strings.TrimSpace(cmd.Example))
+		if samples := cmd.Annotations[docsSamplesAnnotation]; samples != "" {
+			for _, sample := range strings.Split(samples, "\n") {
+				output, err := runDocsExample(sample)
+				if err != nil {
+					return xerrors.Errorf("run example %q: %w", sample, err)
+				}
+				fmt.Fprintf(&buf, "\n```\n$ coder %s\n%s```\n", sample, output)
+			}
+		}
+		name := strings.ReplaceAll(cmd.CommandPath(), " ", "_") + ".md"
+		if err := ioutil.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+			return xerrors.Errorf("write example: %w", err)
+		}
+	}
+	return nil
+}
+
+// runDocsExample runs the example on a fresh command tree and returns
+// everything it printed.
+func runDocsExample(example string) (string, error) {
+	prevClient := clientOverride
+	clientOverride = docsFakeClient()
+	defer func() { clientOverride = prevClient }()
+
+	var buf bytes.Buffer
+	clog.SetOutput(&buf)
+	defer clog.SetOutput(os.Stderr)
+
+	root := Make()
+	root.SetOut(&buf)
+	root.SetErr(&buf)
+	root.SetArgs(append(strings.Fields(example), "--color", string(clog.ColorNever)))
+	if err := root.Execute(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// docsFakeClient returns a fake deployment with sample data for the docs.
+// Everything, including timestamps, is fixed so the output is reproducible.
+func docsFakeClient() coder.Client {
+	var (
+		ctx     = context.Background()
+		fake    = codertest.New()
+		created = time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	)
+	providerID := fake.AddProvider(coder.KubernetesProvider{Name: "us-east"})
+	imageID := fake.AddImage(coder.Image{
+		OrganizationID:  fake.DefaultOrgID(),
+		Repository:      "codercom/enterprise-base",
+		Description:     "Ubuntu with the common development tools",
+		DefaultCPUCores: 2,
+		DefaultMemoryGB: 4,
+		DefaultDiskGB:   30,
+		CreatedAt:       created,
+		UpdatedAt:       created,
+	}, "ubuntu", "latest")
+	var workspaces []string
+	for _, w := range []coder.Workspace{
+		{Name: "backend", CPUCores: 4, MemoryGB: 8, DiskGB: 30},
+		{Name: "frontend", CPUCores: 2, MemoryGB: 4, DiskGB: 30},
+	} {
+		w.ImageID = imageID
+		w.ImageTag = "ubuntu"
+		w.ResourcePoolID = providerID
+		w.CreatedAt = created
+		w.UpdatedAt = created
+		w.LastBuiltAt = created
+		w.LastConnectionAt = created
+		workspaces = append(workspaces, fake.AddWorkspace(w))
+	}
+	// The fake only fails these for unknown workspaces and users.
+	_ = fake.CreateDevURL(ctx, workspaces[0], coder.CreateDevURLReq{Name: "webapp", Port: 3000, Access: "ORG", Scheme: "https"})
+	_, _ = fake.CreateAPIToken(ctx, coder.Me, coder.CreateAPITokenReq{Name: "ci"})
+	return fake
+}
+
+// diffDocs returns a line for each file that differs between the docs in dir
+// and the freshly generated docs in want.
+func diffDocs(dir, want string) ([]string, error) {
+	wantFiles, err := docsFiles(want)
+	if err != nil {
+		return nil, err
+	}
+	gotFiles, err := docsFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []string
+	for name, wantData := range wantFiles {
+		gotData, ok := gotFiles[name]
+		switch {
+		case !ok:
+			drift = append(drift, fmt.Sprintf("missing: %s", name))
+		case !bytes.Equal(gotData, wantData):
+			drift = append(drift, fmt.Sprintf("changed: %s", name))
+		}
+	}
+	for name := range gotFiles {
+		if _, ok := wantFiles[name]; !ok {
+			drift = append(drift, fmt.Sprintf("extra:   %s", name))
+		}
+	}
+	sort.Strings(drift)
+	return drift, nil
+}
+
+// docsFiles returns the contents of the markdown files under dir, keyed by
+// their path relative to dir.
+func docsFiles(dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".md" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("read docs: %w", err)
+	}
+	return files, nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+// Not parallel: the examples swap the client and clog output for the package.
+func Test_genDocsCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "coder-docs")
+	assert.Success(t, "create temp dir", err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	root := Make()
+	assert.Success(t, "generate docs", writeDocs(root, dir))
+
+	for _, cmd := range docsCommands(root) {
+		assert.True(t, cmd.CommandPath()+" has examples", cmd.Example != "")
+		_, err = os.Stat(filepath.Join(dir, docsExamplesDir, strings.ReplaceAll(cmd.CommandPath(), " ", "_")+".md"))
+		assert.Success(t, cmd.CommandPath()+" examples page", err)
+	}
+	sample, err := ioutil.ReadFile(filepath.Join(dir, docsExamplesDir, "coder_workspaces_ls.md"))
+	assert.Success(t, "read workspaces ls examples", err)
+	assert.True(t, "workspaces ls sample output", strings.Contains(string(sample), "$ coder workspaces ls --output json\n[{"))
+
+	drift, err := diffDocs(dir, dir)
+	assert.Success(t, "diff docs", err)
+	assert.Equal(t, "no drift", 0, len(drift))
+
+	want, err := ioutil.TempDir("", "coder-docs")
+	assert.Success(t, "create temp dir", err)
+	t.Cleanup(func() { _ = os.RemoveAll(want) })
+	assert.Success(t, "regenerate docs", writeDocs(Make(), want))
+
+	drift, err = diffDocs(dir, want)
+	assert.Success(t, "diff regenerated docs", err)
+	assert.Equal(t, "reproducible", 0, len(drift))
+
+	assert.Success(t, "edit docs", ioutil.WriteFile(filepath.Join(dir, "coder.md"), []byte("stale"), 0644))
+	assert.Success(t, "remove docs", os.Remove(filepath.Join(dir, "coder_workspaces.md")))
+	assert.Success(t, "add docs", ioutil.WriteFile(filepath.Join(dir, "coder_gone.md"), nil, 0644))
+
+	drift, err = diffDocs(dir, want)
+	assert.Success(t, "diff stale docs", err)
+	assert.Equal(t, "drift", []string{
+		"changed: coder.md",
+		"extra:   coder_gone.md",
+		"missing: coder_workspaces.md",
+	}, drift)
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// maxSyncMappings bounds how many synced directories are remembered, the
+// least recently synced being forgotten first.
+const maxSyncMappings = 100
+
+// syncMapping is a local directory synced to a workspace with "coder sync".
+type syncMapping struct {
+	LocalDir  string    `json:"local_dir"`
+	Workspace string    `json:"workspace"`
+	RemoteDir string    `json:"remote_dir"`
+	SyncedAt  time.Time `json:"synced_at"`
+}
+
+func gotoCmd() *cobra.Command {
+	var printDir bool
+	cmd := &cobra.Command{
+		Use:   "goto [workspace_name[/agent]]",
+		Short: "Open a shell in the workspace directory synced with the current directory",
+		Long: "Open a shell over SSH in the directory of the workspace that the current directory is synced to with \"coder sync\", " +
+			"so there's no need to cd after connecting. Subdirectories of a synced directory map to the same subdirectory of its remote copy.\n\n" +
+			"Without a workspace, the workspace the current directory is synced to is used, " +
+			"or the default workspace set with \"coder config set default-workspace\" if it's synced to several.\n\n" +
+			"Use --print to print the remote directory instead, such as for shell integration.",
+		Args: cobra.MaximumNArgs(1),
+		Example: `coder sync ~/projects/api my-dev:/home/coder/api
+cd ~/projects/api/internal
+coder goto my-dev
+
+# print the directory instead
+coder goto --print`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return xerrors.Errorf("get working directory: %w", err)
+			}
+			mappings, err := readSyncMappings()
+			if err != nil {
+				return err
+			}
+			var target string
+			if len(args) == 0 {
+				if names := syncedWorkspaces(mappings, cwd); len(names) == 1 {
+					target = names[0]
+				}
+			}
+			if target == "" {
+				if target, _, err = workspaceArg("", args, 0); err != nil {
+					return err
+				}
+			}
+			workspaceName, _, err := splitAgentTarget(target)
+			if err != nil {
+				return err
+			}
+			dir, ok := remoteDirFor(mappings, workspaceName, cwd)
+			if !ok {
+				return clog.Error(i18n.Sprintf("%s isn't synced to %s", cwd, workspaceName),
+					clog.BlankLine,
+					clog.Tipf("run \"coder sync <local directory> %s:<remote directory>\" to sync it", workspaceName),
+				)
+			}
+			if printDir {
+				_, err := fmt.Fprintln(cmd.OutOrStdout(), dir)
+				return err
+			}
+			return shell(cmd, []string{target, "-t", gotoShellCommand(dir)})
+		},
+	}
+	cmd.Flags().BoolVar(&printDir, "print", false, "print the remote directory instead of opening a shell in it")
+	return cmd
+}
+
+// gotoShellCommand returns the remote command that starts a login shell in
+// dir. It's run by sh since the user's shell might not be a POSIX shell, and
+// a leading "~" is left unquoted to be expanded.
+func gotoShellCommand(dir string) string {
+	target := posixQuote(dir)
+	switch {
+	case dir == "~":
+		target = "~"
+	case strings.HasPrefix(dir, "~/"):
+		target = "~/" + posixQuote(dir[2:])
+	}
+	return "sh -c " + posixQuote("cd "+target+` && exec "${SHELL:-sh}" -l`)
+}
+
+// remoteDirFor returns the directory of the workspace that the local
+// directory maps to, through the closest synced directory containing it.
+func remoteDirFor(mappings []syncMapping, workspaceName, localDir string) (string, bool) {
+	var (
+		best    syncMapping
+		bestRel string
+		found   bool
+	)
+	for _, m := range mappings {
+		if m.Workspace != workspaceName {
+			continue
+		}
+		rel, ok := relativeTo(m.LocalDir, localDir)
+		if !ok || (found && len(m.LocalDir) <= len(best.LocalDir)) {
+			continue
+		}
+		best, bestRel, found = m, rel, true
+	}
+	if !found {
+		return "", false
+	}
+	return path.Join(best.RemoteDir, bestRel), true
+}
+
+// syncedWorkspaces returns the names of the workspaces the local directory
+// is synced to.
+func syncedWorkspaces(mappings []syncMapping, localDir string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range mappings {
+		if _, ok := relativeTo(m.LocalDir, localDir); ok && !seen[m.Workspace] {
+			seen[m.Workspace] = true
+			names = append(names, m.Workspace)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// relativeTo returns the path of dir relative to root with slashes, if dir
+// is root or inside it.
+func relativeTo(root, dir string) (string, bool) {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func readSyncMappings() ([]syncMapping, error) {
+	raw, err := config.SyncMappings.Read()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read sync mappings: %w", err)
+	}
+	var mappings []syncMapping
+	if err := json.Unmarshal([]byte(raw), &mappings); err != nil {
+		return nil, xerrors.Errorf("parse sync mappings: %w", err)
+	}
+	return mappings, nil
+}
+
+// recordSyncMapping remembers the local directory synced with "coder sync",
+// for "coder goto".
+func recordSyncMapping(m syncMapping) error {
+	mappings, err := readSyncMappings()
+	if err != nil {
+		// Start over rather than never recording a mapping again.
+		mappings = nil
+	}
+	kept := []syncMapping{m}
+	for _, old := range mappings {
+		if old.LocalDir != m.LocalDir || old.Workspace != m.Workspace {
+			kept = append(kept, old)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].SyncedAt.After(kept[j].SyncedAt) })
+	if len(kept) > maxSyncMappings {
+		kept = kept[:maxSyncMappings]
+	}
+	raw, err := json.Marshal(kept)
+	if err != nil {
+		return xerrors.Errorf("encode sync mappings: %w", err)
+	}
+	return config.SyncMappings.Write(string(raw))
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/internal/config"
+)
+
+func Test_remoteDirFor(t *testing.T) {
+	t.Parallel()
+
+	root := filepath.FromSlash("/home/me/projects")
+	mappings := []syncMapping{
+		{LocalDir: filepath.Join(root, "api"), Workspace: "dev", RemoteDir: "/home/coder/api"},
+		{LocalDir: filepath.Join(root, "api", "web"), Workspace: "dev", RemoteDir: "/srv/web"},
+		{LocalDir: filepath.Join(root, "api"), Workspace: "gpu", RemoteDir: "~/api"},
+	}
+	for _, tc := range []struct {
+		workspace, local string
+		want             string
+	}{
+		{"dev", filepath.Join(root, "api"), "/home/coder/api"},
+		{"dev", filepath.Join(root, "api", "internal", "cmd"), "/home/coder/api/internal/cmd"},
+		{"dev", filepath.Join(root, "api", "web", "src"), "/srv/web/src"},
+		{"gpu", filepath.Join(root, "api", "web"), "~/api/web"},
+		{"dev", filepath.Join(root, "apiary"), ""},
+		{"dev", root, ""},
+		{"other", filepath.Join(root, "api"), ""},
+	} {
+		got, ok := remoteDirFor(mappings, tc.workspace, tc.local)
+		assert.Equal(t, tc.workspace+" "+tc.local+" found", tc.want != "", ok)
+		assert.Equal(t, tc.workspace+" "+tc.local, tc.want, got)
+	}
+	assert.Equal(t, "synced workspaces", []string{"dev", "gpu"}, syncedWorkspaces(mappings, filepath.Join(root, "api", "web")))
+
+	assert.Equal(t, "shell command", `sh -c 'cd '\''/srv/it'\''\'\'''\''s'\'' && exec "${SHELL:-sh}" -l'`, gotoShellCommand("/srv/it's"))
+	assert.Equal(t, "home", `sh -c 'cd ~/'\''api'\'' && exec "${SHELL:-sh}" -l'`, gotoShellCommand("~/api"))
+}
+
+// Not parallel: the mappings are stored in the config dir.
+func Test_gotoPrint(t *testing.T) {
+	t.Cleanup(func() { _ = config.SyncMappings.Delete() })
+
+	wd, err := os.Getwd()
+	assert.Success(t, "get working directory", err)
+	assert.Success(t, "record mapping", recordSyncMapping(syncMapping{
+		LocalDir:  filepath.Dir(wd),
+		Workspace: "my-dev",
+		RemoteDir: "/home/coder/internal",
+		SyncedAt:  time.Now(),
+	}))
+	assert.Success(t, "record mapping again", recordSyncMapping(syncMapping{
+		LocalDir:  filepath.Dir(wd),
+		Workspace: "my-dev",
+		RemoteDir: "/home/coder/src/internal",
+		SyncedAt:  time.Now(),
+	}))
+	mappings, err := readSyncMappings()
+	assert.Success(t, "read mappings", err)
+	assert.Equal(t, "mappings", 1, len(mappings))
+
+	res := execute(t, nil, "goto", "--print")
+	res.success(t)
+	res.stdoutContains(t, "/home/coder/src/internal/cmd")
+
+	res = execute(t, nil, "goto", "--print", "other")
+	res.error(t)
+	res.stderrContains(t, "isn't synced to other")
+}
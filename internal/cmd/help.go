@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/config"
+)
+
+// helpLookupTimeout bounds how long help waits for the deployment to name a
+// workspace for its examples, so that help stays quick when it's unreachable.
+const helpLookupTimeout = 2 * time.Second
+
+// Placeholders of the examples that personalized help replaces.
+var (
+	exampleURLs       = []string{"https://my.coder.domain", "https://my-coder.com"}
+	exampleWorkspaces = []string{"my-dev", "my-workspace"}
+)
+
+// examplesAsWrittenAnnotation is the annotation of the commands whose
+// examples help never fills, such as those that delete workspaces, so that
+// copying an example doesn't act on a real workspace.
+const examplesAsWrittenAnnotation = "coder_examples_as_written"
+
+// keepExamples makes help show the examples of cmd as written.
+func keepExamples(cmd *cobra.Command) {
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[examplesAsWrittenAnnotation] = "true"
+}
+
+// Values of the help-examples setting.
+const (
+	helpExamplesOff    = "off"
+	helpExamplesLocal  = "local"
+	helpExamplesLookup = "lookup"
+)
+
+func validateHelpExamples(_ context.Context, value string) error {
+	switch value {
+	case helpExamplesOff, helpExamplesLocal, helpExamplesLookup:
+		return nil
+	}
+	return xerrors.Errorf("invalid value %q: must be off, local or lookup", value)
+}
+
+// helpExamplesMode returns the help-examples setting, which is local unless
+// set.
+func helpExamplesMode() string {
+	value, err := config.HelpExamples.Read()
+	if err != nil || strings.TrimSpace(value) == "" {
+		return helpExamplesLocal
+	}
+	return strings.TrimSpace(value)
+}
+
+// helpValues are the values of the session that help examples are filled
+// with. Empty values leave the placeholders as they are.
+type helpValues struct {
+	url       string
+	workspace string
+}
+
+// personalizeHelp makes help fill the examples of commands with the access
+// URL of the deployment logged in to and the default workspace, so that they
+// work when copied. With the help-examples setting set to lookup, a workspace
+// of the user is looked up when there's no default one. Without a session,
+// examples are shown as written, and so are those of commands marked with
+// keepExamples.
+func personalizeHelp(app *cobra.Command) {
+	help := app.HelpFunc()
+	app.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		mode := helpExamplesMode()
+		if cmd.Example != "" && mode != helpExamplesOff && cmd.Annotations[examplesAsWrittenAnnotation] == "" {
+			ctx, cancel := context.WithTimeout(context.Background(), helpLookupTimeout)
+			cmd.Example = personalizeExample(cmd.Example, lookupHelpValues(ctx, mode == helpExamplesLookup))
+			cancel()
+		}
+		help(cmd, args)
+	})
+}
+
+// lookupHelpValues returns the values of the current session, if any. The
+// deployment is only queried if lookup is set.
+func lookupHelpValues(ctx context.Context, lookup bool) helpValues {
+	var v helpValues
+	if clientOverride == nil {
+		u, err := config.URL.Read()
+		if err != nil {
+			return v
+		}
+		v.url = strings.TrimSuffix(strings.TrimSpace(u), "/")
+	}
+	if name, err := config.DefaultWorkspace.Read(); err == nil && strings.TrimSpace(name) != "" {
+		v.workspace = strings.TrimSpace(name)
+		return v
+	}
+	if !lookup {
+		return v
+	}
+
+	client, err := newClient(ctx, false)
+	if err != nil {
+		return v
+	}
+	if v.url == "" {
+		u := client.BaseURL()
+		v.url = strings.TrimSuffix(u.String(), "/")
+	}
+	_ = cachedLookup(client, "help-workspace", &v.workspace, func() error {
+		workspaces, err := getWorkspaces(ctx, client, coder.Me)
+		if err != nil {
+			return err
+		}
+		v.workspace = exampleWorkspace(workspaces)
+		return nil
+	})
+	return v
+}
+
+// exampleWorkspace returns the name of the workspace to show in examples:
+// the first one that's on, or else the first one.
+func exampleWorkspace(workspaces []coder.Workspace) string {
+	for _, w := range workspaces {
+		if w.LatestStat.ContainerStatus == coder.WorkspaceOn {
+			return w.Name
+		}
+	}
+	if len(workspaces) > 0 {
+		return workspaces[0].Name
+	}
+	return ""
+}
+
+// personalizeExample replaces the placeholders of example with the values of
+// the session.
+func personalizeExample(example string, v helpValues) string {
+	if v.url != "" {
+		for _, placeholder := range exampleURLs {
+			example = strings.ReplaceAll(example, placeholder, v.url)
+		}
+	}
+	if v.workspace != "" {
+		for _, placeholder := range exampleWorkspaces {
+			example = replaceName(example, placeholder, v.workspace)
+		}
+	}
+	return example
+}
+
+// replaceName replaces the occurrences of name in s that aren't part of a
+// longer name, such as "my-dev" but not "my-dev-gpu" or "my-dev-docker.sock".
+func replaceName(s, name, replacement string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, name)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(name)
+		if (i > 0 && isNameByte(s[i-1])) || (end < len(s) && isNameByte(s[end])) {
+			b.WriteString(s[:end])
+		} else {
+			b.WriteString(s[:i])
+			b.WriteString(replacement)
+		}
+		s = s[end:]
+	}
+}
+
+func isNameByte(c byte) bool {
+	return c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+	"cdr.dev/coder-cli/internal/config"
+)
+
+func Test_personalizeExample(t *testing.T) {
+	t.Parallel()
+
+	example := `coder login https://my.coder.domain
+coder ssh my-dev
+coder tunnel my-dev/gpu 8888 8888
+coder ssh my-dev-gpu
+coder tunnel my-dev /var/run/my-dev-docker.sock`
+	got := personalizeExample(example, helpValues{url: "https://coder.acme.com", workspace: "alice-dev"})
+	assert.Equal(t, "personalized", `coder login https://coder.acme.com
+coder ssh alice-dev
+coder tunnel alice-dev/gpu 8888 8888
+coder ssh my-dev-gpu
+coder tunnel alice-dev /var/run/my-dev-docker.sock`, got)
+
+	assert.Equal(t, "no session", example, personalizeExample(example, helpValues{}))
+}
+
+func Test_exampleWorkspace(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "none", "", exampleWorkspace(nil))
+	assert.Equal(t, "running first", "on", exampleWorkspace([]coder.Workspace{
+		{Name: "off", LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOff}},
+		{Name: "on", LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOn}},
+	}))
+	assert.Equal(t, "else the first", "off", exampleWorkspace([]coder.Workspace{
+		{Name: "off", LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOff}},
+	}))
+}
+
+func Test_personalizedHelp(t *testing.T) {
+	fake := codertest.New()
+	fake.AddWorkspace(coder.Workspace{Name: "alice-dev", LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOn}})
+	useFakeClient(t, fake)
+	t.Cleanup(func() {
+		_ = config.HelpExamples.Delete()
+	})
+
+	// The deployment is only queried when opted in.
+	res := execute(t, nil, "tunnel", "--help")
+	res.success(t)
+	res.stdoutContains(t, "coder tunnel my-dev 60001 60001 --udp")
+	assert.Equal(t, "no lookup", 0, len(fake.CallsTo("UserWorkspacesByOrganization")))
+
+	res = execute(t, nil, "config", "set", "help-examples", "lookup")
+	res.success(t)
+	res = execute(t, nil, "tunnel", "--help")
+	res.success(t)
+	res.stdoutContains(t, "coder tunnel alice-dev 60001 60001 --udp")
+
+	// Copying the example of a destructive command doesn't act on a real
+	// workspace.
+	res = execute(t, nil, "workspaces", "rm", "--help")
+	res.success(t)
+	res.stdoutContains(t, "coder workspaces rm my-workspace")
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Test_i18nCatalog checks that the English catalog lists every string that
+// can be translated: the labels of messages, the formats and the literal
+// headers and lines given to clog, and the help of the commands. Run it with
+// -write to regenerate the catalog.
+func Test_i18nCatalog(t *testing.T) {
+	keys := map[string]bool{}
+	for _, label := range []string{"info", "success", "warning", "error", "fatal", "tip:", "hint:", "cause:"} {
+		keys[label] = true
+	}
+	helpStrings(Make(), keys)
+	assert.Success(t, "read sources", messageStrings("../..", keys))
+
+	assertGolden(t, "../i18n/en.go", englishCatalog(t, keys))
+}
+
+// helpStrings adds the help of cmd and its subcommands, as localizeHelp
+// translates it.
+func helpStrings(cmd *cobra.Command, keys map[string]bool) {
+	for _, s := range []string{cmd.Short, cmd.Long} {
+		if s != "" {
+			keys[s] = true
+		}
+	}
+	cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+		if f.Usage != "" {
+			keys[f.Usage] = true
+		}
+	})
+	for _, c := range cmd.Commands() {
+		helpStrings(c, keys)
+	}
+}
+
+// messageStrings adds the formats given to clog and i18n, and the headers
+// and lines given to clog as string literals, from the sources under root.
+func messageStrings(root string, keys map[string]bool) error {
+	fset := token.NewFileSet()
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			switch info.Name() {
+			case ".git", "ci", "docs", "testdata":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			pkg, ok := sel.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			switch pkg.Name + "." + sel.Sel.Name {
+			case "i18n.Sprintf", "i18n.Text", "clog.Tipf", "clog.Hintf", "clog.Causef":
+				if s, ok := stringLiteral(call.Args[0]); ok && s != "" {
+					keys[s] = true
+				}
+			case "clog.Error", "clog.Fatal", "clog.LogInfo", "clog.LogSuccess", "clog.LogWarn":
+				// Shown as they are, so % is escaped as in the keys looked
+				// up by clog.
+				for _, arg := range call.Args {
+					if s, ok := stringLiteral(arg); ok && s != "" {
+						keys[strings.ReplaceAll(s, "%", "%%")] = true
+					}
+				}
+			}
+			return true
+		})
+		return nil
+	})
+}
+
+// stringLiteral returns the value of a string literal, or of literals joined
+// with +.
+func stringLiteral(e ast.Expr) (string, bool) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(e.Value)
+		return s, err == nil
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", false
+		}
+		x, ok := stringLiteral(e.X)
+		if !ok {
+			return "", false
+		}
+		y, ok := stringLiteral(e.Y)
+		return x + y, ok
+	case *ast.ParenExpr:
+		return stringLiteral(e.X)
+	}
+	return "", false
+}
+
+// formatVerbRx matches the verbs of format strings.
+var formatVerbRx = regexp.MustCompile(`%[-+# 0-9.*\[\]]*[a-zA-Z%]`)
+
+// englishCatalog returns the source of the English catalog, which registers
+// every key as its own translation.
+func englishCatalog(t *testing.T, keys map[string]bool) []byte {
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		// Formats of verbs alone, like "%s", have nothing to translate.
+		if strings.IndexFunc(formatVerbRx.ReplaceAllString(k, ""), unicode.IsLetter) < 0 {
+			continue
+		}
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var buf bytes.Buffer
+	buf.WriteString(`// Code generated by "go test ./internal/cmd -run Test_i18nCatalog -write"; DO NOT EDIT.
+
+package i18n
+
+import "golang.org/x/text/language"
+
+// The English strings are shown untranslated. They're listed as the baseline
+// for translations to follow: the labels, formats, headers and lines of
+// messages, and the help of commands. Headers and lines are shown as they
+// are, so their keys escape % as %%.
+func init() {
+	Register(language.English, map[string]string{
+`)
+	for _, k := range sorted {
+		q := strconv.Quote(k)
+		fmt.Fprintf(&buf, "\t\t%s: %s,\n", q, q)
+	}
+	buf.WriteString("\t})\n}\n")
+
+	src, err := format.Source(buf.Bytes())
+	assert.Success(t, "format catalog", err)
+	return src
+}
@@ -1,14 +1,19 @@
 package cmd
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
+	"time"
 
+	"github.com/briandowns/spinner"
 	"github.com/spf13/cobra"
 	"golang.org/x/xerrors"
 
 	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/coderutil"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/x/xcobra"
 	"cdr.dev/coder-cli/pkg/clog"
-	"cdr.dev/coder-cli/pkg/tablewriter"
 )
 
 func imgsCmd() *cobra.Command {
@@ -21,20 +26,23 @@ func imgsCmd() *cobra.Command {
 	}
 
 	cmd.PersistentFlags().StringVar(&user, "user", coder.Me, "Specifies the user by email")
-	cmd.AddCommand(lsImgsCommand(&user))
+	cmd.AddCommand(
+		lsImgsCommand(&user),
+		prepullImgCommand(&user),
+		scanStatusImgCommand(&user),
+	)
 	return cmd
 }
 
 func lsImgsCommand(user *string) *cobra.Command {
-	var (
-		orgName   string
-		outputFmt string
-	)
+	var orgName string
 
 	cmd := &cobra.Command{
 		Use:   "ls",
 		Short: "list all images available to the active user",
 		Long:  "List all Coder images available to the active user.",
+		Example: `coder images ls
+coder images ls --org engineering --output json`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
@@ -59,30 +67,174 @@ func lsImgsCommand(user *string) *cobra.Command {
 				imgs = []coder.Image{} // ensures that json output still marshals
 			}
 
-			switch outputFmt {
-			case jsonOutput:
-				enc := json.NewEncoder(cmd.OutOrStdout())
-				// pretty print the json
-				enc.SetIndent("", "\t")
-
-				if err := enc.Encode(imgs); err != nil {
-					return xerrors.Errorf("write images as JSON: %w", err)
-				}
-				return nil
-			case humanOutput:
-				err = tablewriter.WriteTable(cmd.OutOrStdout(), len(imgs), func(i int) interface{} {
+			return writeOutput(cmd.OutOrStdout(), imgs, func() error {
+				scanned := imagesScanned(imgs)
+				err := writeTable(cmd.OutOrStdout(), len(imgs), func(i int) interface{} {
+					if scanned {
+						row := scannedImage{Image: imgs[i]}
+						if imgs[i].DefaultTag != nil {
+							row.Vulnerabilities = imgs[i].DefaultTag.Scan
+						}
+						return row
+					}
 					return imgs[i]
 				})
 				if err != nil {
 					return xerrors.Errorf("write table: %w", err)
 				}
 				return nil
-			default:
-				return xerrors.Errorf("%q is not a supported value for --output", outputFmt)
+			})
+		},
+	}
+	cmd.Flags().StringVar(&orgName, "org", "", "organization name")
+	addOutputFlag(cmd)
+	docsSamples(cmd, "images ls")
+	return cmd
+}
+
+// scannedImage is a row of "coder images ls" when the deployment scans
+// images for vulnerabilities.
+type scannedImage struct {
+	coder.Image     `table:"_"`
+	Vulnerabilities *coder.ImageScan `table:"Vulnerabilities"`
+}
+
+// imagesScanned reports whether the default tag of any of the images has
+// been scanned for vulnerabilities.
+func imagesScanned(imgs []coder.Image) bool {
+	for _, img := range imgs {
+		if img.DefaultTag != nil && img.DefaultTag.Scan != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// prepullPollInterval is how often the progress of a pre-pull is checked.
+var prepullPollInterval = 2 * time.Second
+
+func prepullImgCommand(user *string) *cobra.Command {
+	var (
+		orgName   string
+		tag       string
+		providers []string
+		detach    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "prepull [image]",
+		Short: "pre-pull an image tag onto workspace provider nodes",
+		Long: "Ask workspace providers to pull an image tag onto their nodes ahead of time, " +
+			"so workspaces created or rebuilt from it don't pay the cold image pull time. Requires site admin, or organization admin.",
+		Args: xcobra.ExactArgs(1),
+		Example: `# pre-pull the latest tag of an image onto all providers
+coder images prepull codercom/ubuntu-dev --tag latest
+
+# pre-pull onto a single provider without waiting for completion
+coder images prepull codercom/ubuntu-dev --tag 20.04 --provider us-east --detach`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
 			}
+
+			img, err := findImg(ctx, client, findImgConf{
+				email:   *user,
+				imgName: args[0],
+				orgName: orgName,
+			})
+			if err != nil {
+				return err
+			}
+
+			req := coder.PrepullImageReq{Tag: tag}
+			for _, name := range providers {
+				p, err := coderutil.ProviderByName(ctx, client, name)
+				if err != nil {
+					return err
+				}
+				req.ProviderIDs = append(req.ProviderIDs, p.ID)
+			}
+
+			prepull, err := client.PrepullImage(ctx, img.ID, req)
+			if err != nil {
+				return xerrors.Errorf("start pre-pull: %w", err)
+			}
+			if detach {
+				clog.LogSuccess(i18n.Sprintf("started pre-pull of %s:%s", img.Repository, tag))
+				return nil
+			}
+			return followPrepull(ctx, client, img, prepull)
 		},
 	}
 	cmd.Flags().StringVar(&orgName, "org", "", "organization name")
-	cmd.Flags().StringVar(&outputFmt, "output", humanOutput, "human | json")
+	cmd.Flags().StringVarP(&tag, "tag", "t", defaultImgTag, "image tag to pre-pull")
+	cmd.Flags().StringSliceVar(&providers, "provider", nil, "workspace provider to pre-pull onto (may be repeated, defaults to all)")
+	cmd.Flags().BoolVar(&detach, "detach", false, "return once the pre-pull has started instead of waiting for it to finish")
+	requireRoles(cmd, coder.SiteAdmin, coder.RoleOrgAdmin)
 	return cmd
 }
+
+// followPrepull polls the pre-pull until it completes, reporting node progress.
+func followPrepull(ctx context.Context, client coder.Client, img *coder.Image, prepull *coder.ImagePrepull) error {
+	name := fmt.Sprintf("%s:%s", img.Repository, prepull.Tag)
+	progress := func(p *coder.ImagePrepull) string {
+		return i18n.Sprintf("pre-pulling %s -- %d/%d nodes", name, p.CompletedNodes, p.TotalNodes)
+	}
+
+	var s *spinner.Spinner
+	if showInteractiveOutput {
+		s = spinner.New(spinner.CharSets[11], 100*time.Millisecond)
+		s.Suffix = "  " + progress(prepull)
+		s.Start()
+		defer s.Stop()
+	}
+
+	ticker := time.NewTicker(prepullPollInterval)
+	defer ticker.Stop()
+	lastCompleted := -1
+	for {
+		if s != nil {
+			s.Suffix = "  " + progress(prepull)
+		} else if prepull.CompletedNodes != lastCompleted {
+			// Like the other progress lines, logged to stderr so it
+			// doesn't mix with the output of the command.
+			clog.LogInfo(progress(prepull))
+		}
+		lastCompleted = prepull.CompletedNodes
+
+		switch prepull.State {
+		case coder.PrepullStateDone, coder.PrepullStateFailed:
+			if s != nil {
+				s.Stop()
+			}
+			return prepullResult(name, prepull)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		var err error
+		prepull, err = client.ImagePrepullByID(ctx, img.ID, prepull.ID)
+		if err != nil {
+			return xerrors.Errorf("get pre-pull status: %w", err)
+		}
+	}
+}
+
+func prepullResult(name string, prepull *coder.ImagePrepull) error {
+	if len(prepull.Errors) == 0 && prepull.State == coder.PrepullStateDone {
+		clog.LogSuccess(i18n.Sprintf("pre-pulled %s onto %d nodes", name, prepull.CompletedNodes))
+		return nil
+	}
+
+	lines := []string{fmt.Sprintf("%d/%d nodes pulled the image", prepull.CompletedNodes, prepull.TotalNodes)}
+	for _, e := range prepull.Errors {
+		lines = append(lines, clog.Causef("node %q: %s", e.Node, e.Message))
+	}
+	return clog.Error(i18n.Sprintf("pre-pull of %s failed", name), lines...)
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// imageSeverities are the severities of vulnerabilities, from the highest.
+var imageSeverities = []string{"critical", "high", "medium", "low", "unknown"}
+
+// imageScanStatus is a row of "coder images scan-status".
+type imageScanStatus struct {
+	Image                     string                `json:"image"            table:"Image"`
+	Tag                       string                `json:"tag"              table:"Tag"`
+	Status                    coder.ImageScanStatus `json:"status"           table:"Status"`
+	Highest                   string                `json:"highest_severity" table:"Highest"`
+	coder.VulnerabilityCounts `json:"vulnerabilities"  table:"_"`
+	Scanned                   string     `json:"-"                table:"Scanned"`
+	ScannedAt                 *time.Time `json:"scanned_at,omitempty" table:"-"`
+	Scanner                   string     `json:"scanner,omitempty"    table:"-"`
+	Hash                      string     `json:"hash,omitempty"       table:"-"`
+	Error                     string     `json:"error,omitempty"      table:"-"`
+}
+
+// imageNotScanned is the status of the tags the scanner hasn't reported on.
+const imageNotScanned coder.ImageScanStatus = "not_scanned"
+
+func newImageScanStatus(img coder.Image, tag coder.ImageTag, now time.Time) imageScanStatus {
+	s := imageScanStatus{
+		Image:   img.Repository,
+		Tag:     tag.Tag,
+		Status:  imageNotScanned,
+		Highest: "-",
+		Scanned: "-",
+	}
+	if tag.Scan == nil {
+		return s
+	}
+	s.Status = tag.Scan.Status
+	s.Scanner = tag.Scan.Scanner
+	s.Hash = tag.Scan.Hash
+	s.Error = tag.Scan.Error
+	if !tag.Scan.ScannedAt.IsZero() {
+		at := tag.Scan.ScannedAt
+		s.ScannedAt = &at
+		s.Scanned = fmt.Sprintf("%s ago", now.Sub(at).Round(time.Minute))
+	}
+	if tag.Scan.Status == coder.ImageScanComplete {
+		s.VulnerabilityCounts = tag.Scan.Vulnerabilities
+		s.Highest = tag.Scan.Vulnerabilities.HighestSeverity()
+	}
+	return s
+}
+
+// atOrAbove reports whether the scan found vulnerabilities of the severity
+// or a higher one.
+func (s imageScanStatus) atOrAbove(severity string) bool {
+	counts := []int{s.Critical, s.High, s.Medium, s.Low, s.Unknown}
+	for i, name := range imageSeverities {
+		if counts[i] > 0 {
+			return true
+		}
+		if name == severity {
+			return false
+		}
+	}
+	return false
+}
+
+func scanStatusImgCommand(user *string) *cobra.Command {
+	var (
+		orgName        string
+		tag            string
+		failOn         string
+		allowUnscanned bool
+	)
+	cmd := &cobra.Command{
+		Use:   "scan-status [image]",
+		Short: "show the vulnerabilities found in images by the scanner of the deployment",
+		Long: "Show the vulnerabilities found by severity in each tag of the image, as reported by the vulnerability scanner " +
+			"integrated with the deployment. Without an image, the default tag of every image is shown.\n\n" +
+			"Use --fail-on to exit with an error when vulnerabilities of a severity or higher remain, " +
+			"such as to track the rollout of patched images in CI. Tags whose scan isn't complete, " +
+			"since it is pending, failed or never ran, fail too unless --allow-unscanned is given.",
+		Example: `coder images scan-status
+coder images scan-status codercom/ubuntu-dev
+coder images scan-status codercom/ubuntu-dev --tag latest --fail-on high --output json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if failOn != "" && !stringIn(failOn, imageSeverities) {
+				return xerrors.Errorf("--fail-on must be one of %v, not %q", imageSeverities, failOn)
+			}
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			statuses, err := imageScanStatuses(ctx, client, *user, orgName, args, tag)
+			if err != nil {
+				return err
+			}
+			if len(statuses) == 0 {
+				clog.LogInfo("no image tags found")
+				statuses = []imageScanStatus{} // ensures that json output still marshals
+			}
+			err = writeOutput(cmd.OutOrStdout(), statuses, func() error {
+				return writeTable(cmd.OutOrStdout(), len(statuses), func(i int) interface{} {
+					return statuses[i]
+				})
+			})
+			if err != nil {
+				return xerrors.Errorf("write output: %w", err)
+			}
+			return imageScanError(statuses, failOn, allowUnscanned)
+		},
+	}
+	cmd.Flags().StringVar(&orgName, "org", "", "organization name")
+	cmd.Flags().StringVarP(&tag, "tag", "t", "", "only show this tag of the image")
+	cmd.Flags().StringVar(&failOn, "fail-on", "", "exit with an error if a tag has vulnerabilities of this severity or higher: critical, high, medium, low or unknown")
+	cmd.Flags().BoolVar(&allowUnscanned, "allow-unscanned", false, "with --fail-on, don't fail on tags whose scan isn't complete")
+	addOutputShorthand(cmd)
+	return cmd
+}
+
+// imageScanStatuses returns the scans of the tags of the image named by
+// args, or of the default tags of all images without one.
+func imageScanStatuses(ctx context.Context, client coder.Client, email, orgName string, args []string, tag string) ([]imageScanStatus, error) {
+	now := time.Now()
+	if len(args) == 0 {
+		if tag != "" {
+			return nil, xerrors.New("--tag requires an image")
+		}
+		imgs, err := getImgs(ctx, client, getImgsConf{email: email, orgName: orgName})
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(imgs, func(i, j int) bool { return imgs[i].Repository < imgs[j].Repository })
+		var statuses []imageScanStatus
+		for _, img := range imgs {
+			if img.DefaultTag != nil {
+				statuses = append(statuses, newImageScanStatus(img, *img.DefaultTag, now))
+			}
+		}
+		return statuses, nil
+	}
+
+	img, err := findImg(ctx, client, findImgConf{email: email, imgName: args[0], orgName: orgName})
+	if err != nil {
+		return nil, err
+	}
+	if tag != "" {
+		t, err := client.ImageTagByID(ctx, img.ID, tag)
+		if err != nil {
+			return nil, xerrors.Errorf("get tag %q: %w", tag, err)
+		}
+		return []imageScanStatus{newImageScanStatus(*img, *t, now)}, nil
+	}
+	tags, err := client.ImageTags(ctx, img.ID)
+	if err != nil {
+		return nil, xerrors.Errorf("get tags: %w", err)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	statuses := make([]imageScanStatus, 0, len(tags))
+	for _, t := range tags {
+		statuses = append(statuses, newImageScanStatus(*img, t, now))
+	}
+	return statuses, nil
+}
+
+// imageScanError returns an error if a tag has vulnerabilities of the
+// severity failOn or higher. Tags whose scan isn't complete can't be shown to
+// be free of them, so they fail too unless allowUnscanned is set.
+func imageScanError(statuses []imageScanStatus, failOn string, allowUnscanned bool) error {
+	if failOn == "" {
+		return nil
+	}
+	var failing, unscanned []string
+	for _, s := range statuses {
+		switch {
+		case s.Status != coder.ImageScanComplete:
+			if !allowUnscanned {
+				unscanned = append(unscanned, fmt.Sprintf("%s:%s has no complete scan: %s", s.Image, s.Tag, s.Status))
+			}
+		case s.atOrAbove(failOn):
+			failing = append(failing, fmt.Sprintf("%s:%s has %s", s.Image, s.Tag, s.VulnerabilityCounts))
+		}
+	}
+	switch {
+	case len(unscanned) > 0:
+		lines := append(failing, unscanned...)
+		lines = append(lines, clog.BlankLine, clog.Tipf("use --allow-unscanned to only fail on the tags that were scanned"))
+		return clog.Error(i18n.Sprintf("%d tags have %s or higher vulnerabilities or no complete scan", len(failing)+len(unscanned), failOn), lines...)
+	case len(failing) > 0:
+		return clog.Error(i18n.Sprintf("%d tags have %s or higher vulnerabilities", len(failing), failOn), failing...)
+	}
+	return nil
+}
+
+func stringIn(s string, list []string) bool {
+	for _, l := range list {
+		if s == l {
+			return true
+		}
+	}
+	return false
+}
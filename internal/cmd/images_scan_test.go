@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_imageScanStatus(t *testing.T) {
+	fake := codertest.New()
+	ubuntu := fake.AddImage(coder.Image{Repository: "codercom/ubuntu"}, "20.04", "18.04")
+	fake.AddImage(coder.Image{Repository: "codercom/centos"}, "8")
+	fake.SetTagScan(ubuntu, "20.04", coder.ImageScan{
+		Status:          coder.ImageScanComplete,
+		Scanner:         "trivy",
+		ScannedAt:       time.Now().Add(-time.Hour),
+		Vulnerabilities: coder.VulnerabilityCounts{High: 2, Low: 5},
+	})
+	fake.SetTagScan(ubuntu, "18.04", coder.ImageScan{Status: coder.ImageScanPending})
+	useFakeClient(t, fake)
+
+	res := execute(t, nil, "images", "ls")
+	res.success(t)
+	res.stdoutContains(t, "2 high, 5 low")
+	res.stdoutContains(t, "not scanned")
+
+	var statuses []imageScanStatus
+	res = execute(t, nil, "images", "scan-status", "--output=json")
+	res.success(t)
+	res.stdoutUnmarshals(t, &statuses)
+	assert.Equal(t, "default tags", 2, len(statuses))
+	assert.Equal(t, "sorted by image", "codercom/centos", statuses[0].Image)
+	assert.Equal(t, "centos not scanned", imageNotScanned, statuses[0].Status)
+	assert.Equal(t, "ubuntu highest", "high", statuses[1].Highest)
+	assert.Equal(t, "ubuntu counts", coder.VulnerabilityCounts{High: 2, Low: 5}, statuses[1].VulnerabilityCounts)
+
+	statuses = nil
+	res = execute(t, nil, "images", "scan-status", "codercom/ubuntu", "--output=json")
+	res.success(t)
+	res.stdoutUnmarshals(t, &statuses)
+	assert.Equal(t, "all tags", 2, len(statuses))
+	assert.Equal(t, "sorted by tag", "18.04", statuses[0].Tag)
+	assert.Equal(t, "pending", coder.ImageScanPending, statuses[0].Status)
+
+	res = execute(t, nil, "images", "scan-status", "codercom/ubuntu", "--tag", "20.04", "--fail-on", "critical")
+	res.success(t)
+	res = execute(t, nil, "images", "scan-status", "codercom/ubuntu", "--tag", "20.04", "--fail-on", "high")
+	res.error(t)
+	res.stderrContains(t, "codercom/ubuntu:20.04 has 2 high, 5 low")
+
+	// A pending scan can't show that a tag is free of vulnerabilities.
+	res = execute(t, nil, "images", "scan-status", "codercom/ubuntu", "--tag", "18.04", "--fail-on", "critical")
+	res.error(t)
+	res.stderrContains(t, "codercom/ubuntu:18.04 has no complete scan: pending")
+	res = execute(t, nil, "images", "scan-status", "codercom/ubuntu", "--tag", "18.04", "--fail-on", "critical", "--allow-unscanned")
+	res.success(t)
+
+	res = execute(t, nil, "images", "scan-status", "--fail-on", "severe")
+	res.error(t)
+	res = execute(t, nil, "images", "scan-status", "--tag", "20.04")
+	res.error(t)
+}
+
+func Test_imageScanStatusAtOrAbove(t *testing.T) {
+	t.Parallel()
+	s := imageScanStatus{VulnerabilityCounts: coder.VulnerabilityCounts{Medium: 1}}
+	assert.False(t, "below high", s.atOrAbove("high"))
+	assert.True(t, "at medium", s.atOrAbove("medium"))
+	assert.True(t, "above low", s.atOrAbove("low"))
+	assert.False(t, "nothing found", imageScanStatus{}.atOrAbove("unknown"))
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// impersonation holds the --as and --as-reason flags of the admin commands
+// that can act on behalf of another user.
+var impersonation struct {
+	user   string
+	reason string
+	// verified is set once the deployment was seen to honor --as.
+	verified bool
+}
+
+// addImpersonationFlags lets the command act on behalf of another user, so
+// that support engineers can see what that user sees without their
+// credentials.
+func addImpersonationFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&impersonation.user, "as", "", "act on behalf of the user with this email, as recorded in the audit log (site admin only)")
+	cmd.Flags().StringVar(&impersonation.reason, "as-reason", "", "why you're acting on behalf of the --as user, recorded in the audit log")
+}
+
+// logImpersonation tells the user that the requests they're about to make
+// are made on behalf of someone else.
+func logImpersonation() {
+	lines := []string{"the deployment records these requests in its audit log as made on their behalf"}
+	if impersonation.reason == "" {
+		lines = append(lines, clog.BlankLine, clog.Tipf("use --as-reason to explain why, such as with a support ticket number"))
+	}
+	clog.LogWarn(i18n.Sprintf("acting as %q", impersonation.user), lines...)
+}
+
+// verifyImpersonation checks that the deployment acts on behalf of the --as
+// user. A deployment that ignores the impersonation header would otherwise
+// apply the command to the caller's own resources of the same name.
+func verifyImpersonation(ctx context.Context, client coder.Client) error {
+	if impersonation.user == "" || impersonation.verified {
+		return nil
+	}
+	me, err := client.Me(ctx)
+	if err != nil {
+		return xerrors.Errorf("get impersonated user: %w", err)
+	}
+	if me.ID != impersonation.user && !strings.EqualFold(me.Email, impersonation.user) {
+		return clog.Error(i18n.Sprintf("the deployment didn't act as %q", impersonation.user),
+			fmt.Sprintf("requests were made as %s instead", me.Email),
+			clog.BlankLine,
+			clog.Tipf("the deployment may not support impersonation, or you may lack the site-admin role"),
+		)
+	}
+	impersonation.verified = true
+	return nil
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+// Not parallel: --as is held in a package variable.
+func Test_verifyImpersonation(t *testing.T) {
+	t.Cleanup(func() {
+		impersonation.user = ""
+		impersonation.verified = false
+	})
+	ctx := context.Background()
+	// The fake ignores the impersonation header, like an older deployment.
+	fake := codertest.New()
+
+	impersonation.user = "other@coder.com"
+	assert.Error(t, "header ignored", verifyImpersonation(ctx, fake))
+	assert.True(t, "not verified", !impersonation.verified)
+
+	impersonation.user = "ME@coder.com"
+	assert.Success(t, "acting as the user", verifyImpersonation(ctx, fake))
+	assert.True(t, "verified", impersonation.verified)
+}
@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
+	"os"
 	"strings"
 
 	"github.com/pkg/browser"
@@ -13,38 +15,173 @@ import (
 
 	"cdr.dev/coder-cli/coder-sdk"
 	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/internal/version"
 	"cdr.dev/coder-cli/internal/x/xcobra"
 	"cdr.dev/coder-cli/pkg/clog"
 )
 
 func loginCmd() *cobra.Command {
-	return &cobra.Command{
+	var helper string
+	cmd := &cobra.Command{
 		Use:   "login [Coder URL eg. https://my.coder.domain/]",
 		Short: "Authenticate this client for future operations",
 		Args:  xcobra.ExactArgs(1),
+		Long: "Authenticate this client for future operations.\n\n" +
+			"The URL may omit the scheme, in which case https is assumed, and may be any page of the " +
+			"deployment: redirects are followed and the canonical access URL of the deployment is stored.\n\n" +
+			"With --credential-helper, no token is stored: the helper is run to get a session token whenever one is needed. " +
+			"It follows the protocol of git credential helpers, receiving \"url=<Coder URL>\" on stdin with the \"get\" " +
+			"argument and printing \"token=<session token>\". It may also be set with the " + credentialHelperEnv + " environment variable.",
+		Example: `coder login https://my.coder.domain
+coder login --credential-helper /usr/local/bin/coder-cred-vault https://my.coder.domain`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Pull the URL from the args and do some sanity check.
-			rawURL := args[0]
-			if rawURL == "" || !strings.HasPrefix(rawURL, "http") {
-				return xerrors.Errorf("invalid URL")
+			u, err := normalizeLoginURL(args[0])
+			if err != nil {
+				return err
+			}
+			hc, err := newHTTPClient(cmd.Context())
+			if err != nil {
+				return err
 			}
-			u, err := url.Parse(rawURL)
+			canonical, err := resolveAccessURL(cmd.Context(), hc, u)
 			if err != nil {
-				return xerrors.Errorf("parse url: %w", err)
+				return err
 			}
-			// Remove the trailing '/' if any.
-			u.Path = strings.TrimSuffix(u.Path, "/")
+			if canonical.String() != u.String() {
+				clog.LogInfo(i18n.Sprintf("using the access URL %s", canonical))
+			}
+			u = canonical
 
 			// From this point, the commandline is correct.
 			// Don't return errors as it would print the usage.
 
+			if helper != "" {
+				return loginWithHelper(cmd.Context(), u, helper)
+			}
 			if err := login(cmd, u); err != nil {
 				return xerrors.Errorf("login error: %w", err)
 			}
 			return nil
 		},
 	}
+	cmd.Flags().StringVar(&helper, "credential-helper", "", "command run to get session tokens, instead of storing one")
+	return cmd
+}
+
+// loginWithHelper checks that the credential helper hands out working
+// tokens for the deployment, then configures it instead of a stored token.
+func loginWithHelper(ctx context.Context, workspaceURL *url.URL, helper string) error {
+	token, _, err := helperSessionCredentials(ctx, helper, workspaceURL.String())
+	if err != nil {
+		return err
+	}
+	if err := pingAPI(ctx, workspaceURL, token); err != nil {
+		return xerrors.Errorf("ping API with credentials from helper: %w", err)
+	}
+	if err := config.URL.Write(workspaceURL.String()); err != nil {
+		return xerrors.Errorf("store workspace url: %w", err)
+	}
+	if err := config.CredentialHelper.Write(helper); err != nil {
+		return xerrors.Errorf("store credential helper: %w", err)
+	}
+	if err := config.Session.Delete(); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("delete stored session: %w", err)
+	}
+	clog.LogSuccess("logged in", fmt.Sprintf("session tokens will be requested from %s", helper))
+	return nil
+}
+
+// normalizeLoginURL parses the URL given to login, defaulting to https when
+// no scheme is given. The query, fragment and trailing '/' are removed.
+func normalizeLoginURL(rawURL string) (*url.URL, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return nil, xerrors.New("invalid URL: it's empty")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, xerrors.Errorf("parse url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, clog.Error(i18n.Sprintf("invalid URL scheme %q", u.Scheme),
+			clog.Tipf("use the https:// URL you open Coder with in your browser"),
+		)
+	}
+	if u.Host == "" {
+		return nil, xerrors.Errorf("invalid URL %q: no host", rawURL)
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.RawPath = ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u, nil
+}
+
+// resolveAccessURL finds the access URL of the Coder deployment serving u,
+// which may be any page of the deployment. The deployment's root is looked
+// for from the host's root down to u's path, so deployments under a path
+// prefix are supported, and redirects are followed to the canonical URL.
+func resolveAccessURL(ctx context.Context, hc *http.Client, u *url.URL) (*url.URL, error) {
+	const coderVersionHeaderKey = "coder-version"
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if u.Path == "" {
+		segments = nil
+	}
+	var (
+		reached bool
+		lastErr error
+	)
+	for i := 0; i <= len(segments); i++ {
+		candidate := *u
+		candidate.Path = ""
+		if i > 0 {
+			candidate.Path = "/" + strings.Join(segments[:i], "/")
+		}
+		apiURL := candidate
+		apiURL.Path += "/api"
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL.String(), nil)
+		if err != nil {
+			return nil, xerrors.Errorf("create request: %w", err)
+		}
+		resp, err := hc.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		_ = resp.Body.Close()
+		reached = true
+		if resp.Header.Get(coderVersionHeaderKey) == "" {
+			continue
+		}
+
+		// The request URL is the one of the last redirect followed.
+		final := *resp.Request.URL
+		final.RawQuery = ""
+		final.Fragment = ""
+		final.RawPath = ""
+		final.Path = strings.TrimSuffix(strings.TrimSuffix(final.Path, "/"), "/api")
+		return &final, nil
+	}
+
+	if !reached && lastErr != nil {
+		return nil, clog.Error(i18n.Sprintf("failed to reach %s", u.Host),
+			clog.Causef(lastErr.Error()),
+			clog.BlankLine,
+			clog.Tipf("check the URL, and that a proxy isn't required to reach it"),
+		)
+	}
+	return nil, clog.Error(i18n.Sprintf("%s does not appear to be a Coder deployment", u),
+		"no Coder API was found at this URL or any of its parents",
+		clog.BlankLine,
+		clog.Tipf("use the URL you open Coder with in your browser"),
+	)
 }
 
 // storeConfig writes the workspace URL and session token to the local config directory.
@@ -87,6 +224,9 @@ func login(cmd *cobra.Command, workspaceURL *url.URL) error {
 	if err := storeConfig(workspaceURL, token, config.URL, config.Session); err != nil {
 		return xerrors.Errorf("store auth: %w", err)
 	}
+	if err := config.CredentialHelper.Delete(); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("remove credential helper: %w", err)
+	}
 	clog.LogSuccess("logged in")
 	return nil
 }
@@ -94,9 +234,14 @@ func login(cmd *cobra.Command, workspaceURL *url.URL) error {
 // pingAPI creates a client from the given url/token and try to exec an api call.
 // Not using the SDK as we want to verify the url/token pair before storing the config files.
 func pingAPI(ctx context.Context, workspaceURL *url.URL, token string) error {
+	hc, err := newHTTPClient(ctx)
+	if err != nil {
+		return err
+	}
 	client, err := coder.NewClient(coder.ClientOptions{
-		BaseURL: workspaceURL,
-		Token:   token,
+		BaseURL:    workspaceURL,
+		HTTPClient: hc,
+		Token:      token,
 	})
 	if err != nil {
 		return xerrors.Errorf("failed to create coder.Client: %w", err)
@@ -104,7 +249,9 @@ func pingAPI(ctx context.Context, workspaceURL *url.URL, token string) error {
 
 	if apiVersion, err := client.APIVersion(ctx); err == nil {
 		if apiVersion != "" && !version.VersionsMatch(apiVersion) {
-			logVersionMismatchError(apiVersion)
+			if target := rolloutVersion(ctx, client, apiVersion); !version.VersionsMatch(target) {
+				logVersionMismatchError(apiVersion, target)
+			}
 		}
 	}
 	_, err = client.Me(ctx)
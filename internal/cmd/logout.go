@@ -12,13 +12,26 @@ import (
 
 func logoutCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   "logout",
-		Short: "Remove local authentication credentials if any exist",
-		RunE:  logout,
+		Use:     "logout",
+		Short:   "Remove local authentication credentials if any exist",
+		Example: `coder logout`,
+		RunE:    logout,
 	}
 }
 
-func logout(_ *cobra.Command, _ []string) error {
+func logout(cmd *cobra.Command, _ []string) error {
+	purgeResponseCache()
+	if helper, _ := config.CredentialHelper.Read(); helper != "" {
+		rawURL, _ := config.URL.Read()
+		// Best effort, the helper may not cache anything to erase.
+		_, _ = runCredentialHelper(cmd.Context(), helper, "erase", map[string]string{"url": rawURL})
+		if err := config.CredentialHelper.Delete(); err != nil {
+			return xerrors.Errorf("remove credential helper: %w", err)
+		}
+		clog.LogSuccess("logged out")
+		return nil
+	}
+
 	err := config.Session.Delete()
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+)
+
+// Sources of the logs of "coder logs".
+const (
+	logsSourceAll     = "all"
+	logsSourceBuild   = "build"
+	logsSourceRuntime = "runtime"
+)
+
+// logLine is a line of "coder logs", from the build log or the output of
+// the workspace.
+type logLine struct {
+	Source string    `json:"source"`
+	Time   time.Time `json:"time"`
+	// Type is the type of build log lines.
+	Type coder.BuildLogType `json:"type,omitempty"`
+	// Stream is the stream runtime lines were written to.
+	Stream coder.WorkspaceLogStream `json:"stream,omitempty"`
+	Msg    string                   `json:"msg"`
+}
+
+// logPrinter prints log lines in the format of the --output flag.
+type logPrinter struct {
+	stdout     io.Writer
+	stderr     io.Writer
+	timestamps bool
+}
+
+func (p logPrinter) print(l logLine) error {
+	if outputFormat != humanOutput {
+		// Every line is a JSON object of its own, for the logs to be
+		// processed as they're followed.
+		return writeOutput(p.stdout, l, nil)
+	}
+	w := p.stdout
+	if l.Stream == coder.WorkspaceLogStderr {
+		w = p.stderr
+	}
+	msg := l.Msg
+	if l.Type == coder.BuildLogTypeError {
+		msg = "error: " + msg
+	}
+	if p.timestamps {
+		msg = l.Time.Local().Format(time.RFC3339) + " " + msg
+	}
+	_, err := fmt.Fprintln(w, msg)
+	return err
+}
+
+func logsCmd() *cobra.Command {
+	var (
+		user       string
+		follow     bool
+		since      string
+		tail       int
+		timestamps bool
+		source     string
+	)
+	cmd := &cobra.Command{
+		Use:   "logs [workspace_name]",
+		Short: "Print the build and runtime logs of a workspace",
+		Long: "Print the log of the latest build of a workspace, followed by the output its container wrote to stdout and stderr since it last started. " +
+			"Runtime output written to stderr is printed to stderr.\n\n" +
+			"With --follow, a build in progress is followed until it's done, then new output is printed as it's written until interrupted. " +
+			"--since and --tail apply to the build log and the output separately.\n\n" +
+			"Without a workspace, the default workspace set with \"coder config set default-workspace\" is used. " +
+			"With --output json or ndjson, every line is printed as a JSON object.",
+		Args: cobra.MaximumNArgs(1),
+		Example: `coder logs my-dev
+coder logs my-dev --follow --tail 20
+coder logs my-dev --source runtime --since 10m --timestamps`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if outputFormat == yamlOutput {
+				return xerrors.New("logs can only be printed with --output human, json or ndjson")
+			}
+			if source != logsSourceAll && source != logsSourceBuild && source != logsSourceRuntime {
+				return xerrors.Errorf("--source must be %s, %s or %s, not %q", logsSourceAll, logsSourceBuild, logsSourceRuntime, source)
+			}
+			sinceTime, err := parseLogsSince(since, time.Now())
+			if err != nil {
+				return err
+			}
+			name, _, err := workspaceArg("", args, 0)
+			if err != nil {
+				return err
+			}
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, name, user)
+			if err != nil {
+				return err
+			}
+
+			p := logPrinter{stdout: cmd.OutOrStdout(), stderr: cmd.ErrOrStderr(), timestamps: timestamps}
+			if source != logsSourceRuntime {
+				if err := printBuildLogs(ctx, client, workspace.ID, p, sinceTime, tail, follow); err != nil {
+					return err
+				}
+			}
+			if source != logsSourceBuild {
+				return printWorkspaceLogs(ctx, client, workspace.ID, p, sinceTime, tail, follow)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&user, "user", coder.Me, "Specify the user whose resources to target")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "follow a build in progress and the output as it's written")
+	cmd.Flags().StringVar(&since, "since", "", "only print lines newer than a duration such as 10m, or than an RFC 3339 time")
+	cmd.Flags().IntVar(&tail, "tail", -1, "only print the last lines, or all of them with -1")
+	cmd.Flags().BoolVar(&timestamps, "timestamps", false, "print the time of every line")
+	cmd.Flags().StringVar(&source, "source", logsSourceAll, "logs to print: all, build or runtime")
+	completeFlagChoices(cmd, "source", logsSourceAll, logsSourceBuild, logsSourceRuntime)
+	addOutputFlag(cmd)
+	return cmd
+}
+
+// parseLogsSince parses --since as a duration before now or a time.
+func parseLogsSince(since string, now time.Time) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(since); err == nil {
+		if d < 0 {
+			return time.Time{}, xerrors.Errorf("--since must not be negative, got %s", since)
+		}
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return time.Time{}, xerrors.Errorf("--since must be a duration such as 10m or an RFC 3339 time, not %q", since)
+	}
+	return t, nil
+}
+
+// printBuildLogs prints the build log of the latest build, then follows it
+// until the build is done if follow is set.
+func printBuildLogs(ctx context.Context, client coder.Client, workspaceID string, p logPrinter, since time.Time, tail int, follow bool) error {
+	logs, err := client.WorkspaceBuildLogs(ctx, workspaceID)
+	if err != nil {
+		return xerrors.Errorf("get build log: %w", err)
+	}
+	var selected []coder.BuildLog
+	for _, l := range logs {
+		if !l.Time.Before(since) {
+			selected = append(selected, l)
+		}
+	}
+	if tail >= 0 && len(selected) > tail {
+		selected = selected[len(selected)-tail:]
+	}
+	for _, l := range selected {
+		if err := p.print(buildLogLine(l)); err != nil {
+			return err
+		}
+	}
+	if !follow || (len(logs) > 0 && logs[len(logs)-1].Type == coder.BuildLogTypeDone) {
+		return nil
+	}
+
+	stream, err := client.FollowWorkspaceBuildLog(ctx, workspaceID)
+	if err != nil {
+		return xerrors.Errorf("follow build log: %w", err)
+	}
+	// The stream replays the log from the start of the build, which was
+	// printed already.
+	skip := len(logs)
+	for l := range stream {
+		if l.Err != nil {
+			if xerrors.Is(l.Err, context.Canceled) {
+				return nil
+			}
+			return xerrors.Errorf("follow build log: %w", l.Err)
+		}
+		if l.Type == coder.BuildLogTypeStart {
+			// A new build restarts the log.
+			skip = 0
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if err := p.print(buildLogLine(l.BuildLog)); err != nil {
+			return err
+		}
+		if l.Type == coder.BuildLogTypeDone {
+			return nil
+		}
+	}
+	return nil
+}
+
+func buildLogLine(l coder.BuildLog) logLine {
+	return logLine{Source: logsSourceBuild, Time: l.Time, Type: l.Type, Msg: l.Msg}
+}
+
+// printWorkspaceLogs prints the output of the workspace, then the new
+// output as it's written until ctx is done if follow is set.
+func printWorkspaceLogs(ctx context.Context, client coder.Client, workspaceID string, p logPrinter, since time.Time, tail int, follow bool) error {
+	req := coder.WorkspaceLogsReq{Since: since, Tail: tail}
+	if tail == 0 {
+		if !follow {
+			return nil
+		}
+		// Only the output written from now on.
+		if now := time.Now(); since.Before(now) {
+			req.Since = now
+		}
+	}
+
+	if !follow {
+		logs, err := client.WorkspaceLogs(ctx, workspaceID, req)
+		if err != nil {
+			return xerrors.Errorf("get workspace logs: %w", err)
+		}
+		for _, l := range logs {
+			if err := p.print(workspaceLogLine(l)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	stream, err := client.FollowWorkspaceLogs(ctx, workspaceID, req)
+	if err != nil {
+		return xerrors.Errorf("follow workspace logs: %w", err)
+	}
+	for l := range stream {
+		if l.Err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return l.Err
+		}
+		if err := p.print(workspaceLogLine(l.WorkspaceLog)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func workspaceLogLine(l coder.WorkspaceLog) logLine {
+	return logLine{Source: logsSourceRuntime, Time: l.Time, Stream: l.Stream, Msg: l.Msg}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_logs(t *testing.T) {
+	fake := codertest.New()
+	now := time.Now()
+	id := fake.AddWorkspace(coder.Workspace{Name: "my-dev"})
+	fake.SetBuildLog(id, []coder.BuildLog{
+		{Time: now.Add(-time.Hour), Type: coder.BuildLogTypeStart, Msg: "Starting build"},
+		{Time: now.Add(-time.Hour), Type: coder.BuildLogTypeStage, Msg: "Pulling image"},
+		{Time: now.Add(-time.Hour), Type: coder.BuildLogTypeDone, Msg: "Build complete"},
+	})
+	fake.AddWorkspaceLogs(id,
+		coder.WorkspaceLog{Time: now.Add(-30 * time.Minute), Stream: coder.WorkspaceLogStdout, Msg: "server started"},
+		coder.WorkspaceLog{Time: now.Add(-time.Minute), Stream: coder.WorkspaceLogStderr, Msg: "request failed"},
+		coder.WorkspaceLog{Time: now.Add(-time.Minute), Stream: coder.WorkspaceLogStdout, Msg: "request served"},
+	)
+	useFakeClient(t, fake)
+
+	res := execute(t, nil, "logs", "my-dev")
+	res.success(t)
+	res.stdoutContains(t, "Pulling image\nBuild complete\nserver started\nrequest served")
+	res.stderrContains(t, "request failed")
+
+	res = execute(t, nil, "logs", "my-dev", "--since", "10m", "--tail", "1")
+	res.success(t)
+	assert.Equal(t, "only the last recent line", "request served\n", res.outBuffer.String())
+
+	res = execute(t, nil, "logs", "my-dev", "--source", "build", "--output", "ndjson")
+	res.success(t)
+	lines := strings.Split(strings.TrimSpace(res.outBuffer.String()), "\n")
+	assert.Equal(t, "build lines", 3, len(lines))
+	var line logLine
+	assert.Success(t, "json line", json.Unmarshal([]byte(lines[1]), &line))
+	assert.Equal(t, "source", logsSourceBuild, line.Source)
+	assert.Equal(t, "msg", "Pulling image", line.Msg)
+	outputFormat = humanOutput
+
+	res = execute(t, nil, "logs", "my-dev", "--source", "nope")
+	res.error(t)
+	res = execute(t, nil, "logs", "my-dev", "--since", "yesterday")
+	res.error(t)
+}
+
+func Test_parseLogsSince(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	since, err := parseLogsSince("", now)
+	assert.Success(t, "empty", err)
+	assert.True(t, "zero", since.IsZero())
+	since, err = parseLogsSince("90m", now)
+	assert.Success(t, "duration", err)
+	assert.Equal(t, "duration", now.Add(-90*time.Minute), since)
+	since, err = parseLogsSince("2021-06-01T10:00:00Z", now)
+	assert.Success(t, "time", err)
+	assert.Equal(t, "time", time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), since)
+	_, err = parseLogsSince("-5m", now)
+	assert.Error(t, "negative", err)
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	humanOutput = "human"
+	jsonOutput  = "json"
+	yamlOutput  = "yaml"
+	// ndjsonOutput writes each item of a list as a JSON object on its own
+	// line, so that pipelines can process them as they arrive.
+	ndjsonOutput = "ndjson"
+)
+
+const outputUsage = "output format: human, json, ndjson or yaml"
+
+// outputFormat is the value of the --output flag.
+var outputFormat = humanOutput
+
+// addOutputFlag adds --output to a command that writes with writeOutput. The
+// flag isn't global, so that no command silently ignores it.
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&outputFormat, "output", humanOutput, outputUsage)
+	completeFlagChoices(cmd, "output", humanOutput, jsonOutput, ndjsonOutput, yamlOutput)
+}
+
+// addOutputShorthand is addOutputFlag with -o as the shorthand of --output,
+// for the commands that had it before the others got --output. Not every
+// command has -o, since some use it for other flags.
+func addOutputShorthand(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", humanOutput, outputUsage)
+	completeFlagChoices(cmd, "output", humanOutput, jsonOutput, ndjsonOutput, yamlOutput)
+}
+
+// writeOutput writes v to w in the format of the --output flag: by calling
+// human for humanOutput, which usually writes a table, or by encoding v. With
+// ndjsonOutput, each element of a slice is encoded on its own line. The YAML
+// is converted from the JSON encoding, so that it has the same field names.
+func writeOutput(w io.Writer, v interface{}, human func() error) error {
+	switch outputFormat {
+	case humanOutput:
+		return human()
+	case jsonOutput:
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			return xerrors.Errorf("write JSON: %w", err)
+		}
+		return nil
+	case ndjsonOutput:
+		enc := json.NewEncoder(w)
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			if err := enc.Encode(v); err != nil {
+				return xerrors.Errorf("write JSON: %w", err)
+			}
+			return nil
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+				return xerrors.Errorf("write JSON: %w", err)
+			}
+		}
+		return nil
+	case yamlOutput:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return xerrors.Errorf("encode JSON: %w", err)
+		}
+		var generic interface{}
+		if err := yaml.Unmarshal(raw, &generic); err != nil {
+			return xerrors.Errorf("convert JSON to YAML: %w", err)
+		}
+		out, err := yaml.Marshal(generic)
+		if err != nil {
+			return xerrors.Errorf("encode YAML: %w", err)
+		}
+		if _, err := w.Write(out); err != nil {
+			return xerrors.Errorf("write YAML: %w", err)
+		}
+		return nil
+	default:
+		return xerrors.Errorf("unknown --output value %q, expected human, json, ndjson or yaml", outputFormat)
+	}
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+// Not parallel: writeOutput reads the global --output flag.
+func Test_writeOutput(t *testing.T) {
+	t.Cleanup(func() { outputFormat = humanOutput })
+	type row struct {
+		Name    string    `json:"name"`
+		Created time.Time `json:"created_at"`
+		Port    int       `json:"port,omitempty"`
+	}
+	rows := []row{{Name: "on", Created: time.Date(2021, 5, 4, 13, 2, 0, 0, time.UTC), Port: 8080}, {Name: "b"}}
+	write := func(format string) (string, bool, error) {
+		outputFormat = format
+		var buf bytes.Buffer
+		called := false
+		err := writeOutput(&buf, rows, func() error {
+			called = true
+			return nil
+		})
+		return buf.String(), called, err
+	}
+
+	out, called, err := write(humanOutput)
+	assert.Success(t, "human", err)
+	assert.True(t, "human writes the table", called)
+	assert.Equal(t, "human writes nothing else", "", out)
+
+	out, _, err = write(jsonOutput)
+	assert.Success(t, "json", err)
+	assert.Equal(t, "json", `[{"name":"on","created_at":"2021-05-04T13:02:00Z","port":8080},{"name":"b","created_at":"0001-01-01T00:00:00Z"}]`+"\n", out)
+
+	out, _, err = write(ndjsonOutput)
+	assert.Success(t, "ndjson", err)
+	assert.Equal(t, "ndjson", `{"name":"on","created_at":"2021-05-04T13:02:00Z","port":8080}`+"\n"+`{"name":"b","created_at":"0001-01-01T00:00:00Z"}`+"\n", out)
+
+	out, called, err = write(yamlOutput)
+	assert.Success(t, "yaml", err)
+	assert.False(t, "yaml doesn't write the table", called)
+	assert.Equal(t, "yaml uses the json field names", `- created_at: "2021-05-04T13:02:00Z"
+  name: "on"
+  port: 8080
+- created_at: "0001-01-01T00:00:00Z"
+  name: b
+`, out)
+
+	_, _, err = write("xml")
+	assert.Error(t, "unknown format", err)
+}
+
+func Test_outputFlag(t *testing.T) {
+	fake := codertest.New()
+	fake.AddWorkspace(coder.Workspace{Name: "my-dev"})
+	useFakeClient(t, fake)
+
+	res := execute(t, nil, "workspaces", "ls", "--output", "yaml")
+	res.success(t)
+	res.stdoutContains(t, "name: my-dev")
+
+	res = execute(t, nil, "workspaces", "ls", "-o", "yaml")
+	res.success(t)
+	res.stdoutContains(t, "name: my-dev")
+
+	res = execute(t, nil, "providers", "ls", "--output", "json")
+	res.success(t)
+	res.stdoutContains(t, "[")
+
+	res = execute(t, nil, "workspaces", "ls", "--output", "xml")
+	res.error(t)
+	res.stderrContains(t, "unknown --output value")
+
+	// Commands that don't honor --output reject it rather than ignore it.
+	res = execute(t, nil, "workspaces", "stop", "my-dev", "--output", "json")
+	res.error(t)
+	res.stderrContains(t, "unknown flag: --output")
+}
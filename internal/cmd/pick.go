@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+const pickDone = "✔ done"
+
+// pickArgs validates positional workspace names unless --pick is set,
+// in which case no names may be given.
+func pickArgs(pick *bool) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if *pick {
+			if len(args) > 0 {
+				return xerrors.New("workspace names cannot be combined with --pick")
+			}
+			return nil
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	}
+}
+
+// pickWorkspaces shows a checkbox list of the user's workspaces
+// and returns the names of the ones selected.
+func pickWorkspaces(ctx context.Context, client coder.Client, user, action string) ([]string, error) {
+	if !showInteractiveOutput {
+		return nil, clog.Fatal("--pick requires an interactive terminal",
+			clog.Tipf("pass workspace names as arguments instead"),
+		)
+	}
+	workspaces, err := getWorkspaces(ctx, client, user)
+	if err != nil {
+		return nil, err
+	}
+	if len(workspaces) == 0 {
+		return nil, clog.Fatal("no workspaces found")
+	}
+
+	items := make([]string, len(workspaces))
+	for i, w := range workspaces {
+		items[i] = fmt.Sprintf("%s (%s)", w.Name, w.LatestStat.ContainerStatus)
+	}
+	selected, err := multiSelect(fmt.Sprintf("Select workspaces to %s", action), items)
+	if err != nil {
+		return nil, xerrors.Errorf("select workspaces: %w", err)
+	}
+	if len(selected) == 0 {
+		return nil, clog.Fatal("no workspaces selected")
+	}
+
+	names := make([]string, 0, len(selected))
+	for _, i := range selected {
+		names = append(names, workspaces[i].Name)
+	}
+	return names, nil
+}
+
+// multiSelect renders items as a checkbox list. Choosing an item toggles it,
+// and choosing "done" returns the indices of the checked items.
+func multiSelect(label string, items []string) ([]int, error) {
+	m := newMultiSelectModel(items)
+	for {
+		idx, _, err := (&promptui.Select{
+			Label:        label,
+			Items:        m.options(),
+			Size:         10,
+			CursorPos:    m.cursor,
+			HideSelected: true,
+		}).Run()
+		if err != nil {
+			return nil, err
+		}
+		if m.choose(idx) {
+			return m.selected(), nil
+		}
+	}
+}
+
+// multiSelectModel is the state of a checkbox list, apart from the prompt
+// rendering it.
+type multiSelectModel struct {
+	items   []string
+	checked []bool
+	// cursor is the option the prompt starts on.
+	cursor int
+}
+
+func newMultiSelectModel(items []string) *multiSelectModel {
+	return &multiSelectModel{items: items, checked: make([]bool, len(items))}
+}
+
+// options returns "done" followed by the items with their checkboxes.
+func (m *multiSelectModel) options() []string {
+	options := make([]string, 0, len(m.items)+1)
+	options = append(options, pickDone)
+	for i, item := range m.items {
+		box := "[ ]"
+		if m.checked[i] {
+			box = "[x]"
+		}
+		options = append(options, box+" "+item)
+	}
+	return options
+}
+
+// choose applies choosing the option at idx, and reports whether it was
+// "done". Choosing an item toggles it and leaves the cursor on it.
+func (m *multiSelectModel) choose(idx int) (done bool) {
+	if idx == 0 {
+		return true
+	}
+	m.checked[idx-1] = !m.checked[idx-1]
+	m.cursor = idx
+	return false
+}
+
+// selected returns the indices of the checked items.
+func (m *multiSelectModel) selected() []int {
+	var selected []int
+	for i, c := range m.checked {
+		if c {
+			selected = append(selected, i)
+		}
+	}
+	return selected
+}
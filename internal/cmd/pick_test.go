@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"github.com/spf13/cobra"
+)
+
+func Test_pickArgs(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name      string
+		all, pick bool
+		args      []string
+		ok        bool
+	}{
+		{"names", false, false, []string{"dev", "gpu-*"}, true},
+		{"no names", false, false, nil, false},
+		{"pick", false, true, nil, true},
+		{"pick with names", false, true, []string{"dev"}, false},
+		{"all", true, false, nil, true},
+		{"all with patterns", true, false, []string{"dev-*"}, true},
+		{"all with pick", true, true, nil, false},
+	} {
+		pick := tc.pick
+		batch := &workspaceBatch{all: tc.all}
+		err := batch.args(&pick)(&cobra.Command{}, tc.args)
+		assert.Equal(t, tc.name, tc.ok, err == nil)
+		if !tc.all {
+			err = pickArgs(&pick)(&cobra.Command{}, tc.args)
+			assert.Equal(t, tc.name+" without --all", tc.ok, err == nil)
+		}
+	}
+}
+
+func Test_multiSelectModel(t *testing.T) {
+	t.Parallel()
+	items := []string{"dev (ON)", "gpu (OFF)", "ci (ON)"}
+	for _, tc := range []struct {
+		name    string
+		choices []int
+		want    []int
+		options []string
+	}{
+		{"done at once", nil, nil, []string{pickDone, "[ ] dev (ON)", "[ ] gpu (OFF)", "[ ] ci (ON)"}},
+		{"check", []int{1, 3}, []int{0, 2}, []string{pickDone, "[x] dev (ON)", "[ ] gpu (OFF)", "[x] ci (ON)"}},
+		{"uncheck", []int{2, 1, 2}, []int{0}, []string{pickDone, "[x] dev (ON)", "[ ] gpu (OFF)", "[ ] ci (ON)"}},
+	} {
+		m := newMultiSelectModel(items)
+		for _, idx := range tc.choices {
+			assert.False(t, tc.name+": an item isn't done", m.choose(idx))
+			assert.Equal(t, tc.name+": the cursor stays on the item", idx, m.cursor)
+		}
+		assert.Equal(t, tc.name+": options", tc.options, m.options())
+		assert.True(t, tc.name+": done confirms", m.choose(0))
+		assert.Equal(t, tc.name+": selected", tc.want, m.selected())
+	}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// assetsRootEnv is set in the images of Coder deployments, whose CLI binary
+// is served from it and updated along with the deployment.
+const assetsRootEnv = "CODER_ASSETS_ROOT"
+
+// packageManager owns an install of coder that "coder update" must not
+// replace, as the package manager would be left with a corrupt install.
+type packageManager struct {
+	name string
+	// upgrade is the command updating coder with the package manager, if
+	// there's one to offer.
+	upgrade []string
+	// hint tells how to update coder instead.
+	hint string
+}
+
+// systemBinDirs are where distribution packages install binaries, which
+// users don't install to by hand.
+var systemBinDirs = []string{"/usr/bin", "/usr/sbin", "/bin", "/sbin"}
+
+// detectPackageManager returns the package manager owning the executable,
+// judging by its path with symlinks resolved, or nil if it was installed by
+// hand.
+func detectPackageManager(exe string, getenv func(string) string) *packageManager {
+	slashed := filepath.ToSlash(exe)
+	if root := getenv(assetsRootEnv); root != "" {
+		if _, ok := relativeTo(root, exe); ok {
+			return &packageManager{
+				name: "the Coder deployment",
+				hint: "coder is updated along with the deployment",
+			}
+		}
+	}
+	if strings.HasPrefix(slashed, "/nix/store/") {
+		return &packageManager{
+			name: "Nix",
+			hint: "update coder with Nix, such as with \"nix-env --upgrade\" or by updating your system configuration",
+		}
+	}
+	// Homebrew installs formulae to <prefix>/Cellar/<formula>/<version>,
+	// and links them into <prefix>/bin.
+	if i := strings.Index(slashed, "/Cellar/"); i >= 0 {
+		formula := strings.SplitN(slashed[i+len("/Cellar/"):], "/", 2)[0]
+		return &packageManager{
+			name:    "Homebrew",
+			upgrade: []string{"brew", "upgrade", formula},
+			hint:    fmt.Sprintf("run \"brew upgrade %s\" to update coder", formula),
+		}
+	}
+	for _, dir := range systemBinDirs {
+		if filepath.ToSlash(filepath.Dir(exe)) == dir {
+			return &packageManager{
+				name: "the system package manager",
+				hint: "update coder with the package manager of your distribution, such as apt or dnf",
+			}
+		}
+	}
+	return nil
+}
+
+// refuse explains why the executable isn't updated.
+func (pm *packageManager) refuse(exe string) error {
+	return clog.Error(i18n.Sprintf("%s is managed by %s", exe, pm.name),
+		"replacing it would leave a corrupt install behind",
+		clog.BlankLine,
+		clog.Tipf("%s", pm.hint),
+		clog.Tipf("use \"--ignore-package-manager\" to replace it anyway"),
+	)
+}
+
+// runUpgrade updates coder with the package manager, after confirming it
+// unless force is set.
+func (pm *packageManager) runUpgrade(ctx context.Context, force bool) error {
+	cmdline := strings.Join(pm.upgrade, " ")
+	if !force {
+		if err := confirmUpdate(fmt.Sprintf("coder is installed with %s. Run %q instead?", pm.name, cmdline)); err != nil {
+			return err
+		}
+	}
+	cmd := exec.CommandContext(ctx, pm.upgrade[0], pm.upgrade[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return xerrors.Errorf("run %s: %w", cmdline, err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_detectPackageManager(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{assetsRootEnv: "/var/lib/coder/assets"}
+	getenv := func(key string) string { return env[key] }
+	for _, tc := range []struct {
+		exe     string
+		want    string
+		upgrade []string
+	}{
+		{exe: "/usr/local/bin/coder"},
+		{exe: "/home/me/bin/coder"},
+		{exe: "/usr/local/Cellar/coder-cli/1.21.0/bin/coder", want: "Homebrew", upgrade: []string{"brew", "upgrade", "coder-cli"}},
+		{exe: "/opt/homebrew/Cellar/coder/1.21.0/bin/coder", want: "Homebrew", upgrade: []string{"brew", "upgrade", "coder"}},
+		{exe: "/nix/store/9x3a1kqj0a8mwb9c7lh0ld2ivsj5z0sb-coder-cli-1.21.0/bin/coder", want: "Nix"},
+		{exe: "/usr/bin/coder", want: "the system package manager"},
+		{exe: "/var/lib/coder/assets/coder-cli/coder", want: "the Coder deployment"},
+		{exe: "/var/lib/coder/assets-old/coder"},
+	} {
+		pm := detectPackageManager(tc.exe, getenv)
+		if tc.want == "" {
+			assert.True(t, tc.exe+" installed by hand", pm == nil)
+			continue
+		}
+		assert.True(t, tc.exe+" managed", pm != nil)
+		assert.Equal(t, tc.exe, tc.want, pm.name)
+		assert.Equal(t, tc.exe+" upgrade", tc.upgrade, pm.upgrade)
+	}
+}
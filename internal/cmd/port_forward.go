@@ -0,0 +1,626 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"cdr.dev/slog"
+	"cdr.dev/slog/sloggers/sloghuman"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+	"cdr.dev/coder-cli/wsnet"
+)
+
+// maxReconnectBackoff caps the wait between attempts to reconnect to a
+// workspace.
+const maxReconnectBackoff = 30 * time.Second
+
+// udpSessionIdleTimeout is how long a forwarded UDP session lives without
+// datagrams either way, like the UDP mappings of a NAT.
+const udpSessionIdleTimeout = 2 * time.Minute
+
+func portForwardCmd() *cobra.Command {
+	var (
+		stdio bool
+		relay bool
+		trace wsnetTraceFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "port-forward [workspace_name] [port_spec...]",
+		Short: "Forward local ports to a workspace",
+		Long: "Forward local TCP and UDP ports, or Unix sockets, to a workspace over a peer-to-peer connection, without SSH.\n\n" +
+			"Each port_spec is one of:\n" +
+			"  [tcp:|udp:]local_port[:workspace_port]   a local port, forwarded to the same port of the workspace if workspace_port is left out\n" +
+			"  unix://local_socket:workspace_port         a local Unix socket, readable and writable only by the current user\n\n" +
+			"workspace_port may also be the absolute path of a Unix socket inside the workspace. " +
+			"With --stdio, the single port_spec is the workspace side only, and stdin and stdout are forwarded to it.\n\n" +
+			"If the connection to the workspace is lost, it is established again on the next connection to a forwarded port. " +
+			"Unless UDP is forwarded, the connection is shared with the other sessions to the workspace, as with \"coder ssh\".",
+		Example: `# forward localhost:8080 to port 8080 of the workspace
+coder port-forward my-dev 8080
+
+# forward several ports at once, and a local port to another workspace port
+coder port-forward my-dev 8080 3000:3001 udp:5353:53
+
+# talk to the workspace's docker daemon from the local docker cli
+coder port-forward my-dev unix:///tmp/my-dev-docker.sock:/var/run/docker.sock
+
+# use the workspace's postgres as a ProxyCommand-style pipe
+coder port-forward my-dev --stdio 5432`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if stdio {
+				return cobra.ExactArgs(2)(cmd, args)
+			}
+			return cobra.MinimumNArgs(2)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+			log := slog.Make(sloghuman.Sink(os.Stderr))
+			if verboseAt(verbosityDebug) {
+				log = log.Leveled(slog.LevelDebug)
+			}
+
+			var forwards []portForward
+			if stdio {
+				network, addr, err := parseStdioTarget(args[1])
+				if err != nil {
+					return err
+				}
+				forwards = append(forwards, portForward{remoteNetwork: network, remoteAddr: addr})
+			} else {
+				for _, spec := range args[1:] {
+					f, err := parsePortForward(spec)
+					if err != nil {
+						return err
+					}
+					forwards = append(forwards, f)
+				}
+			}
+
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			baseURL := client.BaseURL()
+			workspaceName, agent, err := splitAgentTarget(args[0])
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, workspaceName, coder.Me)
+			if err != nil {
+				return err
+			}
+			if workspace.LatestStat.ContainerStatus != coder.WorkspaceOn {
+				return clog.Error("workspace not available",
+					fmt.Sprintf("current status: %q", workspace.LatestStat.ContainerStatus),
+					clog.BlankLine,
+					clog.Tipf("use \"coder workspaces start %s\" to start this workspace", workspace.Name),
+				)
+			}
+			if err := findAgent(ctx, client, workspace, agent); err != nil {
+				return err
+			}
+			iceServers, err := client.ICEServers(ctx)
+			if err != nil {
+				return xerrors.Errorf("get ICE servers: %w", err)
+			}
+			tracer, closeTrace, err := trace.open()
+			if err != nil {
+				return err
+			}
+			defer func() { _ = closeTrace() }()
+
+			t := &tunnneler{
+				log:        log,
+				brokerAddr: &baseURL,
+				token:      client.Token(),
+				workspace:  workspace,
+				agent:      agent,
+				iceServers: iceServers,
+				trace:      tracer,
+				relay:      relay,
+			}
+			for _, f := range forwards {
+				// The mux proxies streams, which don't keep datagrams apart.
+				if f.remoteNetwork == "udp" {
+					t.noMux = true
+				}
+			}
+			wd, err := t.connect(ctx)
+			if err != nil {
+				return err
+			}
+			dialer := &reconnectingDialer{
+				log: log,
+				dial: func(ctx context.Context) (connDialer, error) {
+					return t.connect(ctx)
+				},
+				current: wd,
+			}
+			defer dialer.Close()
+			go updateLastConnection(ctx, client, workspace.ID)
+
+			if stdio {
+				nc, err := dialer.DialContext(ctx, forwards[0].remoteNetwork, forwards[0].remoteAddr)
+				if err != nil {
+					return err
+				}
+				defer nc.Close()
+				go func() {
+					_, _ = io.Copy(nc, os.Stdin)
+				}()
+				if _, err := io.Copy(os.Stdout, nc); err != nil {
+					return xerrors.Errorf("copy: %w", err)
+				}
+				return nil
+			}
+
+			// Listen on every port before forwarding any, so that a port in
+			// use fails the command right away.
+			closers := make([]io.Closer, 0, len(forwards))
+			defer func() {
+				for _, c := range closers {
+					_ = c.Close()
+				}
+			}()
+			group, ctx := errgroup.WithContext(ctx)
+			for _, f := range forwards {
+				f := f
+				if f.listenNetwork == "udp" {
+					pc, err := net.ListenPacket(f.listenNetwork, f.listenAddr)
+					if err != nil {
+						return xerrors.Errorf("listen: %w", err)
+					}
+					closers = append(closers, pc)
+					group.Go(func() error { return forwardPackets(ctx, log, pc, dialer, f, udpSessionIdleTimeout) })
+				} else {
+					listener, err := listenLocal(f.listenNetwork, f.listenAddr)
+					if err != nil {
+						return err
+					}
+					closers = append(closers, listener)
+					group.Go(func() error { return forwardConns(ctx, log, listener, dialer, f) })
+				}
+				clog.LogInfo(i18n.Sprintf("forwarding %s to %s of workspace %q", f.local(), f.remote(), workspace.Name))
+			}
+
+			// Close the listeners on interrupt so that unix sockets are
+			// removed.
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+			defer signal.Stop(sigs)
+			group.Go(func() error {
+				select {
+				case <-sigs:
+					cancel()
+				case <-ctx.Done():
+				}
+				for _, c := range closers {
+					_ = c.Close()
+				}
+				return nil
+			})
+			return group.Wait()
+		},
+	}
+	trace.register(cmd)
+	cmd.Flags().BoolVar(&stdio, "stdio", false, "forward stdin and stdout to the workspace port instead of listening locally")
+	cmd.Flags().BoolVar(&relay, "relay", false, "relay traffic through the Coder deployment without trying a peer-to-peer connection")
+	return cmd
+}
+
+// portForward is a local address forwarded to an address in the workspace.
+type portForward struct {
+	listenNetwork string
+	listenAddr    string
+	remoteNetwork string
+	remoteAddr    string
+}
+
+func (f portForward) local() string {
+	return f.listenNetwork + "://" + f.listenAddr
+}
+
+func (f portForward) remote() string {
+	return f.remoteNetwork + "://" + f.remoteAddr
+}
+
+// parsePortForward parses a port_spec argument of "coder port-forward".
+func parsePortForward(spec string) (portForward, error) {
+	if rest := strings.TrimPrefix(spec, "unix://"); rest != spec {
+		i := strings.Index(rest, ":")
+		if i <= 0 {
+			return portForward{}, xerrors.Errorf("invalid port spec %q: expected unix://local_socket:workspace_port", spec)
+		}
+		network, addr, err := parseRemoteAddr(rest[i+1:])
+		if err != nil {
+			return portForward{}, xerrors.Errorf("invalid port spec %q: %w", spec, err)
+		}
+		return portForward{
+			listenNetwork: "unix",
+			listenAddr:    rest[:i],
+			remoteNetwork: network,
+			remoteAddr:    addr,
+		}, nil
+	}
+
+	network, ports := "tcp", spec
+	if rest := strings.TrimPrefix(spec, "udp:"); rest != spec {
+		network, ports = "udp", rest
+	} else {
+		ports = strings.TrimPrefix(spec, "tcp:")
+	}
+	parts := strings.Split(ports, ":")
+	if len(parts) > 2 {
+		return portForward{}, xerrors.Errorf("invalid port spec %q: expected [tcp:|udp:]local_port[:workspace_port]", spec)
+	}
+	local, err := parsePort(parts[0])
+	if err != nil {
+		return portForward{}, xerrors.Errorf("invalid port spec %q: %w", spec, err)
+	}
+	remote := local
+	if len(parts) == 2 {
+		remote, err = parsePort(parts[1])
+		if err != nil {
+			return portForward{}, xerrors.Errorf("invalid port spec %q: %w", spec, err)
+		}
+	}
+	return portForward{
+		listenNetwork: network,
+		listenAddr:    fmt.Sprintf("localhost:%d", local),
+		remoteNetwork: network,
+		remoteAddr:    fmt.Sprintf("localhost:%d", remote),
+	}, nil
+}
+
+// parseStdioTarget parses the workspace side of "coder port-forward --stdio".
+func parseStdioTarget(arg string) (network, address string, err error) {
+	if port := strings.TrimPrefix(arg, "udp:"); port != arg {
+		p, err := parsePort(port)
+		if err != nil {
+			return "", "", err
+		}
+		return "udp", fmt.Sprintf("localhost:%d", p), nil
+	}
+	return parseRemoteAddr(strings.TrimPrefix(arg, "tcp:"))
+}
+
+func parsePort(s string) (uint64, error) {
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || port == 0 {
+		return 0, xerrors.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+// forwardConns forwards each connection accepted by the listener until ctx
+// is done. A connection that can't be dialed in the workspace is closed
+// without stopping the others.
+func forwardConns(ctx context.Context, log slog.Logger, listener net.Listener, dialer *reconnectingDialer, f portForward) error {
+	for {
+		lc, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return xerrors.Errorf("accept: %w", err)
+		}
+		go func() {
+			defer lc.Close()
+			nc, err := dialer.DialContext(ctx, f.remoteNetwork, f.remoteAddr)
+			if err != nil {
+				clog.LogWarn(i18n.Sprintf("failed to forward a connection to %s", f.remote()), err.Error())
+				return
+			}
+			defer nc.Close()
+			log.Debug(ctx, "forwarding connection", slog.F("local", f.local()), slog.F("remote", f.remote()))
+
+			go func() {
+				_, _ = io.Copy(lc, nc)
+				_ = lc.Close()
+			}()
+			_, _ = io.Copy(nc, lc)
+		}()
+	}
+}
+
+// forwardPackets forwards the datagrams received on the packet conn until
+// ctx is done. Each local address gets its own connection to the workspace,
+// which replies are sent back to it through, and which is closed once no
+// datagram went either way for idleTimeout.
+func forwardPackets(ctx context.Context, log slog.Logger, pc net.PacketConn, dialer connDialer, f portForward, idleTimeout time.Duration) error {
+	type session struct {
+		nc         net.Conn
+		lastActive time.Time
+	}
+	var (
+		mu       sync.Mutex
+		sessions = make(map[string]*session)
+		buf      = make([]byte, 64*1024)
+	)
+	touch := func(s *session) {
+		mu.Lock()
+		s.lastActive = time.Now()
+		mu.Unlock()
+	}
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, s := range sessions {
+			_ = s.nc.Close()
+		}
+	}()
+
+	// The connections to the workspace don't support deadlines, so idle
+	// sessions are closed from here, which ends their reply loop.
+	reapCtx, stopReaping := context.WithCancel(ctx)
+	defer stopReaping()
+	go func() {
+		ticker := time.NewTicker(idleTimeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-reapCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			mu.Lock()
+			for key, s := range sessions {
+				if time.Since(s.lastActive) > idleTimeout {
+					log.Debug(ctx, "closing idle datagram session", slog.F("local", key))
+					delete(sessions, key)
+					_ = s.nc.Close()
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return xerrors.Errorf("read: %w", err)
+		}
+		key := addr.String()
+		mu.Lock()
+		s, ok := sessions[key]
+		mu.Unlock()
+		if !ok {
+			nc, err := dialer.DialContext(ctx, f.remoteNetwork, f.remoteAddr)
+			if err != nil {
+				clog.LogWarn(i18n.Sprintf("failed to forward datagrams to %s", f.remote()), err.Error())
+				continue
+			}
+			s = &session{nc: nc, lastActive: time.Now()}
+			mu.Lock()
+			sessions[key] = s
+			mu.Unlock()
+			go func() {
+				defer func() {
+					mu.Lock()
+					if sessions[key] == s {
+						delete(sessions, key)
+					}
+					mu.Unlock()
+					_ = s.nc.Close()
+				}()
+				reply := make([]byte, 64*1024)
+				for {
+					n, err := s.nc.Read(reply)
+					if err != nil {
+						return
+					}
+					touch(s)
+					if _, err := pc.WriteTo(reply[:n], addr); err != nil {
+						return
+					}
+				}
+			}()
+		}
+		touch(s)
+		if _, err := s.nc.Write(buf[:n]); err != nil {
+			log.Debug(ctx, "dropped datagram", slog.F("remote", f.remote()), slog.Error(err))
+		}
+	}
+}
+
+// connDialer is the part of *wsnet.Dialer used to forward ports.
+type connDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+var _ connDialer = &wsnet.Dialer{}
+
+// reconnectingDialer dials addresses in the workspace through the current
+// dialer, connecting to the workspace again if the connection was lost.
+type reconnectingDialer struct {
+	log  slog.Logger
+	dial func(ctx context.Context) (connDialer, error)
+
+	mu      sync.Mutex
+	current connDialer
+	// connecting is closed once the reconnect in progress, if any, ends.
+	connecting chan struct{}
+	closed     bool
+}
+
+// DialContext dials the address in the workspace. When dialing fails and the
+// connection to the workspace doesn't answer pings anymore, it reconnects and
+// dials again.
+func (r *reconnectingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d, err := r.dialer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nc, err := d.DialContext(ctx, network, address)
+	if err == nil {
+		return nc, nil
+	}
+	if pingErr := d.Ping(ctx); pingErr == nil {
+		// The workspace is reachable, the address itself can't be dialed.
+		return nil, err
+	}
+	r.reset(d)
+	clog.LogWarn("lost the connection to the workspace, reconnecting...")
+	d, err = r.dialer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d.DialContext(ctx, network, address)
+}
+
+// dialer returns the current dialer, connecting to the workspace with
+// exponential backoff if there is none. Callers arriving while another
+// reconnects wait for it rather than dialing too.
+func (r *reconnectingDialer) dialer(ctx context.Context) (connDialer, error) {
+	for {
+		r.mu.Lock()
+		if r.current != nil {
+			d := r.current
+			r.mu.Unlock()
+			return d, nil
+		}
+		if r.closed {
+			r.mu.Unlock()
+			return nil, xerrors.New("dialer closed")
+		}
+		if r.connecting == nil {
+			r.connecting = make(chan struct{})
+			r.mu.Unlock()
+			return r.reconnect(ctx)
+		}
+		connecting := r.connecting
+		r.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-connecting:
+		}
+	}
+}
+
+// reconnect connects to the workspace with exponential backoff, without
+// holding the lock so that other callers can give up while it waits.
+func (r *reconnectingDialer) reconnect(ctx context.Context) (connDialer, error) {
+	done := func(d connDialer) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		close(r.connecting)
+		r.connecting = nil
+		if d == nil {
+			return nil
+		}
+		if r.closed {
+			_ = d.Close()
+			return xerrors.New("dialer closed")
+		}
+		r.current = d
+		clog.LogSuccess("reconnected to the workspace")
+		return nil
+	}
+	backoff := time.Second
+	for {
+		d, err := r.dial(ctx)
+		if err == nil {
+			if err := done(d); err != nil {
+				return nil, err
+			}
+			return d, nil
+		}
+		r.log.Debug(ctx, "reconnect failed", slog.F("retry_in", backoff), slog.Error(err))
+		select {
+		case <-ctx.Done():
+			_ = done(nil)
+			return nil, err
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// Ping pings the workspace through the current dialer, connecting to it
+// first if needed.
+func (r *reconnectingDialer) Ping(ctx context.Context) error {
+	d, err := r.dialer(ctx)
+	if err != nil {
+		return err
+	}
+	return d.Ping(ctx)
+}
+
+// watch connects to the workspace again as soon as the connection is closed,
+// such as by a failed keepalive, rather than on the next dial. It returns an
+// error if reconnecting fails for longer than timeout.
+func (r *reconnectingDialer) watch(ctx context.Context, timeout time.Duration) error {
+	for {
+		reconnectCtx, cancel := context.WithTimeout(ctx, timeout)
+		d, err := r.dialer(reconnectCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return xerrors.Errorf("reconnect to the workspace: %w", err)
+		}
+		closer, ok := d.(interface{ Closed() <-chan struct{} })
+		if !ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-closer.Closed():
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		r.reset(d)
+		clog.LogWarn("lost the connection to the workspace, reconnecting...")
+	}
+}
+
+// reset drops the dialer, unless another connection already replaced it.
+func (r *reconnectingDialer) reset(d connDialer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current == d {
+		_ = d.Close()
+		r.current = nil
+	}
+}
+
+// Close closes the current dialer, and the one a reconnect in progress ends
+// up with.
+func (r *reconnectingDialer) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
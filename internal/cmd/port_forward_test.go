@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+func Test_parsePortForward(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		spec    string
+		want    portForward
+		wantErr bool
+	}{
+		{spec: "8080", want: portForward{"tcp", "localhost:8080", "tcp", "localhost:8080"}},
+		{spec: "tcp:8080:3000", want: portForward{"tcp", "localhost:8080", "tcp", "localhost:3000"}},
+		{spec: "udp:5353:53", want: portForward{"udp", "localhost:5353", "udp", "localhost:53"}},
+		{spec: "unix:///tmp/db.sock:5432", want: portForward{"unix", "/tmp/db.sock", "tcp", "localhost:5432"}},
+		{spec: "unix:///tmp/d.sock:/var/run/docker.sock", want: portForward{"unix", "/tmp/d.sock", "unix", "/var/run/docker.sock"}},
+		{spec: "0", wantErr: true},
+		{spec: "70000", wantErr: true},
+		{spec: "1:2:3", wantErr: true},
+		{spec: "unix:///tmp/db.sock", wantErr: true},
+		{spec: "sctp:80", wantErr: true},
+	}
+	for _, tt := range tests {
+		f, err := parsePortForward(tt.spec)
+		if tt.wantErr {
+			assert.Error(t, tt.spec, err)
+			continue
+		}
+		assert.Success(t, tt.spec, err)
+		assert.Equal(t, tt.spec, tt.want, f)
+	}
+
+	network, addr, err := parseStdioTarget("udp:53")
+	assert.Success(t, "stdio udp", err)
+	assert.Equal(t, "stdio udp", "udp://localhost:53", network+"://"+addr)
+}
+
+// fakeConnDialer dials the local network, standing in for a connection to
+// a workspace.
+type fakeConnDialer struct {
+	down   int32
+	closed int32
+}
+
+func (d *fakeConnDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if atomic.LoadInt32(&d.down) == 1 {
+		return nil, xerrors.New("connection lost")
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, address)
+}
+
+func (d *fakeConnDialer) Ping(context.Context) error {
+	if atomic.LoadInt32(&d.down) == 1 {
+		return xerrors.New("connection lost")
+	}
+	return nil
+}
+
+func (d *fakeConnDialer) Close() error {
+	atomic.StoreInt32(&d.closed, 1)
+	return nil
+}
+
+func Test_reconnectingDialer(t *testing.T) {
+	t.Parallel()
+	clog.SetOutput(ioutil.Discard)
+	t.Cleanup(func() { clog.SetOutput(os.Stderr) })
+	ctx := context.Background()
+
+	remote, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Success(t, "listen", err)
+	t.Cleanup(func() { _ = remote.Close() })
+	go func() {
+		for {
+			c, err := remote.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = c.Write([]byte("hi"))
+			_ = c.Close()
+		}
+	}()
+
+	first := &fakeConnDialer{}
+	var dials int32
+	dialer := &reconnectingDialer{
+		log: slogtest.Make(t, nil),
+		dial: func(context.Context) (connDialer, error) {
+			atomic.AddInt32(&dials, 1)
+			return &fakeConnDialer{}, nil
+		},
+		current: first,
+	}
+
+	local, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Success(t, "listen", err)
+	t.Cleanup(func() { _ = local.Close() })
+	go func() {
+		_ = forwardConns(ctx, slogtest.Make(t, nil), local, dialer, portForward{remoteNetwork: "tcp", remoteAddr: remote.Addr().String()})
+	}()
+	read := func() string {
+		c, err := net.Dial("tcp", local.Addr().String())
+		assert.Success(t, "dial forwarded port", err)
+		defer c.Close()
+		b, err := ioutil.ReadAll(c)
+		assert.Success(t, "read", err)
+		return string(b)
+	}
+
+	assert.Equal(t, "forwarded", "hi", read())
+	assert.Equal(t, "no reconnect", int32(0), atomic.LoadInt32(&dials))
+
+	atomic.StoreInt32(&first.down, 1)
+	assert.Equal(t, "forwarded after reconnecting", "hi", read())
+	assert.Equal(t, "reconnected once", int32(1), atomic.LoadInt32(&dials))
+	assert.Equal(t, "lost dialer closed", int32(1), atomic.LoadInt32(&first.closed))
+
+	_, err = dialer.DialContext(ctx, "tcp", "127.0.0.1:1")
+	assert.Error(t, "refused", err)
+	assert.Equal(t, "refused port doesn't reconnect", int32(1), atomic.LoadInt32(&dials))
+}
+
+func Test_reconnectingDialer_backoff(t *testing.T) {
+	t.Parallel()
+	dialer := &reconnectingDialer{
+		log: slogtest.Make(t, nil),
+		dial: func(context.Context) (connDialer, error) {
+			return nil, xerrors.New("workspace unreachable")
+		},
+	}
+
+	// A caller that keeps retrying doesn't hold back the others.
+	retryCtx, stopRetrying := context.WithCancel(context.Background())
+	retrying := make(chan error, 1)
+	go func() {
+		_, err := dialer.dialer(retryCtx)
+		retrying <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := dialer.dialer(ctx)
+	assert.Error(t, "gave up", err)
+	assert.True(t, "gave up without waiting for the backoff", time.Since(start) < time.Second)
+
+	stopRetrying()
+	assert.Error(t, "retrying caller gave up", <-retrying)
+}
+
+func Test_forwardPackets(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	remote, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Success(t, "listen", err)
+	t.Cleanup(func() { _ = remote.Close() })
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := remote.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = remote.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	local, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Success(t, "listen", err)
+	t.Cleanup(func() { _ = local.Close() })
+	dialer := &countingConnDialer{}
+	go func() {
+		_ = forwardPackets(ctx, slogtest.Make(t, nil), local, dialer,
+			portForward{remoteNetwork: "udp", remoteAddr: remote.LocalAddr().String()}, 200*time.Millisecond)
+	}()
+
+	client, err := net.Dial("udp", local.LocalAddr().String())
+	assert.Success(t, "dial forwarded port", err)
+	defer client.Close()
+	echo := func(msg string) string {
+		_, err := client.Write([]byte(msg))
+		assert.Success(t, "write", err)
+		assert.Success(t, "set deadline", client.SetReadDeadline(time.Now().Add(5*time.Second)))
+		buf := make([]byte, 1024)
+		n, err := client.Read(buf)
+		assert.Success(t, "read", err)
+		return string(buf[:n])
+	}
+
+	assert.Equal(t, "forwarded", "one", echo("one"))
+	assert.Equal(t, "same session", "two", echo("two"))
+	assert.Equal(t, "dialed once", int32(1), atomic.LoadInt32(&dialer.dials))
+
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, "forwarded after idling", "three", echo("three"))
+	assert.Equal(t, "idle session replaced", int32(2), atomic.LoadInt32(&dialer.dials))
+}
+
+// countingConnDialer dials addresses directly, counting the dials.
+type countingConnDialer struct {
+	fakeConnDialer
+	dials int32
+}
+
+func (d *countingConnDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	atomic.AddInt32(&d.dials, 1)
+	return d.fakeConnDialer.DialContext(ctx, network, address)
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// diskSpaceMargin is left free on top of the size of large writes, so that
+// they don't fill up the disk.
+const diskSpaceMargin = 16 << 20
+
+// checkDiskSpace fails with an actionable error if the filesystem of dir
+// can't fit need bytes. Filesystems that don't report their free space are
+// left to fail the write instead.
+func checkDiskSpace(dir string, need uint64) error {
+	free, err := diskFree(dir)
+	if err != nil {
+		return nil
+	}
+	if free >= need+diskSpaceMargin {
+		return nil
+	}
+	return clog.Error(i18n.Sprintf("not enough disk space in %s", dir),
+		fmt.Sprintf("%s are needed, but only %s are free", formatBytes(need+diskSpaceMargin), formatBytes(free)),
+		clog.BlankLine,
+		clog.Tipf("free up space in %s and try again", dir),
+	)
+}
+
+// checkWritable fails with an actionable error unless files can be created
+// in dir and renamed within it, which replacing a file atomically needs.
+func checkWritable(dir string) error {
+	probe, err := ioutil.TempFile(dir, ".coder-preflight-")
+	if err != nil {
+		if os.IsPermission(err) {
+			return clog.Error(i18n.Sprintf("no permission to write to %s", dir),
+				clog.BlankLine,
+				clog.Tipf("run the command as a user that can write to %s, such as with sudo", dir),
+			)
+		}
+		return xerrors.Errorf("write to %s: %w", dir, err)
+	}
+	_ = probe.Close()
+	defer os.Remove(probe.Name())
+	renamed := probe.Name() + ".renamed"
+	if err := os.Rename(probe.Name(), renamed); err != nil {
+		return clog.Error(i18n.Sprintf("files can't be renamed in %s", dir),
+			err.Error(),
+			clog.BlankLine,
+			clog.Tipf("files are replaced by renaming a complete copy over them, so that a failed write never leaves a truncated file"),
+		)
+	}
+	_ = os.Remove(renamed)
+	return nil
+}
+
+// renameFile renames src to dst. Where they're on different filesystems,
+// src is copied to a temp file next to dst, which is then renamed over dst,
+// so that dst is never left partially written.
+func renameFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	var linkErr *os.LinkError
+	if err == nil || !xerrors.As(err, &linkErr) || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return err
+	}
+	_ = in.Close()
+	return os.Remove(src)
+}
+
+// formatBytes formats a size in bytes with binary units, like "12.3 MiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_formatBytes(t *testing.T) {
+	t.Parallel()
+	for n, want := range map[uint64]string{
+		0:                       "0 B",
+		1023:                    "1023 B",
+		1024:                    "1.0 KiB",
+		12*1024*1024 + 300*1024: "12.3 MiB",
+		5 << 30:                 "5.0 GiB",
+	} {
+		assert.Equal(t, "format", want, formatBytes(n))
+	}
+}
+
+func Test_preflight(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	assert.Success(t, "writable", checkWritable(dir))
+	assert.Success(t, "space for a small write", checkDiskSpace(dir, 1024))
+	assert.ErrorContains(t, "space for too large a write", checkDiskSpace(dir, math.MaxUint64-diskSpaceMargin), "not enough disk space")
+
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	assert.Success(t, "write", ioutil.WriteFile(src, []byte("new"), 0755))
+	assert.Success(t, "write", ioutil.WriteFile(dst, []byte("old"), 0755))
+	assert.Success(t, "rename", renameFile(src, dst))
+	content, err := ioutil.ReadFile(dst)
+	assert.Success(t, "read", err)
+	assert.Equal(t, "replaced", "new", string(content))
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+// progressIntervalEnv sets the interval of progress lines, like the global
+// --progress-interval flag.
+const progressIntervalEnv = "CODER_PROGRESS_INTERVAL"
+
+const defaultProgressInterval = 30 * time.Second
+
+// progressInterval is the value of the global --progress-interval flag.
+var progressInterval time.Duration
+
+// resolveProgressInterval applies the env variable unless the flag is set.
+func resolveProgressInterval(cmd *cobra.Command) error {
+	env := os.Getenv(progressIntervalEnv)
+	if env == "" || cmd.Flags().Changed("progress-interval") {
+		return nil
+	}
+	interval, err := time.ParseDuration(env)
+	if err != nil {
+		return xerrors.Errorf("invalid %s %q: %w", progressIntervalEnv, env, err)
+	}
+	progressInterval = interval
+	return nil
+}
+
+// progressEvery returns how often long operations log their progress as a
+// single line, or 0 if they don't: on a terminal, spinners show it instead.
+func progressEvery() time.Duration {
+	if showInteractiveOutput {
+		return 0
+	}
+	return progressInterval
+}
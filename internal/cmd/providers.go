@@ -5,6 +5,7 @@ import (
 	"net/url"
 
 	"cdr.dev/coder-cli/internal/coderutil"
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/internal/x/xcobra"
 
 	"github.com/spf13/cobra"
@@ -12,7 +13,6 @@ import (
 
 	"cdr.dev/coder-cli/coder-sdk"
 	"cdr.dev/coder-cli/pkg/clog"
-	"cdr.dev/coder-cli/pkg/tablewriter"
 )
 
 func providersCmd() *cobra.Command {
@@ -91,10 +91,10 @@ has a valid SSL certificate. See https://coder.com/docs/guides/ssl-certificates
 for more information.`
 			}
 
-			clog.LogSuccess(fmt.Sprintf(`
+			clog.LogSuccess(i18n.Sprintf(`
 Created workspace provider "%s"
 `, createReq.Name))
-			_ = tablewriter.WriteTable(cmd.OutOrStdout(), 1, func(i int) interface{} {
+			_ = writeTable(cmd.OutOrStdout(), 1, func(i int) interface{} {
 				return *wp
 			})
 			_, _ = fmt.Fprint(cmd.OutOrStdout(), `
@@ -130,6 +130,7 @@ https://github.com/cdr/enterprise-helm/blob/workspace-providers-envproxy-only/RE
 	cmd.Flags().StringVar(&clusterAddress, "cluster-address", "", "kubernetes cluster apiserver endpoint")
 	_ = cmd.MarkFlagRequired("hostname")
 	_ = cmd.MarkFlagRequired("cluster-address")
+	requireRoles(cmd, coder.SiteAdmin)
 	return cmd
 }
 
@@ -153,15 +154,21 @@ coder providers ls`,
 				return xerrors.Errorf("list workspace providers: %w", err)
 			}
 
-			err = tablewriter.WriteTable(cmd.OutOrStdout(), len(wps.Kubernetes), func(i int) interface{} {
-				return wps.Kubernetes[i]
-			})
-			if err != nil {
-				return xerrors.Errorf("write table: %w", err)
+			if wps.Kubernetes == nil {
+				wps.Kubernetes = []coder.KubernetesProvider{} // ensures that json output still marshals
 			}
-			return nil
+			return writeOutput(cmd.OutOrStdout(), wps.Kubernetes, func() error {
+				err := writeTable(cmd.OutOrStdout(), len(wps.Kubernetes), func(i int) interface{} {
+					return wps.Kubernetes[i]
+				})
+				if err != nil {
+					return xerrors.Errorf("write table: %w", err)
+				}
+				return nil
+			})
 		},
 	}
+	addOutputFlag(cmd)
 	return cmd
 }
 
@@ -209,7 +216,7 @@ coder providers rm my-workspace-provider`,
 						)
 					}
 
-					clog.LogSuccess(fmt.Sprintf(`removed workspace provider with name "%s"`, name))
+					clog.LogSuccess(i18n.Sprintf(`removed workspace provider with name "%s"`, name))
 
 					return nil
 				})
@@ -217,6 +224,7 @@ coder providers rm my-workspace-provider`,
 			return egroup.Wait()
 		},
 	}
+	requireRoles(cmd, coder.SiteAdmin)
 	return cmd
 }
 
@@ -246,12 +254,13 @@ coder providers cordon my-workspace-provider --reason "limit cloud clost"`,
 			if err := client.CordonWorkspaceProvider(ctx, provider.ID, reason); err != nil {
 				return err
 			}
-			clog.LogSuccess(fmt.Sprintf("provider %q successfully cordoned - you can no longer create workspaces on this provider without uncordoning first", wpName))
+			clog.LogSuccess(i18n.Sprintf("provider %q successfully cordoned - you can no longer create workspaces on this provider without uncordoning first", wpName))
 			return nil
 		},
 	}
 	cmd.Flags().StringVar(&reason, "reason", "", "reason for cordoning the provider")
 	_ = cmd.MarkFlagRequired("reason")
+	requireRoles(cmd, coder.SiteAdmin)
 	return cmd
 }
 
@@ -279,10 +288,11 @@ coder providers uncordon my-workspace-provider`,
 			if err := client.UnCordonWorkspaceProvider(ctx, provider.ID); err != nil {
 				return err
 			}
-			clog.LogSuccess(fmt.Sprintf("provider %q successfully uncordoned - you can now create workspaces on this provider", wpName))
+			clog.LogSuccess(i18n.Sprintf("provider %q successfully uncordoned - you can now create workspaces on this provider", wpName))
 			return nil
 		},
 	}
+	requireRoles(cmd, coder.SiteAdmin)
 	return cmd
 }
 
@@ -311,9 +321,10 @@ coder providers rename build-in us-east-1`,
 			if err := client.RenameWorkspaceProvider(ctx, provider.ID, newName); err != nil {
 				return err
 			}
-			clog.LogSuccess(fmt.Sprintf("provider %s successfully renamed to %s", oldName, newName))
+			clog.LogSuccess(i18n.Sprintf("provider %s successfully renamed to %s", oldName, newName))
 			return nil
 		},
 	}
+	requireRoles(cmd, coder.SiteAdmin)
 	return cmd
 }
@@ -13,6 +13,7 @@ import (
 	"golang.org/x/xerrors"
 
 	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/internal/x/xcobra"
 	"cdr.dev/coder-cli/pkg/clog"
 )
@@ -21,59 +22,104 @@ func rebuildWorkspaceCommand() *cobra.Command {
 	var follow bool
 	var force bool
 	var user string
+	var pick bool
+	var batch workspaceBatch
 	cmd := &cobra.Command{
-		Use:   "rebuild [workspace_name]",
-		Short: "rebuild a Coder workspace",
-		Args:  xcobra.ExactArgs(1),
+		Use:   "rebuild [...workspace_names]",
+		Short: "rebuild Coder workspaces",
+		Long: "Rebuild Coder workspaces by name. Names may be glob patterns, such as \"ci-*\", " +
+			"and --all rebuilds every workspace of --user, or of every user for site admins.",
+		Args: batch.args(&pick),
 		Example: `coder workspaces rebuild front-end-workspace --follow
-coder workspaces rebuild backend-workspace --force`,
+coder workspaces rebuild backend-workspace --force
+coder workspaces rebuild 'ci-*' --force --parallel 4
+coder workspaces rebuild --pick`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 			client, err := newClient(ctx, true)
 			if err != nil {
 				return err
 			}
-			workspace, err := findWorkspace(ctx, client, args[0], user)
+			if pick {
+				if args, err = pickWorkspaces(ctx, client, user, "rebuild"); err != nil {
+					return err
+				}
+			}
+			workspaces, err := batch.resolve(ctx, cmd, client, user, args)
 			if err != nil {
 				return err
 			}
-
-			if !force && workspace.LatestStat.ContainerStatus == coder.WorkspaceOn {
-				_, err = (&promptui.Prompt{
-					Label:     fmt.Sprintf("Rebuild workspace %q? (will destroy any work outside of your home directory)", workspace.Name),
-					IsConfirm: true,
-				}).Run()
-				if err != nil {
-					return clog.Fatal(
-						"failed to confirm prompt", clog.BlankLine,
-						clog.Tipf(`use "--force" to rebuild without a confirmation prompt`),
-					)
-				}
+			if len(workspaces) == 0 {
+				clog.LogInfo("no workspaces to rebuild")
+				return nil
 			}
-
-			if err = client.RebuildWorkspace(ctx, workspace.ID); err != nil {
-				return err
+			if follow && len(workspaces) > 1 {
+				return clog.Error("--follow can only be used when rebuilding a single workspace",
+					clog.BlankLine,
+					clog.Tipf("run \"coder workspaces watch <workspace_name>\" to follow each build separately"),
+				)
 			}
-			if follow {
-				if err = trailBuildLogs(ctx, client, workspace.ID); err != nil {
+			if !force {
+				if err := confirmRebuild(workspaces); err != nil {
 					return err
 				}
-			} else {
-				clog.LogSuccess(
-					"successfully started rebuild",
-					clog.Tipf("run \"coder workspaces watch-build %s\" to follow the build logs", workspace.Name),
-				)
 			}
-			return nil
+			return batch.run(workspaces, func(workspace coder.Workspace) error {
+				return startRebuild(ctx, client, &workspace, follow)
+			})
 		},
 	}
 
 	cmd.Flags().StringVar(&user, "user", coder.Me, "Specify the user whose resources to target")
 	cmd.Flags().BoolVar(&follow, "follow", false, "follow build log after initiating rebuild")
 	cmd.Flags().BoolVar(&force, "force", false, "force rebuild without showing a confirmation prompt")
+	cmd.Flags().BoolVar(&pick, "pick", false, "interactively select the workspaces to rebuild")
+	batch.register(cmd, "rebuild")
+	addImpersonationFlags(cmd)
 	return cmd
 }
 
+// confirmRebuild prompts before rebuilding workspaces that are on, as any
+// work outside of their home directory is lost.
+func confirmRebuild(workspaces []coder.Workspace) error {
+	var on []coder.Workspace
+	for _, w := range workspaces {
+		if w.LatestStat.ContainerStatus == coder.WorkspaceOn {
+			on = append(on, w)
+		}
+	}
+	if len(on) == 0 {
+		return nil
+	}
+	_, err := (&promptui.Prompt{
+		Label:     fmt.Sprintf("Rebuild %s? (will destroy any work outside of your home directory)", workspaceNames(on)),
+		IsConfirm: true,
+	}).Run()
+	if err != nil {
+		return clog.Fatal(
+			"failed to confirm prompt", clog.BlankLine,
+			clog.Tipf(`use "--force" to rebuild without a confirmation prompt`),
+		)
+	}
+	return nil
+}
+
+// startRebuild starts a rebuild of the workspace, following its build log
+// if follow is set.
+func startRebuild(ctx context.Context, client coder.Client, workspace *coder.Workspace, follow bool) error {
+	if err := client.RebuildWorkspace(ctx, workspace.ID); err != nil {
+		return clog.Error(i18n.Sprintf("failed to rebuild workspace %q", workspace.Name), clog.Causef(err.Error()))
+	}
+	if follow {
+		return trailBuildLogs(ctx, client, workspace.ID)
+	}
+	clog.LogSuccess(
+		fmt.Sprintf("successfully started rebuild of %q", workspace.Name),
+		clog.Tipf("run \"coder workspaces watch-build %s\" to follow the build logs", workspace.Name),
+	)
+	return nil
+}
+
 // trailBuildLogs follows the build log for a given workspace and prints the staged
 // output with loaders and success/failure indicators for each stage.
 func trailBuildLogs(ctx context.Context, client coder.Client, workspaceID string) error {
@@ -90,6 +136,15 @@ func trailBuildLogs(ctx context.Context, client coder.Client, workspaceID string
 		return err
 	}
 
+	// Without a terminal, the current stage is repeated periodically
+	// instead, so that CI logs show the build is still going.
+	var heartbeat *clog.Heartbeat
+	defer func() {
+		if heartbeat != nil {
+			heartbeat.Stop()
+		}
+	}()
+
 	var s *spinner.Spinner
 	for l := range logs {
 		if l.Err != nil {
@@ -107,6 +162,10 @@ func trailBuildLogs(ctx context.Context, client coder.Client, workspaceID string
 		case coder.BuildLogTypeStage:
 			if !isTerminal {
 				fmt.Println(msg)
+				if heartbeat == nil {
+					heartbeat = clog.StartHeartbeat(l.BuildLog.Msg, progressEvery())
+				}
+				heartbeat.Set(l.BuildLog.Msg)
 				continue
 			}
 
@@ -122,7 +181,7 @@ func trailBuildLogs(ctx context.Context, client coder.Client, workspaceID string
 
 		case coder.BuildLogTypeSubstage:
 			// TODO(@f0ssel) add verbose substage printing
-			if !verbose {
+			if !verboseAt(verbosityInfo) {
 				continue
 			}
 
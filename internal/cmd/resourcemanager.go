@@ -54,7 +54,10 @@ coder resources top --sort-by memory --show-empty`,
 	cmd.Flags().StringVar(&options.org, "org", "", "filter by the name of an organization")
 	cmd.Flags().StringVar(&options.provider, "provider", "", "filter by the name of a workspace provider")
 	cmd.Flags().StringVar(&options.sortBy, "sort-by", "cpu", "field to sort aggregate groups and workspaces by (cpu|memory)")
+	completeFlagChoices(cmd, "group", "user", "org", "provider")
+	completeFlagChoices(cmd, "sort-by", "cpu", "memory")
 	cmd.Flags().BoolVar(&options.showEmptyGroups, "show-empty", false, "show groups with zero active workspaces")
+	addOutputFlag(cmd)
 
 	return cmd
 }
@@ -219,6 +222,7 @@ func aggregateByProvider(data entities, options resourceTopOptions) ([]groupable
 // groupable specifies a structure capable of being an aggregation group of workspaces (user, org, all).
 type groupable interface {
 	header() string
+	name() string
 	workspaces() []coder.Workspace
 }
 
@@ -231,6 +235,10 @@ func (u userGrouping) workspaces() []coder.Workspace {
 	return u.userWorkspaces
 }
 
+func (u userGrouping) name() string {
+	return u.user.Email
+}
+
 func (u userGrouping) header() string {
 	return fmt.Sprintf("%s\t(%s)", truncate(u.user.Name, 20, "..."), u.user.Email)
 }
@@ -244,6 +252,10 @@ func (o orgGrouping) workspaces() []coder.Workspace {
 	return o.orgWorkspaces
 }
 
+func (o orgGrouping) name() string {
+	return o.org.Name
+}
+
 func (o orgGrouping) header() string {
 	plural := "s"
 	if len(o.org.Members) == 1 {
@@ -261,14 +273,25 @@ func (p providerGrouping) workspaces() []coder.Workspace {
 	return p.providerWorkspaces
 }
 
+func (p providerGrouping) name() string {
+	return p.provider.Name
+}
+
 func (p providerGrouping) header() string {
 	return fmt.Sprintf("%s\t", truncate(p.provider.Name, 20, "..."))
 }
 
-func printResourceTop(writer io.Writer, groups []groupable, labeler workspaceLabeler, showEmptyGroups bool, sortBy string) error {
-	tabwriter := tabwriter.NewWriter(writer, 0, 0, 4, ' ', 0)
-	defer func() { _ = tabwriter.Flush() }()
+// resourceTopGroup is a group of resources top in json and yaml output.
+type resourceTopGroup struct {
+	Group               string            `json:"group"`
+	CPUAllocation       float32           `json:"cpu_allocation"`
+	CPUUtilization      float32           `json:"cpu_utilization"`
+	MemoryAllocationGB  float32           `json:"memory_allocation_gb"`
+	MemoryUtilizationGB float32           `json:"memory_utilization_gb"`
+	Workspaces          []coder.Workspace `json:"workspaces"`
+}
 
+func printResourceTop(writer io.Writer, groups []groupable, labeler workspaceLabeler, showEmptyGroups bool, sortBy string) error {
 	var userResources []aggregatedResources
 	for _, group := range groups {
 		if !showEmptyGroups && len(group.workspaces()) < 1 {
@@ -284,9 +307,35 @@ func printResourceTop(writer io.Writer, groups []groupable, labeler workspaceLab
 		return err
 	}
 
+	structured := make([]resourceTopGroup, 0, len(userResources))
+	for _, u := range userResources {
+		workspaces := u.workspaces()
+		if workspaces == nil {
+			workspaces = []coder.Workspace{}
+		}
+		structured = append(structured, resourceTopGroup{
+			Group:               u.name(),
+			CPUAllocation:       u.cpuAllocation,
+			CPUUtilization:      u.cpuUtilization,
+			MemoryAllocationGB:  u.memAllocation,
+			MemoryUtilizationGB: u.memUtilization,
+			Workspaces:          workspaces,
+		})
+	}
+	return writeOutput(writer, structured, func() error {
+		writeResourceTop(writer, userResources, labeler)
+		return nil
+	})
+}
+
+// writeResourceTop writes the groups of resources top as a table.
+func writeResourceTop(writer io.Writer, userResources []aggregatedResources, labeler workspaceLabeler) {
+	tabwriter := tabwriter.NewWriter(writer, 0, 0, 4, ' ', 0)
+	defer func() { _ = tabwriter.Flush() }()
+
 	for _, u := range userResources {
 		_, _ = fmt.Fprintf(tabwriter, "%s\t%s", u.header(), u.resources)
-		if verbose {
+		if verboseAt(verbosityInfo) {
 			if len(u.workspaces()) > 0 {
 				_, _ = fmt.Fprintf(tabwriter, "\f")
 			}
@@ -303,7 +352,6 @@ func printResourceTop(writer io.Writer, groups []groupable, labeler workspaceLab
 			clog.Tipf("run \"--show-empty\" to see groups with no resources."),
 		)
 	}
-	return nil
 }
 
 func sortAggregatedResources(resources []aggregatedResources, sortBy string) error {
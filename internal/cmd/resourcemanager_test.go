@@ -16,7 +16,7 @@ var write = flag.Bool("write", false, "write to the golden files")
 
 func Test_resourceManager(t *testing.T) {
 	// TODO: cleanup
-	verbose = true
+	verbosity = verbosityInfo
 
 	const goldenFile = "resourcemanager_test.golden"
 	var buff bytes.Buffer
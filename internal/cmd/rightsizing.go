@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// rightsizingOptions are the thresholds used to recommend workspace resources.
+type rightsizingOptions struct {
+	percentile float64
+	headroom   float64
+	threshold  float64
+	minSamples int
+	minCPU     float32
+	minMemory  float32
+}
+
+// statSampler returns the utilization samples of a workspace.
+type statSampler func(ctx context.Context, w coder.Workspace) ([]coder.WorkspaceStat, error)
+
+func rightsizingCmd() *cobra.Command {
+	var (
+		opts      rightsizingOptions
+		sampleFor time.Duration
+		user      string
+		all       bool
+		apply     bool
+		rebuild   bool
+		force     bool
+	)
+	cmd := &cobra.Command{
+		Use:   "rightsizing",
+		Short: "recommend CPU and memory for workspaces from their utilization",
+		Long: "Recommend new CPU and memory values for workspaces, from their utilization. " +
+			"The latest stats of every workspace are used, together with the stats the running workspaces report " +
+			"while they are watched for --sample-for. " +
+			"The recommendation is a percentile of the utilization plus headroom, and is only made when it differs " +
+			"from the current value by more than the threshold.\n\n" +
+			"With --apply --rebuild the recommendations are applied after a confirmation prompt, which rebuilds the workspaces.",
+		Example: `# plan the quarterly right-sizing of every workspace (requires site admin)
+coder workspaces rightsizing --all --sample-for 30m
+
+# be more generous, and apply the plan
+coder workspaces rightsizing --all --percentile 99 --headroom 0.5 --apply --rebuild`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if apply && !rebuild {
+				return clog.Error("--apply requires --rebuild",
+					"resource changes take effect by rebuilding the workspace",
+				)
+			}
+			if opts.percentile <= 0 || opts.percentile > 100 {
+				return xerrors.New("--percentile must be within (0, 100]")
+			}
+
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			var workspaces []coder.Workspace
+			if all {
+				workspaces, err = client.Workspaces(ctx)
+				if err != nil {
+					return xerrors.Errorf("list workspaces: %w", err)
+				}
+			} else {
+				workspaces, err = getWorkspaces(ctx, client, user)
+				if err != nil {
+					return err
+				}
+			}
+
+			if sampleFor > 0 {
+				clog.LogInfo(i18n.Sprintf("watching the utilization of running workspaces for %s", sampleFor))
+			}
+			plan, err := planRightsizing(ctx, watchStats(client, sampleFor), workspaces, opts)
+			if err != nil {
+				return err
+			}
+
+			err = writeOutput(cmd.OutOrStdout(), plan, func() error {
+				return writeRightsizingPlan(cmd, plan)
+			})
+			if err != nil {
+				return err
+			}
+
+			changes := plan.changes()
+			if !apply || len(changes) == 0 {
+				return nil
+			}
+			if !force {
+				label := fmt.Sprintf("Resize and rebuild %d workspaces?", len(changes))
+				if _, err := (&promptui.Prompt{Label: label, IsConfirm: true}).Run(); err != nil {
+					return clog.Fatal(
+						"failed to confirm prompt", clog.BlankLine,
+						clog.Tipf(`use "--force" to apply without a confirmation prompt`),
+					)
+				}
+			}
+			return applyRightsizing(ctx, client, changes)
+		},
+	}
+	cmd.Flags().StringVar(&user, "user", coder.Me, "Specify the user whose resources to target")
+	cmd.Flags().BoolVar(&all, "all", false, "include the workspaces of every user (requires site admin)")
+	cmd.Flags().DurationVar(&sampleFor, "sample-for", 5*time.Minute, "how long to watch the utilization of running workspaces, 0 to only use their latest stats")
+	cmd.Flags().Float64Var(&opts.percentile, "percentile", 95, "percentile of the utilization to size for")
+	cmd.Flags().Float64Var(&opts.headroom, "headroom", 0.25, "fraction added on top of the utilization percentile")
+	cmd.Flags().Float64Var(&opts.threshold, "threshold", 0.2, "minimum relative change for a recommendation to be made")
+	cmd.Flags().IntVar(&opts.minSamples, "min-samples", 1, "minimum number of utilization samples needed to make a recommendation")
+	cmd.Flags().Float32Var(&opts.minCPU, "min-cpu", 0.5, "never recommend fewer CPU cores than this")
+	cmd.Flags().Float32Var(&opts.minMemory, "min-memory", 1, "never recommend less memory than this, in GB")
+	addOutputShorthand(cmd)
+	cmd.Flags().BoolVar(&apply, "apply", false, "apply the recommendations")
+	cmd.Flags().BoolVar(&rebuild, "rebuild", false, "confirm that applying rebuilds the resized workspaces")
+	cmd.Flags().BoolVar(&force, "force", false, "apply without showing a confirmation prompt")
+	return cmd
+}
+
+// watchStats samples the latest stat of a workspace, and when it's running,
+// the stats it reports over DialWorkspaceStats for the given duration.
+func watchStats(client coder.Client, duration time.Duration) statSampler {
+	return func(ctx context.Context, w coder.Workspace) ([]coder.WorkspaceStat, error) {
+		stats := []coder.WorkspaceStat{w.LatestStat}
+		if duration <= 0 || w.LatestStat.ContainerStatus != coder.WorkspaceOn {
+			return stats, nil
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, duration)
+		defer cancel()
+		conn, err := client.DialWorkspaceStats(ctx, w.ID)
+		if err != nil {
+			return nil, xerrors.Errorf("watch stats: %w", err)
+		}
+		defer func() { _ = conn.Close(websocket.StatusNormalClosure, "") }()
+		for {
+			var stat coder.WorkspaceStat
+			if err := wsjson.Read(ctx, conn, &stat); err != nil {
+				if ctx.Err() != nil {
+					return stats, nil
+				}
+				return nil, xerrors.Errorf("read stats: %w", err)
+			}
+			stats = append(stats, stat)
+		}
+	}
+}
+
+// rightsizing is the recommendation for a single workspace.
+type rightsizing struct {
+	Name        string   `json:"workspace"`
+	ID          string   `json:"workspace_id"`
+	Samples     int      `json:"samples"`
+	CPUCores    float32  `json:"cpu_cores"`
+	MemoryGB    float32  `json:"memory_gb"`
+	NewCPUCores *float32 `json:"recommended_cpu_cores,omitempty"`
+	NewMemoryGB *float32 `json:"recommended_memory_gb,omitempty"`
+	Skipped     string   `json:"skipped,omitempty"`
+}
+
+type rightsizingPlan []rightsizing
+
+// changes returns the recommendations that change a workspace.
+func (p rightsizingPlan) changes() []rightsizing {
+	var changes []rightsizing
+	for _, r := range p {
+		if r.NewCPUCores != nil || r.NewMemoryGB != nil {
+			changes = append(changes, r)
+		}
+	}
+	return changes
+}
+
+// planRightsizing samples the workspaces concurrently, so watching them takes
+// as long as watching one.
+func planRightsizing(ctx context.Context, sample statSampler, workspaces []coder.Workspace, opts rightsizingOptions) (rightsizingPlan, error) {
+	var (
+		mu   sync.Mutex
+		plan = make(rightsizingPlan, 0, len(workspaces))
+	)
+	group, ctx := errgroup.WithContext(ctx)
+	for _, w := range workspaces {
+		w := w
+		group.Go(func() error {
+			stats, err := sample(ctx, w)
+			if err != nil {
+				return xerrors.Errorf("get utilization of %q: %w", w.Name, err)
+			}
+			r := recommendResources(w, stats, opts)
+			mu.Lock()
+			defer mu.Unlock()
+			plan = append(plan, r)
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	sort.Slice(plan, func(i, j int) bool { return plan[i].Name < plan[j].Name })
+	return plan, nil
+}
+
+// recommendResources sizes a workspace for the utilization in stats.
+func recommendResources(w coder.Workspace, stats []coder.WorkspaceStat, opts rightsizingOptions) rightsizing {
+	r := rightsizing{Name: w.Name, ID: w.ID, CPUCores: w.CPUCores, MemoryGB: w.MemoryGB}
+
+	var cpu, mem []float64
+	for _, s := range stats {
+		// Stopped workspaces use nothing, which says nothing about their needs.
+		if s.ContainerStatus != coder.WorkspaceOn || s.StatError != "" {
+			continue
+		}
+		cpu = append(cpu, float64(s.CPUUsage))
+		mem = append(mem, float64(s.MemoryUsage))
+	}
+	r.Samples = len(cpu)
+	if r.Samples == 0 || r.Samples < opts.minSamples {
+		r.Skipped = fmt.Sprintf("%d of %d samples", r.Samples, opts.minSamples)
+		return r
+	}
+
+	// CPU is sized in half cores and memory in whole gigabytes.
+	newCPU := roundUp(percentile(cpu, opts.percentile)*(1+opts.headroom), 0.5, opts.minCPU)
+	if significantChange(w.CPUCores, newCPU, opts.threshold) {
+		r.NewCPUCores = &newCPU
+	}
+	newMem := roundUp(percentile(mem, opts.percentile)*(1+opts.headroom), 1, opts.minMemory)
+	if significantChange(w.MemoryGB, newMem, opts.threshold) {
+		r.NewMemoryGB = &newMem
+	}
+	return r
+}
+
+// percentile returns the nearest-rank percentile p of values.
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func roundUp(v, step float64, min float32) float32 {
+	rounded := float32(math.Ceil(v/step) * step)
+	if rounded < min {
+		return min
+	}
+	return rounded
+}
+
+func significantChange(current, recommended float32, threshold float64) bool {
+	if current == recommended {
+		return false
+	}
+	if current == 0 {
+		return true
+	}
+	return math.Abs(float64(recommended-current))/float64(current) >= threshold
+}
+
+func writeRightsizingPlan(cmd *cobra.Command, plan rightsizingPlan) error {
+	type rightsizingRow struct {
+		Workspace string `table:"Workspace"`
+		CPU       string `table:"CPUCores"`
+		Memory    string `table:"MemoryGB"`
+		Samples   string `table:"Samples"`
+	}
+	describe := func(current float32, recommended *float32) string {
+		if recommended == nil {
+			return fmt.Sprint(current)
+		}
+		return fmt.Sprintf("%v -> %v", current, *recommended)
+	}
+	rows := make([]rightsizingRow, 0, len(plan))
+	for _, r := range plan {
+		row := rightsizingRow{
+			Workspace: r.Name,
+			CPU:       describe(r.CPUCores, r.NewCPUCores),
+			Memory:    describe(r.MemoryGB, r.NewMemoryGB),
+			Samples:   fmt.Sprint(r.Samples),
+		}
+		if r.Skipped != "" {
+			row.Samples = "skipped, " + r.Skipped
+		}
+		rows = append(rows, row)
+	}
+	err := writeTable(cmd.OutOrStdout(), len(rows), func(i int) interface{} { return rows[i] })
+	if err != nil {
+		return xerrors.Errorf("write table: %w", err)
+	}
+	return nil
+}
+
+func applyRightsizing(ctx context.Context, client coder.Client, changes []rightsizing) error {
+	var failed int
+	for _, r := range changes {
+		err := client.EditWorkspace(ctx, r.ID, coder.UpdateWorkspaceReq{
+			CPUCores: r.NewCPUCores,
+			MemoryGB: r.NewMemoryGB,
+		})
+		if err != nil {
+			failed++
+			clog.Log(clog.Error(i18n.Sprintf("failed to resize workspace %q", r.Name), clog.Causef(err.Error())))
+			continue
+		}
+		clog.LogSuccess(i18n.Sprintf("resized workspace %q, rebuild started", r.Name))
+	}
+	if failed > 0 {
+		return xerrors.Errorf("%d workspaces failed to resize", failed)
+	}
+	return nil
+}
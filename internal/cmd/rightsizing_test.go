@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_rightsizing(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	opts := rightsizingOptions{
+		percentile: 95,
+		headroom:   0.25,
+		threshold:  0.2,
+		minSamples: 10,
+		minCPU:     0.5,
+		minMemory:  1,
+	}
+
+	fake := codertest.New()
+	oversized := fake.AddWorkspace(coder.Workspace{Name: "oversized", CPUCores: 8, MemoryGB: 16})
+	fake.AddWorkspace(coder.Workspace{Name: "fitting", CPUCores: 2, MemoryGB: 4})
+	fake.AddWorkspace(coder.Workspace{Name: "fresh", CPUCores: 4, MemoryGB: 8})
+
+	samples := map[string][]coder.WorkspaceStat{}
+	for i := 0; i < 20; i++ {
+		samples["oversized"] = append(samples["oversized"],
+			coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOn, CPUUsage: 1.1, MemoryUsage: 2.5},
+			// Samples while stopped or failing to be collected are ignored.
+			coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOff},
+			coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOn, StatError: "timeout", CPUUsage: 7, MemoryUsage: 15},
+		)
+		samples["fitting"] = append(samples["fitting"], coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOn, CPUUsage: 1.5, MemoryUsage: 3})
+	}
+	samples["fresh"] = []coder.WorkspaceStat{{ContainerStatus: coder.WorkspaceOn, CPUUsage: 0.1, MemoryUsage: 1}}
+	sample := func(_ context.Context, w coder.Workspace) ([]coder.WorkspaceStat, error) {
+		return samples[w.Name], nil
+	}
+
+	workspaces, err := fake.Workspaces(ctx)
+	assert.Success(t, "list workspaces", err)
+	plan, err := planRightsizing(ctx, sample, workspaces, opts)
+	assert.Success(t, "plan rightsizing", err)
+	assert.Equal(t, "plan size", 3, len(plan))
+
+	byName := map[string]rightsizing{}
+	for _, r := range plan {
+		byName[r.Name] = r
+	}
+	assert.Equal(t, "oversized samples", 20, byName["oversized"].Samples)
+	assert.Equal(t, "oversized cpu", float32(1.5), *byName["oversized"].NewCPUCores)
+	assert.Equal(t, "oversized memory", float32(4), *byName["oversized"].NewMemoryGB)
+	assert.True(t, "fitting unchanged", byName["fitting"].NewCPUCores == nil && byName["fitting"].NewMemoryGB == nil)
+	assert.Equal(t, "fresh skipped", "1 of 10 samples", byName["fresh"].Skipped)
+
+	changes := plan.changes()
+	assert.Equal(t, "changes", 1, len(changes))
+	err = applyRightsizing(ctx, fake, changes)
+	assert.Success(t, "apply rightsizing", err)
+	w, _ := fake.Workspace(oversized)
+	assert.Equal(t, "cpu applied", float32(1.5), w.CPUCores)
+	assert.Equal(t, "memory applied", float32(4), w.MemoryGB)
+}
+
+func Test_watchStatsLatest(t *testing.T) {
+	t.Parallel()
+
+	// Stopped workspaces, and any workspace without a watch duration, are
+	// sampled from their latest stat without dialing.
+	sample := watchStats(codertest.New(), 0)
+	stats, err := sample(context.Background(), coder.Workspace{LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOn, CPUUsage: 2}})
+	assert.Success(t, "sample", err)
+	assert.Equal(t, "latest stat", []coder.WorkspaceStat{{ContainerStatus: coder.WorkspaceOn, CPUUsage: 2}}, stats)
+
+	stats, err = watchStats(codertest.New(), time.Minute)(context.Background(), coder.Workspace{LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOff}})
+	assert.Success(t, "sample stopped", err)
+	assert.Equal(t, "stopped", 1, len(stats))
+}
+
+func Test_percentile(t *testing.T) {
+	t.Parallel()
+
+	values := []float64{5, 1, 4, 2, 3}
+	assert.Equal(t, "p100", 5.0, percentile(values, 100))
+	assert.Equal(t, "p50", 3.0, percentile(values, 50))
+	assert.Equal(t, "p1", 1.0, percentile(values, 1))
+}
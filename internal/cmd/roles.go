@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// requiredRolesAnnotation is the annotation of the commands only users with
+// certain roles can run, listing the roles comma separated.
+const requiredRolesAnnotation = "coder_required_roles"
+
+// requireRoles makes the command check that the user has one of the roles
+// before it runs, so that a multi-step operation doesn't fail halfway through
+// with a generic 403. Organization roles are satisfied by the role in any
+// organization, and the deployment checks the organization the command
+// targets.
+func requireRoles(cmd *cobra.Command, roles ...coder.Role) {
+	names := make([]string, 0, len(roles))
+	for _, r := range roles {
+		names = append(names, string(r))
+	}
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[requiredRolesAnnotation] = strings.Join(names, ",")
+}
+
+// checkRequiredRoles returns an error naming the roles the command requires
+// if the user has none of them.
+func checkRequiredRoles(cmd *cobra.Command) error {
+	raw, ok := cmd.Annotations[requiredRolesAnnotation]
+	if !ok {
+		return nil
+	}
+	if impersonation.user != "" {
+		// The deployment returns the roles of the impersonated user, and
+		// checks those of the caller itself.
+		return nil
+	}
+	var roles []coder.Role
+	for _, r := range strings.Split(raw, ",") {
+		roles = append(roles, coder.Role(r))
+	}
+
+	ctx := cmd.Context()
+	client, err := newClient(ctx, false)
+	if err != nil {
+		return err
+	}
+	me, err := client.Me(ctx)
+	if err != nil {
+		return xerrors.Errorf("get current user: %w", err)
+	}
+	if hasRole(me, roles...) {
+		return nil
+	}
+	if ok, err := hasOrgRole(ctx, client, me, roles...); err != nil || ok {
+		// Without the organizations, the deployment is left to check.
+		return nil
+	}
+	return missingRoleError(cmd.CommandPath(), me, roles)
+}
+
+// hasOrgRole reports whether the user has one of the organization roles in
+// any of the organizations. The organizations are only fetched if roles
+// includes an organization role.
+func hasOrgRole(ctx context.Context, client coder.Client, me *coder.User, roles ...coder.Role) (bool, error) {
+	var orgRoles []coder.Role
+	for _, r := range roles {
+		if strings.HasPrefix(string(r), "organization-") {
+			orgRoles = append(orgRoles, r)
+		}
+	}
+	if len(orgRoles) == 0 {
+		return false, nil
+	}
+	orgs, err := client.Organizations(ctx)
+	if err != nil {
+		return false, xerrors.Errorf("get organizations: %w", err)
+	}
+	for _, org := range orgs {
+		for _, m := range org.Members {
+			if m.ID == me.ID && hasRole(&coder.User{Roles: m.OrganizationRoles}, orgRoles...) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func missingRoleError(command string, me *coder.User, roles []coder.Role) error {
+	names := make([]string, 0, len(roles))
+	for _, r := range roles {
+		names = append(names, string(r))
+	}
+	need := fmt.Sprintf("the %s role", names[0])
+	if len(names) > 1 {
+		need = fmt.Sprintf("one of the %s or %s roles", strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+	}
+	have := "no roles"
+	if len(me.Roles) > 0 {
+		haveNames := make([]string, 0, len(me.Roles))
+		for _, r := range me.Roles {
+			haveNames = append(haveNames, string(r))
+		}
+		have = "the roles " + strings.Join(haveNames, ", ")
+	}
+	return clog.Error(i18n.Sprintf("you need %s to run %q", need, command),
+		fmt.Sprintf("%s has %s", me.Email, have),
+		clog.BlankLine,
+		clog.Tipf("ask a site admin to run it, or to grant you the role"),
+	)
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_requireRoles(t *testing.T) {
+	fake := codertest.New()
+	useFakeClient(t, fake)
+
+	res := execute(t, nil, "providers", "rename", "built-in", "us-east-1")
+	res.error(t)
+	res.stderrContains(t, `you need the site-admin role to run "coder providers rename"`)
+	res.stderrContains(t, "me@coder.com has the roles site-member")
+	assert.Equal(t, "no provider looked up", 0, len(fake.CallsTo("WorkspaceProviders")))
+
+	// Organization admins promote tags of their organization.
+	res = execute(t, nil, "tags", "promote", "2021-06")
+	res.error(t)
+	res.stderrContains(t, "one of the site-admin or organization-admin roles")
+	me, err := fake.Me(context.Background())
+	assert.Success(t, "me", err)
+	fake.AddOrganization(coder.Organization{Name: "eng", Members: []coder.OrganizationUser{
+		{User: *me, OrganizationRoles: []coder.Role{coder.RoleOrgAdmin}},
+	}})
+	res = execute(t, nil, "tags", "promote", "2021-06")
+	res.error(t)
+	res.stderrContains(t, "exactly one of --image or --all must be set")
+
+	err = missingRoleError("coder tokens create", &coder.User{Email: "me@coder.com"}, []coder.Role{coder.SiteAdmin, coder.SiteManager})
+	assert.ErrorContains(t, "several roles", err, "one of the site-admin or site-manager roles")
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// satelliteHealthTimeout bounds the health check of each satellite, so an
+// unreachable one delays connecting by at most this long.
+const satelliteHealthTimeout = 5 * time.Second
+
+// satelliteRouter picks the broker new ssh and tunnel connections go through:
+// the satellite set with "coder config set satellite" while it's healthy,
+// another healthy satellite while it isn't, or else the deployment. Since
+// every connection is routed anew, connections fail back to the satellite
+// once it recovers.
+type satelliteRouter struct {
+	client     coder.Client
+	httpClient *http.Client
+	preferred  string
+}
+
+// newSatelliteRouter returns nil when no satellite is set, in which case
+// connections go through the deployment.
+func newSatelliteRouter(ctx context.Context, client coder.Client) (*satelliteRouter, error) {
+	name, err := config.Satellite.Read()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read satellite: %w", err)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, nil
+	}
+	hc, err := newHTTPClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &satelliteRouter{client: client, httpClient: hc, preferred: name}, nil
+}
+
+// route returns the broker of the next connection, and logs when it fails
+// over from the preferred satellite or back to it.
+func (r *satelliteRouter) route(ctx context.Context) *url.URL {
+	deployment := r.client.BaseURL()
+	broker, via := &deployment, ""
+
+	sats, err := r.client.Satellites(ctx)
+	if err != nil {
+		r.logRoute(via, []string{fmt.Sprintf("list satellites: %v", err)})
+		return broker
+	}
+	var unhealthy []string
+	for _, s := range r.order(sats) {
+		u, err := r.check(ctx, s)
+		if err != nil {
+			unhealthy = append(unhealthy, fmt.Sprintf("satellite %q: %v", s.Name, err))
+			continue
+		}
+		broker, via = u, s.Name
+		break
+	}
+	r.logRoute(via, unhealthy)
+	return broker
+}
+
+// order returns the satellites with an access URL, the preferred one first.
+// The preferred satellite is kept without one, so that its check reports it.
+func (r *satelliteRouter) order(sats []coder.Satellite) []coder.Satellite {
+	var preferred, others []coder.Satellite
+	for _, s := range sats {
+		switch {
+		case s.Name == r.preferred:
+			preferred = append(preferred, s)
+		case s.AccessURL == "":
+		default:
+			others = append(others, s)
+		}
+	}
+	if len(preferred) == 0 {
+		preferred = []coder.Satellite{{Name: r.preferred}}
+	}
+	return append(preferred, others...)
+}
+
+// check returns the access URL of the satellite if it answers for its key,
+// which every satellite serves.
+func (r *satelliteRouter) check(ctx context.Context, s coder.Satellite) (*url.URL, error) {
+	if s.ID == "" {
+		return nil, xerrors.New("no satellite found by that name")
+	}
+	if s.AccessURL == "" {
+		return nil, xerrors.New("no access url")
+	}
+	u, err := url.Parse(s.AccessURL)
+	if err != nil {
+		return nil, xerrors.Errorf("parse access url: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, satelliteHealthTimeout)
+	defer cancel()
+	health := *u
+	health.Path = satelliteKeyPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, health.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode > 299 {
+		return nil, xerrors.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return u, nil
+}
+
+// logRoute logs the route when it differs from the last connection's, so the
+// failover and failback are logged once rather than on every connection.
+func (r *satelliteRouter) logRoute(via string, unhealthy []string) {
+	// The route is stored after the satellite it was taken for, so that
+	// setting another satellite starts over.
+	last := r.preferred
+	if saved, err := config.SatelliteRoute.Read(); err == nil {
+		if parts := strings.SplitN(saved, "\n", 2); len(parts) == 2 && parts[0] == r.preferred {
+			last = parts[1]
+		}
+	}
+	if via == last {
+		return
+	}
+	_ = config.SatelliteRoute.Write(r.preferred + "\n" + via)
+
+	if via == r.preferred {
+		clog.LogSuccess(i18n.Sprintf("satellite %q is healthy again, routing new connections through it", r.preferred))
+		return
+	}
+	target := "the deployment"
+	if via != "" {
+		target = fmt.Sprintf("satellite %q", via)
+	}
+	clog.LogWarn(i18n.Sprintf("satellite %q is unavailable, routing new connections through %s", r.preferred, target), unhealthy...)
+}
+
+// validateSatellite checks that the satellite exists and has an access URL
+// to route connections to.
+func validateSatellite(ctx context.Context, name string) error {
+	client, err := newClient(ctx, true)
+	if err != nil {
+		return err
+	}
+	sats, err := client.Satellites(ctx)
+	if err != nil {
+		return xerrors.Errorf("get satellites: %w", err)
+	}
+	for _, s := range sats {
+		if s.Name != name {
+			continue
+		}
+		if s.AccessURL == "" {
+			return clog.Error(i18n.Sprintf("satellite %q has no access url", name),
+				"connections can't be routed through it",
+			)
+		}
+		return nil
+	}
+	return xerrors.Errorf("no satellite found by name %q", name)
+}
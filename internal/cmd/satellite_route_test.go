@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// Not parallel: the route is recorded in the config dir and logged to the
+// clog output of the package.
+func Test_satelliteRouter(t *testing.T) {
+	var buf bytes.Buffer
+	clog.SetOutput(&buf)
+	t.Cleanup(func() {
+		clog.SetOutput(os.Stderr)
+		_ = config.SatelliteRoute.Delete()
+	})
+
+	var down int32
+	eu := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 || r.URL.Path != satelliteKeyPath {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"key":"k","fingerprint":"f"}`))
+	}))
+	defer eu.Close()
+	us := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"key":"k","fingerprint":"f"}`))
+	}))
+	defer us.Close()
+
+	fake := codertest.New()
+	fake.AddSatellite(coder.Satellite{Name: "no-url"})
+	fake.AddSatellite(coder.Satellite{Name: "us-east", AccessURL: us.URL})
+	fake.AddSatellite(coder.Satellite{Name: "eu-west", AccessURL: eu.URL})
+	r := &satelliteRouter{client: fake, httpClient: http.DefaultClient, preferred: "eu-west"}
+	ctx := context.Background()
+
+	assert.Equal(t, "healthy", eu.URL, r.route(ctx).String())
+	assert.Equal(t, "nothing logged", "", buf.String())
+
+	atomic.StoreInt32(&down, 1)
+	assert.Equal(t, "failed over", us.URL, r.route(ctx).String())
+	assert.True(t, "failover logged", strings.Contains(buf.String(), `satellite "eu-west" is unavailable, routing new connections through satellite "us-east"`))
+	assert.True(t, "cause logged", strings.Contains(buf.String(), "unexpected status code 503"))
+
+	buf.Reset()
+	assert.Equal(t, "still failed over", us.URL, r.route(ctx).String())
+	assert.Equal(t, "logged once", "", buf.String())
+
+	atomic.StoreInt32(&down, 0)
+	assert.Equal(t, "failed back", eu.URL, r.route(ctx).String())
+	assert.True(t, "failback logged", strings.Contains(buf.String(), `satellite "eu-west" is healthy again`))
+
+	// Without a healthy satellite, connections go through the deployment.
+	buf.Reset()
+	atomic.StoreInt32(&down, 1)
+	us.Close()
+	r.preferred = "gone"
+	deployment := fake.BaseURL()
+	assert.Equal(t, "deployment", deployment.String(), r.route(ctx).String())
+	assert.True(t, "deployment logged", strings.Contains(buf.String(), `satellite "gone" is unavailable, routing new connections through the deployment`))
+	assert.True(t, "missing satellite", strings.Contains(buf.String(), "no satellite found by that name"))
+}
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strings"
 
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/internal/x/xcobra"
 
 	"github.com/spf13/cobra"
@@ -14,7 +15,6 @@ import (
 
 	"cdr.dev/coder-cli/coder-sdk"
 	"cdr.dev/coder-cli/pkg/clog"
-	"cdr.dev/coder-cli/pkg/tablewriter"
 )
 
 const (
@@ -114,17 +114,19 @@ Do you wish to continue? (y/n)
 			_, err = client.CreateSatellite(ctx, coder.CreateSatelliteReq{
 				Name:      name,
 				PublicKey: keyRes.Key,
+				AccessURL: accessURL,
 			})
 			if err != nil {
 				return xerrors.Errorf("making create satellite request: %w", err)
 			}
 
-			clog.LogSuccess(fmt.Sprintf("satellite %s successfully created", name))
+			clog.LogSuccess(i18n.Sprintf("satellite %s successfully created", name))
 
 			return nil
 		},
 	}
 
+	requireRoles(cmd, coder.SiteAdmin)
 	return cmd
 }
 
@@ -164,20 +166,24 @@ coder satellites ls`,
 				return xerrors.Errorf("get satellites request: %w", err)
 			}
 
-			if len(sats) == 0 {
-				return xerrors.Errorf("no satellites found")
+			if sats == nil {
+				sats = []coder.Satellite{} // ensures that json output still marshals
 			}
-
-			err = tablewriter.WriteTable(cmd.OutOrStdout(), len(sats), func(i int) interface{} {
-				return sats[i]
+			return writeOutput(cmd.OutOrStdout(), sats, func() error {
+				if len(sats) == 0 {
+					return xerrors.Errorf("no satellites found")
+				}
+				err := writeTable(cmd.OutOrStdout(), len(sats), func(i int) interface{} {
+					return sats[i]
+				})
+				if err != nil {
+					return xerrors.Errorf("write table: %w", err)
+				}
+				return nil
 			})
-			if err != nil {
-				return xerrors.Errorf("write table: %w", err)
-			}
-
-			return nil
 		},
 	}
+	addOutputFlag(cmd)
 	return cmd
 }
 
@@ -209,7 +215,7 @@ coder satellites rm my-satellite`,
 					if err != nil {
 						return xerrors.Errorf("delete satellites request: %w", err)
 					}
-					clog.LogSuccess(fmt.Sprintf("satellite %s successfully deleted", name))
+					clog.LogSuccess(i18n.Sprintf("satellite %s successfully deleted", name))
 
 					return nil
 				}
@@ -218,5 +224,6 @@ coder satellites rm my-satellite`,
 			return xerrors.Errorf("no satellite found by name '%s'", name)
 		},
 	}
+	requireRoles(cmd, coder.SiteAdmin)
 	return cmd
 }
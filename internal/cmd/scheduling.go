@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+)
+
+// schedulingFlags are the flags of commands that create or edit workspaces,
+// for steering them onto node pools of their provider.
+type schedulingFlags struct {
+	nodeSelector map[string]string
+	tolerations  []string
+	region       string
+}
+
+func (f *schedulingFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringToStringVar(&f.nodeSelector, "node-selector", nil, "key=value labels of the nodes the workspace may be scheduled on (repeatable)")
+	cmd.Flags().StringArrayVar(&f.tolerations, "toleration", nil, "key[=value][:effect] taint of nodes the workspace tolerates, where effect is NoSchedule, PreferNoSchedule or NoExecute (repeatable)")
+	cmd.Flags().StringVar(&f.region, "region", "", "region of the workspace provider to schedule the workspace in")
+}
+
+// hints returns the scheduling hints given by the flags on top of base, the
+// hints of the workspace being edited, or nil if no flag was given. A flag
+// replaces the hints of its kind, and an empty value removes them.
+func (f *schedulingFlags) hints(cmd *cobra.Command, base *coder.SchedulingHints) (*coder.SchedulingHints, error) {
+	flags := cmd.Flags()
+	if !flags.Changed("node-selector") && !flags.Changed("toleration") && !flags.Changed("region") {
+		return nil, nil
+	}
+	var hints coder.SchedulingHints
+	if base != nil {
+		hints = *base
+	}
+	if flags.Changed("node-selector") {
+		hints.NodeSelector = nil
+		for key, value := range f.nodeSelector {
+			if key == "" {
+				return nil, xerrors.Errorf("invalid node selector %q: the label key is empty", key+"="+value)
+			}
+			if hints.NodeSelector == nil {
+				hints.NodeSelector = make(map[string]string)
+			}
+			hints.NodeSelector[key] = value
+		}
+	}
+	if flags.Changed("toleration") {
+		hints.Tolerations = nil
+		for _, s := range f.tolerations {
+			if s == "" {
+				continue
+			}
+			t, err := parseToleration(s)
+			if err != nil {
+				return nil, err
+			}
+			hints.Tolerations = append(hints.Tolerations, t)
+		}
+	}
+	if flags.Changed("region") {
+		hints.Region = f.region
+	}
+	return &hints, nil
+}
+
+var taintEffects = []string{"NoSchedule", "PreferNoSchedule", "NoExecute"}
+
+// parseToleration parses a toleration in the key[=value][:effect] format of
+// kubectl taint. Without a value, it tolerates any value of the key.
+func parseToleration(s string) (coder.Toleration, error) {
+	t := coder.Toleration{Operator: coder.TolerationExists}
+	keyValue := s
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		keyValue, t.Effect = s[:i], s[i+1:]
+		if !validTaintEffect(t.Effect) {
+			return t, xerrors.Errorf("invalid toleration %q: effect must be one of %s", s, strings.Join(taintEffects, ", "))
+		}
+	}
+	t.Key = keyValue
+	if i := strings.Index(keyValue, "="); i >= 0 {
+		t.Key, t.Value, t.Operator = keyValue[:i], keyValue[i+1:], coder.TolerationEqual
+	}
+	if t.Key == "" {
+		return t, xerrors.Errorf("invalid toleration %q: the taint key is empty", s)
+	}
+	return t, nil
+}
+
+func validTaintEffect(effect string) bool {
+	for _, e := range taintEffects {
+		if e == effect {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"github.com/spf13/cobra"
+
+	"cdr.dev/coder-cli/coder-sdk"
+)
+
+func Test_parseToleration(t *testing.T) {
+	t.Parallel()
+
+	for s, want := range map[string]coder.Toleration{
+		"dedicated":                      {Key: "dedicated", Operator: coder.TolerationExists},
+		"dedicated=gpu":                  {Key: "dedicated", Operator: coder.TolerationEqual, Value: "gpu"},
+		"nvidia.com/gpu:NoSchedule":      {Key: "nvidia.com/gpu", Operator: coder.TolerationExists, Effect: "NoSchedule"},
+		"dedicated=gpu:NoExecute":        {Key: "dedicated", Operator: coder.TolerationEqual, Value: "gpu", Effect: "NoExecute"},
+		"dedicated=a=b:PreferNoSchedule": {Key: "dedicated", Operator: coder.TolerationEqual, Value: "a=b", Effect: "PreferNoSchedule"},
+	} {
+		got, err := parseToleration(s)
+		assert.Success(t, s, err)
+		assert.Equal(t, s, want, got)
+	}
+	for _, s := range []string{"dedicated:Never", "=gpu", ":NoSchedule"} {
+		_, err := parseToleration(s)
+		assert.Error(t, s, err)
+	}
+}
+
+func Test_schedulingFlags(t *testing.T) {
+	t.Parallel()
+
+	parse := func(args ...string) (*cobra.Command, *schedulingFlags) {
+		var f schedulingFlags
+		cmd := &cobra.Command{}
+		f.register(cmd)
+		assert.Success(t, "parse flags", cmd.ParseFlags(args))
+		return cmd, &f
+	}
+	base := &coder.SchedulingHints{
+		NodeSelector: map[string]string{"pool": "default"},
+		Tolerations:  []coder.Toleration{{Key: "dedicated", Operator: coder.TolerationExists}},
+		Region:       "us-east-1",
+	}
+
+	cmd, f := parse()
+	hints, err := f.hints(cmd, base)
+	assert.Success(t, "no flags", err)
+	assert.True(t, "no hints without flags", hints == nil)
+
+	cmd, f = parse("--region", "eu-west-1")
+	hints, err = f.hints(cmd, base)
+	assert.Success(t, "region", err)
+	assert.Equal(t, "region replaced, rest kept", &coder.SchedulingHints{
+		NodeSelector: base.NodeSelector,
+		Tolerations:  base.Tolerations,
+		Region:       "eu-west-1",
+	}, hints)
+	assert.Equal(t, "base untouched", "us-east-1", base.Region)
+
+	cmd, f = parse("--node-selector", "pool=gpu,zone=a", "--toleration", "nvidia.com/gpu:NoSchedule", "--toleration", "")
+	hints, err = f.hints(cmd, nil)
+	assert.Success(t, "create", err)
+	assert.Equal(t, "created hints", &coder.SchedulingHints{
+		NodeSelector: map[string]string{"pool": "gpu", "zone": "a"},
+		Tolerations:  []coder.Toleration{{Key: "nvidia.com/gpu", Operator: coder.TolerationExists, Effect: "NoSchedule"}},
+	}, hints)
+
+	cmd, f = parse("--toleration", "")
+	hints, err = f.hints(cmd, base)
+	assert.Success(t, "clear tolerations", err)
+	assert.Equal(t, "tolerations cleared", 0, len(hints.Tolerations))
+
+	cmd, f = parse("--toleration", "dedicated:Never")
+	_, err = f.hints(cmd, nil)
+	assert.ErrorContains(t, "invalid effect", err, "effect must be one of")
+}
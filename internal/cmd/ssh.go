@@ -1,12 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
@@ -14,6 +16,7 @@ import (
 
 	"cdr.dev/coder-cli/coder-sdk"
 	"cdr.dev/coder-cli/pkg/clog"
+	"cdr.dev/coder-cli/wsnet"
 )
 
 var (
@@ -22,11 +25,41 @@ var (
 
 func sshCmd() *cobra.Command {
 	cmd := cobra.Command{
-		Use:   "ssh [workspace_name] [<command [args...]>]",
+		Use:   "ssh [--record dir [--record-input] | --stdio] [--container name] [--workspace workspace_name[/agent] | workspace_name[/agent]] [<command [args...]>]",
 		Short: "Enter a shell of execute a command over SSH into a Coder workspace",
-		Args:  shValidArgs,
+		Long: "Enter a shell of execute a command over SSH into a Coder workspace.\n\n" +
+			"Use --record to save an asciinema-compatible recording of the session to a directory or .cast file. " +
+			"Keystrokes are only recorded with --record-input. A banner tells everyone on the session that it's being recorded.\n\n" +
+			"Use --container to reach the SSH server of another container of the workspace, such as a tooling sidecar. " +
+			"Run \"coder workspaces inspect --containers\" to list them.\n\n" +
+			"Use workspace_name/agent to connect through the agent started with that --label, such as one in a GPU sidecar. " +
+			"Run \"coder workspaces agents\" to list them.\n\n" +
+			"Without a workspace, the default workspace set with \"coder config set default-workspace\" is used. " +
+			"To run a command in it, or in another workspace given with --workspace, pass the command alone.\n\n" +
+			"Before a shell starts in a terminal, a banner summarizes the workspace: its image, resources, disk usage and autostop. " +
+			"Run \"coder config set ssh-banner off\" to hide it.\n\n" +
+			"If ssh fails to connect, the workspace's status, last build and agent are checked to explain why.\n\n" +
+			"Where no ssh binary is installed, such as in minimal containers or on Windows without OpenSSH, a built-in SSH client " +
+			"connects through the agent instead. It supports terminals, exit codes, and the -L, -R, -N, -t and -T flags of ssh. " +
+			"Set " + nativeSSHEnv + "=1 to use it anyway, or " + nativeSSHEnv + "=0 to require the ssh binary.\n\n" +
+			"Use --stdio to speak raw SSH over stdin and stdout instead of running ssh, as an OpenSSH ProxyCommand. " +
+			"\"coder config-ssh\" writes hosts that use it, which editors such as VS Code Remote and JetBrains Gateway connect to as is.\n\n" +
+			"Sessions to the same workspace share one connection, which a background process keeps alive and negotiates again " +
+			"after the network changed, such as when the laptop slept. Set CODER_WSNET_MUX=0 for each session to connect on its own.",
+		Args: shValidArgs,
 		Example: `coder ssh my-dev
-coder ssh my-dev pwd`,
+coder ssh my-dev pwd
+coder ssh --record ~/sessions/ my-dev
+coder ssh --container tools my-dev
+coder ssh my-dev/gpu nvidia-smi
+
+# in ~/.ssh/config
+Host my-dev
+	ProxyCommand coder ssh --stdio my-dev
+
+# with "coder config set default-workspace my-dev"
+coder ssh
+coder ssh --workspace my-dev pwd`,
 		Aliases:               []string{"sh"},
 		DisableFlagParsing:    true,
 		DisableFlagsInUseLine: true,
@@ -37,34 +70,45 @@ coder ssh my-dev pwd`,
 
 func shell(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
-	client, err := newClient(ctx, true)
+	opts, args, err := parseSSHFlags(args)
 	if err != nil {
 		return err
 	}
-	me, err := client.Me(ctx)
+	target, args, err := workspaceArg(opts.workspace, args, 0)
 	if err != nil {
 		return err
 	}
-	workspace, err := findWorkspace(ctx, client, args[0], coder.Me)
+	if opts.stdio {
+		if len(args) > 0 {
+			return xerrors.New("--stdio doesn't run a command, ssh runs it through the proxy")
+		}
+		return sshProxy(ctx, target, opts.container, false, wsnetTraceFlags{})
+	}
+	client, err := newClient(ctx, true)
 	if err != nil {
 		return err
 	}
-	if workspace.LatestStat.ContainerStatus != coder.WorkspaceOn {
-		return clog.Error("workspace not available",
-			fmt.Sprintf("current status: \"%s\"", workspace.LatestStat.ContainerStatus),
-			clog.BlankLine,
-			clog.Tipf("use \"coder workspaces rebuild %s\" to rebuild this workspace", workspace.Name),
-		)
+	me, err := client.Me(ctx)
+	if err != nil {
+		return err
 	}
-	wp, err := client.WorkspaceProviderByID(ctx, workspace.ResourcePoolID)
+	workspaceName, agent, err := splitAgentTarget(target)
 	if err != nil {
 		return err
 	}
-	u, err := url.Parse(wp.EnvproxyAccessURL)
+	workspace, err := findWorkspace(ctx, client, workspaceName, coder.Me)
 	if err != nil {
 		return err
 	}
-
+	if workspace.LatestStat.ContainerStatus != coder.WorkspaceOn {
+		return diagnoseWorkspace(ctx, client, workspace)
+	}
+	if err := findAgent(ctx, client, workspace, agent); err != nil {
+		return err
+	}
+	if len(args) == 0 && showInteractiveOutput && sshBannerEnabled() {
+		writeSSHBanner(ctx, cmd.ErrOrStderr(), client, *workspace)
+	}
 	usr, err := user.Current()
 	if err != nil {
 		return xerrors.Errorf("get user home directory: %w", err)
@@ -75,19 +119,78 @@ func shell(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	ssh := exec.CommandContext(ctx,
-		"ssh", "-i"+privateKeyFilepath,
-		fmt.Sprintf("%s-%s@%s", me.Username, workspace.Name, u.Hostname()),
-	)
-	if len(args) > 1 {
-		ssh.Args = append(ssh.Args, args[1:]...)
+
+	if useNativeSSH() {
+		if opts.record != "" {
+			return clog.Error("--record requires an ssh binary",
+				clog.BlankLine,
+				clog.Tipf("install OpenSSH to record sessions"),
+			)
+		}
+		code, err := runNativeSSH(ctx, client, workspace, agent, opts.container, me.Username, privateKeyFilepath, args)
+		var connectErr nativeSSHConnectError
+		if xerrors.As(err, &connectErr) {
+			if err := diagnoseWorkspace(ctx, client, workspace); err != nil {
+				clog.Log(err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			os.Exit(code)
+		}
+		return nil
 	}
+
+	var ssh *exec.Cmd
+	if opts.container != "" || agent != "" {
+		// Containers and labeled agents are only reachable through the
+		// agent, so tunnel to them the way "coder config-ssh" tunnels to
+		// the workspace.
+		binPath, err := binPath()
+		if err != nil {
+			return xerrors.Errorf("failed to get executable path: %w", err)
+		}
+		target := workspace.Name
+		if agent != "" {
+			target += "/" + agent
+		}
+		if opts.container != "" {
+			ssh = exec.CommandContext(ctx, "ssh", containerSSHArgs(binPath, target, opts.container, privateKeyFilepath)...)
+		} else {
+			ssh = exec.CommandContext(ctx, "ssh", agentSSHArgs(binPath, target, privateKeyFilepath)...)
+		}
+	} else {
+		wp, err := client.WorkspaceProviderByID(ctx, workspace.ResourcePoolID)
+		if err != nil {
+			return err
+		}
+		u, err := url.Parse(wp.EnvproxyAccessURL)
+		if err != nil {
+			return err
+		}
+		ssh = exec.CommandContext(ctx,
+			"ssh", "-i"+privateKeyFilepath,
+			fmt.Sprintf("%s-%s@%s", me.Username, workspace.Name, u.Hostname()),
+		)
+	}
+	ssh.Args = append(ssh.Args, args...)
 	ssh.Stderr = os.Stderr
 	ssh.Stdout = os.Stdout
 	ssh.Stdin = os.Stdin
-	err = ssh.Run()
+	if opts.record != "" {
+		err = runRecorded(ssh, workspace.Name, opts)
+	} else {
+		err = ssh.Run()
+	}
 	var exitErr *exec.ExitError
 	if xerrors.As(err, &exitErr) {
+		if exitErr.ExitCode() == sshConnectionFailed {
+			if err := diagnoseWorkspace(ctx, client, workspace); err != nil {
+				clog.Log(err)
+			}
+		}
 		os.Exit(exitErr.ExitCode())
 		return xerrors.New("unreachable")
 	}
@@ -97,21 +200,170 @@ func shell(cmd *cobra.Command, args []string) error {
 // special handling for the common case of "coder sh" input without a positional argument.
 func shValidArgs(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
-	err := cobra.MinimumNArgs(1)(cmd, args)
+	opts, args, err := parseSSHFlags(args)
+	if err != nil {
+		return err
+	}
+	if opts.workspace != "" || len(args) > 0 {
+		return nil
+	}
+	if name, _ := defaultWorkspace(); name != "" {
+		return nil
+	}
+	client, err := newClient(ctx, true)
 	if err != nil {
-		client, err := newClient(ctx, true)
-		if err != nil {
-			return clog.Error("missing [workspace_name] argument")
-		}
-		_, haystack, err := searchForWorkspace(ctx, client, "", coder.Me)
-		if err != nil {
-			return clog.Error("missing [workspace_name] argument",
-				fmt.Sprintf("specify one of %q", haystack),
-				clog.BlankLine,
-				clog.Tipf("run \"coder workspaces ls\" to view your workspaces"),
-			)
-		}
 		return clog.Error("missing [workspace_name] argument")
 	}
+	_, haystack, err := searchForWorkspace(ctx, client, "", coder.Me)
+	if err != nil {
+		return clog.Error("missing [workspace_name] argument",
+			fmt.Sprintf("specify one of %q", haystack),
+			clog.BlankLine,
+			clog.Tipf("run \"coder workspaces ls\" to view your workspaces"),
+		)
+	}
+	return clog.Error("missing [workspace_name] argument")
+}
+
+// sshOptions are the flags accepted by "coder ssh". Flag parsing is disabled
+// for the command so arguments are passed through to ssh untouched, so the
+// flags are parsed by hand and must come before the workspace name.
+type sshOptions struct {
+	record      string
+	recordInput bool
+	container   string
+	workspace   string
+	stdio       bool
+}
+
+// sshProxyCmd is "coder ssh --stdio" with regular flags, for tools that
+// generate ProxyCommand lines themselves.
+func sshProxyCmd() *cobra.Command {
+	var (
+		container string
+		relay     bool
+		trace     wsnetTraceFlags
+	)
+	cmd := &cobra.Command{
+		Use:    "ssh-proxy [workspace_name[/agent]]",
+		Short:  "Speak SSH to a workspace over stdin and stdout",
+		Long:   "Speak SSH to a workspace over stdin and stdout, for use as an OpenSSH ProxyCommand. This is \"coder ssh --stdio\".",
+		Args:   cobra.MaximumNArgs(1),
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, _, err := workspaceArg("", args, 0)
+			if err != nil {
+				return err
+			}
+			return sshProxy(cmd.Context(), target, container, relay, trace)
+		},
+	}
+	trace.register(cmd)
+	cmd.Flags().StringVar(&container, "container", "", "reach the SSH server of this container of the workspace")
+	cmd.Flags().BoolVar(&relay, "relay", false, "relay traffic through the Coder deployment without trying a peer-to-peer connection")
+	return cmd
+}
+
+// sshProxy tunnels stdin and stdout to the SSH server of the workspace or
+// workspace/agent target, or of one of its containers.
+func sshProxy(ctx context.Context, target, container string, relay bool, trace wsnetTraceFlags) error {
+	c := &tunnneler{
+		log:           tunnelLogger(ctx),
+		stdio:         true,
+		remoteNetwork: "tcp",
+		remoteAddr:    "localhost:12213",
+		relay:         relay,
+	}
+	if container != "" {
+		c.remoteNetwork, c.remoteAddr = wsnet.ContainerNetwork, container
+	}
+	return runTunnel(ctx, c, target, trace)
+}
+
+// containerSSHArgs returns the ssh arguments to reach the SSH server of a
+// container of the workspace through "coder ssh --stdio". target is the workspace
+// name, or workspace/agent.
+func containerSSHArgs(binPath, target, container, privateKeyFilepath string) []string {
+	proxy := fmt.Sprintf("%q ssh --stdio --container %s %s", binPath, container, target)
+	return proxySSHArgs(proxy, sshHostAlias(target)+"."+container, privateKeyFilepath)
+}
+
+// agentSSHArgs returns the ssh arguments to reach the SSH server of the
+// workspace through "coder ssh --stdio" to the agent of a workspace/agent target.
+func agentSSHArgs(binPath, target, privateKeyFilepath string) []string {
+	proxy := fmt.Sprintf("%q ssh --stdio %s", binPath, target)
+	return proxySSHArgs(proxy, sshHostAlias(target), privateKeyFilepath)
+}
+
+func proxySSHArgs(proxy, host, privateKeyFilepath string) []string {
+	return []string{
+		"-o", "ProxyCommand=" + proxy,
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "LogLevel=ERROR",
+		"-o", "IdentitiesOnly=yes",
+		"-i", privateKeyFilepath,
+		host,
+	}
+}
+
+// sshHostAlias returns the host name ssh shows for a workspace or
+// workspace/agent target.
+func sshHostAlias(target string) string {
+	return "coder." + strings.ReplaceAll(target, "/", ".")
+}
+
+func parseSSHFlags(args []string) (sshOptions, []string, error) {
+	var opts sshOptions
+	for len(args) > 0 {
+		arg := args[0]
+		switch {
+		case arg == "--record":
+			if len(args) < 2 {
+				return opts, nil, xerrors.New("flag needs an argument: --record")
+			}
+			opts.record = args[1]
+			args = args[2:]
+		case strings.HasPrefix(arg, "--record="):
+			opts.record = strings.TrimPrefix(arg, "--record=")
+			args = args[1:]
+		case arg == "--container":
+			if len(args) < 2 {
+				return opts, nil, xerrors.New("flag needs an argument: --container")
+			}
+			opts.container = args[1]
+			args = args[2:]
+		case strings.HasPrefix(arg, "--container="):
+			opts.container = strings.TrimPrefix(arg, "--container=")
+			args = args[1:]
+		case arg == "--workspace":
+			if len(args) < 2 {
+				return opts, nil, xerrors.New("flag needs an argument: --workspace")
+			}
+			opts.workspace = args[1]
+			args = args[2:]
+		case strings.HasPrefix(arg, "--workspace="):
+			opts.workspace = strings.TrimPrefix(arg, "--workspace=")
+			args = args[1:]
+		case arg == "--stdio":
+			opts.stdio = true
+			args = args[1:]
+		case arg == "--record-input":
+			opts.recordInput = true
+			args = args[1:]
+		default:
+			return opts, args, opts.check()
+		}
+	}
+	return opts, args, opts.check()
+}
+
+func (opts sshOptions) check() error {
+	if opts.recordInput && opts.record == "" {
+		return xerrors.New("--record-input requires --record")
+	}
+	if opts.stdio && opts.record != "" {
+		return xerrors.New("--stdio can't be combined with --record")
+	}
 	return nil
 }
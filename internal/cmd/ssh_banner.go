@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/config"
+)
+
+// sshBannerLookupTimeout bounds the requests of the banner, so that a slow
+// deployment doesn't hold up the shell.
+const sshBannerLookupTimeout = 2 * time.Second
+
+// validateSSHBanner checks that the ssh-banner setting is on or off.
+func validateSSHBanner(_ context.Context, value string) error {
+	if value != "on" && value != "off" {
+		return xerrors.Errorf("invalid value %q: must be on or off", value)
+	}
+	return nil
+}
+
+// sshBannerEnabled reports whether "coder ssh" prints the banner, which it
+// does unless the ssh-banner setting is off.
+func sshBannerEnabled() bool {
+	value, err := config.SSHBanner.Read()
+	return err != nil || strings.TrimSpace(value) != "off"
+}
+
+// writeSSHBanner writes a summary of the workspace a shell is about to start
+// in: its image, resources, disk usage and when it stops by itself. The
+// banner is best effort, so what can't be fetched is left out.
+func writeSSHBanner(ctx context.Context, w io.Writer, client coder.Client, workspace coder.Workspace) {
+	image := workspace.ImageTag
+	lookupCtx, cancel := context.WithTimeout(ctx, sshBannerLookupTimeout)
+	defer cancel()
+	if img, err := client.ImageByID(lookupCtx, workspace.ImageID); err == nil {
+		image = img.Repository + ":" + workspace.ImageTag
+	}
+	resources := fmt.Sprintf("%g CPU, %g GB memory, %d GB disk", workspace.CPUCores, workspace.MemoryGB, workspace.DiskGB)
+	if workspace.GPUs > 0 {
+		resources += fmt.Sprintf(", %d GPU", workspace.GPUs)
+	}
+	lines := []string{
+		fmt.Sprintf("workspace %s", workspace.Name),
+		fmt.Sprintf("  image:     %s", image),
+		fmt.Sprintf("  resources: %s", resources),
+	}
+
+	if stat := workspace.LatestStat; stat.DiskTotal > 0 {
+		line := fmt.Sprintf("  disk:      %s of %s used (%.0f%%)", formatBytes(uint64(stat.DiskUsed)), formatBytes(uint64(stat.DiskTotal)),
+			float64(stat.DiskUsed)/float64(stat.DiskTotal)*100)
+		if stat.DiskPressure == coder.DiskPressureWarning || stat.DiskPressure == coder.DiskPressureCritical {
+			line += ", " + string(stat.DiskPressure)
+		}
+		lines = append(lines, line)
+	}
+
+	if threshold := time.Duration(workspace.AutoOffThreshold); threshold > 0 {
+		// The workspace stops once nobody used it for the threshold, and this
+		// session keeps it in use, so the countdown starts when it ends.
+		lines = append(lines, fmt.Sprintf("  autostop:  %s after the last session ends", formatAutostop(threshold)))
+	}
+
+	fmt.Fprintln(w, strings.Join(lines, "\n"))
+}
+
+// formatAutostop formats the time until autostop to the minute.
+func formatAutostop(d time.Duration) string {
+	if d < time.Minute {
+		return "less than a minute"
+	}
+	d = d.Round(time.Minute)
+	h, m := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%dm", m)
+	case m == 0:
+		return fmt.Sprintf("%dh", h)
+	default:
+		return fmt.Sprintf("%dh%dm", h, m)
+	}
+}
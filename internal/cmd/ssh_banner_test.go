@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_writeSSHBanner(t *testing.T) {
+	t.Parallel()
+	fake := codertest.New()
+	imageID := fake.AddImage(coder.Image{Repository: "codercom/enterprise-base"}, "ubuntu")
+	workspace := coder.Workspace{
+		Name:             "my-dev",
+		ImageID:          imageID,
+		ImageTag:         "ubuntu",
+		CPUCores:         4,
+		MemoryGB:         8,
+		DiskGB:           30,
+		AutoOffThreshold: coder.Duration(4*time.Hour + 30*time.Minute),
+		LatestStat:       coder.WorkspaceStat{DiskTotal: 30 << 30, DiskUsed: 27 << 30, DiskPressure: coder.DiskPressureWarning},
+	}
+	workspace.ID = fake.AddWorkspace(workspace)
+
+	var b bytes.Buffer
+	writeSSHBanner(context.Background(), &b, fake, workspace)
+	want := "workspace my-dev\n" +
+		"  image:     codercom/enterprise-base:ubuntu\n" +
+		"  resources: 4 CPU, 8 GB memory, 30 GB disk\n" +
+		"  disk:      27.0 GiB of 30.0 GiB used (90%), warning\n" +
+		"  autostop:  4h30m after the last session ends\n"
+	assert.Equal(t, "banner", want, b.String())
+
+	b.Reset()
+	workspace.AutoOffThreshold = 0
+	workspace.ImageID = "missing"
+	workspace.LatestStat = coder.WorkspaceStat{}
+	writeSSHBanner(context.Background(), &b, codertest.New(), workspace)
+	want = "workspace my-dev\n" +
+		"  image:     ubuntu\n" +
+		"  resources: 4 CPU, 8 GB memory, 30 GB disk\n"
+	assert.Equal(t, "without what can't be fetched", want, b.String())
+}
+
+func Test_validateSSHBanner(t *testing.T) {
+	t.Parallel()
+
+	assert.Success(t, "on", validateSSHBanner(context.Background(), "on"))
+	assert.Success(t, "off", validateSSHBanner(context.Background(), "off"))
+	assert.Error(t, "other", validateSSHBanner(context.Background(), "yes"))
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// sshConnectionFailed is the exit code of ssh when it fails to connect,
+// as opposed to the exit code of the remote command.
+const sshConnectionFailed = 255
+
+// buildLogTimeout bounds how long diagnosis reads the build log for.
+var buildLogTimeout = 5 * time.Second
+
+// diagnoseWorkspace explains why the workspace can't be reached, from its
+// status, its last build and whether its agent is connected. It returns nil
+// if nothing looks wrong.
+func diagnoseWorkspace(ctx context.Context, client coder.Client, workspace *coder.Workspace) error {
+	// The status fetched before connecting may be stale by now.
+	if latest, err := client.WorkspaceByID(ctx, workspace.ID); err == nil {
+		workspace = latest
+	}
+
+	var causes []string
+	if workspace.LatestStat.StatError != "" {
+		causes = append(causes, clog.Causef(workspace.LatestStat.StatError))
+	}
+	switch workspace.LatestStat.ContainerStatus {
+	case coder.WorkspaceOff:
+		return clog.Error(i18n.Sprintf("workspace %q is off", workspace.Name), append(causes,
+			clog.BlankLine,
+			clog.Tipf("use \"coder workspaces rebuild %s\" to start it", workspace.Name),
+		)...)
+	case coder.WorkspaceCreating:
+		return clog.Error(i18n.Sprintf("workspace %q is still building", workspace.Name), append(causes,
+			clog.BlankLine,
+			clog.Tipf("use \"coder workspaces watch-build %s\" to wait for the build to finish", workspace.Name),
+		)...)
+	case coder.WorkspaceFailed:
+		stage, buildErr := lastBuildFailure(ctx, client, workspace.ID)
+		if buildErr != "" {
+			causes = append(causes, clog.Causef(buildErr))
+		}
+		header := fmt.Sprintf("the last build of workspace %q failed", workspace.Name)
+		if stage != "" {
+			header = fmt.Sprintf("the last build of workspace %q failed at stage %q", workspace.Name, stage)
+		}
+		return clog.Error(header, append(causes,
+			clog.BlankLine,
+			clog.Tipf("use \"coder workspaces rebuild %s --follow\" to retry the build", workspace.Name),
+		)...)
+	case coder.WorkspaceOn:
+	default:
+		return clog.Error(i18n.Sprintf("workspace %q is not available", workspace.Name), append(causes,
+			fmt.Sprintf("current status: %q", workspace.LatestStat.ContainerStatus),
+			clog.BlankLine,
+			clog.Tipf("use \"coder workspaces rebuild %s\" to rebuild this workspace", workspace.Name),
+		)...)
+	}
+
+	err := probeWorkspace(ctx, client, workspace)
+	if err == nil {
+		return nil
+	}
+	causes = append(causes, clog.Causef(err.Error()))
+	if workspace.LatestStat.LastOnline.IsZero() {
+		return clog.Error(i18n.Sprintf("the agent of workspace %q never connected", workspace.Name), append(causes,
+			clog.BlankLine,
+			clog.Hintf("the image's entrypoint may be preventing the agent from starting"),
+			clog.Tipf("check that the image doesn't replace the workspace's init process"),
+		)...)
+	}
+	return clog.Error(i18n.Sprintf("the agent of workspace %q is not connected", workspace.Name), append(causes,
+		fmt.Sprintf("last online %s ago", time.Since(workspace.LatestStat.LastOnline).Round(time.Second)),
+		clog.BlankLine,
+		clog.Tipf("use \"coder workspaces rebuild %s\" to restart the workspace", workspace.Name),
+	)...)
+}
+
+// lastBuildFailure returns the last stage the latest build of the workspace
+// reached, and the first error it logged.
+func lastBuildFailure(ctx context.Context, client coder.Client, workspaceID string) (stage, buildErr string) {
+	ctx, cancel := context.WithTimeout(ctx, buildLogTimeout)
+	defer cancel()
+
+	logs, err := client.FollowWorkspaceBuildLog(ctx, workspaceID)
+	if err != nil {
+		return "", ""
+	}
+	for l := range logs {
+		if l.Err != nil {
+			if xerrors.Is(l.Err, context.DeadlineExceeded) || xerrors.Is(l.Err, context.Canceled) {
+				break
+			}
+			continue
+		}
+		switch l.Type {
+		case coder.BuildLogTypeStart:
+			stage, buildErr = "", ""
+		case coder.BuildLogTypeStage:
+			if buildErr == "" {
+				stage = l.Msg
+			}
+		case coder.BuildLogTypeError:
+			if buildErr == "" {
+				buildErr = l.Msg
+			}
+		case coder.BuildLogTypeDone:
+			return stage, buildErr
+		}
+	}
+	return stage, buildErr
+}
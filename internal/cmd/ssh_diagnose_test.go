@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+// Not parallel: probeWorkspace is replaced for the package.
+func Test_diagnoseWorkspace(t *testing.T) {
+	ctx := context.Background()
+	fake := codertest.New()
+
+	var probeErr error
+	prevProbe := probeWorkspace
+	probeWorkspace = func(context.Context, coder.Client, *coder.Workspace) error { return probeErr }
+	t.Cleanup(func() { probeWorkspace = prevProbe })
+
+	failed := fake.AddWorkspace(coder.Workspace{
+		Name:       "failed",
+		LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceFailed},
+	})
+	fake.SetBuildLog(failed, []coder.BuildLog{
+		{Type: coder.BuildLogTypeStart, Msg: "Rebuilding workspace"},
+		{Type: coder.BuildLogTypeStage, Msg: "Pulling image"},
+		{Type: coder.BuildLogTypeStage, Msg: "Running personalize script"},
+		{Type: coder.BuildLogTypeError, Msg: "personalize exited with code 1"},
+		{Type: coder.BuildLogTypeDone, Msg: "Build failed"},
+	})
+	fake.AddWorkspace(coder.Workspace{
+		Name:       "off",
+		LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOff},
+	})
+	fake.AddWorkspace(coder.Workspace{Name: "never-connected"})
+	fake.AddWorkspace(coder.Workspace{
+		Name:       "disconnected",
+		LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOn, LastOnline: time.Now().Add(-time.Hour)},
+	})
+
+	diagnose := func(name string) string {
+		workspace, err := findWorkspace(ctx, fake, name, coder.Me)
+		assert.Success(t, "find workspace", err)
+		err = diagnoseWorkspace(ctx, fake, workspace)
+		if err == nil {
+			return ""
+		}
+		return err.Error()
+	}
+
+	assert.True(t, "off", strings.Contains(diagnose("off"), `workspace "off" is off`))
+	assert.True(t, "failed stage", strings.Contains(diagnose("failed"), `failed at stage "Running personalize script"`))
+
+	probeErr = xerrors.New("dial timed out")
+	assert.True(t, "never connected", strings.Contains(diagnose("never-connected"), "never connected"))
+	assert.True(t, "disconnected", strings.Contains(diagnose("disconnected"), "is not connected"))
+
+	probeErr = nil
+	assert.Equal(t, "healthy", "", diagnose("disconnected"))
+}
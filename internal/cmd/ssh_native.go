@@ -0,0 +1,390 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"cdr.dev/slog"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/x/xterminal"
+	"cdr.dev/coder-cli/wsnet"
+)
+
+// nativeSSHEnv set to 1 makes "coder ssh" use its own SSH client even where
+// an ssh binary is installed, and set to 0 makes it require the binary.
+const nativeSSHEnv = "CODER_SSH_NATIVE"
+
+// useNativeSSH reports whether "coder ssh" uses its own SSH client, which it
+// does where no ssh binary is installed, such as in minimal containers and
+// on Windows without OpenSSH.
+func useNativeSSH() bool {
+	if v := os.Getenv(nativeSSHEnv); v != "" {
+		return v == "1"
+	}
+	_, err := exec.LookPath("ssh")
+	return err != nil
+}
+
+// sshForward is a port forward of the native SSH client.
+type sshForward struct {
+	// listen is the address listened on: local for -L, of the workspace
+	// for -R.
+	listen string
+	// dest is the address connected to: of the workspace for -L, local for
+	// -R.
+	dest string
+}
+
+// nativeSSHArgs are the ssh arguments the native SSH client understands.
+type nativeSSHArgs struct {
+	localForwards  []sshForward
+	remoteForwards []sshForward
+	// noCommand is -N, only forwarding ports.
+	noCommand bool
+	// forceTTY is -t and noTTY -T; by default a terminal is allocated for
+	// shells when stdin is one.
+	forceTTY bool
+	noTTY    bool
+	command  []string
+}
+
+// parseNativeSSHArgs parses the arguments following the workspace name. The
+// first argument that isn't a flag starts the command.
+func parseNativeSSHArgs(args []string) (nativeSSHArgs, error) {
+	var a nativeSSHArgs
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		arg := args[0]
+		args = args[1:]
+		switch {
+		case arg == "--":
+			a.command = args
+			return a, nil
+		case arg == "-N":
+			a.noCommand = true
+		case arg == "-t":
+			a.forceTTY = true
+		case arg == "-T":
+			a.noTTY = true
+		case strings.HasPrefix(arg, "-L") || strings.HasPrefix(arg, "-R"):
+			spec := arg[2:]
+			if spec == "" {
+				if len(args) == 0 {
+					return a, xerrors.Errorf("flag needs an argument: %s", arg)
+				}
+				spec, args = args[0], args[1:]
+			}
+			fwd, err := parseSSHForward(spec)
+			if err != nil {
+				return a, xerrors.Errorf("%s %s: %w", arg[:2], spec, err)
+			}
+			if arg[1] == 'L' {
+				a.localForwards = append(a.localForwards, fwd)
+			} else {
+				a.remoteForwards = append(a.remoteForwards, fwd)
+			}
+		default:
+			return a, xerrors.Errorf("ssh flag %s isn't supported without an ssh binary, install OpenSSH to use it", arg)
+		}
+	}
+	a.command = args
+	return a, nil
+}
+
+// parseSSHForward parses a [bind_address:]port:host:hostport spec, listening
+// on localhost by default.
+func parseSSHForward(spec string) (sshForward, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) == 3 {
+		parts = append([]string{"localhost"}, parts...)
+	}
+	if len(parts) != 4 {
+		return sshForward{}, xerrors.New("expected [bind_address:]port:host:hostport")
+	}
+	for _, port := range []string{parts[1], parts[3]} {
+		if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+			return sshForward{}, xerrors.Errorf("invalid port %q", port)
+		}
+	}
+	return sshForward{
+		listen: net.JoinHostPort(parts[0], parts[1]),
+		dest:   net.JoinHostPort(parts[2], parts[3]),
+	}, nil
+}
+
+// nativeSSHSession is a session of the native SSH client.
+type nativeSSHSession struct {
+	log    slog.Logger
+	dialer connDialer
+	// network and addr are of the SSH server, through dialer.
+	network string
+	addr    string
+	user    string
+	signer  ssh.Signer
+	args    nativeSSHArgs
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// nativeSSHConnectError is returned when the SSH connection couldn't be
+// established, as opposed to the session failing.
+type nativeSSHConnectError struct {
+	err error
+}
+
+func (e nativeSSHConnectError) Error() string { return e.err.Error() }
+func (e nativeSSHConnectError) Unwrap() error { return e.err }
+
+// connect establishes the SSH connection of the session.
+func (s *nativeSSHSession) connect(ctx context.Context) (*ssh.Client, error) {
+	nc, err := s.dialer.DialContext(ctx, s.network, s.addr)
+	if err != nil {
+		return nil, nativeSSHConnectError{xerrors.Errorf("dial ssh server: %w", err)}
+	}
+	conn, chans, reqs, err := ssh.NewClientConn(nc, s.addr, &ssh.ClientConfig{
+		User: s.user,
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(s.signer)},
+		// Like the ssh binary is run with StrictHostKeyChecking=no: the
+		// connection is authenticated by wsnet.
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		_ = nc.Close()
+		return nil, nativeSSHConnectError{xerrors.Errorf("ssh handshake: %w", err)}
+	}
+	return ssh.NewClient(conn, chans, reqs), nil
+}
+
+// run runs the session and returns the exit code of its command.
+func (s *nativeSSHSession) run(ctx context.Context) (int, error) {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	for _, fwd := range s.args.localForwards {
+		listener, err := net.Listen("tcp", fwd.listen)
+		if err != nil {
+			return 0, xerrors.Errorf("listen on %s: %w", fwd.listen, err)
+		}
+		defer listener.Close()
+		go s.forward(ctx, listener, fwd.dest, s.dialer.DialContext)
+	}
+	for _, fwd := range s.args.remoteForwards {
+		listener, err := client.Listen("tcp", fwd.listen)
+		if err != nil {
+			return 0, xerrors.Errorf("listen on %s in the workspace: %w", fwd.listen, err)
+		}
+		defer listener.Close()
+		go s.forward(ctx, listener, fwd.dest, (&net.Dialer{}).DialContext)
+	}
+
+	if s.args.noCommand {
+		done := make(chan error, 1)
+		go func() { done <- client.Wait() }()
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		return 0, nil
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, xerrors.Errorf("open session: %w", err)
+	}
+	defer session.Close()
+	session.Stdin = s.stdin
+	session.Stdout = s.stdout
+	session.Stderr = s.stderr
+
+	if s.wantTTY() {
+		restore, err := s.requestPTY(ctx, session)
+		if err != nil {
+			return 0, err
+		}
+		defer restore()
+	}
+
+	if len(s.args.command) == 0 {
+		err = session.Shell()
+	} else {
+		// Like ssh, the arguments are joined into one command line for the
+		// shell of the workspace.
+		err = session.Start(strings.Join(s.args.command, " "))
+	}
+	if err != nil {
+		return 0, xerrors.Errorf("start: %w", err)
+	}
+	err = session.Wait()
+	var exitErr *ssh.ExitError
+	if xerrors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return sshConnectionFailed, xerrors.Errorf("session: %w", err)
+	}
+	return 0, nil
+}
+
+func (s *nativeSSHSession) wantTTY() bool {
+	if s.args.noTTY {
+		return false
+	}
+	if s.args.forceTTY {
+		return true
+	}
+	f, ok := s.stdin.(*os.File)
+	return ok && len(s.args.command) == 0 && term.IsTerminal(int(f.Fd()))
+}
+
+// requestPTY allocates a terminal of the size of ours, which it puts in raw
+// mode and keeps the size of, until restore is called.
+func (s *nativeSSHSession) requestPTY(ctx context.Context, session *ssh.Session) (restore func(), _ error) {
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = "xterm-256color"
+	}
+	inFd, outFd := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	width, height, err := term.GetSize(outFd)
+	if err != nil {
+		width, height = 80, 24
+	}
+	if err := session.RequestPty(termType, height, width, ssh.TerminalModes{ssh.ECHO: 1}); err != nil {
+		return nil, xerrors.Errorf("request pty: %w", err)
+	}
+
+	var restores []func()
+	if inState, err := term.MakeRaw(inFd); err == nil {
+		restores = append(restores, func() { _ = term.Restore(inFd, inState) })
+	}
+	if outState, err := xterminal.MakeOutputRaw(os.Stdout.Fd()); err == nil && outState != nil {
+		restores = append(restores, func() { _ = xterminal.Restore(os.Stdout.Fd(), outState) })
+	}
+
+	// Polling works on every platform, unlike SIGWINCH.
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			w, h, err := term.GetSize(outFd)
+			if err != nil || (w == width && h == height) {
+				continue
+			}
+			width, height = w, h
+			_ = session.WindowChange(height, width)
+		}
+	}()
+	return func() {
+		cancel()
+		for _, restore := range restores {
+			restore()
+		}
+	}, nil
+}
+
+// forward forwards the connections accepted by listener to dest.
+func (s *nativeSSHSession) forward(ctx context.Context, listener net.Listener, dest string, dial func(ctx context.Context, network, addr string) (net.Conn, error)) {
+	for {
+		lc, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer lc.Close()
+			rc, err := dial(ctx, "tcp", dest)
+			if err != nil {
+				s.log.Warn(ctx, "forward connection", slog.F("dest", dest), slog.Error(err))
+				return
+			}
+			defer rc.Close()
+			go func() {
+				_, _ = io.Copy(lc, rc)
+				_ = lc.Close()
+			}()
+			_, _ = io.Copy(rc, lc)
+		}()
+	}
+}
+
+// runNativeSSH runs "coder ssh" with the native SSH client.
+func runNativeSSH(ctx context.Context, client coder.Client, workspace *coder.Workspace, agent, container, user, privateKeyPath string, args []string) (int, error) {
+	sshArgs, err := parseNativeSSHArgs(args)
+	if err != nil {
+		return 0, err
+	}
+	s, closeDialer, err := newNativeSSHSession(ctx, client, workspace, agent, container, user, privateKeyPath)
+	if err != nil {
+		return 0, err
+	}
+	defer closeDialer()
+	s.args = sshArgs
+	return s.run(ctx)
+}
+
+// newNativeSSHSession returns a session of the native SSH client with the
+// SSH server of the workspace, or of one of its containers, reached through
+// the agent, and a func closing the connection to the agent.
+func newNativeSSHSession(ctx context.Context, client coder.Client, workspace *coder.Workspace, agent, container, user, privateKeyPath string) (*nativeSSHSession, func(), error) {
+	rawKey, err := ioutil.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("read ssh key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(rawKey)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("parse ssh key: %w", err)
+	}
+	iceServers, err := client.ICEServers(ctx)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("get ICE servers: %w", err)
+	}
+	baseURL := client.BaseURL()
+	c := &tunnneler{
+		log:        tunnelLogger(ctx),
+		brokerAddr: &baseURL,
+		token:      client.Token(),
+		workspace:  workspace,
+		agent:      agent,
+		iceServers: iceServers,
+	}
+	dialer, err := c.connect(ctx)
+	if err != nil {
+		return nil, nil, nativeSSHConnectError{err}
+	}
+	go updateLastConnection(ctx, client, workspace.ID)
+
+	s := &nativeSSHSession{
+		log:     c.log,
+		dialer:  dialer,
+		network: "tcp",
+		addr:    "localhost:12213",
+		user:    user,
+		signer:  signer,
+		stdin:   os.Stdin,
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
+	}
+	if container != "" {
+		s.network, s.addr = wsnet.ContainerNetwork, container
+	}
+	return s, func() { _ = dialer.Close() }, nil
+}
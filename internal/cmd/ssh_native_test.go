@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func Test_parseNativeSSHArgs(t *testing.T) {
+	t.Parallel()
+
+	a, err := parseNativeSSHArgs([]string{"-L", "8080:localhost:80", "-R127.0.0.1:9000:localhost:3000", "-t", "htop", "-d"})
+	assert.Success(t, "parse", err)
+	assert.Equal(t, "local forward", []sshForward{{listen: "localhost:8080", dest: "localhost:80"}}, a.localForwards)
+	assert.Equal(t, "remote forward", []sshForward{{listen: "127.0.0.1:9000", dest: "localhost:3000"}}, a.remoteForwards)
+	assert.True(t, "tty", a.forceTTY)
+	assert.Equal(t, "flags after the command are its own", []string{"htop", "-d"}, a.command)
+
+	a, err = parseNativeSSHArgs([]string{"-N", "--", "-x"})
+	assert.Success(t, "parse", err)
+	assert.True(t, "no command", a.noCommand)
+	assert.Equal(t, "command after --", []string{"-x"}, a.command)
+
+	_, err = parseNativeSSHArgs([]string{"-A"})
+	assert.Error(t, "unsupported flag", err)
+	_, err = parseNativeSSHArgs([]string{"-L"})
+	assert.Error(t, "forward requires value", err)
+	_, err = parseNativeSSHArgs([]string{"-L", "8080:80"})
+	assert.Error(t, "malformed forward", err)
+	_, err = parseNativeSSHArgs([]string{"-L", "http:localhost:80"})
+	assert.Error(t, "invalid port", err)
+}
+
+// directDialer dials addresses directly, standing in for the agent.
+type directDialer struct{}
+
+func (directDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return (&net.Dialer{}).DialContext(ctx, network, address)
+}
+func (directDialer) Ping(context.Context) error { return nil }
+func (directDialer) Close() error               { return nil }
+
+// echoSSHCommand prints the command of a session instead of running it, and
+// exits with status 3.
+func echoSSHCommand(ch ssh.Channel, command string) uint32 {
+	_, _ = io.WriteString(ch, "ran "+command)
+	return 3
+}
+
+// shellSSHCommand runs the command of a session with sh, standing in for the
+// SSH server of a workspace.
+func shellSSHCommand(ch ssh.Channel, command string) uint32 {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = ch, ch, ch.Stderr()
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return uint32(exitErr.ExitCode())
+		}
+		return 1
+	}
+	return 0
+}
+
+// serveTestSSH serves SSH sessions authenticated by key, which run their
+// command with run and exit with the status it returns.
+func serveTestSSH(t *testing.T, key ssh.PublicKey, run func(ch ssh.Channel, command string) uint32) string {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Success(t, "generate host key", err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	assert.Success(t, "host signer", err)
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, k ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(k.Marshal(), key.Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Success(t, "listen", err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			nc, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(nc, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newCh := range chans {
+					ch, chReqs, err := newCh.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						for req := range chReqs {
+							if req.Type != "exec" {
+								_ = req.Reply(false, nil)
+								continue
+							}
+							_ = req.Reply(true, nil)
+							var payload struct{ Command string }
+							_ = ssh.Unmarshal(req.Payload, &payload)
+							status := run(ch, payload.Command)
+							_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+							_ = ch.Close()
+						}
+					}()
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func Test_nativeSSHSession(t *testing.T) {
+	t.Parallel()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.Success(t, "generate key", err)
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.Success(t, "signer", err)
+	addr := serveTestSSH(t, signer.PublicKey(), echoSSHCommand)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("ExitCode", func(t *testing.T) {
+		var stdout bytes.Buffer
+		s := &nativeSSHSession{
+			log:     slogtest.Make(t, nil),
+			dialer:  directDialer{},
+			network: "tcp",
+			addr:    addr,
+			user:    "coder",
+			signer:  signer,
+			args:    nativeSSHArgs{command: []string{"echo", "hi"}},
+			stdin:   &bytes.Buffer{},
+			stdout:  &stdout,
+			stderr:  ioutil.Discard,
+		}
+		code, err := s.run(ctx)
+		assert.Success(t, "run", err)
+		assert.Equal(t, "exit code", 3, code)
+		assert.Equal(t, "output", "ran echo hi", stdout.String())
+	})
+
+	t.Run("LocalForward", func(t *testing.T) {
+		echo, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Success(t, "listen echo", err)
+		defer echo.Close()
+		go func() {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_, _ = io.Copy(conn, conn)
+		}()
+		free, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Success(t, "find free port", err)
+		local := free.Addr().String()
+		_ = free.Close()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		s := &nativeSSHSession{
+			log:     slogtest.Make(t, nil),
+			dialer:  directDialer{},
+			network: "tcp",
+			addr:    addr,
+			user:    "coder",
+			signer:  signer,
+			args: nativeSSHArgs{
+				noCommand:     true,
+				localForwards: []sshForward{{listen: local, dest: echo.Addr().String()}},
+			},
+		}
+		done := make(chan error, 1)
+		go func() {
+			_, err := s.run(ctx)
+			done <- err
+		}()
+
+		var conn net.Conn
+		for i := 0; i < 50; i++ {
+			if conn, err = net.Dial("tcp", local); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		assert.Success(t, "dial forward", err)
+		defer conn.Close()
+		_, err = conn.Write([]byte("ping"))
+		assert.Success(t, "write", err)
+		got := make([]byte, 4)
+		_, err = io.ReadFull(conn, got)
+		assert.Success(t, "read", err)
+		assert.Equal(t, "echoed through the forward", "ping", string(got))
+
+		cancel()
+		assert.Success(t, "run", <-done)
+	})
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/asciicast"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// runRecorded runs the ssh command while recording the session as an
+// asciicast file at the location given by --record.
+func runRecorded(ssh *exec.Cmd, workspaceName string, opts sshOptions) error {
+	path, err := recordingPath(opts.record, workspaceName, time.Now())
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return xerrors.Errorf("create recording: %w", err)
+	}
+	defer f.Close()
+
+	width, height := 80, 24
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		width, height = w, h
+	}
+	rec, err := asciicast.NewRecorder(f, asciicast.Header{
+		Width:  width,
+		Height: height,
+		Title:  "coder ssh " + workspaceName,
+		Env: map[string]string{
+			"SHELL": os.Getenv("SHELL"),
+			"TERM":  os.Getenv("TERM"),
+		},
+	})
+	if err != nil {
+		return xerrors.Errorf("write recording: %w", err)
+	}
+
+	// The banner is part of the recording as well so whoever plays it back
+	// knows the participants were told.
+	banner := recordingBanner(opts.recordInput)
+	fmt.Fprint(os.Stderr, banner)
+	rec.Record(asciicast.EventOutput, []byte(banner))
+
+	ssh.Stdout = io.MultiWriter(os.Stdout, rec.Writer(asciicast.EventOutput))
+	ssh.Stderr = io.MultiWriter(os.Stderr, rec.Writer(asciicast.EventOutput))
+
+	if opts.recordInput {
+		stdinFd := int(os.Stdin.Fd())
+		if term.IsTerminal(stdinFd) {
+			// ssh can no longer see the terminal once stdin is piped through us,
+			// so force a remote terminal and put the local one in raw mode ourselves.
+			state, err := term.MakeRaw(stdinFd)
+			if err != nil {
+				return xerrors.Errorf("make terminal raw: %w", err)
+			}
+			defer func() { _ = term.Restore(stdinFd, state) }()
+			ssh.Args = append([]string{ssh.Args[0], "-tt"}, ssh.Args[1:]...)
+		}
+
+		ssh.Stdin = nil
+		in, err := ssh.StdinPipe()
+		if err != nil {
+			return xerrors.Errorf("create stdin pipe: %w", err)
+		}
+		// Not waited on: the read from stdin only returns on the next keystroke,
+		// which may never come. The pipe is closed once ssh exits.
+		go func() {
+			_, _ = io.Copy(in, io.TeeReader(os.Stdin, rec.Writer(asciicast.EventInput)))
+			_ = in.Close()
+		}()
+	}
+
+	err = ssh.Run()
+	if rerr := rec.Err(); rerr != nil {
+		clog.LogWarn("the session recording is incomplete", clog.Causef(rerr.Error()))
+	}
+	clog.LogSuccess(i18n.Sprintf("session recorded to %q", path),
+		clog.Tipf("play it back with \"asciinema play %s\"", path),
+	)
+	return err
+}
+
+func recordingBanner(input bool) string {
+	what := "output"
+	if input {
+		what = "output and keystrokes"
+	}
+	return fmt.Sprintf("*** This session is being recorded (%s). ***\r\n", what)
+}
+
+// recordingPath returns the file to record to. A path ending in ".cast" is
+// used as is; anything else is treated as a directory to create the
+// recording in.
+func recordingPath(record, workspaceName string, now time.Time) (string, error) {
+	if strings.HasPrefix(record, "~") {
+		usr, err := user.Current()
+		if err != nil {
+			return "", xerrors.Errorf("get user home directory: %w", err)
+		}
+		record = strings.Replace(record, "~", usr.HomeDir, 1)
+	}
+
+	dir, path := record, ""
+	if strings.HasSuffix(record, ".cast") {
+		dir = filepath.Dir(record)
+		path = record
+	} else {
+		path = filepath.Join(record, fmt.Sprintf("%s-%s.cast", workspaceName, now.Format("20060102-150405")))
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", xerrors.Errorf("create recording directory: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_parseSSHFlags(t *testing.T) {
+	t.Parallel()
+
+	opts, args, err := parseSSHFlags([]string{"--record", "/tmp/sessions", "--record-input", "my-dev", "--record", "x"})
+	assert.Success(t, "parse", err)
+	assert.Equal(t, "record", "/tmp/sessions", opts.record)
+	assert.True(t, "record input", opts.recordInput)
+	assert.Equal(t, "remaining args passed through", []string{"my-dev", "--record", "x"}, args)
+
+	opts, args, err = parseSSHFlags([]string{"--record=out.cast", "my-dev", "pwd"})
+	assert.Success(t, "parse with equals", err)
+	assert.Equal(t, "record", "out.cast", opts.record)
+	assert.Equal(t, "args", []string{"my-dev", "pwd"}, args)
+
+	_, _, err = parseSSHFlags([]string{"--record-input", "my-dev"})
+	assert.Error(t, "input requires record", err)
+
+	_, _, err = parseSSHFlags([]string{"--record"})
+	assert.Error(t, "record requires value", err)
+
+	opts, args, err = parseSSHFlags([]string{"--container", "tools", "my-dev", "pwd"})
+	assert.Success(t, "parse container", err)
+	assert.Equal(t, "container", "tools", opts.container)
+	assert.Equal(t, "args", []string{"my-dev", "pwd"}, args)
+
+	opts, _, err = parseSSHFlags([]string{"--container=tools", "my-dev"})
+	assert.Success(t, "parse container with equals", err)
+	assert.Equal(t, "container", "tools", opts.container)
+
+	_, _, err = parseSSHFlags([]string{"--container"})
+	assert.Error(t, "container requires value", err)
+
+	opts, args, err = parseSSHFlags([]string{"--stdio", "--container", "tools", "my-dev"})
+	assert.Success(t, "parse stdio", err)
+	assert.True(t, "stdio", opts.stdio)
+	assert.Equal(t, "args", []string{"my-dev"}, args)
+
+	_, _, err = parseSSHFlags([]string{"--stdio", "--record", "out.cast", "my-dev"})
+	assert.Error(t, "stdio can't be recorded", err)
+}
+
+func Test_containerSSHArgs(t *testing.T) {
+	t.Parallel()
+
+	args := containerSSHArgs("/usr/local/bin/coder", "my-dev", "tools", "/home/me/.ssh/coder_enterprise")
+	assert.Equal(t, "proxy command", `ProxyCommand="/usr/local/bin/coder" ssh --stdio --container tools my-dev`, args[1])
+	assert.Equal(t, "host", "coder.my-dev.tools", args[len(args)-1])
+
+	args = containerSSHArgs("/usr/local/bin/coder", "my-dev/gpu", "tools", "/home/me/.ssh/coder_enterprise")
+	assert.Equal(t, "agent proxy command", `ProxyCommand="/usr/local/bin/coder" ssh --stdio --container tools my-dev/gpu`, args[1])
+	assert.Equal(t, "agent host", "coder.my-dev.gpu.tools", args[len(args)-1])
+}
+
+func Test_agentSSHArgs(t *testing.T) {
+	t.Parallel()
+
+	args := agentSSHArgs("/usr/local/bin/coder", "my-dev/gpu", "/home/me/.ssh/coder_enterprise")
+	assert.Equal(t, "proxy command", `ProxyCommand="/usr/local/bin/coder" ssh --stdio my-dev/gpu`, args[1])
+	assert.Equal(t, "host", "coder.my-dev.gpu", args[len(args)-1])
+}
+
+func Test_recordingPath(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	now := time.Date(2021, 5, 4, 13, 2, 1, 0, time.UTC)
+
+	path, err := recordingPath(filepath.Join(dir, "sessions"), "my-dev", now)
+	assert.Success(t, "directory", err)
+	assert.Equal(t, "generated name", filepath.Join(dir, "sessions", "my-dev-20210504-130201.cast"), path)
+
+	path, err = recordingPath(filepath.Join(dir, "a", "pairing.cast"), "my-dev", now)
+	assert.Success(t, "file", err)
+	assert.Equal(t, "file used as is", filepath.Join(dir, "a", "pairing.cast"), path)
+}
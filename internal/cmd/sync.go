@@ -2,120 +2,545 @@ package cmd
 
 import (
 	"bytes"
-	"log"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	stdsync "sync"
+	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/term"
 	"golang.org/x/xerrors"
 
 	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/internal/sync"
 	"cdr.dev/coder-cli/internal/x/xcobra"
 	"cdr.dev/coder-cli/pkg/clog"
 )
 
 func syncCmd() *cobra.Command {
-	var init bool
+	var (
+		init         bool
+		verify       bool
+		excludes     []string
+		watch        bool
+		conflicts    string
+		pollInterval time.Duration
+		allowEmpty   bool
+		lockFile     string
+	)
 	cmd := &cobra.Command{
 		Use:   "sync [local directory] [<workspace name>:<remote directory>]",
 		Short: "Establish a one way directory sync to a Coder workspace",
-		Args:  xcobra.ExactArgs(2),
-		RunE:  makeRunSync(&init),
+		Long: "Establish a one way directory sync to a Coder workspace.\n\n" +
+			"Without arguments, it starts the sync sessions of the repository of the current directory, like \"coder sync start\".\n\n" +
+			"Before the initial transfer, the remote directory is checked to be writable and to have room for the local directory.\n\n" +
+			"After every transfer, the SHA-256 of the transferred files is compared on both ends, and files that differ " +
+			"are transferred again. Every verified file is recorded in a journal in the Coder configuration directory.\n\n" +
+			"The hashes of local files are cached in the Coder configuration directory along with their size and " +
+			"modification time, so restarting a sync only reads the files that changed since.\n\n" +
+			"Files are transferred with rsync, which must be installed on both ends with the same protocol version. " +
+			"Otherwise, such as on Windows, a built-in transfer sends the files whose SHA-256 differs through the workspace " +
+			"executor with tar instead. Set " + nativeSyncEnv + "=1 to use it anyway, or " + nativeSyncEnv + "=0 to require rsync.\n\n" +
+			"With --watch, changes are propagated both ways: local changes as they happen, and remote ones as the workspace is polled. " +
+			"The patterns of the .gitignore and .coderignore at the root of the local directory are left out, along with --exclude. " +
+			"A file changed on both ends since they last agreed is a conflict, which --conflict settles by keeping the local or remote copy, " +
+			"or by asking which to keep. The hashes both ends agreed on are kept in the Coder configuration directory, " +
+			"so files deleted while the sync wasn't running are deleted on the other end too. Directories are created as files need them, " +
+			"and the first session merges both ends. If the remote directory turns out empty, such as after a rebuild, " +
+			"the sync asks whether to push the local files again or delete them, and fails when there's nobody to ask, " +
+			"unless --allow-empty-remote is given.",
+		Example: `coder sync ~/projects/api my-workspace:/home/coder/api --exclude node_modules --exclude "*.log"
+
+# propagate changes both ways, keeping the local copy of conflicting files
+coder sync ~/projects/api my-workspace:/home/coder/api --watch --conflict prefer-local
+
+# start the sync sessions of the repository
+coder sync`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return nil
+			}
+			return xcobra.ExactArgs(2)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if lockFile != "" {
+				lock, err := lockAgent(lockFile)
+				if xerrors.Is(err, errAgentLocked) {
+					return xerrors.Errorf("another sync holds the lock %s", lockFile)
+				}
+				if err != nil {
+					return err
+				}
+				defer lock.Close()
+			}
+			if len(args) == 0 {
+				return startConfiguredSync(cmd, "", init, verify)
+			}
+			s, err := newSync(cmd, args[0], args[1])
+			if err != nil {
+				return err
+			}
+			s.Excludes = excludes
+			if watch {
+				s.Conflicts = sync.ConflictPolicy(conflicts)
+				s.PollInterval = pollInterval
+				s.AllowEmptyRemote = allowEmpty
+				return runBidirectionalSync(cmd, s, init)
+			}
+			return runSync(cmd, s, init, verify)
+		},
 	}
 	cmd.Flags().BoolVar(&init, "init", false, "do initial transfer and exit")
+	cmd.Flags().BoolVar(&watch, "watch", false, "propagate changes both ways, honoring .gitignore and .coderignore")
+	cmd.Flags().StringVar(&conflicts, "conflict", string(sync.Prompt), "with --watch, how to settle files changed on both ends: prefer-local, prefer-remote or prompt")
+	cmd.Flags().DurationVar(&pollInterval, "poll-interval", sync.DefaultPollInterval, "with --watch, how often the workspace is checked for changes")
+	cmd.Flags().BoolVar(&allowEmpty, "allow-empty-remote", false, "with --watch, delete the local files synced before if the remote directory turns out empty, instead of asking")
+	completeFlagChoices(cmd, "conflict", string(sync.PreferLocal), string(sync.PreferRemote), string(sync.Prompt))
+	cmd.Flags().BoolVar(&verify, "verify", true, "verify the content of transferred files on both ends")
+	cmd.Flags().StringArrayVar(&excludes, "exclude", nil, "rsync pattern of the paths to leave out of the sync, such as node_modules; repeatable")
+	// The lock tells "coder down" the sync "coder up" started is still the
+	// process it recorded.
+	cmd.Flags().StringVar(&lockFile, "lock-file", "", "file to lock, with the pid of the sync, while it runs")
+	_ = cmd.Flags().MarkHidden("lock-file")
+	cmd.AddCommand(syncStartCmd())
+	cmd.AddCommand(syncVerifyCmd())
 	return cmd
 }
 
-// rsyncVersion returns local rsync protocol version as a string.
-func rsyncVersion() string {
-	cmd := exec.Command("rsync", "--version")
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Fatal(err)
-	}
+func syncStartCmd() *cobra.Command {
+	var (
+		workspace string
+		init      bool
+		verify    bool
+	)
+	cmd := &cobra.Command{
+		Use:   "start",
+		Short: "Start the sync sessions of the repository",
+		Long: "Start the syncs listed in the " + syncConfigPath + " or, without one, the " + workflowPath + " of the repository " +
+			"of the current directory, searching its parents, so that everyone working on the repository syncs the same directories. " +
+			"The mappings, excludes, mode and verify of " + syncConfigPath + " take precedence over the syncs of the workflow " +
+			"\"coder up\" reads, which \"coder up --help\" describes; the syncs run in the foreground " +
+			"and the output of each is prefixed with its local directory.",
+		Example: `coder sync start
 
-	firstLine, err := bytes.NewBuffer(out).ReadString('\n')
-	if err != nil {
-		log.Fatal(err)
+# sync to another workspace than the one of the config
+coder sync start --workspace my-other-workspace`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return startConfiguredSync(cmd, workspace, init, verify)
+		},
 	}
-	versionString := strings.Split(firstLine, "protocol version ")
-
-	return versionString[1]
+	cmd.Flags().StringVar(&workspace, "workspace", "", "workspace to sync to, instead of the one of the config")
+	cmd.Flags().BoolVar(&init, "init", false, "do initial transfer and exit, whatever the mode of the config")
+	cmd.Flags().BoolVar(&verify, "verify", true, "verify the content of transferred files on both ends, overriding the config")
+	return cmd
 }
 
-func makeRunSync(init *bool) func(cmd *cobra.Command, args []string) error {
-	return func(cmd *cobra.Command, args []string) error {
-		var (
-			ctx    = cmd.Context()
-			local  = args[0]
-			remote = args[1]
+// startConfiguredSync runs the syncs of the sync config or workflow of the
+// repository of the current directory, until one fails. The flags of the
+// command override them when set.
+func startConfiguredSync(cmd *cobra.Command, workspace string, init, verify bool) error {
+	wf, err := findSyncWorkflow(".")
+	if err != nil {
+		return err
+	}
+	if len(wf.Sync) == 0 {
+		return clog.Error("the workflow lists no directories to sync",
+			clog.BlankLine,
+			clog.Tipf("add them to the sync list of %s, or to the mappings of a %s", wf.syncPath, syncConfigPath),
 		)
-
-		client, err := newClient(ctx, true)
-		if err != nil {
+	}
+	if workspace == "" {
+		if workspace, err = wf.workspaceName(); err != nil {
 			return err
 		}
+	}
+	if !cmd.Flags().Changed("init") {
+		init = wf.Mode == syncModeOnce
+	}
+	if !cmd.Flags().Changed("verify") {
+		verify = wf.verify()
+	}
 
-		remoteTokens := strings.SplitN(remote, ":", 2)
-		if len(remoteTokens) != 2 {
-			return xerrors.New("remote malformatted")
-		}
-		var (
-			workspaceName = remoteTokens[0]
-			remoteDir     = remoteTokens[1]
-		)
-
-		workspace, err := findWorkspace(ctx, client, workspaceName, coder.Me)
+	// Syncs running side by side share the terminal, so each line of their
+	// output says which one it comes from.
+	var outMu stdsync.Mutex
+	syncs := make([]*sync.Sync, 0, len(wf.Sync))
+	for _, ws := range wf.Sync {
+		s, err := newSync(cmd, wf.localDir(ws), workspace+":"+ws.Remote)
 		if err != nil {
 			return err
 		}
-
-		info, err := os.Stat(local)
-		if err != nil {
-			return err
+		s.Excludes = wf.excludes(ws)
+		if len(wf.Sync) > 1 {
+			prefix := ws.Local + ": "
+			s.OutW = &prefixWriter{mu: &outMu, w: s.OutW, prefix: prefix}
+			s.ErrW = &prefixWriter{mu: &outMu, w: s.ErrW, prefix: prefix}
 		}
-		if info.Mode().IsRegular() {
-			return sync.SingleFile(ctx, local, remoteDir, workspace, client)
+		syncs = append(syncs, s)
+	}
+	var eg errgroup.Group
+	for _, s := range syncs {
+		s := s
+		eg.Go(func() error {
+			if err := runSync(cmd, s, init, verify); err != nil {
+				return xerrors.Errorf("sync %s: %w", s.LocalDir, err)
+			}
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
+func syncVerifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify [local directory] [<workspace name>:<remote directory>]",
+		Short: "Check that a synced directory matches its remote copy",
+		Long: "Compare the SHA-256 of every file of the local directory with its remote copy, " +
+			"and report the files that differ, are missing on the remote, or only exist on the remote.",
+		Args:    xcobra.ExactArgs(2),
+		Example: `coder sync verify ~/projects/api my-workspace:/home/coder/api`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			s, err := newSync(cmd, args[0], args[1])
+			if err != nil {
+				return err
+			}
+			info, err := os.Stat(s.LocalDir)
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return xerrors.Errorf("local path must lead to a directory")
+			}
+			journal, err := openSyncJournal(s.Workspace.Name, s.LocalDir)
+			if err != nil {
+				return err
+			}
+			defer journal.Close()
+			s.Journal = sync.NewJournal(journal)
+			s.HashCache = openSyncHashCache(s.LocalDir)
+			defer saveSyncHashCache(s.HashCache)
+
+			discrepancies, err := s.VerifyTree(ctx)
+			if err != nil {
+				return err
+			}
+			if len(discrepancies) > 0 {
+				lines := make([]string, 0, len(discrepancies)+2)
+				for _, d := range discrepancies {
+					lines = append(lines, d.String())
+				}
+				lines = append(lines, clog.BlankLine, clog.Tipf("run \"coder sync --init %s %s\" to transfer them again", args[0], args[1]))
+				return clog.Error(i18n.Sprintf("%d files differ between %s and %s", len(discrepancies), args[0], args[1]), lines...)
+			}
+			clog.LogSuccess(i18n.Sprintf("%s matches %s", args[1], args[0]))
+			return nil
+		},
+	}
+}
+
+// newSync returns a sync from the local path to the remote, in the
+// "<workspace name>:<remote directory>" format.
+func newSync(cmd *cobra.Command, local, remote string) (*sync.Sync, error) {
+	ctx := cmd.Context()
+	client, err := newClient(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteTokens := strings.SplitN(remote, ":", 2)
+	if len(remoteTokens) != 2 {
+		return nil, xerrors.New("remote malformatted")
+	}
+	var (
+		workspaceName = remoteTokens[0]
+		remoteDir     = remoteTokens[1]
+	)
+
+	workspace, err := findWorkspace(ctx, client, workspaceName, coder.Me)
+	if err != nil {
+		return nil, err
+	}
+
+	absLocal, err := filepath.Abs(local)
+	if err != nil {
+		return nil, xerrors.Errorf("make abs path out of %s, %s: %w", local, absLocal, err)
+	}
+
+	return &sync.Sync{
+		Workspace:           *workspace,
+		RemoteDir:           remoteDir,
+		LocalDir:            absLocal,
+		Client:              client,
+		OutW:                cmd.OutOrStdout(),
+		ErrW:                cmd.ErrOrStderr(),
+		InputReader:         cmd.InOrStdin(),
+		IsInteractiveOutput: showInteractiveOutput,
+		ProgressInterval:    progressEvery(),
+		Log:                 subsystemLogger("sync", verbosityTrace),
+	}, nil
+}
+
+// openSyncJournal creates the integrity journal of a new sync session of the
+// local directory with the workspace. Each directory gets its own, so syncs
+// running side by side don't write to the same one.
+func openSyncJournal(workspaceName, localDir string) (*os.File, error) {
+	dir, err := config.Dir("sync-journals")
+	if err != nil {
+		return nil, xerrors.Errorf("create journal directory: %w", err)
+	}
+	key := sha256.Sum256([]byte(localDir))
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s-%s.jsonl", workspaceName, hex.EncodeToString(key[:4]), time.Now().Format("20060102T150405")))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, xerrors.Errorf("create journal: %w", err)
+	}
+	clog.LogInfo(i18n.Sprintf("recording verified files to %s", path))
+	return f, nil
+}
+
+// prefixWriter prefixes every line written to w, holding mu while it writes
+// so lines written through writers sharing it don't interleave.
+type prefixWriter struct {
+	mu     *stdsync.Mutex
+	w      io.Writer
+	prefix string
+	// midLine is whether the last write ended in the middle of a line.
+	midLine bool
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var buf bytes.Buffer
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if len(line) == 0 {
+			continue
 		}
-		if !info.IsDir() {
-			return xerrors.Errorf("local path must lead to a regular file or directory: %w", err)
+		if !p.midLine {
+			buf.WriteString(p.prefix)
 		}
+		buf.Write(line)
+		p.midLine = line[len(line)-1] != '\n'
+	}
+	if _, err := p.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
 
-		absLocal, err := filepath.Abs(local)
-		if err != nil {
-			return xerrors.Errorf("make abs path out of %s, %s: %w", local, absLocal, err)
-		}
+// openSyncHashCache loads the cached hashes of the files of the local
+// directory. The cache only saves time, so the sync goes on without it if it
+// can't be loaded.
+func openSyncHashCache(localDir string) *sync.HashCache {
+	dir, err := config.Dir("sync-cache")
+	if err != nil {
+		clog.LogWarn("no hash cache, every file will be hashed", clog.Causef("create cache directory: %v", err))
+		return nil
+	}
+	key := sha256.Sum256([]byte(localDir))
+	cache, err := sync.OpenHashCache(filepath.Join(dir, hex.EncodeToString(key[:8])+".json"))
+	if err != nil {
+		clog.LogWarn("no hash cache, every file will be hashed", clog.Causef("%v", err))
+		return nil
+	}
+	return cache
+}
 
-		s := sync.Sync{
-			Init:                *init,
-			Workspace:           *workspace,
-			RemoteDir:           remoteDir,
-			LocalDir:            absLocal,
-			Client:              client,
-			OutW:                cmd.OutOrStdout(),
-			ErrW:                cmd.ErrOrStderr(),
-			InputReader:         cmd.InOrStdin(),
-			IsInteractiveOutput: showInteractiveOutput,
-		}
+func saveSyncHashCache(cache *sync.HashCache) {
+	if err := cache.Save(); err != nil {
+		clog.LogWarn("failed to save the hash cache", clog.Causef("%v", err))
+	}
+}
 
-		localVersion := rsyncVersion()
-		remoteVersion, rsyncErr := s.Version()
+// nativeSyncEnv set to 1 makes "coder sync" use its built-in transfer even
+// where rsync is installed on both ends, and set to 0 makes it require rsync.
+const nativeSyncEnv = "CODER_SYNC_NATIVE"
 
+// rsyncVersion returns local rsync protocol version as a string.
+func rsyncVersion() (string, error) {
+	cmd := exec.Command("rsync", "--version")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", err
+	}
+
+	firstLine, err := bytes.NewBuffer(out).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	versionString := strings.Split(firstLine, "protocol version ")
+	if len(versionString) != 2 {
+		return "", xerrors.Errorf("unexpected rsync version %q", strings.TrimSpace(firstLine))
+	}
+
+	return versionString[1], nil
+}
+
+// useNativeSync reports whether s transfers files with the built-in transfer,
+// which it does when rsync is missing on either end or their protocols don't
+// match, unless nativeSyncEnv says otherwise.
+func useNativeSync(s *sync.Sync) (bool, error) {
+	switch os.Getenv(nativeSyncEnv) {
+	case "1":
+		return true, nil
+	case "0":
+		localVersion, err := rsyncVersion()
+		if err != nil {
+			return false, clog.Error("rsync is not installed",
+				clog.Causef(err.Error()),
+				clog.BlankLine,
+				clog.Tipf("unset %s to sync with the built-in transfer", nativeSyncEnv),
+			)
+		}
+		remoteVersion, rsyncErr := s.Version()
 		if rsyncErr != nil {
 			clog.LogInfo("unable to determine remote rsync version: proceeding cautiously")
 		} else if localVersion != remoteVersion {
-			return xerrors.Errorf("rsync protocol mismatch: local = %s, remote = %s", localVersion, remoteVersion)
+			return false, xerrors.Errorf("rsync protocol mismatch: local = %s, remote = %s", localVersion, remoteVersion)
 		}
+		return false, nil
+	}
 
-		for err == nil || err == sync.ErrRestartSync {
-			err = s.Run()
+	localVersion, err := rsyncVersion()
+	if err != nil {
+		clog.LogInfo("rsync is not installed locally, syncing with the built-in transfer")
+		return true, nil
+	}
+	remoteVersion, err := s.Version()
+	if err != nil {
+		clog.LogInfo(i18n.Sprintf("rsync is not installed in %s, syncing with the built-in transfer", s.Workspace.Name))
+		return true, nil
+	}
+	if localVersion != remoteVersion {
+		clog.LogInfo(i18n.Sprintf("rsync protocol mismatch (local = %s, remote = %s), syncing with the built-in transfer",
+			strings.TrimSpace(localVersion), strings.TrimSpace(remoteVersion)))
+		return true, nil
+	}
+	return false, nil
+}
+
+// runBidirectionalSync propagates changes both ways between the local
+// directory of s and its remote copy, until it fails. With init, it returns
+// once both ends agree.
+func runBidirectionalSync(cmd *cobra.Command, s *sync.Sync, init bool) error {
+	switch s.Conflicts {
+	case sync.PreferLocal, sync.PreferRemote, sync.Prompt:
+	default:
+		return xerrors.Errorf("--conflict must be %s, %s or %s, not %q", sync.PreferLocal, sync.PreferRemote, sync.Prompt, s.Conflicts)
+	}
+	info, err := os.Stat(s.LocalDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return xerrors.New("--watch syncs directories, the local path must lead to one")
+	}
+
+	patterns, unsupported, err := sync.ReadIgnoreFiles(s.LocalDir)
+	if err != nil {
+		return err
+	}
+	if len(unsupported) > 0 {
+		clog.LogWarn("some ignore patterns aren't supported, the files they match are synced", unsupported...)
+	}
+	s.Excludes = append(s.Excludes, patterns...)
+
+	if err := recordSyncMapping(syncMapping{
+		LocalDir:  s.LocalDir,
+		Workspace: s.Workspace.Name,
+		RemoteDir: s.RemoteDir,
+		SyncedAt:  time.Now(),
+	}); err != nil {
+		clog.LogWarn("failed to record the synced directory for \"coder goto\"", clog.Causef("%v", err))
+	}
+
+	s.Init = init
+	s.HashCache = openSyncHashCache(s.LocalDir)
+	defer saveSyncHashCache(s.HashCache)
+	s.StatePath = syncStatePath(s)
+	if s.Conflicts == sync.Prompt {
+		if f, ok := s.InputReader.(*os.File); !ok || !term.IsTerminal(int(f.Fd())) {
+			clog.LogWarn("there's no terminal to ask about conflicts, files changed on both ends are left alone",
+				clog.BlankLine,
+				clog.Tipf("use --conflict prefer-local or prefer-remote to settle them"),
+			)
+			s.InputReader = nil
 		}
+	}
+	return s.RunBidirectional()
+}
+
+// syncStatePath returns where the hashes both ends of a bidirectional sync
+// agreed on are kept, or empty if there's nowhere to keep them.
+func syncStatePath(s *sync.Sync) string {
+	dir, err := config.Dir("sync-state")
+	if err != nil {
+		clog.LogWarn("files deleted while the sync isn't running won't be deleted on the other end",
+			clog.Causef("create state directory: %v", err))
+		return ""
+	}
+	key := sha256.Sum256([]byte(s.LocalDir + "\x00" + s.Workspace.ID + "\x00" + s.RemoteDir))
+	return filepath.Join(dir, hex.EncodeToString(key[:8])+".json")
+}
+
+// runSync transfers the local path of s, and keeps it in sync unless init
+// is set.
+func runSync(cmd *cobra.Command, s *sync.Sync, init, verify bool) error {
+	ctx := cmd.Context()
+	info, err := os.Stat(s.LocalDir)
+	if err != nil {
+		return err
+	}
+	if info.Mode().IsRegular() {
+		return sync.SingleFile(ctx, s.LocalDir, s.RemoteDir, &s.Workspace, s.Client)
+	}
+	if !info.IsDir() {
+		return xerrors.Errorf("local path must lead to a regular file or directory: %w", err)
+	}
+
+	if err := recordSyncMapping(syncMapping{
+		LocalDir:  s.LocalDir,
+		Workspace: s.Workspace.Name,
+		RemoteDir: s.RemoteDir,
+		SyncedAt:  time.Now(),
+	}); err != nil {
+		clog.LogWarn("failed to record the synced directory for \"coder goto\"", clog.Causef("%v", err))
+	}
+
+	s.Init = init
+	if verify {
+		journal, err := openSyncJournal(s.Workspace.Name, s.LocalDir)
 		if err != nil {
 			return err
 		}
-		return nil
+		defer journal.Close()
+		s.Verify = true
+		s.Journal = sync.NewJournal(journal)
+		s.HashCache = openSyncHashCache(s.LocalDir)
+		defer saveSyncHashCache(s.HashCache)
+	}
+
+	s.Native, err = useNativeSync(s)
+	if err != nil {
+		return err
+	}
+
+	for err == nil || err == sync.ErrRestartSync {
+		err = s.Run()
+	}
+	if err != nil {
+		return err
 	}
+	return nil
 }
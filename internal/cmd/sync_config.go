@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// syncConfigPath is where "coder sync start" and "coder up" find the sync
+// sessions of a repository, relative to its root. Its settings take
+// precedence over the syncs of the workflow.
+const syncConfigPath = ".coder/sync.yaml"
+
+// syncConfig is the sync sessions of a repository, shared by everyone
+// working on it.
+type syncConfig struct {
+	// Workspace is the name of the workspace, used when the workflow names
+	// none.
+	Workspace string `yaml:"workspace"`
+	// Mode is syncModeWatch or syncModeOnce, the mode of the workflow if
+	// empty.
+	Mode string `yaml:"mode"`
+	// Verify is whether to verify the transferred files, as the workflow
+	// says if unset.
+	Verify *bool `yaml:"verify"`
+	// Exclude lists the rsync patterns excluded from every mapping.
+	Exclude []string `yaml:"exclude"`
+	// Mappings lists the directories synced to the workspace.
+	Mappings []workflowSync `yaml:"mappings"`
+}
+
+func parseSyncConfig(raw []byte) (*syncConfig, error) {
+	var cfg syncConfig
+	if err := yaml.UnmarshalStrict(raw, &cfg); err != nil {
+		return nil, xerrors.Errorf("parse: %w", err)
+	}
+	switch cfg.Mode {
+	case "", syncModeWatch, syncModeOnce:
+	default:
+		return nil, xerrors.Errorf("mode must be %q or %q, not %q", syncModeWatch, syncModeOnce, cfg.Mode)
+	}
+	if len(cfg.Mappings) == 0 {
+		return nil, xerrors.New("mappings must list at least one directory")
+	}
+	if err := checkWorkflowSyncs(cfg.Mappings, "mapping"); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// applySyncConfig reads the sync config of the repository dir is in, if
+// any, and replaces the syncs of the workflow with its mappings. Its mode,
+// verify and workspace replace those of the workflow only when it sets
+// them, and the workspace only when the workflow names none.
+func (wf *workflow) applySyncConfig(dir string) (found bool, _ error) {
+	root, raw, err := findRepoFile(dir, syncConfigPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, xerrors.Errorf("read sync config: %w", err)
+	}
+	cfgPath := filepath.Join(root, syncConfigPath)
+	cfg, err := parseSyncConfig(raw)
+	if err != nil {
+		return false, xerrors.Errorf("%s: %w", cfgPath, err)
+	}
+
+	if wf.Workspace == "" {
+		wf.Workspace = cfg.Workspace
+	}
+	if cfg.Mode != "" {
+		wf.Mode = cfg.Mode
+	}
+	if cfg.Verify != nil {
+		wf.Verify = cfg.Verify
+	}
+	wf.Exclude = cfg.Exclude
+	wf.Sync = cfg.Mappings
+	wf.root = root
+	wf.syncPath = cfgPath
+	return true, nil
+}
+
+// findSyncWorkflow reads the syncs "coder sync start" runs: those of the
+// sync config of the repository dir is in, or else of its workflow.
+func findSyncWorkflow(dir string) (*workflow, error) {
+	wf, err := readWorkflow(dir)
+	if os.IsNotExist(err) {
+		wf, err = &workflow{Mode: syncModeWatch}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	found, err := wf.applySyncConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !found && wf.syncPath == "" {
+		return nil, clog.Error("no sync config found",
+			fmt.Sprintf("neither the current directory nor its parents have a %s or a %s", syncConfigPath, workflowPath),
+			clog.BlankLine,
+			clog.Tipf("create a %s listing the directories to sync, such as:\n\n"+
+				"  workspace: my-workspace\n  exclude: [node_modules, \"*.log\"]\n  mappings:\n    - local: .\n      remote: /home/coder/my-project", syncConfigPath),
+			clog.Tipf("or pass the directories: coder sync [local directory] [<workspace name>:<remote directory>]"),
+		)
+	}
+	return wf, nil
+}
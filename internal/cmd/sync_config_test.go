@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_findSyncWorkflow(t *testing.T) {
+	t.Parallel()
+	writeFile := func(t *testing.T, path, content string) {
+		assert.Success(t, "mkdir", os.MkdirAll(filepath.Dir(path), 0750))
+		assert.Success(t, "write "+path, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+	syncConfig := `workspace: my-workspace
+mode: once
+verify: false
+exclude: [".git", "*.log"]
+mappings:
+  - remote: /home/coder/project
+  - local: services/api
+    remote: /home/coder/api
+    exclude: [node_modules]
+`
+
+	t.Run("SyncConfig", func(t *testing.T) {
+		t.Parallel()
+		root := t.TempDir()
+		nested := filepath.Join(root, "services", "api")
+		assert.Success(t, "mkdir", os.MkdirAll(nested, 0750))
+		writeFile(t, filepath.Join(root, syncConfigPath), syncConfig)
+
+		wf, err := findSyncWorkflow(nested)
+		assert.Success(t, "found from a subdirectory", err)
+		assert.Equal(t, "root", root, wf.root)
+		assert.Equal(t, "sync path", filepath.Join(root, syncConfigPath), wf.syncPath)
+		assert.Equal(t, "workspace", "my-workspace", wf.Workspace)
+		assert.Equal(t, "mode", syncModeOnce, wf.Mode)
+		assert.False(t, "verify", wf.verify())
+		assert.Equal(t, "mappings", 2, len(wf.Sync))
+		assert.Equal(t, "local defaults to the root", root, wf.localDir(wf.Sync[0]))
+		assert.Equal(t, "local is relative to the root", nested, wf.localDir(wf.Sync[1]))
+		assert.Equal(t, "mapping excludes add to the global ones", []string{".git", "*.log", "node_modules"}, wf.excludes(wf.Sync[1]))
+	})
+
+	t.Run("OverWorkflow", func(t *testing.T) {
+		t.Parallel()
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, workflowPath), `workspace: workflow-workspace
+timeout: 15m
+exclude: [dist]
+sync:
+  - remote: /home/coder/other
+`)
+		writeFile(t, filepath.Join(root, syncConfigPath), syncConfig)
+
+		for name, find := range map[string]func(string) (*workflow, error){
+			"sync start": findSyncWorkflow,
+			"up":         findWorkflow,
+		} {
+			wf, err := find(root)
+			assert.Success(t, name, err)
+			assert.Equal(t, name+": the workspace of the workflow is kept", "workflow-workspace", wf.Workspace)
+			assert.Equal(t, name+": mode", syncModeOnce, wf.Mode)
+			assert.False(t, name+": verify", wf.verify())
+			assert.Equal(t, name+": mappings replace the syncs", "/home/coder/project", wf.Sync[0].Remote)
+			assert.Equal(t, name+": excludes replace those of the workflow", []string{".git", "*.log"}, wf.excludes(wf.Sync[0]))
+		}
+	})
+
+	t.Run("WorkflowOnly", func(t *testing.T) {
+		t.Parallel()
+		root := t.TempDir()
+		writeFile(t, filepath.Join(root, workflowPath), "sync:\n  - remote: /home/coder/project\n")
+
+		wf, err := findSyncWorkflow(root)
+		assert.Success(t, "find", err)
+		assert.Equal(t, "sync path", filepath.Join(root, workflowPath), wf.syncPath)
+		assert.Equal(t, "syncs", 1, len(wf.Sync))
+	})
+
+	t.Run("Neither", func(t *testing.T) {
+		t.Parallel()
+		_, err := findSyncWorkflow(t.TempDir())
+		assert.Error(t, "no sync config", err)
+	})
+}
+
+func Test_parseSyncConfig(t *testing.T) {
+	t.Parallel()
+	cfg, err := parseSyncConfig([]byte("mappings:\n  - remote: /home/coder/project\n"))
+	assert.Success(t, "parse", err)
+	assert.Equal(t, "mode is inherited from the workflow", "", cfg.Mode)
+	assert.Equal(t, "local defaults to the root", ".", cfg.Mappings[0].Local)
+
+	for name, raw := range map[string]string{
+		"unknown field":   "mapping:\n  - remote: /home/coder/project\n",
+		"no mappings":     "workspace: a\n",
+		"missing remote":  "mappings:\n  - local: .\n",
+		"relative remote": "mappings:\n  - remote: project\n",
+		"unknown mode":    "mode: twoway\nmappings:\n  - remote: /home/coder/project\n",
+	} {
+		_, err := parseSyncConfig([]byte(raw))
+		assert.Error(t, name, err)
+	}
+}
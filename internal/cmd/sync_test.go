@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_prefixWriter(t *testing.T) {
+	t.Parallel()
+	var (
+		mu  sync.Mutex
+		out bytes.Buffer
+		api = &prefixWriter{mu: &mu, w: &out, prefix: "api: "}
+		web = &prefixWriter{mu: &mu, w: &out, prefix: "web: "}
+	)
+	_, _ = api.Write([]byte("one\ntw"))
+	_, _ = api.Write([]byte("o\n"))
+	_, _ = web.Write([]byte("three\n"))
+	assert.Equal(t, "prefixed lines", "api: one\napi: two\nweb: three\n", out.String())
+}
@@ -1,15 +1,12 @@
 package cmd
 
 import (
-	"encoding/json"
-
 	"github.com/spf13/cobra"
 	"golang.org/x/xerrors"
 
 	"cdr.dev/coder-cli/coder-sdk"
 	"cdr.dev/coder-cli/internal/x/xcobra"
 	"cdr.dev/coder-cli/pkg/clog"
-	"cdr.dev/coder-cli/pkg/tablewriter"
 )
 
 func tagsCmd() *cobra.Command {
@@ -23,6 +20,7 @@ func tagsCmd() *cobra.Command {
 		tagsLsCmd(),
 		tagsCreateCmd(),
 		tagsRmCmd(),
+		tagsPromoteCmd(),
 	)
 	return cmd
 }
@@ -79,7 +77,6 @@ func tagsLsCmd() *cobra.Command {
 	var (
 		orgName   string
 		imageName string
-		outputFmt string
 	)
 	cmd := &cobra.Command{
 		Use:     "ls",
@@ -105,29 +102,16 @@ func tagsLsCmd() *cobra.Command {
 				return err
 			}
 
-			switch outputFmt {
-			case humanOutput:
-				err = tablewriter.WriteTable(cmd.OutOrStdout(), len(tags), func(i int) interface{} { return tags[i] })
-				if err != nil {
-					return err
-				}
-			case jsonOutput:
-				err := json.NewEncoder(cmd.OutOrStdout()).Encode(tags)
-				if err != nil {
-					return err
-				}
-			default:
-				return clog.Error("unknown --output value")
-			}
-
-			return nil
+			return writeOutput(cmd.OutOrStdout(), tags, func() error {
+				return writeTable(cmd.OutOrStdout(), len(tags), func(i int) interface{} { return tags[i] })
+			})
 		},
 	}
 	cmd.Flags().StringVar(&orgName, "org", "", "organization by name")
 	cmd.Flags().StringVarP(&imageName, "image", "i", "", "image by name")
-	cmd.Flags().StringVar(&outputFmt, "output", humanOutput, "output format (human|json)")
 	_ = cmd.MarkFlagRequired("image")
 	_ = cmd.MarkFlagRequired("org")
+	addOutputFlag(cmd)
 	return cmd
 }
 
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+func tagsPromoteCmd() *cobra.Command {
+	var (
+		orgName string
+		pattern string
+		all     bool
+		dryRun  bool
+		rebuild bool
+		force   bool
+	)
+	cmd := &cobra.Command{
+		Use:   "promote [tag]",
+		Short: "make a tag the default of matching images",
+		Long: "Make a tag the default tag of every image matching a pattern. " +
+			"Workspaces on a matching image but a different tag are listed as outdated, " +
+			"and with --rebuild they are moved to the new tag and rebuilt. Requires site admin, or organization admin.",
+		Example: `# preview promoting 2021-06 across all codercom images
+coder tags promote 2021-06 --image 'codercom/*' --org default --dry-run
+
+# promote it everywhere and rebuild the workspaces left behind
+coder tags promote 2021-06 --all --org default --rebuild`,
+		Args: xcobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if all == (pattern != "") {
+				return xerrors.New("exactly one of --image or --all must be set")
+			}
+			if all {
+				pattern = "*"
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return xerrors.Errorf("invalid --image pattern: %w", err)
+			}
+
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			plan, err := planPromotion(ctx, client, orgName, pattern, args[0])
+			if err != nil {
+				return err
+			}
+			if len(plan) == 0 {
+				clog.LogInfo(i18n.Sprintf("no images matching %q need tag %q promoted", pattern, args[0]))
+				return nil
+			}
+
+			if err := writePromotionPlan(cmd, plan); err != nil {
+				return err
+			}
+			if dryRun {
+				return nil
+			}
+
+			if !force {
+				label := fmt.Sprintf("Make %q the default tag of %d images?", args[0], len(plan))
+				if rebuild {
+					label = fmt.Sprintf("Make %q the default tag of %d images and rebuild outdated workspaces?", args[0], len(plan))
+				}
+				if _, err := (&promptui.Prompt{Label: label, IsConfirm: true}).Run(); err != nil {
+					return clog.Fatal(
+						"failed to confirm prompt", clog.BlankLine,
+						clog.Tipf(`use "--force" to promote without a confirmation prompt`),
+					)
+				}
+			}
+			return applyPromotion(ctx, client, plan, args[0], rebuild)
+		},
+	}
+	cmd.Flags().StringVarP(&orgName, "org", "o", "", "organization name")
+	cmd.Flags().StringVarP(&pattern, "image", "i", "", "image name or glob pattern, such as 'codercom/*'")
+	cmd.Flags().BoolVar(&all, "all", false, "promote the tag on every image in the organization that has it")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would change without changing anything")
+	cmd.Flags().BoolVar(&rebuild, "rebuild", false, "move outdated workspaces to the new tag and rebuild them")
+	cmd.Flags().BoolVar(&force, "force", false, "promote without showing a confirmation prompt")
+	requireRoles(cmd, coder.SiteAdmin, coder.RoleOrgAdmin)
+	return cmd
+}
+
+// tagPromotion describes the promotion of a tag on a single image.
+type tagPromotion struct {
+	image      coder.Image
+	from       string
+	outdated   []coder.Workspace
+	tagMissing bool
+}
+
+// planPromotion returns the images matching pattern whose default tag would
+// change. Images that don't have the tag are included with tagMissing set so
+// they can be reported.
+func planPromotion(ctx context.Context, client coder.Client, orgName, pattern, tag string) ([]tagPromotion, error) {
+	imgs, err := getImgs(ctx, client, getImgsConf{email: coder.Me, orgName: orgName})
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []tagPromotion
+	for _, img := range imgs {
+		if ok, _ := path.Match(pattern, img.Repository); !ok {
+			continue
+		}
+		from := ""
+		if img.DefaultTag != nil {
+			from = img.DefaultTag.Tag
+		}
+		if from == tag {
+			continue
+		}
+
+		tags, err := client.ImageTags(ctx, img.ID)
+		if err != nil {
+			return nil, xerrors.Errorf("get tags of %s: %w", img.Repository, err)
+		}
+		if !hasTag(tags, tag) {
+			plan = append(plan, tagPromotion{image: img, from: from, tagMissing: true})
+			continue
+		}
+		plan = append(plan, tagPromotion{image: img, from: from})
+	}
+	if len(plan) == 0 {
+		return nil, nil
+	}
+
+	// The workspaces listed are those the user administers, which are the
+	// ones of the organization of the images for organization admins.
+	workspaces, err := client.Workspaces(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("list workspaces: %w", err)
+	}
+	for i := range plan {
+		if plan[i].tagMissing {
+			continue
+		}
+		for _, w := range workspaces {
+			if w.ImageID == plan[i].image.ID && w.ImageTag != tag {
+				plan[i].outdated = append(plan[i].outdated, w)
+			}
+		}
+	}
+	sort.Slice(plan, func(i, j int) bool { return plan[i].image.Repository < plan[j].image.Repository })
+	return plan, nil
+}
+
+func hasTag(tags []coder.ImageTag, tag string) bool {
+	for _, t := range tags {
+		if t.Tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func writePromotionPlan(cmd *cobra.Command, plan []tagPromotion) error {
+	type promotionRow struct {
+		Image    string `table:"Image"`
+		From     string `table:"Current Default"`
+		Outdated string `table:"Outdated Workspaces"`
+	}
+	rows := make([]promotionRow, 0, len(plan))
+	for _, p := range plan {
+		outdated := fmt.Sprint(len(p.outdated))
+		if p.tagMissing {
+			outdated = "skipped, tag not found"
+		}
+		rows = append(rows, promotionRow{Image: p.image.Repository, From: p.from, Outdated: outdated})
+	}
+	err := writeTable(cmd.OutOrStdout(), len(rows), func(i int) interface{} { return rows[i] })
+	if err != nil {
+		return xerrors.Errorf("write table: %w", err)
+	}
+
+	for _, p := range plan {
+		if len(p.outdated) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(p.outdated))
+		for _, w := range p.outdated {
+			names = append(names, fmt.Sprintf("  %s (%s)", w.Name, w.ImageTag))
+		}
+		clog.LogInfo(i18n.Sprintf("outdated workspaces on %s", p.image.Repository), names...)
+	}
+	return nil
+}
+
+// applyPromotion sets the default tag of each planned image, and optionally
+// moves the outdated workspaces onto it.
+func applyPromotion(ctx context.Context, client coder.Client, plan []tagPromotion, tag string, rebuild bool) error {
+	var failed int
+	for _, p := range plan {
+		if p.tagMissing {
+			clog.LogWarn(i18n.Sprintf("skipped %s: it has no tag %q", p.image.Repository, tag))
+			continue
+		}
+		if err := client.UpdateImage(ctx, p.image.ID, coder.UpdateImageReq{DefaultTag: &tag}); err != nil {
+			failed++
+			clog.Log(clog.Error(i18n.Sprintf("failed to promote %s:%s", p.image.Repository, tag), clog.Causef(err.Error())))
+			continue
+		}
+		clog.LogSuccess(i18n.Sprintf("promoted %s:%s to default", p.image.Repository, tag))
+
+		if !rebuild {
+			continue
+		}
+		for _, w := range p.outdated {
+			err := client.EditWorkspace(ctx, w.ID, coder.UpdateWorkspaceReq{ImageTag: &tag})
+			if err != nil {
+				failed++
+				clog.Log(clog.Error(i18n.Sprintf("failed to rebuild workspace %q", w.Name), clog.Causef(err.Error())))
+				continue
+			}
+			clog.LogSuccess(i18n.Sprintf("started rebuild of workspace %q on %s", w.Name, tag))
+		}
+	}
+	if failed > 0 {
+		return xerrors.Errorf("%d operations failed", failed)
+	}
+	return nil
+}
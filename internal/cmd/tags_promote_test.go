@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_tagPromotion(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := codertest.New()
+	ubuntu := fake.AddImage(coder.Image{Repository: "codercom/ubuntu"}, "2021-05", "2021-06")
+	fake.AddImage(coder.Image{Repository: "codercom/centos"}, "2021-05")
+	fake.AddImage(coder.Image{Repository: "other/ubuntu"}, "2021-05", "2021-06")
+	stale := fake.AddWorkspace(coder.Workspace{Name: "stale", ImageID: ubuntu, ImageTag: "2021-05"})
+	fake.AddWorkspace(coder.Workspace{Name: "current", ImageID: ubuntu, ImageTag: "2021-06"})
+
+	plan, err := planPromotion(ctx, fake, "", "codercom/*", "2021-06")
+	assert.Success(t, "plan", err)
+	assert.Equal(t, "matching images", 2, len(plan))
+	assert.Equal(t, "sorted by name", "codercom/centos", plan[0].image.Repository)
+	assert.True(t, "centos lacks the tag", plan[0].tagMissing)
+	assert.Equal(t, "current default", "2021-05", plan[1].from)
+	assert.Equal(t, "one outdated workspace", 1, len(plan[1].outdated))
+	assert.Equal(t, "outdated workspace", "stale", plan[1].outdated[0].Name)
+
+	err = applyPromotion(ctx, fake, plan, "2021-06", true)
+	assert.Success(t, "apply", err)
+
+	img, err := fake.ImageByID(ctx, ubuntu)
+	assert.Success(t, "get image", err)
+	assert.Equal(t, "default promoted", "2021-06", img.DefaultTag.Tag)
+	w, _ := fake.Workspace(stale)
+	assert.Equal(t, "workspace moved to new tag", "2021-06", w.ImageTag)
+
+	plan, err = planPromotion(ctx, fake, "", "codercom/ubuntu", "2021-06")
+	assert.Success(t, "plan again", err)
+	assert.Equal(t, "nothing left to promote", 0, len(plan))
+}
@@ -1,15 +1,16 @@
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/xerrors"
 
 	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/internal/x/xcobra"
-	"cdr.dev/coder-cli/pkg/tablewriter"
+	"cdr.dev/coder-cli/pkg/clog"
 )
 
 func tokensCmd() *cobra.Command {
@@ -24,16 +25,16 @@ func tokensCmd() *cobra.Command {
 		createTokensCmd(),
 		rmTokenCmd(),
 		regenTokenCmd(),
+		revokeTokensCmd(),
 	)
 	return cmd
 }
 
 func lsTokensCmd() *cobra.Command {
-	var outputFmt string
-
 	cmd := &cobra.Command{
-		Use:   "ls",
-		Short: "show the user's active API tokens",
+		Use:     "ls",
+		Short:   "show the user's active API tokens",
+		Example: `coder tokens ls`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 			client, err := newClient(ctx, true)
@@ -46,60 +47,127 @@ func lsTokensCmd() *cobra.Command {
 				return err
 			}
 
-			switch outputFmt {
-			case humanOutput:
-				err := tablewriter.WriteTable(cmd.OutOrStdout(), len(tokens), func(i int) interface{} {
+			return writeOutput(cmd.OutOrStdout(), tokens, func() error {
+				err := writeTable(cmd.OutOrStdout(), len(tokens), func(i int) interface{} {
 					return tokens[i]
 				})
 				if err != nil {
 					return xerrors.Errorf("write table: %w", err)
 				}
-			case jsonOutput:
-				err := json.NewEncoder(cmd.OutOrStdout()).Encode(tokens)
-				if err != nil {
-					return xerrors.Errorf("write tokens as JSON: %w", err)
-				}
-			default:
-				return xerrors.Errorf("unknown --output value %q", outputFmt)
-			}
-
-			return nil
+				return nil
+			})
 		},
 	}
 
-	cmd.Flags().StringVarP(&outputFmt, "output", "o", humanOutput, "human | json")
+	addOutputShorthand(cmd)
+	docsSamples(cmd, "tokens ls")
 
 	return cmd
 }
 
 func createTokensCmd() *cobra.Command {
-	return &cobra.Command{
+	var (
+		copyToken bool
+		forAgent  string
+		user      string
+	)
+	cmd := &cobra.Command{
 		Use:   "create [token_name]",
 		Short: "create generates a new API token and prints it to stdout",
-		Args:  xcobra.ExactArgs(1),
+		Long: "Create generates a new API token and prints it to stdout.\n\n" +
+			"With --for-agent, it instead mints a new token for the agent of the given workspace, " +
+			"for running \"coder agent start\" in custom images. The workspace's previous agent token " +
+			"stops working. Only site admins and managers can mint agent tokens.",
+		Example: `coder tokens create ci
+
+# mint an agent token for a workspace owned by another user
+coder tokens create --for-agent backend --user charlie@coder.com`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if forAgent != "" {
+				return xcobra.ExactArgs(0)(cmd, args)
+			}
+			return xcobra.ExactArgs(1)(cmd, args)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 			client, err := newClient(ctx, true)
 			if err != nil {
 				return err
 			}
-			token, err := client.CreateAPIToken(ctx, coder.Me, coder.CreateAPITokenReq{
-				Name: args[0],
-			})
+
+			var token string
+			if forAgent != "" {
+				token, err = createAgentToken(ctx, client, forAgent, user)
+			} else {
+				token, err = client.CreateAPIToken(ctx, coder.Me, coder.CreateAPITokenReq{
+					Name: args[0],
+				})
+			}
 			if err != nil {
 				return err
 			}
-			fmt.Println(token)
+			if copyToken && copyToClipboard(ctx, token, "token") {
+				return nil
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), token)
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&copyToken, "copy", false, "copy the token to the clipboard instead of printing it")
+	cmd.Flags().StringVar(&forAgent, "for-agent", "", "mint a new agent token for the named workspace, replacing its current one (admin only)")
+	cmd.Flags().StringVar(&user, "user", coder.Me, "the owner of the --for-agent workspace, by email")
+	return cmd
+}
+
+// createAgentToken mints a new agent token for the user's workspace.
+func createAgentToken(ctx context.Context, client coder.Client, workspaceName, user string) (string, error) {
+	me, err := client.Me(ctx)
+	if err != nil {
+		return "", xerrors.Errorf("get current user: %w", err)
+	}
+	if !hasRole(me, coder.SiteAdmin, coder.SiteManager) {
+		return "", clog.Error("only site admins and managers can mint agent tokens",
+			clog.BlankLine,
+			clog.Tipf("ask an admin to run \"coder tokens create --for-agent %s --user %s\"", workspaceName, me.Email),
+		)
+	}
+
+	workspace, err := findWorkspace(ctx, client, workspaceName, user)
+	if err != nil {
+		return "", err
+	}
+	token, err := client.RegenerateWorkspaceAgentToken(ctx, workspace.ID)
+	if err != nil {
+		return "", xerrors.Errorf("mint agent token: %w", err)
+	}
+	clog.LogSuccess(
+		fmt.Sprintf("minted a new agent token for workspace %q", workspace.Name),
+		"the previous agent token no longer works, and this one won't be shown again",
+		clog.BlankLine,
+		clog.Tipf("start the agent with CODER_AGENT_TOKEN set to the token, or with \"coder agent start --token\""),
+	)
+	return token, nil
+}
+
+// hasRole reports whether the user has any of the roles.
+func hasRole(user *coder.User, roles ...coder.Role) bool {
+	for _, have := range user.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func rmTokenCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "rm [token_id]",
 		Short: "remove an API token by its unique ID",
-		Args:  xcobra.ExactArgs(1),
+		Example: `# find the ID of the token with "coder tokens ls"
+coder tokens rm 5f7dd1fc-a36f1b89cdb88cf0f7d0c31e`,
+		Args: xcobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 			client, err := newClient(ctx, true)
@@ -115,10 +183,15 @@ func rmTokenCmd() *cobra.Command {
 }
 
 func regenTokenCmd() *cobra.Command {
-	return &cobra.Command{
+	var copyToken bool
+	cmd := &cobra.Command{
 		Use:   "regen [token_id]",
 		Short: "regenerate an API token by its unique ID and print the new token to stdout",
-		Args:  xcobra.ExactArgs(1),
+		Example: `coder tokens regen 5f7dd1fc-a36f1b89cdb88cf0f7d0c31e
+
+# copy the new token instead of printing it
+coder tokens regen 5f7dd1fc-a36f1b89cdb88cf0f7d0c31e --copy`,
+		Args: xcobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 			client, err := newClient(ctx, true)
@@ -127,10 +200,102 @@ func regenTokenCmd() *cobra.Command {
 			}
 			token, err := client.RegenerateAPIToken(ctx, coder.Me, args[0])
 			if err != nil {
+				return err
+			}
+			if copyToken && copyToClipboard(ctx, token, "token") {
 				return nil
 			}
 			fmt.Println(token)
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&copyToken, "copy", false, "copy the token to the clipboard instead of printing it")
+	return cmd
+}
+
+func revokeTokensCmd() *cobra.Command {
+	var (
+		all   bool
+		user  string
+		force bool
+	)
+	cmd := &cobra.Command{
+		Use:   "revoke [token_id...]",
+		Short: "revoke API tokens of a user, such as all of them after a leak",
+		Long: "Revoke the API tokens with the given IDs, or all of them with --all. " +
+			"With --user, the tokens of another user are revoked, which only site admins can do.\n\n" +
+			"Each revocation is recorded with when and by whom it was done, " +
+			"and --output json prints the records for the audit trail of an incident.",
+		Example: `coder tokens revoke --all --user alice@corp.com
+
+# keep the records of the revocations for the incident report
+coder tokens revoke --all --user alice@corp.com --force --output json > revoked.json`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all && len(args) > 0 {
+				return xerrors.New("pass either token IDs or --all, not both")
+			}
+			if !all && len(args) == 0 {
+				return xerrors.New("pass the IDs of the tokens to revoke, or --all")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			actor, err := client.Me(ctx)
+			if err != nil {
+				return xerrors.Errorf("get current user: %w", err)
+			}
+			owner, err := client.UserByEmail(ctx, user)
+			if err != nil {
+				return xerrors.Errorf("get user: %w", err)
+			}
+
+			ids := args
+			if all {
+				tokens, err := client.APITokens(ctx, owner.ID)
+				if err != nil {
+					return xerrors.Errorf("get tokens of %s: %w", owner.Email, err)
+				}
+				ids = make([]string, 0, len(tokens))
+				for _, t := range tokens {
+					ids = append(ids, t.ID)
+				}
+			}
+			if len(ids) == 0 {
+				clog.LogInfo(i18n.Sprintf("%s has no API tokens", owner.Email))
+				return writeIncidentRecords(cmd.OutOrStdout(), []incidentRecord{})
+			}
+			if !force {
+				if err := confirmIncidentAction(fmt.Sprintf("Revoke %d API tokens of %s?", len(ids), owner.Email), `revoke`); err != nil {
+					return err
+				}
+			}
+
+			records := revokeAPITokens(ctx, client, actor, owner, ids)
+			if err := writeIncidentRecords(cmd.OutOrStdout(), records); err != nil {
+				return err
+			}
+			return incidentRecordsError(records)
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "revoke all API tokens of the user")
+	cmd.Flags().StringVar(&user, "user", coder.Me, "the owner of the tokens, by email (admin only for other users)")
+	cmd.Flags().BoolVar(&force, "force", false, "revoke without showing a confirmation prompt")
+	addOutputShorthand(cmd)
+	return cmd
+}
+
+// revokeAPITokens deletes the API tokens of the owner, carrying on past
+// failures, and returns a record of each revocation.
+func revokeAPITokens(ctx context.Context, client coder.Client, actor, owner *coder.User, ids []string) []incidentRecord {
+	records := make([]incidentRecord, 0, len(ids))
+	for _, id := range ids {
+		err := client.DeleteAPIToken(ctx, owner.ID, id)
+		records = append(records, newIncidentRecord(actor, owner, incidentRevokeToken, id, err))
+	}
+	return records
 }
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_createAgentToken(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := codertest.New()
+	charlie := fake.AddUser(coder.User{Email: "charlie@coder.com"}, fake.DefaultOrgID())
+	id := fake.AddWorkspace(coder.Workspace{Name: "backend", UserID: charlie})
+
+	_, err := createAgentToken(ctx, fake, "backend", "charlie@coder.com")
+	assert.Error(t, "members can't mint agent tokens", err)
+	assert.Equal(t, "no token minted", 0, len(fake.CallsTo("RegenerateWorkspaceAgentToken")))
+
+	roles := []coder.Role{coder.SiteAdmin}
+	assert.Success(t, "make admin", fake.UpdateUser(ctx, coder.Me, coder.UpdateUserReq{Roles: &roles}))
+
+	token, err := createAgentToken(ctx, fake, "backend", "charlie@coder.com")
+	assert.Success(t, "mint agent token", err)
+	assert.True(t, "token", token != "")
+	calls := fake.CallsTo("RegenerateWorkspaceAgentToken")
+	assert.Equal(t, "minted once", 1, len(calls))
+	assert.Equal(t, "for the workspace", id, calls[0].Args[0])
+
+	_, err = createAgentToken(ctx, fake, "missing", "charlie@coder.com")
+	assert.Error(t, "unknown workspace", err)
+}
+
+func Test_tokensRevoke(t *testing.T) {
+	ctx := context.Background()
+	fake := codertest.New()
+	alice := fake.AddUser(coder.User{Email: "alice@corp.com"}, fake.DefaultOrgID())
+	var ids []string
+	for _, name := range []string{"laptop", "ci", "backup"} {
+		_, err := fake.CreateAPIToken(ctx, alice, coder.CreateAPITokenReq{Name: name})
+		assert.Success(t, "create token", err)
+	}
+	tokens, err := fake.APITokens(ctx, alice)
+	assert.Success(t, "get tokens", err)
+	for _, token := range tokens {
+		ids = append(ids, token.ID)
+	}
+	useFakeClient(t, fake)
+
+	res := execute(t, nil, "tokens", "revoke", "--user", "alice@corp.com", "--all", ids[0])
+	res.error(t)
+
+	res = execute(t, nil, "tokens", "revoke", "--user", "alice@corp.com", "--force", ids[0])
+	res.success(t)
+	res.stdoutContains(t, ids[0])
+	tokens, err = fake.APITokens(ctx, alice)
+	assert.Success(t, "get tokens", err)
+	assert.Equal(t, "one revoked", 2, len(tokens))
+
+	res = execute(t, nil, "tokens", "revoke", "--user", "alice@corp.com", "--force", ids[0])
+	res.error(t)
+	res.stderrContains(t, "1 of 1 actions failed")
+
+	res = execute(t, nil, "tokens", "revoke", "--user", "alice@corp.com", "--all", "--force", "--output", "json")
+	res.success(t)
+	res.stdoutContains(t, `"target":"`+ids[2]+`"`)
+	tokens, err = fake.APITokens(ctx, alice)
+	assert.Success(t, "get tokens", err)
+	assert.Equal(t, "all revoked", 0, len(tokens))
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/pkg/clog"
+	"cdr.dev/coder-cli/wsnet"
+)
+
+// trustedIdentity is the identity an agent presented on first connect, which
+// it must present on every later connect.
+type trustedIdentity struct {
+	Deployment  string    `json:"deployment"`
+	WorkspaceID string    `json:"workspace_id"`
+	Workspace   string    `json:"workspace"`
+	Agent       string    `json:"agent,omitempty"`
+	Key         []byte    `json:"key"`
+	PinnedAt    time.Time `json:"pinned_at"`
+}
+
+// trustedIdentities guards config.TrustedIdentities, since several tunnels
+// may connect concurrently.
+var trustedIdentities sync.Mutex
+
+func readTrustedIdentities() ([]trustedIdentity, error) {
+	raw, err := config.TrustedIdentities.Read()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read trusted identities: %w", err)
+	}
+	var pins []trustedIdentity
+	if err := json.Unmarshal([]byte(raw), &pins); err != nil {
+		return nil, xerrors.Errorf("parse trusted identities: %w", err)
+	}
+	return pins, nil
+}
+
+func writeTrustedIdentities(pins []trustedIdentity) error {
+	raw, err := json.MarshalIndent(pins, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.TrustedIdentities.Write(string(raw))
+}
+
+// identityPinned reports whether an identity is pinned for the agent of the
+// workspace. Relayed connections aren't checked against it.
+func identityPinned(deployment *url.URL, workspace *coder.Workspace, agent string) (bool, error) {
+	trustedIdentities.Lock()
+	defer trustedIdentities.Unlock()
+
+	pins, err := readTrustedIdentities()
+	if err != nil {
+		return false, err
+	}
+	for _, pin := range pins {
+		if pin.Deployment == deployment.String() && pin.WorkspaceID == workspace.ID && pin.Agent == agent {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// identityVerifier returns the wsnet.DialOptions.VerifyIdentity callback for
+// the agent of the workspace. It pins the identity the agent presents on first
+// connect, and fails later connects presenting another identity, which means
+// the agent was recreated without its key, or the broker is answering in its
+// place.
+func identityVerifier(deployment *url.URL, workspace *coder.Workspace, agent string) func(ed25519.PublicKey) error {
+	return func(key ed25519.PublicKey) error {
+		trustedIdentities.Lock()
+		defer trustedIdentities.Unlock()
+
+		pins, err := readTrustedIdentities()
+		if err != nil {
+			return err
+		}
+		target := workspace.Name
+		if agent != "" {
+			target += "/" + agent
+		}
+		for _, pin := range pins {
+			if pin.Deployment != deployment.String() || pin.WorkspaceID != workspace.ID || pin.Agent != agent {
+				continue
+			}
+			if bytes.Equal(pin.Key, key) {
+				return nil
+			}
+			presented := "no identity"
+			if key != nil {
+				presented = wsnet.IdentityFingerprint(key)
+			}
+			return clog.Error(i18n.Sprintf("the identity of workspace %q changed", target),
+				fmt.Sprintf("pinned identity:    %s", wsnet.IdentityFingerprint(pin.Key)),
+				fmt.Sprintf("presented identity: %s", presented),
+				"the connection may be intercepted, or the agent lost its identity key",
+				clog.BlankLine,
+				clog.Tipf("if the agent's identity key was deliberately replaced, run \"coder trust rm %s\" to pin the new one", target),
+			)
+		}
+		if key == nil {
+			// Older agents present no identity, so there's nothing to pin.
+			return nil
+		}
+
+		pins = append(pins, trustedIdentity{
+			Deployment:  deployment.String(),
+			WorkspaceID: workspace.ID,
+			Workspace:   workspace.Name,
+			Agent:       agent,
+			Key:         key,
+			PinnedAt:    time.Now(),
+		})
+		if err := writeTrustedIdentities(pins); err != nil {
+			return xerrors.Errorf("pin identity: %w", err)
+		}
+		clog.LogInfo(i18n.Sprintf("pinned the identity of workspace %q", target), wsnet.IdentityFingerprint(key))
+		return nil
+	}
+}
+
+func trustCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trust",
+		Short: "Manage the pinned identities of workspace agents",
+		Long: "Workspace agents present a persistent identity on connect, which is pinned on first connect. " +
+			"Later connects presenting another identity fail, so a compromised broker can't intercept tunnel traffic.",
+	}
+	cmd.AddCommand(lsTrustCmd(), rmTrustCmd())
+	return cmd
+}
+
+type trustedIdentityRow struct {
+	Deployment  string `table:"Deployment"`
+	Workspace   string `table:"Workspace"`
+	Fingerprint string `table:"Fingerprint"`
+	PinnedAt    string `table:"PinnedAt"`
+}
+
+func lsTrustCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "ls",
+		Short:   "List the pinned identities of workspace agents",
+		Example: `coder trust ls`,
+		Args:    xcobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			trustedIdentities.Lock()
+			pins, err := readTrustedIdentities()
+			trustedIdentities.Unlock()
+			if err != nil {
+				return err
+			}
+			if pins == nil {
+				pins = []trustedIdentity{} // ensures that json output still marshals
+			}
+			return writeOutput(cmd.OutOrStdout(), pins, func() error {
+				return writeTrustTable(cmd.OutOrStdout(), pins)
+			})
+		},
+	}
+	addOutputFlag(cmd)
+	return cmd
+}
+
+// writeTrustTable writes the pinned identities as a table.
+func writeTrustTable(w io.Writer, pins []trustedIdentity) error {
+	if len(pins) == 0 {
+		clog.LogInfo("no identities pinned")
+		return nil
+	}
+	err := writeTable(w, len(pins), func(i int) interface{} {
+		pin := pins[i]
+		workspace := pin.Workspace
+		if pin.Agent != "" {
+			workspace += "/" + pin.Agent
+		}
+		host := pin.Deployment
+		if u, err := url.Parse(pin.Deployment); err == nil {
+			host = u.Host
+		}
+		return trustedIdentityRow{
+			Deployment:  host,
+			Workspace:   workspace,
+			Fingerprint: wsnet.IdentityFingerprint(pin.Key),
+			PinnedAt:    pin.PinnedAt.Local().Format("2006-01-02 15:04"),
+		}
+	})
+	if err != nil {
+		return xerrors.Errorf("write table: %w", err)
+	}
+	return nil
+}
+
+func rmTrustCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rm [workspace_name[/agent]]",
+		Short: "Forget the pinned identity of a workspace agent",
+		Long: "Forget the pinned identity of a workspace agent of the current deployment, " +
+			"so that the identity it presents on the next connect is pinned instead.",
+		Example: `coder trust rm my-dev
+coder trust rm my-dev/gpu`,
+		Args: xcobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			workspaceName, agent, err := splitAgentTarget(args[0])
+			if err != nil {
+				return err
+			}
+			client, err := newClient(ctx, false)
+			if err != nil {
+				return err
+			}
+			deployment := client.BaseURL()
+
+			trustedIdentities.Lock()
+			defer trustedIdentities.Unlock()
+			pins, err := readTrustedIdentities()
+			if err != nil {
+				return err
+			}
+			kept := make([]trustedIdentity, 0, len(pins))
+			for _, pin := range pins {
+				if pin.Deployment == deployment.String() && pin.Workspace == workspaceName && pin.Agent == agent {
+					continue
+				}
+				kept = append(kept, pin)
+			}
+			if len(kept) == len(pins) {
+				return xerrors.Errorf("no identity is pinned for workspace %q", args[0])
+			}
+			if err := writeTrustedIdentities(kept); err != nil {
+				return xerrors.Errorf("write trusted identities: %w", err)
+			}
+			clog.LogSuccess(i18n.Sprintf("forgot the identity of workspace %q", args[0]))
+			return nil
+		},
+	}
+	keepExamples(cmd)
+	return cmd
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/pkg/clog"
+	"cdr.dev/coder-cli/wsnet"
+)
+
+// Not parallel: the identities are pinned in the config dir.
+func Test_identityVerifier(t *testing.T) {
+	clog.SetOutput(ioutil.Discard)
+	fake := codertest.New()
+	useFakeClient(t, fake)
+	t.Cleanup(func() {
+		clog.SetOutput(os.Stderr)
+		_ = config.TrustedIdentities.Delete()
+	})
+	deployment := fake.BaseURL()
+	workspace := &coder.Workspace{ID: "workspace-1", Name: "my-dev"}
+
+	key, err := wsnet.GenerateIdentityKey()
+	assert.Success(t, "generate key", err)
+	other, err := wsnet.GenerateIdentityKey()
+	assert.Success(t, "generate key", err)
+	pub := key.Public().(ed25519.PublicKey)
+
+	verify := identityVerifier(&deployment, workspace, "")
+	assert.Success(t, "no identity before pinning", verify(nil))
+	pinned, err := identityPinned(&deployment, workspace, "")
+	assert.Success(t, "pinned", err)
+	assert.True(t, "nothing pinned", !pinned)
+	assert.Success(t, "pinned on first connect", verify(pub))
+	pinned, err = identityPinned(&deployment, workspace, "")
+	assert.Success(t, "pinned", err)
+	assert.True(t, "pinned", pinned)
+	assert.Success(t, "same identity", verify(pub))
+	assert.ErrorContains(t, "other identity", verify(other.Public().(ed25519.PublicKey)), "identity of workspace \"my-dev\" changed")
+	assert.ErrorContains(t, "downgrade", verify(nil), "identity of workspace \"my-dev\" changed")
+
+	gpu := identityVerifier(&deployment, workspace, "gpu")
+	assert.Success(t, "agents are pinned separately", gpu(other.Public().(ed25519.PublicKey)))
+
+	res := execute(t, nil, "trust", "ls")
+	res.success(t)
+	res.stdoutContains(t, wsnet.IdentityFingerprint(pub))
+	res.stdoutContains(t, "my-dev/gpu")
+
+	res = execute(t, nil, "trust", "rm", "my-dev")
+	res.success(t)
+	assert.Success(t, "new identity pinned", verify(other.Public().(ed25519.PublicKey)))
+
+	res = execute(t, nil, "trust", "rm", "backend")
+	res.error(t)
+}
+
+func Test_agentIdentityKey(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "identity.key")
+
+	key, err := agentIdentityKey(path)
+	assert.Success(t, "generated", err)
+	again, err := agentIdentityKey(path)
+	assert.Success(t, "loaded", err)
+	assert.True(t, "persisted", bytes.Equal(key, again))
+}
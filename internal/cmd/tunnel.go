@@ -7,151 +7,346 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"cdr.dev/slog"
 	"cdr.dev/slog/sloggers/sloghuman"
-	"github.com/fatih/color"
 	"github.com/pion/webrtc/v3"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/xerrors"
+	"nhooyr.io/websocket"
 
 	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/internal/x/xcobra"
 	"cdr.dev/coder-cli/pkg/clog"
 	"cdr.dev/coder-cli/wsnet"
 )
 
 func tunnelCmd() *cobra.Command {
+	var (
+		listen        string
+		relay         bool
+		udp           bool
+		reverse       bool
+		socks5        string
+		trace         wsnetTraceFlags
+		workspaceFlag string
+	)
+	// restArgs is the number of arguments after the workspace name.
+	restArgs := func() int {
+		if socks5 != "" {
+			return 0
+		}
+		if listen != "" {
+			return 1
+		}
+		return 2
+	}
 	cmd := &cobra.Command{
-		Use:   "tunnel [workspace_name] [workspace_port] [localhost_port]",
-		Args:  xcobra.ExactArgs(3),
+		Use: "tunnel [workspace_name] [workspace_port|workspace_socket] [localhost_port]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if workspaceFlag != "" {
+				return xcobra.ExactArgs(restArgs())(cmd, args)
+			}
+			// The workspace name may be left out for the default workspace.
+			return cobra.RangeArgs(restArgs(), restArgs()+1)(cmd, args)
+		},
 		Short: "proxies a port on the workspace to localhost",
-		Long:  "proxies a port on the workspace to localhost",
+		Long: "proxies a port on the workspace to localhost\n\n" +
+			"With --listen unix:///path/to.sock the local side is a Unix socket, " +
+			"readable and writable only by the current user, instead of a TCP port. " +
+			"workspace_port may also be the absolute path of a Unix socket inside the workspace, " +
+			"or container:<name> for the SSH server of another container of the workspace.\n\n" +
+			"With --udp, UDP datagrams are forwarded between the ports instead, such as for mosh. " +
+			"Each local sender gets a session of its own with the workspace port.\n\n" +
+			"With --reverse, the tunnel goes the other way: the workspace listens on workspace_port, " +
+			"which must be free, and its connections are forwarded to localhost_port on this machine, " +
+			"such as to reach a local license server or database from the workspace. " +
+			"The workspace only listens on localhost, and stops when the tunnel does.\n\n" +
+			"With --socks5 host:port, no ports are given: a SOCKS5 proxy runs on the address instead, " +
+			"connecting to any destination from the workspace, with names resolved there too, " +
+			"such as to reach internal services of the workspace's network. " +
+			"It listens on localhost unless a host is given.\n\n" +
+			"workspace_name may be workspace/agent to reach the workspace through the agent started with that --label, " +
+			"such as one running in a GPU sidecar. Without workspace_name, the workspace given with --workspace, " +
+			"or else the default workspace set with \"coder config set default-workspace\", is used.\n\n" +
+			"With a satellite set with \"coder config set satellite\", connections go through it while it's healthy, " +
+			"and through another satellite or the deployment while it isn't.\n\n" +
+			"If no peer-to-peer connection can be established, because the network blocks UDP and TURN traffic, " +
+			"traffic is relayed through the Coder deployment instead, which is much slower. " +
+			"--relay skips the peer-to-peer attempt.",
 		Example: `# run a tcp tunnel from the workspace on port 3000 to localhost:3000
 
 coder tunnel my-dev 3000 3000
+
+# expose the workspace's postgres on a local unix socket
+coder tunnel my-dev 5432 --listen unix:///tmp/db.sock
+
+# talk to the workspace's docker daemon from the local docker cli
+coder tunnel my-dev /var/run/docker.sock --listen unix:///tmp/my-dev-docker.sock
+docker -H unix:///tmp/my-dev-docker.sock ps
+
+# reach port 8888 of the gpu sidecar through its own agent
+coder tunnel my-dev/gpu 8888 8888
+
+# forward the udp port of a mosh server
+coder tunnel my-dev 60001 60001 --udp
+
+# let the workspace reach the postgres running on this machine at localhost:5432
+coder tunnel my-dev 5432 5432 --reverse
+
+# reach the services of the workspace's network through a socks5 proxy
+coder tunnel --socks5 :1080 my-dev
+curl --socks5-hostname localhost:1080 http://git.internal
 `,
 		Hidden: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
-			log := slog.Make(sloghuman.Sink(os.Stderr))
-			if os.Getenv("CODER_TUNNEL_DEBUG") != "" {
-				log = log.Leveled(slog.LevelDebug)
-				log.Info(ctx, "debug logging enabled")
-			}
+			log := tunnelLogger(ctx)
 
-			remotePort, err := strconv.ParseUint(args[1], 10, 16)
+			target, args, err := workspaceArg(workspaceFlag, args, restArgs())
 			if err != nil {
-				return xerrors.Errorf("parse remote port: %w", err)
+				return err
 			}
-
-			var localPort uint64
-			if args[2] != "stdio" {
-				localPort, err = strconv.ParseUint(args[2], 10, 16)
+			if socks5 != "" {
+				if listen != "" || udp || reverse {
+					return xerrors.New("--socks5 can't be used with --listen, --udp or --reverse")
+				}
+				listenAddr, err := parseSOCKS5Addr(socks5)
 				if err != nil {
-					return xerrors.Errorf("parse local port: %w", err)
+					return err
+				}
+				c := &tunnneler{
+					log:           log,
+					listenNetwork: "tcp",
+					listenAddr:    listenAddr,
+					relay:         relay,
+					socks5:        true,
 				}
+				return runTunnel(ctx, c, target, trace)
 			}
-
-			sdk, err := newClient(ctx, false)
+			remoteNetwork, remoteAddr, err := parseRemoteAddr(args[0])
 			if err != nil {
-				return xerrors.Errorf("getting coder client: %w", err)
+				return err
 			}
-			baseURL := sdk.BaseURL()
 
-			workspace, err := findWorkspace(ctx, sdk, args[0], coder.Me)
-			if err != nil {
-				return xerrors.Errorf("get workspaces: %w", err)
+			var (
+				stdio         bool
+				listenNetwork = "tcp"
+				listenAddr    string
+			)
+			switch {
+			case listen != "":
+				listenNetwork, listenAddr, err = parseListenAddr(listen)
+				if err != nil {
+					return err
+				}
+			case args[1] == "stdio":
+				stdio = true
+			default:
+				localPort, err := strconv.ParseUint(args[1], 10, 16)
+				if err != nil {
+					return xerrors.Errorf("parse local port: %w", err)
+				}
+				listenAddr = fmt.Sprintf("localhost:%d", localPort)
 			}
 
-			if workspace.LatestStat.ContainerStatus != coder.WorkspaceOn {
-				color.NoColor = false
-				notAvailableError := clog.Error("workspace not available",
-					fmt.Sprintf("current status: %q", workspace.LatestStat.ContainerStatus),
-					clog.BlankLine,
-					clog.Tipf("use \"coder workspaces rebuild %s\" to rebuild this workspace", workspace.Name),
-				)
-				// If we're attempting to forward our remote SSH port,
-				// we want to communicate with the OpenSSH protocol so
-				// SSH clients can properly display output to our users.
-				if remotePort == 12213 {
-					rawKey, err := sdk.SSHKey(ctx)
-					if err != nil {
-						return xerrors.Errorf("get ssh key: %w", err)
-					}
-					err = discardSSHConnection(&stdioConn{}, rawKey.PrivateKey, notAvailableError.String())
-					if err != nil {
-						return err
-					}
-					return nil
+			if udp {
+				switch {
+				case remoteNetwork != "tcp":
+					return xerrors.New("--udp forwards to a workspace port, not a socket or container")
+				case stdio:
+					return xerrors.New("--udp can't forward over stdio, which doesn't keep datagrams apart")
+				case listenNetwork != "tcp":
+					return xerrors.New("--udp can't listen on a unix socket")
 				}
-
-				return notAvailableError
+				remoteNetwork, listenNetwork = "udp", "udp"
 			}
-
-			iceServers, err := sdk.ICEServers(ctx)
-			if err != nil {
-				return xerrors.Errorf("get ICE servers: %w", err)
+			if reverse {
+				switch {
+				case udp:
+					return xerrors.New("--reverse forwards TCP connections only")
+				case remoteNetwork == wsnet.ContainerNetwork:
+					return xerrors.New("--reverse listens on a workspace port or socket, not a container")
+				case stdio:
+					return xerrors.New("--reverse forwards to a local port, not stdio")
+				case listen != "":
+					return xerrors.New("--reverse forwards to localhost_port, it doesn't listen locally")
+				}
 			}
-			log.Debug(ctx, "got ICE servers", slog.F("ice", iceServers))
 
 			c := &tunnneler{
-				log:        log,
-				brokerAddr: &baseURL,
-				token:      sdk.Token(),
-				workspace:  workspace,
-				iceServers: iceServers,
-				stdio:      args[2] == "stdio",
-				localPort:  uint16(localPort),
-				remotePort: uint16(remotePort),
+				log:           log,
+				stdio:         stdio,
+				listenNetwork: listenNetwork,
+				listenAddr:    listenAddr,
+				remoteNetwork: remoteNetwork,
+				remoteAddr:    remoteAddr,
+				relay:         relay,
+				reverse:       reverse,
+				// The mux proxies streams, which don't keep datagrams apart,
+				// and can't listen in the workspace.
+				noMux: udp || reverse,
 			}
+			return runTunnel(ctx, c, target, trace)
+		},
+	}
+	trace.register(cmd)
+	cmd.Flags().StringVar(&listen, "listen", "", "local address to listen on instead of localhost_port, such as unix:///tmp/db.sock")
+	cmd.Flags().BoolVar(&relay, "relay", false, "relay traffic through the Coder deployment without trying a peer-to-peer connection")
+	cmd.Flags().BoolVar(&udp, "udp", false, "forward UDP datagrams instead of TCP connections")
+	cmd.Flags().StringVar(&socks5, "socks5", "", "run a SOCKS5 proxy to the workspace's network on this address, such as :1080, instead of forwarding a port")
+	cmd.Flags().BoolVar(&reverse, "reverse", false, "listen on workspace_port in the workspace and forward its connections to localhost_port")
+	cmd.Flags().StringVar(&workspaceFlag, "workspace", "", "workspace to tunnel to, instead of workspace_name")
+	cmd.AddCommand(tunnelShareCmd(), tunnelSharesCmd(), tunnelMuxCmd())
+
+	return cmd
+}
 
-			err = c.start(ctx)
+// tunnelLogger logs to stderr, at the debug level with CODER_TUNNEL_DEBUG set
+// or -vv.
+func tunnelLogger(ctx context.Context) slog.Logger {
+	log := slog.Make(sloghuman.Sink(os.Stderr))
+	if os.Getenv("CODER_TUNNEL_DEBUG") != "" || verboseAt(verbosityDebug) {
+		log = log.Leveled(slog.LevelDebug)
+		log.Info(ctx, "debug logging enabled")
+	}
+	return log
+}
+
+// runTunnel connects the tunnel to the workspace or workspace/agent target.
+// The workspace side of the tunnel and how it's served locally must already
+// be set on c.
+func runTunnel(ctx context.Context, c *tunnneler, target string, trace wsnetTraceFlags) error {
+	sdk, err := newClient(ctx, false)
+	if err != nil {
+		return xerrors.Errorf("getting coder client: %w", err)
+	}
+	baseURL := sdk.BaseURL()
+
+	workspaceName, agent, err := splitAgentTarget(target)
+	if err != nil {
+		return err
+	}
+	workspace, err := findWorkspace(ctx, sdk, workspaceName, coder.Me)
+	if err != nil {
+		return xerrors.Errorf("get workspaces: %w", err)
+	}
+
+	if workspace.LatestStat.ContainerStatus != coder.WorkspaceOn {
+		// The error may be shown by an SSH client on the user's
+		// terminal rather than written to our piped stdout, so color
+		// it unless color was turned off.
+		if colorFlag != string(clog.ColorNever) && os.Getenv("NO_COLOR") == "" {
+			clog.SetColorMode(clog.ColorAlways)
+		}
+		notAvailableError := clog.Error("workspace not available",
+			fmt.Sprintf("current status: %q", workspace.LatestStat.ContainerStatus),
+			clog.BlankLine,
+			clog.Tipf("use \"coder workspaces rebuild %s\" to rebuild this workspace", workspace.Name),
+		)
+		// If we're attempting to forward our remote SSH port, or the
+		// SSH server of a container, we want to communicate with the
+		// OpenSSH protocol so SSH clients can properly display output
+		// to our users.
+		if c.remoteAddr == "localhost:12213" || c.remoteNetwork == wsnet.ContainerNetwork {
+			rawKey, err := sdk.SSHKey(ctx)
 			if err != nil {
-				return xerrors.Errorf("running tunnel: %w", err)
+				return xerrors.Errorf("get ssh key: %w", err)
+			}
+			err = discardSSHConnection(&stdioConn{}, rawKey.PrivateKey, notAvailableError.String())
+			if err != nil {
+				return err
 			}
-
 			return nil
-		},
+		}
+
+		return notAvailableError
 	}
 
-	return cmd
+	if err := findAgent(ctx, sdk, workspace, agent); err != nil {
+		return err
+	}
+
+	iceServers, err := sdk.ICEServers(ctx)
+	if err != nil {
+		return xerrors.Errorf("get ICE servers: %w", err)
+	}
+	c.log.Debug(ctx, "got ICE servers", slog.F("ice", iceServers))
+
+	tracer, closeTrace, err := trace.open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = closeTrace() }()
+
+	c.brokerAddr = &baseURL
+	c.token = sdk.Token()
+	c.workspace = workspace
+	c.agent = agent
+	c.iceServers = iceServers
+	c.trace = tracer
+	c.router, err = newSatelliteRouter(ctx, sdk)
+	if err != nil {
+		return err
+	}
+
+	err = c.start(ctx)
+	if err != nil {
+		return xerrors.Errorf("running tunnel: %w", err)
+	}
+
+	return nil
 }
 
 type tunnneler struct {
-	log        slog.Logger
-	brokerAddr *url.URL
-	token      string
-	workspace  *coder.Workspace
-	iceServers []webrtc.ICEServer
-	remotePort uint16
-	localPort  uint16
-	stdio      bool
+	log           slog.Logger
+	brokerAddr    *url.URL
+	token         string
+	workspace     *coder.Workspace
+	agent         string
+	iceServers    []webrtc.ICEServer
+	trace         *wsnet.Tracer
+	remoteNetwork string
+	remoteAddr    string
+	listenNetwork string
+	listenAddr    string
+	stdio         bool
+	relay         bool
+	// reverse listens on the remote address and forwards to the listen
+	// address instead.
+	reverse bool
+	// socks5 serves a SOCKS5 proxy on the listen address instead of
+	// forwarding to the remote address.
+	socks5 bool
+	// noMux connects without sharing the connection of the mux.
+	noMux bool
+	// keepAlive is how often dialed connections are pinged, if ever.
+	keepAlive time.Duration
+	// router routes each dial through a satellite, if one is set. The
+	// identity of the workspace stays pinned to brokerAddr.
+	router *satelliteRouter
 }
 
 func (c *tunnneler) start(ctx context.Context) error {
-	c.log.Debug(ctx, "Connecting to workspace...")
-
-	dialLog := c.log.Named("wsnet")
-	wd, err := wsnet.DialWebsocket(
-		ctx,
-		wsnet.ConnectEndpoint(c.brokerAddr, c.workspace.ID, c.token),
-		&wsnet.DialOptions{
-			Log:                &dialLog,
-			TURNProxyAuthToken: c.token,
-			TURNRemoteProxyURL: c.brokerAddr,
-			TURNLocalProxyURL:  c.brokerAddr,
-			ICEServers:         c.iceServers,
-		},
-		nil,
-	)
+	if c.reverse {
+		return c.startReverse(ctx)
+	}
+	wd, err := c.connect(ctx)
 	if err != nil {
-		return xerrors.Errorf("creating workspace dialer: %w", err)
+		return err
+	}
+	if c.socks5 {
+		return c.startSOCKS5(ctx, wd)
 	}
-	nc, err := wd.DialContext(ctx, "tcp", fmt.Sprintf("localhost:%d", c.remotePort))
+	nc, err := wd.DialContext(ctx, c.remoteNetwork, c.remoteAddr)
 	if err != nil {
 		return err
 	}
@@ -161,22 +356,7 @@ func (c *tunnneler) start(ctx context.Context) error {
 	if err != nil {
 		return xerrors.Errorf("getting coder client: %w", err)
 	}
-
-	// regularly update the last connection at
-	go func() {
-		ticker := time.NewTicker(time.Minute)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				// silently ignore failures so we don't spam the console
-				_ = sdk.UpdateLastConnectionAt(ctx, c.workspace.ID)
-			}
-		}
-	}()
+	go updateLastConnection(ctx, sdk, c.workspace.ID)
 
 	// proxy via stdio
 	if c.stdio {
@@ -193,18 +373,49 @@ func (c *tunnneler) start(ctx context.Context) error {
 	// if the user specified that.
 	_ = nc.Close()
 
-	// proxy via tcp listener
-	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", c.localPort))
+	if c.listenNetwork == "udp" {
+		pc, err := net.ListenPacket(c.listenNetwork, c.listenAddr)
+		if err != nil {
+			return xerrors.Errorf("listen: %w", err)
+		}
+		defer pc.Close()
+		c.log.Debug(ctx, "Listening", slog.F("network", c.listenNetwork), slog.F("addr", c.listenAddr))
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stop := closeOnInterrupt(closerFunc(func() error {
+			cancel()
+			return pc.Close()
+		}))
+		defer stop()
+		return forwardPackets(ctx, c.log, pc, wd, portForward{remoteNetwork: c.remoteNetwork, remoteAddr: c.remoteAddr}, udpSessionIdleTimeout)
+	}
+
+	// proxy via local listener
+	listener, err := listenLocal(c.listenNetwork, c.listenAddr)
 	if err != nil {
-		return xerrors.Errorf("listen: %w", err)
+		return err
 	}
+	defer listener.Close()
+	c.log.Debug(ctx, "Listening", slog.F("network", c.listenNetwork), slog.F("addr", c.listenAddr))
+
+	// Close the listener on interrupt so a unix socket is removed.
+	var closing int32
+	stop := closeOnInterrupt(closerFunc(func() error {
+		atomic.StoreInt32(&closing, 1)
+		return listener.Close()
+	}))
+	defer stop()
 
 	for {
 		lc, err := listener.Accept()
 		if err != nil {
+			if atomic.LoadInt32(&closing) == 1 {
+				return nil
+			}
 			return xerrors.Errorf("accept: %w", err)
 		}
-		nc, err := wd.DialContext(ctx, "tcp", fmt.Sprintf("localhost:%d", c.remotePort))
+		nc, err := wd.DialContext(ctx, c.remoteNetwork, c.remoteAddr)
 		if err != nil {
 			return err
 		}
@@ -221,6 +432,280 @@ func (c *tunnneler) start(ctx context.Context) error {
 	}
 }
 
+// startSOCKS5 serves a SOCKS5 proxy connecting to destinations through wd.
+func (c *tunnneler) startSOCKS5(ctx context.Context, wd connDialer) error {
+	listener, err := listenLocal(c.listenNetwork, c.listenAddr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	c.log.Debug(ctx, "SOCKS5 proxy listening", slog.F("addr", c.listenAddr))
+
+	sdk, err := newClient(ctx, false)
+	if err != nil {
+		return xerrors.Errorf("getting coder client: %w", err)
+	}
+	go updateLastConnection(ctx, sdk, c.workspace.ID)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := closeOnInterrupt(closerFunc(func() error {
+		cancel()
+		return listener.Close()
+	}))
+	defer stop()
+	return serveSOCKS5(ctx, c.log, listener, wd)
+}
+
+// startReverse listens on the remote address in the workspace, and forwards
+// the connections made to it to the listen address on this machine.
+func (c *tunnneler) startReverse(ctx context.Context) error {
+	wd, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer wd.Close()
+	listener, err := wd.Listen(ctx, c.remoteNetwork, c.remoteAddr)
+	if err != nil {
+		return xerrors.Errorf("listen in the workspace: %w", err)
+	}
+	defer listener.Close()
+	c.log.Debug(ctx, "Listening in the workspace", slog.F("network", c.remoteNetwork), slog.F("addr", c.remoteAddr))
+
+	sdk, err := newClient(ctx, false)
+	if err != nil {
+		return xerrors.Errorf("getting coder client: %w", err)
+	}
+	go updateLastConnection(ctx, sdk, c.workspace.ID)
+
+	var closing int32
+	stop := closeOnInterrupt(closerFunc(func() error {
+		atomic.StoreInt32(&closing, 1)
+		return listener.Close()
+	}))
+	defer stop()
+
+	for {
+		rc, err := listener.Accept()
+		if err != nil {
+			if atomic.LoadInt32(&closing) == 1 {
+				return nil
+			}
+			return xerrors.Errorf("accept: %w", err)
+		}
+		go func() {
+			defer func() {
+				_ = rc.Close()
+			}()
+			lc, err := net.Dial(c.listenNetwork, c.listenAddr)
+			if err != nil {
+				clog.LogWarn(i18n.Sprintf("failed to forward a connection from the workspace to %s", c.listenAddr), err.Error())
+				return
+			}
+			defer func() {
+				_ = lc.Close()
+			}()
+
+			go func() {
+				_, _ = io.Copy(lc, rc)
+			}()
+			_, _ = io.Copy(rc, lc)
+		}()
+	}
+}
+
+// closerFunc is a function that's an io.Closer.
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// closeOnInterrupt closes c on SIGINT or SIGTERM, until stop is called.
+func closeOnInterrupt(c io.Closer) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		if _, ok := <-sigs; ok {
+			_ = c.Close()
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}
+}
+
+// dial connects to the agent of the workspace, peer-to-peer if possible.
+func (c *tunnneler) dial(ctx context.Context) (*wsnet.Dialer, error) {
+	c.log.Debug(ctx, "Connecting to workspace...")
+
+	hc, err := newHTTPClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dialLog := c.log.Named("wsnet")
+	if level, ok := subsystemLevels["wsnet"]; ok {
+		dialLog = dialLog.Leveled(level)
+	}
+	iceLog := subsystemLogger("ice", verbosityTrace)
+	broker := c.brokerAddr
+	if c.router != nil {
+		broker = c.router.route(ctx)
+	}
+	var (
+		endpoint = wsnet.AgentConnectEndpoint(broker, c.workspace.ID, c.agent, c.token)
+		dialOpts = &wsnet.DialOptions{
+			Log:                &dialLog,
+			ICELog:             &iceLog,
+			Trace:              c.trace,
+			TURNProxyAuthToken: c.token,
+			TURNRemoteProxyURL: broker,
+			TURNLocalProxyURL:  broker,
+			ICEServers:         c.iceServers,
+			HTTPClient:         hc,
+			Relay:              c.relay,
+			VerifyIdentity:     identityVerifier(c.brokerAddr, c.workspace, c.agent),
+			KeepAlive:          c.keepAlive,
+		}
+		wsOpts = &websocket.DialOptions{HTTPClient: hc}
+	)
+	pinned, err := identityPinned(c.brokerAddr, c.workspace, c.agent)
+	if err != nil {
+		return nil, err
+	}
+	if c.relay {
+		lines := []string{"this is much slower than a peer-to-peer connection"}
+		if pinned {
+			lines = append(lines, "the identity pinned for the workspace isn't checked on relayed connections")
+		}
+		clog.LogWarn("relaying traffic through the Coder deployment", lines...)
+	}
+	wd, err := wsnet.DialWebsocket(ctx, endpoint, dialOpts, wsOpts)
+	if err != nil && !c.relay && xerrors.Is(err, context.DeadlineExceeded) {
+		// Timing out means no ICE candidate pair worked, which is what
+		// happens when all UDP and TURN traffic is dropped. It's also what
+		// a broker stalling ICE looks like, so connections to pinned
+		// identities aren't downgraded to unauthenticated relaying.
+		if pinned {
+			return nil, clog.Error("could not establish a peer-to-peer connection",
+				"the network may block UDP and TURN traffic",
+				"relayed connections aren't checked against the identity pinned for the workspace, so they aren't fallen back to",
+				clog.BlankLine,
+				clog.Tipf("pass --relay to relay traffic through the Coder deployment anyway"),
+			)
+		}
+		clog.LogWarn("could not establish a peer-to-peer connection, relaying traffic through the Coder deployment",
+			"this is much slower, and usually means the network blocks UDP and TURN traffic",
+			clog.BlankLine,
+			clog.Tipf("pass --relay to skip the peer-to-peer attempt"),
+		)
+		dialOpts.Relay = true
+		wd, err = wsnet.DialWebsocket(ctx, endpoint, dialOpts, wsOpts)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("creating workspace dialer: %w", err)
+	}
+	return wd, nil
+}
+
+// updateLastConnection regularly updates the last connection time of the
+// workspace until ctx is done, so that it isn't stopped while tunneled to.
+func updateLastConnection(ctx context.Context, client coder.Client, workspaceID string) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// silently ignore failures so we don't spam the console
+			_ = client.UpdateLastConnectionAt(ctx, workspaceID)
+		}
+	}
+}
+
+// parseRemoteAddr parses the workspace_port argument, which is either a port
+// on the workspace's localhost, the absolute path of a unix socket, or the
+// name of another container of the workspace.
+func parseRemoteAddr(arg string) (network, address string, err error) {
+	if name := strings.TrimPrefix(arg, wsnet.ContainerNetwork+":"); name != arg {
+		if name == "" {
+			return "", "", xerrors.New("missing container name")
+		}
+		return wsnet.ContainerNetwork, name, nil
+	}
+	if path := strings.TrimPrefix(arg, "unix://"); strings.HasPrefix(path, "/") {
+		return "unix", path, nil
+	}
+	port, err := strconv.ParseUint(arg, 10, 16)
+	if err != nil {
+		return "", "", xerrors.Errorf("parse remote port: %w", err)
+	}
+	return "tcp", fmt.Sprintf("localhost:%d", port), nil
+}
+
+// parseListenAddr parses the value of --listen into a network and address
+// for net.Listen.
+func parseListenAddr(listen string) (network, address string, err error) {
+	u, err := url.Parse(listen)
+	if err != nil {
+		return "", "", xerrors.Errorf("parse listen address: %w", err)
+	}
+	switch u.Scheme {
+	case "unix":
+		// Accept both unix:///abs/path and unix://relative/path.
+		path := u.Host + u.Path
+		if path == "" {
+			return "", "", xerrors.Errorf("listen address %q has no socket path", listen)
+		}
+		return "unix", path, nil
+	case "tcp":
+		if u.Host == "" {
+			return "", "", xerrors.Errorf("listen address %q has no host", listen)
+		}
+		return "tcp", u.Host, nil
+	default:
+		return "", "", xerrors.Errorf("listen address %q must start with unix:// or tcp://", listen)
+	}
+}
+
+// listenLocal listens on the local side of a tunnel. Unix sockets are only
+// accessible by the current user, and a stale socket left behind by a
+// previous tunnel is replaced.
+func listenLocal(network, address string) (net.Listener, error) {
+	if network != "unix" {
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			return nil, xerrors.Errorf("listen: %w", err)
+		}
+		return listener, nil
+	}
+
+	if info, err := os.Lstat(address); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, xerrors.Errorf("%s exists and is not a socket", address)
+		}
+		if conn, err := net.Dial("unix", address); err == nil {
+			_ = conn.Close()
+			return nil, xerrors.Errorf("%s is already in use", address)
+		}
+		if err := os.Remove(address); err != nil {
+			return nil, xerrors.Errorf("remove stale socket: %w", err)
+		}
+	}
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, xerrors.Errorf("listen: %w", err)
+	}
+	if err := os.Chmod(address, 0600); err != nil {
+		_ = listener.Close()
+		return nil, xerrors.Errorf("restrict socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
 // Used to treat stdio like a connection for proxying SSH.
 type stdioConn struct{}
 
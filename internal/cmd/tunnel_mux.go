@@ -0,0 +1,478 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"cdr.dev/slog"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/config"
+)
+
+// Sessions to the same workspace share one connection through a mux: a
+// "coder tunnel mux" process started in the background by the first session.
+// It keeps the connection alive, negotiates a new one when the network path
+// changes, and exits once no session used it for a while.
+//
+// Sessions talk to the mux over a unix socket in the config directory. Each
+// connection starts with a muxRequest as JSON, which the mux answers with a
+// muxResponse before proxying the dialed connection. Both are written without
+// the trailing newline of json.Encoder, which would otherwise be proxied as
+// data.
+
+const (
+	// wsnetMuxEnv turns the mux off when set to 0, so that every session
+	// negotiates a connection of its own.
+	wsnetMuxEnv = "CODER_WSNET_MUX"
+	// wsnetKeepAliveEnv sets how often the mux pings the workspace, like
+	// its --keepalive flag.
+	wsnetKeepAliveEnv = "CODER_WSNET_KEEPALIVE"
+
+	defaultMuxKeepAlive   = 15 * time.Second
+	defaultMuxIdleTimeout = 5 * time.Minute
+)
+
+var (
+	// muxStartTimeout is how long a session waits for the mux it started to
+	// connect to the workspace, before connecting on its own.
+	muxStartTimeout = 30 * time.Second
+	// muxPingTimeout is how long a running mux has to answer a session.
+	muxPingTimeout = 5 * time.Second
+)
+
+type muxRequest struct {
+	Network string `json:"network,omitempty"`
+	Address string `json:"address,omitempty"`
+	// Ping asks the mux to ping the workspace instead of dialing.
+	Ping bool `json:"ping,omitempty"`
+}
+
+type muxResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+func tunnelMuxCmd() *cobra.Command {
+	var (
+		keepAlive   time.Duration
+		idleTimeout time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "mux [workspace_name[/agent]]",
+		Short: "Share one connection to a workspace between sessions",
+		Long: "Share one connection to a workspace between the coder ssh, tunnel and port-forward sessions to it, " +
+			"which start it in the background as needed. The connection is pinged every --keepalive, " +
+			"and negotiated again when it's lost, such as after the laptop slept or switched networks. " +
+			"The mux exits once no session used it for --idle-timeout, or when it couldn't reconnect for as long.\n\n" +
+			"Set " + wsnetMuxEnv + "=0 for every session to connect on its own instead.",
+		Args:   cobra.ExactArgs(1),
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			log := tunnelLogger(ctx)
+
+			if env := os.Getenv(wsnetKeepAliveEnv); env != "" && !cmd.Flags().Changed("keepalive") {
+				var err error
+				keepAlive, err = time.ParseDuration(env)
+				if err != nil {
+					return xerrors.Errorf("invalid %s %q: %w", wsnetKeepAliveEnv, env, err)
+				}
+			}
+
+			client, err := newClient(ctx, false)
+			if err != nil {
+				return err
+			}
+			baseURL := client.BaseURL()
+			workspaceName, agent, err := splitAgentTarget(args[0])
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, workspaceName, coder.Me)
+			if err != nil {
+				return err
+			}
+			if workspace.LatestStat.ContainerStatus != coder.WorkspaceOn {
+				return xerrors.Errorf("workspace %q is not available, current status: %q", workspace.Name, workspace.LatestStat.ContainerStatus)
+			}
+			if err := findAgent(ctx, client, workspace, agent); err != nil {
+				return err
+			}
+			iceServers, err := client.ICEServers(ctx)
+			if err != nil {
+				return xerrors.Errorf("get ICE servers: %w", err)
+			}
+			path, err := muxSocketPath(workspace.ID, agent)
+			if err != nil {
+				return err
+			}
+
+			t := &tunnneler{
+				log:        log,
+				brokerAddr: &baseURL,
+				token:      client.Token(),
+				workspace:  workspace,
+				agent:      agent,
+				iceServers: iceServers,
+				keepAlive:  keepAlive,
+			}
+			t.router, err = newSatelliteRouter(ctx, client)
+			if err != nil {
+				return err
+			}
+			wd, err := t.dial(ctx)
+			if err != nil {
+				return err
+			}
+			dialer := &reconnectingDialer{
+				log: log,
+				dial: func(ctx context.Context) (connDialer, error) {
+					return t.dial(ctx)
+				},
+				current: wd,
+			}
+			defer dialer.Close()
+
+			// Listening only once connected means sessions wait for a
+			// working connection rather than one being negotiated.
+			listener, err := listenLocal("unix", path)
+			if err != nil {
+				return err
+			}
+			defer listener.Close()
+			log.Info(ctx, "sharing the connection to the workspace", slog.F("workspace", workspace.Name), slog.F("socket", path))
+
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go updateLastConnection(ctx, client, workspace.ID)
+
+			// The mux outlives the terminal of the session that started
+			// it, and only exits once idle or told to.
+			signal.Ignore(syscall.SIGHUP)
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+			defer signal.Stop(sigs)
+			go func() {
+				select {
+				case <-sigs:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+
+			group, ctx := errgroup.WithContext(ctx)
+			group.Go(func() error {
+				return dialer.watch(ctx, idleTimeout)
+			})
+			group.Go(func() error {
+				defer cancel()
+				m := &muxServer{log: log, dialer: dialer, idleTimeout: idleTimeout}
+				return m.serve(ctx, listener)
+			})
+			return group.Wait()
+		},
+	}
+	cmd.Flags().DurationVar(&keepAlive, "keepalive", defaultMuxKeepAlive, "how often to ping the workspace, 0 to never (env "+wsnetKeepAliveEnv+")")
+	cmd.Flags().DurationVar(&idleTimeout, "idle-timeout", defaultMuxIdleTimeout, "exit once no session used the connection for this long")
+	return cmd
+}
+
+// muxSocketPath returns the path of the socket of the mux of the workspace
+// agent.
+func muxSocketPath(workspaceID, agent string) (string, error) {
+	dir, err := config.Dir("wsnet-mux")
+	if err != nil {
+		return "", xerrors.Errorf("create mux directory: %w", err)
+	}
+	// Hashed to stay well within the length limit of socket paths.
+	key := sha256.Sum256([]byte(workspaceID + "\x00" + agent))
+	return filepath.Join(dir, hex.EncodeToString(key[:8])+".sock"), nil
+}
+
+// muxServer serves the dials of sessions through the connection to the
+// workspace.
+type muxServer struct {
+	log         slog.Logger
+	dialer      connDialer
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	active   int
+	idle     *time.Timer
+	stopping int32
+}
+
+// serve accepts sessions until ctx is done or none was active for the idle
+// timeout.
+func (m *muxServer) serve(ctx context.Context, listener net.Listener) error {
+	stop := func() {
+		atomic.StoreInt32(&m.stopping, 1)
+		_ = listener.Close()
+	}
+	m.mu.Lock()
+	m.idle = time.AfterFunc(m.idleTimeout, func() {
+		m.log.Info(ctx, "no sessions left, exiting", slog.F("idle_timeout", m.idleTimeout))
+		stop()
+	})
+	m.mu.Unlock()
+	defer m.idle.Stop()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+		case <-done:
+		}
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if atomic.LoadInt32(&m.stopping) == 1 {
+				return nil
+			}
+			return xerrors.Errorf("accept: %w", err)
+		}
+		m.acquire()
+		go func() {
+			defer m.release()
+			m.handle(ctx, conn)
+		}()
+	}
+}
+
+func (m *muxServer) acquire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active++
+	m.idle.Stop()
+}
+
+func (m *muxServer) release() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active--
+	if m.active == 0 {
+		m.idle.Reset(m.idleTimeout)
+	}
+}
+
+// handle answers the request of a session, proxying the connection it
+// dialed.
+func (m *muxServer) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	decoder := json.NewDecoder(conn)
+	var req muxRequest
+	if err := decoder.Decode(&req); err != nil {
+		m.log.Debug(ctx, "read mux request", slog.Error(err))
+		return
+	}
+	if req.Ping {
+		_ = writeMuxResponse(conn, m.dialer.Ping(ctx))
+		return
+	}
+
+	nc, err := m.dialer.DialContext(ctx, req.Network, req.Address)
+	if werr := writeMuxResponse(conn, err); err != nil || werr != nil {
+		m.log.Debug(ctx, "dial for session", slog.F("network", req.Network), slog.F("address", req.Address), slog.Error(err))
+		return
+	}
+	defer nc.Close()
+	go func() {
+		_, _ = io.Copy(nc, io.MultiReader(decoder.Buffered(), conn))
+		_ = nc.Close()
+	}()
+	_, _ = io.Copy(conn, nc)
+}
+
+func writeMuxResponse(w io.Writer, err error) error {
+	var resp muxResponse
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	msg, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	return err
+}
+
+// muxDialer dials addresses in the workspace through its mux.
+type muxDialer struct {
+	path string
+}
+
+var _ connDialer = &muxDialer{}
+
+func (d *muxDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.request(ctx, muxRequest{Network: network, Address: address})
+}
+
+// Ping pings the workspace through the mux, which fails when there is no mux.
+func (d *muxDialer) Ping(ctx context.Context) error {
+	conn, err := d.request(ctx, muxRequest{Ping: true})
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Close does nothing, since the connection belongs to the mux.
+func (d *muxDialer) Close() error {
+	return nil
+}
+
+func (d *muxDialer) request(ctx context.Context, req muxRequest) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", d.path)
+	if err != nil {
+		return nil, xerrors.Errorf("connect to mux: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	msg, err := json.Marshal(req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, xerrors.Errorf("marshal mux request: %w", err)
+	}
+	if _, err := conn.Write(msg); err != nil {
+		_ = conn.Close()
+		return nil, xerrors.Errorf("write mux request: %w", err)
+	}
+	decoder := json.NewDecoder(conn)
+	var resp muxResponse
+	if err := decoder.Decode(&resp); err != nil {
+		_ = conn.Close()
+		return nil, xerrors.Errorf("read mux response: %w", err)
+	}
+	if resp.Error != "" {
+		_ = conn.Close()
+		return nil, xerrors.New(resp.Error)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return &muxConn{Conn: conn, r: io.MultiReader(decoder.Buffered(), conn)}, nil
+}
+
+// muxConn is a connection proxied by the mux, whose reads start with what was
+// buffered while reading the response.
+type muxConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *muxConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// useMux reports whether the tunnel shares the connection of the mux. Relayed
+// and traced connections are left out, since the mux connects its own way.
+func (c *tunnneler) useMux() bool {
+	return !c.noMux && !c.relay && c.trace == nil && os.Getenv(wsnetMuxEnv) != "0"
+}
+
+// connect returns a dialer to the workspace, which shares the connection of
+// the mux when possible, starting the mux if it isn't running.
+func (c *tunnneler) connect(ctx context.Context) (connDialer, error) {
+	if !c.useMux() {
+		return c.dial(ctx)
+	}
+	d, err := c.dialMux(ctx)
+	if err == nil {
+		return d, nil
+	}
+	c.log.Debug(ctx, "connecting without the mux", slog.Error(err))
+	return c.dial(ctx)
+}
+
+func (c *tunnneler) dialMux(ctx context.Context) (connDialer, error) {
+	path, err := muxSocketPath(c.workspace.ID, c.agent)
+	if err != nil {
+		return nil, err
+	}
+	d := &muxDialer{path: path}
+	ping := func() error {
+		ctx, cancel := context.WithTimeout(ctx, muxPingTimeout)
+		defer cancel()
+		return d.Ping(ctx)
+	}
+	if err := ping(); err == nil {
+		c.log.Debug(ctx, "sharing the connection of the mux", slog.F("socket", path))
+		return d, nil
+	}
+
+	target := c.workspace.Name
+	if c.agent != "" {
+		target += "/" + c.agent
+	}
+	if err := startTunnelMux(target, path); err != nil {
+		return nil, err
+	}
+	c.log.Debug(ctx, "started the mux", slog.F("socket", path))
+	deadline := time.NewTimer(muxStartTimeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			return nil, xerrors.Errorf("the mux didn't start within %s, see %s", muxStartTimeout, muxLogPath(path))
+		case <-ticker.C:
+		}
+		if err := ping(); err == nil {
+			return d, nil
+		}
+	}
+}
+
+func muxLogPath(socketPath string) string {
+	return strings.TrimSuffix(socketPath, ".sock") + ".log"
+}
+
+// startTunnelMux runs "coder tunnel mux" to the target in the background,
+// detached from the session starting it, logging next to its socket. If
+// another session started one meanwhile, the new one exits since the socket
+// is in use.
+func startTunnelMux(target, socketPath string) error {
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(muxLogPath(socketPath), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return xerrors.Errorf("open mux log: %w", err)
+	}
+	defer logFile.Close()
+
+	proc := exec.Command(exe, "tunnel", "mux", target)
+	proc.Stdout = logFile
+	proc.Stderr = logFile
+	detachMux(proc)
+	if err := proc.Start(); err != nil {
+		return xerrors.Errorf("start mux: %w", err)
+	}
+	// Reap the mux if it exits while this session runs, such as when
+	// another one won the socket.
+	go func() { _ = proc.Wait() }()
+	return nil
+}
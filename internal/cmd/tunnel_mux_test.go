@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+func Test_muxServer(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	remote, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Success(t, "listen", err)
+	t.Cleanup(func() { _ = remote.Close() })
+	go func() {
+		for {
+			c, err := remote.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				b := make([]byte, 5)
+				if _, err := c.Read(b); err == nil {
+					_, _ = c.Write(append([]byte("echo "), b...))
+				}
+			}()
+		}
+	}()
+
+	path := filepath.Join(t.TempDir(), "mux.sock")
+	listener, err := listenLocal("unix", path)
+	assert.Success(t, "listen mux", err)
+	fake := &fakeConnDialer{}
+	m := &muxServer{log: slogtest.Make(t, nil), dialer: fake, idleTimeout: 200 * time.Millisecond}
+	served := make(chan error, 1)
+	go func() {
+		served <- m.serve(ctx, listener)
+	}()
+
+	d := &muxDialer{path: path}
+	assert.Success(t, "ping", d.Ping(ctx))
+	for i := 0; i < 2; i++ {
+		nc, err := d.DialContext(ctx, "tcp", remote.Addr().String())
+		assert.Success(t, "dial through the mux", err)
+		_, err = nc.Write([]byte("hello"))
+		assert.Success(t, "write", err)
+		b, err := ioutil.ReadAll(nc)
+		assert.Success(t, "read", err)
+		assert.Equal(t, "proxied", "echo hello", string(b))
+		_ = nc.Close()
+	}
+
+	_, err = d.DialContext(ctx, "tcp", "127.0.0.1:1")
+	assert.Error(t, "refused port", err)
+	atomic.StoreInt32(&fake.down, 1)
+	assert.Error(t, "ping of a lost connection", d.Ping(ctx))
+
+	select {
+	case err := <-served:
+		assert.Success(t, "exit when idle", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the mux didn't exit once idle")
+	}
+	assert.Error(t, "no mux", d.Ping(ctx))
+}
+
+// closingConnDialer is a fakeConnDialer whose connection can be lost.
+type closingConnDialer struct {
+	fakeConnDialer
+	closed chan struct{}
+}
+
+func (d *closingConnDialer) Closed() <-chan struct{} {
+	return d.closed
+}
+
+func Test_reconnectingDialer_watch(t *testing.T) {
+	t.Parallel()
+	clog.SetOutput(ioutil.Discard)
+	t.Cleanup(func() { clog.SetOutput(os.Stderr) })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := &closingConnDialer{closed: make(chan struct{})}
+	redialed := make(chan struct{})
+	dialer := &reconnectingDialer{
+		log: slogtest.Make(t, nil),
+		dial: func(context.Context) (connDialer, error) {
+			close(redialed)
+			return &closingConnDialer{closed: make(chan struct{})}, nil
+		},
+		current: first,
+	}
+	watched := make(chan error, 1)
+	go func() {
+		watched <- dialer.watch(ctx, time.Minute)
+	}()
+
+	close(first.closed)
+	select {
+	case <-redialed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lost connection wasn't negotiated again")
+	}
+	assert.Equal(t, "lost dialer closed", int32(1), atomic.LoadInt32(&first.fakeConnDialer.closed))
+
+	cancel()
+	select {
+	case err := <-watched:
+		assert.Success(t, "stop watching", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch didn't return")
+	}
+}
@@ -0,0 +1,15 @@
+// +build !windows
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachMux starts the mux in a session of its own, so that the signals the
+// terminal sends to the session that started it, such as on ^C, don't reach
+// it.
+func detachMux(proc *exec.Cmd) {
+	proc.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,18 @@
+// +build windows
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// detachMux starts the mux without a console and in a process group of its
+// own, so that the ^C of the session that started it doesn't reach it.
+func detachMux(proc *exec.Cmd) {
+	proc.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: windows.CREATE_NEW_PROCESS_GROUP | windows.DETACHED_PROCESS,
+	}
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// maxShareExpiry bounds the lifetime of share links, which grant access to
+// anyone holding them. DevURLs suit longer-lived access.
+const maxShareExpiry = 24 * time.Hour
+
+func tunnelShareCmd() *cobra.Command {
+	var (
+		expires  time.Duration
+		copyLink bool
+	)
+	cmd := &cobra.Command{
+		Use:   "share [workspace_name]:[port]",
+		Short: "create a short-lived link to a port of a workspace",
+		Long: "Create a short-lived, tokenized URL through the Coder deployment to a port of a workspace, " +
+			"so that a teammate without access to the workspace can reach a dev server for a while. " +
+			"Anyone holding the link can use it until it expires or is revoked with \"coder tunnel shares revoke\".",
+		Example: `# let a teammate reach the dev server on port 3000 for the next hour
+coder tunnel share my-dev:3000 --expires 1h`,
+		Args: xcobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			i := strings.LastIndex(args[0], ":")
+			if i <= 0 {
+				return xerrors.Errorf("invalid target %q: expected workspace_name:port", args[0])
+			}
+			workspaceName := args[0][:i]
+			port, err := validatePort(args[0][i+1:])
+			if err != nil {
+				return err
+			}
+			if expires <= 0 || expires > maxShareExpiry {
+				return clog.Error(i18n.Sprintf("invalid --expires %s: share links must expire within %s", expires, maxShareExpiry),
+					clog.BlankLine,
+					clog.Tipf("use \"coder urls create\" for longer-lived access"),
+				)
+			}
+
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, workspaceName, coder.Me)
+			if err != nil {
+				return err
+			}
+			share, err := client.CreateTunnelShare(ctx, workspace.ID, coder.CreateTunnelShareReq{
+				Port:      port,
+				ExpiresIn: coder.Duration(expires),
+			})
+			if err != nil {
+				return xerrors.Errorf("create share link: %w", err)
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), share.URL)
+			clog.LogSuccess(
+				fmt.Sprintf("shared port %d of workspace %q until %s", share.Port, workspace.Name, share.ExpiresAt.Local().Format(time.Kitchen)),
+				clog.BlankLine,
+				clog.Tipf("run \"coder tunnel shares revoke %s %s\" to revoke it sooner", workspace.Name, share.ID),
+			)
+			if copyLink {
+				copyToClipboard(ctx, share.URL, "share link")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&expires, "expires", time.Hour, "how long the link works for, at most "+maxShareExpiry.String())
+	cmd.Flags().BoolVar(&copyLink, "copy", false, "copy the link to the clipboard")
+	return cmd
+}
+
+func tunnelSharesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "shares",
+		Short: "manage the share links of your workspaces",
+	}
+	cmd.AddCommand(lsTunnelSharesCmd(), revokeTunnelShareCmd())
+	return cmd
+}
+
+func lsTunnelSharesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls [workspace_name]",
+		Short: "list the unexpired share links of a workspace, or of all your workspaces",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			var workspaces []coder.Workspace
+			if len(args) == 1 {
+				workspace, err := findWorkspace(ctx, client, args[0], coder.Me)
+				if err != nil {
+					return err
+				}
+				workspaces = []coder.Workspace{*workspace}
+			} else {
+				workspaces, err = getWorkspaces(ctx, client, coder.Me)
+				if err != nil {
+					return err
+				}
+			}
+
+			shares := []coder.TunnelShare{} // ensures that json output still marshals
+			for _, workspace := range workspaces {
+				s, err := client.TunnelShares(ctx, workspace.ID)
+				if err != nil {
+					return xerrors.Errorf("get share links of workspace %q: %w", workspace.Name, err)
+				}
+				shares = append(shares, s...)
+			}
+
+			return writeOutput(cmd.OutOrStdout(), shares, func() error {
+				if len(shares) == 0 {
+					clog.LogInfo("no share links found")
+					return nil
+				}
+				err := writeTable(cmd.OutOrStdout(), len(shares), func(i int) interface{} {
+					return shares[i]
+				})
+				if err != nil {
+					return xerrors.Errorf("write table: %w", err)
+				}
+				return nil
+			})
+		},
+	}
+	addOutputShorthand(cmd)
+	return cmd
+}
+
+func revokeTunnelShareCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "revoke [workspace_name] [share_id]",
+		Short:   "revoke a share link before it expires",
+		Example: `coder tunnel shares revoke my-dev 5f7c2e9a-11b3d6b7`,
+		Args:    xcobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, args[0], coder.Me)
+			if err != nil {
+				return err
+			}
+			if err := client.RevokeTunnelShare(ctx, workspace.ID, args[1]); err != nil {
+				return xerrors.Errorf("revoke share link: %w", err)
+			}
+			clog.LogSuccess(i18n.Sprintf("revoked share link %s", args[1]))
+			return nil
+		},
+	}
+}
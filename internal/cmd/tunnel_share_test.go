@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_tunnelShare(t *testing.T) {
+	ctx := context.Background()
+	fake := codertest.New()
+	id := fake.AddWorkspace(coder.Workspace{Name: "my-dev"})
+	useFakeClient(t, fake)
+
+	res := execute(t, nil, "tunnel", "share", "my-dev:3000", "--expires", "48h")
+	res.error(t)
+	res.stderrContains(t, "share links must expire within 24h")
+
+	res = execute(t, nil, "tunnel", "share", "my-dev", "--expires", "30m")
+	res.error(t)
+	res.stderrContains(t, "expected workspace_name:port")
+
+	res = execute(t, nil, "tunnel", "share", "my-dev:3000", "--expires", "30m")
+	res.success(t)
+	res.stdoutContains(t, "https://coder.example.com/share/")
+	shares, err := fake.TunnelShares(ctx, id)
+	assert.Success(t, "get shares", err)
+	assert.Equal(t, "one share", 1, len(shares))
+	assert.Equal(t, "port", 3000, shares[0].Port)
+
+	res = execute(t, nil, "tunnel", "shares", "ls")
+	res.success(t)
+	res.stdoutContains(t, shares[0].URL)
+
+	res = execute(t, nil, "tunnel", "shares", "revoke", "my-dev", shares[0].ID)
+	res.success(t)
+	shares, err = fake.TunnelShares(ctx, id)
+	assert.Success(t, "get shares", err)
+	assert.Equal(t, "revoked", 0, len(shares))
+
+	res = execute(t, nil, "tunnel", "shares", "ls", "my-dev", "--output", "json")
+	res.success(t)
+	assert.Equal(t, "empty json", "[]", strings.TrimSpace(res.outBuffer.String()))
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"cdr.dev/slog"
+	"golang.org/x/xerrors"
+)
+
+// SOCKS5 protocol values, see RFC 1928.
+const (
+	socks5Version = 0x05
+
+	socks5NoAuth       = 0x00
+	socks5NoAcceptable = 0xff
+
+	socks5Connect = 0x01
+
+	socks5IPv4   = 0x01
+	socks5Domain = 0x03
+	socks5IPv6   = 0x04
+
+	socks5Succeeded          = 0x00
+	socks5GeneralFailure     = 0x01
+	socks5NotAllowed         = 0x02
+	socks5HostUnreachable    = 0x04
+	socks5ConnectionRefused  = 0x05
+	socks5CommandUnsupported = 0x07
+	socks5AddressUnsupported = 0x08
+)
+
+// parseSOCKS5Addr parses the --socks5 address, listening on localhost
+// unless a host is given, so that the workspace's network isn't exposed to
+// the local network by accident.
+func parseSOCKS5Addr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", xerrors.Errorf("parse --socks5 address %q, such as :1080: %w", addr, err)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", xerrors.Errorf("parse --socks5 port %q: %w", port, err)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// serveSOCKS5 runs a SOCKS5 server on listener, connecting clients to the
+// destinations they request through dialer, so that they're resolved and
+// reached from the workspace. Only the CONNECT command without
+// authentication is supported.
+func serveSOCKS5(ctx context.Context, log slog.Logger, listener net.Listener, dialer connDialer) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return xerrors.Errorf("accept: %w", err)
+		}
+		go func() {
+			defer conn.Close()
+			err := handleSOCKS5(ctx, log, conn, dialer)
+			if err != nil {
+				log.Debug(ctx, "socks5 connection failed", slog.F("client", conn.RemoteAddr()), slog.Error(err))
+			}
+		}()
+	}
+}
+
+func handleSOCKS5(ctx context.Context, log slog.Logger, conn net.Conn, dialer connDialer) error {
+	// The longest fields are the list of methods and the domain, of up to
+	// 255 bytes after their length.
+	buf := make([]byte, 2+255)
+
+	// The greeting lists the authentication methods of the client.
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return xerrors.Errorf("read greeting: %w", err)
+	}
+	if buf[0] != socks5Version {
+		return xerrors.Errorf("unsupported socks version %d", buf[0])
+	}
+	methods := buf[2 : 2+int(buf[1])]
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return xerrors.Errorf("read auth methods: %w", err)
+	}
+	method := byte(socks5NoAcceptable)
+	for _, m := range methods {
+		if m == socks5NoAuth {
+			method = socks5NoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+		return xerrors.Errorf("write auth method: %w", err)
+	}
+	if method == socks5NoAcceptable {
+		return xerrors.New("the client requires authentication")
+	}
+
+	// The request is the command and its destination.
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return xerrors.Errorf("read request: %w", err)
+	}
+	cmd, addrType := buf[1], buf[3]
+	var host string
+	switch addrType {
+	case socks5IPv4, socks5IPv6:
+		size := net.IPv4len
+		if addrType == socks5IPv6 {
+			size = net.IPv6len
+		}
+		if _, err := io.ReadFull(conn, buf[:size]); err != nil {
+			return xerrors.Errorf("read address: %w", err)
+		}
+		host = net.IP(buf[:size]).String()
+	case socks5Domain:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return xerrors.Errorf("read domain: %w", err)
+		}
+		domain := buf[1 : 1+int(buf[0])]
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return xerrors.Errorf("read domain: %w", err)
+		}
+		host = string(domain)
+	default:
+		_ = writeSOCKS5Reply(conn, socks5AddressUnsupported)
+		return xerrors.Errorf("unsupported address type %d", addrType)
+	}
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return xerrors.Errorf("read port: %w", err)
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2]))))
+	if cmd != socks5Connect {
+		_ = writeSOCKS5Reply(conn, socks5CommandUnsupported)
+		return xerrors.Errorf("unsupported command %d for %s", cmd, addr)
+	}
+
+	log.Debug(ctx, "socks5 connect", slog.F("client", conn.RemoteAddr()), slog.F("addr", addr))
+	nc, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		_ = writeSOCKS5Reply(conn, socks5ReplyCode(err))
+		return xerrors.Errorf("dial %s: %w", addr, err)
+	}
+	defer nc.Close()
+	if err := writeSOCKS5Reply(conn, socks5Succeeded); err != nil {
+		return xerrors.Errorf("write reply: %w", err)
+	}
+
+	go func() {
+		_, _ = io.Copy(nc, conn)
+		_ = nc.Close()
+	}()
+	_, _ = io.Copy(conn, nc)
+	return nil
+}
+
+// writeSOCKS5Reply answers a request. The bound address isn't meaningful
+// for connections made from the workspace, so it's left unspecified.
+func writeSOCKS5Reply(w io.Writer, code byte) error {
+	_, err := w.Write([]byte{socks5Version, code, 0, socks5IPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// socks5ReplyCode returns the reply code for an error dialing from the
+// workspace. The agent reports errors as text, so they're told apart by it.
+func socks5ReplyCode(err error) byte {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "connection refused"):
+		return socks5ConnectionRefused
+	case strings.Contains(msg, "not permitted"):
+		return socks5NotAllowed
+	case strings.Contains(msg, "no such host"), strings.Contains(msg, "unreachable"):
+		return socks5HostUnreachable
+	default:
+		return socks5GeneralFailure
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"golang.org/x/net/proxy"
+)
+
+func Test_parseSOCKS5Addr(t *testing.T) {
+	t.Parallel()
+
+	addr, err := parseSOCKS5Addr(":1080")
+	assert.Success(t, "port only", err)
+	assert.Equal(t, "localhost by default", "localhost:1080", addr)
+
+	addr, err = parseSOCKS5Addr("0.0.0.0:1080")
+	assert.Success(t, "host", err)
+	assert.Equal(t, "given host", "0.0.0.0:1080", addr)
+
+	_, err = parseSOCKS5Addr("1080")
+	assert.Error(t, "no colon", err)
+	_, err = parseSOCKS5Addr(":socks")
+	assert.Error(t, "named port", err)
+}
+
+func Test_serveSOCKS5(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	remote, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Success(t, "listen", err)
+	t.Cleanup(func() { _ = remote.Close() })
+	go func() {
+		for {
+			c, err := remote.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = c.Write([]byte("from the workspace"))
+			_ = c.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(remote.Addr().String())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Success(t, "listen socks5", err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		_ = serveSOCKS5(ctx, slogtest.Make(t, nil), listener, &fakeConnDialer{})
+	}()
+
+	client, err := proxy.SOCKS5("tcp", listener.Addr().String(), nil, proxy.Direct)
+	assert.Success(t, "socks5 client", err)
+	// Names are sent to the proxy, to be resolved in the workspace.
+	for _, host := range []string{"127.0.0.1", "localhost"} {
+		nc, err := client.Dial("tcp", net.JoinHostPort(host, port))
+		assert.Success(t, "dial through the proxy to "+host, err)
+		b, err := ioutil.ReadAll(nc)
+		assert.Success(t, "read", err)
+		assert.Equal(t, "proxied", "from the workspace", string(b))
+		_ = nc.Close()
+	}
+
+	_, err = client.Dial("tcp", "127.0.0.1:1")
+	assert.Error(t, "refused port", err)
+}
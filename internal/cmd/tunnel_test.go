@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_parseListenAddr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		listen  string
+		network string
+		address string
+		wantErr bool
+	}{
+		{listen: "unix:///tmp/db.sock", network: "unix", address: "/tmp/db.sock"},
+		{listen: "unix://db.sock", network: "unix", address: "db.sock"},
+		{listen: "tcp://127.0.0.1:5432", network: "tcp", address: "127.0.0.1:5432"},
+		{listen: "unix://", wantErr: true},
+		{listen: "/tmp/db.sock", wantErr: true},
+		{listen: "udp://localhost:53", wantErr: true},
+	}
+	for _, tt := range tests {
+		network, address, err := parseListenAddr(tt.listen)
+		if tt.wantErr {
+			assert.Error(t, tt.listen, err)
+			continue
+		}
+		assert.Success(t, tt.listen, err)
+		assert.Equal(t, tt.listen+" network", tt.network, network)
+		assert.Equal(t, tt.listen+" address", tt.address, address)
+	}
+}
+
+func Test_parseRemoteAddr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		arg     string
+		network string
+		address string
+		wantErr bool
+	}{
+		{arg: "3000", network: "tcp", address: "localhost:3000"},
+		{arg: "/var/run/docker.sock", network: "unix", address: "/var/run/docker.sock"},
+		{arg: "unix:///var/run/docker.sock", network: "unix", address: "/var/run/docker.sock"},
+		{arg: "container:tools", network: "container", address: "tools"},
+		{arg: "container:", wantErr: true},
+		{arg: "docker.sock", wantErr: true},
+		{arg: "70000", wantErr: true},
+	}
+	for _, tt := range tests {
+		network, address, err := parseRemoteAddr(tt.arg)
+		if tt.wantErr {
+			assert.Error(t, tt.arg, err)
+			continue
+		}
+		assert.Success(t, tt.arg, err)
+		assert.Equal(t, tt.arg+" network", tt.network, network)
+		assert.Equal(t, tt.arg+" address", tt.address, address)
+	}
+}
+
+func Test_listenLocalUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket permissions are not enforced on windows")
+	}
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "db.sock")
+
+	listener, err := listenLocal("unix", path)
+	assert.Success(t, "listen", err)
+	info, err := os.Stat(path)
+	assert.Success(t, "stat socket", err)
+	assert.Equal(t, "socket permissions", os.FileMode(0600), info.Mode().Perm())
+
+	_, err = listenLocal("unix", path)
+	assert.Error(t, "socket in use", err)
+
+	// Leave a stale socket behind, as a killed tunnel would.
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	assert.Success(t, "close listener", listener.Close())
+	listener, err = listenLocal("unix", path)
+	assert.Success(t, "replace stale socket", err)
+	assert.Success(t, "close listener", listener.Close())
+
+	regular := filepath.Join(t.TempDir(), "file")
+	assert.Success(t, "create file", ioutil.WriteFile(regular, nil, 0600))
+	_, err = listenLocal("unix", regular)
+	assert.Error(t, "not a socket", err)
+}
+
+func Test_tunnelUDPArgs(t *testing.T) {
+	t.Parallel()
+
+	res := execute(t, nil, "tunnel", "my-dev", "60001", "stdio", "--udp")
+	res.error(t)
+	res.stderrContains(t, "stdio")
+
+	res = execute(t, nil, "tunnel", "my-dev", "/run/app.sock", "8080", "--udp")
+	res.error(t)
+	res.stderrContains(t, "not a socket or container")
+
+	res = execute(t, nil, "tunnel", "my-dev", "60001", "--listen", "unix:///tmp/app.sock", "--udp")
+	res.error(t)
+	res.stderrContains(t, "unix socket")
+}
+
+func Test_tunnelReverseArgs(t *testing.T) {
+	t.Parallel()
+
+	res := execute(t, nil, "tunnel", "my-dev", "container:tools", "2222", "--reverse")
+	res.error(t)
+	res.stderrContains(t, "not a container")
+
+	res = execute(t, nil, "tunnel", "my-dev", "5432", "--listen", "unix:///tmp/db.sock", "--reverse")
+	res.error(t)
+	res.stderrContains(t, "doesn't listen locally")
+}
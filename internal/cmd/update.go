@@ -0,0 +1,1012 @@
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/version"
+	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// releasesURL is where the release archives built by ci/scripts/build.sh are
+// published, under a directory per version tag.
+const releasesURL = "https://github.com/cdr/coder-cli/releases/download"
+
+// updateMirrorEnv sets the mirror of the release archives, like --mirror-url.
+const updateMirrorEnv = "CODER_UPDATE_MIRROR"
+
+// Sources of release archives, see --source.
+const (
+	updateSourceGitHub     = "github"
+	updateSourceDeployment = "deployment"
+)
+
+// githubProbeTimeout bounds checking whether github.com can be reached,
+// before falling back to downloading coder from the deployment.
+const githubProbeTimeout = 5 * time.Second
+
+// checksumsFile is the release asset listing the SHA-256 checksums of the
+// release archives, in the format of sha256sum.
+const checksumsFile = "SHA256SUMS"
+
+// selfCheckTimeout bounds running the new binary with --version after an
+// update.
+const selfCheckTimeout = 10 * time.Second
+
+func updateCmd() *cobra.Command {
+	var (
+		targetVersion string
+		channel       string
+		force         bool
+		skipChecksum  bool
+		rollback      bool
+		fromFile      string
+		mirrorURL     string
+		source        string
+		ignorePkgMgr  bool
+		showChangelog bool
+	)
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update the coder binary",
+		Long: "Replace the running coder binary with the release matching the version of your Coder deployment, " +
+			"or with the given --version.\n\n" +
+			"When site admins stage a new CLI version with \"coder update rollout\", the version offered to you by the rollout is used instead.\n\n" +
+			"With --channel, or the update-channel set with \"coder config set\", the newest release of the channel is used instead: " +
+			"stable releases, beta releases and release candidates too, or nightly builds too.\n\n" +
+			"Before anything is downloaded, coder checks that the directory of the binary is writable and has room for the new binary. " +
+			"The downloaded release archive is verified against the checksums published with the release before the binary is replaced. " +
+			"The replaced binary is kept next to the new one as coder.old, and restored if the new binary fails to run. " +
+			"Use --rollback to restore it after a bad update.\n\n" +
+			"On Windows, where a running binary can't be replaced, it's renamed to coder.old first. " +
+			"If that's not possible either, the new binary is staged as coder.new, and replaces coder the next time it runs.\n\n" +
+			"Where github.com can't be reached, the release archives can be downloaded from a mirror with the same layout instead, " +
+			"given with --mirror-url or the " + updateMirrorEnv + " env variable, or installed from a release archive on disk with --from-file. " +
+			"Coder deployments also serve the release of their own version, which is downloaded from the deployment with --source deployment, " +
+			"or when github.com can't be reached, and verified against the " + checksumsFile + " file the deployment serves with it. " +
+			"An archive on disk is verified against the " + checksumsFile + " file published with the release, copied next to it.\n\n" +
+			"A binary installed with a package manager, such as Homebrew, Nix or a distribution package, isn't replaced, " +
+			"as that would corrupt the install. For Homebrew, the equivalent brew command is offered instead.\n\n" +
+			"With --changelog, the release notes of every version after the running one, up to the new one, are shown before confirming the update. " +
+			"Run \"coder changelog\" to show them without updating.",
+		Args: xcobra.ExactArgs(0),
+		Example: `coder update
+coder update --version 1.21.0
+
+# track pre-releases
+coder update --channel beta
+coder config set update-channel beta
+
+# go back to the version before the last update
+coder update --rollback
+
+# read what changed before updating
+coder update --changelog
+
+# update without access to github.com
+coder update --source deployment
+coder update --mirror-url https://artifacts.example.com/coder-cli/releases
+coder update --from-file ./coder-cli-linux-amd64.tar.gz`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if !ignorePkgMgr {
+				exe, err := executablePath()
+				if err != nil {
+					return err
+				}
+				if pm := detectPackageManager(exe, os.Getenv); pm != nil {
+					// The package manager only offers its own latest version.
+					if pm.upgrade == nil || rollback || fromFile != "" || targetVersion != "" || channel != "" || mirrorURL != "" {
+						return pm.refuse(exe)
+					}
+					return pm.runUpgrade(ctx, force)
+				}
+			}
+			if rollback {
+				if targetVersion != "" || channel != "" || fromFile != "" || mirrorURL != "" {
+					return xerrors.New("--rollback can't be used with --version, --channel, --from-file or --mirror-url")
+				}
+				return rollbackUpdate(ctx, force)
+			}
+			if fromFile != "" {
+				if targetVersion != "" || channel != "" || mirrorURL != "" {
+					return xerrors.New("--from-file can't be used with --version, --channel or --mirror-url")
+				}
+				return updateFromFile(ctx, fromFile, force, skipChecksum)
+			}
+			if targetVersion != "" && channel != "" {
+				return xerrors.New("--version and --channel can't be used together")
+			}
+			switch source {
+			case "", updateSourceGitHub, updateSourceDeployment:
+			default:
+				return xerrors.Errorf("invalid --source %q: must be %s or %s", source, updateSourceGitHub, updateSourceDeployment)
+			}
+			baseURL, err := updateBaseURL(mirrorURL, os.Getenv(updateMirrorEnv))
+			if err != nil {
+				return err
+			}
+			// Channels are looked up with the GitHub API, which mirrors
+			// don't serve.
+			mirrored := baseURL != releasesURL
+			if mirrored && channel != "" {
+				return clog.Error("--channel can't be used with a mirror",
+					"the releases of a channel are looked up on github.com",
+					clog.BlankLine,
+					clog.Tipf("use \"--version\" to pick the release to download from the mirror"),
+				)
+			}
+			if source == updateSourceDeployment && (targetVersion != "" || channel != "" || mirrored) {
+				return xerrors.New("--source deployment can't be used with --version, --channel or a mirror, as deployments serve the release of their own version")
+			}
+			hc, err := newHTTPClient(ctx)
+			if err != nil {
+				return err
+			}
+			if source == "" && !mirrored && !reachable(ctx, hc, "https://github.com") {
+				if targetVersion != "" || channel != "" {
+					return clog.Error("github.com can't be reached",
+						clog.BlankLine,
+						clog.Tipf("use \"--mirror-url\" or \"--from-file\" to update without access to github.com"),
+					)
+				}
+				clog.LogInfo("github.com can't be reached, so coder is downloaded from the deployment")
+				source = updateSourceDeployment
+			}
+			if source == updateSourceDeployment {
+				if configured, err := updateChannel(); err == nil && configured != "" {
+					clog.LogWarn(i18n.Sprintf("ignoring the %s update channel, as deployments serve the release of their own version", configured))
+				}
+				client, err := newClient(ctx, false)
+				if err != nil {
+					return err
+				}
+				if targetVersion, err = client.APIVersion(ctx); err != nil {
+					return xerrors.Errorf("get deployment version: %w", err)
+				}
+				baseURL = deploymentBinURL(client.BaseURL())
+			}
+			if targetVersion == "" && channel == "" {
+				channel, err = updateChannel()
+				if err != nil {
+					return err
+				}
+				if mirrored && channel != "" {
+					clog.LogWarn(i18n.Sprintf("ignoring the %s update channel, as its releases are looked up on github.com", channel))
+					channel = ""
+				}
+			}
+			if channel != "" {
+				targetVersion, err = channelVersion(ctx, hc, releasesAPIURL, channel)
+				if err != nil {
+					return err
+				}
+			}
+			if targetVersion == "" {
+				client, err := newClient(ctx, false)
+				if err != nil {
+					return err
+				}
+				apiVersion, err := client.APIVersion(ctx)
+				if err != nil {
+					return xerrors.Errorf("get deployment version: %w", err)
+				}
+				targetVersion = rolloutVersion(ctx, client, apiVersion)
+			}
+			targetVersion = "v" + strings.TrimPrefix(targetVersion, "v")
+			if targetVersion == "v"+strings.TrimPrefix(version.Version, "v") {
+				clog.LogSuccess(i18n.Sprintf("coder is already at version %s", targetVersion))
+				return nil
+			}
+
+			exe, err := executablePath()
+			if err != nil {
+				return err
+			}
+			if showChangelog {
+				writeUpdateChangelog(ctx, cmd.OutOrStdout(), hc, targetVersion)
+			}
+			if !force {
+				if err := confirmUpdate(fmt.Sprintf("Update coder from %s to %s?", version.Version, targetVersion)); err != nil {
+					return err
+				}
+			}
+
+			u := &updater{
+				httpClient:   hc,
+				baseURL:      baseURL,
+				goos:         runtime.GOOS,
+				goarch:       runtime.GOARCH,
+				executable:   exe,
+				skipChecksum: skipChecksum,
+				moveAside:    runtime.GOOS == "windows",
+				progress:     showInteractiveOutput,
+				heartbeat:    progressEvery(),
+				flat:         source == updateSourceDeployment,
+			}
+			if err := u.update(ctx, targetVersion); err != nil {
+				return err
+			}
+			logUpdated(u, targetVersion)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&targetVersion, "version", "", "the version to update to, instead of the version of your Coder deployment")
+	cmd.Flags().StringVar(&channel, "channel", "", "update to the newest release of this channel, stable, beta or nightly, instead of the version of your Coder deployment")
+	cmd.Flags().BoolVar(&force, "force", false, "update without showing a confirmation prompt")
+	cmd.Flags().BoolVar(&rollback, "rollback", false, "restore the binary replaced by the last update")
+	cmd.Flags().BoolVar(&skipChecksum, "skip-checksum", false, "don't verify the download against the published checksums, such as for releases published without them")
+	cmd.Flags().StringVar(&fromFile, "from-file", "", "install the binary in this release archive, instead of downloading one")
+	cmd.Flags().StringVar(&mirrorURL, "mirror-url", "", "download release archives from this mirror of "+releasesURL+" (env "+updateMirrorEnv+")")
+	cmd.Flags().StringVar(&source, "source", "", "where to download coder from, github or deployment (default github, or deployment when github.com can't be reached)")
+	cmd.Flags().BoolVar(&ignorePkgMgr, "ignore-package-manager", false, "replace the binary even if it's managed by a package manager")
+	cmd.Flags().BoolVar(&showChangelog, "changelog", false, "show the release notes of the versions between the running one and the new one before updating")
+	_ = cmd.MarkFlagFilename("from-file", "gz", "zip")
+	completeFlagChoices(cmd, "channel", updateChannels...)
+	completeFlagChoices(cmd, "source", updateSourceGitHub, updateSourceDeployment)
+	cmd.AddCommand(updateRolloutCmd())
+	return cmd
+}
+
+// updateBaseURL returns where to download release archives from, the mirror
+// given with --mirror-url or the env variable, or GitHub.
+func updateBaseURL(flag, env string) (string, error) {
+	mirror := flag
+	if mirror == "" {
+		mirror = env
+	}
+	if mirror == "" {
+		return releasesURL, nil
+	}
+	u, err := url.Parse(mirror)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", xerrors.Errorf("invalid mirror URL %q: must be an http or https URL", mirror)
+	}
+	return strings.TrimSuffix(mirror, "/"), nil
+}
+
+// deploymentBinURL returns where the deployment serves the release archives
+// of its version.
+func deploymentBinURL(base url.URL) string {
+	base.Path = path.Join(base.Path, "bin")
+	return strings.TrimSuffix(base.String(), "/")
+}
+
+// reachable reports whether an HTTP request to u gets any response.
+func reachable(ctx context.Context, hc *http.Client, u string) bool {
+	ctx, cancel := context.WithTimeout(ctx, githubProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+	return true
+}
+
+func updateFromFile(ctx context.Context, archivePath string, force, skipChecksum bool) error {
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	if !force {
+		if err := confirmUpdate(fmt.Sprintf("Update coder from %s to the binary in %s?", version.Version, archivePath)); err != nil {
+			return err
+		}
+	}
+	u := &updater{
+		goos:         runtime.GOOS,
+		goarch:       runtime.GOARCH,
+		executable:   exe,
+		skipChecksum: skipChecksum,
+		moveAside:    runtime.GOOS == "windows",
+	}
+	newVersion, err := u.updateFromFile(ctx, archivePath)
+	if err != nil {
+		return err
+	}
+	logUpdated(u, newVersion)
+	return nil
+}
+
+func logUpdated(u *updater, newVersion string) {
+	if u.staged {
+		clog.LogSuccess(i18n.Sprintf("staged coder %s", newVersion),
+			fmt.Sprintf("%s is still in use, so it's replaced the next time coder runs", u.executable),
+		)
+		return
+	}
+	clog.LogSuccess(i18n.Sprintf("updated coder to %s", newVersion))
+}
+
+func rollbackUpdate(ctx context.Context, force bool) error {
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	if !force {
+		if err := confirmUpdate(fmt.Sprintf("Roll coder %s back to the binary replaced by the last update?", version.Version)); err != nil {
+			return err
+		}
+	}
+	u := &updater{executable: exe, moveAside: runtime.GOOS == "windows"}
+	previousVersion, err := u.rollback(ctx)
+	if err != nil {
+		return err
+	}
+	clog.LogSuccess(i18n.Sprintf("rolled coder back to %s", previousVersion))
+	return nil
+}
+
+// executablePath returns the path of the running coder binary, resolving
+// symlinks so that the binary is replaced rather than the link.
+func executablePath() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", xerrors.Errorf("get executable path: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", xerrors.Errorf("resolve executable path: %w", err)
+	}
+	return exe, nil
+}
+
+func confirmUpdate(label string) error {
+	if _, err := (&promptui.Prompt{Label: label, IsConfirm: true}).Run(); err != nil {
+		return clog.Fatal(
+			"failed to confirm prompt", clog.BlankLine,
+			clog.Tipf(`use "--force" to update without a confirmation prompt`),
+		)
+	}
+	return nil
+}
+
+// updater replaces the executable with a release of another version.
+//
+// The release archive is downloaded to a temp file, and the binary is
+// streamed out of it into a temp file next to the executable, which then
+// replaces it. Neither is ever fully held in memory, so updating works on
+// small machines too. The replaced binary is kept at previousBinary, to be
+// restored if the new binary fails to run, or by a rollback.
+type updater struct {
+	httpClient   *http.Client
+	baseURL      string
+	goos         string
+	goarch       string
+	executable   string
+	skipChecksum bool
+	// moveAside replaces the executable by renaming it out of the way
+	// first, since Windows can't replace a running executable.
+	moveAside bool
+	// staged is set when the new binary couldn't replace the executable
+	// yet, and was staged to replace it the next time coder runs.
+	staged bool
+	// progress shows the progress of the download on a spinner.
+	progress bool
+	// heartbeat is how often the progress of the download is logged as a
+	// single line when it's not shown on a spinner, or never if 0.
+	heartbeat time.Duration
+	// flat is set when baseURL serves the release archives of a single
+	// version, without a directory per version, like deployments do.
+	flat bool
+}
+
+// assetURL returns the URL of the named asset of the release.
+func (u *updater) assetURL(targetVersion, name string) string {
+	if u.flat {
+		return u.baseURL + "/" + name
+	}
+	return fmt.Sprintf("%s/%s/%s", u.baseURL, targetVersion, name)
+}
+
+// releaseAsset returns the name of the release archive for the platform, and
+// the name of the binary inside it.
+func releaseAsset(goos, goarch string) (archive, binary string) {
+	switch goos {
+	case "windows":
+		return "coder-cli-windows.zip", "coder.exe"
+	case "darwin":
+		return fmt.Sprintf("coder-cli-%s-%s.zip", goos, goarch), "coder"
+	}
+	return fmt.Sprintf("coder-cli-%s-%s.tar.gz", goos, goarch), "coder"
+}
+
+func (u *updater) update(ctx context.Context, targetVersion string) error {
+	if err := u.preflight(); err != nil {
+		return err
+	}
+	archiveName, binaryName := releaseAsset(u.goos, u.goarch)
+	archive, sum, err := u.download(ctx, u.assetURL(targetVersion, archiveName))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = archive.Close()
+		_ = os.Remove(archive.Name())
+	}()
+	if !u.skipChecksum {
+		if err := u.verifyChecksum(ctx, targetVersion, archiveName, sum); err != nil {
+			return err
+		}
+	}
+	_, err = u.install(ctx, archive, archiveName, binaryName, targetVersion)
+	return err
+}
+
+// updateFromFile replaces the executable with the binary in the release
+// archive at archivePath, and returns its version. The archive is verified
+// against the checksums file next to it.
+func (u *updater) updateFromFile(ctx context.Context, archivePath string) (string, error) {
+	if err := u.preflight(); err != nil {
+		return "", err
+	}
+	_, binaryName := releaseAsset(u.goos, u.goarch)
+	archiveName := filepath.Base(archivePath)
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return "", xerrors.Errorf("open archive: %w", err)
+	}
+	defer archive.Close()
+	if !u.skipChecksum {
+		if err := verifyLocalChecksum(archive); err != nil {
+			return "", err
+		}
+		if _, err := archive.Seek(0, io.SeekStart); err != nil {
+			return "", xerrors.Errorf("rewind archive: %w", err)
+		}
+	}
+	return u.install(ctx, archive, archiveName, binaryName, "")
+}
+
+// install replaces the executable with the named binary from the release
+// archive, and returns its version, which must be wantVersion unless that's
+// empty.
+func (u *updater) install(ctx context.Context, archive *os.File, archiveName, binaryName, wantVersion string) (string, error) {
+	// The new binary is written next to the executable so that it can be
+	// renamed over it, which is atomic on the same filesystem.
+	dir := filepath.Dir(u.executable)
+	binary, err := ioutil.TempFile(dir, ".coder-update-")
+	if err != nil {
+		return "", xerrors.Errorf("create temp file: %w", err)
+	}
+	defer func() {
+		_ = binary.Close()
+		_ = os.Remove(binary.Name())
+	}()
+
+	if strings.HasSuffix(archiveName, ".zip") {
+		err = extractZip(archive, binaryName, binary)
+	} else {
+		err = extractTarGz(archive, binaryName, binary)
+	}
+	if err != nil {
+		return "", xerrors.Errorf("extract %s from %s: %w", binaryName, archiveName, err)
+	}
+	// The binary must be on disk before it replaces the executable, or a
+	// crash could leave a truncated executable behind.
+	if err := binary.Sync(); err != nil {
+		return "", xerrors.Errorf("write binary: %w", err)
+	}
+	if err := binary.Close(); err != nil {
+		return "", xerrors.Errorf("write binary: %w", err)
+	}
+	if err := os.Chmod(binary.Name(), 0755); err != nil {
+		return "", xerrors.Errorf("make binary executable: %w", err)
+	}
+	name := wantVersion
+	if name == "" {
+		name = "the new binary"
+	}
+	if u.moveAside {
+		staged, err := u.replaceRunning(binary.Name())
+		if err != nil {
+			return "", err
+		}
+		if staged {
+			return u.checkStaged(ctx, name, wantVersion)
+		}
+	} else {
+		if err := u.keepPrevious(); err != nil {
+			return "", err
+		}
+		if err := renameFile(binary.Name(), u.executable); err != nil {
+			return "", xerrors.Errorf("replace %s: %w", u.executable, err)
+		}
+	}
+
+	newVersion, err := u.selfCheck(ctx, u.executable, wantVersion)
+	if err != nil {
+		if rbErr := os.Rename(previousBinary(u.executable), u.executable); rbErr != nil {
+			return "", xerrors.Errorf("%s failed its self-check, and restoring the previous binary failed: %v: %w", name, rbErr, err)
+		}
+		return "", clog.Error(i18n.Sprintf("%s failed its self-check, so the previous binary was restored", name),
+			err.Error(),
+		)
+	}
+	return newVersion, nil
+}
+
+// preflight checks that the new binary can be written next to the
+// executable and renamed over it, and that there's room for it and for a
+// copy of the replaced binary, before anything is downloaded or written.
+func (u *updater) preflight() error {
+	info, err := os.Stat(u.executable)
+	if err != nil {
+		return xerrors.Errorf("stat executable: %w", err)
+	}
+	dir := filepath.Dir(u.executable)
+	if err := checkWritable(dir); err != nil {
+		return err
+	}
+	// The new binary is about the size of the running one, and the replaced
+	// binary is copied where it can't be hard linked.
+	return checkDiskSpace(dir, 2*uint64(info.Size()))
+}
+
+// previousBinary returns the path the binary replaced by an update is kept
+// at, for "coder update --rollback".
+func previousBinary(executable string) string {
+	return strings.TrimSuffix(executable, ".exe") + ".old"
+}
+
+// stagedBinary returns the path a new binary is staged at when the
+// executable can't be replaced yet, to replace it the next time coder runs.
+func stagedBinary(executable string) string {
+	return strings.TrimSuffix(executable, ".exe") + ".new"
+}
+
+// replacedBinary returns the path a rollback moves the running executable to
+// when it can't be removed yet, to be removed the next time coder runs.
+func replacedBinary(executable string) string {
+	return strings.TrimSuffix(executable, ".exe") + ".replaced"
+}
+
+// replaceRunning replaces the executable with binary where a running
+// executable can't be replaced but can be renamed, like on Windows, by
+// renaming the executable to previousBinary first. If the previous binary
+// can't be removed either, such as while it still runs, binary is staged to
+// replace the executable the next time coder runs instead, and staged is
+// set.
+func (u *updater) replaceRunning(binary string) (staged bool, err error) {
+	previous := previousBinary(u.executable)
+	if err := os.Remove(previous); err != nil && !os.IsNotExist(err) {
+		return true, u.stage(binary)
+	}
+	if err := os.Rename(u.executable, previous); err != nil {
+		return true, u.stage(binary)
+	}
+	if err := os.Rename(binary, u.executable); err != nil {
+		_ = os.Rename(previous, u.executable) // Best effort, there's no executable otherwise.
+		return false, xerrors.Errorf("replace %s: %w", u.executable, err)
+	}
+	return false, nil
+}
+
+func (u *updater) stage(binary string) error {
+	if err := os.Rename(binary, stagedBinary(u.executable)); err != nil {
+		return xerrors.Errorf("stage %s: %w", binary, err)
+	}
+	return nil
+}
+
+// checkStaged runs the self-check of the staged binary, and removes it if it
+// fails.
+func (u *updater) checkStaged(ctx context.Context, name, wantVersion string) (string, error) {
+	staged := stagedBinary(u.executable)
+	newVersion, err := u.selfCheck(ctx, staged, wantVersion)
+	if err != nil {
+		_ = os.Remove(staged)
+		return "", clog.Error(i18n.Sprintf("%s failed its self-check, so it wasn't staged", name),
+			err.Error(),
+		)
+	}
+	u.staged = true
+	return newVersion, nil
+}
+
+// applyStagedUpdate replaces the executable with the binary staged by an
+// update, if any, and removes the binary left behind by a rollback. It's run
+// whenever coder starts on Windows, where the running executable can't be
+// replaced.
+func applyStagedUpdate(executable string) error {
+	_ = os.Remove(replacedBinary(executable)) // Best effort, it might still run.
+	staged := stagedBinary(executable)
+	if _, err := os.Stat(staged); err != nil {
+		return nil
+	}
+	u := &updater{executable: executable, moveAside: true}
+	if _, err := u.replaceRunning(staged); err != nil {
+		return xerrors.Errorf("apply staged update: %w", err)
+	}
+	return nil
+}
+
+// keepPrevious keeps the executable at previousBinary, replacing the binary
+// kept by the last update.
+func (u *updater) keepPrevious() error {
+	previous := previousBinary(u.executable)
+	if err := os.Remove(previous); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("remove %s: %w", previous, err)
+	}
+	// A hard link keeps the executable in place until the new binary is
+	// renamed over it.
+	if err := os.Link(u.executable, previous); err == nil {
+		return nil
+	}
+	src, err := os.Open(u.executable)
+	if err != nil {
+		return xerrors.Errorf("keep previous binary: %w", err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(previous, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0755)
+	if err != nil {
+		return xerrors.Errorf("keep previous binary: %w", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return xerrors.Errorf("keep previous binary: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return xerrors.Errorf("keep previous binary: %w", err)
+	}
+	return nil
+}
+
+// selfCheck runs the binary with --version, and returns the version it
+// reports, which must be wantVersion unless that's empty.
+func (u *updater) selfCheck(ctx context.Context, binary, wantVersion string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, selfCheckTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, binary, "--version").Output()
+	if err != nil {
+		return "", xerrors.Errorf("run %s --version: %w", binary, err)
+	}
+	// The output is "coder version v1.21.0 go1.16.3 linux/amd64".
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 || fields[1] != "version" {
+		return "", xerrors.Errorf("unexpected output of %s --version: %q", binary, strings.TrimSpace(string(out)))
+	}
+	got := "v" + strings.TrimPrefix(fields[2], "v")
+	if wantVersion != "" && got != wantVersion {
+		return "", xerrors.Errorf("%s reports version %s", binary, got)
+	}
+	return got, nil
+}
+
+// rollback restores the binary replaced by the last update.
+func (u *updater) rollback(ctx context.Context) (string, error) {
+	previous := previousBinary(u.executable)
+	if _, err := os.Stat(previous); os.IsNotExist(err) {
+		return "", clog.Error("no previous binary to roll back to",
+			fmt.Sprintf("%s is kept by \"coder update\", and removed by a rollback", previous),
+		)
+	}
+	previousVersion, err := u.selfCheck(ctx, previous, "")
+	if err != nil {
+		return "", xerrors.Errorf("check previous binary: %w", err)
+	}
+	if u.moveAside {
+		// The running executable can be renamed but not removed, so it's
+		// removed the next time coder runs.
+		replaced := replacedBinary(u.executable)
+		_ = os.Remove(replaced) // Best effort, it might still run.
+		if err := os.Rename(u.executable, replaced); err != nil {
+			return "", xerrors.Errorf("move %s aside: %w", u.executable, err)
+		}
+		if err := os.Rename(previous, u.executable); err != nil {
+			_ = os.Rename(replaced, u.executable) // Best effort, there's no executable otherwise.
+			return "", xerrors.Errorf("restore %s: %w", previous, err)
+		}
+		_ = os.Remove(replaced) // Best effort, it fails while it runs.
+		return previousVersion, nil
+	}
+	if err := os.Rename(previous, u.executable); err != nil {
+		return "", xerrors.Errorf("restore %s: %w", previous, err)
+	}
+	return previousVersion, nil
+}
+
+// verifyChecksum checks the SHA-256 sum of the release archive against the
+// checksums published with the release.
+func (u *updater) verifyChecksum(ctx context.Context, targetVersion, archiveName string, sum []byte) error {
+	url := u.assetURL(targetVersion, checksumsFile)
+	resp, err := u.get(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && u.flat {
+		return clog.Error("the deployment publishes no checksums",
+			"the download can't be verified",
+			clog.BlankLine,
+			clog.Tipf("use \"--skip-checksum\" to update without verifying the download"),
+		)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return clog.Error(i18n.Sprintf("no checksums are published for %s", targetVersion),
+			"the download can't be verified",
+			clog.BlankLine,
+			clog.Tipf("use \"--skip-checksum\" to update without verifying the download"),
+		)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("download %s: unexpected status %s", url, resp.Status)
+	}
+	// The checksums of a handful of archives fit well within a megabyte.
+	want, err := parseChecksums(io.LimitReader(resp.Body, 1<<20), archiveName)
+	if err != nil {
+		return xerrors.Errorf("read %s: %w", checksumsFile, err)
+	}
+	if !bytes.Equal(want, sum) {
+		return checksumMismatch(archiveName, want, sum)
+	}
+	return nil
+}
+
+// verifyLocalChecksum checks the SHA-256 sum of the release archive against
+// the checksums file next to it.
+func verifyLocalChecksum(archive *os.File) error {
+	archiveName := filepath.Base(archive.Name())
+	sumsPath := filepath.Join(filepath.Dir(archive.Name()), checksumsFile)
+	sums, err := os.Open(sumsPath)
+	if os.IsNotExist(err) {
+		return clog.Error(i18n.Sprintf("no %s next to %s", checksumsFile, archiveName),
+			"the archive can't be verified",
+			clog.BlankLine,
+			clog.Tipf("copy the %s file published with the release next to the archive, or use \"--skip-checksum\"", checksumsFile),
+		)
+	}
+	if err != nil {
+		return xerrors.Errorf("open %s: %w", checksumsFile, err)
+	}
+	defer sums.Close()
+	want, err := parseChecksums(io.LimitReader(sums, 1<<20), archiveName)
+	if err != nil {
+		return xerrors.Errorf("read %s: %w", sumsPath, err)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, archive); err != nil {
+		return xerrors.Errorf("read archive: %w", err)
+	}
+	if sum := h.Sum(nil); !bytes.Equal(want, sum) {
+		return checksumMismatch(archiveName, want, sum)
+	}
+	return nil
+}
+
+func checksumMismatch(archiveName string, want, got []byte) error {
+	return clog.Error(i18n.Sprintf("checksum mismatch for %s", archiveName),
+		fmt.Sprintf("expected: %x", want),
+		fmt.Sprintf("got:      %x", got),
+		"the archive is corrupted or was tampered with, so coder was not updated",
+	)
+}
+
+// parseChecksums returns the checksum of the named file from the output of
+// sha256sum.
+func parseChecksums(r io.Reader, name string) ([]byte, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Files hashed in binary mode are marked with a leading "*".
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha256.Size {
+			return nil, xerrors.Errorf("invalid checksum for %s", name)
+		}
+		return sum, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, xerrors.Errorf("no checksum listed for %s", name)
+}
+
+func (u *updater) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("create request: %w", err)
+	}
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("download %s: %w", url, err)
+	}
+	return resp, nil
+}
+
+// download writes the body of url to a temp file, which is returned open,
+// along with its SHA-256 sum.
+func (u *updater) download(ctx context.Context, url string) (*os.File, []byte, error) {
+	resp, err := u.get(ctx, url)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, xerrors.Errorf("download %s: unexpected status %s", url, resp.Status)
+	}
+	if resp.ContentLength > 0 {
+		if err := checkDiskSpace(os.TempDir(), uint64(resp.ContentLength)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	f, err := ioutil.TempFile("", "coder-update-")
+	if err != nil {
+		return nil, nil, xerrors.Errorf("create temp file: %w", err)
+	}
+	h := sha256.New()
+	w := io.MultiWriter(f, h)
+	if u.progress {
+		p := newDownloadProgress(path.Base(url), resp.ContentLength)
+		defer p.stop()
+		w = io.MultiWriter(w, p)
+	} else if u.heartbeat > 0 {
+		p := newDownloadHeartbeat(path.Base(url), resp.ContentLength, u.heartbeat)
+		defer p.heartbeat.Stop()
+		w = io.MultiWriter(w, p)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, nil, xerrors.Errorf("download %s: %w", url, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, nil, xerrors.Errorf("rewind archive: %w", err)
+	}
+	return f, h.Sum(nil), nil
+}
+
+// downloadProgress shows the bytes downloaded so far on a spinner, out of
+// the total and with the time left when the size of the download is known.
+type downloadProgress struct {
+	name    string
+	total   int64
+	written int64
+	start   time.Time
+	spinner *spinner.Spinner
+}
+
+func newDownloadProgress(name string, total int64) *downloadProgress {
+	p := &downloadProgress{
+		name:    name,
+		total:   total,
+		start:   time.Now(),
+		spinner: spinner.New(spinner.CharSets[11], 100*time.Millisecond, spinner.WithWriter(os.Stderr)),
+	}
+	p.spinner.Suffix = "  " + downloadProgressLine(name, 0, total, 0)
+	p.spinner.Start()
+	return p
+}
+
+func (p *downloadProgress) Write(b []byte) (int, error) {
+	p.written += int64(len(b))
+	p.spinner.Suffix = "  " + downloadProgressLine(p.name, p.written, p.total, time.Since(p.start))
+	return len(b), nil
+}
+
+func (p *downloadProgress) stop() {
+	p.spinner.Stop()
+}
+
+// downloadHeartbeat logs the progress of a download as a single line
+// periodically, when it's not shown on a spinner.
+type downloadHeartbeat struct {
+	name      string
+	total     int64
+	written   int64
+	start     time.Time
+	heartbeat *clog.Heartbeat
+}
+
+func newDownloadHeartbeat(name string, total int64, interval time.Duration) *downloadHeartbeat {
+	return &downloadHeartbeat{
+		name:      name,
+		total:     total,
+		start:     time.Now(),
+		heartbeat: clog.StartHeartbeat(downloadProgressLine(name, 0, total, 0), interval),
+	}
+}
+
+func (p *downloadHeartbeat) Write(b []byte) (int, error) {
+	p.written += int64(len(b))
+	p.heartbeat.Set(downloadProgressLine(p.name, p.written, p.total, time.Since(p.start)))
+	return len(b), nil
+}
+
+// downloadProgressLine describes the progress of a download of total bytes,
+// or of unknown size if total isn't positive, after elapsed.
+func downloadProgressLine(name string, written, total int64, elapsed time.Duration) string {
+	line := fmt.Sprintf("downloading %s -- %s", name, formatBytes(uint64(written)))
+	if total <= 0 {
+		return line
+	}
+	line += " / " + formatBytes(uint64(total))
+	if written > 0 && written < total && elapsed > 0 {
+		left := time.Duration(float64(elapsed) * float64(total-written) / float64(written))
+		line += fmt.Sprintf(", %s left", left.Round(time.Second))
+	}
+	return line
+}
+
+// extractTarGz streams the named file out of the gzipped tarball into dst.
+func extractTarGz(archive io.Reader, name string, dst io.Writer) error {
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return xerrors.Errorf("%s not found in archive", name)
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg && filepath.Base(hdr.Name) == name {
+			_, err := io.Copy(dst, tr)
+			return err
+		}
+	}
+}
+
+// extractZip streams the named file out of the zip archive into dst.
+// Zip archives are read from their end, so it needs a file.
+func extractZip(archive *os.File, name string, dst io.Writer) error {
+	info, err := archive.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(archive, info.Size())
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if f.Mode().IsRegular() && filepath.Base(f.Name) == name {
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			_, err = io.Copy(dst, rc)
+			return err
+		}
+	}
+	return xerrors.Errorf("%s not found in archive", name)
+}
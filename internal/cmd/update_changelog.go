@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/version"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+func changelogCmd() *cobra.Command {
+	var since string
+	cmd := &cobra.Command{
+		Use:   "changelog [version]",
+		Short: "Show the release notes of a coder version",
+		Long: "Show the release notes of a coder version, the running one by default, from its GitHub release.\n\n" +
+			"With --since, the notes of every release after that version, up to the given one, are shown, newest first.",
+		Args: cobra.MaximumNArgs(1),
+		Example: `coder changelog
+coder changelog v1.22.0
+
+# everything that changed between two versions
+coder changelog --since v1.21.0 v1.22.0`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			target := version.Version
+			if len(args) > 0 {
+				target = args[0]
+			}
+			if !version.Valid(target) {
+				return xerrors.Errorf("invalid version %q", target)
+			}
+			if since != "" && !version.Valid(since) {
+				return xerrors.Errorf("invalid --since version %q", since)
+			}
+			releases, err := fetchChangelog(ctx, since, "v"+strings.TrimPrefix(target, "v"))
+			if err != nil {
+				return err
+			}
+			return writeChangelog(cmd.OutOrStdout(), releases)
+		},
+	}
+	cmd.Flags().StringVar(&since, "since", "", "show the notes of every release after this version")
+	return cmd
+}
+
+// writeUpdateChangelog writes the release notes of the versions after the
+// running one, up to targetVersion. Failing to get them doesn't stop the
+// update, such as where github.com can't be reached.
+func writeUpdateChangelog(ctx context.Context, w io.Writer, hc *http.Client, targetVersion string) {
+	if version.Compare(targetVersion, version.Version) < 0 {
+		clog.LogInfo(i18n.Sprintf("%s is older than the running version, so there are no release notes to show", targetVersion))
+		return
+	}
+	releases, err := releaseNotes(ctx, hc, releasesAPIURL, version.Version, targetVersion)
+	if err == nil {
+		err = writeChangelog(w, releases)
+	}
+	if err != nil {
+		clog.LogWarn("failed to show the release notes", clog.Causef(err.Error()))
+	}
+}
+
+// fetchChangelog lists the releases of coder-cli after from and up to to.
+// Only the release of to is listed if from is "".
+func fetchChangelog(ctx context.Context, from, to string) ([]githubRelease, error) {
+	hc, err := newHTTPClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return releaseNotes(ctx, hc, releasesAPIURL, from, to)
+}
+
+func releaseNotes(ctx context.Context, hc *http.Client, apiURL, from, to string) ([]githubRelease, error) {
+	releases, err := listReleases(ctx, hc, apiURL)
+	if err != nil {
+		return nil, err
+	}
+	if from == "" {
+		for _, r := range releases {
+			if !r.Draft && version.Compare(r.TagName, to) == 0 {
+				return []githubRelease{r}, nil
+			}
+		}
+		return nil, xerrors.Errorf("no release notes found for %s", to)
+	}
+	return changelog(releases, from, to), nil
+}
+
+// changelog returns the releases after from, up to and including to, newest
+// first. Pre-releases are only included when updating to one, since their
+// notes are repeated in the release that follows them. When from isn't a
+// version, such as for development builds, only to is included.
+func changelog(releases []githubRelease, from, to string) []githubRelease {
+	var notes []githubRelease
+	for _, r := range releases {
+		switch {
+		case r.Draft:
+		case version.Prerelease(r.TagName) != "" && version.Prerelease(to) == "":
+		case !version.Valid(from) && version.Compare(r.TagName, to) != 0:
+		case version.Compare(r.TagName, from) > 0 && version.Compare(r.TagName, to) <= 0:
+			notes = append(notes, r)
+		}
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		return version.Compare(notes[i].TagName, notes[j].TagName) > 0
+	})
+	return notes
+}
+
+// writeChangelog writes the notes of the releases to w, with their markdown
+// headings in bold and the rest as is.
+func writeChangelog(w io.Writer, releases []githubRelease) error {
+	if len(releases) == 0 {
+		_, err := fmt.Fprintln(w, "No release notes found.")
+		return err
+	}
+	for i, r := range releases {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		header := r.TagName
+		if !r.PublishedAt.IsZero() {
+			header += " (" + r.PublishedAt.Format("2006-01-02") + ")"
+		}
+		if _, err := fmt.Fprintln(w, clog.Bold(header)); err != nil {
+			return err
+		}
+		body := strings.TrimSpace(strings.ReplaceAll(r.Body, "\r\n", "\n"))
+		if body == "" {
+			body = "No release notes."
+		}
+		for _, line := range strings.Split(body, "\n") {
+			if heading := strings.TrimLeft(line, "#"); heading != line && strings.HasPrefix(heading, " ") {
+				line = clog.Bold(strings.TrimSpace(heading))
+			}
+			if _, err := fmt.Fprintln(w, "  "+line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_changelog(t *testing.T) {
+	t.Parallel()
+
+	releases := []githubRelease{
+		{TagName: "v1.23.0-beta.1", Prerelease: true},
+		{TagName: "v1.22.1"},
+		{TagName: "v1.23.0", Draft: true},
+		{TagName: "v1.21.0"},
+		{TagName: "v1.22.0"},
+		{TagName: "v1.22.0-rc.1", Prerelease: true},
+		{TagName: "v1.20.0"},
+	}
+	tags := func(releases []githubRelease) []string {
+		tags := make([]string, 0, len(releases))
+		for _, r := range releases {
+			tags = append(tags, r.TagName)
+		}
+		return tags
+	}
+
+	assert.Equal(t, "releases since, newest first", []string{"v1.22.1", "v1.22.0"}, tags(changelog(releases, "v1.21.0", "v1.22.1")))
+	assert.Equal(t, "pre-releases when updating to one", []string{"v1.23.0-beta.1", "v1.22.1"}, tags(changelog(releases, "v1.22.0", "v1.23.0-beta.1")))
+	assert.Equal(t, "development build", []string{"v1.22.0"}, tags(changelog(releases, "unknown", "v1.22.0")))
+	assert.Equal(t, "drafts left out", 0, len(changelog(releases, "v1.22.1", "v1.23.0")))
+}
+
+func Test_releaseNotes(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[
+			{"tag_name": "v1.22.0", "published_at": "2021-05-04T10:00:00Z", "body": "## Features\r\n- coder port-forward"},
+			{"tag_name": "v1.21.0", "body": ""}
+		]`))
+	}))
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+
+	releases, err := releaseNotes(ctx, srv.Client(), srv.URL, "", "v1.22.0")
+	assert.Success(t, "single release", err)
+	var out bytes.Buffer
+	assert.Success(t, "write", writeChangelog(&out, releases))
+	assert.True(t, "header", strings.Contains(out.String(), "v1.22.0 (2021-05-04)\n"))
+	assert.True(t, "heading", strings.Contains(out.String(), "  Features\n"))
+	assert.True(t, "body", strings.Contains(out.String(), "  - coder port-forward\n"))
+
+	releases, err = releaseNotes(ctx, srv.Client(), srv.URL, "v1.20.0", "v1.22.0")
+	assert.Success(t, "range", err)
+	out.Reset()
+	assert.Success(t, "write", writeChangelog(&out, releases))
+	assert.True(t, "empty notes", strings.Contains(out.String(), "v1.21.0\n  No release notes.\n"))
+
+	_, err = releaseNotes(ctx, srv.Client(), srv.URL, "", "v1.19.0")
+	assert.ErrorContains(t, "unknown release", err, "no release notes found for v1.19.0")
+}
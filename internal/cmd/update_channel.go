@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/version"
+)
+
+// releasesAPIURL lists the GitHub releases of coder-cli.
+const releasesAPIURL = "https://api.github.com/repos/cdr/coder-cli/releases"
+
+// updateChannels are the release channels "coder update --channel" tracks,
+// from the least to the most frequently released.
+var updateChannels = []string{"stable", "beta", "nightly"}
+
+type githubRelease struct {
+	TagName     string    `json:"tag_name"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+	Body        string    `json:"body"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// inChannel reports whether the release is published to the channel. Each
+// channel also carries the releases of the channels before it, so that
+// trackers of pre-releases get the release that follows them.
+func (r githubRelease) inChannel(channel string) bool {
+	if r.Draft {
+		return false
+	}
+	prerelease := version.Prerelease(r.TagName)
+	if !r.Prerelease && prerelease == "" {
+		return true
+	}
+	switch channel {
+	case "beta":
+		return strings.HasPrefix(prerelease, "beta") || strings.HasPrefix(prerelease, "rc")
+	case "nightly":
+		return true
+	}
+	return false
+}
+
+func validateUpdateChannel(_ context.Context, channel string) error {
+	for _, c := range updateChannels {
+		if c == channel {
+			return nil
+		}
+	}
+	return xerrors.Errorf("invalid channel %q: must be one of %s", channel, strings.Join(updateChannels, ", "))
+}
+
+// channelVersion returns the newest version released to the channel.
+func channelVersion(ctx context.Context, hc *http.Client, apiURL, channel string) (string, error) {
+	if err := validateUpdateChannel(ctx, channel); err != nil {
+		return "", err
+	}
+	releases, err := listReleases(ctx, hc, apiURL)
+	if err != nil {
+		return "", err
+	}
+
+	var newest string
+	for _, r := range releases {
+		if r.inChannel(channel) && (newest == "" || version.Compare(r.TagName, newest) > 0) {
+			newest = r.TagName
+		}
+	}
+	if newest == "" {
+		return "", xerrors.Errorf("no releases found in the %s channel", channel)
+	}
+	return newest, nil
+}
+
+// listReleases lists the newest 100 releases with the GitHub API.
+func listReleases(ctx context.Context, hc *http.Client, apiURL string) ([]githubRelease, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL+"?per_page=100", nil)
+	if err != nil {
+		return nil, xerrors.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("list releases: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("list releases: unexpected status %s", resp.Status)
+	}
+	var releases []githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, xerrors.Errorf("decode releases: %w", err)
+	}
+	return releases, nil
+}
+
+// updateChannel returns the channel set with "coder config set update-channel",
+// or "" if none is set.
+func updateChannel() (string, error) {
+	channel, err := config.UpdateChannel.Read()
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", xerrors.Errorf("read update channel: %w", err)
+	}
+	return strings.TrimSpace(channel), nil
+}
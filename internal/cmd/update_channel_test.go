@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_channelVersion(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Listed newest first, like the GitHub API, except that a patch
+		// release of an older minor version came out last.
+		_, _ = w.Write([]byte(`[
+			{"tag_name": "v1.21.4"},
+			{"tag_name": "v1.23.0-nightly.20261014", "prerelease": true},
+			{"tag_name": "v1.23.0-beta.1", "prerelease": true, "draft": true},
+			{"tag_name": "v1.22.0-rc.2", "prerelease": true},
+			{"tag_name": "v1.22.0-beta.11", "prerelease": true},
+			{"tag_name": "v1.22.0-beta.2", "prerelease": true},
+			{"tag_name": "v1.21.3"}
+		]`))
+	}))
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+
+	for channel, want := range map[string]string{
+		"stable":  "v1.21.4",
+		"beta":    "v1.22.0-rc.2",
+		"nightly": "v1.23.0-nightly.20261014",
+	} {
+		got, err := channelVersion(ctx, srv.Client(), srv.URL, channel)
+		assert.Success(t, channel, err)
+		assert.Equal(t, channel, want, got)
+	}
+
+	_, err := channelVersion(ctx, srv.Client(), srv.URL, "canary")
+	assert.ErrorContains(t, "unknown channel", err, "must be one of stable, beta, nightly")
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// rolloutVersion returns the CLI version offered to the authenticated user by
+// the staged rollout of the deployment, or apiVersion when no rollout is
+// published. Deployments that don't support staged rollouts are treated as
+// having none.
+func rolloutVersion(ctx context.Context, client coder.Client, apiVersion string) string {
+	rollout, err := client.SiteConfigCLIRollout(ctx)
+	if err != nil || rollout.Version == "" {
+		return apiVersion
+	}
+	if rollout.Percent >= 100 {
+		return rollout.Version
+	}
+	if me, err := client.Me(ctx); err == nil && rolloutBucket(me.ID, rollout.Version) < rollout.Percent {
+		return rollout.Version
+	}
+	if rollout.PreviousVersion != "" {
+		return rollout.PreviousVersion
+	}
+	return apiVersion
+}
+
+// rolloutBucket places the user in one of 100 buckets for the rollout of the
+// version. Users in buckets below the rollout percentage are offered the
+// version, so raising the percentage keeps the users already offered it, and
+// each version is rolled out to a different first group of users.
+func rolloutBucket(userID, version string) int {
+	sum := sha256.Sum256([]byte(userID + "\n" + strings.TrimPrefix(version, "v")))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
+
+func updateRolloutCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollout",
+		Short: "Stage the CLI version offered by \"coder update\" (site admin only)",
+		Long: "Publish the CLI version \"coder update\" and the version check offer to a percentage of users, " +
+			"so a new CLI version can be rolled out across the organization in stages. " +
+			"Users are offered the version of the deployment when no rollout is published.",
+	}
+	cmd.AddCommand(showUpdateRolloutCmd(), setUpdateRolloutCmd())
+	return cmd
+}
+
+func showUpdateRolloutCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "show",
+		Short:   "Show the published CLI rollout",
+		Example: `coder update rollout show`,
+		Args:    xcobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			client, err := newClient(ctx, false)
+			if err != nil {
+				return err
+			}
+			rollout, err := client.SiteConfigCLIRollout(ctx)
+			if err != nil {
+				return xerrors.Errorf("get CLI rollout: %w", err)
+			}
+			return writeOutput(cmd.OutOrStdout(), rollout, func() error {
+				if rollout.Version == "" {
+					clog.LogInfo("no CLI rollout is published, users are offered the version of the deployment")
+					return nil
+				}
+				previous := rollout.PreviousVersion
+				if previous == "" {
+					previous = "the version of the deployment"
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "version %s is offered to %d%% of users, others are offered %s\n", rollout.Version, rollout.Percent, previous)
+				return nil
+			})
+		},
+	}
+	addOutputFlag(cmd)
+	return cmd
+}
+
+func setUpdateRolloutCmd() *cobra.Command {
+	var rollout coder.ConfigCLIRollout
+	cmd := &cobra.Command{
+		Use:   "set --version [version] --percent [percent]",
+		Short: "Publish a CLI version to a percentage of users",
+		Example: `# offer 1.22.0 to a tenth of users, and 1.21.3 to the others
+coder update rollout set --version 1.22.0 --percent 10 --previous 1.21.3
+
+# complete the rollout
+coder update rollout set --version 1.22.0 --percent 100
+
+# stop the rollout, offering the version of the deployment again
+coder update rollout set --version "" --percent 0`,
+		Args: xcobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if rollout.Percent < 0 || rollout.Percent > 100 {
+				return xerrors.Errorf("invalid --percent %d: must be from 0 to 100", rollout.Percent)
+			}
+			rollout.Version = strings.TrimPrefix(rollout.Version, "v")
+			rollout.PreviousVersion = strings.TrimPrefix(rollout.PreviousVersion, "v")
+			client, err := newClient(ctx, false)
+			if err != nil {
+				return err
+			}
+			if err := client.PutSiteConfigCLIRollout(ctx, rollout); err != nil {
+				return xerrors.Errorf("set CLI rollout: %w", err)
+			}
+			if rollout.Version == "" {
+				clog.LogSuccess("stopped the CLI rollout")
+				return nil
+			}
+			clog.LogSuccess(i18n.Sprintf("offering version %s to %d%% of users", rollout.Version, rollout.Percent))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&rollout.Version, "version", "", "the CLI version to roll out, empty to stop the rollout")
+	cmd.Flags().IntVar(&rollout.Percent, "percent", 0, "the percentage of users offered the version, from 0 to 100")
+	cmd.Flags().StringVar(&rollout.PreviousVersion, "previous", "", "the version offered to the other users, instead of the version of the deployment")
+	_ = cmd.MarkFlagRequired("version")
+	_ = cmd.MarkFlagRequired("percent")
+	requireRoles(cmd, coder.SiteAdmin)
+	return cmd
+}
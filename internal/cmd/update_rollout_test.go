@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_rolloutBucket(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "stable", rolloutBucket("user-1", "1.22.0"), rolloutBucket("user-1", "v1.22.0"))
+
+	offered := 0
+	for i := 0; i < 1000; i++ {
+		if rolloutBucket(fmt.Sprintf("user-%d", i), "1.22.0") < 10 {
+			offered++
+		}
+	}
+	assert.True(t, "about a tenth of users", offered > 50 && offered < 150)
+}
+
+func Test_rolloutVersion(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fake := codertest.New()
+
+	assert.Equal(t, "no rollout", "1.21.0", rolloutVersion(ctx, fake, "1.21.0"))
+
+	assert.Success(t, "put", fake.PutSiteConfigCLIRollout(ctx, coder.ConfigCLIRollout{Version: "1.22.0", Percent: 100}))
+	assert.Equal(t, "complete rollout", "1.22.0", rolloutVersion(ctx, fake, "1.21.0"))
+
+	assert.Success(t, "put", fake.PutSiteConfigCLIRollout(ctx, coder.ConfigCLIRollout{Version: "1.22.0", Percent: 0, PreviousVersion: "1.21.3"}))
+	assert.Equal(t, "previous version", "1.21.3", rolloutVersion(ctx, fake, "1.22.0"))
+
+	bucket := rolloutBucket(fake.MeID(), "1.22.0")
+	assert.Success(t, "put", fake.PutSiteConfigCLIRollout(ctx, coder.ConfigCLIRollout{Version: "1.22.0", Percent: bucket + 1}))
+	assert.Equal(t, "in rollout", "1.22.0", rolloutVersion(ctx, fake, "1.21.0"))
+	assert.Success(t, "put", fake.PutSiteConfigCLIRollout(ctx, coder.ConfigCLIRollout{Version: "1.22.0", Percent: bucket}))
+	assert.Equal(t, "outside rollout", "1.21.0", rolloutVersion(ctx, fake, "1.21.0"))
+}
+
+func Test_updateRollout(t *testing.T) {
+	fake := codertest.New()
+	roles := []coder.Role{coder.SiteAdmin}
+	assert.Success(t, "make admin", fake.UpdateUser(context.Background(), coder.Me, coder.UpdateUserReq{Roles: &roles}))
+	useFakeClient(t, fake)
+
+	res := execute(t, nil, "update", "rollout", "set", "--version", "v1.22.0", "--percent", "101")
+	res.error(t)
+	res.stderrContains(t, "must be from 0 to 100")
+
+	res = execute(t, nil, "update", "rollout", "set", "--version", "v1.22.0", "--percent", "25")
+	res.success(t)
+	rollout, err := fake.SiteConfigCLIRollout(context.Background())
+	assert.Success(t, "get rollout", err)
+	assert.Equal(t, "stored", coder.ConfigCLIRollout{Version: "1.22.0", Percent: 25}, *rollout)
+
+	res = execute(t, nil, "update", "rollout", "show")
+	res.success(t)
+	res.stdoutContains(t, "version 1.22.0 is offered to 25% of users")
+}
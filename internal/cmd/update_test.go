@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_updater(t *testing.T) {
+	t.Parallel()
+
+	// Each release is published with checksums, except for v1.20.0, and
+	// v1.19.0 has the checksums of other archives. The binary of v1.17.0
+	// fails to run.
+	archives := map[string][]byte{}
+	for _, v := range []string{"v1.21.0", "v1.20.0", "v1.19.0", "v1.17.0"} {
+		binary := fakeBinary(v)
+		if v == "v1.17.0" {
+			binary = []byte("#!/bin/sh\nexit 1\n")
+		}
+		tarGz, zipped := tarGzArchive(t, "coder", binary), zipArchive(t, "coder.exe", binary)
+		archives["/"+v+"/coder-cli-linux-amd64.tar.gz"] = tarGz
+		archives["/"+v+"/coder-cli-windows.zip"] = zipped
+		switch v {
+		case "v1.20.0":
+		case "v1.19.0":
+			archives["/"+v+"/SHA256SUMS"] = checksums(map[string][]byte{"coder-cli-linux-amd64.tar.gz": zipped, "coder-cli-windows.zip": tarGz})
+		default:
+			archives["/"+v+"/SHA256SUMS"] = checksums(map[string][]byte{"coder-cli-linux-amd64.tar.gz": tarGz, "coder-cli-windows.zip": zipped})
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		archive, ok := archives[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(archive)
+	}))
+	t.Cleanup(srv.Close)
+
+	// Not parallel: running a binary while another subtest writes one can
+	// fail with ETXTBSY, as the writer's fd leaks into the forked process.
+	for _, goos := range []string{"linux", "windows"} {
+		goos := goos
+		t.Run(goos, func(t *testing.T) {
+			ctx := context.Background()
+			dir, err := ioutil.TempDir("", "coder-update")
+			assert.Success(t, "create temp dir", err)
+			t.Cleanup(func() { _ = os.RemoveAll(dir) })
+			exe := filepath.Join(dir, "coder")
+			oldBinary := fakeBinary("v1.18.0")
+			assert.Success(t, "write old binary", ioutil.WriteFile(exe, oldBinary, 0755))
+			binaryIs := func(name string, want []byte) {
+				t.Helper()
+				got, err := ioutil.ReadFile(exe)
+				assert.Success(t, "read binary", err)
+				assert.Equal(t, name, want, got)
+			}
+
+			u := &updater{
+				httpClient: srv.Client(),
+				baseURL:    srv.URL,
+				goos:       goos,
+				goarch:     "amd64",
+				executable: exe,
+			}
+			assert.Success(t, "update", u.update(ctx, "v1.21.0"))
+			binaryIs("binary replaced", fakeBinary("v1.21.0"))
+
+			entries, err := ioutil.ReadDir(dir)
+			assert.Success(t, "read dir", err)
+			assert.Equal(t, "only the previous binary is left", 2, len(entries))
+
+			previous, err := u.rollback(ctx)
+			assert.Success(t, "rollback", err)
+			assert.Equal(t, "previous version", "v1.18.0", previous)
+			binaryIs("binary restored", oldBinary)
+			_, err = u.rollback(ctx)
+			assert.ErrorContains(t, "nothing to roll back", err, "no previous binary")
+
+			assert.Error(t, "missing release", u.update(ctx, "v0.0.1"))
+			err = u.update(ctx, "v1.19.0")
+			assert.ErrorContains(t, "checksum mismatch", err, "checksum mismatch")
+			err = u.update(ctx, "v1.20.0")
+			assert.ErrorContains(t, "no checksums", err, "no checksums are published")
+			err = u.update(ctx, "v1.17.0")
+			assert.ErrorContains(t, "self-check", err, "failed its self-check")
+			binaryIs("binary kept", oldBinary)
+
+			u.skipChecksum = true
+			assert.Success(t, "update without checksums", u.update(ctx, "v1.20.0"))
+			u.skipChecksum = false
+
+			// Deployments serve the release of their version without a
+			// directory per version, and might publish no checksums, which
+			// is only updated from with --skip-checksum.
+			u.flat, u.baseURL = true, srv.URL+"/v1.19.0"
+			err = u.update(ctx, "v1.19.0")
+			assert.ErrorContains(t, "deployment checksum mismatch", err, "checksum mismatch")
+			u.baseURL = srv.URL + "/v1.20.0"
+			err = u.update(ctx, "v1.20.0")
+			assert.ErrorContains(t, "deployment without checksums", err, "the deployment publishes no checksums")
+			u.skipChecksum = true
+			assert.Success(t, "update from a deployment without checksums", u.update(ctx, "v1.20.0"))
+			u.flat, u.baseURL, u.skipChecksum = false, srv.URL, false
+
+			// A release archive copied to disk, with or without its
+			// checksums next to it.
+			archiveName, _ := releaseAsset(goos, "amd64")
+			archiveDir := t.TempDir()
+			archivePath := filepath.Join(archiveDir, archiveName)
+			assert.Success(t, "write archive", ioutil.WriteFile(archivePath, archives["/v1.21.0/"+archiveName], 0600))
+			_, err = u.updateFromFile(ctx, archivePath)
+			assert.ErrorContains(t, "no checksums file", err, "no SHA256SUMS next to")
+			assert.Success(t, "write checksums", ioutil.WriteFile(filepath.Join(archiveDir, "SHA256SUMS"), archives["/v1.19.0/SHA256SUMS"], 0600))
+			_, err = u.updateFromFile(ctx, archivePath)
+			assert.ErrorContains(t, "checksum mismatch", err, "checksum mismatch")
+			assert.Success(t, "write checksums", ioutil.WriteFile(filepath.Join(archiveDir, "SHA256SUMS"), archives["/v1.21.0/SHA256SUMS"], 0600))
+			newVersion, err := u.updateFromFile(ctx, archivePath)
+			assert.Success(t, "update from file", err)
+			assert.Equal(t, "new version", "v1.21.0", newVersion)
+			binaryIs("binary replaced from file", fakeBinary("v1.21.0"))
+		})
+	}
+}
+
+func Test_updateBaseURL(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		flag, env string
+		want      string
+		err       string
+	}{
+		{want: releasesURL},
+		{env: "https://mirror.example.com/coder/", want: "https://mirror.example.com/coder"},
+		{flag: "http://flag.example.com", env: "https://env.example.com", want: "http://flag.example.com"},
+		{flag: "/srv/releases", err: "invalid mirror URL"},
+		{env: "ftp://mirror.example.com", err: "invalid mirror URL"},
+	} {
+		got, err := updateBaseURL(tc.flag, tc.env)
+		if tc.err != "" {
+			assert.ErrorContains(t, tc.flag+tc.env, err, tc.err)
+			continue
+		}
+		assert.Success(t, tc.flag+tc.env, err)
+		assert.Equal(t, tc.flag+tc.env, tc.want, got)
+	}
+}
+
+func Test_downloadProgressLine(t *testing.T) {
+	t.Parallel()
+
+	const name = "coder-cli-linux-amd64.tar.gz"
+	for _, tc := range []struct {
+		written, total int64
+		elapsed        time.Duration
+		want           string
+	}{
+		{want: "downloading " + name + " -- 0 B"},
+		{written: 3 << 20, total: -1, elapsed: time.Second, want: "downloading " + name + " -- 3.0 MiB"},
+		{written: 0, total: 8 << 20, want: "downloading " + name + " -- 0 B / 8.0 MiB"},
+		{written: 2 << 20, total: 8 << 20, elapsed: 2 * time.Second, want: "downloading " + name + " -- 2.0 MiB / 8.0 MiB, 6s left"},
+		{written: 8 << 20, total: 8 << 20, elapsed: 8 * time.Second, want: "downloading " + name + " -- 8.0 MiB / 8.0 MiB"},
+	} {
+		assert.Equal(t, tc.want, tc.want, downloadProgressLine(name, tc.written, tc.total, tc.elapsed))
+	}
+}
+
+func Test_updateSource(t *testing.T) {
+	t.Parallel()
+
+	base, err := url.Parse("https://coder.example.com/root/")
+	assert.Success(t, "parse URL", err)
+	assert.Equal(t, "deployment bin URL", "https://coder.example.com/root/bin", deploymentBinURL(*base))
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	ctx := context.Background()
+	assert.True(t, "any response", reachable(ctx, srv.Client(), srv.URL))
+	srv.Close()
+	assert.False(t, "no response", reachable(ctx, srv.Client(), srv.URL))
+}
+
+// fakeBinary returns a script answering --version like coder.
+func fakeBinary(version string) []byte {
+	return []byte("#!/bin/sh\necho coder version " + version + " go1.16.3 linux/amd64\n")
+}
+
+// checksums returns the output of sha256sum for the files.
+func checksums(files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	for name, content := range files {
+		fmt.Fprintf(&buf, "%x  %s\n", sha256.Sum256(content), name)
+	}
+	return buf.Bytes()
+}
+
+func tarGzArchive(t *testing.T, name string, content []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	assert.Success(t, "write header", tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+	_, err := tw.Write(content)
+	assert.Success(t, "write content", err)
+	assert.Success(t, "close tar", tw.Close())
+	assert.Success(t, "close gzip", gz.Close())
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, name string, content []byte) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(name)
+	assert.Success(t, "create entry", err)
+	_, err = w.Write(content)
+	assert.Success(t, "write content", err)
+	assert.Success(t, "close zip", zw.Close())
+	return buf.Bytes()
+}
+
+// Not parallel: running a binary while another test writes one can fail with
+// ETXTBSY, as the writer's fd leaks into the forked process.
+func Test_updaterMoveAside(t *testing.T) {
+	ctx := context.Background()
+	archive := tarGzArchive(t, "coder", fakeBinary("v1.21.0"))
+	archives := map[string][]byte{
+		"/v1.21.0/coder-cli-linux-amd64.tar.gz": archive,
+		"/v1.21.0/SHA256SUMS":                   checksums(map[string][]byte{"coder-cli-linux-amd64.tar.gz": archive}),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		archive, ok := archives[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(archive)
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "coder")
+	oldBinary := fakeBinary("v1.18.0")
+	binaryIs := func(name string, want []byte) {
+		t.Helper()
+		got, err := ioutil.ReadFile(exe)
+		assert.Success(t, "read binary", err)
+		assert.Equal(t, name, want, got)
+	}
+	newUpdater := func() *updater {
+		return &updater{
+			httpClient: srv.Client(),
+			baseURL:    srv.URL,
+			goos:       "linux",
+			goarch:     "amd64",
+			executable: exe,
+			moveAside:  true,
+		}
+	}
+
+	assert.Success(t, "write old binary", ioutil.WriteFile(exe, oldBinary, 0755))
+	u := newUpdater()
+	assert.Success(t, "update", u.update(ctx, "v1.21.0"))
+	assert.False(t, "staged", u.staged)
+	binaryIs("binary replaced", fakeBinary("v1.21.0"))
+
+	_, err := u.rollback(ctx)
+	assert.Success(t, "rollback", err)
+	binaryIs("binary restored", oldBinary)
+	_, err = os.Stat(replacedBinary(exe))
+	assert.True(t, "replaced binary removed", os.IsNotExist(err))
+
+	// A previous binary that can't be removed, like one that still runs on
+	// Windows, stages the update instead.
+	previous := previousBinary(exe)
+	assert.Success(t, "make previous binary unremovable", os.MkdirAll(filepath.Join(previous, "busy"), 0750))
+	u = newUpdater()
+	assert.Success(t, "update", u.update(ctx, "v1.21.0"))
+	assert.True(t, "staged", u.staged)
+	binaryIs("binary kept", oldBinary)
+
+	assert.Success(t, "apply blocked staged update", applyStagedUpdate(exe))
+	binaryIs("binary still kept", oldBinary)
+	assert.Success(t, "free previous binary", os.RemoveAll(previous))
+	assert.Success(t, "apply staged update", applyStagedUpdate(exe))
+	binaryIs("binary replaced on next run", fakeBinary("v1.21.0"))
+	_, err = os.Stat(stagedBinary(exe))
+	assert.True(t, "staged binary moved", os.IsNotExist(err))
+}
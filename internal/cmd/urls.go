@@ -2,8 +2,6 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -12,13 +10,15 @@ import (
 	"golang.org/x/xerrors"
 
 	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/internal/x/xcobra"
 	"cdr.dev/coder-cli/pkg/clog"
-	"cdr.dev/coder-cli/pkg/tablewriter"
 )
 
 func urlCmd() *cobra.Command {
-	var outputFmt string
+	var (
+		copyURLs bool
+	)
 	cmd := &cobra.Command{
 		Use:   "urls",
 		Short: "Interact with workspace DevURLs",
@@ -26,17 +26,25 @@ func urlCmd() *cobra.Command {
 	lsCmd := &cobra.Command{
 		Use:   "ls [workspace_name]",
 		Short: "List all DevURLs for a workspace",
-		Args:  xcobra.ExactArgs(1),
-		RunE:  listDevURLsCmd(&outputFmt),
+		Example: `coder urls ls my-workspace
+
+# copy the DevURLs to the clipboard
+coder urls ls my-workspace --copy`,
+		Args: xcobra.ExactArgs(1),
+		RunE: listDevURLsCmd(&copyURLs),
 	}
-	lsCmd.Flags().StringVarP(&outputFmt, "output", "o", humanOutput, "human|json")
+	addOutputShorthand(lsCmd)
+	lsCmd.Flags().BoolVar(&copyURLs, "copy", false, "copy the DevURLs to the clipboard, one per line")
+	docsSamples(lsCmd, "urls ls backend")
 
 	rmCmd := &cobra.Command{
-		Use:   "rm [workspace_name] [port]",
-		Args:  cobra.ExactArgs(2),
-		Short: "Remove a dev url",
-		RunE:  removeDevURL,
+		Use:     "rm [workspace_name] [port]",
+		Args:    cobra.ExactArgs(2),
+		Short:   "Remove a dev url",
+		Example: `coder urls rm my-workspace 8080`,
+		RunE:    removeDevURL,
 	}
+	keepExamples(rmCmd)
 
 	cmd.AddCommand(
 		lsCmd,
@@ -78,7 +86,7 @@ func accessLevelIsValid(level string) bool {
 
 // Run gets the list of active devURLs from the cemanager for the
 // specified workspace and outputs info to stdout.
-func listDevURLsCmd(outputFmt *string) func(cmd *cobra.Command, args []string) error {
+func listDevURLsCmd(copyURLs *bool) func(cmd *cobra.Command, args []string) error {
 	return func(cmd *cobra.Command, args []string) error {
 		ctx := cmd.Context()
 		client, err := newClient(ctx, true)
@@ -92,24 +100,29 @@ func listDevURLsCmd(outputFmt *string) func(cmd *cobra.Command, args []string) e
 			return err
 		}
 
-		switch *outputFmt {
-		case humanOutput:
+		err = writeOutput(cmd.OutOrStdout(), devURLs, func() error {
 			if len(devURLs) < 1 {
-				clog.LogInfo(fmt.Sprintf("no devURLs found for workspace %q", workspaceName))
+				clog.LogInfo(i18n.Sprintf("no devURLs found for workspace %q", workspaceName))
 				return nil
 			}
-			err := tablewriter.WriteTable(cmd.OutOrStdout(), len(devURLs), func(i int) interface{} {
+			err := writeTable(cmd.OutOrStdout(), len(devURLs), func(i int) interface{} {
 				return devURLs[i]
 			})
 			if err != nil {
 				return xerrors.Errorf("write table: %w", err)
 			}
-		case jsonOutput:
-			if err := json.NewEncoder(cmd.OutOrStdout()).Encode(devURLs); err != nil {
-				return xerrors.Errorf("encode DevURLs as json: %w", err)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if *copyURLs && len(devURLs) > 0 {
+			urls := make([]string, 0, len(devURLs))
+			for _, u := range devURLs {
+				urls = append(urls, u.URL)
 			}
-		default:
-			return xerrors.Errorf("unknown --output value %q", *outputFmt)
+			copyToClipboard(ctx, strings.Join(urls, "\n"), "DevURLs")
 		}
 		return nil
 	}
@@ -174,7 +187,7 @@ func createDevURLCmd() *cobra.Command {
 				if err != nil {
 					return xerrors.Errorf("update DevURL: %w", err)
 				}
-				clog.LogSuccess(fmt.Sprintf("patched devurl for port %s", port))
+				clog.LogSuccess(i18n.Sprintf("patched devurl for port %s", port))
 			} else {
 				err := client.CreateDevURL(ctx, workspace.ID, coder.CreateDevURLReq{
 					Port:        portNum,
@@ -186,7 +199,7 @@ func createDevURLCmd() *cobra.Command {
 				if err != nil {
 					return xerrors.Errorf("insert DevURL: %w", err)
 				}
-				clog.LogSuccess(fmt.Sprintf("created devurl for port %s", port))
+				clog.LogSuccess(i18n.Sprintf("created devurl for port %s", port))
 			}
 			return nil
 		},
@@ -195,6 +208,8 @@ func createDevURLCmd() *cobra.Command {
 	cmd.Flags().StringVar(&access, "access", "private", "Set DevURL access to [private | org | authed | public]")
 	cmd.Flags().StringVar(&urlname, "name", "", "DevURL name")
 	cmd.Flags().StringVar(&scheme, "scheme", "http", "Server scheme (http|https)")
+	completeFlagChoices(cmd, "access", "private", "org", "authed", "public")
+	completeFlagChoices(cmd, "scheme", "http", "https")
 	return cmd
 }
 
@@ -249,7 +264,7 @@ func removeDevURL(cmd *cobra.Command, args []string) error {
 
 	urlID, found := devURLID(portNum, urls)
 	if found {
-		clog.LogInfo(fmt.Sprintf("deleting devurl for port %v", port))
+		clog.LogInfo(i18n.Sprintf("deleting devurl for port %v", port))
 	} else {
 		return xerrors.Errorf("No devurl found for port %v", port)
 	}
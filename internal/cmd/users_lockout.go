@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// Actions of incident records.
+const (
+	incidentSuspendUser      = "suspend_user"
+	incidentRevokeToken      = "revoke_token"
+	incidentRotateAgentToken = "rotate_agent_token"
+)
+
+// incidentRecord records an action taken in response to an incident, such as
+// revoking a token, for its audit trail.
+type incidentRecord struct {
+	Action string    `json:"action" table:"Action"`
+	User   string    `json:"user"   table:"User"`
+	Target string    `json:"target" table:"Target"`
+	Actor  string    `json:"actor"  table:"-"`
+	At     time.Time `json:"at"     table:"-"`
+	OK     bool      `json:"ok"     table:"OK"`
+	Error  string    `json:"error,omitempty" table:"Error"`
+}
+
+func newIncidentRecord(actor, user *coder.User, action, target string, err error) incidentRecord {
+	r := incidentRecord{
+		Action: action,
+		User:   user.Email,
+		Target: target,
+		Actor:  actor.Email,
+		At:     time.Now().UTC(),
+		OK:     err == nil,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+func writeIncidentRecords(w io.Writer, records []incidentRecord) error {
+	return writeOutput(w, records, func() error {
+		if len(records) == 0 {
+			return nil
+		}
+		err := writeTable(w, len(records), func(i int) interface{} {
+			return records[i]
+		})
+		if err != nil {
+			return xerrors.Errorf("write table: %w", err)
+		}
+		return nil
+	})
+}
+
+// incidentRecordsError returns an error if any of the actions failed.
+func incidentRecordsError(records []incidentRecord) error {
+	var failed int
+	for _, r := range records {
+		if !r.OK {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return clog.Fatal(i18n.Sprintf("%d of %d actions failed", failed, len(records)),
+		clog.BlankLine,
+		clog.Tipf("the records list the errors; run the command again to retry, completed actions are safe to repeat"),
+	)
+}
+
+// confirmIncidentAction prompts before acting, as the actions can't be
+// undone.
+func confirmIncidentAction(label, verb string) error {
+	if _, err := (&promptui.Prompt{Label: label, IsConfirm: true}).Run(); err != nil {
+		return clog.Fatal(
+			"failed to confirm prompt", clog.BlankLine,
+			clog.Tipf(`use "--force" to %s without a confirmation prompt`, verb),
+		)
+	}
+	return nil
+}
+
+func lockoutUserCmd() *cobra.Command {
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "lockout [user_email]",
+		Short: "suspend a user, revoke their API tokens and disconnect their workspace agents",
+		Long: "Lock a user out of the deployment in response to an incident, such as a compromised account. In order, it:\n\n" +
+			"  - suspends the user, so they can't log in or use any token,\n" +
+			"  - revokes all of their API tokens,\n" +
+			"  - rotates the agent token of each of their workspaces, which disconnects the agents, " +
+			"so that nobody can connect to the workspaces until an admin mints a new one with \"coder tokens create --for-agent\".\n\n" +
+			"It carries on past failed actions, and records each action with when and by whom it was done; " +
+			"--output json prints the records for the audit trail of the incident. Only site admins and site managers can lock users out.",
+		Example: `coder users lockout alice@corp.com
+
+coder users lockout alice@corp.com --force --output json > lockout.json`,
+		Args: xcobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			actor, err := client.Me(ctx)
+			if err != nil {
+				return xerrors.Errorf("get current user: %w", err)
+			}
+			user, err := client.UserByEmail(ctx, args[0])
+			if err != nil {
+				return xerrors.Errorf("get user: %w", err)
+			}
+			if user.ID == actor.ID {
+				return clog.Error("refusing to lock yourself out",
+					clog.BlankLine,
+					clog.Tipf("ask another site admin or site manager to run \"coder users lockout %s\"", user.Email),
+				)
+			}
+			if !force {
+				if err := confirmIncidentAction(fmt.Sprintf("Suspend %s, revoke their tokens and disconnect their agents?", user.Email), "lock out"); err != nil {
+					return err
+				}
+			}
+
+			records, err := lockoutUser(ctx, client, actor, user)
+			if werr := writeIncidentRecords(cmd.OutOrStdout(), records); werr != nil {
+				return werr
+			}
+			if err != nil {
+				return err
+			}
+			return incidentRecordsError(records)
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "lock out without showing a confirmation prompt")
+	addOutputShorthand(cmd)
+	requireRoles(cmd, coder.SiteAdmin, coder.SiteManager)
+	return cmd
+}
+
+// lockoutUser suspends the user, revokes their API tokens and rotates the
+// agent tokens of their workspaces, and returns a record of each action. The
+// user is suspended first, so that they can't mint new tokens meanwhile. It
+// returns an error if the tokens or workspaces of the user can't be listed.
+func lockoutUser(ctx context.Context, client coder.Client, actor, user *coder.User) ([]incidentRecord, error) {
+	revoked := true
+	err := client.UpdateUser(ctx, user.ID, coder.UpdateUserReq{Revoked: &revoked})
+	records := []incidentRecord{newIncidentRecord(actor, user, incidentSuspendUser, user.Email, err)}
+
+	tokens, err := client.APITokens(ctx, user.ID)
+	if err != nil {
+		return records, xerrors.Errorf("get tokens of %s: %w", user.Email, err)
+	}
+	ids := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		ids = append(ids, t.ID)
+	}
+	records = append(records, revokeAPITokens(ctx, client, actor, user, ids)...)
+
+	workspaces, err := getWorkspaces(ctx, client, user.Email)
+	if err != nil {
+		return records, xerrors.Errorf("get workspaces of %s: %w", user.Email, err)
+	}
+	for _, w := range workspaces {
+		// The new token is thrown away, so that no agent can connect.
+		_, err := client.RegenerateWorkspaceAgentToken(ctx, w.ID)
+		records = append(records, newIncidentRecord(actor, user, incidentRotateAgentToken, w.Name, err))
+	}
+	return records, nil
+}
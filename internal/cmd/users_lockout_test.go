@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_usersLockout(t *testing.T) {
+	ctx := context.Background()
+	fake := codertest.New()
+	alice := fake.AddUser(coder.User{Email: "alice@corp.com"}, fake.DefaultOrgID())
+	fake.AddWorkspace(coder.Workspace{Name: "backend", UserID: alice})
+	for _, name := range []string{"laptop", "ci"} {
+		_, err := fake.CreateAPIToken(ctx, alice, coder.CreateAPITokenReq{Name: name})
+		assert.Success(t, "create token", err)
+	}
+	useFakeClient(t, fake)
+
+	res := execute(t, nil, "users", "lockout", "alice@corp.com", "--force")
+	res.error(t)
+	res.stderrContains(t, "you need one of the site-admin or site-manager roles")
+	assert.Equal(t, "nothing done", 0, len(fake.CallsTo("UpdateUser")))
+
+	// Site managers manage users too.
+	roles := []coder.Role{coder.SiteManager}
+	assert.Success(t, "make manager", fake.UpdateUser(ctx, coder.Me, coder.UpdateUserReq{Roles: &roles}))
+	res = execute(t, nil, "users", "lockout", "alice@corp.com", "--force", "--output", "json")
+	res.success(t)
+	res.stdoutContains(t, `"action":"suspend_user"`)
+	res.stdoutContains(t, `"action":"rotate_agent_token","user":"alice@corp.com","target":"backend"`)
+
+	user, err := fake.UserByID(ctx, alice)
+	assert.Success(t, "get user", err)
+	assert.True(t, "suspended", user.Revoked)
+	tokens, err := fake.APITokens(ctx, alice)
+	assert.Success(t, "get tokens", err)
+	assert.Equal(t, "tokens revoked", 0, len(tokens))
+	assert.Equal(t, "agent token rotated", 1, len(fake.CallsTo("RegenerateWorkspaceAgentToken")))
+
+	me, err := fake.Me(ctx)
+	assert.Success(t, "get me", err)
+	res = execute(t, nil, "users", "lockout", me.Email, "--force")
+	res.error(t)
+	res.stderrContains(t, "refusing to lock yourself out")
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"cdr.dev/slog"
+	"cdr.dev/slog/sloggers/sloghuman"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+// Verbosity levels, set by repeating the global -v flag.
+const (
+	// verbosityInfo (-v) shows extra command output, such as build substages.
+	verbosityInfo = 1
+	// verbosityDebug (-vv) additionally logs every API request.
+	verbosityDebug = 2
+	// verbosityTrace (-vvv) additionally logs ICE negotiation and sync engine internals.
+	verbosityTrace = 3
+)
+
+// verbosity is a global flag for specifying how much output a command should give.
+var verbosity int
+
+// verboseAt reports whether output at the given verbosity level should be shown.
+func verboseAt(level int) bool {
+	return verbosity >= level
+}
+
+// logLevelEnv sets the levels of subsystems, like the global --log-level
+// flag.
+const logLevelEnv = "CODER_LOG_LEVEL"
+
+// logSubsystems are the subsystems --log-level sets the level of.
+var logSubsystems = []string{"ice", "sdk", "sync", "tunnel", "wsnet", "wsnet_listen"}
+
+// logLevelFlag is the value of the global --log-level flag.
+var logLevelFlag string
+
+// subsystemLevels maps the subsystems given to --log-level to their level,
+// which takes precedence over the verbosity.
+var subsystemLevels map[string]slog.Level
+
+// resolveLogLevels parses the --log-level flag, or the env variable unless
+// the flag is set.
+func resolveLogLevels(cmd *cobra.Command) error {
+	raw := logLevelFlag
+	if env := os.Getenv(logLevelEnv); env != "" && !cmd.Flags().Changed("log-level") {
+		raw = env
+	}
+	levels, err := parseLogLevels(raw)
+	if err != nil {
+		return xerrors.Errorf("invalid log level %q: %w", raw, err)
+	}
+	subsystemLevels = levels
+	return nil
+}
+
+// parseLogLevels parses comma separated subsystem=level pairs, such as
+// "wsnet=debug,sync=info".
+func parseLogLevels(raw string) (map[string]slog.Level, error) {
+	levels := map[string]slog.Level{}
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i < 0 {
+			return nil, xerrors.Errorf("%q is not subsystem=level", pair)
+		}
+		name, levelName := pair[:i], pair[i+1:]
+		known := false
+		for _, s := range logSubsystems {
+			known = known || s == name
+		}
+		if !known {
+			return nil, xerrors.Errorf("unknown subsystem %q, expected one of %s", name, strings.Join(logSubsystems, ", "))
+		}
+		switch levelName {
+		case "debug":
+			levels[name] = slog.LevelDebug
+		case "info":
+			levels[name] = slog.LevelInfo
+		case "warn":
+			levels[name] = slog.LevelWarn
+		case "error":
+			levels[name] = slog.LevelError
+		default:
+			return nil, xerrors.Errorf("unknown level %q of %s, expected debug, info, warn or error", levelName, name)
+		}
+	}
+	return levels, nil
+}
+
+// subsystemLogger returns a logger writing to stderr for the named subsystem
+// at the level --log-level gives it or, without one, at debug level when the
+// verbosity is at least enableAt. It discards everything otherwise.
+func subsystemLogger(name string, enableAt int) slog.Logger {
+	level, ok := subsystemLevels[name]
+	if !ok {
+		if !verboseAt(enableAt) {
+			return slog.Make()
+		}
+		level = slog.LevelDebug
+	}
+	return slog.Make(sloghuman.Sink(os.Stderr)).Named(name).Leveled(level)
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"cdr.dev/slog"
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_verbosityFlag(t *testing.T) {
+	defer func() { verbosity = 0 }()
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{args: nil, want: 0},
+		{args: []string{"-v"}, want: verbosityInfo},
+		{args: []string{"-vv"}, want: verbosityDebug},
+		{args: []string{"-v", "--verbose", "-v"}, want: verbosityTrace},
+	}
+	for _, tt := range tests {
+		verbosity = 0
+		err := Make().PersistentFlags().Parse(tt.args)
+		assert.Success(t, "parse flags", err)
+		assert.Equal(t, "verbosity", tt.want, verbosity)
+	}
+	assert.True(t, "trace includes debug", verboseAt(verbosityDebug))
+}
+
+func Test_parseLogLevels(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		raw  string
+		want map[string]slog.Level
+		ok   bool
+	}{
+		{raw: "", want: map[string]slog.Level{}, ok: true},
+		{raw: "wsnet=debug,sync=info", want: map[string]slog.Level{"wsnet": slog.LevelDebug, "sync": slog.LevelInfo}, ok: true},
+		{raw: " ice=warn , sdk=error,", want: map[string]slog.Level{"ice": slog.LevelWarn, "sdk": slog.LevelError}, ok: true},
+		{raw: "wsnet"},
+		{raw: "wsnet=verbose"},
+		{raw: "network=debug"},
+	} {
+		got, err := parseLogLevels(tt.raw)
+		assert.Equal(t, tt.raw+" parses", tt.ok, err == nil)
+		if tt.ok {
+			assert.Equal(t, tt.raw, tt.want, got)
+		}
+	}
+}
+
+// Not parallel: the levels and the env are global.
+func Test_logLevelFlag(t *testing.T) {
+	defer func() { verbosity, logLevelFlag, subsystemLevels = 0, "", nil }()
+	assert.Success(t, "setenv", os.Setenv(logLevelEnv, "sync=info"))
+	t.Cleanup(func() { _ = os.Unsetenv(logLevelEnv) })
+
+	app := Make()
+	assert.Success(t, "parse flags", app.ParseFlags(nil))
+	assert.Success(t, "resolve", resolveLogLevels(app))
+	assert.Equal(t, "the env applies without the flag", map[string]slog.Level{"sync": slog.LevelInfo}, subsystemLevels)
+
+	app = Make()
+	assert.Success(t, "parse flags", app.ParseFlags([]string{"--log-level", "wsnet=debug"}))
+	assert.Success(t, "resolve", resolveLogLevels(app))
+	assert.Equal(t, "the flag takes precedence over the env", map[string]slog.Level{"wsnet": slog.LevelDebug}, subsystemLevels)
+
+	app = Make()
+	assert.Success(t, "parse flags", app.ParseFlags([]string{"--log-level", "wsnet"}))
+	assert.Error(t, "invalid level", resolveLogLevels(app))
+}
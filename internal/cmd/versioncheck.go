@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/version"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// versionCheckInterval is how often the version of the CLI is compared to
+// the version offered by each deployment.
+const versionCheckInterval = 24 * time.Hour
+
+// noVersionCheckEnv disables the version check when set, like
+// --no-version-check, such as in CI.
+const noVersionCheckEnv = "CODER_NO_VERSION_CHECK"
+
+// noVersionCheck is the value of the global --no-version-check flag.
+var noVersionCheck bool
+
+// versionCheck is the result of the last version check of a deployment.
+type versionCheck struct {
+	CheckedAt  time.Time `json:"checked_at"`
+	APIVersion string    `json:"api_version"`
+	// Target is the version "coder update" offers.
+	Target string `json:"target"`
+}
+
+func versionCheckEnabled() bool {
+	return !noVersionCheck && os.Getenv(noVersionCheckEnv) == ""
+}
+
+// checkCLIVersion compares the local version of the CLI to the version the
+// deployment at apiVersion offers, at most once per versionCheckInterval
+// unless the deployment was upgraded since, and hints at updating when a
+// newer version is offered. The results are cached in the config dir by
+// deployment URL.
+func checkCLIVersion(ctx context.Context, client coder.Client, deploymentURL, apiVersion, localVersion string, now time.Time) {
+	checks := make(map[string]versionCheck)
+	if raw, err := config.VersionChecks.Read(); err == nil {
+		_ = json.Unmarshal([]byte(raw), &checks)
+	}
+	if last, ok := checks[deploymentURL]; ok && last.APIVersion == apiVersion &&
+		now.Sub(last.CheckedAt) < versionCheckInterval && !now.Before(last.CheckedAt) {
+		return
+	}
+
+	target := rolloutVersion(ctx, client, apiVersion)
+	checks[deploymentURL] = versionCheck{CheckedAt: now, APIVersion: apiVersion, Target: target}
+	if raw, err := json.Marshal(checks); err == nil {
+		_ = config.VersionChecks.Write(string(raw)) // Best effort, checked again next time.
+	}
+
+	switch {
+	case version.Compare(target, localVersion) > 0:
+		clog.LogInfo(i18n.Sprintf("coder-cli v%s is available, run \"coder update\"", strings.TrimPrefix(target, "v")))
+	case !version.VersionsMatch(target):
+		logVersionMismatchError(apiVersion, target)
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/version"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// Not parallel: the checks are recorded in the config dir and logged to the
+// clog output of the package, and the version of the CLI is set.
+func Test_checkCLIVersion(t *testing.T) {
+	var buf bytes.Buffer
+	clog.SetOutput(&buf)
+	cliVersion := version.Version
+	t.Cleanup(func() {
+		version.Version = cliVersion
+		clog.SetOutput(os.Stderr)
+		_ = config.VersionChecks.Delete()
+	})
+	ctx := context.Background()
+	fake := codertest.New()
+	fake.SetAPIVersion("1.21.0")
+	now := time.Now()
+	const deployment = "https://coder.example.com"
+
+	checkCLIVersion(ctx, fake, deployment, "1.21.0", "v1.20.3", now)
+	assert.True(t, "hinted", strings.Contains(buf.String(), `coder-cli v1.21.0 is available, run "coder update"`))
+
+	buf.Reset()
+	checkCLIVersion(ctx, fake, deployment, "1.21.0", "v1.20.3", now.Add(time.Hour))
+	assert.Equal(t, "checked once a day", 1, len(fake.CallsTo("SiteConfigCLIRollout")))
+	assert.Equal(t, "hinted once a day", "", buf.String())
+
+	version.Version = "v1.21.0"
+	checkCLIVersion(ctx, fake, "https://other.example.com", "1.21.0", version.Version, now.Add(time.Hour))
+	assert.Equal(t, "deployments checked apart", 2, len(fake.CallsTo("SiteConfigCLIRollout")))
+	assert.Equal(t, "up to date", "", buf.String())
+
+	version.Version = "v1.22.0"
+	checkCLIVersion(ctx, fake, deployment, "1.21.0", version.Version, now.Add(25*time.Hour))
+	assert.Equal(t, "checked again", 3, len(fake.CallsTo("SiteConfigCLIRollout")))
+	assert.True(t, "newer than the deployment", strings.Contains(buf.String(), "version mismatch detected"))
+
+	fake.SetAPIVersion("1.22.0")
+	checkCLIVersion(ctx, fake, deployment, "1.22.0", version.Version, now.Add(26*time.Hour))
+	assert.Equal(t, "checked after an upgrade", 4, len(fake.CallsTo("SiteConfigCLIRollout")))
+}
+
+func Test_checkSession(t *testing.T) {
+	t.Parallel()
+	fake := codertest.New()
+	fake.On("APIVersion", func(...interface{}) error {
+		return coder.NewHTTPError(&http.Response{
+			StatusCode: http.StatusUnauthorized,
+			Request:    httptest.NewRequest(http.MethodGet, "/api/v0/version", nil),
+			Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		})
+	})
+	_, err := checkSession(context.Background(), fake)
+	assert.ErrorContains(t, "unauthorized", err, "try running \"coder login")
+}
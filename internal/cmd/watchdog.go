@@ -0,0 +1,316 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cli/safeexec"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/coderutil"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/notify"
+	"cdr.dev/coder-cli/pkg/clog"
+	"cdr.dev/coder-cli/wsnet"
+)
+
+func watchdogCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "watchdog",
+		Short: "Monitor the reachability of your Coder workspaces",
+		Long:  "Keep SSH access to your Coder workspaces healthy for users of \"coder config-ssh\".",
+	}
+	cmd.AddCommand(watchdogStartCmd())
+	return cmd
+}
+
+func watchdogStartCmd() *cobra.Command {
+	var (
+		configpath        string
+		additionalOptions []string
+		interval          time.Duration
+		noNotify          bool
+		noProbe           bool
+	)
+	cmd := &cobra.Command{
+		Use:   "start",
+		Short: "Run the workspace watchdog in the foreground",
+		Long: "Periodically check your workspaces and keep SSH access to them healthy. " +
+			"The watchdog refreshes the \"coder config-ssh\" entries when workspaces are created or deleted, " +
+			"re-establishes connections to the workspace broker after the machine wakes from sleep, " +
+			"and shows a desktop notification when a workspace changes state.",
+		Example: `# run the watchdog, checking every 30 seconds
+coder watchdog start
+
+# check less often and only log state changes
+coder watchdog start --interval 2m --no-notify`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if interval < time.Second {
+				return xerrors.New("--interval must be at least 1s")
+			}
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			configpath, _, err = sshConfigPaths(configpath)
+			if err != nil {
+				return err
+			}
+
+			w := &watchdog{
+				client:            client,
+				configpath:        configpath,
+				additionalOptions: additionalOptions,
+				notify:            !noNotify,
+				probe:             !noProbe,
+			}
+			return w.run(ctx, interval)
+		},
+	}
+	cmd.Flags().StringVar(&configpath, "filepath", filepath.Join("~", ".ssh", "config"), "path of the ssh config file written by \"coder config-ssh\"")
+	cmd.Flags().StringSliceVarP(&additionalOptions, "option", "o", []string{}, "additional options injected in the ssh config when it is refreshed")
+	cmd.Flags().DurationVar(&interval, "interval", 30*time.Second, "how often workspaces are checked")
+	cmd.Flags().BoolVar(&noNotify, "no-notify", false, "log state changes without showing desktop notifications")
+	cmd.Flags().BoolVar(&noProbe, "no-probe", false, "skip connecting to running workspaces to check that they are reachable")
+	_ = cmd.MarkFlagFilename("filepath")
+	return cmd
+}
+
+// watchState is the observed state of a single workspace.
+type watchState struct {
+	name      string
+	status    coder.WorkspaceStatus
+	reachable bool
+}
+
+// watchEvent is a change in the observed state of a workspace.
+type watchEvent struct {
+	name    string
+	message string
+}
+
+// diffWatchStates returns the changes between two observations, keyed by
+// workspace ID, sorted by workspace name.
+func diffWatchStates(prev, next map[string]watchState) []watchEvent {
+	var events []watchEvent
+	for id, n := range next {
+		p, ok := prev[id]
+		switch {
+		case !ok:
+			events = append(events, watchEvent{name: n.name, message: "was created"})
+		case p.status != n.status:
+			events = append(events, watchEvent{name: n.name, message: fmt.Sprintf("is now %s", strings.ToLower(string(n.status)))})
+		case n.status == coder.WorkspaceOn && p.reachable != n.reachable:
+			if n.reachable {
+				events = append(events, watchEvent{name: n.name, message: "is reachable again"})
+			} else {
+				events = append(events, watchEvent{name: n.name, message: "is unreachable"})
+			}
+		}
+	}
+	for id, p := range prev {
+		if _, ok := next[id]; !ok {
+			events = append(events, watchEvent{name: p.name, message: "was deleted"})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].name < events[j].name })
+	return events
+}
+
+// watchdogSleepFactor is how many intervals must pass between two checks
+// before the watchdog assumes the machine was asleep.
+const watchdogSleepFactor = 3
+
+type watchdog struct {
+	client            coder.Client
+	configpath        string
+	additionalOptions []string
+	notify            bool
+	probe             bool
+
+	states map[string]watchState
+}
+
+func (w *watchdog) run(ctx context.Context, interval time.Duration) error {
+	clog.LogInfo(i18n.Sprintf("watching workspaces every %s", interval))
+	if err := w.check(ctx, false); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			// Monotonic time stops while the machine sleeps, so compare wall clocks.
+			resumed := now.Round(0).Sub(last.Round(0)) > watchdogSleepFactor*interval
+			last = now
+			if err := w.check(ctx, resumed); err != nil {
+				// Connectivity is expected to come and go, so keep watching.
+				clog.LogWarn("failed to check workspaces", clog.Causef(err.Error()))
+			}
+		}
+	}
+}
+
+// check observes the current state of the user's workspaces and reacts to
+// any change since the previous check.
+func (w *watchdog) check(ctx context.Context, resumed bool) error {
+	workspaces, err := getWorkspaces(ctx, w.client, coder.Me)
+	if err != nil {
+		return err
+	}
+
+	if resumed {
+		clog.LogInfo("resumed from sleep, resetting workspace connections")
+		resetSSHConnections(ctx, workspaces)
+	}
+
+	next := make(map[string]watchState, len(workspaces))
+	for _, ws := range workspaces {
+		state := watchState{name: ws.Name, status: ws.LatestStat.ContainerStatus, reachable: true}
+		if w.probe && state.status == coder.WorkspaceOn {
+			if err := probeWorkspace(ctx, w.client, &ws); err != nil {
+				state.reachable = false
+				if verboseAt(verbosityInfo) {
+					clog.LogWarn(i18n.Sprintf("workspace %q is unreachable", ws.Name), clog.Causef(err.Error()))
+				}
+			}
+		}
+		next[ws.ID] = state
+	}
+
+	prev := w.states
+	w.states = next
+	if prev == nil {
+		return nil
+	}
+
+	events := diffWatchStates(prev, next)
+	if membershipChanged(prev, next) {
+		if err := w.refreshSSHConfig(ctx, workspaces); err != nil {
+			clog.LogWarn("failed to refresh ssh config", clog.Causef(err.Error()))
+		}
+	}
+	for _, e := range events {
+		w.report(ctx, e)
+	}
+	return nil
+}
+
+func (w *watchdog) report(ctx context.Context, e watchEvent) {
+	msg := fmt.Sprintf("workspace %q %s", e.name, e.message)
+	clog.LogInfo(msg)
+	if !w.notify {
+		return
+	}
+	if err := notify.Send(ctx, "Coder", msg); err != nil && !xerrors.Is(err, notify.ErrUnavailable) {
+		clog.LogWarn("failed to show desktop notification", clog.Causef(err.Error()))
+	}
+}
+
+// refreshSSHConfig rewrites the config-ssh section if the user has one.
+func (w *watchdog) refreshSSHConfig(ctx context.Context, workspaces []coder.Workspace) error {
+	current, err := readSSHConfig(w.configpath)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(current, sshStartToken) {
+		// The user doesn't use config-ssh, so there's nothing to keep in sync.
+		return nil
+	}
+
+	_, privateKeyFilepath, err := sshConfigPaths(w.configpath)
+	if err != nil {
+		return err
+	}
+	withProviders, err := coderutil.WorkspacesWithProvider(ctx, w.client, workspaces)
+	if err != nil {
+		return xerrors.Errorf("resolve workspace providers: %w", err)
+	}
+	if _, err := writeCoderSSHConfig(w.configpath, privateKeyFilepath, withProviders, w.additionalOptions, true, sshStale{prune: true}); err != nil {
+		return err
+	}
+	clog.LogSuccess(i18n.Sprintf("refreshed ssh config at %q", w.configpath))
+	return nil
+}
+
+func membershipChanged(prev, next map[string]watchState) bool {
+	if len(prev) != len(next) {
+		return true
+	}
+	for id, p := range prev {
+		if n, ok := next[id]; !ok || n.name != p.name {
+			return true
+		}
+	}
+	return false
+}
+
+// probeWorkspace connects to the workspace through the broker to check that
+// it is reachable. It's a variable so it can be replaced in tests.
+var probeWorkspace = func(ctx context.Context, client coder.Client, workspace *coder.Workspace) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	dialer, err := dialWorkspace(ctx, client, workspace)
+	if err != nil {
+		return err
+	}
+	defer dialer.Close()
+	return dialer.Ping(ctx)
+}
+
+// dialWorkspace connects to the agent of the workspace the way tunnels do,
+// checking the identity pinned for it and routing through the satellite, if
+// one is set.
+func dialWorkspace(ctx context.Context, client coder.Client, workspace *coder.Workspace) (*wsnet.Dialer, error) {
+	iceServers, err := client.ICEServers(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("get ICE servers: %w", err)
+	}
+	router, err := newSatelliteRouter(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	baseURL := client.BaseURL()
+	t := &tunnneler{
+		log:        subsystemLogger("tunnel", verbosityDebug),
+		brokerAddr: &baseURL,
+		token:      client.Token(),
+		workspace:  workspace,
+		iceServers: iceServers,
+		router:     router,
+	}
+	return t.dial(ctx)
+}
+
+// resetSSHConnections closes the OpenSSH control masters of the workspaces.
+// Their tunnels to the broker don't survive sleep, and ControlPersist would
+// otherwise keep handing the dead connection to new ssh sessions.
+func resetSSHConnections(ctx context.Context, workspaces []coder.Workspace) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		// Control masters are only configured on these platforms.
+		return
+	}
+	sshPath, err := safeexec.LookPath("ssh")
+	if err != nil {
+		return
+	}
+	for _, ws := range workspaces {
+		// Fails harmlessly when there is no master for the host.
+		_ = exec.CommandContext(ctx, sshPath, "-O", "exit", "coder."+ws.Name).Run()
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_diffWatchStates(t *testing.T) {
+	t.Parallel()
+
+	prev := map[string]watchState{
+		"1": {name: "backend", status: coder.WorkspaceOn, reachable: true},
+		"2": {name: "frontend", status: coder.WorkspaceOn, reachable: true},
+		"3": {name: "old", status: coder.WorkspaceOff},
+	}
+	next := map[string]watchState{
+		"1": {name: "backend", status: coder.WorkspaceOff},
+		"2": {name: "frontend", status: coder.WorkspaceOn, reachable: false},
+		"4": {name: "new", status: coder.WorkspaceOn, reachable: true},
+	}
+
+	events := diffWatchStates(prev, next)
+	assert.Equal(t, "events", []watchEvent{
+		{name: "backend", message: "is now off"},
+		{name: "frontend", message: "is unreachable"},
+		{name: "new", message: "was created"},
+		{name: "old", message: "was deleted"},
+	}, events)
+	assert.True(t, "membership changed", membershipChanged(prev, next))
+	assert.True(t, "membership unchanged", !membershipChanged(prev, prev))
+}
+
+func Test_watchdogRefreshesSSHConfig(t *testing.T) {
+	ctx := context.Background()
+
+	fake := codertest.New()
+	providerID := fake.AddProvider(coder.KubernetesProvider{
+		Name:               "default",
+		KubeProviderConfig: coder.KubeProviderConfig{SSHEnabled: true},
+	})
+	fake.AddWorkspace(coder.Workspace{Name: "backend", ResourcePoolID: providerID})
+
+	configpath := filepath.Join(t.TempDir(), "config")
+	err := ioutil.WriteFile(configpath, []byte("Host example\n\n"+sshStartToken+"\n"+sshEndToken+"\n"), 0600)
+	assert.Success(t, "write ssh config", err)
+
+	w := &watchdog{client: fake, configpath: configpath}
+	err = w.check(ctx, false)
+	assert.Success(t, "first check", err)
+
+	fake.AddWorkspace(coder.Workspace{Name: "frontend", ResourcePoolID: providerID})
+	err = w.check(ctx, false)
+	assert.Success(t, "second check", err)
+
+	config, err := readStr(configpath)
+	assert.Success(t, "read ssh config", err)
+	assert.True(t, "user entries kept", strings.HasSuffix(config, "\nHost example\n"))
+	config, err = readStr(sshIncludePath(configpath))
+	assert.Success(t, "read ssh config include file", err)
+	assert.True(t, "new workspace added", strings.Contains(config, "Host coder.frontend\n"))
+	assert.True(t, "existing workspace kept", strings.Contains(config, "Host coder.backend\n"))
+}
@@ -0,0 +1,511 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/config"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// workflowPath is where "coder up" and "coder down" find the workflow of a
+// repository, relative to its root.
+const workflowPath = ".coder/workflow.yaml"
+
+// Modes of the syncs of a workflow.
+const (
+	// syncModeWatch transfers the directories and keeps them in sync.
+	syncModeWatch = "watch"
+	// syncModeOnce transfers the directories and exits, like --init.
+	syncModeOnce = "once"
+)
+
+// workflow is the morning and evening routine of a repository: the
+// workspace it is worked on in and the directories synced to it. Both
+// "coder up" and "coder sync start" read it.
+type workflow struct {
+	// Workspace is the name of the workspace. The default workspace is
+	// used when it is empty.
+	Workspace string `yaml:"workspace"`
+	// Timeout is how long "coder up" waits for the workspace to be on.
+	Timeout time.Duration `yaml:"timeout"`
+	// Mode is syncModeWatch, the default, or syncModeOnce.
+	Mode string `yaml:"mode"`
+	// Verify is whether to verify the transferred files, true if unset.
+	Verify *bool `yaml:"verify"`
+	// Exclude lists the rsync patterns excluded from every sync.
+	Exclude []string `yaml:"exclude"`
+	// Sync lists the directories synced to the workspace.
+	Sync []workflowSync `yaml:"sync"`
+
+	// root is the directory holding .coder/workflow.yaml, or the
+	// .coder/sync.yaml the syncs were read from.
+	root string
+	// syncPath is the file the syncs were read from.
+	syncPath string
+}
+
+type workflowSync struct {
+	// Local is the local directory, relative to the root of the repository.
+	Local string `yaml:"local"`
+	// Remote is the absolute path of the directory of the workspace it is
+	// synced to.
+	Remote string `yaml:"remote"`
+	// Exclude lists the rsync patterns excluded from this sync, relative to
+	// Local.
+	Exclude []string `yaml:"exclude"`
+}
+
+// findWorkflow reads the workflow of the repository dir is in, searching
+// dir and its parents, with the sync settings of its sync config, if any.
+func findWorkflow(dir string) (*workflow, error) {
+	wf, err := readWorkflow(dir)
+	if os.IsNotExist(err) {
+		return nil, clog.Error("no workflow found",
+			fmt.Sprintf("neither the current directory nor its parents have a %s", workflowPath),
+			clog.BlankLine,
+			clog.Tipf("create one naming the workspace and the directories to sync, such as:\n\n"+
+				"  workspace: my-workspace\n  exclude: [node_modules, \"*.log\"]\n  sync:\n    - local: .\n      remote: /home/coder/my-project"),
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := wf.applySyncConfig(dir); err != nil {
+		return nil, err
+	}
+	return wf, nil
+}
+
+// readWorkflow reads the workflow of the repository dir is in. The error
+// satisfies os.IsNotExist if there's none.
+func readWorkflow(dir string) (*workflow, error) {
+	root, raw, err := findRepoFile(dir, workflowPath)
+	if os.IsNotExist(err) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read workflow: %w", err)
+	}
+	wf, err := parseWorkflow(raw)
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %w", filepath.Join(root, workflowPath), err)
+	}
+	wf.root = root
+	wf.syncPath = filepath.Join(root, workflowPath)
+	return wf, nil
+}
+
+// findRepoFile reads the file at rel, such as ".coder/workflow.yaml", from
+// dir or the closest of its parents that has one, and returns the directory
+// it was found in. The error satisfies os.IsNotExist if none has it.
+func findRepoFile(dir, rel string) (root string, raw []byte, _ error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", nil, xerrors.Errorf("make abs path out of %s: %w", dir, err)
+	}
+	for {
+		raw, err := ioutil.ReadFile(filepath.Join(dir, rel))
+		if err == nil {
+			return dir, raw, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil, err
+		}
+		dir = parent
+	}
+}
+
+func parseWorkflow(raw []byte) (*workflow, error) {
+	var wf workflow
+	if err := yaml.UnmarshalStrict(raw, &wf); err != nil {
+		return nil, xerrors.Errorf("parse: %w", err)
+	}
+	if wf.Timeout < 0 {
+		return nil, xerrors.New("timeout must not be negative")
+	}
+	switch wf.Mode {
+	case "":
+		wf.Mode = syncModeWatch
+	case syncModeWatch, syncModeOnce:
+	default:
+		return nil, xerrors.Errorf("mode must be %q or %q, not %q", syncModeWatch, syncModeOnce, wf.Mode)
+	}
+	if err := checkWorkflowSyncs(wf.Sync, "sync"); err != nil {
+		return nil, err
+	}
+	return &wf, nil
+}
+
+// checkWorkflowSyncs checks the remote directories of syncs, and defaults
+// their local directory to the root. kind names them in errors.
+func checkWorkflowSyncs(syncs []workflowSync, kind string) error {
+	for i, s := range syncs {
+		if s.Remote == "" {
+			return xerrors.Errorf("%s %d: remote is required", kind, i+1)
+		}
+		if !path.IsAbs(s.Remote) {
+			return xerrors.Errorf("%s %d: remote must be an absolute path, not %q", kind, i+1, s.Remote)
+		}
+		if s.Local == "" {
+			syncs[i].Local = "."
+		}
+	}
+	return nil
+}
+
+// workspaceName returns the workspace of the workflow, falling back to the
+// default workspace.
+func (wf *workflow) workspaceName() (string, error) {
+	if wf.Workspace != "" {
+		return wf.Workspace, nil
+	}
+	name, err := defaultWorkspace()
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", clog.Error("the workflow names no workspace",
+			clog.BlankLine,
+			clog.Tipf("add \"workspace: <name>\" to %s, or run \"coder config set default-workspace <name>\"", wf.syncPath),
+		)
+	}
+	return name, nil
+}
+
+// localDir returns the absolute path of the local directory of s.
+func (wf *workflow) localDir(s workflowSync) string {
+	if filepath.IsAbs(s.Local) {
+		return filepath.Clean(s.Local)
+	}
+	return filepath.Join(wf.root, s.Local)
+}
+
+// excludes returns the patterns excluded from s.
+func (wf *workflow) excludes(s workflowSync) []string {
+	return append(append([]string{}, wf.Exclude...), s.Exclude...)
+}
+
+// verify returns whether to verify the transferred files.
+func (wf *workflow) verify() bool {
+	return wf.Verify == nil || *wf.Verify
+}
+
+// syncFlags returns the flags of "coder sync" that apply the mode, verify
+// and excludes of the workflow to s.
+func (wf *workflow) syncFlags(s workflowSync) []string {
+	var flags []string
+	if wf.Mode == syncModeOnce {
+		flags = append(flags, "--init")
+	}
+	if !wf.verify() {
+		flags = append(flags, "--verify=false")
+	}
+	for _, pattern := range wf.excludes(s) {
+		flags = append(flags, "--exclude", pattern)
+	}
+	return flags
+}
+
+func upCmd() *cobra.Command {
+	var (
+		timeout time.Duration
+		noSync  bool
+	)
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "Start the workspace of the current repository and sync it",
+		Long: "Start the workspace named in the " + workflowPath + " of the current repository, wait until it is on, " +
+			"refresh the ssh config if \"coder config-ssh --auto-refresh\" was run, and start syncing the directories " +
+			"the workflow lists in the background. \"coder down\" undoes it.\n\n" +
+			"The workflow is read from the current directory or the closest parent that has one:\n\n" +
+			"  workspace: my-workspace   # the default workspace when omitted\n" +
+			"  timeout: 15m              # how long to wait for the workspace to be on\n" +
+			"  mode: watch               # or once, to transfer and exit like \"coder sync --init\"\n" +
+			"  verify: true\n" +
+			"  exclude: [\".git\", \"*.log\"]  # rsync patterns left out of every sync\n" +
+			"  sync:\n" +
+			"    - local: .              # relative to the repository root\n" +
+			"      remote: /home/coder/my-project\n" +
+			"      exclude: [node_modules]\n\n" +
+			"A " + syncConfigPath + " in the repository, listing the syncs under mappings instead of sync, takes precedence " +
+			"over the sync, exclude, mode and verify of the workflow.\n\n" +
+			"\"coder sync start\" runs the same syncs in the foreground. The output of each sync is logged to the workflow-syncs directory of the Coder configuration directory.",
+		Example: `coder up
+coder up --timeout 30m --no-sync`,
+		Args: xcobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			wd, err := os.Getwd()
+			if err != nil {
+				return xerrors.Errorf("get working directory: %w", err)
+			}
+			wf, err := findWorkflow(wd)
+			if err != nil {
+				return err
+			}
+			name, err := wf.workspaceName()
+			if err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("timeout") && wf.Timeout > 0 {
+				timeout = wf.Timeout
+			}
+
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, name, coder.Me)
+			if err != nil {
+				return err
+			}
+			if err := startWorkspace(ctx, client, *workspace); err != nil {
+				return err
+			}
+			if workspace, err = client.WorkspaceByID(ctx, workspace.ID); err != nil {
+				return xerrors.Errorf("get workspace: %w", err)
+			}
+			waitCtx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				waitCtx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			err = followWorkspace(waitCtx, client, workspace, cmd.OutOrStdout())
+			if xerrors.Is(err, context.DeadlineExceeded) {
+				return clog.Error(i18n.Sprintf("workspace %q is not on after %s", workspace.Name, timeout),
+					clog.BlankLine,
+					clog.Tipf("raise --timeout, or the timeout of the workflow, if the image takes a while to pull"),
+				)
+			}
+			if err != nil {
+				return err
+			}
+
+			refreshSSHConfig(ctx, client)
+
+			if noSync {
+				return nil
+			}
+			for _, s := range wf.Sync {
+				if err := startWorkflowSync(workspace.Name, wf.localDir(s), s.Remote, wf.syncFlags(s)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "give up if the workspace is not on after this long, overriding the workflow (0 waits forever)")
+	cmd.Flags().BoolVar(&noSync, "no-sync", false, "don't start syncing the directories of the workflow")
+	return cmd
+}
+
+func downCmd() *cobra.Command {
+	var keepWorkspace bool
+	cmd := &cobra.Command{
+		Use:   "down",
+		Short: "Stop syncing the current repository and stop its workspace",
+		Long: "Stop the syncs \"coder up\" started for the " + workflowPath + " of the current repository, " +
+			"then stop its workspace.",
+		Example: `coder down
+coder down --keep-workspace`,
+		Args: xcobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			wd, err := os.Getwd()
+			if err != nil {
+				return xerrors.Errorf("get working directory: %w", err)
+			}
+			wf, err := findWorkflow(wd)
+			if err != nil {
+				return err
+			}
+			name, err := wf.workspaceName()
+			if err != nil {
+				return err
+			}
+
+			for _, s := range wf.Sync {
+				if err := stopWorkflowSync(name, wf.localDir(s)); err != nil {
+					return err
+				}
+			}
+			if keepWorkspace {
+				return nil
+			}
+
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, name, coder.Me)
+			if err != nil {
+				return err
+			}
+			if workspace.LatestStat.ContainerStatus == coder.WorkspaceOff {
+				clog.LogInfo(i18n.Sprintf("workspace %q is already off", workspace.Name))
+				return nil
+			}
+			return stopWorkspace(ctx, client, *workspace)
+		},
+	}
+	cmd.Flags().BoolVar(&keepWorkspace, "keep-workspace", false, "only stop the syncs, leaving the workspace on")
+	return cmd
+}
+
+// workflowSyncLockTimeout is how long "coder up" waits for a sync it started
+// to take its lock.
+const workflowSyncLockTimeout = 5 * time.Second
+
+// workflowSyncState records a sync started by "coder up", so that "coder
+// down" can stop it.
+type workflowSyncState struct {
+	PID       int       `json:"pid"`
+	Workspace string    `json:"workspace"`
+	LocalDir  string    `json:"local_dir"`
+	RemoteDir string    `json:"remote_dir"`
+	Log       string    `json:"log"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// workflowSyncPaths returns the paths of the state, the log and the lock of
+// the sync of the local directory to the workspace.
+func workflowSyncPaths(workspace, localDir string) (state, log, lock string, err error) {
+	dir, err := config.Dir("workflow-syncs")
+	if err != nil {
+		return "", "", "", xerrors.Errorf("create sync state directory: %w", err)
+	}
+	key := sha256.Sum256([]byte(workspace + "\x00" + localDir))
+	base := filepath.Join(dir, hex.EncodeToString(key[:8]))
+	return base + ".json", base + ".log", base + ".lock", nil
+}
+
+// startWorkflowSync runs "coder sync" of the local directory to the remote
+// one in the background with the flags, replacing the sync "coder up"
+// started before.
+func startWorkflowSync(workspace, localDir, remoteDir string, flags []string) error {
+	if err := stopWorkflowSync(workspace, localDir); err != nil {
+		return err
+	}
+	statePath, logPath, lockPath, err := workflowSyncPaths(workspace, localDir)
+	if err != nil {
+		return err
+	}
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return xerrors.Errorf("open sync log: %w", err)
+	}
+	defer logFile.Close()
+
+	args := append([]string{"sync", localDir, workspace + ":" + remoteDir, "--lock-file", lockPath}, flags...)
+	proc := exec.Command(exe, args...)
+	proc.Stdout = logFile
+	proc.Stderr = logFile
+	if err := proc.Start(); err != nil {
+		return xerrors.Errorf("start sync of %s: %w", localDir, err)
+	}
+	state, err := json.Marshal(workflowSyncState{
+		PID:       proc.Process.Pid,
+		Workspace: workspace,
+		LocalDir:  localDir,
+		RemoteDir: remoteDir,
+		Log:       logPath,
+		StartedAt: time.Now(),
+	})
+	if err != nil {
+		return xerrors.Errorf("marshal sync state: %w", err)
+	}
+	if err := ioutil.WriteFile(statePath, state, 0600); err != nil {
+		_ = proc.Process.Kill()
+		return xerrors.Errorf("record sync state: %w", err)
+	}
+	// Waiting for the sync to take its lock lets "coder down" stop it right
+	// away. A sync that fails first explains why in its log.
+	for deadline := time.Now().Add(workflowSyncLockTimeout); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if agentLockPID(lockPath) == proc.Process.Pid {
+			break
+		}
+	}
+	if err := proc.Process.Release(); err != nil {
+		return xerrors.Errorf("release sync process: %w", err)
+	}
+	clog.LogSuccess(i18n.Sprintf("syncing %s to %s:%s", localDir, workspace, remoteDir),
+		clog.Tipf("follow its output in %s", logPath),
+	)
+	return nil
+}
+
+// stopWorkflowSync stops the sync "coder up" started of the local directory
+// to the workspace, if any. The sync holds its lock while it runs, so a
+// process that reused its pid after it exited isn't killed.
+func stopWorkflowSync(workspace, localDir string) error {
+	statePath, _, lockPath, err := workflowSyncPaths(workspace, localDir)
+	if err != nil {
+		return err
+	}
+	raw, err := ioutil.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("read sync state: %w", err)
+	}
+	var state workflowSyncState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return xerrors.Errorf("parse sync state %s: %w", statePath, err)
+	}
+	lock, err := lockAgent(lockPath)
+	switch {
+	case err == nil:
+		// The sync exited on its own, which leaves nothing to stop.
+		_ = lock.Close()
+	case xerrors.Is(err, errAgentLocked):
+		if err := stopSyncProcess(agentLockPID(lockPath)); err != nil {
+			return xerrors.Errorf("stop sync of %s: %w", state.LocalDir, err)
+		}
+		clog.LogSuccess(i18n.Sprintf("stopped syncing %s to %s:%s", state.LocalDir, state.Workspace, state.RemoteDir))
+	default:
+		return xerrors.Errorf("check sync of %s: %w", state.LocalDir, err)
+	}
+	if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("remove sync state: %w", err)
+	}
+	return nil
+}
+
+// stopSyncProcess kills the sync holding its lock with the pid.
+func stopSyncProcess(pid int) error {
+	if pid == 0 {
+		return xerrors.New("the sync didn't record its pid, stop it manually")
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func Test_findWorkflow(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	nested := filepath.Join(root, "services", "api")
+	assert.Success(t, "mkdir", os.MkdirAll(nested, 0750))
+	assert.Success(t, "mkdir .coder", os.MkdirAll(filepath.Join(root, ".coder"), 0750))
+	err := ioutil.WriteFile(filepath.Join(root, workflowPath), []byte(`workspace: my-workspace
+timeout: 15m
+verify: false
+exclude: [".git", "*.log"]
+sync:
+  - remote: /home/coder/project
+  - local: services/api
+    remote: /home/coder/api
+    exclude: [node_modules]
+`), 0600)
+	assert.Success(t, "write workflow", err)
+
+	wf, err := findWorkflow(nested)
+	assert.Success(t, "found from a subdirectory", err)
+	assert.Equal(t, "root", root, wf.root)
+	assert.Equal(t, "workspace", "my-workspace", wf.Workspace)
+	assert.Equal(t, "timeout", 15*time.Minute, wf.Timeout)
+	assert.Equal(t, "syncs", 2, len(wf.Sync))
+	assert.Equal(t, "local defaults to the root", root, wf.localDir(wf.Sync[0]))
+	assert.Equal(t, "local is relative to the root", nested, wf.localDir(wf.Sync[1]))
+	assert.Equal(t, "mode defaults to watch", syncModeWatch, wf.Mode)
+	assert.False(t, "verify", wf.verify())
+	assert.Equal(t, "global excludes", []string{".git", "*.log"}, wf.excludes(wf.Sync[0]))
+	assert.Equal(t, "sync excludes add to the global ones", []string{".git", "*.log", "node_modules"}, wf.excludes(wf.Sync[1]))
+	assert.Equal(t, "sync flags", []string{"--verify=false", "--exclude", ".git", "--exclude", "*.log"}, wf.syncFlags(wf.Sync[0]))
+
+	_, err = findWorkflow(t.TempDir())
+	assert.Error(t, "no workflow", err)
+}
+
+func Test_parseWorkflow(t *testing.T) {
+	t.Parallel()
+	wf, err := parseWorkflow([]byte("mode: once\nsync:\n  - remote: /home/coder/project\n"))
+	assert.Success(t, "parse", err)
+	assert.Equal(t, "mode", syncModeOnce, wf.Mode)
+	assert.True(t, "verify defaults to true", wf.verify())
+	assert.Equal(t, "once transfers and exits", []string{"--init"}, wf.syncFlags(wf.Sync[0]))
+
+	for name, raw := range map[string]string{
+		"unknown field":    "workspace: a\nsyncs: []\n",
+		"missing remote":   "workspace: a\nsync:\n  - local: .\n",
+		"relative remote":  "sync:\n  - remote: project\n",
+		"unknown mode":     "mode: twoway\nsync:\n  - remote: /home/coder/project\n",
+		"negative timeout": "workspace: a\ntimeout: -1m\n",
+	} {
+		_, err := parseWorkflow([]byte(raw))
+		assert.Error(t, name, err)
+	}
+}
+
+func Test_stopWorkflowSync(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sleep")
+	}
+	// The pid recorded by "coder up" was reused by another process since the
+	// sync exited, which must not be killed.
+	other := exec.Command("sleep", "30")
+	assert.Success(t, "start process", other.Start())
+	t.Cleanup(func() { _ = other.Process.Kill() })
+	exited := make(chan struct{})
+	go func() {
+		_ = other.Wait()
+		close(exited)
+	}()
+
+	workspace, localDir := "my-workspace", t.TempDir()
+	statePath, _, _, err := workflowSyncPaths(workspace, localDir)
+	assert.Success(t, "paths", err)
+	state, err := json.Marshal(workflowSyncState{PID: other.Process.Pid, Workspace: workspace, LocalDir: localDir})
+	assert.Success(t, "marshal state", err)
+	assert.Success(t, "write state", ioutil.WriteFile(statePath, state, 0600))
+
+	assert.Success(t, "stop", stopWorkflowSync(workspace, localDir))
+	select {
+	case <-exited:
+		t.Fatal("killed a process that isn't the sync")
+	case <-time.After(100 * time.Millisecond):
+	}
+	_, err = os.Stat(statePath)
+	assert.True(t, "state removed", os.IsNotExist(err))
+}
@@ -9,6 +9,8 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,9 +18,9 @@ import (
 
 	"cdr.dev/coder-cli/coder-sdk"
 	"cdr.dev/coder-cli/internal/coderutil"
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/internal/x/xcobra"
 	"cdr.dev/coder-cli/pkg/clog"
-	"cdr.dev/coder-cli/pkg/tablewriter"
 	"cdr.dev/coder-cli/wsnet"
 
 	"github.com/fatih/color"
@@ -31,6 +33,28 @@ import (
 
 const defaultImgTag = "latest"
 
+// imageDigestPattern matches the content digest of an image, which unlike a
+// tag always refers to the same image.
+var imageDigestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// checkImageDigest validates the --from-image-digest flag of cmd, which
+// replaces its --tag flag.
+func checkImageDigest(cmd *cobra.Command, digest string) error {
+	if digest == "" {
+		return nil
+	}
+	if cmd.Flags().Changed("tag") {
+		return xerrors.New("--tag and --from-image-digest are mutually exclusive")
+	}
+	if !imageDigestPattern.MatchString(digest) {
+		return clog.Error(i18n.Sprintf("invalid image digest %q", digest),
+			clog.BlankLine,
+			clog.Hintf(`digests have the form "sha256:" followed by 64 lowercase hex characters`),
+		)
+	}
+	return nil
+}
+
 func envCmd() *cobra.Command {
 	cmd := workspacesCmd()
 	cmd.Use = "envs"
@@ -48,43 +72,67 @@ func workspacesCmd() *cobra.Command {
 	}
 
 	cmd.AddCommand(
+		agentsWorkspaceCmd(),
 		createWorkspaceCmd(),
+		workspaceDiskCmd(),
 		editWorkspaceCmd(),
+		execScriptCmd(),
+		inspectWorkspaceCmd(),
 		lsWorkspacesCommand(),
 		pingWorkspaceCommand(),
 		rebuildWorkspaceCommand(),
+		rightsizingCmd(),
 		rmWorkspacesCmd(),
 		setPolicyTemplate(),
+		startWorkspacesCmd(),
 		stopWorkspacesCmd(),
 		watchBuildLogCommand(),
+		watchWorkspaceCmd(),
 		workspaceFromConfigCmd(false),
 		workspaceFromConfigCmd(true),
 	)
 	return cmd
 }
 
-const (
-	humanOutput = "human"
-	jsonOutput  = "json"
-)
-
 func lsWorkspacesCommand() *cobra.Command {
 	var (
-		outputFmt string
-		user      string
-		provider  string
+		user     string
+		provider string
+		org      string
+		status   string
+		allOrgs  bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "ls",
 		Short: "list all workspaces owned by the active user",
-		Long:  "List all Coder workspaces owned by the active user.",
+		Long: "List all Coder workspaces owned by the active user.\n\n" +
+			"Site admins can list the workspaces of all users and organizations with --all-orgs, " +
+			"which shows the owner, organization, provider, status and last activity of each workspace.\n\n" +
+			"Workspaces whose disk is filling up, as reported by their agents, are warned about after the list.",
+		Example: `coder workspaces ls
+
+# see the workspaces the way another user sees them (site admin only)
+coder workspaces ls --as charlie@coder.com --as-reason "support ticket 1234"
+
+# list the stopped workspaces of an organization, across all users (site admin only)
+coder workspaces ls --all-orgs --org engineering --status off
+
+# stream the workspaces of all users one JSON object per line, as they are received (site admin only)
+coder workspaces ls --all-orgs --output ndjson | jq -r 'select(.status == "OFF") | .name'`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 			client, err := newClient(ctx, true)
 			if err != nil {
 				return err
 			}
+			if allOrgs {
+				owner := ""
+				if cmd.Flags().Changed("user") {
+					owner = user
+				}
+				return listAllWorkspaces(cmd, client, owner, provider, org, status)
+			}
 			workspaces, err := getWorkspaces(ctx, client, user)
 			if err != nil {
 				return err
@@ -95,46 +143,199 @@ func lsWorkspacesCommand() *cobra.Command {
 					return err
 				}
 			}
+			workspaces, err = filterWorkspaces(ctx, client, workspaces, org, status)
+			if err != nil {
+				return err
+			}
 			if len(workspaces) < 1 {
 				clog.LogInfo("no workspaces found")
 				workspaces = []coder.Workspace{} // ensures that json output still marshals
 			}
 
-			switch outputFmt {
-			case humanOutput:
-				workspaces, err := coderutil.WorkspacesHumanTable(ctx, client, workspaces)
+			return writeOutput(cmd.OutOrStdout(), workspaces, func() error {
+				rows, err := coderutil.WorkspacesHumanTable(ctx, client, workspaces)
 				if err != nil {
 					return err
 				}
-				err = tablewriter.WriteTable(cmd.OutOrStdout(), len(workspaces), func(i int) interface{} {
-					return workspaces[i]
+				err = writeTable(cmd.OutOrStdout(), len(rows), func(i int) interface{} {
+					return rows[i]
 				})
 				if err != nil {
 					return xerrors.Errorf("write table: %w", err)
 				}
-			case jsonOutput:
-				err := json.NewEncoder(cmd.OutOrStdout()).Encode(workspaces)
-				if err != nil {
-					return xerrors.Errorf("write workspaces as JSON: %w", err)
+				for _, w := range workspaces {
+					if p := w.LatestStat.DiskPressure; p == coder.DiskPressureWarning || p == coder.DiskPressureCritical {
+						warnDiskPressure(w.Name, p)
+					}
 				}
-			default:
-				return xerrors.Errorf("unknown --output value %q", outputFmt)
-			}
-			return nil
+				return nil
+			})
 		},
 	}
 
 	cmd.Flags().StringVar(&user, "user", coder.Me, "Specify the user whose resources to target")
-	cmd.Flags().StringVarP(&outputFmt, "output", "o", humanOutput, "human | json")
+	addOutputShorthand(cmd)
 	cmd.Flags().StringVarP(&provider, "provider", "p", "", "Filter workspaces by a particular workspace provider name.")
+	cmd.Flags().StringVar(&org, "org", "", "Filter workspaces by organization name.")
+	cmd.Flags().StringVar(&status, "status", "", "Filter workspaces by status: on, off, creating, failed or unknown.")
+	completeFlagChoices(cmd, "status", "on", "off", "creating", "failed", "unknown")
+	cmd.Flags().BoolVar(&allOrgs, "all-orgs", false, "List the workspaces of all users and organizations, filtered by --user only if given (site admin only).")
+	addImpersonationFlags(cmd)
+	docsSamples(cmd, "workspaces ls", "workspaces ls --output json")
 
 	return cmd
 }
 
+// listAllWorkspaces writes the workspaces of all users and organizations,
+// filtered by the owner email, provider, organization and status when given.
+// With --output ndjson, each workspace is written as soon as it is decoded
+// from the response, unsorted, instead of once they all are.
+func listAllWorkspaces(cmd *cobra.Command, client coder.Client, owner, provider, org, status string) error {
+	ctx := cmd.Context()
+	match, err := workspaceMatcher(ctx, client, owner, provider, org, status)
+	if err != nil {
+		return err
+	}
+	listErr := func(err error) error {
+		return clog.Error("failed to list the workspaces of all users",
+			err.Error(),
+			clog.BlankLine,
+			clog.Tipf("--all-orgs is only available to site admins"),
+		)
+	}
+
+	if outputFormat == ndjsonOutput {
+		row, err := coderutil.OwnedWorkspaceRow(ctx, client)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		var writeErr error
+		err = client.EachWorkspace(ctx, func(w coder.Workspace) error {
+			if !match(w) {
+				return nil
+			}
+			if err := enc.Encode(row(w)); err != nil {
+				writeErr = xerrors.Errorf("write JSON: %w", err)
+				return writeErr
+			}
+			return nil
+		})
+		if writeErr != nil {
+			return writeErr
+		}
+		if err != nil {
+			return listErr(err)
+		}
+		return nil
+	}
+
+	workspaces, err := client.Workspaces(ctx)
+	if err != nil {
+		return listErr(err)
+	}
+	filtered := make([]coder.Workspace, 0, len(workspaces))
+	for _, w := range workspaces {
+		if match(w) {
+			filtered = append(filtered, w)
+		}
+	}
+
+	rows, err := coderutil.OwnedWorkspacesTable(ctx, client, filtered)
+	if err != nil {
+		return err
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Owner != rows[j].Owner {
+			return rows[i].Owner < rows[j].Owner
+		}
+		return rows[i].Name < rows[j].Name
+	})
+
+	return writeOutput(cmd.OutOrStdout(), rows, func() error {
+		if len(rows) < 1 {
+			clog.LogInfo("no workspaces found")
+			return nil
+		}
+		err := writeTable(cmd.OutOrStdout(), len(rows), func(i int) interface{} {
+			return rows[i]
+		})
+		if err != nil {
+			return xerrors.Errorf("write table: %w", err)
+		}
+		return nil
+	})
+}
+
+// filterWorkspaces keeps the workspaces in the organization with the given
+// name and with the given status, when they're not empty.
+func filterWorkspaces(ctx context.Context, client coder.Client, workspaces []coder.Workspace, org, status string) ([]coder.Workspace, error) {
+	match, err := workspaceMatcher(ctx, client, "", "", org, status)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]coder.Workspace, 0, len(workspaces))
+	for _, w := range workspaces {
+		if match(w) {
+			filtered = append(filtered, w)
+		}
+	}
+	return filtered, nil
+}
+
+// workspaceMatcher returns whether a workspace is owned by the user with the
+// given email, is on the provider and in the organization with the given
+// names, and has the given status, ignoring those that are empty.
+func workspaceMatcher(ctx context.Context, client coder.Client, owner, provider, org, status string) (func(coder.Workspace) bool, error) {
+	var ownerID, providerID, orgID string
+	if owner != "" {
+		user, err := client.UserByEmail(ctx, owner)
+		if err != nil {
+			return nil, xerrors.Errorf("get user: %w", err)
+		}
+		ownerID = user.ID
+	}
+	if provider != "" {
+		wp, err := coderutil.ProviderByName(ctx, client, provider)
+		if err != nil {
+			return nil, xerrors.Errorf("get workspace provider %q: %w", provider, err)
+		}
+		providerID = wp.ID
+	}
+	if org != "" {
+		orgs, err := client.Organizations(ctx)
+		if err != nil {
+			return nil, xerrors.Errorf("get organizations: %w", err)
+		}
+		for _, o := range orgs {
+			if o.Name == org {
+				orgID = o.ID
+			}
+		}
+		if orgID == "" {
+			return nil, xerrors.Errorf("organization %q not found", org)
+		}
+	}
+	status = strings.ToUpper(status)
+	switch coder.WorkspaceStatus(status) {
+	case "", coder.WorkspaceOn, coder.WorkspaceOff, coder.WorkspaceCreating, coder.WorkspaceFailed, coder.WorkspaceUnknown:
+	default:
+		return nil, xerrors.Errorf("invalid --status %q: must be on, off, creating, failed or unknown", strings.ToLower(status))
+	}
+
+	return func(w coder.Workspace) bool {
+		return (ownerID == "" || w.UserID == ownerID) &&
+			(providerID == "" || w.ResourcePoolID == providerID) &&
+			(orgID == "" || w.OrganizationID == orgID) &&
+			(status == "" || string(w.LatestStat.ContainerStatus) == status)
+	}, nil
+}
+
 func pingWorkspaceCommand() *cobra.Command {
 	var (
 		schemes []string
 		count   int
+		trace   wsnetTraceFlags
 	)
 
 	cmd := &cobra.Command{
@@ -163,10 +364,17 @@ func pingWorkspaceCommand() *cobra.Command {
 				iceSchemes[scheme] = nil
 			}
 
+			tracer, closeTrace, err := trace.open()
+			if err != nil {
+				return err
+			}
+			defer func() { _ = closeTrace() }()
+
 			pinger := &wsPinger{
 				client:     client,
 				workspace:  workspace,
 				iceSchemes: iceSchemes,
+				trace:      tracer,
 			}
 
 			seq := 0
@@ -191,6 +399,8 @@ func pingWorkspaceCommand() *cobra.Command {
 
 	cmd.Flags().StringSliceVarP(&schemes, "scheme", "s", []string{"stun", "stuns", "turn", "turns"}, "customize schemes to filter ice servers")
 	cmd.Flags().IntVarP(&count, "count", "c", 0, "stop after <count> replies")
+	completeFlagChoices(cmd, "scheme", "stun", "stuns", "turn", "turns")
+	trace.register(cmd)
 	return cmd
 }
 
@@ -199,6 +409,7 @@ type wsPinger struct {
 	workspace  *coder.Workspace
 	dialer     *wsnet.Dialer
 	iceSchemes map[ice.SchemeType]interface{}
+	trace      *wsnet.Tracer
 	tunneled   bool
 }
 
@@ -255,13 +466,20 @@ func (w *wsPinger) ping(ctx context.Context) error {
 			w.logFail(fmt.Sprintf("workspace is unreachable (status=%s)", workspace.LatestStat.ContainerStatus))
 			return nil
 		}
+		hc, err := newHTTPClient(ctx)
+		if err != nil {
+			return err
+		}
 		connectStart := time.Now()
 		w.dialer, err = wsnet.DialWebsocket(ctx, wsnet.ConnectEndpoint(&url, w.workspace.ID, w.client.Token()), &wsnet.DialOptions{
 			ICEServers:         filteredServers,
+			Trace:              w.trace,
 			TURNProxyAuthToken: w.client.Token(),
 			TURNRemoteProxyURL: &url,
 			TURNLocalProxyURL:  &url,
-		}, &websocket.DialOptions{})
+			HTTPClient:         hc,
+			VerifyIdentity:     identityVerifier(&url, w.workspace, ""),
+		}, &websocket.DialOptions{HTTPClient: hc})
 		if err != nil {
 			w.logFail(fmt.Sprintf("dial workspace: %s", err.Error()))
 			return nil
@@ -329,56 +547,165 @@ func (w *wsPinger) ping(ctx context.Context) error {
 }
 
 func stopWorkspacesCmd() *cobra.Command {
-	var user string
+	var (
+		user     string
+		pick     bool
+		batch    workspaceBatch
+		idleFor  time.Duration
+		dryRun   bool
+		force    bool
+		schedule string
+	)
 	cmd := &cobra.Command{
 		Use:   "stop [...workspace_names]",
 		Short: "stop Coder workspaces by name",
-		Long:  "Stop Coder workspaces by name",
+		Long: "Stop Coder workspaces by name.\n\n" +
+			"With --idle-for, only workspaces nobody has connected to for that long are stopped. " +
+			"A workspace is idle from its last connection through the agent, or from its last build if nobody connected since. " +
+			"Combined with --all, this makes an idle workspace reaper; --schedule prints a cron entry that runs it.",
 		Example: `coder workspaces stop front-end-workspace
 coder workspaces stop front-end-workspace backend-workspace
 
-# stop all of your workspaces
-coder workspaces ls -o json | jq -c '.[].name' | xargs coder workspaces stop
+# stop the workspaces whose name starts with "ci-"
+coder workspaces stop 'ci-*'
+
+# stop all workspaces of a given user
+coder workspaces stop --all --user charlie@coder.com --force
 
-# stop all workspaces for a given user
-coder workspaces --user charlie@coder.com ls -o json \
-	| jq -c '.[].name' \
-	| xargs coder workspaces --user charlie@coder.com stop`,
-		Args: cobra.MinimumNArgs(1),
+# stop every workspace before a maintenance window, 20 at a time (requires site admin)
+coder workspaces stop --all --parallel 20 --force
+
+# choose which workspaces to stop from a list
+coder workspaces stop --pick
+
+# list the workspaces of every user that nobody used for a day (requires site admin)
+coder workspaces stop --all --idle-for 24h --dry-run
+
+# stop them every hour from cron
+(crontab -l 2>/dev/null; coder workspaces stop --all --idle-for 24h --schedule '0 * * * *') | crontab -`,
+		Args: batch.args(&pick),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
+			if idleFor < 0 {
+				return xerrors.New("--idle-for must not be negative")
+			}
+			if schedule != "" {
+				if !batch.all {
+					return xerrors.New("--schedule requires --all")
+				}
+				entry, err := stopCronEntry(cmd, schedule)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), entry)
+				return nil
+			}
+
 			client, err := newClient(ctx, true)
 			if err != nil {
 				return xerrors.Errorf("new client: %w", err)
 			}
+			if pick {
+				if args, err = pickWorkspaces(ctx, client, user, "stop"); err != nil {
+					return err
+				}
+			}
+			workspaces, err := batch.resolve(ctx, cmd, client, user, args)
+			if err != nil {
+				return err
+			}
+			if batch.all {
+				return stopAllWorkspaces(ctx, client, workspaces, idleFor, dryRun, force, batch.parallel)
+			}
 
-			egroup := clog.LoggedErrGroup()
-			for _, workspaceName := range args {
-				workspaceName := workspaceName
-				egroup.Go(func() error {
-					workspace, err := findWorkspace(ctx, client, workspaceName, user)
-					if err != nil {
-						return err
-					}
-
-					if err = client.StopWorkspace(ctx, workspace.ID); err != nil {
-						return clog.Error(fmt.Sprintf("stop workspace %q", workspace.Name),
-							clog.Causef(err.Error()), clog.BlankLine,
-							clog.Hintf("current workspace status is %q", workspace.LatestStat.ContainerStatus),
-						)
-					}
-					clog.LogSuccess(fmt.Sprintf("successfully stopped workspace %q", workspaceName))
+			return batch.run(workspaces, func(workspace coder.Workspace) error {
+				if idleFor > 0 && !isIdle(workspace, idleFor, time.Now()) {
+					clog.LogInfo(i18n.Sprintf("skipped workspace %q, last active %s ago", workspace.Name, time.Since(lastActive(workspace)).Round(time.Minute)))
 					return nil
-				})
-			}
+				}
+				if dryRun {
+					clog.LogInfo(i18n.Sprintf("would stop workspace %q", workspace.Name))
+					return nil
+				}
+				return stopWorkspace(ctx, client, workspace)
+			})
+		},
+	}
+	cmd.Flags().StringVar(&user, "user", coder.Me, "Specify the user whose resources to target")
+	cmd.Flags().BoolVar(&pick, "pick", false, "interactively select the workspaces to stop")
+	batch.register(cmd, "stop")
+	cmd.Flags().DurationVar(&idleFor, "idle-for", 0, "only stop workspaces that nobody connected to for this long")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show which workspaces would be stopped without stopping them")
+	cmd.Flags().BoolVar(&force, "force", false, "stop with --all without showing a confirmation prompt")
+	cmd.Flags().StringVar(&schedule, "schedule", "", "print a crontab entry that runs this command on the given cron schedule, instead of running it")
+	addImpersonationFlags(cmd)
+	return cmd
+}
 
-			return egroup.Wait()
+func startWorkspacesCmd() *cobra.Command {
+	var (
+		user  string
+		pick  bool
+		batch workspaceBatch
+	)
+	cmd := &cobra.Command{
+		Use:   "start [...workspace_names]",
+		Short: "start stopped Coder workspaces by name",
+		Long: "Start Coder workspaces that are off or failed, by rebuilding them. Workspaces that are " +
+			"already on or being built are skipped.",
+		Example: `coder workspaces start front-end-workspace
+
+# start the workspaces whose name starts with "ci-"
+coder workspaces start 'ci-*'
+
+# start all your stopped workspaces
+coder workspaces start --all --user me`,
+		Args: batch.args(&pick),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			if pick {
+				if args, err = pickWorkspaces(ctx, client, user, "start"); err != nil {
+					return err
+				}
+			}
+			workspaces, err := batch.resolve(ctx, cmd, client, user, args)
+			if err != nil {
+				return err
+			}
+			return batch.run(workspaces, func(workspace coder.Workspace) error {
+				return startWorkspace(ctx, client, workspace)
+			})
 		},
 	}
 	cmd.Flags().StringVar(&user, "user", coder.Me, "Specify the user whose resources to target")
+	cmd.Flags().BoolVar(&pick, "pick", false, "interactively select the workspaces to start")
+	batch.register(cmd, "start")
+	addImpersonationFlags(cmd)
 	return cmd
 }
 
+// startWorkspace starts the workspace unless it is already on or being
+// built. Starting a stopped workspace rebuilds it.
+func startWorkspace(ctx context.Context, client coder.Client, workspace coder.Workspace) error {
+	switch workspace.LatestStat.ContainerStatus {
+	case coder.WorkspaceOn, coder.WorkspaceCreating:
+		clog.LogInfo(i18n.Sprintf("skipped workspace %q, it is already %s", workspace.Name, strings.ToLower(string(workspace.LatestStat.ContainerStatus))))
+		return nil
+	}
+	if err := client.RebuildWorkspace(ctx, workspace.ID); err != nil {
+		return clog.Error(i18n.Sprintf("failed to start workspace %q", workspace.Name), clog.Causef(err.Error()))
+	}
+	clog.LogSuccess(
+		fmt.Sprintf("started workspace %q", workspace.Name),
+		clog.Tipf("run \"coder workspaces watch %s\" to wait until it is on", workspace.Name),
+	)
+	return nil
+}
+
 func createWorkspaceCmd() *cobra.Command {
 	var (
 		org             string
@@ -388,24 +715,74 @@ func createWorkspaceCmd() *cobra.Command {
 		gpus            int
 		img             string
 		tag             string
+		digest          string
 		follow          bool
 		useCVM          bool
 		providerName    string
 		enableAutostart bool
+		scheduling      schedulingFlags
+		fromConfig      string
+		force           bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "create [workspace_name]",
 		Short: "create a new workspace.",
-		Args:  xcobra.ExactArgs(1),
-		Long:  "Create a new Coder workspace.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if fromConfig != "" {
+				return cobra.MaximumNArgs(1)(cmd, args)
+			}
+			return xcobra.ExactArgs(1)(cmd, args)
+		},
+		Long: "Create a new Coder workspace.\n\n" +
+			"With --from-config, the workspace is declared in a YAML or JSON spec file instead of flags, and is " +
+			"created if it doesn't exist, edited to match the spec if it differs, or left alone if it matches, " +
+			"so that the same spec can be applied again and again:\n\n" +
+			"  name: my-workspace        # or given as the argument\n" +
+			"  org: engineering          # required for members of several organizations\n" +
+			"  image: ubuntu\n" +
+			"  tag: latest               # or digest: sha256:<digest>\n" +
+			"  provider: us-east         # the default provider when omitted\n" +
+			"  cpu: 4                    # cpu, memory and disk default to those of the image\n" +
+			"  memory: 8\n" +
+			"  disk: 30\n" +
+			"  gpus: 0\n" +
+			"  container_vm: false\n" +
+			"  autostart: false          # only applied on creation\n" +
+			"  scheduling:\n" +
+			"    node_selector: {pool: gpu}\n" +
+			"    tolerations: [\"nvidia.com/gpu:NoSchedule\"]\n" +
+			"    region: us-east-1\n\n" +
+			"The provider of a workspace and whether it is a container-based VM can't be changed, and its disk can't be shrunk.",
 		Example: `# create a new workspace using default resource amounts
 coder workspaces create my-new-workspace --image ubuntu
-coder workspaces create my-new-powerful-workspace --cpu 12 --disk 100 --memory 16 --image ubuntu`,
+coder workspaces create my-new-powerful-workspace --cpu 12 --disk 100 --memory 16 --image ubuntu
+
+# pin the workspace to the exact image, even if its tags are moved later
+coder workspaces create my-pinned-workspace --image ubuntu --from-image-digest sha256:<digest>
+
+# schedule the workspace onto the GPU node pool of the provider
+coder workspaces create my-gpu-workspace --image ubuntu --gpus 1 --node-selector pool=gpu --toleration nvidia.com/gpu:NoSchedule
+
+# create or update the workspace declared in a spec file, such as from CI
+coder workspaces create --from-config workspace.yaml --force`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
+			if fromConfig != "" {
+				return createWorkspaceFromSpec(cmd, fromConfig, args, force, follow)
+			}
 			if img == "" {
-				return xerrors.New("image unset")
+				return xerrors.New("--image is required, or a spec file with --from-config")
+			}
+			if err := checkImageDigest(cmd, digest); err != nil {
+				return err
+			}
+			hints, err := scheduling.hints(cmd, nil)
+			if err != nil {
+				return err
+			}
+			if digest != "" {
+				tag = ""
 			}
 
 			client, err := newClient(ctx, true)
@@ -449,6 +826,7 @@ coder workspaces create my-new-powerful-workspace --cpu 12 --disk 100 --memory 1
 				ImageID:         importedImg.ID,
 				OrgID:           importedImg.OrganizationID,
 				ImageTag:        tag,
+				ImageDigest:     digest,
 				CPUCores:        cpu,
 				MemoryGB:        memory,
 				DiskGB:          disk,
@@ -457,6 +835,7 @@ coder workspaces create my-new-powerful-workspace --cpu 12 --disk 100 --memory 1
 				ResourcePoolID:  provider.ID,
 				Namespace:       provider.DefaultNamespace,
 				EnableAutoStart: enableAutostart,
+				SchedulingHints: hints,
 			}
 
 			// if any of these defaulted to their zero value we provision
@@ -475,6 +854,7 @@ coder workspaces create my-new-powerful-workspace --cpu 12 --disk 100 --memory 1
 			if err != nil {
 				return xerrors.Errorf("create workspace: %w", err)
 			}
+			refreshSSHConfig(ctx, client)
 
 			if follow {
 				clog.LogSuccess("creating workspace...")
@@ -493,6 +873,7 @@ coder workspaces create my-new-powerful-workspace --cpu 12 --disk 100 --memory 1
 	}
 	cmd.Flags().StringVarP(&org, "org", "o", "", "name of the organization the workspace should be created under.")
 	cmd.Flags().StringVarP(&tag, "tag", "t", defaultImgTag, "tag of the image the workspace will be based off of.")
+	cmd.Flags().StringVar(&digest, "from-image-digest", "", "digest of the image the workspace will be based off of, such as sha256:<digest>, instead of a tag.")
 	cmd.Flags().Float32VarP(&cpu, "cpu", "c", 0, "number of cpu cores the workspace should be provisioned with.")
 	cmd.Flags().Float32VarP(&memory, "memory", "m", 0, "GB of RAM a workspace should be provisioned with.")
 	cmd.Flags().IntVarP(&disk, "disk", "d", 0, "GB of disk storage a workspace should be provisioned with.")
@@ -502,10 +883,52 @@ coder workspaces create my-new-powerful-workspace --cpu 12 --disk 100 --memory 1
 	cmd.Flags().BoolVar(&follow, "follow", false, "follow buildlog after initiating rebuild")
 	cmd.Flags().BoolVar(&useCVM, "container-based-vm", false, "deploy the workspace as a Container-based VM")
 	cmd.Flags().BoolVar(&enableAutostart, "enable-autostart", false, "automatically start this workspace at your preferred time.")
-	_ = cmd.MarkFlagRequired("image")
+	scheduling.register(cmd)
+	cmd.Flags().StringVar(&fromConfig, "from-config", "", "path of a YAML or JSON spec of the workspace to create or update, or - to read it from stdin")
+	cmd.Flags().BoolVar(&force, "force", false, "with --from-config, rebuild a running workspace to apply changes without a confirmation prompt")
+	_ = cmd.MarkFlagFilename("from-config", "yaml", "yml", "json")
 	return cmd
 }
 
+// createWorkspaceFromSpec applies the spec at path, named by the argument if
+// given.
+func createWorkspaceFromSpec(cmd *cobra.Command, path string, args []string, force, follow bool) error {
+	ctx := cmd.Context()
+	for _, name := range specFlags {
+		if cmd.Flags().Changed(name) {
+			return xerrors.Errorf("--%s can't be combined with --from-config, set it in the spec instead", name)
+		}
+	}
+	spec, err := readWorkspaceSpec(path, cmd.InOrStdin())
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		spec.Name = args[0]
+	}
+	if spec.Name == "" {
+		return clog.Error("Must provide a workspace name.",
+			clog.BlankLine,
+			clog.Tipf("set name in the spec, or give it as the argument"),
+		)
+	}
+
+	client, err := newClient(ctx, true)
+	if err != nil {
+		return err
+	}
+	workspace, err := applyWorkspaceSpec(ctx, client, spec, force)
+	if err != nil || workspace == nil {
+		return err
+	}
+	refreshSSHConfig(ctx, client)
+	if follow {
+		return trailBuildLogs(ctx, client, workspace.ID)
+	}
+	clog.LogInfo(i18n.Sprintf(`run "coder workspaces watch-build %s" to trail the build logs`, workspace.Name))
+	return nil
+}
+
 // selectOrg finds the organization in the list or returns the default organization
 // if the needle isn't found.
 func selectOrg(needle string, haystack []coder.Organization) (*coder.Organization, error) {
@@ -647,6 +1070,9 @@ func workspaceFromConfigCmd(update bool) *cobra.Command {
 		if err != nil {
 			return handleAPIError(err)
 		}
+		if !update {
+			refreshSSHConfig(ctx, client)
+		}
 
 		if follow {
 			clog.LogSuccess("creating workspace...")
@@ -695,6 +1121,7 @@ coder envs create-from-config --name="dev-env" -f coder.yaml`,
 
 	cmd.Flags().StringVarP(&filepath, "filepath", "f", "", "path to local template file.")
 	cmd.Flags().BoolVar(&follow, "follow", false, "follow buildlog after initiating rebuild")
+	_ = cmd.MarkFlagFilename("filepath", "yaml", "yml")
 	return cmd
 }
 
@@ -703,6 +1130,7 @@ func editWorkspaceCmd() *cobra.Command {
 		org    string
 		img    string
 		tag    string
+		digest string
 		cpu    float32
 		memory float32
 		disk   int
@@ -710,6 +1138,8 @@ func editWorkspaceCmd() *cobra.Command {
 		follow bool
 		user   string
 		force  bool
+
+		scheduling schedulingFlags
 	)
 
 	cmd := &cobra.Command{
@@ -719,9 +1149,17 @@ func editWorkspaceCmd() *cobra.Command {
 		Long:  "Edit an existing workspace and initate a rebuild.",
 		Example: `coder workspaces edit back-end-workspace --cpu 4
 
-coder workspaces edit back-end-workspace --disk 20`,
+coder workspaces edit back-end-workspace --disk 20
+
+coder workspaces edit back-end-workspace --from-image-digest sha256:<digest>
+
+# move the workspace to another region, keeping its other scheduling hints
+coder workspaces edit back-end-workspace --region eu-west-1`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
+			if err := checkImageDigest(cmd, digest); err != nil {
+				return err
+			}
 			client, err := newClient(ctx, true)
 			if err != nil {
 				return err
@@ -744,6 +1182,11 @@ coder workspaces edit back-end-workspace --disk 20`,
 				return xerrors.New("org is required for multi-org members")
 			}
 
+			// The default of --tag is only used when the image changes, so that
+			// editing other resources keeps the workspace on its tag.
+			if !cmd.Flags().Changed("tag") {
+				tag = ""
+			}
 			req, err := buildUpdateReq(ctx, client, updateConf{
 				cpu:       cpu,
 				memGB:     memory,
@@ -753,11 +1196,15 @@ coder workspaces edit back-end-workspace --disk 20`,
 				user:      user,
 				image:     img,
 				imageTag:  tag,
+				digest:    digest,
 				orgName:   org,
 			})
 			if err != nil {
 				return err
 			}
+			if req.SchedulingHints, err = scheduling.hints(cmd, workspace.SchedulingHints); err != nil {
+				return err
+			}
 
 			if !force && workspace.LatestStat.ContainerStatus == coder.WorkspaceOn {
 				_, err = (&promptui.Prompt{
@@ -793,7 +1240,8 @@ coder workspaces edit back-end-workspace --disk 20`,
 	}
 	cmd.Flags().StringVarP(&org, "org", "o", "", "name of the organization the workspace should be created under.")
 	cmd.Flags().StringVarP(&img, "image", "i", "", "name of the image you want the workspace to be based off of.")
-	cmd.Flags().StringVarP(&tag, "tag", "t", "latest", "image tag of the image you want to base the workspace off of.")
+	cmd.Flags().StringVarP(&tag, "tag", "t", "latest", "image tag of the image you want to base the workspace off of. The tag is kept unless this flag or --image is given.")
+	cmd.Flags().StringVar(&digest, "from-image-digest", "", "digest of the image you want to base the workspace off of, such as sha256:<digest>, instead of a tag.")
 	cmd.Flags().Float32VarP(&cpu, "cpu", "c", 0, "The number of cpu cores the workspace should be provisioned with.")
 	cmd.Flags().Float32VarP(&memory, "memory", "m", 0, "The amount of RAM a workspace should be provisioned with.")
 	cmd.Flags().IntVarP(&disk, "disk", "d", 0, "The amount of disk storage a workspace should be provisioned with.")
@@ -801,6 +1249,7 @@ coder workspaces edit back-end-workspace --disk 20`,
 	cmd.Flags().BoolVar(&follow, "follow", false, "follow buildlog after initiating rebuild")
 	cmd.Flags().StringVar(&user, "user", coder.Me, "Specify the user whose resources to target")
 	cmd.Flags().BoolVar(&force, "force", false, "force rebuild without showing a confirmation prompt")
+	scheduling.register(cmd)
 	return cmd
 }
 
@@ -808,21 +1257,40 @@ func rmWorkspacesCmd() *cobra.Command {
 	var (
 		force bool
 		user  string
+		pick  bool
+		batch workspaceBatch
 	)
 
 	cmd := &cobra.Command{
 		Use:   "rm [...workspace_names]",
 		Short: "remove Coder workspaces by name",
-		Args:  cobra.MinimumNArgs(1),
+		Long: "Remove Coder workspaces by name. Names may be glob patterns, such as \"ci-*\", " +
+			"and --all removes every workspace of --user, or of every user for site admins.",
+		Example: `coder workspaces rm my-workspace
+coder workspaces rm 'ci-*' --force`,
+		Args: batch.args(&pick),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 			client, err := newClient(ctx, true)
 			if err != nil {
 				return err
 			}
+			if pick {
+				if args, err = pickWorkspaces(ctx, client, user, "remove"); err != nil {
+					return err
+				}
+			}
+			workspaces, err := batch.resolve(ctx, cmd, client, user, args)
+			if err != nil {
+				return err
+			}
+			if len(workspaces) == 0 {
+				clog.LogInfo("no workspaces to remove")
+				return nil
+			}
 			if !force {
 				confirm := promptui.Prompt{
-					Label:     fmt.Sprintf("Delete workspaces %q? (all data will be lost)", args),
+					Label:     fmt.Sprintf("Delete %s? (all data will be lost)", workspaceNames(workspaces)),
 					IsConfirm: true,
 				}
 				if _, err := confirm.Run(); err != nil {
@@ -833,29 +1301,25 @@ func rmWorkspacesCmd() *cobra.Command {
 				}
 			}
 
-			egroup := clog.LoggedErrGroup()
-			for _, workspaceName := range args {
-				workspaceName := workspaceName
-				egroup.Go(func() error {
-					workspace, err := findWorkspace(ctx, client, workspaceName, user)
-					if err != nil {
-						return err
-					}
-					if err = client.DeleteWorkspace(ctx, workspace.ID); err != nil {
-						return clog.Error(
-							fmt.Sprintf(`failed to delete workspace "%s"`, workspace.Name),
-							clog.Causef(err.Error()),
-						)
-					}
-					clog.LogSuccess(fmt.Sprintf("deleted workspace %q", workspace.Name))
-					return nil
-				})
-			}
-			return egroup.Wait()
+			err = batch.run(workspaces, func(workspace coder.Workspace) error {
+				if err := client.DeleteWorkspace(ctx, workspace.ID); err != nil {
+					return clog.Error(
+						fmt.Sprintf(`failed to delete workspace "%s"`, workspace.Name),
+						clog.Causef(err.Error()),
+					)
+				}
+				clog.LogSuccess(i18n.Sprintf("deleted workspace %q", workspace.Name))
+				return nil
+			})
+			refreshSSHConfig(ctx, client)
+			return err
 		},
 	}
 	cmd.Flags().BoolVarP(&force, "force", "f", false, "force remove the specified workspaces without prompting first")
 	cmd.Flags().StringVar(&user, "user", coder.Me, "Specify the user whose resources to target")
+	cmd.Flags().BoolVar(&pick, "pick", false, "interactively select the workspaces to remove")
+	batch.register(cmd, "remove")
+	keepExamples(cmd)
 	return cmd
 }
 
@@ -868,6 +1332,7 @@ type updateConf struct {
 	user      string
 	image     string
 	imageTag  string
+	digest    string
 	orgName   string
 }
 
@@ -950,14 +1415,19 @@ func buildUpdateReq(ctx context.Context, client coder.Client, conf updateConf) (
 		updateReq.GPUs = &conf.gpus
 	}
 
-	if conf.imageTag == "" {
+	if conf.digest != "" {
+		updateReq.ImageDigest = &conf.digest
+		return &updateReq, nil
+	}
+	switch {
+	case conf.imageTag != "":
+		updateReq.ImageTag = &conf.imageTag
+	case conf.image != "":
 		// We're forced to make an alloc here because untyped string consts are not addressable.
 		// i.e.  updateReq.ImageTag = &defaultImgTag results in :
 		// invalid operation: cannot take address of defaultImgTag (untyped string constant "latest")
 		imgTag := defaultImgTag
 		updateReq.ImageTag = &imgTag
-	} else {
-		updateReq.ImageTag = &conf.imageTag
 	}
 	return &updateReq, nil
 }
@@ -976,6 +1446,12 @@ func setPolicyTemplate() *cobra.Command {
 		Use:   "policy-template",
 		Short: "Set workspace policy template",
 		Long:  "Set workspace policy template or restore to default configuration. This feature is for site admins only.",
+		Example: `# check how a template would affect the existing workspaces before setting it
+coder workspaces policy-template --filepath ./policy.yaml --dry-run
+coder workspaces policy-template --filepath ./policy.yaml
+
+# restore the default template
+coder workspaces policy-template --default`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 			client, err := newClient(ctx, true)
@@ -1041,5 +1517,7 @@ func setPolicyTemplate() *cobra.Command {
 	cmd.Flags().StringVarP(&filepath, "filepath", "f", "", "full path to local policy template file.")
 	cmd.Flags().StringVar(&scope, "scope", "site", "scope of impact for the policy template. Supported values: site")
 	cmd.Flags().BoolVar(&defaultTemplate, "default", false, "Restore policy template to default configuration")
+	_ = cmd.MarkFlagFilename("filepath", "yaml", "yml")
+	completeFlagChoices(cmd, "scope", "site")
 	return cmd
 }
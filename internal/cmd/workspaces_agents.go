@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// agentLabelPattern matches the labels of agents, which appear in URLs and
+// SSH host aliases.
+var agentLabelPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// agentLabelEnv sets the label of the agent when no --label flag is given.
+const agentLabelEnv = "CODER_AGENT_LABEL"
+
+func checkAgentLabel(label string) error {
+	if label != "" && !agentLabelPattern.MatchString(label) {
+		return xerrors.Errorf("invalid agent label %q: must be lowercase letters, digits and dashes, starting with a letter or digit", label)
+	}
+	return nil
+}
+
+// splitAgentTarget splits a workspace/agent target into the workspace name
+// and the agent label, which is empty for the main agent.
+func splitAgentTarget(target string) (workspaceName, label string, err error) {
+	parts := strings.SplitN(target, "/", 2)
+	if len(parts) == 1 {
+		return target, "", nil
+	}
+	if parts[0] == "" || parts[1] == "" {
+		return "", "", xerrors.Errorf("invalid target %q: expected workspace or workspace/agent", target)
+	}
+	if err := checkAgentLabel(parts[1]); err != nil {
+		return "", "", err
+	}
+	return parts[0], parts[1], nil
+}
+
+// findAgent checks that the workspace has an agent with the given label,
+// listing the agents it has otherwise. The main agent isn't checked for, so
+// that deployments that don't list agents keep working.
+func findAgent(ctx context.Context, client coder.Client, workspace *coder.Workspace, label string) error {
+	if label == "" {
+		return nil
+	}
+	agents, err := client.WorkspaceAgents(ctx, workspace.ID)
+	if err != nil {
+		return xerrors.Errorf("get agents of workspace %q: %w", workspace.Name, err)
+	}
+	labels := make([]string, 0, len(agents))
+	for _, agent := range agents {
+		if agent.Label == label {
+			return nil
+		}
+		if agent.Label != "" {
+			labels = append(labels, agent.Label)
+		}
+	}
+	hint := "the workspace runs no labeled agents"
+	if len(labels) > 0 {
+		hint = fmt.Sprintf("available agents: %s", strings.Join(labels, ", "))
+	}
+	return clog.Error(i18n.Sprintf("agent %q not found in workspace %q", label, workspace.Name),
+		hint,
+		clog.BlankLine,
+		clog.Tipf("run \"coder workspaces agents %s\" to list the agents of the workspace", workspace.Name),
+	)
+}
+
+func agentsWorkspaceCmd() *cobra.Command {
+	var (
+		user string
+	)
+	cmd := &cobra.Command{
+		Use:   "agents [workspace_name]",
+		Short: "list the agents connected to a workspace",
+		Long: "List the agents connected to a workspace.\n\n" +
+			"Workspaces may run several agents, such as one in the main container and one in a GPU sidecar, " +
+			"each started with \"coder agent start --label\". Reach a labeled agent with \"coder ssh workspace/label\" " +
+			"or \"coder tunnel workspace/label\". The main agent has no label.",
+		Example: `coder workspaces agents my-workspace
+
+# open a shell through the agent of the gpu sidecar
+coder ssh my-workspace/gpu`,
+		Args: xcobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, args[0], user)
+			if err != nil {
+				return err
+			}
+			agents, err := client.WorkspaceAgents(ctx, workspace.ID)
+			if err != nil {
+				return xerrors.Errorf("get agents: %w", err)
+			}
+			if agents == nil {
+				agents = []coder.WorkspaceAgent{} // ensures that json output still marshals
+			}
+
+			return writeOutput(cmd.OutOrStdout(), agents, func() error {
+				if len(agents) == 0 {
+					clog.LogInfo("no agents connected")
+					return nil
+				}
+				err := writeTable(cmd.OutOrStdout(), len(agents), func(i int) interface{} {
+					return agents[i]
+				})
+				if err != nil {
+					return xerrors.Errorf("write table: %w", err)
+				}
+				return nil
+			})
+		},
+	}
+	cmd.Flags().StringVar(&user, "user", coder.Me, "Specify the user whose resources to target")
+	addOutputShorthand(cmd)
+	return cmd
+}
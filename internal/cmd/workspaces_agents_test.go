@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_splitAgentTarget(t *testing.T) {
+	t.Parallel()
+
+	workspace, agent, err := splitAgentTarget("my-dev")
+	assert.Success(t, "workspace", err)
+	assert.Equal(t, "workspace name", "my-dev", workspace)
+	assert.Equal(t, "main agent", "", agent)
+
+	workspace, agent, err = splitAgentTarget("my-dev/gpu")
+	assert.Success(t, "workspace/agent", err)
+	assert.Equal(t, "workspace name", "my-dev", workspace)
+	assert.Equal(t, "agent", "gpu", agent)
+
+	for _, target := range []string{"my-dev/", "/gpu", "my-dev/GPU", "my-dev/gpu/0"} {
+		_, _, err = splitAgentTarget(target)
+		assert.Error(t, target, err)
+	}
+}
+
+func Test_findAgent(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := codertest.New()
+	id := fake.AddWorkspace(coder.Workspace{Name: "my-dev"})
+	fake.AddWorkspaceAgent(id, coder.WorkspaceAgent{})
+	fake.AddWorkspaceAgent(id, coder.WorkspaceAgent{Label: "gpu"})
+	workspace, err := findWorkspace(ctx, fake, "my-dev", coder.Me)
+	assert.Success(t, "find workspace", err)
+
+	assert.Success(t, "main agent", findAgent(ctx, fake, workspace, ""))
+	assert.Success(t, "labeled agent", findAgent(ctx, fake, workspace, "gpu"))
+	err = findAgent(ctx, fake, workspace, "tpu")
+	assert.Error(t, "unknown agent", err)
+	assert.ErrorContains(t, "lists agents", err, "agent \"tpu\" not found")
+}
+
+func Test_workspacesAgents(t *testing.T) {
+	fake := codertest.New()
+	id := fake.AddWorkspace(coder.Workspace{Name: "my-dev", LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOn}})
+	fake.AddWorkspaceAgent(id, coder.WorkspaceAgent{Label: "gpu", Hostname: "my-dev-gpu"})
+	useFakeClient(t, fake)
+
+	res := execute(t, nil, "workspaces", "agents", "my-dev")
+	res.success(t)
+	res.stdoutContains(t, "my-dev-gpu")
+
+	res = execute(t, nil, "workspaces", "agents", "my-dev", "--output", "json")
+	res.success(t)
+	res.stdoutContains(t, `"label":"gpu"`)
+
+	res = execute(t, nil, "tunnel", "my-dev/tpu", "8888", "8888")
+	res.error(t)
+	res.stderrContains(t, "available agents: gpu")
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// defaultBatchParallelism is how many workspaces batch operations act on at
+// once, unless --parallel is given.
+const defaultBatchParallelism = 8
+
+// workspaceBatch selects the workspaces a batch operation acts on, from
+// names and glob patterns such as "ci-*", or from --all workspaces, and runs
+// the operation on them with bounded concurrency.
+type workspaceBatch struct {
+	all      bool
+	parallel int
+}
+
+func (b *workspaceBatch) register(cmd *cobra.Command, verb string) {
+	cmd.Flags().BoolVar(&b.all, "all", false, verb+" every workspace of every user (requires site admin), or of --user if given, narrowed down by the name patterns if any")
+	cmd.Flags().IntVar(&b.parallel, "parallel", defaultBatchParallelism, "how many workspaces to "+verb+" at once")
+}
+
+// args validates the positional arguments: names or patterns are required
+// unless --all or --pick is set.
+func (b *workspaceBatch) args(pick *bool) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if b.all {
+			if *pick {
+				return xerrors.New("--all cannot be combined with --pick")
+			}
+			return nil
+		}
+		return pickArgs(pick)(cmd, args)
+	}
+}
+
+// resolve returns the workspaces selected by the names and glob patterns
+// (see path.Match), among the workspaces of user. A name or pattern that
+// matches nothing is an error. With --all, the workspaces of every user are
+// searched instead, unless --user was given, and no pattern selects them
+// all.
+func (b *workspaceBatch) resolve(ctx context.Context, cmd *cobra.Command, client coder.Client, user string, patterns []string) ([]coder.Workspace, error) {
+	var (
+		workspaces []coder.Workspace
+		err        error
+	)
+	if b.all && !cmd.Flags().Changed("user") {
+		workspaces, err = client.Workspaces(ctx)
+		if err != nil {
+			return nil, clog.Error("failed to list the workspaces of all users",
+				err.Error(),
+				clog.BlankLine,
+				clog.Tipf("--all is only available to site admins, pass --user to act on the workspaces of a single user"),
+			)
+		}
+	} else {
+		workspaces, err = getWorkspaces(ctx, client, user)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if b.all && len(patterns) == 0 {
+		return workspaces, nil
+	}
+
+	var (
+		selected []coder.Workspace
+		seen     = make(map[string]bool)
+	)
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, xerrors.Errorf("invalid workspace pattern %q: %w", pattern, err)
+		}
+		matched := false
+		for _, w := range workspaces {
+			if ok, _ := path.Match(pattern, w.Name); !ok {
+				continue
+			}
+			matched = true
+			if !seen[w.ID] {
+				seen[w.ID] = true
+				selected = append(selected, w)
+			}
+		}
+		if matched || b.all {
+			continue
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			names := make([]string, 0, len(workspaces))
+			for _, w := range workspaces {
+				names = append(names, w.Name)
+			}
+			return nil, clog.Fatal(
+				"failed to find workspace",
+				fmt.Sprintf("workspace %q not found in %q", pattern, names),
+				clog.BlankLine,
+				clog.Tipf("run \"coder workspaces ls\" to view your workspaces"),
+			)
+		}
+		return nil, clog.Fatal(
+			"failed to find workspace",
+			fmt.Sprintf("no workspace matches %q", pattern),
+			clog.BlankLine,
+			clog.Tipf("run \"coder workspaces ls\" to view your workspaces"),
+		)
+	}
+	return selected, nil
+}
+
+// run calls fn on each workspace, running at most --parallel at once. Each
+// failure is logged as it happens, and the returned error counts them.
+func (b *workspaceBatch) run(workspaces []coder.Workspace, fn func(coder.Workspace) error) error {
+	return runBatch(workspaces, b.parallel, fn)
+}
+
+func runBatch(workspaces []coder.Workspace, parallel int, fn func(coder.Workspace) error) error {
+	if parallel < 1 {
+		return xerrors.New("--parallel must be at least 1")
+	}
+	sem := make(chan struct{}, parallel)
+	egroup := clog.LoggedErrGroup()
+	for _, w := range workspaces {
+		w := w
+		egroup.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			return fn(w)
+		})
+	}
+	return egroup.Wait()
+}
+
+// workspaceNames describes the workspaces in a confirmation prompt, naming
+// them unless there are many.
+func workspaceNames(workspaces []coder.Workspace) string {
+	if len(workspaces) > 5 {
+		return fmt.Sprintf("%d workspaces", len(workspaces))
+	}
+	names := make([]string, 0, len(workspaces))
+	for _, w := range workspaces {
+		names = append(names, w.Name)
+	}
+	return fmt.Sprintf("workspaces %q", names)
+}
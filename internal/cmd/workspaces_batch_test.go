@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+func Test_workspaceBatchResolve(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := codertest.New()
+	for _, name := range []string{"ci-1", "ci-2", "backend"} {
+		fake.AddWorkspace(coder.Workspace{Name: name})
+	}
+	other := fake.AddUser(coder.User{Email: "charlie@coder.com"}, fake.DefaultOrgID())
+	fake.AddWorkspace(coder.Workspace{Name: "ci-3", UserID: other})
+
+	resolve := func(flags []string, patterns ...string) ([]string, error) {
+		var (
+			batch workspaceBatch
+			user  string
+			cmd   = &cobra.Command{}
+		)
+		cmd.Flags().StringVar(&user, "user", coder.Me, "")
+		batch.register(cmd, "start")
+		assert.Success(t, "parse flags", cmd.ParseFlags(flags))
+		workspaces, err := batch.resolve(ctx, cmd, fake, user, patterns)
+		names := make([]string, 0, len(workspaces))
+		for _, w := range workspaces {
+			names = append(names, w.Name)
+		}
+		sort.Strings(names)
+		return names, err
+	}
+
+	names, err := resolve(nil, "backend", "ci-*", "ci-1")
+	assert.Success(t, "names and patterns", err)
+	assert.Equal(t, "deduplicated", []string{"backend", "ci-1", "ci-2"}, names)
+
+	names, err = resolve([]string{"--all"})
+	assert.Success(t, "all", err)
+	assert.Equal(t, "every user", []string{"backend", "ci-1", "ci-2", "ci-3"}, names)
+
+	names, err = resolve([]string{"--all", "--user", "charlie@coder.com"}, "ci-*")
+	assert.Success(t, "all of user", err)
+	assert.Equal(t, "one user", []string{"ci-3"}, names)
+
+	names, err = resolve([]string{"--all"}, "frontend-*")
+	assert.Success(t, "all tolerates no match", err)
+	assert.Equal(t, "none", 0, len(names))
+
+	var cliErr clog.CLIError
+	_, err = resolve(nil, "frontend")
+	assert.True(t, "unknown name", xerrors.As(err, &cliErr))
+	assert.True(t, "names the workspace", strings.Contains(cliErr.String(), `workspace "frontend" not found`))
+	_, err = resolve(nil, "frontend-*")
+	assert.True(t, "unmatched pattern", xerrors.As(err, &cliErr))
+	assert.True(t, "names the pattern", strings.Contains(cliErr.String(), `no workspace matches "frontend-*"`))
+	_, err = resolve(nil, "ci-[")
+	assert.ErrorContains(t, "invalid pattern", err, "invalid workspace pattern")
+}
+
+func Test_runBatch(t *testing.T) {
+	t.Parallel()
+	clog.SetOutput(ioutil.Discard)
+	t.Cleanup(func() { clog.SetOutput(os.Stderr) })
+
+	workspaces := make([]coder.Workspace, 10)
+	for i := range workspaces {
+		workspaces[i].Name = string(rune('a' + i))
+	}
+
+	var running, peak, done int32
+	err := runBatch(workspaces, 3, func(w coder.Workspace) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&done, 1)
+		if w.Name == "c" || w.Name == "f" {
+			return xerrors.Errorf("failed %s", w.Name)
+		}
+		return nil
+	})
+	assert.ErrorContains(t, "failures counted", err, "2 failures emitted")
+	assert.Equal(t, "every workspace", int32(10), atomic.LoadInt32(&done))
+	assert.True(t, "bounded", atomic.LoadInt32(&peak) <= 3)
+
+	assert.Error(t, "parallel below 1", runBatch(workspaces, 0, func(coder.Workspace) error { return nil }))
+}
+
+func Test_startWorkspaces(t *testing.T) {
+	ctx := context.Background()
+	fake := codertest.New()
+	useFakeClient(t, fake)
+
+	off := fake.AddWorkspace(coder.Workspace{Name: "ci-1", LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOff}})
+	on := fake.AddWorkspace(coder.Workspace{Name: "ci-2"})
+	other := fake.AddWorkspace(coder.Workspace{Name: "backend", LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOff}})
+
+	res := execute(t, nil, "workspaces", "start", "ci-*")
+	res.success(t)
+	res.stderrContains(t, `started workspace "ci-1"`)
+	res.stderrContains(t, `skipped workspace "ci-2", it is already on`)
+
+	assert.Equal(t, "one rebuild", 1, len(fake.CallsTo("RebuildWorkspace")))
+	for id, want := range map[string]coder.WorkspaceStatus{
+		off:   coder.WorkspaceOn,
+		on:    coder.WorkspaceOn,
+		other: coder.WorkspaceOff,
+	} {
+		w, err := fake.WorkspaceByID(ctx, id)
+		assert.Success(t, "get workspace", err)
+		assert.Equal(t, w.Name+" status", want, w.LatestStat.ContainerStatus)
+	}
+
+	res = execute(t, nil, "workspaces", "start", "--all", "--pick")
+	res.error(t)
+}
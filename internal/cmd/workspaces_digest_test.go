@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_workspaceImageDigest(t *testing.T) {
+	ctx := context.Background()
+	digest := "sha256:" + strings.Repeat("ab", 32)
+
+	fake := codertest.New()
+	fake.AddProvider(coder.KubernetesProvider{Name: "built-in", BuiltIn: true})
+	fake.AddImage(coder.Image{OrganizationID: fake.DefaultOrgID(), Repository: "codercom/ubuntu"}, "latest")
+	useFakeClient(t, fake)
+
+	res := execute(t, nil, "workspaces", "create", "pinned", "--image", "codercom/ubuntu", "--tag", "latest", "--from-image-digest", digest)
+	res.error(t)
+	res.stderrContains(t, "mutually exclusive")
+
+	res = execute(t, nil, "workspaces", "create", "pinned", "--image", "codercom/ubuntu", "--from-image-digest", "sha256:nothex")
+	res.error(t)
+	res.stderrContains(t, "invalid image digest")
+
+	res = execute(t, nil, "workspaces", "create", "pinned", "--image", "codercom/ubuntu", "--from-image-digest", digest)
+	res.success(t)
+	workspace, err := findWorkspace(ctx, fake, "pinned", coder.Me)
+	assert.Success(t, "find workspace", err)
+	assert.Equal(t, "pinned digest", digest, workspace.ImageDigest)
+	assert.Equal(t, "no tag", "", workspace.ImageTag)
+
+	res = execute(t, nil, "workspaces", "ls")
+	res.success(t)
+	res.stdoutContains(t, "codercom/ubuntu@"+digest)
+
+	res = execute(t, nil, "workspaces", "edit", "pinned", "--cpu", "2", "--force")
+	res.success(t)
+	workspace, err = findWorkspace(ctx, fake, "pinned", coder.Me)
+	assert.Success(t, "find workspace", err)
+	assert.Equal(t, "still pinned", digest, workspace.ImageDigest)
+	assert.Equal(t, "still no tag", "", workspace.ImageTag)
+
+	res = execute(t, nil, "workspaces", "edit", "pinned", "--tag", "latest", "--force")
+	res.success(t)
+	workspace, err = findWorkspace(ctx, fake, "pinned", coder.Me)
+	assert.Success(t, "find workspace", err)
+	assert.Equal(t, "unpinned", "", workspace.ImageDigest)
+	assert.Equal(t, "tag", "latest", workspace.ImageTag)
+}
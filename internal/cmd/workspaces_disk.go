@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// workspaceDisk is the disk usage of a workspace, from its latest stat.
+type workspaceDisk struct {
+	Workspace string             `json:"workspace"`
+	DiskTotal int64              `json:"disk_total"`
+	DiskUsed  int64              `json:"disk_used"`
+	Pressure  coder.DiskPressure `json:"disk_pressure,omitempty"`
+}
+
+// workspaceDiskRow is a workspaceDisk in a human readable form.
+type workspaceDiskRow struct {
+	Workspace string `table:"Workspace"`
+	Used      string `table:"Used"`
+	Size      string `table:"Size"`
+	Use       string `table:"Use%"`
+	Pressure  string `table:"Pressure"`
+}
+
+func workspaceDiskCmd() *cobra.Command {
+	var user string
+	cmd := &cobra.Command{
+		Use:   "disk [workspace_name]",
+		Short: "show how full the disk of a workspace is",
+		Long: "Show the usage of the home volume of a workspace, or of the default workspace when given none, " +
+			"along with the pressure its agents last reported.\n\n" +
+			"Agents report a warning once the volume is 85% full and turn critical at 95%, " +
+			"which \"coder agent start --disk-warn --disk-critical\" change. " +
+			"\"coder workspaces ls\" warns about the workspaces whose disk is filling up.",
+		Example: `coder workspaces disk my-workspace
+
+# list the workspaces whose disk is critical
+coder workspaces ls --output json | jq -r '.[] | select(.latest_stat.disk_pressure == "critical") | .name'`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			name, _, err := workspaceArg("", args, 0)
+			if err != nil {
+				return err
+			}
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, name, user)
+			if err != nil {
+				return err
+			}
+			disk := workspaceDisk{
+				Workspace: workspace.Name,
+				DiskTotal: workspace.LatestStat.DiskTotal,
+				DiskUsed:  workspace.LatestStat.DiskUsed,
+				Pressure:  workspace.LatestStat.DiskPressure,
+			}
+
+			return writeOutput(cmd.OutOrStdout(), disk, func() error {
+				if disk.DiskTotal == 0 {
+					clog.LogInfo(i18n.Sprintf("the disk usage of workspace %q isn't known yet", workspace.Name),
+						clog.Tipf("it's reported while the workspace is on"),
+					)
+					return nil
+				}
+				err := writeTable(cmd.OutOrStdout(), 1, func(int) interface{} {
+					return makeWorkspaceDiskRow(disk)
+				})
+				if err != nil {
+					return xerrors.Errorf("write table: %w", err)
+				}
+				if disk.Pressure == coder.DiskPressureWarning || disk.Pressure == coder.DiskPressureCritical {
+					warnDiskPressure(workspace.Name, disk.Pressure)
+				}
+				return nil
+			})
+		},
+	}
+	cmd.Flags().StringVar(&user, "user", coder.Me, "Specify the user whose resources to target")
+	addOutputShorthand(cmd)
+	return cmd
+}
+
+func makeWorkspaceDiskRow(d workspaceDisk) workspaceDiskRow {
+	row := workspaceDiskRow{
+		Workspace: d.Workspace,
+		Used:      formatBytes(uint64(d.DiskUsed)),
+		Size:      formatBytes(uint64(d.DiskTotal)),
+		Use:       "-",
+		Pressure:  string(d.Pressure),
+	}
+	if d.DiskTotal > 0 {
+		row.Use = fmt.Sprintf("%.0f%%", float64(d.DiskUsed)/float64(d.DiskTotal)*100)
+	}
+	if row.Pressure == "" {
+		row.Pressure = "-"
+	}
+	return row
+}
+
+// warnDiskPressure warns that the disk of the workspace is filling up.
+func warnDiskPressure(workspaceName string, pressure coder.DiskPressure) {
+	msg := fmt.Sprintf("the disk of workspace %q is filling up", workspaceName)
+	if pressure == coder.DiskPressureCritical {
+		msg = fmt.Sprintf("the disk of workspace %q is almost full", workspaceName)
+	}
+	clog.LogWarn(msg,
+		"builds and editors fail once it's full",
+		clog.BlankLine,
+		clog.Tipf("run \"coder workspaces disk %s\" to see its usage, and free up space or grow it with \"coder workspaces edit %s --disk\"", workspaceName, workspaceName),
+	)
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_diskThresholds(t *testing.T) {
+	t.Parallel()
+
+	limits := diskThresholds{warn: 85, critical: 95}
+	assert.Success(t, "valid", limits.check())
+	assert.Equal(t, "ok", coder.DiskPressureOK, limits.pressure(100, 84))
+	assert.Equal(t, "warning", coder.DiskPressureWarning, limits.pressure(100, 85))
+	assert.Equal(t, "critical", coder.DiskPressureCritical, limits.pressure(100, 99))
+	assert.Equal(t, "empty volume", coder.DiskPressureOK, limits.pressure(0, 0))
+
+	assert.Error(t, "warn above critical", diskThresholds{warn: 96, critical: 95}.check())
+	assert.Error(t, "not a percentage", diskThresholds{warn: 85, critical: 101}.check())
+}
+
+func Test_agentDiskMonitor(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var (
+		used     uint64 = 50
+		enabled         = true
+		reported []coder.AgentDisk
+	)
+	m := &agentDiskMonitor{
+		log:        slogtest.Make(t, nil),
+		path:       "/home/coder",
+		label:      "gpu",
+		thresholds: diskThresholds{warn: 85, critical: 95},
+		enabled:    func() bool { return enabled },
+		report: func(_ context.Context, disk coder.AgentDisk) error {
+			reported = append(reported, disk)
+			return nil
+		},
+		usage: func(string) (uint64, uint64, error) { return 100, used, nil },
+	}
+	now := time.Date(2021, 5, 4, 13, 0, 0, 0, time.UTC)
+
+	assert.Success(t, "first check", m.check(ctx, now))
+	assert.Equal(t, "reported at start", 1, len(reported))
+	assert.Equal(t, "label", "gpu", reported[0].Label)
+
+	assert.Success(t, "unchanged", m.check(ctx, now.Add(time.Minute)))
+	assert.Equal(t, "not reported again", 1, len(reported))
+
+	used = 90
+	assert.Success(t, "filling up", m.check(ctx, now.Add(2*time.Minute)))
+	assert.Equal(t, "reported on change", 2, len(reported))
+	assert.Equal(t, "warning", coder.DiskPressureWarning, reported[1].Pressure)
+
+	assert.Success(t, "refresh", m.check(ctx, now.Add(2*time.Minute+agentDiskReportInterval)))
+	assert.Equal(t, "reported when due", 3, len(reported))
+
+	enabled = false
+	used = 99
+	assert.Success(t, "metrics off", m.check(ctx, now.Add(3*time.Minute+agentDiskReportInterval)))
+	assert.Equal(t, "not reported while metrics are off", 3, len(reported))
+}
+
+func Test_workspacesDisk(t *testing.T) {
+	fake := codertest.New()
+	providerID := fake.AddProvider(coder.KubernetesProvider{Name: "us-east", BuiltIn: true})
+	imageID := fake.AddImage(coder.Image{Repository: "codercom/ubuntu"}, "20.04")
+	fake.AddWorkspace(coder.Workspace{
+		Name:           "my-dev",
+		ImageID:        imageID,
+		ResourcePoolID: providerID,
+		LatestStat: coder.WorkspaceStat{
+			ContainerStatus: coder.WorkspaceOn,
+			DiskTotal:       10 << 30,
+			DiskUsed:        9800 << 20,
+			DiskPressure:    coder.DiskPressureCritical,
+		},
+	})
+	fake.AddWorkspace(coder.Workspace{Name: "roomy", ImageID: imageID, ResourcePoolID: providerID, LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOn}})
+	useFakeClient(t, fake)
+
+	res := execute(t, nil, "workspaces", "disk", "my-dev")
+	res.success(t)
+	res.stdoutContains(t, "9.6 GiB")
+	res.stdoutContains(t, "96%")
+	res.stderrContains(t, "is almost full")
+
+	res = execute(t, nil, "workspaces", "disk", "my-dev", "--output", "json")
+	res.success(t)
+	res.stdoutContains(t, `"disk_pressure":"critical"`)
+
+	res = execute(t, nil, "workspaces", "disk", "roomy")
+	res.success(t)
+	res.stderrContains(t, "isn't known yet")
+
+	res = execute(t, nil, "workspaces", "ls")
+	res.success(t)
+	res.stdoutContains(t, "roomy")
+	res.stderrContains(t, "the disk of workspace \"my-dev\" is almost full")
+	assert.False(t, "no warning for roomy", strings.Contains(res.errBuffer.String(), "\"roomy\""))
+}
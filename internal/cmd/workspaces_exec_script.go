@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"cdr.dev/wsep"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"nhooyr.io/websocket"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/coderutil"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// scriptCleanupTimeout bounds how long removing the uploaded script may take,
+// which happens even if the command was interrupted.
+const scriptCleanupTimeout = 10 * time.Second
+
+// uploadScript writes stdin to a new private temp file and prints its path.
+const uploadScript = `set -e
+f=$(mktemp "${TMPDIR:-/tmp}/coder-script.XXXXXX")
+cat > "$f"
+chmod 700 "$f"
+printf '%s' "$f"`
+
+func execScriptCmd() *cobra.Command {
+	var (
+		user          string
+		env           []string
+		workdir       string
+		interpreter   string
+		workspaceFlag string
+	)
+	cmd := &cobra.Command{
+		Use:   "exec-script [workspace_name] [script] [-- args...]",
+		Short: "run a local script in a workspace",
+		Long: "Upload a local script to a temp file in the workspace, run it with the given arguments and environment " +
+			"while streaming its output, then remove it.\n\n" +
+			"The script is run directly, so it needs a shebang line unless --interpreter is given. " +
+			"Use \"-\" to read the script from stdin. The command exits with the exit code of the script.\n\n" +
+			"Without workspace_name, the workspace given with --workspace, or else the default workspace set with " +
+			"\"coder config set default-workspace\", is used. The arguments of the script must then follow \"--\".",
+		Args: cobra.MinimumNArgs(1),
+		ValidArgsFunction: func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+			// The script is the only local file among the arguments, and
+			// may come first when the workspace name is left out.
+			if len(args) <= 1 {
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		Example: `coder workspaces exec-script backend ./scripts/cleanup.sh
+coder workspaces exec-script backend ./scripts/migrate.sh --env DB=staging -- --dry-run
+coder workspaces exec-script backend report.py --interpreter python3 --workdir /home/coder/project
+
+# with "coder config set default-workspace backend"
+coder workspaces exec-script ./scripts/migrate.sh -- --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			// Only the arguments before "--" may be the workspace name.
+			positional := len(args)
+			if n := cmd.ArgsLenAtDash(); n >= 0 {
+				positional = n
+			}
+			workspaceName, leading, err := workspaceArg(workspaceFlag, args[:positional], 1)
+			if err != nil {
+				return err
+			}
+			if len(leading) == 0 {
+				return xerrors.New("missing [script] argument")
+			}
+			scriptPath := leading[0]
+			scriptArgs := append(append([]string{}, leading[1:]...), args[positional:]...)
+
+			for _, kv := range env {
+				if !strings.Contains(kv, "=") {
+					return xerrors.Errorf("invalid --env %q: expected KEY=VALUE", kv)
+				}
+			}
+
+			var script io.Reader = cmd.InOrStdin()
+			if scriptPath != "-" {
+				f, err := os.Open(scriptPath)
+				if err != nil {
+					return xerrors.Errorf("open script: %w", err)
+				}
+				defer f.Close()
+				script = f
+			}
+
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, workspaceName, user)
+			if err != nil {
+				return err
+			}
+			if workspace.LatestStat.ContainerStatus != coder.WorkspaceOn {
+				return clog.Error(i18n.Sprintf("workspace %q is not running", workspace.Name),
+					clog.BlankLine,
+					clog.Tipf("use \"coder workspaces rebuild %s\" to start it", workspace.Name),
+				)
+			}
+
+			err = execScript(ctx, workspaceExecer(client, workspace), script, scriptOptions{
+				args:        scriptArgs,
+				env:         env,
+				workdir:     workdir,
+				interpreter: interpreter,
+				stdout:      cmd.OutOrStdout(),
+				stderr:      cmd.ErrOrStderr(),
+			})
+			// Only the script's own exit code is passed on, not that of
+			// uploading or removing it.
+			if exitErr, ok := err.(wsep.ExitError); ok {
+				os.Exit(exitErr.Code)
+			}
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&user, "user", coder.Me, "Specify the user whose resources to target")
+	cmd.Flags().StringArrayVarP(&env, "env", "e", nil, "set an environment variable of the script, as KEY=VALUE (repeatable)")
+	cmd.Flags().StringVar(&workdir, "workdir", "", "directory to run the script in, instead of the home directory")
+	cmd.Flags().StringVar(&interpreter, "interpreter", "", "program to run the script with, such as bash or python3, instead of its shebang line")
+	cmd.Flags().StringVar(&workspaceFlag, "workspace", "", "workspace to run the script in, instead of workspace_name")
+	return cmd
+}
+
+// execerDialer returns an execer for a single process, and a function
+// releasing it once the process is done.
+type execerDialer func(ctx context.Context) (wsep.Execer, func(), error)
+
+// workspaceExecer dials the executor of the workspace for each process.
+func workspaceExecer(client coder.Client, workspace *coder.Workspace) execerDialer {
+	return func(ctx context.Context) (wsep.Execer, func(), error) {
+		conn, err := coderutil.DialWorkspaceWsep(ctx, client, workspace)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("dial executor: %w", err)
+		}
+		return wsep.RemoteExecer(conn), func() { _ = conn.Close(websocket.StatusNormalClosure, "") }, nil
+	}
+}
+
+type scriptOptions struct {
+	args        []string
+	env         []string
+	workdir     string
+	interpreter string
+	stdout      io.Writer
+	stderr      io.Writer
+}
+
+// execScript uploads the script, runs it and removes it. A wsep.ExitError is
+// returned if the script exits with a non-zero code.
+func execScript(ctx context.Context, dial execerDialer, script io.Reader, opts scriptOptions) error {
+	var path bytes.Buffer
+	err := runProcess(ctx, dial, wsep.Command{
+		Command: "sh",
+		Args:    []string{"-c", uploadScript},
+		Stdin:   true,
+	}, script, &path, ioutil.Discard)
+	if err != nil {
+		return xerrors.Errorf("upload script: %w", err)
+	}
+	if path.Len() == 0 {
+		return xerrors.New("upload script: no temp file path returned")
+	}
+	defer func() {
+		// The script is removed even if ctx was canceled, such as by ^C.
+		ctx, cancel := context.WithTimeout(context.Background(), scriptCleanupTimeout)
+		defer cancel()
+		err := runProcess(ctx, dial, wsep.Command{Command: "rm", Args: []string{"-f", path.String()}}, nil, ioutil.Discard, ioutil.Discard)
+		if err != nil {
+			clog.LogWarn(i18n.Sprintf("failed to remove the script at %s", path.String()), clog.Causef(err.Error()))
+		}
+	}()
+
+	run := wsep.Command{
+		Command:    path.String(),
+		Args:       opts.args,
+		Env:        opts.env,
+		WorkingDir: opts.workdir,
+	}
+	if opts.interpreter != "" {
+		run.Command = opts.interpreter
+		run.Args = append([]string{path.String()}, opts.args...)
+	}
+	return runProcess(ctx, dial, run, nil, opts.stdout, opts.stderr)
+}
+
+// runProcess runs the command to completion, sending it stdin if it's not nil.
+func runProcess(ctx context.Context, dial execerDialer, command wsep.Command, stdin io.Reader, stdout, stderr io.Writer) error {
+	execer, release, err := dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	process, err := execer.Start(ctx, command)
+	if err != nil {
+		return xerrors.Errorf("start %s: %w", command.Command, err)
+	}
+	defer process.Close()
+
+	if stdin != nil {
+		go func() {
+			w := process.Stdin()
+			defer w.Close()
+			_, _ = io.Copy(w, stdin)
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = io.Copy(stderr, process.Stderr())
+	}()
+	_, _ = io.Copy(stdout, process.Stdout()) // Any error is reported by Wait.
+	<-done
+	return process.Wait()
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"cdr.dev/wsep"
+)
+
+func Test_execScript(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	tmp, err := ioutil.TempDir("", "coder-exec-script")
+	assert.Success(t, "create temp dir", err)
+	t.Cleanup(func() { _ = os.RemoveAll(tmp) })
+
+	// Scripts run on the local system, with TMPDIR pointing at tmp so the
+	// upload can be checked for cleanup.
+	local := func(ctx context.Context) (wsep.Execer, func(), error) {
+		return tmpDirExecer{dir: tmp}, func() {}, nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	script := "#!/bin/sh\necho \"$GREETING $1 from $(pwd)\"\necho oops >&2\n"
+	err = execScript(ctx, local, strings.NewReader(script), scriptOptions{
+		args:    []string{"world"},
+		env:     []string{"GREETING=hello"},
+		workdir: tmp,
+		stdout:  &stdout,
+		stderr:  &stderr,
+	})
+	assert.Success(t, "exec script", err)
+	assert.Equal(t, "stdout", "hello world from "+tmp+"\n", stdout.String())
+	assert.Equal(t, "stderr", "oops\n", stderr.String())
+
+	err = execScript(ctx, local, strings.NewReader("exit 3\n"), scriptOptions{
+		interpreter: "sh",
+		stdout:      &stdout,
+		stderr:      &stderr,
+	})
+	exitErr, ok := err.(wsep.ExitError)
+	assert.True(t, "exit error", ok)
+	assert.Equal(t, "exit code", 3, exitErr.Code)
+
+	left, err := filepath.Glob(filepath.Join(tmp, "coder-script.*"))
+	assert.Success(t, "glob", err)
+	assert.Equal(t, "scripts removed", 0, len(left))
+}
+
+// tmpDirExecer runs commands locally with TMPDIR set to dir.
+type tmpDirExecer struct {
+	dir string
+}
+
+func (e tmpDirExecer) Start(ctx context.Context, c wsep.Command) (wsep.Process, error) {
+	c.Env = append(c.Env, "TMPDIR="+e.dir)
+	return wsep.LocalExecer{}.Start(ctx, c)
+}
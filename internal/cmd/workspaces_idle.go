@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// lastActive returns when the workspace was last used: its last connection
+// through the agent, or its last build if nobody connected since.
+func lastActive(w coder.Workspace) time.Time {
+	if w.LastBuiltAt.After(w.LastConnectionAt) {
+		return w.LastBuiltAt
+	}
+	return w.LastConnectionAt
+}
+
+// isIdle reports whether nobody used the workspace for idleFor.
+func isIdle(w coder.Workspace, idleFor time.Duration, now time.Time) bool {
+	return now.Sub(lastActive(w)) >= idleFor
+}
+
+func stopWorkspace(ctx context.Context, client coder.Client, workspace coder.Workspace) error {
+	if err := client.StopWorkspace(ctx, workspace.ID); err != nil {
+		return clog.Error(i18n.Sprintf("stop workspace %q", workspace.Name),
+			clog.Causef(err.Error()), clog.BlankLine,
+			clog.Hintf("current workspace status is %q", workspace.LatestStat.ContainerStatus),
+		)
+	}
+	clog.LogSuccess(i18n.Sprintf("successfully stopped workspace %q", workspace.Name))
+	return nil
+}
+
+// idleWorkspaces returns the running workspaces that nobody used for idleFor.
+func idleWorkspaces(workspaces []coder.Workspace, idleFor time.Duration, now time.Time) []coder.Workspace {
+	var idle []coder.Workspace
+	for _, w := range workspaces {
+		if w.LatestStat.ContainerStatus != coder.WorkspaceOn {
+			continue
+		}
+		if isIdle(w, idleFor, now) {
+			idle = append(idle, w)
+		}
+	}
+	return idle
+}
+
+// stopAllWorkspaces stops the workspaces that are running and that nobody
+// used for idleFor, at most parallel at once.
+func stopAllWorkspaces(ctx context.Context, client coder.Client, workspaces []coder.Workspace, idleFor time.Duration, dryRun, force bool, parallel int) error {
+	now := time.Now()
+	stop := idleWorkspaces(workspaces, idleFor, now)
+	if len(stop) == 0 {
+		clog.LogInfo("no workspaces to stop")
+		return nil
+	}
+	if dryRun {
+		lines := make([]string, 0, len(stop))
+		for _, w := range stop {
+			lines = append(lines, fmt.Sprintf("  %s, last active %s ago", w.Name, now.Sub(lastActive(w)).Round(time.Minute)))
+		}
+		clog.LogInfo(i18n.Sprintf("would stop %d workspaces", len(stop)), lines...)
+		return nil
+	}
+	if !force {
+		label := fmt.Sprintf("Stop %d workspaces?", len(stop))
+		if _, err := (&promptui.Prompt{Label: label, IsConfirm: true}).Run(); err != nil {
+			return clog.Fatal(
+				"failed to confirm prompt", clog.BlankLine,
+				clog.Tipf(`use "--force" to stop without a confirmation prompt`),
+			)
+		}
+	}
+
+	return runBatch(stop, parallel, func(w coder.Workspace) error {
+		return stopWorkspace(ctx, client, w)
+	})
+}
+
+// stopCronEntry returns a crontab entry running the stop command with the
+// same --all, --user and --idle-for flags on the given schedule.
+func stopCronEntry(cmd *cobra.Command, schedule string) (string, error) {
+	schedule = strings.TrimSpace(schedule)
+	if !strings.HasPrefix(schedule, "@") && len(strings.Fields(schedule)) != 5 {
+		return "", xerrors.Errorf("invalid cron schedule %q: expected 5 fields, such as \"0 * * * *\"", schedule)
+	}
+	binPath, err := binPath()
+	if err != nil {
+		return "", xerrors.Errorf("failed to get executable path: %w", err)
+	}
+
+	command := fmt.Sprintf("%q workspaces stop --all", binPath)
+	if f := cmd.Flags().Lookup("user"); f.Changed {
+		command += fmt.Sprintf(" --user %q", f.Value.String())
+	}
+	if f := cmd.Flags().Lookup("idle-for"); f.Changed {
+		command += " --idle-for " + f.Value.String()
+	}
+	// cron turns an unescaped % of the command into a newline.
+	command = strings.ReplaceAll(command+" --force", "%", `\%`)
+	return schedule + " " + command, nil
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_stopAllWorkspacesIdle(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Now()
+
+	fake := codertest.New()
+	idle := fake.AddWorkspace(coder.Workspace{
+		Name:             "idle",
+		LastBuiltAt:      now.Add(-72 * time.Hour),
+		LastConnectionAt: now.Add(-48 * time.Hour),
+	})
+	connected := fake.AddWorkspace(coder.Workspace{
+		Name:             "connected",
+		LastBuiltAt:      now.Add(-72 * time.Hour),
+		LastConnectionAt: now.Add(-time.Hour),
+	})
+	rebuilt := fake.AddWorkspace(coder.Workspace{
+		Name:             "rebuilt",
+		LastBuiltAt:      now.Add(-time.Hour),
+		LastConnectionAt: now.Add(-48 * time.Hour),
+	})
+
+	workspaces, err := fake.Workspaces(ctx)
+	assert.Success(t, "list workspaces", err)
+	err = stopAllWorkspaces(ctx, fake, workspaces, 24*time.Hour, false, true, defaultBatchParallelism)
+	assert.Success(t, "stop idle workspaces", err)
+
+	for id, want := range map[string]coder.WorkspaceStatus{
+		idle:      coder.WorkspaceOff,
+		connected: coder.WorkspaceOn,
+		rebuilt:   coder.WorkspaceOn,
+	} {
+		w, err := fake.WorkspaceByID(ctx, id)
+		assert.Success(t, "get workspace", err)
+		assert.Equal(t, w.Name+" status", want, w.LatestStat.ContainerStatus)
+	}
+}
+
+func Test_idleWorkspacesSkipsStopped(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	workspaces := []coder.Workspace{
+		{Name: "off", LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOff}},
+		{Name: "on", LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOn}},
+	}
+	idle := idleWorkspaces(workspaces, time.Hour, now)
+	assert.Equal(t, "idle count", 1, len(idle))
+	assert.Equal(t, "idle workspace", "on", idle[0].Name)
+}
+
+func Test_stopCronEntry(t *testing.T) {
+	t.Parallel()
+
+	cmd := stopWorkspacesCmd()
+	assert.Success(t, "parse flags", cmd.ParseFlags([]string{"--all", "--idle-for", "24h", "--user", "charlie@coder.com"}))
+
+	entry, err := stopCronEntry(cmd, "0 * * * *")
+	assert.Success(t, "cron entry", err)
+	assert.True(t, "schedule first", strings.HasPrefix(entry, "0 * * * * \""))
+	assert.True(t, "flags", strings.HasSuffix(entry, `" workspaces stop --all --user "charlie@coder.com" --idle-for 24h0m0s --force`))
+
+	assert.Success(t, "parse flags", cmd.ParseFlags([]string{"--user", "100%@coder.com"}))
+	entry, err = stopCronEntry(cmd, "0 * * * *")
+	assert.Success(t, "cron entry", err)
+	assert.True(t, "percent escaped", strings.Contains(entry, `--user "100\%@coder.com"`))
+
+	_, err = stopCronEntry(cmd, "@hourly")
+	assert.Success(t, "cron shorthand", err)
+
+	_, err = stopCronEntry(cmd, "0 * *")
+	assert.Error(t, "invalid schedule", err)
+}
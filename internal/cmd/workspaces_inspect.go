@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/jsonpatch"
+	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+func inspectWorkspaceCmd() *cobra.Command {
+	var (
+		user       string
+		watch      bool
+		interval   time.Duration
+		containers bool
+	)
+	cmd := &cobra.Command{
+		Use:   "inspect <workspace_name>",
+		Short: "print a workspace as JSON",
+		Long: "Print the API object of a workspace as JSON, or as YAML with --output yaml.\n\n" +
+			"With --watch, print a JSON patch (RFC 6902) on its own line each time the object changes. " +
+			"The first patch adds the whole object, and the command exits after printing a patch " +
+			"that removes it once the workspace is deleted.\n\n" +
+			"With --containers, connect to the workspace and print the names of the containers " +
+			"that can be reached with \"coder ssh --container\".",
+		Example: `coder workspaces inspect my-workspace
+
+# print each build state transition
+coder workspaces inspect my-workspace --watch |
+  jq -c --unbuffered '.[] | select(.path == "/latest_stat/container_status") | .value'
+
+# list the sidecar containers of a workspace
+coder workspaces inspect my-workspace --containers`,
+		Args: xcobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, args[0], user)
+			if err != nil {
+				return err
+			}
+
+			if containers {
+				if watch {
+					return xerrors.New("--containers can't be used with --watch")
+				}
+				names, err := workspaceContainers(ctx, client, workspace)
+				if err != nil {
+					return err
+				}
+				return writeInspected(cmd.OutOrStdout(), names)
+			}
+			if !watch {
+				return writeInspected(cmd.OutOrStdout(), workspace)
+			}
+			if outputFormat == yamlOutput {
+				return xerrors.New("--watch prints JSON patches, it can't be used with --output yaml")
+			}
+			if interval <= 0 {
+				return xerrors.New("--interval must be positive")
+			}
+			return watchWorkspace(ctx, client, workspace.ID, interval, cmd.OutOrStdout())
+		},
+	}
+	cmd.Flags().StringVar(&user, "user", coder.Me, "Specify the user whose resources to target")
+	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "print a JSON patch line each time the workspace changes")
+	cmd.Flags().DurationVar(&interval, "interval", 2*time.Second, "how often the workspace is checked for changes with --watch")
+	cmd.Flags().BoolVar(&containers, "containers", false, "print the names of the containers of the workspace as a JSON array")
+	addOutputFlag(cmd)
+	docsSamples(cmd, "workspaces inspect backend")
+	return cmd
+}
+
+// writeInspected writes v as indented JSON, or as YAML with --output yaml.
+func writeInspected(w io.Writer, v interface{}) error {
+	if outputFormat == yamlOutput {
+		return writeOutput(w, v, nil)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// workspaceContainers asks the agent of the workspace for the names of the
+// containers it can reach.
+func workspaceContainers(ctx context.Context, client coder.Client, workspace *coder.Workspace) ([]string, error) {
+	if workspace.LatestStat.ContainerStatus != coder.WorkspaceOn {
+		return nil, clog.Error("workspace not available",
+			fmt.Sprintf("current status: %q", workspace.LatestStat.ContainerStatus),
+			clog.BlankLine,
+			clog.Tipf("containers can only be listed while the workspace is running"),
+		)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	dialer, err := dialWorkspace(ctx, client, workspace)
+	if err != nil {
+		return nil, xerrors.Errorf("connect to workspace: %w", err)
+	}
+	defer dialer.Close()
+	names, err := dialer.Containers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if names == nil {
+		names = []string{}
+	}
+	return names, nil
+}
+
+// watchWorkspace writes a JSON patch line to w each time the workspace
+// changes, until it is deleted or ctx is canceled.
+func watchWorkspace(ctx context.Context, client coder.Client, workspaceID string, interval time.Duration, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev *coder.Workspace
+	for {
+		workspace, err := client.WorkspaceByID(ctx, workspaceID)
+		switch {
+		case isNotFound(err):
+			if prev == nil {
+				return xerrors.Errorf("get workspace: %w", err)
+			}
+			return enc.Encode([]jsonpatch.Operation{{Op: "remove", Path: ""}})
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil
+			}
+			// Keep watching through transient failures.
+			clog.LogWarn("failed to get workspace", clog.Causef(err.Error()))
+		default:
+			var from interface{}
+			if prev != nil {
+				from = prev
+			}
+			patch, err := jsonpatch.Diff(from, workspace)
+			if err != nil {
+				return xerrors.Errorf("diff workspace: %w", err)
+			}
+			if len(patch) > 0 {
+				if err := enc.Encode(patch); err != nil {
+					return xerrors.Errorf("write patch: %w", err)
+				}
+			}
+			prev = workspace
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func isNotFound(err error) bool {
+	if xerrors.Is(err, coder.ErrNotFound) {
+		return true
+	}
+	var herr *coder.HTTPError
+	return xerrors.As(err, &herr) && herr.StatusCode() == http.StatusNotFound
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_watchWorkspace(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := codertest.New()
+	id := fake.AddWorkspace(coder.Workspace{Name: "backend"})
+
+	// Stop the workspace after the first poll, and delete it after the second.
+	var polls int
+	fake.On("WorkspaceByID", func(args ...interface{}) error {
+		polls++
+		switch polls {
+		case 2:
+			return fake.StopWorkspace(ctx, id)
+		case 3:
+			return fake.DeleteWorkspace(ctx, id)
+		}
+		return nil
+	})
+
+	var buf bytes.Buffer
+	err := watchWorkspace(ctx, fake, id, time.Millisecond, &buf)
+	assert.Success(t, "watch workspace", err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, "patch count", 3, len(lines))
+	assert.True(t, "whole object added", strings.HasPrefix(lines[0], `[{"op":"add","path":"","value":{"id":"`+id+`"`))
+	assert.True(t, "status replaced", strings.Contains(lines[1], `{"op":"replace","path":"/latest_stat/container_status","value":"OFF"}`))
+	assert.Equal(t, "object removed", `[{"op":"remove","path":""}]`, lines[2])
+}
+
+func Test_workspaceContainersStopped(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := codertest.New()
+	id := fake.AddWorkspace(coder.Workspace{Name: "backend"})
+	assert.Success(t, "stop workspace", fake.StopWorkspace(ctx, id))
+	workspace, err := fake.WorkspaceByID(ctx, id)
+	assert.Success(t, "get workspace", err)
+
+	_, err = workspaceContainers(ctx, fake, workspace)
+	assert.Error(t, "stopped workspace", err)
+}
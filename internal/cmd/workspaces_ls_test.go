@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+	"cdr.dev/coder-cli/internal/coderutil"
+)
+
+func Test_workspacesLsAllOrgs(t *testing.T) {
+	fake := codertest.New()
+	providerID := fake.AddProvider(coder.KubernetesProvider{Name: "us-east", BuiltIn: true})
+	orgID := fake.AddOrganization(coder.Organization{Name: "engineering"})
+	charlie := fake.AddUser(coder.User{Email: "charlie@coder.com", Username: "charlie"}, orgID)
+	lastOpened := time.Date(2021, 5, 4, 13, 2, 0, 0, time.UTC)
+	fake.AddWorkspace(coder.Workspace{Name: "mine", ResourcePoolID: providerID, LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOn}})
+	fake.AddWorkspace(coder.Workspace{
+		Name:           "backend",
+		UserID:         charlie,
+		OrganizationID: orgID,
+		ResourcePoolID: providerID,
+		LastOpenedAt:   lastOpened,
+		LatestStat:     coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOff},
+	})
+	useFakeClient(t, fake)
+
+	res := execute(t, nil, "workspaces", "ls", "--all-orgs")
+	res.success(t)
+	res.stdoutContains(t, "charlie@coder.com")
+	res.stdoutContains(t, "me@coder.com")
+	res.stdoutContains(t, "2021-05-04 13:02")
+
+	res = execute(t, nil, "workspaces", "ls", "--all-orgs", "--org", "engineering", "--status", "off", "--output", "json")
+	res.success(t)
+	var rows []coderutil.OwnedWorkspaceTable
+	assert.Success(t, "decode json", json.Unmarshal(res.outBuffer.Bytes(), &rows))
+	assert.Equal(t, "filtered", 1, len(rows))
+	assert.Equal(t, "owner", "charlie@coder.com", rows[0].Owner)
+	assert.Equal(t, "organization", "engineering", rows[0].Organization)
+	assert.Equal(t, "provider", "us-east", rows[0].Provider)
+	assert.True(t, "last active", lastOpened.Equal(rows[0].LastActiveAt))
+
+	res = execute(t, nil, "workspaces", "ls", "--all-orgs", "--user", "me@coder.com", "--output", "json")
+	res.success(t)
+	rows = nil
+	assert.Success(t, "decode json", json.Unmarshal(res.outBuffer.Bytes(), &rows))
+	assert.Equal(t, "own workspace", 1, len(rows))
+	assert.Equal(t, "name", "mine", rows[0].Name)
+
+	res = execute(t, nil, "workspaces", "ls", "--all-orgs", "--output", "ndjson")
+	res.success(t)
+	dec := json.NewDecoder(res.outBuffer)
+	var names []string
+	for dec.More() {
+		var row coderutil.OwnedWorkspaceTable
+		assert.Success(t, "decode ndjson line", dec.Decode(&row))
+		names = append(names, row.Name)
+	}
+	assert.Equal(t, "one object per workspace, as listed", []string{"mine", "backend"}, names)
+	assert.Equal(t, "streamed", 1, len(fake.CallsTo("EachWorkspace")))
+
+	res = execute(t, nil, "workspaces", "ls", "--all-orgs", "--status", "sleeping")
+	res.error(t)
+	res.stderrContains(t, "invalid --status")
+}
@@ -0,0 +1,322 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/coderutil"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// workspaceSpec declares a workspace for "coder workspaces create
+// --from-config", in YAML or JSON. Resources left at zero get the defaults
+// of the image on creation, and are left alone on existing workspaces.
+type workspaceSpec struct {
+	Name string `yaml:"name"`
+	// Org is the organization of the image and the workspace, which is
+	// required for members of several organizations.
+	Org   string `yaml:"org"`
+	Image string `yaml:"image"`
+	Tag   string `yaml:"tag"`
+	// Digest pins the workspace to the exact image, instead of Tag.
+	Digest string `yaml:"digest"`
+	// Provider is the name of the workspace provider, the default one when
+	// empty.
+	Provider    string  `yaml:"provider"`
+	CPU         float32 `yaml:"cpu"`
+	MemoryGB    float32 `yaml:"memory"`
+	DiskGB      int     `yaml:"disk"`
+	GPUs        int     `yaml:"gpus"`
+	ContainerVM bool    `yaml:"container_vm"`
+	// Autostart is only applied when the workspace is created.
+	Autostart  bool                     `yaml:"autostart"`
+	Scheduling *workspaceSpecScheduling `yaml:"scheduling"`
+}
+
+type workspaceSpecScheduling struct {
+	NodeSelector map[string]string `yaml:"node_selector"`
+	// Tolerations are in the key[=value][:effect] format of the
+	// --toleration flag.
+	Tolerations []string `yaml:"tolerations"`
+	Region      string   `yaml:"region"`
+}
+
+// specFlags are the flags of "coder workspaces create" that --from-config
+// replaces with fields of the spec.
+var specFlags = []string{
+	"org", "image", "tag", "from-image-digest", "provider", "cpu", "memory", "disk", "gpus",
+	"container-based-vm", "enable-autostart", "node-selector", "toleration", "region",
+}
+
+// readWorkspaceSpec reads the spec at path, or from stdin if path is "-".
+func readWorkspaceSpec(path string, stdin io.Reader) (*workspaceSpec, error) {
+	var (
+		raw []byte
+		err error
+	)
+	if path == "-" {
+		raw, err = ioutil.ReadAll(stdin)
+	} else {
+		raw, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read workspace spec: %w", err)
+	}
+	spec, err := parseWorkspaceSpec(raw)
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// parseWorkspaceSpec parses a spec in YAML, or in JSON which is a subset of
+// it, rejecting unknown fields so that typos aren't silently ignored.
+func parseWorkspaceSpec(raw []byte) (*workspaceSpec, error) {
+	var spec workspaceSpec
+	if err := yaml.UnmarshalStrict(raw, &spec); err != nil {
+		return nil, xerrors.Errorf("parse: %w", err)
+	}
+	switch {
+	case spec.Image == "":
+		return nil, xerrors.New("image is required")
+	case spec.Tag != "" && spec.Digest != "":
+		return nil, xerrors.New("tag and digest are mutually exclusive")
+	case spec.Digest != "" && !imageDigestPattern.MatchString(spec.Digest):
+		return nil, xerrors.Errorf(`invalid digest %q: digests have the form "sha256:" followed by 64 lowercase hex characters`, spec.Digest)
+	case spec.CPU < 0 || spec.MemoryGB < 0 || spec.DiskGB < 0 || spec.GPUs < 0:
+		return nil, xerrors.New("resources must not be negative")
+	}
+	if _, err := spec.hints(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// hints returns the scheduling hints of the spec, or nil if it has none.
+func (s *workspaceSpec) hints() (*coder.SchedulingHints, error) {
+	if s.Scheduling == nil {
+		return nil, nil
+	}
+	hints := &coder.SchedulingHints{Region: s.Scheduling.Region}
+	for key, value := range s.Scheduling.NodeSelector {
+		if key == "" {
+			return nil, xerrors.Errorf("invalid node selector %q: the label key is empty", key+"="+value)
+		}
+		if hints.NodeSelector == nil {
+			hints.NodeSelector = make(map[string]string)
+		}
+		hints.NodeSelector[key] = value
+	}
+	for _, raw := range s.Scheduling.Tolerations {
+		t, err := parseToleration(raw)
+		if err != nil {
+			return nil, err
+		}
+		hints.Tolerations = append(hints.Tolerations, t)
+	}
+	return hints, nil
+}
+
+// applyWorkspaceSpec creates the workspace of the spec, or edits it to match
+// the spec if it exists. It returns the workspace, or nil if it already
+// matched the spec.
+func applyWorkspaceSpec(ctx context.Context, client coder.Client, spec *workspaceSpec, force bool) (*coder.Workspace, error) {
+	multiOrgMember, err := isMultiOrgMember(ctx, client, coder.Me)
+	if err != nil {
+		return nil, err
+	}
+	if multiOrgMember && spec.Org == "" {
+		return nil, xerrors.New("org is required for multi-org members")
+	}
+	img, err := findImg(ctx, client, findImgConf{
+		email:   coder.Me,
+		imgName: spec.Image,
+		orgName: spec.Org,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var provider *coder.KubernetesProvider
+	if spec.Provider == "" {
+		provider, err = coderutil.DefaultWorkspaceProvider(ctx, client)
+		if err != nil {
+			return nil, xerrors.Errorf("default workspace provider: %w", err)
+		}
+	} else {
+		provider, err = coderutil.ProviderByName(ctx, client, spec.Provider)
+		if err != nil {
+			return nil, xerrors.Errorf("provider by name: %w", err)
+		}
+	}
+	hints, err := spec.hints()
+	if err != nil {
+		return nil, err
+	}
+
+	workspaces, err := getWorkspaces(ctx, client, coder.Me)
+	if err != nil {
+		return nil, err
+	}
+	var existing *coder.Workspace
+	for i, w := range workspaces {
+		if w.Name == spec.Name {
+			existing = &workspaces[i]
+			break
+		}
+	}
+
+	if existing == nil {
+		req := coder.CreateWorkspaceRequest{
+			Name:            spec.Name,
+			ImageID:         img.ID,
+			OrgID:           img.OrganizationID,
+			ImageTag:        spec.Tag,
+			ImageDigest:     spec.Digest,
+			CPUCores:        spec.CPU,
+			MemoryGB:        spec.MemoryGB,
+			DiskGB:          spec.DiskGB,
+			GPUs:            spec.GPUs,
+			UseContainerVM:  spec.ContainerVM,
+			ResourcePoolID:  provider.ID,
+			Namespace:       provider.DefaultNamespace,
+			EnableAutoStart: spec.Autostart,
+			SchedulingHints: hints,
+		}
+		if req.ImageTag == "" && req.ImageDigest == "" {
+			req.ImageTag = defaultImgTag
+		}
+		if req.CPUCores == 0 {
+			req.CPUCores = img.DefaultCPUCores
+		}
+		if req.MemoryGB == 0 {
+			req.MemoryGB = img.DefaultMemoryGB
+		}
+		if req.DiskGB == 0 {
+			req.DiskGB = img.DefaultDiskGB
+		}
+		workspace, err := client.CreateWorkspace(ctx, req)
+		if err != nil {
+			return nil, xerrors.Errorf("create workspace: %w", err)
+		}
+		clog.LogSuccess(i18n.Sprintf("created workspace %q", workspace.Name))
+		return workspace, nil
+	}
+
+	if existing.ResourcePoolID != provider.ID {
+		return nil, clog.Error(i18n.Sprintf("workspace %q is on another provider than the spec", existing.Name),
+			"the provider of a workspace can't be changed",
+			clog.BlankLine,
+			clog.Tipf("remove the workspace with \"coder workspaces rm %s\" to create it again on %s", existing.Name, provider.Name),
+		)
+	}
+	if existing.UseContainerVM != spec.ContainerVM {
+		return nil, clog.Error(i18n.Sprintf("workspace %q doesn't match container_vm of the spec", existing.Name),
+			"whether a workspace is a container-based VM can't be changed",
+			clog.BlankLine,
+			clog.Tipf("remove the workspace with \"coder workspaces rm %s\" to create it again", existing.Name),
+		)
+	}
+	if spec.DiskGB != 0 && spec.DiskGB < existing.DiskGB {
+		return nil, xerrors.Errorf("workspace %q has a %d GB disk, which can't be shrunk to %d GB", existing.Name, existing.DiskGB, spec.DiskGB)
+	}
+
+	req, changes := workspaceSpecChanges(spec, existing, img.ID, hints)
+	if len(changes) == 0 {
+		clog.LogInfo(i18n.Sprintf("workspace %q is up to date", existing.Name))
+		return nil, nil
+	}
+	if !force && existing.LatestStat.ContainerStatus == coder.WorkspaceOn {
+		_, err = (&promptui.Prompt{
+			Label:     fmt.Sprintf("Change %s of workspace %q and rebuild it? (will destroy any work outside of your home directory)", strings.Join(changes, ", "), existing.Name),
+			IsConfirm: true,
+		}).Run()
+		if err != nil {
+			return nil, clog.Fatal(
+				"failed to confirm prompt", clog.BlankLine,
+				clog.Tipf(`use "--force" to rebuild without a confirmation prompt`),
+			)
+		}
+	}
+	if err := client.EditWorkspace(ctx, existing.ID, req); err != nil {
+		return nil, xerrors.Errorf("failed to apply changes to workspace %q: %w", existing.Name, err)
+	}
+	clog.LogSuccess(i18n.Sprintf("changed %s of workspace %q, rebuilding...", strings.Join(changes, ", "), existing.Name))
+	return existing, nil
+}
+
+// workspaceSpecChanges returns the request editing the workspace to match
+// the spec, and the names of the fields it changes.
+func workspaceSpecChanges(spec *workspaceSpec, w *coder.Workspace, imageID string, hints *coder.SchedulingHints) (coder.UpdateWorkspaceReq, []string) {
+	var (
+		req     coder.UpdateWorkspaceReq
+		changes []string
+	)
+	imageChanged := imageID != w.ImageID
+	if imageChanged {
+		req.ImageID = &imageID
+		changes = append(changes, "image")
+	}
+	if spec.Digest != "" {
+		if imageChanged || spec.Digest != w.ImageDigest {
+			req.ImageDigest = &spec.Digest
+			changes = append(changes, "digest")
+		}
+	} else {
+		tag := spec.Tag
+		if tag == "" {
+			tag = defaultImgTag
+		}
+		if imageChanged || w.ImageDigest != "" || tag != w.ImageTag {
+			req.ImageTag = &tag
+			changes = append(changes, "tag")
+		}
+	}
+	if spec.CPU != 0 && spec.CPU != w.CPUCores {
+		req.CPUCores = &spec.CPU
+		changes = append(changes, "cpu")
+	}
+	if spec.MemoryGB != 0 && spec.MemoryGB != w.MemoryGB {
+		req.MemoryGB = &spec.MemoryGB
+		changes = append(changes, "memory")
+	}
+	if spec.DiskGB != 0 && spec.DiskGB != w.DiskGB {
+		req.DiskGB = &spec.DiskGB
+		changes = append(changes, "disk")
+	}
+	if spec.GPUs != 0 && spec.GPUs != w.GPUs {
+		req.GPUs = &spec.GPUs
+		changes = append(changes, "gpus")
+	}
+	if hints != nil && !reflect.DeepEqual(hints, normalizedHints(w.SchedulingHints)) {
+		req.SchedulingHints = hints
+		changes = append(changes, "scheduling")
+	}
+	return req, changes
+}
+
+// normalizedHints returns the hints with empty fields set the way
+// workspaceSpec.hints sets them, so that they compare equal.
+func normalizedHints(h *coder.SchedulingHints) *coder.SchedulingHints {
+	n := &coder.SchedulingHints{}
+	if h == nil {
+		return n
+	}
+	n.Region = h.Region
+	if len(h.NodeSelector) > 0 {
+		n.NodeSelector = h.NodeSelector
+	}
+	if len(h.Tolerations) > 0 {
+		n.Tolerations = h.Tolerations
+	}
+	return n
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_parseWorkspaceSpec(t *testing.T) {
+	t.Parallel()
+
+	spec, err := parseWorkspaceSpec([]byte(`{"name": "dev", "image": "ubuntu", "cpu": 4, "scheduling": {"tolerations": ["nvidia.com/gpu:NoSchedule"]}}`))
+	assert.Success(t, "json", err)
+	assert.Equal(t, "name", "dev", spec.Name)
+	assert.Equal(t, "cpu", float32(4), spec.CPU)
+	hints, err := spec.hints()
+	assert.Success(t, "hints", err)
+	assert.Equal(t, "toleration", coder.Toleration{Key: "nvidia.com/gpu", Operator: coder.TolerationExists, Effect: "NoSchedule"}, hints.Tolerations[0])
+
+	for name, raw := range map[string]string{
+		"no image":       "name: dev\n",
+		"unknown field":  "image: ubuntu\ncpus: 4\n",
+		"tag and digest": "image: ubuntu\ntag: latest\ndigest: sha256:0000000000000000000000000000000000000000000000000000000000000000\n",
+		"invalid digest": "image: ubuntu\ndigest: latest\n",
+		"negative":       "image: ubuntu\nmemory: -1\n",
+		"bad toleration": "image: ubuntu\nscheduling:\n  tolerations: [\"gpu:Sometimes\"]\n",
+	} {
+		_, err := parseWorkspaceSpec([]byte(raw))
+		assert.Error(t, name, err)
+	}
+}
+
+func Test_workspaceSpecChanges(t *testing.T) {
+	t.Parallel()
+	w := &coder.Workspace{ImageID: "img", ImageTag: "latest", CPUCores: 2, MemoryGB: 4, DiskGB: 10}
+
+	_, changes := workspaceSpecChanges(&workspaceSpec{Image: "ubuntu"}, w, "img", nil)
+	assert.Equal(t, "unset fields are left alone", 0, len(changes))
+
+	_, changes = workspaceSpecChanges(&workspaceSpec{Image: "ubuntu", Scheduling: &workspaceSpecScheduling{}}, w, "img", &coder.SchedulingHints{})
+	assert.Equal(t, "empty scheduling matches no hints", 0, len(changes))
+
+	req, changes := workspaceSpecChanges(&workspaceSpec{Image: "ubuntu", Tag: "22.04", CPU: 4, DiskGB: 10}, w, "img", nil)
+	assert.Equal(t, "changes", []string{"tag", "cpu"}, changes)
+	assert.Equal(t, "tag", "22.04", *req.ImageTag)
+	assert.Equal(t, "cpu", float32(4), *req.CPUCores)
+	assert.True(t, "disk unchanged", req.DiskGB == nil)
+
+	req, changes = workspaceSpecChanges(&workspaceSpec{Image: "centos"}, w, "other", nil)
+	assert.Equal(t, "new image resets the tag", []string{"image", "tag"}, changes)
+	assert.Equal(t, "default tag", defaultImgTag, *req.ImageTag)
+}
+
+func Test_createWorkspaceFromConfig(t *testing.T) {
+	ctx := context.Background()
+	fake := codertest.New()
+	fake.AddProvider(coder.KubernetesProvider{Name: "us-east", BuiltIn: true})
+	fake.AddImage(coder.Image{Repository: "codercom/ubuntu", DefaultCPUCores: 2, DefaultMemoryGB: 4, DefaultDiskGB: 10}, "latest")
+	useFakeClient(t, fake)
+
+	path := filepath.Join(t.TempDir(), "workspace.yaml")
+	writeSpec := func(spec string) {
+		assert.Success(t, "write spec", ioutil.WriteFile(path, []byte(spec), 0600))
+	}
+
+	writeSpec("name: dev\nimage: codercom/ubuntu\nmemory: 8\n")
+	res := execute(t, nil, "workspaces", "create", "--from-config", path)
+	res.success(t)
+	res.stderrContains(t, `created workspace "dev"`)
+	workspaces, err := fake.Workspaces(ctx)
+	assert.Success(t, "list workspaces", err)
+	assert.Equal(t, "created", 1, len(workspaces))
+	assert.Equal(t, "image default cpu", float32(2), workspaces[0].CPUCores)
+	assert.Equal(t, "memory of the spec", float32(8), workspaces[0].MemoryGB)
+
+	res = execute(t, nil, "workspaces", "create", "--from-config", path)
+	res.success(t)
+	res.stderrContains(t, `workspace "dev" is up to date`)
+	assert.Equal(t, "no edit", 0, len(fake.CallsTo("EditWorkspace")))
+
+	writeSpec("name: dev\nimage: codercom/ubuntu\nmemory: 8\ncpu: 4\n")
+	res = execute(t, nil, "workspaces", "create", "--from-config", path, "--force")
+	res.success(t)
+	res.stderrContains(t, `changed cpu of workspace "dev"`)
+	w, err := fake.WorkspaceByID(ctx, workspaces[0].ID)
+	assert.Success(t, "get workspace", err)
+	assert.Equal(t, "cpu applied", float32(4), w.CPUCores)
+
+	writeSpec("name: dev\nimage: codercom/ubuntu\ndisk: 5\n")
+	res = execute(t, nil, "workspaces", "create", "--from-config", path)
+	res.error(t)
+
+	res = execute(t, nil, "workspaces", "create", "--from-config", path, "--cpu", "2")
+	res.error(t)
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/internal/x/xcobra"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+func watchWorkspaceCmd() *cobra.Command {
+	var (
+		user    string
+		timeout time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "watch <workspace_name>",
+		Short: "stream the build log and status changes of a workspace until it is on or failed",
+		Long: "Stream the build log and the status changes of a workspace until it is on, " +
+			"exiting with an error if its build fails, it is deleted, or --timeout elapses.\n\n" +
+			"It returns at once for a workspace that is already on or failed, so run it once the build " +
+			"was started, such as after \"coder workspaces rebuild\". With --output json, each event is " +
+			"printed as a JSON object on its own line.",
+		Example: `# block a CI pipeline until the workspace is ready
+coder workspaces rebuild my-workspace --force
+coder workspaces watch my-workspace --timeout 15m
+
+# print the build stages as they start
+coder workspaces watch my-workspace --output json | jq -r 'select(.type == "build") | .build.msg'`,
+		Args: xcobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			switch outputFormat {
+			case humanOutput, jsonOutput, ndjsonOutput, yamlOutput:
+			default:
+				return xerrors.Errorf("unknown --output value %q, expected human, json, ndjson or yaml", outputFormat)
+			}
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, args[0], user)
+			if err != nil {
+				return err
+			}
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			err = followWorkspace(ctx, client, workspace, cmd.OutOrStdout())
+			if xerrors.Is(err, context.DeadlineExceeded) {
+				return clog.Error(i18n.Sprintf("workspace %q is not on after %s", workspace.Name, timeout),
+					clog.BlankLine,
+					clog.Tipf("raise --timeout if the image takes a while to pull"),
+				)
+			}
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&user, "user", coder.Me, "Specify the user whose resources to target")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "give up if the workspace is not on after this long (0 waits forever)")
+	addOutputFlag(cmd)
+	// The example rebuilds the workspace.
+	keepExamples(cmd)
+	return cmd
+}
+
+// followWorkspace writes the build log and the status changes of the
+// workspace to w until it is on, and returns an error if it fails or is
+// deleted first.
+func followWorkspace(ctx context.Context, client coder.Client, workspace *coder.Workspace, w io.Writer) error {
+	status := workspace.LatestStat.ContainerStatus
+	if status == coder.WorkspaceOn || status == coder.WorkspaceFailed {
+		current := coder.Event{Type: coder.EventTypeWorkspace, Time: time.Now(), Workspace: &coder.WorkspaceEvent{Workspace: *workspace}}
+		err := writeWorkspaceEvent(w, current, func() {
+			fmt.Fprintf(w, "status: %s\n", strings.ToLower(string(status)))
+		})
+		if err != nil {
+			return err
+		}
+		if status == coder.WorkspaceFailed {
+			return buildFailedError(workspace.Name)
+		}
+		return nil
+	}
+	if status == coder.WorkspaceOff {
+		clog.LogInfo(i18n.Sprintf("workspace %q is off, waiting for it to start", workspace.Name))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		settled bool
+		result  error
+	)
+	settle := func(err error) {
+		settled, result = true, err
+		cancel()
+	}
+	handle := func(ev coder.Event, human func()) {
+		if settled {
+			return
+		}
+		if err := writeWorkspaceEvent(w, ev, human); err != nil {
+			settle(err)
+		}
+	}
+
+	filter := coder.EventFilter{
+		WorkspaceIDs: []string{workspace.ID},
+		Types:        []coder.EventType{coder.EventTypeWorkspace, coder.EventTypeBuild},
+	}
+	err := client.SubscribeEvents(ctx, filter, coder.EventHandlers{
+		Build: func(log coder.BuildLog) {
+			handle(coder.Event{Type: coder.EventTypeBuild, Time: log.Time, Build: &log}, func() {
+				if log.Type == coder.BuildLogTypeSubstage && !verboseAt(verbosityInfo) {
+					return
+				}
+				if log.Type == coder.BuildLogTypeStage || log.Type == coder.BuildLogTypeSubstage || log.Type == coder.BuildLogTypeError {
+					fmt.Fprintf(w, "%s %s\n", log.Time.Local().Format(time.RFC3339), log.Msg)
+				}
+			})
+		},
+		Workspace: func(t time.Time, ev coder.WorkspaceEvent) {
+			next := ev.Workspace.LatestStat.ContainerStatus
+			handle(coder.Event{Type: coder.EventTypeWorkspace, Time: t, Workspace: &ev}, func() {
+				if next != status && !ev.Deleted {
+					fmt.Fprintf(w, "%s status: %s -> %s\n", t.Local().Format(time.RFC3339), strings.ToLower(string(status)), strings.ToLower(string(next)))
+				}
+			})
+			if settled {
+				return
+			}
+			status = next
+			switch {
+			case ev.Deleted:
+				settle(clog.Error(i18n.Sprintf("workspace %q was deleted", workspace.Name)))
+			case status == coder.WorkspaceOn:
+				settle(nil)
+			case status == coder.WorkspaceFailed:
+				settle(buildFailedError(workspace.Name))
+			}
+		},
+		Reconnect: func(err error) {
+			clog.LogWarn("lost the event stream of the deployment, reconnecting", err.Error())
+		},
+	})
+	if settled {
+		if result == nil && outputFormat == humanOutput {
+			clog.LogSuccess(i18n.Sprintf("workspace %q is on", workspace.Name))
+		}
+		return result
+	}
+	return err
+}
+
+// buildFailedError explains that the build of the workspace failed.
+func buildFailedError(name string) error {
+	return clog.Error(i18n.Sprintf("workspace %q failed to build", name),
+		clog.BlankLine,
+		clog.Tipf("see the build log with \"coder workspaces watch-build %s\", then rebuild it with \"coder workspaces rebuild %s\"", name, name),
+	)
+}
+
+// writeWorkspaceEvent writes the event in the format of the --output flag,
+// calling human for humanOutput. In YAML, each event is its own document.
+func writeWorkspaceEvent(w io.Writer, ev coder.Event, human func()) error {
+	switch outputFormat {
+	case humanOutput:
+		human()
+		return nil
+	case yamlOutput:
+		if _, err := fmt.Fprintln(w, "---"); err != nil {
+			return xerrors.Errorf("write YAML: %w", err)
+		}
+	}
+	return writeOutput(w, ev, nil)
+}
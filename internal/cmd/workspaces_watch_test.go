@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/coder-sdk/codertest"
+)
+
+func Test_workspacesWatch(t *testing.T) {
+	start := time.Date(2021, 5, 4, 13, 2, 0, 0, time.UTC)
+	newFake := func(final coder.WorkspaceStatus) {
+		fake := codertest.New()
+		workspace := coder.Workspace{Name: "my-dev", LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceCreating}}
+		id := fake.AddWorkspace(workspace)
+		workspace.ID = id
+		workspace.LatestStat.ContainerStatus = final
+		fake.AddEvents(
+			coder.Event{Type: coder.EventTypeBuild, Time: start, Build: &coder.BuildLog{WorkspaceID: id, Time: start, Type: coder.BuildLogTypeStage, Msg: "Pulling image"}},
+			coder.Event{Type: coder.EventTypeWorkspace, Time: start.Add(time.Minute), Workspace: &coder.WorkspaceEvent{Workspace: workspace}},
+			coder.Event{Type: coder.EventTypeBuild, Time: start.Add(2 * time.Minute), Build: &coder.BuildLog{WorkspaceID: id, Time: start, Type: coder.BuildLogTypeStage, Msg: "after the build"}},
+		)
+		useFakeClient(t, fake)
+	}
+
+	newFake(coder.WorkspaceOn)
+	res := execute(t, nil, "workspaces", "watch", "my-dev")
+	res.success(t)
+	res.stdoutContains(t, "Pulling image")
+	res.stdoutContains(t, "status: creating -> on")
+	res.stderrContains(t, `workspace "my-dev" is on`)
+	assert.True(t, "stops once on", !strings.Contains(res.outBuffer.String(), "after the build"))
+
+	newFake(coder.WorkspaceOn)
+	res = execute(t, nil, "workspaces", "watch", "my-dev", "--output", "json")
+	res.success(t)
+	var events []coder.Event
+	dec := json.NewDecoder(bytes.NewReader(res.outBuffer.Bytes()))
+	for dec.More() {
+		var ev coder.Event
+		assert.Success(t, "decode event", dec.Decode(&ev))
+		events = append(events, ev)
+	}
+	assert.Equal(t, "events", 2, len(events))
+	assert.Equal(t, "build", "Pulling image", events[0].Build.Msg)
+	assert.Equal(t, "status", coder.WorkspaceOn, events[1].Workspace.Workspace.LatestStat.ContainerStatus)
+
+	newFake(coder.WorkspaceFailed)
+	res = execute(t, nil, "workspaces", "watch", "my-dev")
+	res.error(t)
+	res.stderrContains(t, "failed to build")
+
+	newFake(coder.WorkspaceCreating)
+	res = execute(t, nil, "workspaces", "watch", "my-dev", "--timeout", "50ms")
+	res.error(t)
+	res.stderrContains(t, "is not on after 50ms")
+
+	// A workspace that is already on returns at once.
+	fake := codertest.New()
+	fake.AddWorkspace(coder.Workspace{Name: "my-dev", LatestStat: coder.WorkspaceStat{ContainerStatus: coder.WorkspaceOn}})
+	useFakeClient(t, fake)
+	res = execute(t, nil, "workspaces", "watch", "my-dev")
+	res.success(t)
+	res.stdoutContains(t, "status: on")
+	assert.Equal(t, "no subscription", 0, len(fake.CallsTo("SubscribeEvents")))
+}
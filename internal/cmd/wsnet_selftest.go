@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"nhooyr.io/websocket"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+	"cdr.dev/coder-cli/wsnet"
+)
+
+// selftestPayloadSize is how much data the selftest echoes through the
+// connection to measure its throughput.
+const selftestPayloadSize = 1 << 20
+
+func wsnetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "wsnet",
+		Short:  "diagnose the networking of workspace connections",
+		Hidden: true,
+	}
+	cmd.AddCommand(wsnetSelftestCmd())
+	return cmd
+}
+
+func wsnetSelftestCmd() *cobra.Command {
+	var (
+		agentToken string
+		relay      bool
+		timeout    time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "selftest [workspace_name]",
+		Short: "connect to this machine through the broker of a workspace and time each step",
+		Long: "Start an agent in this process with an agent token of the workspace, connect to it through the broker " +
+			"of the deployment like \"coder tunnel\" does, and echo data through the connection, timing each step.\n\n" +
+			"Both ends run on this machine, so a failure points at its network or the deployment rather than at the workspace, " +
+			"which helps tell client networking issues from server ones in bug reports. " +
+			"The agent listens with a label of its own, so the workspace's agent keeps running undisturbed.\n\n" +
+			"The agent token is read from --agent-token or CODER_AGENT_TOKEN, which is set inside workspaces.",
+		Example: `# from inside the workspace
+coder wsnet selftest my-dev
+
+# check whether the broker relay works where WebRTC is blocked
+coder wsnet selftest my-dev --relay --output json`,
+		Args: cobra.RangeArgs(0, 1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			target, _, err := workspaceArg("", args, 0)
+			if err != nil {
+				return err
+			}
+			if agentToken == "" {
+				agentToken = os.Getenv("CODER_AGENT_TOKEN")
+			}
+			if agentToken == "" {
+				return clog.Error("no agent token",
+					"the selftest listens as an agent of the workspace",
+					clog.BlankLine,
+					clog.Tipf("run it inside the workspace, or pass --agent-token"),
+				)
+			}
+
+			client, err := newClient(ctx, true)
+			if err != nil {
+				return err
+			}
+			workspace, err := findWorkspace(ctx, client, target, coder.Me)
+			if err != nil {
+				return err
+			}
+			iceServers, err := client.ICEServers(ctx)
+			if err != nil {
+				return xerrors.Errorf("get ICE servers: %w", err)
+			}
+			hc, err := newHTTPClient(ctx)
+			if err != nil {
+				return err
+			}
+
+			// A label of its own keeps the broker from routing the dialer to
+			// the workspace's agent.
+			var b [4]byte
+			_, _ = rand.Read(b[:])
+			label := "selftest-" + hex.EncodeToString(b[:])
+			baseURL := client.BaseURL()
+			dialLog := subsystemLogger("wsnet", verbosityDebug)
+			iceLog := subsystemLogger("ice", verbosityTrace)
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			steps, err := wsnetSelftest(ctx, selftestOptions{
+				listenEndpoint:  wsnet.AgentListenEndpoint(&baseURL, agentToken, label),
+				connectEndpoint: wsnet.AgentConnectEndpoint(&baseURL, workspace.ID, label, client.Token()),
+				agentToken:      agentToken,
+				httpClient:      hc,
+				dial: &wsnet.DialOptions{
+					Log:                &dialLog,
+					ICELog:             &iceLog,
+					ICEServers:         iceServers,
+					TURNProxyAuthToken: client.Token(),
+					TURNRemoteProxyURL: &baseURL,
+					TURNLocalProxyURL:  &baseURL,
+					HTTPClient:         hc,
+					Relay:              relay,
+				},
+			})
+
+			if len(steps) == 0 {
+				if err != nil {
+					return err
+				}
+				steps = []selftestStep{} // ensures that json output still marshals
+			}
+			werr := writeOutput(cmd.OutOrStdout(), steps, func() error {
+				return writeTable(cmd.OutOrStdout(), len(steps), func(i int) interface{} {
+					return steps[i]
+				})
+			})
+			if werr != nil {
+				return xerrors.Errorf("write output: %w", werr)
+			}
+			if err != nil {
+				return selftestError(steps, relay, err)
+			}
+			clog.LogSuccess("connected to this machine through the broker")
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&agentToken, "agent-token", "", "agent token of the workspace, instead of the CODER_AGENT_TOKEN env variable")
+	cmd.Flags().BoolVar(&relay, "relay", false, "relay traffic through the broker without trying a peer-to-peer connection")
+	cmd.Flags().DurationVar(&timeout, "timeout", time.Minute, "give up on the selftest after this long")
+	addOutputShorthand(cmd)
+	return cmd
+}
+
+// selftestStep is a step of the selftest and how long it took.
+type selftestStep struct {
+	Step       string `json:"step" table:"Step"`
+	Took       string `json:"-" table:"Took"`
+	DurationMS int64  `json:"duration_ms" table:"-"`
+	Detail     string `json:"detail,omitempty" table:"Detail"`
+	Error      string `json:"error,omitempty" table:"Error"`
+}
+
+type selftestOptions struct {
+	listenEndpoint  string
+	connectEndpoint string
+	agentToken      string
+	httpClient      *http.Client
+	dial            *wsnet.DialOptions
+}
+
+// wsnetSelftest listens as an agent at the listen endpoint, dials it
+// through the connect endpoint and echoes data through the connection. It
+// returns the steps it went through, the last of which failed if it returns
+// an error.
+func wsnetSelftest(ctx context.Context, opts selftestOptions) ([]selftestStep, error) {
+	var steps []selftestStep
+	step := func(name string, fn func() (string, error)) error {
+		start := time.Now()
+		detail, err := fn()
+		took := time.Since(start)
+		s := selftestStep{
+			Step:       name,
+			Took:       took.Round(time.Millisecond).String(),
+			DurationMS: took.Milliseconds(),
+			Detail:     detail,
+		}
+		if err != nil {
+			s.Error = err.Error()
+		}
+		steps = append(steps, s)
+		return err
+	}
+
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, xerrors.Errorf("listen: %w", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	var listener io.Closer
+	err = step("listen", func() (string, error) {
+		listener, err = wsnet.ListenWithOptions(ctx, subsystemLogger("wsnet_listen", verbosityDebug), opts.listenEndpoint, opts.agentToken, &wsnet.ListenOptions{
+			HTTPClient: opts.httpClient,
+		})
+		return "", err
+	})
+	if err != nil {
+		return steps, err
+	}
+	defer listener.Close()
+
+	var dialer *wsnet.Dialer
+	err = step("handshake", func() (string, error) {
+		dialer, err = wsnet.DialWebsocket(ctx, opts.connectEndpoint, opts.dial, &websocket.DialOptions{HTTPClient: opts.httpClient})
+		if err != nil {
+			return "", err
+		}
+		if dialer.Relayed() {
+			return "relayed over the broker", nil
+		}
+		pair, err := dialer.Candidates()
+		if err != nil || pair == nil {
+			return "peer-to-peer", nil
+		}
+		return fmt.Sprintf("peer-to-peer, %s to %s over %s", pair.Local.Typ, pair.Remote.Typ, pair.Local.Protocol), nil
+	})
+	if err != nil {
+		return steps, err
+	}
+	defer dialer.Close()
+
+	var conn net.Conn
+	err = step("dial", func() (string, error) {
+		conn, err = dialer.DialContext(ctx, "tcp", echo.Addr().String())
+		return "", err
+	})
+	if err != nil {
+		return steps, err
+	}
+	defer conn.Close()
+
+	err = step("echo", func() (string, error) {
+		start := time.Now()
+		payload := make([]byte, selftestPayloadSize)
+		_, _ = rand.Read(payload)
+		errCh := make(chan error, 1)
+		go func() {
+			// Data channels take messages of up to 32KiB.
+			for sent := 0; sent < len(payload); sent += 32 << 10 {
+				end := sent + 32<<10
+				if end > len(payload) {
+					end = len(payload)
+				}
+				if _, err := conn.Write(payload[sent:end]); err != nil {
+					// Unblock the read of the echo.
+					_ = conn.Close()
+					errCh <- err
+					return
+				}
+			}
+			errCh <- nil
+		}()
+		got := make([]byte, len(payload))
+		if _, err := io.ReadFull(conn, got); err != nil {
+			return "", xerrors.Errorf("read echo: %w", err)
+		}
+		if err := <-errCh; err != nil {
+			return "", xerrors.Errorf("write: %w", err)
+		}
+		if !bytes.Equal(payload, got) {
+			return "", xerrors.New("the echoed data differs from what was sent")
+		}
+		rate := float64(2*len(payload)) / time.Since(start).Seconds()
+		return fmt.Sprintf("%s each way, %s/s", formatBytes(uint64(len(payload))), formatBytes(uint64(rate))), nil
+	})
+	if err != nil {
+		return steps, err
+	}
+
+	err = step("ping", func() (string, error) {
+		return "", dialer.Ping(ctx)
+	})
+	return steps, err
+}
+
+// selftestError explains the failed step of the selftest.
+func selftestError(steps []selftestStep, relay bool, err error) error {
+	var failed string
+	if len(steps) > 0 {
+		failed = steps[len(steps)-1].Step
+	}
+	lines := []string{err.Error(), clog.BlankLine}
+	switch {
+	case failed == "listen":
+		lines = append(lines, clog.Tipf("check that the agent token belongs to the workspace and that the broker is reachable"))
+	case failed == "handshake" && !relay:
+		lines = append(lines, clog.Tipf("pass --relay to check whether the network blocks WebRTC, such as UDP and TURN traffic"))
+	default:
+		lines = append(lines, clog.Tipf("run with -vv for the logs of both ends, and attach them to the bug report"))
+	}
+	return clog.Fatal(i18n.Sprintf("the selftest failed at the %s step", failed), lines...)
+}
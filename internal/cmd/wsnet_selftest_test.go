@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"github.com/hashicorp/yamux"
+	"nhooyr.io/websocket"
+
+	"cdr.dev/coder-cli/wsnet"
+)
+
+// selftestBroker pairs the dialers of /connect with the listener of /listen,
+// like the broker of a deployment.
+func selftestBroker(t *testing.T) (connectURL, listenURL string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Success(t, "listen", err)
+	var (
+		mux  = http.NewServeMux()
+		mu   sync.Mutex
+		sess *yamux.Session
+	)
+	mux.HandleFunc("/listen", func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		sess, _ = yamux.Client(websocket.NetConn(context.Background(), c, websocket.MessageBinary), nil)
+	})
+	mux.HandleFunc("/connect", func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		nc := websocket.NetConn(context.Background(), c, websocket.MessageBinary)
+		mu.Lock()
+		oc, err := sess.Open()
+		mu.Unlock()
+		if err != nil {
+			return
+		}
+		go func() {
+			_, _ = io.Copy(nc, oc)
+		}()
+		_, _ = io.Copy(oc, nc)
+	})
+	s := &http.Server{Handler: mux}
+	go func() {
+		_ = s.Serve(listener)
+	}()
+	t.Cleanup(func() { _ = s.Close() })
+	return fmt.Sprintf("ws://%s/connect", listener.Addr()), fmt.Sprintf("ws://%s/listen", listener.Addr())
+}
+
+func Test_wsnetSelftest(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	connectURL, listenURL := selftestBroker(t)
+	for _, relay := range []bool{false, true} {
+		steps, err := wsnetSelftest(ctx, selftestOptions{
+			listenEndpoint:  listenURL,
+			connectEndpoint: connectURL,
+			dial:            &wsnet.DialOptions{Relay: relay},
+		})
+		assert.Success(t, "selftest", err)
+		names := make([]string, 0, len(steps))
+		for _, s := range steps {
+			names = append(names, s.Step)
+		}
+		assert.Equal(t, "steps", []string{"listen", "handshake", "dial", "echo", "ping"}, names)
+	}
+
+	steps, err := wsnetSelftest(ctx, selftestOptions{
+		listenEndpoint:  "ws://127.0.0.1:1/listen",
+		connectEndpoint: connectURL,
+		dial:            &wsnet.DialOptions{},
+	})
+	assert.Error(t, "no broker", err)
+	assert.Equal(t, "failed step", "listen", steps[len(steps)-1].Step)
+	assert.Error(t, "explained", selftestError(steps, false, err))
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/wsnet"
+)
+
+// wsnetTraceFlags are the flags of commands that connect to a workspace over
+// wsnet, for writing a connection trace to attach to support tickets.
+type wsnetTraceFlags struct {
+	path     string
+	noRedact bool
+}
+
+func (f *wsnetTraceFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.path, "trace-wsnet", "", "append a trace of the workspace connection's lifecycle to this file")
+	cmd.Flags().BoolVar(&f.noRedact, "trace-wsnet-no-redact", false, "include IP addresses in the --trace-wsnet output")
+	_ = cmd.MarkFlagFilename("trace-wsnet")
+	// Only asked for by support, so it isn't worth a line of help or completion.
+	_ = cmd.Flags().MarkHidden("trace-wsnet-no-redact")
+}
+
+// open returns the tracer to pass in wsnet.DialOptions, and a function to
+// close the trace file. The tracer is nil if no trace was requested.
+func (f *wsnetTraceFlags) open() (*wsnet.Tracer, func() error, error) {
+	if f.path == "" {
+		return nil, func() error { return nil }, nil
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("open wsnet trace: %w", err)
+	}
+	return wsnet.NewTracer(file, !f.noRedact), file.Close, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"sync"
+	"time"
 
 	"golang.org/x/xerrors"
 	"nhooyr.io/websocket"
@@ -110,9 +111,13 @@ func WorkspacesHumanTable(ctx context.Context, client coder.Client, workspaces [
 		if !ok {
 			return nil, xerrors.Errorf("fetch workspace workspace provider: %w", coder.ErrNotFound)
 		}
+		image := fmt.Sprintf("%s:%s", imageMap[e.ImageID].Repository, e.ImageTag)
+		if e.ImageDigest != "" {
+			image = fmt.Sprintf("%s@%s", imageMap[e.ImageID].Repository, e.ImageDigest)
+		}
 		pooledWorkspaces = append(pooledWorkspaces, WorkspaceTable{
 			Name:     e.Name,
-			Image:    fmt.Sprintf("%s:%s", imageMap[e.ImageID].Repository, e.ImageTag),
+			Image:    image,
 			CPU:      e.CPUCores,
 			MemoryGB: e.MemoryGB,
 			DiskGB:   e.DiskGB,
@@ -124,6 +129,86 @@ func WorkspacesHumanTable(ctx context.Context, client coder.Client, workspaces [
 	return pooledWorkspaces, nil
 }
 
+// OwnedWorkspaceTable defines a Workspace-like structure for listings across
+// users and organizations, naming the owner, organization and provider of each
+// workspace.
+type OwnedWorkspaceTable struct {
+	ID           string    `json:"id"             table:"-"`
+	Name         string    `json:"name"           table:"Name"`
+	Owner        string    `json:"owner"          table:"Owner"`
+	Organization string    `json:"organization"   table:"Organization"`
+	Provider     string    `json:"provider"       table:"Provider"`
+	Status       string    `json:"status"         table:"Status"`
+	LastActive   string    `json:"-"              table:"LastActive"`
+	LastActiveAt time.Time `json:"last_active_at" table:"-"`
+}
+
+// OwnedWorkspacesTable composes each Workspace with the email of its owner and
+// the names of its organization and provider.
+func OwnedWorkspacesTable(ctx context.Context, client coder.Client, workspaces []coder.Workspace) ([]OwnedWorkspaceTable, error) {
+	row, err := OwnedWorkspaceRow(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]OwnedWorkspaceTable, 0, len(workspaces))
+	for _, w := range workspaces {
+		rows = append(rows, row(w))
+	}
+	return rows, nil
+}
+
+// OwnedWorkspaceRow fetches the users, organizations and providers once, and
+// returns a function composing a Workspace with the email of its owner and
+// the names of its organization and provider, for workspaces listed one at a
+// time.
+func OwnedWorkspaceRow(ctx context.Context, client coder.Client) (func(coder.Workspace) OwnedWorkspaceTable, error) {
+	users, err := client.Users(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("get users: %w", err)
+	}
+	owners := make(map[string]string, len(users))
+	for _, u := range users {
+		owners[u.ID] = u.Email
+	}
+	orgs, err := client.Organizations(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("get organizations: %w", err)
+	}
+	orgNames := make(map[string]string, len(orgs))
+	for _, org := range orgs {
+		orgNames[org.ID] = org.Name
+	}
+	providers, err := client.WorkspaceProviders(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("get workspace providers: %w", err)
+	}
+	providerNames := make(map[string]string, len(providers.Kubernetes))
+	for _, p := range providers.Kubernetes {
+		providerNames[p.ID] = p.Name
+	}
+
+	return func(w coder.Workspace) OwnedWorkspaceTable {
+		lastActive := w.LastConnectionAt
+		if w.LastOpenedAt.After(lastActive) {
+			lastActive = w.LastOpenedAt
+		}
+		row := OwnedWorkspaceTable{
+			ID:           w.ID,
+			Name:         w.Name,
+			Owner:        owners[w.UserID],
+			Organization: orgNames[w.OrganizationID],
+			Provider:     providerNames[w.ResourcePoolID],
+			Status:       string(w.LatestStat.ContainerStatus),
+			LastActive:   "never",
+			LastActiveAt: lastActive,
+		}
+		if !lastActive.IsZero() {
+			row.LastActive = lastActive.UTC().Format("2006-01-02 15:04")
+		}
+		return row
+	}, nil
+}
+
 // MakeImageMap fetches all image entities specified in the slice of workspaces, then places them into an ID map.
 func MakeImageMap(ctx context.Context, client coder.Client, workspaces []coder.Workspace) (map[string]*coder.Image, error) {
 	var (
@@ -15,6 +15,16 @@ func SetRoot(root string) {
 	configRoot = root
 }
 
+// Dir returns the path of a subdirectory of the configuration directory,
+// creating it if needed.
+func Dir(name string) (string, error) {
+	path := filepath.Join(configRoot, name)
+	if err := os.MkdirAll(path, 0750); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
 // open opens a file in the configuration directory,
 // creating all intermediate directories.
 func open(path string, flag int, mode os.FileMode) (*os.File, error) {
@@ -23,4 +23,57 @@ func (f File) Read() (string, error) {
 var (
 	Session File = "session"
 	URL     File = "url"
+
+	// ProxyPAC is the URL or path of a proxy auto-config script.
+	ProxyPAC File = "proxy_pac"
+	// ProxyAuth is the proxy authentication scheme: basic, ntlm or negotiate.
+	ProxyAuth File = "proxy_auth"
+	// SSHAutoRefresh holds the ssh config path and options that config-ssh
+	// regenerates whenever workspaces are created or removed. Refreshing is
+	// disabled when it doesn't exist.
+	SSHAutoRefresh File = "ssh_auto_refresh"
+	// CredentialHelper is the command run to get session tokens instead of
+	// reading Session.
+	CredentialHelper File = "credential_helper"
+	// AuditHeaders lists what is sent with requests to attribute them in
+	// the deployment's audit log: user, host and command, or all.
+	AuditHeaders File = "audit_headers"
+	// DeprecationWarnings holds when each API deprecation was last warned
+	// about, as JSON.
+	DeprecationWarnings File = "deprecation_warnings"
+	// TrustedIdentities holds the identities of workspace agents pinned on
+	// first connect, as JSON.
+	TrustedIdentities File = "trusted_identities"
+	// AgentIdentityKey is the identity key the workspace agent presents to
+	// dialers, as a PEM PKCS #8 block.
+	AgentIdentityKey File = "agent_identity_key"
+	// DefaultWorkspace is the name of the workspace targeted by commands
+	// given no workspace.
+	DefaultWorkspace File = "default_workspace"
+	// UpdateChannel is the release channel "coder update" tracks instead of
+	// the version of the deployment.
+	UpdateChannel File = "update_channel"
+	// SyncMappings lists the local directories synced to workspaces with
+	// "coder sync" and their remote copies, as JSON.
+	SyncMappings File = "sync_mappings"
+	// VersionChecks holds when the CLI version was last compared to the
+	// version offered by each deployment, and the result, as JSON.
+	VersionChecks File = "version_checks"
+	// TableColumns holds the columns of the tables of each command saved
+	// with --save-columns, by command path, as JSON.
+	TableColumns File = "table_columns"
+	// SSHBanner is "off" when "coder ssh" shouldn't print a summary of the
+	// workspace before the shell starts.
+	SSHBanner File = "ssh_banner"
+	// HelpExamples is how help fills the examples of commands: "off" to show
+	// them as written, "local" with the saved settings, or "lookup" to also
+	// query the deployment for a workspace.
+	HelpExamples File = "help_examples"
+	// Satellite is the name of the satellite ssh and tunnel connections are
+	// routed through while it's healthy.
+	Satellite File = "satellite"
+	// SatelliteRoute holds the satellite set when the last connection was
+	// routed, and the name of the satellite, or "" for the deployment, it was
+	// routed through, one per line.
+	SatelliteRoute File = "satellite_route"
 )
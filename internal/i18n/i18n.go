@@ -0,0 +1,106 @@
+// Package i18n translates the user-facing strings of the CLI.
+//
+// Strings are keyed by their English text, which is shown when there's no
+// translation. Translations are registered per language with Register, in a
+// file per language such as en.go, and format strings keep the verbs of the
+// English text, in any order with explicit argument indexes like %[2]s.
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+// LangEnv selects the language of the CLI, overriding the locale.
+const LangEnv = "CODER_LANG"
+
+var (
+	mu       sync.RWMutex
+	tags     []language.Tag
+	catalogs []map[string]string
+	// current holds the translations of the selected language, nil for
+	// English.
+	current map[string]string
+)
+
+// Register adds translations of the English strings for the language.
+func Register(tag language.Tag, messages map[string]string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for i, t := range tags {
+		if t == tag {
+			for k, v := range messages {
+				catalogs[i][k] = v
+			}
+			return
+		}
+	}
+	catalog := make(map[string]string, len(messages))
+	for k, v := range messages {
+		catalog[k] = v
+	}
+	tags = append(tags, tag)
+	catalogs = append(catalogs, catalog)
+}
+
+// SetLanguage selects the closest registered language to lang, a BCP 47 tag
+// or a POSIX locale like "de_DE.UTF-8", falling back to English. The tag
+// of the selected language is returned.
+func SetLanguage(lang string) language.Tag {
+	mu.Lock()
+	defer mu.Unlock()
+	current = nil
+	tag, err := language.Parse(posixToBCP47(lang))
+	if err != nil || len(tags) == 0 {
+		return language.English
+	}
+	// English comes first so that it's the fallback of the matcher.
+	_, i, confidence := language.NewMatcher(append([]language.Tag{language.English}, tags...)).Match(tag)
+	if confidence == language.No || i == 0 {
+		return language.English
+	}
+	current = catalogs[i-1]
+	return tags[i-1]
+}
+
+// LanguageFromEnv returns the language selected by the environment: the
+// LangEnv env variable, or the locale.
+func LanguageFromEnv(getenv func(string) string) string {
+	for _, key := range []string{LangEnv, "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// posixToBCP47 converts a POSIX locale like "pt_BR.UTF-8@euro" to a BCP 47
+// tag like "pt-BR". The C locale is English.
+func posixToBCP47(locale string) string {
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return "en"
+	}
+	return strings.ReplaceAll(locale, "_", "-")
+}
+
+// Text returns the translation of s in the selected language, or s.
+func Text(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if t, ok := current[s]; ok && t != "" {
+		return t
+	}
+	return s
+}
+
+// Sprintf formats the translation of format in the selected language, like
+// fmt.Sprintf.
+func Sprintf(format string, a ...interface{}) string {
+	return fmt.Sprintf(Text(format), a...)
+}
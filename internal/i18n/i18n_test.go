@@ -0,0 +1,53 @@
+package i18n
+
+import (
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+	"golang.org/x/text/language"
+)
+
+func TestPosixToBCP47(t *testing.T) {
+	t.Parallel()
+	for locale, want := range map[string]string{
+		"":                 "en",
+		"C":                "en",
+		"C.UTF-8":          "en",
+		"POSIX":            "en",
+		"de_DE.UTF-8":      "de-DE",
+		"pt_BR":            "pt-BR",
+		"fr_FR.UTF-8@euro": "fr-FR",
+		"es":               "es",
+	} {
+		assert.Equal(t, locale, want, posixToBCP47(locale))
+	}
+}
+
+func TestLanguageFromEnv(t *testing.T) {
+	t.Parallel()
+	env := map[string]string{"LANG": "de_DE.UTF-8", "LC_MESSAGES": "fr_FR.UTF-8"}
+	getenv := func(key string) string { return env[key] }
+	assert.Equal(t, "locale", "fr_FR.UTF-8", LanguageFromEnv(getenv))
+	env[LangEnv] = "es"
+	assert.Equal(t, "override", "es", LanguageFromEnv(getenv))
+}
+
+// Not parallel: the language is selected for the whole package.
+func TestSetLanguage(t *testing.T) {
+	Register(language.French, map[string]string{
+		"tip:":                        "astuce :",
+		"workspace %q was created":    "l'espace de travail %q a été créé",
+		"%d of %d workspaces stopped": "%[2]d espaces de travail, %[1]d arrêtés",
+	})
+	t.Cleanup(func() { SetLanguage("en") })
+
+	assert.Equal(t, "French", language.French, SetLanguage("fr_CA.UTF-8"))
+	assert.Equal(t, "translated", "astuce :", Text("tip:"))
+	assert.Equal(t, "formatted", `l'espace de travail "api" a été créé`, Sprintf("workspace %q was created", "api"))
+	assert.Equal(t, "reordered", "5 espaces de travail, 2 arrêtés", Sprintf("%d of %d workspaces stopped", 2, 5))
+	assert.Equal(t, "untranslated", "cause:", Text("cause:"))
+
+	assert.Equal(t, "unsupported", language.English, SetLanguage("ja_JP.UTF-8"))
+	assert.Equal(t, "English", "tip:", Text("tip:"))
+	assert.Equal(t, "invalid", language.English, SetLanguage("not a locale"))
+}
@@ -0,0 +1,155 @@
+// Package jsonpatch computes JSON patches as defined in RFC 6902.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Operation is a single operation of a JSON patch. Only the "add", "remove"
+// and "replace" operations are produced.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Diff returns the patch that turns the JSON encoding of from into the JSON
+// encoding of to. A nil from is treated as a missing document, so the patch
+// adds to in its entirety.
+func Diff(from, to interface{}) ([]Operation, error) {
+	a, err := normalize(from)
+	if err != nil {
+		return nil, xerrors.Errorf("encode from: %w", err)
+	}
+	b, err := normalize(to)
+	if err != nil {
+		return nil, xerrors.Errorf("encode to: %w", err)
+	}
+	if from == nil {
+		op, err := valueOp("add", "", to)
+		if err != nil {
+			return nil, err
+		}
+		return []Operation{op}, nil
+	}
+
+	var ops []Operation
+	if err := diff(&ops, "", a, b); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// normalize round-trips v through JSON so it only contains the types
+// produced by encoding/json.
+func normalize(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func diff(ops *[]Operation, path string, a, b interface{}) error {
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			return diffObjects(ops, path, a, b)
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok {
+			return diffArrays(ops, path, a, b)
+		}
+	}
+	op, err := valueOp("replace", path, b)
+	if err != nil {
+		return err
+	}
+	*ops = append(*ops, op)
+	return nil
+}
+
+func diffObjects(ops *[]Operation, path string, a, b map[string]interface{}) error {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		av, inA := a[k]
+		bv, inB := b[k]
+		p := path + "/" + escape(k)
+		switch {
+		case !inB:
+			*ops = append(*ops, Operation{Op: "remove", Path: p})
+		case !inA:
+			op, err := valueOp("add", p, bv)
+			if err != nil {
+				return err
+			}
+			*ops = append(*ops, op)
+		default:
+			if err := diff(ops, p, av, bv); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func diffArrays(ops *[]Operation, path string, a, b []interface{}) error {
+	common := len(a)
+	if len(b) < common {
+		common = len(b)
+	}
+	for i := 0; i < common; i++ {
+		if err := diff(ops, path+"/"+strconv.Itoa(i), a[i], b[i]); err != nil {
+			return err
+		}
+	}
+	// Remove from the end so the indexes of earlier elements don't shift.
+	for i := len(a) - 1; i >= common; i-- {
+		*ops = append(*ops, Operation{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+	}
+	for i := common; i < len(b); i++ {
+		op, err := valueOp("add", path+"/"+strconv.Itoa(i), b[i])
+		if err != nil {
+			return err
+		}
+		*ops = append(*ops, op)
+	}
+	return nil
+}
+
+func valueOp(op, path string, v interface{}) (Operation, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return Operation{}, xerrors.Errorf("encode value of %q: %w", path, err)
+	}
+	return Operation{Op: op, Path: path, Value: raw}, nil
+}
+
+// escape escapes a key for use as a JSON pointer reference token, as
+// defined in RFC 6901.
+func escape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
@@ -0,0 +1,49 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	type doc struct {
+		Name   string            `json:"name"`
+		On     bool              `json:"on"`
+		Tags   []string          `json:"tags"`
+		Labels map[string]string `json:"labels"`
+	}
+	from := doc{Name: "dev", On: true, Tags: []string{"a", "b", "c"}, Labels: map[string]string{"team": "x", "a/b": "1"}}
+	to := doc{Name: "dev", On: false, Tags: []string{"a", "z"}, Labels: map[string]string{"team": "x", "owner": "me"}}
+
+	ops, err := Diff(from, to)
+	assert.Success(t, "diff", err)
+	assert.Equal(t, "patch", `[`+
+		`{"op":"remove","path":"/labels/a~1b"},`+
+		`{"op":"add","path":"/labels/owner","value":"me"},`+
+		`{"op":"replace","path":"/on","value":false},`+
+		`{"op":"replace","path":"/tags/1","value":"z"},`+
+		`{"op":"remove","path":"/tags/2"}`+
+		`]`, encode(t, ops))
+
+	ops, err = Diff(to, to)
+	assert.Success(t, "diff unchanged", err)
+	assert.Equal(t, "no operations", 0, len(ops))
+
+	ops, err = Diff(nil, map[string]int{"a": 1})
+	assert.Success(t, "diff from nothing", err)
+	assert.Equal(t, "whole document added", `[{"op":"add","path":"","value":{"a":1}}]`, encode(t, ops))
+
+	ops, err = Diff([]int{1}, []int{1, 2, 3})
+	assert.Success(t, "diff array growth", err)
+	assert.Equal(t, "elements added", `[{"op":"add","path":"/1","value":2},{"op":"add","path":"/2","value":3}]`, encode(t, ops))
+}
+
+func encode(t *testing.T, ops []Operation) string {
+	raw, err := json.Marshal(ops)
+	assert.Success(t, "encode patch", err)
+	return string(raw)
+}
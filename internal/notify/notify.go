@@ -0,0 +1,61 @@
+// Package notify shows desktop notifications using the platform's
+// notification utilities.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/cli/safeexec"
+	"golang.org/x/xerrors"
+)
+
+// ErrUnavailable is returned when no notification utility is accessible,
+// such as on headless systems.
+var ErrUnavailable = errors.New("no desktop notification utility available")
+
+// command returns the command that shows a notification with the given
+// title and message.
+func command(title, message string) []string {
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptQuote(message), appleScriptQuote(title))
+		return []string{"osascript", "-e", script}
+	case "windows":
+		script := fmt.Sprintf(`$n = New-Object System.Windows.Forms.NotifyIcon
+$n.Icon = [System.Drawing.SystemIcons]::Information
+$n.Visible = $true
+$n.ShowBalloonTip(5000, %s, %s, 'Info')
+Start-Sleep -Seconds 5
+$n.Dispose()`, powerShellQuote(title), powerShellQuote(message))
+		return []string{"powershell.exe", "-NoProfile", "-Command", "Add-Type -AssemblyName System.Windows.Forms; " + script}
+	}
+	return []string{"notify-send", "--app-name=coder", title, message}
+}
+
+// Send shows a desktop notification.
+func Send(ctx context.Context, title, message string) error {
+	args := command(title, message)
+	path, err := safeexec.LookPath(args[0])
+	if err != nil {
+		return ErrUnavailable
+	}
+	cmd := exec.CommandContext(ctx, path, args[1:]...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return xerrors.Errorf("%s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func appleScriptQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func powerShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
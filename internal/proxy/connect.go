@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+	"golang.org/x/xerrors"
+)
+
+// connectDialer dials connections through HTTP CONNECT tunnels,
+// performing connection-oriented proxy authentication such as NTLM.
+type connectDialer struct {
+	selectProxies selectFunc
+	auth          AuthScheme
+	dialer        *net.Dialer
+}
+
+// DialContext dials addr through the first proxy that accepts the connection.
+func (d *connectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	target := &url.URL{Scheme: "http", Host: addr}
+	if _, port, _ := net.SplitHostPort(addr); port == "443" {
+		target.Scheme = "https"
+	}
+	proxies, err := d.selectProxies(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, p := range proxies {
+		var conn net.Conn
+		switch {
+		case p == nil:
+			conn, err = d.dialer.DialContext(ctx, network, addr)
+		case p.Scheme == "socks5":
+			conn, err = d.dialSOCKS(ctx, p, network, addr)
+		default:
+			conn, err = d.dialConnect(ctx, p, addr)
+		}
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = xerrors.New("no proxies available")
+	}
+	return nil, lastErr
+}
+
+func (d *connectDialer) dialSOCKS(ctx context.Context, p *url.URL, network, addr string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if p.User != nil {
+		pass, _ := p.User.Password()
+		auth = &proxy.Auth{User: p.User.Username(), Password: pass}
+	}
+	socks, err := proxy.SOCKS5("tcp", p.Host, auth, d.dialer)
+	if err != nil {
+		return nil, err
+	}
+	return socks.(proxy.ContextDialer).DialContext(ctx, network, addr)
+}
+
+func (d *connectDialer) dialConnect(ctx context.Context, p *url.URL, addr string) (_ net.Conn, err error) {
+	conn, err := d.dialer.DialContext(ctx, "tcp", p.Host)
+	if err != nil {
+		return nil, xerrors.Errorf("dial proxy %s: %w", p.Host, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = conn.Close()
+		}
+	}()
+	if p.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: p.Hostname()})
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+
+	scheme := "NTLM"
+	if d.auth == AuthNegotiate {
+		scheme = "Negotiate"
+	}
+	br := bufio.NewReader(conn)
+	resp, err := connectRoundTrip(conn, br, addr, scheme+" "+base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return bufferedConn(conn, br), nil
+	}
+	if resp.StatusCode != http.StatusProxyAuthRequired {
+		return nil, xerrors.Errorf("proxy %s responded to CONNECT with %s", p.Host, resp.Status)
+	}
+	if resp.Close {
+		return nil, xerrors.Errorf("proxy %s closed the connection during %s authentication", p.Host, scheme)
+	}
+
+	var challenge *ntlmChallenge
+	for _, h := range resp.Header.Values("Proxy-Authenticate") {
+		fields := strings.Fields(h)
+		if len(fields) != 2 || !strings.EqualFold(fields[0], scheme) {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, xerrors.Errorf("decode %s challenge: %w", scheme, err)
+		}
+		if challenge, err = parseNTLMChallenge(raw); err != nil {
+			return nil, err
+		}
+	}
+	if challenge == nil {
+		return nil, xerrors.Errorf("proxy %s does not support %s authentication", p.Host, scheme)
+	}
+
+	if p.User == nil {
+		return nil, xerrors.Errorf("proxy %s requires credentials", p.Host)
+	}
+	password, _ := p.User.Password()
+	domain, user := ntlmSplitUser(p.User.Username())
+	var clientChallenge [8]byte
+	if _, err := rand.Read(clientChallenge[:]); err != nil {
+		return nil, err
+	}
+	authMsg := ntlmAuthenticateMessage(challenge, domain, user, password, time.Now(), clientChallenge)
+
+	resp, err = connectRoundTrip(conn, br, addr, scheme+" "+base64.StdEncoding.EncodeToString(authMsg))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("proxy %s rejected %s credentials for %q: %s", p.Host, scheme, p.User.Username(), resp.Status)
+	}
+	return bufferedConn(conn, br), nil
+}
+
+// connectRoundTrip sends a CONNECT request for addr and reads the response,
+// discarding its body so the connection can be reused.
+func connectRoundTrip(conn net.Conn, br *bufio.Reader, addr, authorization string) (*http.Response, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{
+			"Proxy-Authorization": []string{authorization},
+			"Proxy-Connection":    []string{"Keep-Alive"},
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, xerrors.Errorf("write CONNECT request: %w", err)
+	}
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, xerrors.Errorf("read CONNECT response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	return resp, nil
+}
+
+// bufferedConn returns a net.Conn that first drains any bytes already read
+// into br.
+func bufferedConn(conn net.Conn, br *bufio.Reader) net.Conn {
+	if br.Buffered() == 0 {
+		return conn
+	}
+	return &readerConn{Conn: conn, r: br}
+}
+
+type readerConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *readerConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,3 @@
+// Package proxy configures outbound proxying for HTTP and WebSocket connections,
+// including proxy auto-config (PAC) evaluation and NTLM proxy authentication.
+package proxy
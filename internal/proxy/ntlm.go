@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4" //nolint:staticcheck // NTLM requires MD4.
+	"golang.org/x/xerrors"
+)
+
+// NTLM message flags. See [MS-NLMP] 2.2.2.5.
+const (
+	ntlmNegotiateUnicode                 = 0x00000001
+	ntlmNegotiateOEM                     = 0x00000002
+	ntlmRequestTarget                    = 0x00000004
+	ntlmNegotiateNTLM                    = 0x00000200
+	ntlmNegotiateAlwaysSign              = 0x00008000
+	ntlmNegotiateExtendedSessionSecurity = 0x00080000
+	ntlmNegotiateTargetInfo              = 0x00800000
+	ntlmNegotiate128                     = 0x20000000
+	ntlmNegotiate56                      = 0x80000000
+
+	ntlmDefaultFlags = ntlmNegotiateUnicode | ntlmNegotiateOEM | ntlmRequestTarget | ntlmNegotiateNTLM |
+		ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSessionSecurity | ntlmNegotiateTargetInfo |
+		ntlmNegotiate128 | ntlmNegotiate56
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmNegotiateMessage returns the first message of the NTLM handshake.
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmDefaultFlags)
+	// Domain and workstation are left empty.
+	return msg
+}
+
+// ntlmChallenge is the server's response to the negotiate message.
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge [8]byte
+	targetInfo      []byte
+}
+
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 32 || !bytes.Equal(msg[:8], ntlmSignature) {
+		return nil, xerrors.New("invalid ntlm challenge message")
+	}
+	if typ := binary.LittleEndian.Uint32(msg[8:]); typ != 2 {
+		return nil, xerrors.Errorf("unexpected ntlm message type %d", typ)
+	}
+	c := &ntlmChallenge{flags: binary.LittleEndian.Uint32(msg[20:])}
+	copy(c.serverChallenge[:], msg[24:32])
+	if len(msg) >= 48 {
+		length := int(binary.LittleEndian.Uint16(msg[40:]))
+		offset := int(binary.LittleEndian.Uint32(msg[44:]))
+		if offset+length > len(msg) {
+			return nil, xerrors.New("ntlm target info out of range")
+		}
+		c.targetInfo = msg[offset : offset+length]
+	}
+	return c, nil
+}
+
+// ntlmSplitUser splits DOMAIN\user or user@domain into its domain and user parts.
+func ntlmSplitUser(s string) (domain, user string) {
+	if i := strings.IndexByte(s, '\\'); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	if i := strings.LastIndexByte(s, '@'); i >= 0 {
+		return s[i+1:], s[:i]
+	}
+	return "", s
+}
+
+func ntlmUTF16(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+func ntlmHMAC(key []byte, data ...[]byte) []byte {
+	h := hmac.New(md5.New, key)
+	for _, d := range data {
+		_, _ = h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// ntowfv2 derives the NTLMv2 response key. See [MS-NLMP] 3.3.2.
+func ntowfv2(domain, user, password string) []byte {
+	h := md4.New()
+	_, _ = h.Write(ntlmUTF16(password))
+	return ntlmHMAC(h.Sum(nil), ntlmUTF16(strings.ToUpper(user)+domain))
+}
+
+// ntlmAuthenticateMessage builds the final NTLMv2 message of the handshake.
+func ntlmAuthenticateMessage(c *ntlmChallenge, domain, user, password string, now time.Time, clientChallenge [8]byte) []byte {
+	key := ntowfv2(domain, user, password)
+
+	// Windows FILETIME: 100ns intervals since 1601-01-01.
+	timestamp := uint64(now.UnixNano()/100) + 116444736000000000
+	blob := new(bytes.Buffer)
+	blob.Write([]byte{1, 1, 0, 0, 0, 0, 0, 0})
+	_ = binary.Write(blob, binary.LittleEndian, timestamp)
+	blob.Write(clientChallenge[:])
+	blob.Write([]byte{0, 0, 0, 0})
+	blob.Write(c.targetInfo)
+	blob.Write([]byte{0, 0, 0, 0})
+
+	ntProof := ntlmHMAC(key, c.serverChallenge[:], blob.Bytes())
+	ntResponse := append(ntProof, blob.Bytes()...)
+	lmResponse := append(ntlmHMAC(key, c.serverChallenge[:], clientChallenge[:]), clientChallenge[:]...)
+
+	encode := func(s string) []byte { return []byte(s) }
+	if c.flags&ntlmNegotiateUnicode != 0 {
+		encode = ntlmUTF16
+	}
+	fields := [][]byte{lmResponse, ntResponse, encode(domain), encode(user), nil, nil}
+
+	const headerLen = 64
+	msg := make([]byte, headerLen)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	offset := headerLen
+	for i, f := range fields {
+		field := msg[12+8*i:]
+		binary.LittleEndian.PutUint16(field[0:], uint16(len(f)))
+		binary.LittleEndian.PutUint16(field[2:], uint16(len(f)))
+		binary.LittleEndian.PutUint32(field[4:], uint32(offset))
+		offset += len(f)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], c.flags&ntlmDefaultFlags)
+	for _, f := range fields {
+		msg = append(msg, f...)
+	}
+	return msg
+}
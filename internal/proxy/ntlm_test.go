@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func TestNTOWFv2(t *testing.T) {
+	// Test vector from [MS-NLMP] 4.2.4.1.1.
+	got := ntowfv2("Domain", "User", "Password")
+	assert.Equal(t, "ntowfv2", "0c868a403bfd7a93a3001ef22ef02e3f", hex.EncodeToString(got))
+}
+
+func TestNTLMSplitUser(t *testing.T) {
+	domain, user := ntlmSplitUser(`CORP\alice`)
+	assert.Equal(t, "domain", "CORP", domain)
+	assert.Equal(t, "user", "alice", user)
+
+	domain, user = ntlmSplitUser("alice@corp.example.com")
+	assert.Equal(t, "domain", "corp.example.com", domain)
+	assert.Equal(t, "user", "alice", user)
+
+	domain, user = ntlmSplitUser("alice")
+	assert.Equal(t, "domain", "", domain)
+	assert.Equal(t, "user", "alice", user)
+}
+
+func TestConnectDialerNTLM(t *testing.T) {
+	proxyAddr := serveNTLMProxy(t)
+	proxyURL := &url.URL{Scheme: "http", Host: proxyAddr, User: url.UserPassword(`CORP\alice`, "hunter2")}
+
+	d := &connectDialer{
+		selectProxies: func(*url.URL) ([]*url.URL, error) { return []*url.URL{proxyURL}, nil },
+		auth:          AuthNTLM,
+		dialer:        &net.Dialer{},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := d.DialContext(ctx, "tcp", "example.com:443")
+	assert.Success(t, "dial through proxy", err)
+	defer conn.Close()
+
+	b, err := ioutil.ReadAll(conn)
+	assert.Success(t, "read tunnel", err)
+	assert.Equal(t, "tunneled data", "tunnel to example.com:443 as alice", string(b))
+}
+
+// serveNTLMProxy starts a fake proxy that requires a two-leg NTLM handshake on
+// a single connection before accepting a CONNECT request.
+func serveNTLMProxy(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Success(t, "listen", err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+
+		req, err := http.ReadRequest(br)
+		if err != nil || !strings.HasPrefix(req.Header.Get("Proxy-Authorization"), "NTLM ") {
+			_, _ = io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\n\r\n")
+			return
+		}
+		challenge := make([]byte, 48)
+		copy(challenge, ntlmSignature)
+		binary.LittleEndian.PutUint32(challenge[8:], 2)
+		binary.LittleEndian.PutUint32(challenge[20:], ntlmDefaultFlags)
+		copy(challenge[24:], "srvchall")
+		binary.LittleEndian.PutUint32(challenge[44:], 48)
+		_, _ = io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n"+
+			"Proxy-Authenticate: NTLM "+base64.StdEncoding.EncodeToString(challenge)+"\r\n"+
+			"Content-Length: 0\r\n\r\n")
+
+		req, err = http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(req.Header.Get("Proxy-Authorization"), "NTLM "))
+		if err != nil || len(raw) < 64 || binary.LittleEndian.Uint32(raw[8:]) != 3 {
+			_, _ = io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			return
+		}
+		// Extract the UTF-16 user name field.
+		userLen := binary.LittleEndian.Uint16(raw[36:])
+		userOff := binary.LittleEndian.Uint32(raw[40:])
+		var user strings.Builder
+		for i := uint32(0); i < uint32(userLen); i += 2 {
+			user.WriteByte(raw[userOff+i])
+		}
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+		_, _ = io.WriteString(conn, "tunnel to "+req.Host+" as "+user.String())
+	}()
+	return l.Addr().String()
+}
@@ -0,0 +1,441 @@
+package proxy
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertkrimen/otto"
+	"golang.org/x/xerrors"
+)
+
+// PAC scripts are JavaScript, run by otto, an ECMAScript 5 interpreter. The
+// helper functions of the PAC standard are implemented in Go: the DNS and
+// network helpers, with Microsoft's IPv6 variants ending in Ex, the date and
+// time helpers, and shExpMatch. alert is accepted and ignored.
+
+var (
+	// pacEvalTimeout bounds each evaluation of a script, so that a script
+	// that loops forever fails instead of hanging every request.
+	pacEvalTimeout = 5 * time.Second
+	// pacNow is the time the date and time helpers compare against.
+	pacNow = time.Now
+
+	errPACTimeout = xerrors.New("pac script timed out")
+)
+
+// pacMaxCallDepth bounds the recursion of a script.
+const pacMaxCallDepth = 256
+
+// pacScript is a parsed proxy auto-config script.
+type pacScript struct {
+	// mu serializes evaluations, since the interpreter isn't safe for
+	// concurrent use.
+	mu   sync.Mutex
+	vm   *otto.Otto
+	find otto.Value
+}
+
+// parsePAC runs the source of a PAC script, which must define
+// FindProxyForURL.
+func parsePAC(src string) (*pacScript, error) {
+	vm := otto.New()
+	vm.SetStackDepthLimit(pacMaxCallDepth)
+	for name, fn := range pacBuiltins {
+		if err := vm.Set(name, pacFunction(vm, fn)); err != nil {
+			return nil, xerrors.Errorf("define %s: %w", name, err)
+		}
+	}
+	script, err := vm.Compile("", src)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &pacScript{vm: vm}
+	_, err = s.eval(func() (otto.Value, error) { return vm.Run(script) })
+	if err != nil {
+		return nil, err
+	}
+	if s.find, err = vm.Get("FindProxyForURL"); err != nil {
+		return nil, err
+	}
+	if !s.find.IsFunction() {
+		return nil, xerrors.New("pac script doesn't define a FindProxyForURL function")
+	}
+	return s, nil
+}
+
+// findProxy evaluates FindProxyForURL for the given URL and host.
+func (s *pacScript) findProxy(rawURL, host string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.eval(func() (otto.Value, error) {
+		return s.find.Call(otto.NullValue(), rawURL, host)
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+// eval runs fn, interrupting it once it has run for pacEvalTimeout.
+func (s *pacScript) eval(fn func() (otto.Value, error)) (v otto.Value, err error) {
+	defer func() {
+		if caught := recover(); caught != nil {
+			if caught != errPACTimeout {
+				panic(caught)
+			}
+			err = errPACTimeout
+		}
+	}()
+	interrupt := make(chan func(), 1)
+	s.vm.Interrupt = interrupt
+	timer := time.AfterFunc(pacEvalTimeout, func() {
+		interrupt <- func() { panic(errPACTimeout) }
+	})
+	defer timer.Stop()
+	return fn()
+}
+
+// pacFunction adapts a helper to otto, which passes it the arguments as
+// strings and converts the result back.
+func pacFunction(vm *otto.Otto, fn func(args []string) interface{}) func(call otto.FunctionCall) otto.Value {
+	return func(call otto.FunctionCall) otto.Value {
+		args := make([]string, len(call.ArgumentList))
+		for i, arg := range call.ArgumentList {
+			args[i] = arg.String()
+		}
+		res := fn(args)
+		if res == nil {
+			return otto.NullValue()
+		}
+		v, err := vm.ToValue(res)
+		if err != nil {
+			return otto.UndefinedValue()
+		}
+		return v
+	}
+}
+
+var pacBuiltins = map[string]func(args []string) interface{}{
+	"isPlainHostName": func(args []string) interface{} {
+		return !strings.Contains(pacArg(args, 0), ".")
+	},
+	"dnsDomainIs": func(args []string) interface{} {
+		return strings.HasSuffix(strings.ToLower(pacArg(args, 0)), strings.ToLower(pacArg(args, 1)))
+	},
+	"localHostOrDomainIs": func(args []string) interface{} {
+		host, hostdom := strings.ToLower(pacArg(args, 0)), strings.ToLower(pacArg(args, 1))
+		return host == hostdom || !strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+".")
+	},
+	"isResolvable": func(args []string) interface{} {
+		return pacResolve(pacArg(args, 0)) != nil
+	},
+	"isResolvableEx": func(args []string) interface{} {
+		return len(pacResolveAll(pacArg(args, 0))) > 0
+	},
+	"dnsResolve": func(args []string) interface{} {
+		ip := pacResolve(pacArg(args, 0))
+		if ip == nil {
+			return nil
+		}
+		return ip.String()
+	},
+	"dnsResolveEx": func(args []string) interface{} {
+		return pacJoinIPs(pacResolveAll(pacArg(args, 0)))
+	},
+	"isInNet": func(args []string) interface{} {
+		ip := pacResolve(pacArg(args, 0))
+		pattern, mask := net.ParseIP(pacArg(args, 1)).To4(), net.ParseIP(pacArg(args, 2)).To4()
+		if ip == nil || pattern == nil || mask == nil {
+			return false
+		}
+		return ip.Mask(net.IPMask(mask)).Equal(pattern.Mask(net.IPMask(mask)))
+	},
+	"isInNetEx": func(args []string) interface{} {
+		_, network, err := net.ParseCIDR(pacArg(args, 1))
+		if err != nil {
+			return false
+		}
+		for _, ip := range pacResolveAll(pacArg(args, 0)) {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	},
+	"myIpAddress": func([]string) interface{} {
+		return pacLocalIP("udp4", "198.51.100.1:80", "127.0.0.1")
+	},
+	"myIpAddressEx": func([]string) interface{} {
+		return pacJoinIPs([]net.IP{
+			net.ParseIP(pacLocalIP("udp6", "[2001:db8::1]:80", "::1")),
+			net.ParseIP(pacLocalIP("udp4", "198.51.100.1:80", "127.0.0.1")),
+		})
+	},
+	"dnsDomainLevels": func(args []string) interface{} {
+		return float64(strings.Count(pacArg(args, 0), "."))
+	},
+	"shExpMatch": func(args []string) interface{} {
+		re := regexp.QuoteMeta(pacArg(args, 1))
+		re = strings.ReplaceAll(re, `\*`, ".*")
+		re = strings.ReplaceAll(re, `\?`, ".")
+		ok, _ := regexp.MatchString("^"+re+"$", pacArg(args, 0))
+		return ok
+	},
+	"weekdayRange": pacWeekdayRange,
+	"dateRange":    pacDateRange,
+	"timeRange":    pacTimeRange,
+	"alert": func([]string) interface{} {
+		return nil
+	},
+}
+
+func pacArg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
+
+// pacResolve returns the first IPv4 address of host, or nil.
+func pacResolve(host string) net.IP {
+	for _, ip := range pacResolveAll(host) {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4
+		}
+	}
+	return nil
+}
+
+// pacResolveAll returns the addresses of host, which may be an address
+// itself.
+func pacResolveAll(host string) []net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil
+	}
+	return ips
+}
+
+// pacJoinIPs returns the addresses separated by semicolons, as the Ex helpers
+// return them.
+func pacJoinIPs(ips []net.IP) string {
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if ip != nil {
+			addrs = append(addrs, ip.String())
+		}
+	}
+	return strings.Join(addrs, ";")
+}
+
+// pacLocalIP returns the address of the interface that reaches addr, or
+// fallback. Dialing UDP doesn't send any packets but selects the interface.
+func pacLocalIP(network, addr, fallback string) string {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return fallback
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+var (
+	pacWeekdays = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+	pacMonths   = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+)
+
+// pacClock returns the current time, in UTC when the last argument is "GMT",
+// and the other arguments.
+func pacClock(args []string) (time.Time, []string) {
+	now := pacNow()
+	if n := len(args); n > 0 && strings.EqualFold(args[n-1], "GMT") {
+		return now.UTC(), args[:n-1]
+	}
+	return now.Local(), args
+}
+
+// pacInRange reports whether v is within [first, last], which wraps around
+// when first is greater than last, such as for FRI to MON.
+func pacInRange(v, first, last int) bool {
+	if first <= last {
+		return first <= v && v <= last
+	}
+	return v >= first || v <= last
+}
+
+func pacIndex(names []string, name string) int {
+	for i, n := range names {
+		if strings.EqualFold(n, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// pacWeekdayRange is weekdayRange(wd1[, wd2][, "GMT"]).
+func pacWeekdayRange(args []string) interface{} {
+	now, args := pacClock(args)
+	if len(args) < 1 || len(args) > 2 {
+		return false
+	}
+	first := pacIndex(pacWeekdays, args[0])
+	last := first
+	if len(args) == 2 {
+		last = pacIndex(pacWeekdays, args[1])
+	}
+	if first < 0 || last < 0 {
+		return false
+	}
+	return pacInRange(int(now.Weekday()), first, last)
+}
+
+// pacTimeRange is timeRange(hour1[, min1[, sec1]], hour2[, min2[, sec2]][, "GMT"]),
+// or timeRange(hour[, "GMT"]) for a single hour. Ranges include their end, so
+// timeRange(9, 17) lasts until 17:59:59.
+func pacTimeRange(args []string) interface{} {
+	now, args := pacClock(args)
+	n := make([]int, len(args))
+	for i, arg := range args {
+		v, err := strconv.Atoi(arg)
+		if err != nil {
+			return false
+		}
+		n[i] = v
+	}
+	secs := now.Hour()*3600 + now.Minute()*60 + now.Second()
+	switch len(n) {
+	case 1:
+		return now.Hour() == n[0]
+	case 2:
+		return pacInRange(now.Hour(), n[0], n[1])
+	case 4:
+		return pacInRange(secs, n[0]*3600+n[1]*60, n[2]*3600+n[3]*60+59)
+	case 6:
+		return pacInRange(secs, n[0]*3600+n[1]*60+n[2], n[3]*3600+n[4]*60+n[5])
+	}
+	return false
+}
+
+// pacDateRange is dateRange with a day, month or year, or a range of them:
+// days of the month, months, years, day and month, month and year, or all
+// three, optionally followed by "GMT". Ranges without a year wrap around,
+// such as DEC to FEB.
+func pacDateRange(args []string) interface{} {
+	now, args := pacClock(args)
+	if len(args) == 0 || len(args) > 6 || len(args) != 1 && len(args)%2 != 0 {
+		return false
+	}
+	if len(args) == 1 {
+		args = []string{args[0], args[0]}
+	}
+	half := len(args) / 2
+	first, firstKinds, ok := pacDateKey(args[:half])
+	if !ok {
+		return false
+	}
+	last, lastKinds, ok := pacDateKey(args[half:])
+	if !ok || firstKinds != lastKinds {
+		return false
+	}
+	current := pacDateOrder(now.Day(), int(now.Month()), now.Year(), firstKinds)
+	if firstKinds&pacYear != 0 {
+		return first <= current && current <= last
+	}
+	return pacInRange(current, first, last)
+}
+
+// The parts of a date given to dateRange.
+const (
+	pacDay = 1 << iota
+	pacMonth
+	pacYear
+)
+
+// pacDateKey parses the day, month and year given in args, each at most
+// once, and returns them ordered as a number, and the parts given.
+func pacDateKey(args []string) (key, parts int, ok bool) {
+	var day, month, year int
+	for _, arg := range args {
+		v, err := strconv.Atoi(arg)
+		part := pacYear
+		switch {
+		case err != nil:
+			part, v = pacMonth, pacIndex(pacMonths, arg)+1
+			if v == 0 {
+				return 0, 0, false
+			}
+			month = v
+		case v < 32:
+			part, day = pacDay, v
+		default:
+			year = v
+		}
+		if parts&part != 0 {
+			return 0, 0, false
+		}
+		parts |= part
+	}
+	return pacDateOrder(day, month, year, parts), parts, true
+}
+
+// pacDateOrder orders dates by the given parts of them.
+func pacDateOrder(day, month, year, parts int) int {
+	var key int
+	if parts&pacYear != 0 {
+		key = year * 10000
+	}
+	if parts&pacMonth != 0 {
+		key += month * 100
+	}
+	if parts&pacDay != 0 {
+		key += day
+	}
+	return key
+}
+
+// parsePACResult parses a FindProxyForURL result such as
+// "PROXY a:8080; SOCKS b:1080; DIRECT" into proxy URLs.
+// A nil entry means the connection should be made directly.
+func parsePACResult(res string) ([]*url.URL, error) {
+	var proxies []*url.URL
+	for _, entry := range strings.Split(res, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		kind := strings.ToUpper(fields[0])
+		if kind == "DIRECT" {
+			proxies = append(proxies, nil)
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, xerrors.Errorf("invalid pac result entry %q", entry)
+		}
+		var scheme string
+		switch kind {
+		case "PROXY", "HTTP":
+			scheme = "http"
+		case "HTTPS":
+			scheme = "https"
+		case "SOCKS", "SOCKS5":
+			scheme = "socks5"
+		default:
+			return nil, xerrors.Errorf("unsupported pac result type %q", fields[0])
+		}
+		proxies = append(proxies, &url.URL{Scheme: scheme, Host: fields[1]})
+	}
+	if len(proxies) == 0 {
+		// An empty result is treated as DIRECT.
+		proxies = append(proxies, nil)
+	}
+	return proxies, nil
+}
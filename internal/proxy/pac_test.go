@@ -0,0 +1,199 @@
+package proxy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+const testPAC = `
+// Route internal traffic directly.
+var internalSuffix = ".corp.example.com";
+
+function isInternal(host) {
+	return dnsDomainIs(host, internalSuffix) || host == "intranet";
+}
+
+function FindProxyForURL(url, host) {
+	host = host.toLowerCase();
+	if (isPlainHostName(host) && !isInternal(host)) {
+		return "DIRECT";
+	}
+	if (isInternal(host)) return "DIRECT";
+	/* Plain HTTP goes through the legacy proxy. */
+	if (url.substring(0, 5) == "http:") {
+		return "PROXY legacy.example.com:3128";
+	}
+	if (shExpMatch(host, "*.socks.example.com")) {
+		return "SOCKS socks.example.com:1080";
+	}
+	if (host.indexOf("fallback") != -1) {
+		return "PROXY a.example.com:8080; PROXY b.example.com:8080; DIRECT";
+	}
+	return isInNet(host, "10.0.0.0", "255.0.0.0") ? "DIRECT" : "PROXY proxy.example.com:8080";
+}
+`
+
+func TestPAC(t *testing.T) {
+	script, err := parsePAC(testPAC)
+	assert.Success(t, "parse pac", err)
+
+	cases := []struct {
+		url  string
+		host string
+		want string
+	}{
+		{"https://localhost/", "localhost", "DIRECT"},
+		{"https://git.corp.example.com/", "GIT.corp.example.com", "DIRECT"},
+		{"http://example.com/", "example.com", "PROXY legacy.example.com:3128"},
+		{"https://a.socks.example.com/", "a.socks.example.com", "SOCKS socks.example.com:1080"},
+		{"https://fallback.example.com/", "fallback.example.com", "PROXY a.example.com:8080; PROXY b.example.com:8080; DIRECT"},
+		{"https://10.1.2.3/", "10.1.2.3", "DIRECT"},
+		{"https://192.0.2.1/", "192.0.2.1", "PROXY proxy.example.com:8080"},
+	}
+	for _, c := range cases {
+		got, err := script.findProxy(c.url, c.host)
+		assert.Success(t, fmt.Sprintf("find proxy for %q", c.url), err)
+		assert.Equal(t, fmt.Sprintf("proxy for %q", c.url), c.want, got)
+	}
+}
+
+func TestPACErrors(t *testing.T) {
+	_, err := parsePAC(`function other() { return "DIRECT"; }`)
+	assert.ErrorContains(t, "missing FindProxyForURL", err, "FindProxyForURL")
+
+	_, err = parsePAC(`function FindProxyForURL(url, host) { return "DIRECT"`)
+	assert.Error(t, "unterminated function", err)
+
+	script, err := parsePAC(`function FindProxyForURL(url, host) { return unknownFn(host); }`)
+	assert.Success(t, "parse pac", err)
+	_, err = script.findProxy("https://example.com", "example.com")
+	assert.ErrorContains(t, "unknown function", err, "unknownFn")
+}
+
+func TestPACLanguage(t *testing.T) {
+	script, err := parsePAC(`var proxies = ["a.example.com", "b.example.com", "c.example.com"];
+
+function FindProxyForURL(url, host) {
+	switch (host) {
+	case "direct.example.com":
+		return "DIRECT";
+	}
+	var sum = 0;
+	for (var i = 0; i < host.length; i++) {
+		sum += host.charCodeAt(i);
+	}
+	var picked = proxies[sum % proxies.length];
+	return "PROXY " + picked + ":" + (8080 * 2 / 2);
+}`)
+	assert.Success(t, "parse pac", err)
+
+	got, err := script.findProxy("https://direct.example.com/", "direct.example.com")
+	assert.Success(t, "find proxy", err)
+	assert.Equal(t, "switch", "DIRECT", got)
+	got, err = script.findProxy("https://example.com/", "example.com")
+	assert.Success(t, "find proxy", err)
+	assert.Equal(t, "hashed", "PROXY a.example.com:8080", got)
+}
+
+func TestPACDateTime(t *testing.T) {
+	now := pacNow
+	// A Wednesday.
+	pacNow = func() time.Time { return time.Date(2021, time.June, 16, 14, 30, 0, 0, time.UTC) }
+	t.Cleanup(func() { pacNow = now })
+
+	script, err := parsePAC(`function FindProxyForURL(url, host) { return String(eval(host)); }`)
+	assert.Success(t, "parse pac", err)
+	cases := map[string]bool{
+		`weekdayRange("MON", "FRI", "GMT")`:                 true,
+		`weekdayRange("WED", "GMT")`:                        true,
+		`weekdayRange("SAT", "TUE", "GMT")`:                 false,
+		`weekdayRange("FRI", "THU", "GMT")`:                 true,
+		`timeRange(9, 17, "GMT")`:                           true,
+		`timeRange(14, "GMT")`:                              true,
+		`timeRange(22, 6, "GMT")`:                           false,
+		`timeRange(14, 0, 14, 30, "GMT")`:                   true,
+		`timeRange(14, 0, 14, 29, "GMT")`:                   false,
+		`timeRange(14, 31, 0, 15, 0, 0, "GMT")`:             false,
+		`dateRange("JUN", "GMT")`:                           true,
+		`dateRange(1, 15, "GMT")`:                           false,
+		`dateRange("DEC", "JUL", "GMT")`:                    true,
+		`dateRange(1, "JUN", 30, "JUN", "GMT")`:             true,
+		`dateRange("JUN", 2020, "MAY", 2021, "GMT")`:        false,
+		`dateRange(2021, "GMT")`:                            true,
+		`dateRange(1, "JAN", 2021, 16, "JUN", 2021, "GMT")`: true,
+		`dateRange("JUNE", "GMT")`:                          false,
+	}
+	for expr, want := range cases {
+		got, err := script.findProxy("", expr)
+		assert.Success(t, expr, err)
+		assert.Equal(t, expr, fmt.Sprint(want), got)
+	}
+}
+
+func TestPACIPv6(t *testing.T) {
+	script, err := parsePAC(`function FindProxyForURL(url, host) {
+	if (isInNetEx(host, "2001:db8::/32")) return "PROXY v6.example.com:8080";
+	if (isInNetEx(host, "10.0.0.0/8")) return "PROXY v4.example.com:8080";
+	return "PROXY " + dnsResolveEx(host) + ":8080";
+}`)
+	assert.Success(t, "parse pac", err)
+
+	cases := []struct {
+		host string
+		want string
+	}{
+		{"2001:db8::1", "PROXY v6.example.com:8080"},
+		{"10.1.2.3", "PROXY v4.example.com:8080"},
+		{"2001:db9::1", "PROXY 2001:db9::1:8080"},
+	}
+	for _, c := range cases {
+		got, err := script.findProxy("https://["+c.host+"]/", c.host)
+		assert.Success(t, fmt.Sprintf("find proxy for %q", c.host), err)
+		assert.Equal(t, fmt.Sprintf("proxy for %q", c.host), c.want, got)
+	}
+}
+
+func TestPACLimits(t *testing.T) {
+	timeout := pacEvalTimeout
+	pacEvalTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { pacEvalTimeout = timeout })
+
+	script, err := parsePAC(`function FindProxyForURL(url, host) { while (true) {} }`)
+	assert.Success(t, "parse pac", err)
+	_, err = script.findProxy("https://example.com", "example.com")
+	assert.True(t, "interrupted", xerrors.Is(err, errPACTimeout))
+	// The script still works after being interrupted.
+	_, err = script.findProxy("https://example.com", "example.com")
+	assert.True(t, "interrupted again", xerrors.Is(err, errPACTimeout))
+
+	_, err = parsePAC(`while (true) {}`)
+	assert.True(t, "global code interrupted", xerrors.Is(err, errPACTimeout))
+
+	script, err = parsePAC(`function f(n) { return f(n + 1); }
+function FindProxyForURL(url, host) { return f(0); }`)
+	assert.Success(t, "parse pac", err)
+	_, err = script.findProxy("https://example.com", "example.com")
+	assert.Error(t, "unbounded recursion", err)
+}
+
+func TestParsePACResult(t *testing.T) {
+	proxies, err := parsePACResult("PROXY a:1; HTTPS b:2; SOCKS5 c:3; DIRECT")
+	assert.Success(t, "parse result", err)
+	assert.Equal(t, "proxy count", 4, len(proxies))
+	assert.Equal(t, "http proxy", "http://a:1", proxies[0].String())
+	assert.Equal(t, "https proxy", "https://b:2", proxies[1].String())
+	assert.Equal(t, "socks proxy", "socks5://c:3", proxies[2].String())
+	assert.True(t, "direct", proxies[3] == nil)
+
+	proxies, err = parsePACResult("")
+	assert.Success(t, "parse empty result", err)
+	assert.True(t, "empty result is direct", len(proxies) == 1 && proxies[0] == nil)
+
+	_, err = parsePACResult("FTP a:1")
+	assert.Error(t, "unsupported type", err)
+}
@@ -0,0 +1,282 @@
+package proxy
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/xerrors"
+)
+
+// AuthScheme is the authentication scheme used with a proxy.
+type AuthScheme string
+
+// Supported proxy authentication schemes.
+const (
+	// AuthBasic sends credentials from the proxy URL as Basic auth.
+	// It is the default.
+	AuthBasic AuthScheme = "basic"
+	// AuthNTLM performs an NTLMv2 handshake on the CONNECT request.
+	AuthNTLM AuthScheme = "ntlm"
+	// AuthNegotiate performs the NTLM handshake using the Negotiate scheme.
+	// Kerberos tickets are not supported.
+	AuthNegotiate AuthScheme = "negotiate"
+)
+
+// ParseAuthScheme parses a case-insensitive authentication scheme name.
+func ParseAuthScheme(s string) (AuthScheme, error) {
+	switch scheme := AuthScheme(strings.ToLower(strings.TrimSpace(s))); scheme {
+	case "":
+		return AuthBasic, nil
+	case AuthBasic, AuthNTLM, AuthNegotiate:
+		return scheme, nil
+	default:
+		return "", xerrors.Errorf("unsupported proxy auth scheme %q: must be one of basic, ntlm, negotiate", s)
+	}
+}
+
+// Options configures how outbound connections are proxied.
+type Options struct {
+	// PAC is the URL or file path of a proxy auto-config script.
+	// When set, it takes precedence over the proxy environment variables.
+	PAC string
+
+	// Auth is the authentication scheme used with the selected proxy.
+	Auth AuthScheme
+
+	// User holds the proxy credentials used when the selected proxy URL
+	// doesn't contain any. NTLM usernames may be given as DOMAIN\user.
+	User *url.Userinfo
+
+	// Warn is called with the error of the PAC script the first time it
+	// fails, after which connections are made directly.
+	Warn func(err error)
+}
+
+// proxyRetryAfter is how long a proxy that couldn't be reached is skipped
+// when a PAC script offers others.
+const proxyRetryAfter = time.Minute
+
+// proxyProbeTimeout bounds the check that a proxy can be reached.
+const proxyProbeTimeout = 5 * time.Second
+
+// selectFunc returns the proxies to try, in order, for a request to u.
+// A nil entry means the request should be made directly.
+type selectFunc func(u *url.URL) ([]*url.URL, error)
+
+// NewTransport returns an http.Transport that routes connections according to opts.
+// Without a PAC script, proxies are read from the standard HTTP_PROXY, HTTPS_PROXY
+// and NO_PROXY environment variables.
+func NewTransport(ctx context.Context, opts Options) (*http.Transport, error) {
+	if opts.Auth == "" {
+		opts.Auth = AuthBasic
+	}
+	sel, err := newSelector(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	switch opts.Auth {
+	case AuthBasic:
+		// http.Transport takes a single proxy, so the first one that can
+		// be reached is picked from those the PAC script offers.
+		f := &proxyFailover{dialer: &net.Dialer{Timeout: proxyProbeTimeout}, down: make(map[string]time.Time)}
+		transport.Proxy = func(r *http.Request) (*url.URL, error) {
+			proxies, err := sel(r.URL)
+			if err != nil || len(proxies) == 0 {
+				return nil, err
+			}
+			return f.pick(r.Context(), proxies), nil
+		}
+	case AuthNTLM, AuthNegotiate:
+		// The NTLM handshake has to happen on a single connection, which
+		// http.Transport doesn't support. Tunnel every connection through
+		// CONNECT ourselves instead.
+		d := &connectDialer{
+			selectProxies: sel,
+			auth:          opts.Auth,
+			dialer: &net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			},
+		}
+		transport.Proxy = nil
+		transport.DialContext = d.DialContext
+	default:
+		return nil, xerrors.Errorf("unsupported proxy auth scheme %q", opts.Auth)
+	}
+	return transport, nil
+}
+
+// NewHTTPClient returns an http.Client using a transport created by NewTransport.
+func NewHTTPClient(ctx context.Context, opts Options) (*http.Client, error) {
+	transport, err := NewTransport(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// proxyFailover picks the first proxy of a list that can be reached, like
+// browsers do with the entries of a PAC result.
+type proxyFailover struct {
+	dialer *net.Dialer
+
+	mu sync.Mutex
+	// down holds when the proxies that couldn't be reached were last tried.
+	down map[string]time.Time
+}
+
+// pick returns the first of proxies that can be reached, or the last one,
+// which is tried anyway. A nil proxy means a direct connection.
+func (f *proxyFailover) pick(ctx context.Context, proxies []*url.URL) *url.URL {
+	for _, p := range proxies[:len(proxies)-1] {
+		if p == nil || f.reachable(ctx, p) {
+			return p
+		}
+	}
+	return proxies[len(proxies)-1]
+}
+
+func (f *proxyFailover) reachable(ctx context.Context, p *url.URL) bool {
+	f.mu.Lock()
+	downAt, down := f.down[p.Host]
+	f.mu.Unlock()
+	if down && time.Since(downAt) < proxyRetryAfter {
+		return false
+	}
+
+	conn, err := f.dialer.DialContext(ctx, "tcp", p.Host)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		f.down[p.Host] = time.Now()
+		return false
+	}
+	_ = conn.Close()
+	delete(f.down, p.Host)
+	return true
+}
+
+func newSelector(ctx context.Context, opts Options) (selectFunc, error) {
+	withUser := func(proxies []*url.URL) []*url.URL {
+		if opts.User == nil {
+			return proxies
+		}
+		with := make([]*url.URL, len(proxies))
+		for i, p := range proxies {
+			if p != nil && p.User == nil {
+				// The ProxyFunc of httpproxy returns the same URL on every
+				// call, so it's copied rather than modified.
+				copied := *p
+				copied.User = opts.User
+				p = &copied
+			}
+			with[i] = p
+		}
+		return with
+	}
+
+	if opts.PAC == "" {
+		fromEnv := httpproxy.FromEnvironment().ProxyFunc()
+		return func(u *url.URL) ([]*url.URL, error) {
+			p, err := fromEnv(u)
+			if err != nil {
+				return nil, err
+			}
+			return withUser([]*url.URL{p}), nil
+		}, nil
+	}
+
+	script, err := openPAC(ctx, opts.PAC)
+	if err != nil {
+		return nil, err
+	}
+	// Like browsers, a script that fails, such as by calling a function only
+	// some browsers define, falls back to a direct connection rather than
+	// failing every request. The failure is reported once through Warn.
+	var warnOnce sync.Once
+	direct := func(err error) ([]*url.URL, error) {
+		warnOnce.Do(func() {
+			if opts.Warn != nil {
+				opts.Warn(xerrors.Errorf("pac script %q: %w", opts.PAC, err))
+			}
+		})
+		return []*url.URL{nil}, nil
+	}
+	return func(u *url.URL) ([]*url.URL, error) {
+		res, err := script.findProxy(u.String(), u.Hostname())
+		if err != nil {
+			return direct(xerrors.Errorf("evaluate: %w", err))
+		}
+		proxies, err := parsePACResult(res)
+		if err != nil {
+			return direct(err)
+		}
+		return withUser(proxies), nil
+	}, nil
+}
+
+// CheckPAC loads the PAC script at location and checks that it defines
+// FindProxyForURL.
+func CheckPAC(ctx context.Context, location string) error {
+	_, err := openPAC(ctx, location)
+	return err
+}
+
+func openPAC(ctx context.Context, location string) (*pacScript, error) {
+	src, err := loadPAC(ctx, location)
+	if err != nil {
+		return nil, xerrors.Errorf("load pac script %q: %w", location, err)
+	}
+	script, err := parsePAC(src)
+	if err != nil {
+		return nil, xerrors.Errorf("parse pac script %q: %w", location, err)
+	}
+	return script, nil
+}
+
+// loadPAC reads a PAC script from an http(s) URL, a file:// URL or a file path.
+func loadPAC(ctx context.Context, location string) (string, error) {
+	u, err := url.Parse(location)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		path := location
+		if err == nil && u.Scheme == "file" {
+			path = u.Path
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	// The PAC script itself is always fetched directly.
+	client := &http.Client{Transport: &http.Transport{Proxy: nil}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", xerrors.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
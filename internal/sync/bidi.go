@@ -0,0 +1,765 @@
+package sync
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rjeczalik/notify"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"cdr.dev/wsep"
+
+	"cdr.dev/coder-cli/internal/activity"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// A bidirectional sync keeps the SHA-256 of every file as of when both ends
+// last agreed on it. A file that changed on one end since is copied to the
+// other, and a file that changed on both ends is a conflict, settled by the
+// ConflictPolicy. Local changes are picked up as they happen, and the remote
+// is polled.
+
+// ConflictPolicy decides which copy of a file changed on both ends wins.
+type ConflictPolicy string
+
+// Conflict policies.
+const (
+	PreferLocal  ConflictPolicy = "prefer-local"
+	PreferRemote ConflictPolicy = "prefer-remote"
+	// Prompt asks which copy to keep, and leaves the conflict alone if
+	// there's nobody to ask.
+	Prompt ConflictPolicy = "prompt"
+)
+
+// DefaultPollInterval is how often a bidirectional sync checks the remote
+// for changes by default.
+const DefaultPollInterval = 2 * time.Second
+
+// bidiTempPrefix starts the names of the files pulled files are written to
+// before they replace the local ones.
+const bidiTempPrefix = ".coder-sync-"
+
+// bidiStateVersion is bumped whenever the format of the state changes, which
+// discards the states written by older versions.
+const bidiStateVersion = 1
+
+type bidiStateFile struct {
+	Version int               `json:"version"`
+	Files   map[string]string `json:"files"`
+}
+
+// remoteFile is a remote file as last polled.
+type remoteFile struct {
+	// stat is the size and modification time of the file, or empty if its
+	// hash must be computed again on the next poll.
+	stat   string
+	sha256 string
+}
+
+// bidiPlan is what a cycle of the bidirectional sync does.
+type bidiPlan struct {
+	push         []string
+	pull         []string
+	removeRemote []string
+	removeLocal  []string
+	conflicts    []Discrepancy
+	// agreed is set when files became the same on both ends.
+	agreed bool
+}
+
+func (p bidiPlan) empty() bool {
+	return len(p.push)+len(p.pull)+len(p.removeRemote)+len(p.removeLocal)+len(p.conflicts) == 0
+}
+
+// reconcile compares both ends with the hashes they last agreed on. Files
+// that are the same on both ends are agreed on in base. Files whose remote
+// state is unknown are left alone.
+func reconcile(base, local, remote map[string]string, unknown map[string]bool) bidiPlan {
+	paths := make(map[string]struct{}, len(base)+len(local)+len(remote))
+	for _, m := range []map[string]string{base, local, remote} {
+		for p := range m {
+			paths[p] = struct{}{}
+		}
+	}
+	var plan bidiPlan
+	for p := range paths {
+		if unknown[p] {
+			continue
+		}
+		l, r, b := local[p], remote[p], base[p]
+		switch {
+		case l == r:
+			if l != b {
+				plan.agreed = true
+			}
+			if l == "" {
+				delete(base, p)
+			} else {
+				base[p] = l
+			}
+		case r == b && l == "":
+			plan.removeRemote = append(plan.removeRemote, p)
+		case r == b:
+			plan.push = append(plan.push, p)
+		case l == b && r == "":
+			plan.removeLocal = append(plan.removeLocal, p)
+		case l == b:
+			plan.pull = append(plan.pull, p)
+		default:
+			plan.conflicts = append(plan.conflicts, Discrepancy{Path: p, Local: l, Remote: r})
+		}
+	}
+	for _, list := range [][]string{plan.push, plan.pull, plan.removeRemote, plan.removeLocal} {
+		sort.Strings(list)
+	}
+	sort.Slice(plan.conflicts, func(i, j int) bool { return plan.conflicts[i].Path < plan.conflicts[j].Path })
+	return plan
+}
+
+// dropRemoteChanged drops the files to push or remove on the remote whose
+// SHA-256 in current is no longer the one in remote they were planned with,
+// a missing one meaning that the file doesn't exist, and returns them. The
+// next cycle finds them changed on both ends.
+func (p *bidiPlan) dropRemoteChanged(remote, current map[string]string) []string {
+	var changed []string
+	keep := func(paths []string) []string {
+		kept := paths[:0]
+		for _, rel := range paths {
+			if current[rel] != remote[rel] {
+				changed = append(changed, rel)
+				continue
+			}
+			kept = append(kept, rel)
+		}
+		return kept
+	}
+	p.push = keep(p.push)
+	p.removeRemote = keep(p.removeRemote)
+	return changed
+}
+
+// keepLocal settles the conflict in favor of the local copy.
+func (p *bidiPlan) keepLocal(d Discrepancy) {
+	if d.Local == "" {
+		p.removeRemote = append(p.removeRemote, d.Path)
+		return
+	}
+	p.push = append(p.push, d.Path)
+}
+
+// keepRemote settles the conflict in favor of the remote copy.
+func (p *bidiPlan) keepRemote(d Discrepancy) {
+	if d.Remote == "" {
+		p.removeLocal = append(p.removeLocal, d.Path)
+		return
+	}
+	p.pull = append(p.pull, d.Path)
+}
+
+type bidiSync struct {
+	Sync
+	// base holds the hashes both ends last agreed on.
+	base   map[string]string
+	remote map[string]remoteFile
+	// skipped holds the conflicts left alone, so they aren't asked about
+	// again until either copy changes.
+	skipped map[string]Discrepancy
+	input   *bufio.Reader
+}
+
+// RunBidirectional propagates changes both ways between LocalDir and
+// RemoteDir, until it fails. With Init, it returns after the first round.
+func (s Sync) RunBidirectional() error {
+	events := make(chan notify.EventInfo, maxInflightInotify)
+	if err := notify.Watch(path.Join(s.LocalDir, "..."), events, notify.All); err != nil {
+		return xerrors.Errorf("create watch: %w", err)
+	}
+	defer notify.Stop(events)
+
+	ctx := context.Background()
+	mkdirCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := s.remoteCmd(mkdirCtx, "mkdir", "-p", s.RemoteDir); err != nil {
+		return xerrors.Errorf("create remote directory: %w", err)
+	}
+
+	b := &bidiSync{
+		Sync:    s,
+		remote:  make(map[string]remoteFile),
+		skipped: make(map[string]Discrepancy),
+	}
+	if s.InputReader != nil {
+		b.input = bufio.NewReader(s.InputReader)
+	}
+	var err error
+	if b.base, err = loadBidiState(s.StatePath); err != nil {
+		return err
+	}
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ap := activity.NewPusher(s.Client, s.Workspace.ID, activityName)
+
+	clog.LogInfo(i18n.Sprintf("syncing %s and %s both ways", s.LocalDir, s.RemoteDir))
+	if err := b.cycle(ctx); err != nil {
+		return err
+	}
+	if s.Init {
+		return nil
+	}
+	clog.LogInfo(i18n.Sprintf("watching %s and polling %s every %s for changes", s.LocalDir, s.RemoteDir, interval))
+
+	poll := time.NewTicker(interval)
+	defer poll.Stop()
+	for {
+		setConsoleTitle("🛰 watching both ends", s.IsInteractiveOutput)
+		select {
+		case ev := <-events:
+			if b.ignoredEvent(ev.Path()) {
+				continue
+			}
+			// Let the burst of events of a single change settle.
+			time.Sleep(maxAcceptableDispatch)
+			drainEvents(events)
+		case <-poll.C:
+		}
+		if err := b.cycle(ctx); err != nil {
+			return err
+		}
+		ap.Push(ctx)
+	}
+}
+
+func drainEvents(events <-chan notify.EventInfo) {
+	for {
+		select {
+		case <-events:
+		default:
+			return
+		}
+	}
+}
+
+// ignoredEvent reports whether the local path changing doesn't call for a
+// cycle.
+func (b *bidiSync) ignoredEvent(localPath string) bool {
+	return strings.HasPrefix(filepath.Base(localPath), bidiTempPrefix) || b.excluded(localPath)
+}
+
+// cycle brings both ends in agreement once.
+func (b *bidiSync) cycle(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+
+	local, err := localHashes(b.LocalDir, ".", b.HashCache, b.Excludes)
+	if err != nil {
+		return xerrors.Errorf("hash local files: %w", err)
+	}
+	if err := b.HashCache.flush(); err != nil {
+		// The cache only saves time, so the sync goes on without it.
+		b.Log.Warn(ctx, "save hash cache", slog.Error(err))
+	}
+	for p := range local {
+		if strings.HasPrefix(path.Base(p), bidiTempPrefix) {
+			delete(local, p)
+		}
+	}
+	remote, unknown, err := b.pollRemote(ctx)
+	if err != nil {
+		return err
+	}
+	if err := b.checkEmptyRemote(remote, unknown); err != nil {
+		return err
+	}
+
+	plan := reconcile(b.base, local, remote, unknown)
+	if plan.empty() {
+		if plan.agreed {
+			b.saveState(ctx)
+		}
+		return nil
+	}
+	b.settle(&plan)
+	b.Log.Debug(ctx, "bidirectional cycle",
+		slog.F("push", plan.push),
+		slog.F("pull", plan.pull),
+		slog.F("remove_remote", plan.removeRemote),
+		slog.F("remove_local", plan.removeLocal),
+	)
+
+	// The remote files changed since they were hashed are left alone too,
+	// rather than overwritten or deleted.
+	if checked := append(append([]string{}, plan.push...), plan.removeRemote...); len(checked) > 0 {
+		current, err := b.hashRemote(ctx, checked)
+		if err != nil {
+			return err
+		}
+		if changed := plan.dropRemoteChanged(remote, current); len(changed) > 0 {
+			for _, p := range changed {
+				// Hashed again on the next poll, even if its size and
+				// modification time look the same.
+				delete(b.remote, p)
+			}
+			b.Log.Debug(ctx, "remote files changed during the cycle", slog.F("paths", changed))
+		}
+	}
+	if len(plan.push) > 0 {
+		err := b.remoteExec(ctx, func(w io.Writer) error {
+			return writeNativeTar(w, b.LocalDir, nativeTransfer{changed: plan.push})
+		}, nil, "sh", "-c", remoteUntarScript, "sh", b.RemoteDir)
+		if err != nil {
+			return xerrors.Errorf("push files: %w", err)
+		}
+		for _, p := range plan.push {
+			b.base[p] = local[p]
+		}
+	}
+	if len(plan.removeRemote) > 0 {
+		err := b.remoteExec(ctx, func(w io.Writer) error {
+			_, err := io.WriteString(w, strings.Join(plan.removeRemote, "\x00")+"\x00")
+			return err
+		}, nil, "sh", "-c", remoteRemoveScript, "sh", b.RemoteDir)
+		if err != nil {
+			return xerrors.Errorf("remove remote files: %w", err)
+		}
+		for _, p := range plan.removeRemote {
+			delete(b.base, p)
+		}
+	}
+	// The local files changed since they were hashed are left alone: the
+	// next cycle finds them changed on both ends, and settles the conflict.
+	var changed []string
+	pulled := make(map[string]string, len(plan.pull))
+	if len(plan.pull) > 0 {
+		var err error
+		if pulled, err = b.pull(ctx, plan.pull, local); err != nil {
+			return xerrors.Errorf("pull files: %w", err)
+		}
+		for _, p := range plan.pull {
+			sum, ok := pulled[p]
+			if !ok {
+				changed = append(changed, p)
+				continue
+			}
+			b.base[p] = sum
+		}
+	}
+	var removedLocal int
+	for _, p := range plan.removeLocal {
+		unchanged, err := localUnchanged(b.LocalDir, p, local[p])
+		if err != nil {
+			return xerrors.Errorf("hash local file: %w", err)
+		}
+		if !unchanged {
+			changed = append(changed, p)
+			continue
+		}
+		err = os.Remove(filepath.Join(b.LocalDir, filepath.FromSlash(p)))
+		if err != nil && !os.IsNotExist(err) {
+			return xerrors.Errorf("remove local file: %w", err)
+		}
+		delete(b.base, p)
+		removedLocal++
+	}
+	if len(changed) > 0 {
+		b.Log.Debug(ctx, "local files changed during the cycle", slog.F("paths", changed))
+	}
+
+	b.saveState(ctx)
+	if n := len(plan.push) + len(pulled) + len(plan.removeRemote) + removedLocal; n > 0 {
+		clog.LogSuccess(i18n.Sprintf("pushed %d, pulled %d, removed %d remote and %d local files",
+			len(plan.push), len(pulled), len(plan.removeRemote), removedLocal))
+	}
+	return nil
+}
+
+// localUnchanged reports whether the local file still has the SHA-256 the
+// cycle was planned with, an empty one meaning that it didn't exist.
+func localUnchanged(root, rel, sum string) (bool, error) {
+	current, err := hashFile(filepath.Join(root, filepath.FromSlash(rel)))
+	if os.IsNotExist(err) {
+		return sum == "", nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return current == sum, nil
+}
+
+func (b *bidiSync) saveState(ctx context.Context) {
+	if err := saveBidiState(b.StatePath, b.base); err != nil {
+		// Without the state, the next session merges both ends again.
+		b.Log.Warn(ctx, "save sync state", slog.Error(err))
+	}
+}
+
+// checkEmptyRemote refuses to go on when the remote has none of the files
+// both ends agreed on, such as after a rebuild wiped RemoteDir, since every
+// local copy would be deleted. Unless AllowEmptyRemote is set, the user is
+// asked whether to push the local files again or delete them.
+func (b *bidiSync) checkEmptyRemote(remote map[string]string, unknown map[string]bool) error {
+	if len(remote) > 0 || len(unknown) > 0 || len(b.base) == 0 || b.AllowEmptyRemote {
+		return nil
+	}
+	switch b.askEmptyRemote() {
+	case "p":
+		b.base = make(map[string]string)
+		return nil
+	case "d":
+		return nil
+	}
+	push := "restart the sync to push them again"
+	if b.StatePath != "" {
+		push = fmt.Sprintf("remove %s to push them again", b.StatePath)
+	}
+	return clog.Error(i18n.Sprintf("%s is empty, but %d files were synced before", b.RemoteDir, len(b.base)),
+		"the local copies would be deleted, as if they had been deleted on the remote",
+		clog.BlankLine,
+		clog.Tipf("run with --allow-empty-remote to delete them, or %s", push),
+	)
+}
+
+// askEmptyRemote asks what to do about the empty remote, and returns "p" to
+// push the local files again, "d" to delete them, or "a" to abort.
+func (b *bidiSync) askEmptyRemote() string {
+	if b.input == nil {
+		return "a"
+	}
+	for {
+		fmt.Fprintf(b.ErrW, "%s is empty, but %d files were synced before. [p]ush the local files again, [d]elete the local copies, or [a]bort? ", b.RemoteDir, len(b.base))
+		answer, err := b.input.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "p", "push":
+			return "p"
+		case "d", "delete":
+			return "d"
+		case "a", "abort":
+			return "a"
+		}
+		if err != nil {
+			fmt.Fprintln(b.ErrW)
+			return "a"
+		}
+	}
+}
+
+// settle resolves the conflicts of the plan with the ConflictPolicy.
+func (b *bidiSync) settle(plan *bidiPlan) {
+	conflicts := plan.conflicts
+	plan.conflicts = nil
+	for _, d := range conflicts {
+		if skipped, ok := b.skipped[d.Path]; ok && skipped == d {
+			continue
+		}
+		delete(b.skipped, d.Path)
+		switch b.Conflicts {
+		case PreferLocal:
+			plan.keepLocal(d)
+		case PreferRemote:
+			plan.keepRemote(d)
+		default:
+			switch b.ask(d) {
+			case "l":
+				plan.keepLocal(d)
+			case "r":
+				plan.keepRemote(d)
+			default:
+				b.skipped[d.Path] = d
+				clog.LogWarn(i18n.Sprintf("left the conflict on %s alone until either copy changes again", d.Path))
+			}
+		}
+	}
+}
+
+// ask asks which copy of a file changed on both ends to keep, and returns
+// "l", "r", or "s" to skip it.
+func (b *bidiSync) ask(d Discrepancy) string {
+	if b.input == nil {
+		return "s"
+	}
+	what := "changed on both ends"
+	switch {
+	case d.Local == "":
+		what = "deleted locally and changed on the remote"
+	case d.Remote == "":
+		what = "changed locally and deleted on the remote"
+	}
+	for {
+		fmt.Fprintf(b.ErrW, "conflict: %s was %s. Keep the [l]ocal or [r]emote copy, or [s]kip? ", d.Path, what)
+		answer, err := b.input.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		switch answer {
+		case "l", "local":
+			return "l"
+		case "r", "remote":
+			return "r"
+		case "s", "skip":
+			return "s"
+		}
+		if err != nil {
+			fmt.Fprintln(b.ErrW)
+			return "s"
+		}
+	}
+}
+
+// remoteStatScript prints the remote time, then the size, modification time
+// and path of the regular files under $1. It fails if any of them can't be
+// listed, since a partial listing reads as files deleted on the remote.
+const remoteStatScript = `command -v find >/dev/null && command -v stat >/dev/null || exit 127
+cd "$1" || exit 1
+date +%s || exit 1
+find . -type f -exec stat -c '%s %Y %n' {} +`
+
+// remoteHashListScript prints the SHA-256 of the NUL separated paths on
+// stdin, relative to $1, in the format of sha256sum.
+const remoteHashListScript = `command -v sha256sum >/dev/null || exit 127
+cd "$1" && xargs -0 sha256sum 2>/dev/null
+exit 0`
+
+// pollRemote returns the SHA-256 of the remote files that aren't excluded,
+// and the files whose hash is unknown, such as files removed since they were
+// listed. Only the files whose size or modification time changed since the
+// last poll are hashed again.
+func (b *bidiSync) pollRemote(ctx context.Context) (map[string]string, map[string]bool, error) {
+	out, err := b.remoteOutput(ctx, "sh", "-c", remoteStatScript, "sh", b.RemoteDir)
+	var code wsep.ExitError
+	if xerrors.As(err, &code) && code.Code == 127 {
+		return nil, nil, xerrors.New("find or stat is not installed on the remote")
+	}
+	if err != nil {
+		return nil, nil, xerrors.Errorf("list remote files: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	now, err := strconv.ParseInt(lines[0], 10, 64)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("list remote files: unexpected output %q", lines[0])
+	}
+	stats := make(map[string]string, len(lines))
+	var stale []string
+	for _, line := range lines[1:] {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || !strings.HasPrefix(fields[2], "./") {
+			continue
+		}
+		p := strings.TrimPrefix(fields[2], "./")
+		if Excluded(b.Excludes, p) || strings.HasPrefix(path.Base(p), bidiTempPrefix) {
+			continue
+		}
+		stat := fields[0] + " " + fields[1]
+		// A file modified within the racy window might still change
+		// without its modification time changing.
+		if mtime, err := strconv.ParseInt(fields[1], 10, 64); err != nil || now-mtime < int64(racyWindow/time.Second) {
+			stat = ""
+		}
+		stats[p] = stat
+		if f, ok := b.remote[p]; !ok || f.stat == "" || f.stat != stat {
+			stale = append(stale, p)
+		}
+	}
+
+	sums, err := b.hashRemote(ctx, stale)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	remote := make(map[string]string, len(stats))
+	unknown := make(map[string]bool)
+	for _, p := range stale {
+		sum, ok := sums[p]
+		if !ok {
+			unknown[p] = true
+			delete(b.remote, p)
+			continue
+		}
+		b.remote[p] = remoteFile{stat: stats[p], sha256: sum}
+	}
+	for p := range b.remote {
+		if _, ok := stats[p]; !ok {
+			delete(b.remote, p)
+			continue
+		}
+		remote[p] = b.remote[p].sha256
+	}
+	return remote, unknown, nil
+}
+
+// hashRemote returns the SHA-256 of the remote files at paths that exist.
+func (b *bidiSync) hashRemote(ctx context.Context, paths []string) (map[string]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	var out strings.Builder
+	err := b.remoteExec(ctx, func(w io.Writer) error {
+		_, err := io.WriteString(w, "./"+strings.Join(paths, "\x00./")+"\x00")
+		return err
+	}, &out, "sh", "-c", remoteHashListScript, "sh", b.RemoteDir)
+	var code wsep.ExitError
+	if xerrors.As(err, &code) && code.Code == 127 {
+		return nil, xerrors.New("sha256sum is not installed on the remote")
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("hash remote files: %w", err)
+	}
+	return parseSHA256Sums(out.String()), nil
+}
+
+// pullBatch is how many files a single remote tar archives, to stay within
+// the limits on the length of command lines.
+const pullBatch = 256
+
+// pull copies the remote files to the local directory, and returns the
+// SHA-256 of what was written. The local files whose SHA-256 is no longer
+// the one in local aren't replaced, nor returned.
+func (b *bidiSync) pull(ctx context.Context, paths []string, local map[string]string) (map[string]string, error) {
+	pulled := make(map[string]string, len(paths))
+	for start := 0; start < len(paths); start += pullBatch {
+		end := start + pullBatch
+		if end > len(paths) {
+			end = len(paths)
+		}
+		args := []string{"-c", `cd "$1" && shift && exec tar -cf - "$@"`, "sh", b.RemoteDir}
+		for _, p := range paths[start:end] {
+			args = append(args, "./"+p)
+		}
+		pr, pw := io.Pipe()
+		extracted := make(chan error, 1)
+		go func() {
+			err := extractPulled(pr, b.LocalDir, local, pulled)
+			// Let the remote tar finish even if extraction failed.
+			_, _ = io.Copy(ioutil.Discard, pr)
+			extracted <- err
+		}()
+		err := b.remoteExec(ctx, nil, pw, "sh", args...)
+		_ = pw.CloseWithError(err)
+		if extractErr := <-extracted; extractErr != nil {
+			return nil, extractErr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pulled, nil
+}
+
+// extractPulled writes the regular files of the tar archive to the local
+// directory, recording their SHA-256 in sums. Every file is written to a
+// temporary file first, so that tools watching the local directory never see
+// it half written. A local file whose SHA-256 is no longer the one in local,
+// such as one saved while it was pulled, is left alone and not recorded.
+func extractPulled(r io.Reader, root string, local, sums map[string]string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return xerrors.Errorf("read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		rel := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+			return xerrors.Errorf("archive entry %q is outside of the synced directory", hdr.Name)
+		}
+		dst := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return xerrors.Errorf("create directory of %s: %w", rel, err)
+		}
+		sum, replaced, err := writePulledFile(dst, tr, hdr, local[rel])
+		if err != nil {
+			return xerrors.Errorf("write %s: %w", rel, err)
+		}
+		if replaced {
+			sums[rel] = sum
+		}
+	}
+}
+
+// writePulledFile replaces dst with the file read from r, unless its SHA-256
+// is no longer expected. The check is made once the file is downloaded,
+// right before it replaces dst.
+func writePulledFile(dst string, r io.Reader, hdr *tar.Header, expected string) (sum string, replaced bool, err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), bidiTempPrefix+"*")
+	if err != nil {
+		return "", false, err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }() // Best effort, gone after the rename.
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		_ = tmp.Close()
+		return "", false, err
+	}
+	if err := tmp.Chmod(os.FileMode(hdr.Mode).Perm()); err != nil {
+		_ = tmp.Close()
+		return "", false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", false, err
+	}
+	if err := os.Chtimes(tmp.Name(), hdr.ModTime, hdr.ModTime); err != nil {
+		return "", false, err
+	}
+	unchanged, err := localUnchanged(filepath.Dir(dst), filepath.Base(dst), expected)
+	if err != nil || !unchanged {
+		return "", false, err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return "", false, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), true, nil
+}
+
+// loadBidiState loads the hashes both ends last agreed on. A missing,
+// corrupt or outdated state starts empty, which merges both ends.
+func loadBidiState(path string) (map[string]string, error) {
+	files := make(map[string]string)
+	if path == "" {
+		return files, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read sync state: %w", err)
+	}
+	var f bidiStateFile
+	if err := json.Unmarshal(data, &f); err != nil || f.Version != bidiStateVersion || f.Files == nil {
+		return files, nil
+	}
+	return f.Files, nil
+}
+
+func saveBidiState(path string, files map[string]string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(bidiStateFile{Version: bidiStateVersion, Files: files})
+	if err != nil {
+		return xerrors.Errorf("encode sync state: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return xerrors.Errorf("write sync state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package sync
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func TestReconcile(t *testing.T) {
+	t.Parallel()
+
+	base := map[string]string{
+		"same":           "a",
+		"pushed":         "a",
+		"pulled":         "a",
+		"deleted-local":  "a",
+		"deleted-remote": "a",
+		"both":           "a",
+		"gone":           "a",
+		"unknown":        "a",
+	}
+	local := map[string]string{
+		"same":           "a",
+		"pushed":         "b",
+		"pulled":         "a",
+		"deleted-remote": "a",
+		"both":           "b",
+		"new-local":      "n",
+		"new-both":       "x",
+		"unknown":        "a",
+	}
+	remote := map[string]string{
+		"same":          "a",
+		"pushed":        "a",
+		"pulled":        "b",
+		"deleted-local": "a",
+		"both":          "c",
+		"new-remote":    "n",
+		"new-both":      "y",
+	}
+	plan := reconcile(base, local, remote, map[string]bool{"unknown": true})
+	assert.Equal(t, "push", []string{"new-local", "pushed"}, plan.push)
+	assert.Equal(t, "pull", []string{"new-remote", "pulled"}, plan.pull)
+	assert.Equal(t, "remove remote", []string{"deleted-local"}, plan.removeRemote)
+	assert.Equal(t, "remove local", []string{"deleted-remote"}, plan.removeLocal)
+	assert.Equal(t, "conflicts", []Discrepancy{
+		{Path: "both", Local: "b", Remote: "c"},
+		{Path: "new-both", Local: "x", Remote: "y"},
+	}, plan.conflicts)
+	assert.True(t, "gone on both ends", plan.agreed)
+	_, ok := base["gone"]
+	assert.False(t, "gone forgotten", ok)
+	assert.Equal(t, "unknown left alone", "a", base["unknown"])
+
+	plan.keepLocal(Discrepancy{Path: "x", Remote: "r"})
+	plan.keepRemote(Discrepancy{Path: "y", Local: "l"})
+	assert.Equal(t, "keep local deletion", "x", plan.removeRemote[len(plan.removeRemote)-1])
+	assert.Equal(t, "keep remote deletion", "y", plan.removeLocal[len(plan.removeLocal)-1])
+}
+
+func TestDropRemoteChanged(t *testing.T) {
+	t.Parallel()
+
+	plan := bidiPlan{
+		push:         []string{"new", "new-raced", "pushed", "pushed-raced"},
+		removeRemote: []string{"removed", "removed-raced", "removed-gone"},
+	}
+	remote := map[string]string{"pushed": "a", "pushed-raced": "a", "removed": "a", "removed-raced": "a", "removed-gone": "a"}
+	current := map[string]string{"new-raced": "n", "pushed": "a", "pushed-raced": "b", "removed": "a", "removed-raced": "b"}
+	changed := plan.dropRemoteChanged(remote, current)
+	assert.Equal(t, "changed", []string{"new-raced", "pushed-raced", "removed-raced", "removed-gone"}, changed)
+	assert.Equal(t, "push", []string{"new", "pushed"}, plan.push)
+	assert.Equal(t, "remove remote", []string{"removed"}, plan.removeRemote)
+}
+
+func TestExtractPulled(t *testing.T) {
+	t.Parallel()
+
+	archive := func(name, content string) *bytes.Buffer {
+		var b bytes.Buffer
+		tw := tar.NewWriter(&b)
+		assert.Success(t, "header", tw.WriteHeader(&tar.Header{
+			Name: name, Mode: 0600, Size: int64(len(content)), ModTime: time.Unix(1600000000, 0), Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write([]byte(content))
+		assert.Success(t, "write", err)
+		assert.Success(t, "close", tw.Close())
+		return &b
+	}
+
+	root := t.TempDir()
+	sums := make(map[string]string)
+	assert.Success(t, "extract", extractPulled(archive("./src/a.go", "a"), root, nil, sums))
+	content, err := ioutil.ReadFile(filepath.Join(root, "src", "a.go"))
+	assert.Success(t, "read", err)
+	assert.Equal(t, "content", "a", string(content))
+	const sumA = "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"
+	assert.Equal(t, "sum", sumA, sums["src/a.go"])
+
+	// The local file was saved after the cycle hashed it.
+	err = ioutil.WriteFile(filepath.Join(root, "src", "a.go"), []byte("saved"), 0600)
+	assert.Success(t, "save", err)
+	sums = make(map[string]string)
+	local := map[string]string{"src/a.go": sumA}
+	assert.Success(t, "extract", extractPulled(archive("./src/a.go", "b"), root, local, sums))
+	content, err = ioutil.ReadFile(filepath.Join(root, "src", "a.go"))
+	assert.Success(t, "read", err)
+	assert.Equal(t, "save kept", "saved", string(content))
+	assert.Equal(t, "not pulled", 0, len(sums))
+
+	local["src/a.go"] = "d81c55f49c5bb0d36bc11e3966ec4efab66f8dfefbbc1761161ca9d230e5466a"
+	assert.Success(t, "extract", extractPulled(archive("./src/a.go", "b"), root, local, sums))
+	content, err = ioutil.ReadFile(filepath.Join(root, "src", "a.go"))
+	assert.Success(t, "read", err)
+	assert.Equal(t, "unchanged replaced", "b", string(content))
+
+	err = extractPulled(archive("../escape", "x"), root, nil, sums)
+	assert.ErrorContains(t, "escape", err, "outside of the synced directory")
+}
+
+func TestBidiState(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	files, err := loadBidiState(path)
+	assert.Success(t, "missing", err)
+	assert.Equal(t, "empty", 0, len(files))
+	assert.Success(t, "save", saveBidiState(path, map[string]string{"a": "1"}))
+	files, err = loadBidiState(path)
+	assert.Success(t, "load", err)
+	assert.Equal(t, "loaded", map[string]string{"a": "1"}, files)
+}
+
+func TestCheckEmptyRemote(t *testing.T) {
+	t.Parallel()
+
+	newBidi := func(input string, allow bool) *bidiSync {
+		b := &bidiSync{
+			Sync: Sync{RemoteDir: "/home/coder/api", ErrW: ioutil.Discard, AllowEmptyRemote: allow},
+			base: map[string]string{"main.go": "1", "go.mod": "2"},
+		}
+		if input != "" {
+			b.input = bufio.NewReader(strings.NewReader(input))
+		}
+		return b
+	}
+	local := map[string]string{"main.go": "1", "go.mod": "2"}
+
+	// Without anyone to ask, the sync stops rather than deleting the local
+	// copies.
+	b := newBidi("", false)
+	assert.Error(t, "nobody to ask", b.checkEmptyRemote(map[string]string{}, nil))
+	assert.Error(t, "aborted", newBidi("a\n", false).checkEmptyRemote(map[string]string{}, nil))
+
+	b = newBidi("x\np\n", false)
+	assert.Success(t, "push", b.checkEmptyRemote(map[string]string{}, nil))
+	plan := reconcile(b.base, local, map[string]string{}, nil)
+	assert.Equal(t, "pushed again", []string{"go.mod", "main.go"}, plan.push)
+	assert.Equal(t, "nothing removed", 0, len(plan.removeLocal))
+
+	b = newBidi("d\n", false)
+	assert.Success(t, "delete", b.checkEmptyRemote(map[string]string{}, nil))
+	plan = reconcile(b.base, local, map[string]string{}, nil)
+	assert.Equal(t, "removed", []string{"go.mod", "main.go"}, plan.removeLocal)
+
+	assert.Success(t, "allowed", newBidi("", true).checkEmptyRemote(map[string]string{}, nil))
+	assert.Success(t, "not empty", newBidi("", false).checkEmptyRemote(map[string]string{"main.go": "1"}, nil))
+	assert.Success(t, "unknown", newBidi("", false).checkEmptyRemote(map[string]string{}, map[string]bool{"main.go": true}))
+}
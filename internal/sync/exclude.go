@@ -0,0 +1,133 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Excluded reports whether the path, relative to the synced directory with
+// slashes, matches any of the exclude patterns or is under a directory that
+// does, following rsync: a pattern without a slash, such as "node_modules"
+// or "*.log", matches a name at any depth; one with a slash, such as
+// "build/out", matches consecutive names at any depth, unless it starts with
+// a slash, which anchors it to the synced directory.
+func Excluded(patterns []string, rel string) bool {
+	rel = strings.Trim(filepath.ToSlash(rel), "/")
+	if rel == "" || rel == "." {
+		return false
+	}
+	names := strings.Split(rel, "/")
+	for _, pattern := range patterns {
+		anchored := strings.HasPrefix(pattern, "/")
+		parts := strings.Split(strings.Trim(pattern, "/"), "/")
+		for start := 0; start+len(parts) <= len(names); start++ {
+			if anchored && start > 0 {
+				break
+			}
+			if matchNames(parts, names[start:start+len(parts)]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchNames(patterns, names []string) bool {
+	for i, pattern := range patterns {
+		if ok, err := path.Match(pattern, names[i]); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// excluded reports whether the local path is excluded from the sync.
+func (s Sync) excluded(localPath string) bool {
+	if len(s.Excludes) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(s.LocalDir, strings.TrimSuffix(localPath, "/."))
+	if err != nil {
+		return false
+	}
+	return Excluded(s.Excludes, rel)
+}
+
+// excludeArgs returns the rsync arguments excluding the patterns from the
+// transfer of the local path. rsync anchors patterns to the transferred
+// directory, so anchored ones only apply to transfers of the synced one;
+// other transfers are of paths that aren't excluded.
+func (s Sync) excludeArgs(local string) []string {
+	root := local == s.LocalDir+"/."
+	args := make([]string, 0, len(s.Excludes))
+	for _, pattern := range s.Excludes {
+		if strings.HasPrefix(pattern, "/") && !root {
+			continue
+		}
+		args = append(args, "--exclude="+pattern)
+	}
+	return args
+}
+
+// IgnoreFiles are the files at the root of the synced directory whose
+// patterns a bidirectional sync leaves out, in the format of .gitignore.
+var IgnoreFiles = []string{".gitignore", ".coderignore"}
+
+// ReadIgnoreFiles returns the patterns of the IgnoreFiles of dir as exclude
+// patterns, and the patterns that can't be expressed as such. Missing files
+// are skipped.
+func ReadIgnoreFiles(dir string) (patterns, unsupported []string, err error) {
+	for _, name := range IgnoreFiles {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, xerrors.Errorf("read %s: %w", name, err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			pattern, ok := ignorePattern(line)
+			if !ok {
+				unsupported = append(unsupported, name+": "+line)
+				continue
+			}
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns, unsupported, nil
+}
+
+// ignorePattern converts a .gitignore pattern to an exclude pattern.
+// Negations and "**" within a pattern have no equivalent. A trailing slash,
+// which limits the pattern to directories, is dropped, so the pattern
+// matches files too.
+func ignorePattern(line string) (string, bool) {
+	if strings.HasPrefix(line, "!") {
+		return "", false
+	}
+	pattern := strings.TrimSuffix(line, "/")
+	// A leading "**/" matches at any depth, like a pattern without a
+	// slash.
+	if strings.HasPrefix(pattern, "**/") {
+		pattern = strings.TrimPrefix(pattern, "**/")
+		if strings.Contains(pattern, "/") {
+			return "", false
+		}
+	} else if strings.Contains(strings.TrimPrefix(pattern, "/"), "/") && !strings.HasPrefix(pattern, "/") {
+		// In .gitignore, a slash within the pattern anchors it.
+		pattern = "/" + pattern
+	}
+	if pattern == "" || pattern == "/" || strings.Contains(pattern, "**") {
+		return "", false
+	}
+	return pattern, true
+}
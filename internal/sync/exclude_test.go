@@ -0,0 +1,54 @@
+package sync
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func TestExcluded(t *testing.T) {
+	t.Parallel()
+
+	patterns := []string{"node_modules", "*.log", "build/out", "/dist/"}
+	for rel, want := range map[string]bool{
+		".":                             false,
+		"node_modules":                  true,
+		"web/node_modules/react/a.js":   true,
+		"logs/server.log":               true,
+		"server.log.gz":                 false,
+		"build/out/app":                 true,
+		"services/api/build/out":        true,
+		"build/cache":                   false,
+		"dist/app.js":                   true,
+		"web/dist/app.js":               false,
+		"src/main.go":                   false,
+		"src/node_modules_notes/readme": false,
+	} {
+		assert.Equal(t, rel, want, Excluded(patterns, rel))
+	}
+
+	s := Sync{LocalDir: "/home/me/api", Excludes: patterns}
+	assert.True(t, "local path", s.excluded("/home/me/api/web/node_modules/."))
+	assert.Equal(t, "anchored patterns only apply to the root", []string{
+		"--exclude=node_modules", "--exclude=*.log", "--exclude=build/out",
+	}, s.excludeArgs("/home/me/api/web/."))
+	assert.Equal(t, "root transfer", 4, len(s.excludeArgs("/home/me/api/.")))
+}
+
+func TestReadIgnoreFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	assert.Success(t, "gitignore", ioutil.WriteFile(filepath.Join(dir, ".gitignore"),
+		[]byte("# deps\nnode_modules/\n*.log\n/dist\nbuild/out\n**/tmp\n!keep.log\ndocs/**/*.md\n"), 0644))
+	assert.Success(t, "coderignore", ioutil.WriteFile(filepath.Join(dir, ".coderignore"), []byte(".env\n"), 0644))
+
+	patterns, unsupported, err := ReadIgnoreFiles(dir)
+	assert.Success(t, "read", err)
+	assert.Equal(t, "patterns", []string{"node_modules", "*.log", "/dist", "/build/out", "tmp", ".env"}, patterns)
+	assert.Equal(t, "unsupported", []string{".gitignore: !keep.log", ".gitignore: docs/**/*.md"}, unsupported)
+	assert.True(t, "nested", Excluded(patterns, "web/node_modules/react"))
+	assert.False(t, "anchored", Excluded(patterns, "web/build/out"))
+}
@@ -0,0 +1,147 @@
+package sync
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// A file whose modification time is this close to when it was hashed might
+// still be written to without its modification time changing, given the
+// granularity of some filesystems, so its hash isn't cached.
+const racyWindow = 2 * time.Second
+
+// hashCacheSaveInterval bounds how often the cache is written back while a
+// sync is running, since every save rewrites the whole file.
+const hashCacheSaveInterval = 30 * time.Second
+
+// hashCacheVersion is bumped whenever the format of the cache changes, which
+// discards the caches written by older versions.
+const hashCacheVersion = 1
+
+type cachedHash struct {
+	Size int64 `json:"size"`
+	// ModTime is in Unix nanoseconds.
+	ModTime int64  `json:"mtime"`
+	SHA256  string `json:"sha256"`
+}
+
+type hashCacheFile struct {
+	Version int                   `json:"version"`
+	Files   map[string]cachedHash `json:"files"`
+}
+
+// HashCache remembers the SHA-256 of local files along with their size and
+// modification time, so unchanged files aren't hashed again when a sync
+// session restarts. It is safe for concurrent use, and a nil cache hashes
+// every file.
+type HashCache struct {
+	path string
+
+	mu       sync.Mutex
+	files    map[string]cachedHash
+	dirty    bool
+	lastSave time.Time
+}
+
+// OpenHashCache loads the cache stored at path. A missing, corrupt or
+// outdated cache starts empty.
+func OpenHashCache(path string) (*HashCache, error) {
+	c := &HashCache{path: path, files: make(map[string]cachedHash)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read hash cache: %w", err)
+	}
+	var f hashCacheFile
+	if err := json.Unmarshal(data, &f); err != nil || f.Version != hashCacheVersion || f.Files == nil {
+		return c, nil
+	}
+	c.files = f.Files
+	return c, nil
+}
+
+// lookup returns the cached hash of the file at rel, if it hasn't changed
+// since it was cached.
+func (c *HashCache) lookup(rel string, info os.FileInfo) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.files[rel]
+	if !ok || e.Size != info.Size() || e.ModTime != info.ModTime().UnixNano() {
+		return "", false
+	}
+	return e.SHA256, true
+}
+
+func (c *HashCache) store(rel string, info os.FileInfo, sum string) {
+	if c == nil || time.Since(info.ModTime()) < racyWindow {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[rel] = cachedHash{Size: info.Size(), ModTime: info.ModTime().UnixNano(), SHA256: sum}
+	c.dirty = true
+}
+
+// prune forgets the files that aren't in hashes, after the whole tree was
+// hashed.
+func (c *HashCache) prune(hashes map[string]string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for rel := range c.files {
+		if _, ok := hashes[rel]; !ok {
+			delete(c.files, rel)
+			c.dirty = true
+		}
+	}
+}
+
+// Save writes the cache back if it changed.
+func (c *HashCache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	data, err := json.Marshal(hashCacheFile{Version: hashCacheVersion, Files: c.files})
+	if err != nil {
+		return xerrors.Errorf("encode hash cache: %w", err)
+	}
+	if err := writeFileAtomic(c.path, data); err != nil {
+		return xerrors.Errorf("write hash cache: %w", err)
+	}
+	c.dirty = false
+	c.lastSave = time.Now()
+	return nil
+}
+
+// flush saves the cache unless it was saved recently. The first save happens
+// right away, so the result of the initial scan survives an interrupted
+// session.
+func (c *HashCache) flush() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	recent := !c.lastSave.IsZero() && time.Since(c.lastSave) < hashCacheSaveInterval
+	c.mu.Unlock()
+	if recent {
+		return nil
+	}
+	return c.Save()
+}
@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func TestHashCache(t *testing.T) {
+	t.Parallel()
+
+	const (
+		a = "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"
+		b = "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d"
+	)
+
+	dir, err := ioutil.TempDir("", "coder-sync")
+	assert.Success(t, "create temp dir", err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	root := filepath.Join(dir, "root")
+	assert.Success(t, "mkdir", os.MkdirAll(root, 0750))
+	cachePath := filepath.Join(dir, "cache.json")
+
+	// Files written just now aren't cached, so they're dated back.
+	past := time.Now().Add(-time.Hour)
+	write := func(name, content string, mtime time.Time) {
+		path := filepath.Join(root, name)
+		assert.Success(t, "write file", ioutil.WriteFile(path, []byte(content), 0600))
+		assert.Success(t, "set mtime", os.Chtimes(path, mtime, mtime))
+	}
+	write("a", "a", past)
+	write("fresh", "a", time.Now())
+
+	cache, err := OpenHashCache(cachePath)
+	assert.Success(t, "open missing cache", err)
+	hashes, err := localHashes(root, ".", cache, nil)
+	assert.Success(t, "hash tree", err)
+	assert.Equal(t, "hashes", map[string]string{"a": a, "fresh": a}, hashes)
+	assert.Success(t, "save cache", cache.Save())
+
+	// Changing the content without changing the size or modification time
+	// shows whether the file was read again.
+	write("a", "b", past)
+	write("fresh", "b", time.Now())
+	cache, err = OpenHashCache(cachePath)
+	assert.Success(t, "open cache", err)
+	hashes, err = localHashes(root, ".", cache, nil)
+	assert.Success(t, "hash tree", err)
+	assert.Equal(t, "hashes", map[string]string{"a": a, "fresh": b}, hashes)
+
+	write("a", "b", past.Add(time.Second))
+	hashes, err = localHashes(root, ".", cache, nil)
+	assert.Success(t, "hash tree", err)
+	assert.Equal(t, "modified", b, hashes["a"])
+
+	assert.Success(t, "remove file", os.Remove(filepath.Join(root, "a")))
+	_, err = localHashes(root, ".", cache, nil)
+	assert.Success(t, "hash tree", err)
+	_, cached := cache.lookup("a", nil)
+	assert.False(t, "removed file still cached", cached)
+
+	assert.Success(t, "corrupt cache", ioutil.WriteFile(cachePath, []byte("{"), 0600))
+	cache, err = OpenHashCache(cachePath)
+	assert.Success(t, "open corrupt cache", err)
+	assert.Equal(t, "entries", 0, len(cache.files))
+}
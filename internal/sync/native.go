@@ -0,0 +1,271 @@
+package sync
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cdr.dev/slog"
+	"cdr.dev/wsep"
+	"github.com/gorilla/websocket"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/coderutil"
+)
+
+// The native transfer stands in for rsync where it isn't installed on either
+// end, such as on Windows. It compares the SHA-256 of the files on both ends,
+// the way verification does, then sends the files that differ as a tar
+// archive through the workspace executor. Files are transferred whole, so
+// it's slower than rsync for large files with small changes.
+
+// remoteUntarScript extracts the tar archive on stdin into $1.
+const remoteUntarScript = `command -v tar >/dev/null || exit 127
+mkdir -p "$1" && cd "$1" && tar -xf -`
+
+// remoteRemoveScript removes the NUL separated paths on stdin, relative to $1.
+const remoteRemoveScript = `cd "$1" && xargs -0 rm -f --`
+
+// nativeTransfer is what the native transfer of a path sends to the remote.
+type nativeTransfer struct {
+	// dirs and links are recreated on every transfer, since they're cheap
+	// to send and aren't hashed.
+	dirs  []string
+	links []string
+	// changed lists the regular files whose content differs on the remote.
+	changed []string
+	// extra lists the remote files that don't exist locally.
+	extra []string
+	// replaced lists the remote files that are links locally, which are
+	// removed before the links are sent, since tar doesn't overwrite files
+	// with links everywhere.
+	replaced []string
+}
+
+// syncPathsNative transfers local, a file or directory within LocalDir, to
+// its remote copy without rsync. With deleteExtra, remote files that don't exist
+// locally are removed.
+func (s Sync) syncPathsNative(ctx context.Context, deleteExtra bool, local string) error {
+	rel, err := filepath.Rel(s.LocalDir, filepath.Clean(strings.TrimSuffix(local, "/.")))
+	if err != nil {
+		return xerrors.Errorf("relative path: %w", err)
+	}
+	rel = filepath.ToSlash(rel)
+
+	t, err := s.planNativeTransfer(ctx, rel, deleteExtra)
+	if err != nil {
+		return err
+	}
+	s.Log.Debug(ctx, "native transfer",
+		slog.F("path", rel),
+		slog.F("changed", len(t.changed)),
+		slog.F("extra", len(t.extra)),
+	)
+	if len(t.replaced) > 0 {
+		if err := s.removeRemote(ctx, t.replaced); err != nil {
+			return xerrors.Errorf("remove files replaced by links: %w", err)
+		}
+	}
+	if len(t.dirs)+len(t.links)+len(t.changed) > 0 {
+		err := s.remoteExec(ctx, func(w io.Writer) error {
+			return writeNativeTar(w, s.LocalDir, t)
+		}, nil, "sh", "-c", remoteUntarScript, "sh", s.RemoteDir)
+		var code wsep.ExitError
+		if xerrors.As(err, &code) && code.Code == 127 {
+			return xerrors.New("tar is not installed on the remote")
+		}
+		if err != nil {
+			return xerrors.Errorf("send files: %w", err)
+		}
+	}
+	if len(t.extra) > 0 {
+		if err := s.removeRemote(ctx, t.extra); err != nil {
+			return xerrors.Errorf("remove deleted files: %w", err)
+		}
+	}
+	return nil
+}
+
+// removeRemote removes the remote files at paths, relative to RemoteDir.
+func (s Sync) removeRemote(ctx context.Context, paths []string) error {
+	return s.remoteExec(ctx, func(w io.Writer) error {
+		_, err := io.WriteString(w, strings.Join(paths, "\x00")+"\x00")
+		return err
+	}, nil, "sh", "-c", remoteRemoveScript, "sh", s.RemoteDir)
+}
+
+// planNativeTransfer compares the files under rel on both ends.
+func (s Sync) planNativeTransfer(ctx context.Context, rel string, deleteExtra bool) (nativeTransfer, error) {
+	var t nativeTransfer
+	err := filepath.Walk(filepath.Join(s.LocalDir, filepath.FromSlash(rel)), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed since the event, the next event deals with it.
+				return nil
+			}
+			return err
+		}
+		r, err := filepath.Rel(s.LocalDir, p)
+		if err != nil {
+			return err
+		}
+		if Excluded(s.Excludes, r) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case info.IsDir() && r != ".":
+			t.dirs = append(t.dirs, filepath.ToSlash(r))
+		case info.Mode()&os.ModeSymlink != 0:
+			t.links = append(t.links, filepath.ToSlash(r))
+		}
+		return nil
+	})
+	if err != nil {
+		return t, xerrors.Errorf("walk local files: %w", err)
+	}
+
+	local, err := localHashes(s.LocalDir, rel, s.HashCache, s.Excludes)
+	if err != nil {
+		return t, xerrors.Errorf("hash local files: %w", err)
+	}
+	remote, err := s.remoteHashes(ctx, rel)
+	if err != nil {
+		return t, xerrors.Errorf("hash remote files: %w", err)
+	}
+	for p := range remote {
+		if Excluded(s.Excludes, p) {
+			delete(remote, p)
+		}
+	}
+	t.compare(local, remote, deleteExtra)
+	return t, nil
+}
+
+// compare fills the files of the transfer from the hashes of the local and
+// remote files, once its links are known.
+func (t *nativeTransfer) compare(local, remote map[string]string, deleteExtra bool) {
+	links := make(map[string]bool, len(t.links))
+	for _, l := range t.links {
+		links[l] = true
+		if _, ok := remote[l]; ok {
+			t.replaced = append(t.replaced, l)
+		}
+	}
+	for _, d := range compareHashes(local, remote, deleteExtra) {
+		switch {
+		case links[d.Path]:
+			// Sent as a link, after the remote file is replaced.
+		case d.Local == "":
+			t.extra = append(t.extra, d.Path)
+		default:
+			t.changed = append(t.changed, d.Path)
+		}
+	}
+	sort.Strings(t.extra)
+	sort.Strings(t.replaced)
+}
+
+// writeNativeTar writes the directories, links and changed files of the
+// transfer, relative to root, as a tar archive to w.
+func writeNativeTar(w io.Writer, root string, t nativeTransfer) error {
+	tw := tar.NewWriter(w)
+	write := func(rel string) error {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			// Removed since it was planned, the next event deals with it.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Clean(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if !info.Mode().IsRegular() {
+			return tw.WriteHeader(hdr)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		// The file may have grown since it was stat'ed, and tar fails on
+		// entries longer than their header.
+		_, err = io.CopyN(tw, f, hdr.Size)
+		if err == io.EOF {
+			return xerrors.Errorf("%s was truncated while it was sent", rel)
+		}
+		return err
+	}
+	for _, group := range [][]string{t.dirs, t.links, t.changed} {
+		for _, rel := range group {
+			if err := write(rel); err != nil {
+				return xerrors.Errorf("archive %s: %w", rel, err)
+			}
+		}
+	}
+	return tw.Close()
+}
+
+// remoteExec runs prog in the workspace with what input writes as its stdin,
+// if not nil, and copies its stdout to output, if not nil.
+func (s Sync) remoteExec(ctx context.Context, input func(io.Writer) error, output io.Writer, prog string, args ...string) error {
+	conn, err := coderutil.DialWorkspaceWsep(ctx, s.Client, &s.Workspace)
+	if err != nil {
+		return xerrors.Errorf("dial executor: %w", err)
+	}
+	defer func() { _ = conn.Close(websocket.CloseNormalClosure, "") }() // Best effort.
+
+	process, err := wsep.RemoteExecer(conn).Start(ctx, wsep.Command{Command: prog, Args: args, Stdin: input != nil})
+	if err != nil {
+		return xerrors.Errorf("exec remote process: %w", err)
+	}
+	go func() { _, _ = io.Copy(s.ErrW, process.Stderr()) }() // Best effort.
+	inputErr := make(chan error, 1)
+	if input != nil {
+		go func() {
+			stdin := process.Stdin()
+			defer stdin.Close()
+			inputErr <- input(stdin)
+		}()
+	}
+	if output == nil {
+		output = ioutil.Discard
+	}
+	_, _ = io.Copy(output, process.Stdout()) // Any error is reported by Wait.
+	if err := process.Wait(); err != nil {
+		return xerrors.Errorf("%s: %w", prog, err)
+	}
+	// The process may exit before reading all of its input, such as the
+	// padding at the end of a tar archive, so input isn't waited for.
+	select {
+	case err := <-inputErr:
+		return err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,72 @@
+package sync
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func TestWriteNativeTar(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	assert.Success(t, "mkdir", os.MkdirAll(filepath.Join(root, "src", "empty"), 0755))
+	assert.Success(t, "write", ioutil.WriteFile(filepath.Join(root, "src", "a.go"), []byte("package a\n"), 0644))
+	transfer := nativeTransfer{
+		dirs:    []string{"src", "src/empty"},
+		changed: []string{"src/a.go", "src/gone.go"},
+	}
+	if runtime.GOOS != "windows" {
+		assert.Success(t, "symlink", os.Symlink("a.go", filepath.Join(root, "src", "link.go")))
+		transfer.links = []string{"src/link.go"}
+	}
+
+	var b bytes.Buffer
+	assert.Success(t, "write tar", writeNativeTar(&b, root, transfer))
+
+	entries := make(map[string]string)
+	tr := tar.NewReader(&b)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Success(t, "next", err)
+		content, err := ioutil.ReadAll(tr)
+		assert.Success(t, "read", err)
+		entries[hdr.Name] = string(content) + hdr.Linkname
+	}
+	want := map[string]string{
+		"src/":       "",
+		"src/empty/": "",
+		"src/a.go":   "package a\n",
+	}
+	if runtime.GOOS != "windows" {
+		want["src/link.go"] = "a.go"
+	}
+	// Files removed since the transfer was planned are left out.
+	assert.Equal(t, "entries", want, entries)
+}
+
+func TestNativeTransferCompare(t *testing.T) {
+	t.Parallel()
+
+	transfer := nativeTransfer{links: []string{"current", "new-link"}}
+	transfer.compare(
+		map[string]string{"a.go": "1", "b.go": "2"},
+		map[string]string{"a.go": "1", "b.go": "old", "current": "3", "gone.go": "4"},
+		true,
+	)
+	assert.Equal(t, "changed", []string{"b.go"}, transfer.changed)
+	// The remote file a link replaces is removed before the link is sent,
+	// not after, which would remove the link.
+	assert.Equal(t, "replaced", []string{"current"}, transfer.replaced)
+	assert.Equal(t, "extra", []string{"gone.go"}, transfer.extra)
+}
@@ -0,0 +1,112 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"cdr.dev/wsep"
+
+	"cdr.dev/coder-cli/internal/coderutil"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// remoteSpaceScript prints whether the closest existing directory of the
+// remote directory $1 is writable, the KiB available on its filesystem, and
+// the KiB the remote directory already uses, which the sync replaces.
+const remoteSpaceScript = `d=$1
+while [ ! -d "$d" ]; do d=$(dirname "$d"); done
+if [ ! -w "$d" ]; then echo "unwritable $d"; exit 0; fi
+used=0
+if [ -d "$1" ]; then used=$(du -sk "$1" 2>/dev/null | cut -f1); fi
+echo "$(df -Pk "$d" | tail -n 1 | awk '{print $4}') ${used:-0}"`
+
+// preflight checks that the remote directory can be written and that its
+// filesystem fits the local directory, before the initial transfer. A disk
+// filling up halfway through leaves truncated files behind otherwise.
+// The check is skipped if the remote can't tell.
+func (s Sync) preflight(ctx context.Context) error {
+	out, err := s.remoteOutput(ctx, "sh", "-c", remoteSpaceScript, "sh", s.RemoteDir)
+	if err != nil {
+		s.Log.Debug(ctx, "skip remote disk space check", slog.Error(err))
+		return nil
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 2 && fields[0] == "unwritable" {
+		return clog.Error(i18n.Sprintf("no permission to write to %s in %s", fields[1], s.Workspace.Name),
+			clog.BlankLine,
+			clog.Tipf("sync to a directory the workspace user can write to"),
+		)
+	}
+	if len(fields) != 2 {
+		s.Log.Debug(ctx, "skip remote disk space check", slog.F("output", out))
+		return nil
+	}
+	availableKiB, err1 := strconv.ParseUint(fields[0], 10, 64)
+	usedKiB, err2 := strconv.ParseUint(fields[1], 10, 64)
+	if err1 != nil || err2 != nil {
+		s.Log.Debug(ctx, "skip remote disk space check", slog.F("output", out))
+		return nil
+	}
+
+	size, err := dirSize(s.LocalDir)
+	if err != nil {
+		return xerrors.Errorf("measure %s: %w", s.LocalDir, err)
+	}
+	needKiB := (size + 1023) / 1024
+	if needKiB <= availableKiB+usedKiB {
+		return nil
+	}
+	return clog.Error(i18n.Sprintf("not enough disk space for %s in %s", s.RemoteDir, s.Workspace.Name),
+		fmt.Sprintf("%d MiB are needed, but only %d MiB are free", (needKiB-usedKiB)/1024, availableKiB/1024),
+		clog.BlankLine,
+		clog.Tipf("free up space in the workspace, or resize its disk with \"coder workspaces edit --disk\""),
+	)
+}
+
+// remoteOutput runs prog in the workspace, and returns its output.
+func (s Sync) remoteOutput(ctx context.Context, prog string, args ...string) (string, error) {
+	conn, err := coderutil.DialWorkspaceWsep(ctx, s.Client, &s.Workspace)
+	if err != nil {
+		return "", xerrors.Errorf("dial executor: %w", err)
+	}
+	defer func() { _ = conn.Close(websocket.CloseNormalClosure, "") }() // Best effort.
+
+	process, err := wsep.RemoteExecer(conn).Start(ctx, wsep.Command{Command: prog, Args: args})
+	if err != nil {
+		return "", xerrors.Errorf("exec remote process: %w", err)
+	}
+	var out bytes.Buffer
+	go func() { _, _ = io.Copy(ioutil.Discard, process.Stderr()) }() // Best effort.
+	_, _ = io.Copy(&out, process.Stdout())                           // Any error is reported by Wait.
+	if err := process.Wait(); err != nil {
+		return "", xerrors.Errorf("%s: %w", prog, err)
+	}
+	return out.String(), nil
+}
+
+// dirSize returns the total size of the regular files under root.
+func dirSize(root string) (uint64, error) {
+	var size uint64
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size, err
+}
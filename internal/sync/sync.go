@@ -22,11 +22,13 @@ import (
 	"golang.org/x/sync/semaphore"
 	"golang.org/x/xerrors"
 
+	"cdr.dev/slog"
 	"cdr.dev/wsep"
 
 	"cdr.dev/coder-cli/coder-sdk"
 	"cdr.dev/coder-cli/internal/activity"
 	"cdr.dev/coder-cli/internal/coderutil"
+	"cdr.dev/coder-cli/internal/i18n"
 	"cdr.dev/coder-cli/pkg/clog"
 )
 
@@ -40,6 +42,39 @@ type Sync struct {
 	RemoteDir string
 	// DisableMetrics disables activity metric pushing.
 	DisableMetrics bool
+	// Verify compares the hashes of transferred files on both ends after
+	// every transfer, and transfers them again if they differ.
+	Verify bool
+	// ProgressInterval is how often the initial sync logs that it's still
+	// going, or never if 0.
+	ProgressInterval time.Duration
+	// Journal records the result of every verification (optional).
+	Journal *Journal
+	// HashCache remembers the hashes of unchanged local files across
+	// sessions (optional).
+	HashCache *HashCache
+	// Excludes are rsync patterns of the paths left out of the sync, see
+	// Excluded. Excluded paths are neither transferred nor deleted on the
+	// remote.
+	Excludes []string
+	// Native transfers files with the built-in transfer instead of rsync,
+	// for machines where rsync isn't installed on either end. See
+	// syncPathsNative.
+	Native bool
+	// Conflicts settles the files changed on both ends of a bidirectional
+	// sync.
+	Conflicts ConflictPolicy
+	// PollInterval is how often a bidirectional sync checks the remote for
+	// changes, DefaultPollInterval if 0.
+	PollInterval time.Duration
+	// StatePath is where a bidirectional sync keeps the hashes both ends
+	// last agreed on between sessions (optional). Without it, every session
+	// starts by merging both ends.
+	StatePath string
+	// AllowEmptyRemote lets a bidirectional sync delete the local copies of
+	// the files it agreed on when RemoteDir turns out empty. Otherwise, it
+	// asks through InputReader, or fails.
+	AllowEmptyRemote bool
 
 	Workspace           coder.Workspace
 	Client              coder.Client
@@ -47,6 +82,9 @@ type Sync struct {
 	ErrW                io.Writer
 	InputReader         io.Reader
 	IsInteractiveOutput bool
+	// Log receives engine tracing, such as rsync invocations and raw
+	// filesystem events. The zero value discards it.
+	Log slog.Logger
 }
 
 // See https://lxadm.com/Rsync_exit_codes#List_of_standard_rsync_exit_codes.
@@ -55,14 +93,20 @@ const (
 	rsyncExitCodeDataStream = 12
 )
 
-func (s Sync) syncPaths(delete bool, local, remote string) error {
+func (s Sync) syncPaths(delete bool, local, remote string, extraArgs ...string) error {
+	if s.Native {
+		// The built-in transfer always compares checksums, so extraArgs
+		// have nothing left to ask for.
+		return s.syncPathsNative(context.Background(), delete, local)
+	}
 	self := os.Args[0]
 
-	args := []string{"-zz",
+	args := append([]string{"-zz",
 		"-a",
 		"--delete",
-		"-e", self + " sh", local, s.Workspace.Name + ":" + remote,
-	}
+	}, s.excludeArgs(local)...)
+	args = append(args, extraArgs...)
+	args = append(args, "-e", self+" sh", local, s.Workspace.Name+":"+remote)
 	if delete {
 		args = append([]string{"--delete"}, args...)
 	}
@@ -74,6 +118,7 @@ func (s Sync) syncPaths(delete bool, local, remote string) error {
 	// on compression level.
 	// (AB): compression sped up the initial sync of the enterprise repo by 30%, leading me to believe it's
 	// good in general for codebases.
+	s.Log.Debug(context.Background(), "run rsync", slog.F("args", args))
 	cmd := exec.Command("rsync", args...)
 	cmd.Stdout = s.OutW
 	cmd.Stderr = ioutil.Discard
@@ -95,6 +140,7 @@ func (s Sync) syncPaths(delete bool, local, remote string) error {
 }
 
 func (s Sync) remoteCmd(ctx context.Context, prog string, args ...string) error {
+	s.Log.Debug(ctx, "run remote command", slog.F("prog", prog), slog.F("args", args))
 	conn, err := coderutil.DialWorkspaceWsep(ctx, s.Client, &s.Workspace)
 	if err != nil {
 		return xerrors.Errorf("dial executor: %w", err)
@@ -125,15 +171,25 @@ func (s Sync) remoteCmd(ctx context.Context, prog string, args ...string) error
 
 // initSync performs the initial synchronization of the directory.
 func (s Sync) initSync() error {
-	clog.LogInfo(fmt.Sprintf("doing initial sync (%s -> %s)", s.LocalDir, s.RemoteDir))
+	clog.LogInfo(i18n.Sprintf("doing initial sync (%s -> %s)", s.LocalDir, s.RemoteDir))
 
+	if err := s.preflight(context.Background()); err != nil {
+		return err
+	}
 	start := time.Now()
+	heartbeat := clog.StartHeartbeat(fmt.Sprintf("initial sync (%s -> %s) in progress", s.LocalDir, s.RemoteDir), s.ProgressInterval)
+	defer heartbeat.Stop()
 	// Delete old files on initial sync (e.g git checkout).
 	// Add the "/." to the local directory so rsync doesn't try to place the directory
 	// into the remote dir.
 	if err := s.syncPaths(true, s.LocalDir+"/.", s.RemoteDir); err != nil {
 		return err
 	}
+	if s.Verify {
+		if err := s.verifyTransfer(context.Background(), s.LocalDir+"/.", s.RemoteDir, true); err != nil {
+			return err
+		}
+	}
 	clog.LogSuccess(
 		fmt.Sprintf("finished initial sync (%s)", time.Since(start).Truncate(time.Millisecond)),
 	)
@@ -158,6 +214,9 @@ func (s Sync) handleCreate(localPath string) error {
 		}
 		return err
 	}
+	if s.Verify {
+		return s.verifyTransfer(context.Background(), localPath, target, false)
+	}
 	return nil
 }
 
@@ -193,6 +252,14 @@ func (s Sync) work(ev timedEvent) {
 		localPath = ev.Path()
 		err       error
 	)
+	s.Log.Debug(context.Background(), "handle event",
+		slog.F("event", ev.Event().String()),
+		slog.F("path", localPath),
+		slog.F("queued", time.Since(ev.CreatedAt)),
+	)
+	if s.excluded(localPath) {
+		return
+	}
 	switch ev.Event() {
 	case notify.Write, notify.Create:
 		err = s.handleCreate(localPath)
@@ -201,14 +268,14 @@ func (s Sync) work(ev timedEvent) {
 	case notify.Remove:
 		err = s.handleDelete(localPath)
 	default:
-		clog.LogInfo(fmt.Sprintf("unhandled event %+v %s", ev.Event(), ev.Path()))
+		clog.LogInfo(i18n.Sprintf("unhandled event %+v %s", ev.Event(), ev.Path()))
 	}
 
 	log := fmt.Sprintf("%v %s (%s)",
 		ev.Event(), filepath.Base(localPath), time.Since(ev.CreatedAt).Truncate(time.Millisecond*10),
 	)
 	if err != nil {
-		clog.Log(clog.Error(fmt.Sprintf("%s: %s", log, err)))
+		clog.Log(clog.Error(i18n.Sprintf("%s: %s", log, err)))
 	} else {
 		clog.LogSuccess(log)
 	}
@@ -303,6 +370,9 @@ func (s Sync) Version() (string, error) {
 	}
 
 	versionString := strings.Split(firstLine, "protocol version ")
+	if len(versionString) != 2 {
+		return "", xerrors.Errorf("unexpected rsync version %q", strings.TrimSpace(firstLine))
+	}
 
 	return versionString[1], nil
 }
@@ -339,7 +409,7 @@ func (s Sync) Run() error {
 		return nil
 	}
 
-	clog.LogInfo(fmt.Sprintf("watching %s for changes", s.LocalDir))
+	clog.LogInfo(i18n.Sprintf("watching %s for changes", s.LocalDir))
 
 	var droppedEvents uint64
 	// Timed events lets us track how long each individual file takes to
@@ -0,0 +1,362 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cdr.dev/slog"
+	"cdr.dev/wsep"
+	"github.com/gorilla/websocket"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/internal/coderutil"
+	"cdr.dev/coder-cli/internal/i18n"
+	"cdr.dev/coder-cli/pkg/clog"
+)
+
+// Transfers are verified by comparing the SHA-256 of every regular file on
+// both ends, since rsync only checks what it transferred, and the data can
+// still get corrupted on the way to the disk.
+
+// verifyTimeout bounds how long hashing a tree on both ends may take.
+const verifyTimeout = 10 * time.Minute
+
+// Discrepancy is a file whose remote copy doesn't match the local one.
+type Discrepancy struct {
+	// Path is relative to the synced directories, with slashes.
+	Path string
+	// Local and Remote are the hex SHA-256 of the file on each end, or
+	// empty if it's missing there.
+	Local  string
+	Remote string
+}
+
+func (d Discrepancy) String() string {
+	switch {
+	case d.Remote == "":
+		return fmt.Sprintf("missing on remote: %s", d.Path)
+	case d.Local == "":
+		return fmt.Sprintf("only on remote:    %s", d.Path)
+	}
+	return fmt.Sprintf("content differs:   %s", d.Path)
+}
+
+// JournalEntry records the verification of a single file.
+type JournalEntry struct {
+	Time   time.Time `json:"time"`
+	Path   string    `json:"path"`
+	Local  string    `json:"local_sha256,omitempty"`
+	Remote string    `json:"remote_sha256,omitempty"`
+	OK     bool      `json:"ok"`
+	// Retried is set when the file was transferred again after a
+	// discrepancy.
+	Retried bool `json:"retried,omitempty"`
+}
+
+// Journal records every verified file as a line of JSON, so the integrity of
+// a sync session can be audited afterwards. It is safe for concurrent use.
+type Journal struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJournal returns a journal writing to w.
+func NewJournal(w io.Writer) *Journal {
+	return &Journal{enc: json.NewEncoder(w)}
+}
+
+func (j *Journal) record(e JournalEntry) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_ = j.enc.Encode(e) // Best effort, the journal must not stop the sync.
+}
+
+// VerifyTree compares every file of the local directory with its remote copy,
+// including files that only exist on the remote.
+func (s Sync) VerifyTree(ctx context.Context) ([]Discrepancy, error) {
+	return s.verify(ctx, s.LocalDir, verifyOptions{extra: true})
+}
+
+type verifyOptions struct {
+	// extra reports files that only exist on the remote. They're expected
+	// after individual transfers, until deletions are synced.
+	extra bool
+	// retried marks journal entries as following a second transfer.
+	retried bool
+}
+
+// verify compares the files under localPath, a file or a directory within
+// LocalDir, with their remote copies.
+func (s Sync) verify(ctx context.Context, localPath string, opts verifyOptions) ([]Discrepancy, error) {
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+
+	rel, err := filepath.Rel(s.LocalDir, filepath.Clean(localPath))
+	if err != nil {
+		return nil, xerrors.Errorf("relative path: %w", err)
+	}
+	rel = filepath.ToSlash(rel)
+
+	local, err := localHashes(s.LocalDir, rel, s.HashCache, s.Excludes)
+	if err != nil {
+		return nil, xerrors.Errorf("hash local files: %w", err)
+	}
+	if err := s.HashCache.flush(); err != nil {
+		// The cache only saves time, so the sync goes on without it.
+		s.Log.Warn(ctx, "save hash cache", slog.Error(err))
+	}
+	remote, err := s.remoteHashes(ctx, rel)
+	if err != nil {
+		return nil, xerrors.Errorf("hash remote files: %w", err)
+	}
+	for p := range remote {
+		if Excluded(s.Excludes, p) {
+			delete(remote, p)
+		}
+	}
+
+	discrepancies := compareHashes(local, remote, opts.extra)
+	bad := make(map[string]bool, len(discrepancies))
+	now := time.Now()
+	for _, d := range discrepancies {
+		bad[d.Path] = true
+		s.Journal.record(JournalEntry{Time: now, Path: d.Path, Local: d.Local, Remote: d.Remote, Retried: opts.retried})
+	}
+	for p, sum := range local {
+		if !bad[p] {
+			s.Journal.record(JournalEntry{Time: now, Path: p, Local: sum, Remote: sum, OK: true, Retried: opts.retried})
+		}
+	}
+	return discrepancies, nil
+}
+
+// hashWorkers is how many files are hashed at once.
+var hashWorkers = runtime.NumCPU()
+
+// localHashes returns the SHA-256 of the regular files under rel, a path
+// relative to root, keyed by their path relative to root with slashes. Files
+// that haven't changed since they were cached aren't read again, and
+// excluded ones aren't read at all.
+func localHashes(root, rel string, cache *HashCache, excludes []string) (map[string]string, error) {
+	type file struct {
+		path string
+		rel  string
+		info os.FileInfo
+	}
+	var files []file
+	err := filepath.Walk(filepath.Join(root, filepath.FromSlash(rel)), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed since it was synced, the next event deals with it.
+				return nil
+			}
+			return err
+		}
+		p, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if Excluded(excludes, p) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		files = append(files, file{path: path, rel: filepath.ToSlash(p), info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make(chan file, len(files))
+	for _, f := range files {
+		jobs <- f
+	}
+	close(jobs)
+
+	var (
+		mu     sync.Mutex
+		hashes = make(map[string]string, len(files))
+		eg     errgroup.Group
+	)
+	for i := 0; i < hashWorkers; i++ {
+		eg.Go(func() error {
+			for f := range jobs {
+				sum, ok := cache.lookup(f.rel, f.info)
+				if !ok {
+					var err error
+					sum, err = hashFile(f.path)
+					if os.IsNotExist(err) {
+						continue
+					}
+					if err != nil {
+						return err
+					}
+					cache.store(f.rel, f.info, sum)
+				}
+				mu.Lock()
+				hashes[f.rel] = sum
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	if rel == "." {
+		cache.prune(hashes)
+	}
+	return hashes, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remoteHashScript prints the SHA-256 of the regular files under $2, relative
+// to $1, in the format of sha256sum. Missing paths print nothing.
+const remoteHashScript = `command -v sha256sum >/dev/null || exit 127
+cd "$1" 2>/dev/null || exit 0
+find "$2" -type f -exec sha256sum {} + 2>/dev/null
+exit 0`
+
+// remoteHashes returns the SHA-256 of the remote regular files under rel,
+// a path relative to RemoteDir, keyed by their path relative to RemoteDir.
+func (s Sync) remoteHashes(ctx context.Context, rel string) (map[string]string, error) {
+	conn, err := coderutil.DialWorkspaceWsep(ctx, s.Client, &s.Workspace)
+	if err != nil {
+		return nil, xerrors.Errorf("dial executor: %w", err)
+	}
+	defer func() { _ = conn.Close(websocket.CloseNormalClosure, "") }() // Best effort.
+
+	// The "./" prefix keeps names starting with "-" from being taken for
+	// options of find.
+	target := "."
+	if rel != "." {
+		target = "./" + rel
+	}
+	process, err := wsep.RemoteExecer(conn).Start(ctx, wsep.Command{
+		Command: "sh",
+		Args:    []string{"-c", remoteHashScript, "sh", s.RemoteDir, target},
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("exec remote process: %w", err)
+	}
+	var out bytes.Buffer
+	go func() { _, _ = io.Copy(ioutil.Discard, process.Stderr()) }() // Best effort.
+	_, _ = io.Copy(&out, process.Stdout())                           // Any error is reported by Wait.
+	if err := process.Wait(); err != nil {
+		if code, ok := err.(wsep.ExitError); ok && code.Code == 127 {
+			return nil, xerrors.New("sha256sum is not installed on the remote")
+		}
+		return nil, xerrors.Errorf("remote sha256sum: %w", err)
+	}
+	return parseSHA256Sums(out.String()), nil
+}
+
+var sha256sumUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n")
+
+// parseSHA256Sums parses the output of sha256sum for paths starting with
+// "./", keyed by the path without that prefix.
+func parseSHA256Sums(out string) map[string]string {
+	hashes := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		// sha256sum escapes names with backslashes or newlines, and
+		// marks the line with a leading backslash.
+		escaped := strings.HasPrefix(line, `\`)
+		if escaped {
+			line = line[1:]
+		}
+		// Lines are the hash, a space, then a space or "*" for
+		// binary mode, then the name.
+		if len(line) < 67 {
+			continue
+		}
+		sum, name := line[:64], line[66:]
+		if escaped {
+			name = sha256sumUnescaper.Replace(name)
+		}
+		hashes[strings.TrimPrefix(name, "./")] = sum
+	}
+	return hashes
+}
+
+// compareHashes returns the files whose hashes differ, sorted by path. Files
+// that only exist on the remote are included if extra is set.
+func compareHashes(local, remote map[string]string, extra bool) []Discrepancy {
+	var discrepancies []Discrepancy
+	for p, sum := range local {
+		if remote[p] != sum {
+			discrepancies = append(discrepancies, Discrepancy{Path: p, Local: sum, Remote: remote[p]})
+		}
+	}
+	for p, sum := range remote {
+		if _, ok := local[p]; !ok && extra {
+			discrepancies = append(discrepancies, Discrepancy{Path: p, Remote: sum})
+		}
+	}
+	sort.Slice(discrepancies, func(i, j int) bool { return discrepancies[i].Path < discrepancies[j].Path })
+	return discrepancies
+}
+
+// verifyTransfer checks the files transferred from localPath, and transfers
+// them again with checksums if they differ. A file written to between its
+// transfer and its verification looks corrupted too, which the second
+// transfer fixes.
+func (s Sync) verifyTransfer(ctx context.Context, localPath, remotePath string, deleteExtra bool) error {
+	discrepancies, err := s.verify(ctx, localPath, verifyOptions{extra: deleteExtra})
+	if err != nil {
+		return xerrors.Errorf("verify transfer: %w", err)
+	}
+	if len(discrepancies) == 0 {
+		return nil
+	}
+	clog.LogWarn(i18n.Sprintf("%d files differ on the remote after transfer, transferring them again", len(discrepancies)))
+
+	if err := s.syncPaths(deleteExtra, localPath, remotePath, "--checksum"); err != nil {
+		return err
+	}
+	discrepancies, err = s.verify(ctx, localPath, verifyOptions{extra: deleteExtra, retried: true})
+	if err != nil {
+		return xerrors.Errorf("verify transfer: %w", err)
+	}
+	if len(discrepancies) > 0 {
+		lines := make([]string, 0, len(discrepancies))
+		for _, d := range discrepancies {
+			lines = append(lines, d.String())
+		}
+		return clog.Error("files still differ on the remote after transferring them again", lines...)
+	}
+	return nil
+}
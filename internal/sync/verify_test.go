@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func TestParseSHA256Sums(t *testing.T) {
+	t.Parallel()
+
+	const (
+		a = "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"
+		b = "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d"
+	)
+	sums := parseSHA256Sums(a + "  ./src/a.go\n" +
+		a + " *./bin/b\n" +
+		`\` + b + `  ./odd\nname` + "\n" +
+		"garbage\n")
+	assert.Equal(t, "sums", map[string]string{
+		"src/a.go":  a,
+		"bin/b":     a,
+		"odd\nname": b,
+	}, sums)
+}
+
+func TestCompareHashes(t *testing.T) {
+	t.Parallel()
+
+	local := map[string]string{"same": "1", "changed": "2", "missing": "3"}
+	remote := map[string]string{"same": "1", "changed": "4", "extra": "5"}
+
+	assert.Equal(t, "without extra", []Discrepancy{
+		{Path: "changed", Local: "2", Remote: "4"},
+		{Path: "missing", Local: "3"},
+	}, compareHashes(local, remote, false))
+	assert.Equal(t, "with extra", []Discrepancy{
+		{Path: "changed", Local: "2", Remote: "4"},
+		{Path: "extra", Remote: "5"},
+		{Path: "missing", Local: "3"},
+	}, compareHashes(local, remote, true))
+}
+
+func TestLocalHashes(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "coder-sync")
+	assert.Success(t, "create temp dir", err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	assert.Success(t, "mkdir", os.MkdirAll(filepath.Join(dir, "src"), 0750))
+	assert.Success(t, "write file", ioutil.WriteFile(filepath.Join(dir, "src", "a"), []byte("a"), 0600))
+	assert.Success(t, "write file", ioutil.WriteFile(filepath.Join(dir, "b"), []byte("b"), 0600))
+
+	all, err := localHashes(dir, ".", nil, nil)
+	assert.Success(t, "hash tree", err)
+	assert.Equal(t, "tree", map[string]string{
+		"src/a": "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb",
+		"b":     "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d",
+	}, all)
+
+	sub, err := localHashes(dir, "src", nil, nil)
+	assert.Success(t, "hash subtree", err)
+	assert.Equal(t, "subtree", 1, len(sub))
+
+	missing, err := localHashes(dir, "gone", nil, nil)
+	assert.Success(t, "hash missing path", err)
+	assert.Equal(t, "missing", 0, len(missing))
+
+	kept, err := localHashes(dir, ".", nil, []string{"src"})
+	assert.Success(t, "hash tree with excludes", err)
+	assert.Equal(t, "excluded directory skipped", map[string]string{
+		"b": "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d",
+	}, kept)
+}
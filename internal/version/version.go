@@ -3,6 +3,7 @@
 package version
 
 import (
+	"strconv"
 	"strings"
 )
 
@@ -18,3 +19,112 @@ func VersionsMatch(apiVersion string) bool {
 	majorMinor := strings.Join(withoutPatchRelease[:2], ".")
 	return strings.HasPrefix(strings.TrimPrefix(apiVersion, "v"), strings.TrimPrefix(majorMinor, "v"))
 }
+
+// Compare returns -1, 0 or 1 as the semantic version a is older than, the same
+// as, or newer than b, ignoring build metadata. The "v" prefix is optional.
+// Versions that aren't semantic versions are older than those that are.
+func Compare(a, b string) int {
+	pa, oka := parse(a)
+	pb, okb := parse(b)
+	switch {
+	case !oka && !okb:
+		return 0
+	case !oka:
+		return -1
+	case !okb:
+		return 1
+	}
+	for i := range pa.core {
+		if c := compareInt(pa.core[i], pb.core[i]); c != 0 {
+			return c
+		}
+	}
+	// A pre-release is older than its release.
+	switch {
+	case pa.prerelease == "" && pb.prerelease == "":
+		return 0
+	case pa.prerelease == "":
+		return 1
+	case pb.prerelease == "":
+		return -1
+	}
+	return comparePrerelease(strings.Split(pa.prerelease, "."), strings.Split(pb.prerelease, "."))
+}
+
+// Valid reports whether v is a semantic version, with an optional "v" prefix.
+func Valid(v string) bool {
+	_, ok := parse(v)
+	return ok
+}
+
+// Prerelease returns the pre-release part of the semantic version, such as
+// "beta.1" for "v1.22.0-beta.1", or "" for a release.
+func Prerelease(v string) string {
+	p, _ := parse(v)
+	return p.prerelease
+}
+
+type semver struct {
+	core       [3]int
+	prerelease string
+}
+
+func parse(v string) (semver, bool) {
+	var p semver
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		v, p.prerelease = v[:i], v[i+1:]
+		if p.prerelease == "" {
+			return p, false
+		}
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return p, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return p, false
+		}
+		p.core[i] = n
+	}
+	return p, true
+}
+
+// comparePrerelease compares dot-separated pre-release identifiers: numeric
+// ones numerically and below alphanumeric ones, which compare as strings.
+func comparePrerelease(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		na, erra := strconv.Atoi(a[i])
+		nb, errb := strconv.Atoi(b[i])
+		var c int
+		switch {
+		case erra == nil && errb == nil:
+			c = compareInt(na, nb)
+		case erra == nil:
+			c = -1
+		case errb == nil:
+			c = 1
+		default:
+			c = strings.Compare(a[i], b[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(a), len(b))
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -31,3 +31,39 @@ func TestVersion(t *testing.T) {
 	match = VersionsMatch("v1.12.9")
 	assert.True(t, "versions do match", match)
 }
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+
+	ordered := []string{
+		"unknown",
+		"1.21.0",
+		"v1.22.0-beta.1",
+		"v1.22.0-beta.2",
+		"v1.22.0-beta.11",
+		"v1.22.0-nightly.20261014",
+		"v1.22.0-rc.1",
+		"v1.22.0",
+		"v1.22.1+cli.2",
+		"v1.23.0",
+		"v2.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			assert.Equal(t, ordered[i]+" vs "+ordered[j], want, Compare(ordered[i], ordered[j]))
+		}
+	}
+	assert.Equal(t, "build metadata ignored", 0, Compare("v1.22.1+cli.2", "1.22.1"))
+
+	assert.Equal(t, "prerelease", "beta.1", Prerelease("v1.22.0-beta.1+cli"))
+	assert.Equal(t, "release", "", Prerelease("v1.22.0"))
+
+	assert.True(t, "valid", Valid("v1.22.0-beta.1+cli"))
+	assert.True(t, "unknown", !Valid("unknown"))
+}
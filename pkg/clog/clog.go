@@ -36,11 +36,11 @@ type CLIError struct {
 func (m CLIMessage) String() string {
 	var str strings.Builder
 	str.WriteString(fmt.Sprintf("%s: %s\n",
-		color.New(m.Color).Sprint(m.Level),
-		color.New(color.Bold).Sprint(m.Header)),
+		colorize(localize(m.Level), m.Color),
+		colorize(localizeText(m.Header), color.Bold)),
 	)
 	for _, line := range m.Lines {
-		str.WriteString(fmt.Sprintf("  %s %s\n", color.New(m.Color).Sprint("|"), line))
+		str.WriteString(fmt.Sprintf("  %s %s\n", colorize("|", m.Color), localizeText(line)))
 	}
 	return str.String()
 }
@@ -114,22 +114,22 @@ func Fatal(header string, lines ...string) CLIError {
 
 // Bold provides a convenience wrapper around color.New for brevity when logging.
 func Bold(a string) string {
-	return color.New(color.Bold).Sprint(a)
+	return colorize(a, color.Bold)
 }
 
 // Tipf formats according to the given format specifier and prepends a bolded "tip: " header.
 func Tipf(format string, a ...interface{}) string {
-	return fmt.Sprintf("%s %s", Bold("tip:"), fmt.Sprintf(format, a...))
+	return fmt.Sprintf("%s %s", Bold(localize("tip:")), localize(format, a...))
 }
 
 // Hintf formats according to the given format specifier and prepends a bolded "hint: " header.
 func Hintf(format string, a ...interface{}) string {
-	return fmt.Sprintf("%s %s", Bold("hint:"), fmt.Sprintf(format, a...))
+	return fmt.Sprintf("%s %s", Bold(localize("hint:")), localize(format, a...))
 }
 
 // Causef formats according to the given format specifier and prepends a bolded "cause: " header.
 func Causef(format string, a ...interface{}) string {
-	return fmt.Sprintf("%s %s", Bold("cause:"), fmt.Sprintf(format, a...))
+	return fmt.Sprintf("%s %s", Bold(localize("cause:")), localize(format, a...))
 }
 
 // BlankLine is an empty string meant to be used in CLIMessage and CLIError construction.
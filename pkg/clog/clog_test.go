@@ -83,3 +83,14 @@ func TestError(t *testing.T) {
 		)
 	})
 }
+
+func TestSetLocalizer(t *testing.T) {
+	t.Cleanup(func() { SetLocalizer(nil) })
+	SetLocalizer(func(format string, a ...interface{}) string {
+		return fmt.Sprintf("["+format+"]", a...)
+	})
+
+	assert.Equal(t, "tip", Bold("[tip:]")+" [use 2 workers]", Tipf("use %d workers", 2))
+	assert.Equal(t, "level", "[error]: [boom]\n", Error("boom").String())
+	assert.Equal(t, "lines", "[warning]: [disk at 95%]\n  | [clean up]\n", CLIMessage{Level: "warning", Header: "disk at 95%", Lines: []string{"clean up"}}.String())
+}
@@ -0,0 +1,83 @@
+package clog
+
+import (
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/fatih/color"
+	"golang.org/x/term"
+	"golang.org/x/xerrors"
+)
+
+// ColorMode controls when output is colored.
+type ColorMode string
+
+// Color modes, as accepted by the --color flag.
+const (
+	// ColorAuto colors output written to a terminal, unless the NO_COLOR
+	// environment variable is set. CLICOLOR_FORCE forces color even when
+	// output is redirected.
+	ColorAuto   ColorMode = "auto"
+	ColorAlways ColorMode = "always"
+	ColorNever  ColorMode = "never"
+)
+
+var colorMode = ColorAuto
+
+// ParseColorMode parses the value of a --color flag.
+func ParseColorMode(s string) (ColorMode, error) {
+	switch mode := ColorMode(s); mode {
+	case ColorAuto, ColorAlways, ColorNever:
+		return mode, nil
+	}
+	return "", xerrors.Errorf("invalid color mode %q, expected one of %q, %q or %q", s, ColorAuto, ColorAlways, ColorNever)
+}
+
+// SetColorMode sets when output is colored. It also applies to output
+// colored with github.com/fatih/color and written to stdout.
+func SetColorMode(mode ColorMode) {
+	colorMode = mode
+	color.NoColor = !ColorEnabled(os.Stdout)
+}
+
+// ColorEnabled reports whether output written to w should be colored.
+//
+// See https://no-color.org and https://bixense.com/clicolors.
+func ColorEnabled(w io.Writer) bool {
+	switch colorMode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return true
+	}
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+// StripColor removes ANSI escape sequences from s.
+func StripColor(s string) string {
+	return ansiEscape.ReplaceAllString(s, "")
+}
+
+// colorize returns s colored with attrs if output written by clog should be
+// colored.
+func colorize(s string, attrs ...color.Attribute) string {
+	if !ColorEnabled(writer) {
+		return s
+	}
+	c := color.New(attrs...)
+	c.EnableColor()
+	return c.Sprint(s)
+}
@@ -0,0 +1,73 @@
+package clog
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func setenv(t *testing.T, key, value string) {
+	prev, ok := os.LookupEnv(key)
+	assert.Success(t, "set "+key, os.Setenv(key, value))
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(key, prev)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+func TestColorEnabled(t *testing.T) {
+	t.Cleanup(func() { SetColorMode(ColorAuto) })
+	setenv(t, "NO_COLOR", "")
+	setenv(t, "CLICOLOR_FORCE", "")
+	var buf bytes.Buffer
+
+	SetColorMode(ColorAuto)
+	assert.True(t, "auto doesn't color a buffer", !ColorEnabled(&buf))
+
+	setenv(t, "CLICOLOR_FORCE", "1")
+	assert.True(t, "CLICOLOR_FORCE colors a buffer", ColorEnabled(&buf))
+
+	setenv(t, "NO_COLOR", "1")
+	assert.True(t, "NO_COLOR wins over CLICOLOR_FORCE", !ColorEnabled(&buf))
+
+	SetColorMode(ColorAlways)
+	assert.True(t, "always ignores NO_COLOR", ColorEnabled(&buf))
+
+	SetColorMode(ColorNever)
+	setenv(t, "NO_COLOR", "")
+	assert.True(t, "never ignores CLICOLOR_FORCE", !ColorEnabled(&buf))
+}
+
+func TestColorMessages(t *testing.T) {
+	t.Cleanup(func() {
+		SetColorMode(ColorAuto)
+		SetOutput(os.Stderr)
+	})
+	var buf bytes.Buffer
+	SetOutput(&buf)
+
+	SetColorMode(ColorNever)
+	LogWarn("disk almost full", Tipf("run docker system prune"))
+	assert.Equal(t, "plain output", "warning: disk almost full\n  | tip: run docker system prune\n", buf.String())
+
+	buf.Reset()
+	SetColorMode(ColorAlways)
+	LogWarn("disk almost full")
+	assert.True(t, "colored output", buf.String() != StripColor(buf.String()))
+	assert.Equal(t, "stripped output", "warning: disk almost full\n", StripColor(buf.String()))
+}
+
+func TestParseColorMode(t *testing.T) {
+	for _, s := range []string{"auto", "always", "never"} {
+		mode, err := ParseColorMode(s)
+		assert.Success(t, s, err)
+		assert.Equal(t, s, ColorMode(s), mode)
+	}
+	_, err := ParseColorMode("sometimes")
+	assert.Error(t, "invalid mode", err)
+}
@@ -0,0 +1,75 @@
+package clog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Heartbeat logs the status of a long operation as a single info line every
+// interval, so that logs that aren't read on a terminal, such as CI logs,
+// show it's still going without the control sequences of a spinner.
+type Heartbeat struct {
+	start time.Time
+	mu    sync.Mutex
+	// status is the current status of the operation.
+	status string
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// StartHeartbeat logs the status every interval until Stop is called. A
+// non-positive interval logs nothing.
+func StartHeartbeat(status string, interval time.Duration) *Heartbeat {
+	h := &Heartbeat{
+		start:  time.Now(),
+		status: status,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if interval <= 0 {
+		close(h.done)
+		return h
+	}
+	go func() {
+		defer close(h.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.stop:
+				return
+			case now := <-ticker.C:
+				h.mu.Lock()
+				status := h.status
+				h.mu.Unlock()
+				LogInfo(heartbeatLine(status, now.Sub(h.start)))
+			}
+		}
+	}()
+	return h
+}
+
+// Set updates the status logged with the next line.
+func (h *Heartbeat) Set(status string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status = status
+}
+
+// Stop stops logging. It's safe to call more than once.
+func (h *Heartbeat) Stop() {
+	h.mu.Lock()
+	select {
+	case <-h.stop:
+	default:
+		close(h.stop)
+	}
+	h.mu.Unlock()
+	<-h.done
+}
+
+// heartbeatLine formats the status of an operation running for elapsed.
+func heartbeatLine(status string, elapsed time.Duration) string {
+	return fmt.Sprintf("%s (%s elapsed)", status, elapsed.Truncate(time.Second))
+}
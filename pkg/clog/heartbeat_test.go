@@ -0,0 +1,44 @@
+package clog
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest/assert"
+)
+
+func TestHeartbeat(t *testing.T) {
+	// Not parallel: the output of clog is global.
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	t.Cleanup(func() { SetOutput(os.Stderr) })
+
+	h := StartHeartbeat("building", 10*time.Millisecond)
+	time.Sleep(35 * time.Millisecond)
+	h.Set("pulling image")
+	time.Sleep(35 * time.Millisecond)
+	h.Stop()
+	h.Stop()
+
+	output := buf.String()
+	assert.True(t, "logs the first status", strings.Contains(output, "building ("))
+	assert.True(t, "logs the updated status", strings.Contains(output, "pulling image ("))
+	assert.True(t, "logs one status per line", strings.Count(output, "elapsed)\n") >= 2)
+
+	buf.Reset()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, "logs nothing once stopped", "", buf.String())
+
+	h = StartHeartbeat("building", 0)
+	time.Sleep(20 * time.Millisecond)
+	h.Stop()
+	assert.Equal(t, "logs nothing without an interval", "", buf.String())
+}
+
+func TestHeartbeatLine(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "line", "building (1m2s elapsed)", heartbeatLine("building", time.Minute+2*time.Second+300*time.Millisecond))
+}
@@ -0,0 +1,27 @@
+package clog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// localize formats the user-facing strings of the package, see SetLocalizer.
+var localize = fmt.Sprintf
+
+// SetLocalizer sets the function translating the labels of messages, such as
+// "error" and "tip:", the formats given to Tipf, Hintf and Causef, before
+// formatting them, and the headers and lines of messages. The strings are in
+// English, and fmt.Sprintf is used by default.
+func SetLocalizer(f func(format string, a ...interface{}) string) {
+	if f == nil {
+		f = fmt.Sprintf
+	}
+	localize = f
+}
+
+// localizeText translates s, which is shown as is rather than used as a
+// format. Headers formatted by the caller are only translated if they were
+// formatted with a translated format.
+func localizeText(s string) string {
+	return localize(strings.ReplaceAll(s, "%", "%%"))
+}
@@ -6,10 +6,32 @@ import (
 	"reflect"
 	"strings"
 	"text/tabwriter"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/coder-cli/pkg/clog"
 )
 
 const structFieldTagKey = "table"
 
+type options struct {
+	// columns are the headers of the columns to write, in order, or nil to
+	// write them all.
+	columns []string
+}
+
+// Option configures WriteTable.
+type Option func(*options)
+
+// Columns selects the columns WriteTable writes and their order, by their
+// headers, which are matched ignoring case, spaces, dashes and underscores.
+// Passing nil writes all columns.
+func Columns(headers []string) Option {
+	return func(o *options) {
+		o.columns = headers
+	}
+}
+
 // StructValues tab delimits the values of a given struct.
 //
 // Tag a field `table:"-"` to hide it from output.
@@ -59,26 +81,124 @@ func StructFieldNames(data interface{}) string {
 //
 // `table:"-"` omits the field and no tag defaults to the Go identifier.
 // `table:"_"` flattens a fields subfields.
-func WriteTable(writer io.Writer, length int, each func(i int) interface{}) error {
+//
+// Only the columns selected with the Columns option are written, if any.
+//
+// ANSI escape sequences in values are removed unless output to writer
+// should be colored.
+func WriteTable(writer io.Writer, length int, each func(i int) interface{}, opts ...Option) error {
 	if length < 1 {
 		return nil
 	}
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	columns := o.columns
+	colored := clog.ColorEnabled(writer)
 	w := tabwriter.NewWriter(writer, 0, 0, 4, ' ', 0)
 	defer func() { _ = w.Flush() }() // Best effort.
+	var selected []int
 	for ix := 0; ix < length; ix++ {
 		item := each(ix)
 		if ix == 0 {
-			if _, err := fmt.Fprintln(w, StructFieldNames(item)); err != nil {
+			header := StructFieldNames(item)
+			if columns != nil {
+				names := structFieldNames(reflect.ValueOf(item))
+				var err error
+				if selected, err = selectColumns(names, columns); err != nil {
+					return err
+				}
+				header = pick(names, selected)
+			}
+			if _, err := fmt.Fprintln(w, header); err != nil {
 				return err
 			}
 		}
-		if _, err := fmt.Fprintln(w, StructValues(item)); err != nil {
+		values := StructValues(item)
+		if columns != nil {
+			values = pick(structFieldValues(reflect.ValueOf(item)), selected)
+		}
+		if !colored {
+			values = clog.StripColor(values)
+		}
+		if _, err := fmt.Fprintln(w, values); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// selectColumns returns the indexes of the wanted headers among headers.
+func selectColumns(headers, wanted []string) ([]int, error) {
+	selected := make([]int, 0, len(wanted))
+	for _, want := range wanted {
+		found := -1
+		for i, h := range headers {
+			if normalizeHeader(h) == normalizeHeader(want) {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			return nil, xerrors.Errorf("unknown column %q, the columns are: %s", want, strings.Join(headers, ", "))
+		}
+		selected = append(selected, found)
+	}
+	return selected, nil
+}
+
+func normalizeHeader(h string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "", "_", "").Replace(h))
+}
+
+// pick tab delimits the elements of all at the indexes.
+func pick(all []string, indexes []int) string {
+	s := &strings.Builder{}
+	for _, i := range indexes {
+		fmt.Fprintf(s, "%s\t", all[i])
+	}
+	return s.String()
+}
+
+// structFieldNames returns the headers of the columns of a struct, in the
+// order of StructFieldNames.
+func structFieldNames(v reflect.Value) []string {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	var names []string
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if shouldHideField(field) {
+			continue
+		}
+		if shouldFlatten(field) {
+			names = append(names, structFieldNames(reflect.New(field.Type))...)
+			continue
+		}
+		names = append(names, fieldName(field))
+	}
+	return names
+}
+
+// structFieldValues returns the formatted values of the columns of a struct,
+// in the order of StructValues.
+func structFieldValues(v reflect.Value) []string {
+	var values []string
+	for i := 0; i < v.NumField(); i++ {
+		if shouldHideField(v.Type().Field(i)) {
+			continue
+		}
+		if shouldFlatten(v.Type().Field(i)) {
+			values = append(values, structFieldValues(v.Field(i))...)
+			continue
+		}
+		values = append(values, fmt.Sprintf("%v", v.Field(i).Interface()))
+	}
+	return values
+}
+
 func fieldName(f reflect.StructField) string {
 	custom, ok := f.Tag.Lookup(structFieldTagKey)
 	if ok {
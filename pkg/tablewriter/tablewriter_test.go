@@ -55,6 +55,45 @@ func TestTableWriter(t *testing.T) {
 	assertGolden(t, "table_output.golden", buf.Bytes())
 }
 
+func TestTableWriterStripsColor(t *testing.T) {
+	type Row struct {
+		Name   string
+		Status string
+	}
+	items := []Row{
+		{Name: "backend", Status: "\x1b[32mON\x1b[0m"},
+		{Name: "frontend", Status: "OFF"},
+	}
+
+	// Output to a buffer is never a terminal, so it's not colored.
+	buf := bytes.NewBuffer(nil)
+	err := WriteTable(buf, len(items), func(i int) interface{} { return items[i] })
+	assert.Success(t, "write table", err)
+	assert.Equal(t, "color removed and columns aligned",
+		"Name        Status    \nbackend     ON        \nfrontend    OFF       \n", buf.String())
+}
+
+func TestTableWriterColumns(t *testing.T) {
+	type Nested struct {
+		Image string
+	}
+	type Row struct {
+		ID         string `table:"-"`
+		Name       string
+		LastActive string `table:"Last Active"`
+		Nested     Nested `table:"_"`
+	}
+	items := []Row{{ID: "1", Name: "backend", LastActive: "never", Nested: Nested{Image: "ubuntu"}}}
+	buf := bytes.NewBuffer(nil)
+	err := WriteTable(buf, len(items), func(i int) interface{} { return items[i] }, Columns([]string{"image", "last-active", "NAME"}))
+	assert.Success(t, "write table", err)
+	assert.Equal(t, "selected columns in order",
+		"Image     Last Active    Name       \nubuntu    never          backend    \n", buf.String())
+
+	err = WriteTable(bytes.NewBuffer(nil), len(items), func(i int) interface{} { return items[i] }, Columns([]string{"id"}))
+	assert.ErrorContains(t, "hidden fields aren't columns", err, `unknown column "id", the columns are: Name, Last Active, Image`)
+}
+
 func assertGolden(t *testing.T, path string, output []byte) {
 	if *write {
 		err := ioutil.WriteFile(path, output, 0777)
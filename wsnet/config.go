@@ -0,0 +1,56 @@
+package wsnet
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+
+	"cdr.dev/slog"
+)
+
+// AgentConfig is configuration the deployment pushes to running listeners
+// over the broker connection, in the Config field of a BrokerMessage on its
+// own stream. It's applied without restarting the listener, and kept across
+// broker reconnects. Fields left unset keep their current value.
+//
+// The listener answers with a BrokerMessage whose Error is empty once the
+// configuration is applied.
+type AgentConfig struct {
+	// LogLevel is debug, info, warn or error.
+	LogLevel string `json:"log_level,omitempty"`
+	// Metrics turns the reporting of agent metrics on or off.
+	Metrics *bool `json:"metrics,omitempty"`
+	// AllowedPorts restricts the addresses dialers can reach, on top of the
+	// policies sent with each dial. Unlike the other fields, an empty list
+	// is set, and lifts the restriction. It's kept when null.
+	AllowedPorts []DialPolicy `json:"allowed_ports"`
+}
+
+// applyConfig applies configuration pushed by the deployment, and answers
+// on conn.
+func (l *listener) applyConfig(ctx context.Context, conn net.Conn, config AgentConfig) {
+	l.log.Info(ctx, "applying pushed configuration", slog.F("config", config))
+	var resp BrokerMessage
+	err := l.onConfig(config)
+	if err == nil && config.AllowedPorts != nil {
+		l.allowedPortsMut.Lock()
+		l.allowedPorts = config.AllowedPorts
+		l.allowedPortsMut.Unlock()
+	}
+	if err != nil {
+		l.log.Warn(ctx, "rejected pushed configuration", slog.Error(err))
+		resp.Error = err.Error()
+	}
+	data, _ := json.Marshal(&resp)
+	_, _ = conn.Write(data)
+	_ = conn.Close()
+}
+
+// permitted checks the resolved protocol of a dial against the allowed
+// ports pushed by the deployment.
+func (l *listener) permitted(protocol string) error {
+	l.allowedPortsMut.RLock()
+	defer l.allowedPortsMut.RUnlock()
+	_, _, err := BrokerMessage{Policies: l.allowedPorts}.getAddress(protocol)
+	return err
+}
@@ -47,6 +47,26 @@ func ConnectEndpoint(baseURL *url.URL, workspace, token string) string {
 	return fmt.Sprintf("%s://%s%s%s%s%s", wsScheme, baseURL.Host, "/api/private/envagent/", workspace, "/connect?session_token=", token)
 }
 
+// AgentListenEndpoint is like ListenEndpoint, for an agent of a workspace
+// running several agents. They are told apart by their label, which is empty
+// for the main agent.
+func AgentListenEndpoint(baseURL *url.URL, token, label string) string {
+	return withAgentLabel(ListenEndpoint(baseURL, token), label)
+}
+
+// AgentConnectEndpoint is like ConnectEndpoint, for the agent of the
+// workspace with the given label.
+func AgentConnectEndpoint(baseURL *url.URL, workspace, label, token string) string {
+	return withAgentLabel(ConnectEndpoint(baseURL, workspace, token), label)
+}
+
+func withAgentLabel(endpoint, label string) string {
+	if label == "" {
+		return endpoint
+	}
+	return endpoint + "&agent=" + url.QueryEscape(label)
+}
+
 // TURNWebSocketICECandidate returns a fake TCP relay ICEServer.
 // It's used to trigger the ICEProxyDialer.
 func TURNProxyICECandidate() webrtc.ICEServer {
@@ -61,8 +81,9 @@ func TURNProxyICECandidate() webrtc.ICEServer {
 // Proxies all TURN ICEServer traffic through this dialer.
 // References Coder APIs with a specific token.
 type turnProxyDialer struct {
-	baseURL *url.URL
-	token   string
+	baseURL    *url.URL
+	token      string
+	httpClient *http.Client
 }
 
 func (t *turnProxyDialer) Dial(network, addr string) (c net.Conn, err error) {
@@ -85,6 +106,7 @@ func (t *turnProxyDialer) Dial(network, addr string) (c net.Conn, err error) {
 	url.Path = "/api/private/turn"
 	conn, resp, err := websocket.Dial(ctx, url.String(), &websocket.DialOptions{
 		HTTPHeader: headers,
+		HTTPClient: t.httpClient,
 	})
 	if err != nil {
 		if resp != nil {
@@ -2,16 +2,20 @@ package wsnet
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/hashicorp/yamux"
 	"github.com/pion/datachannel"
 	"github.com/pion/webrtc/v3"
 	"golang.org/x/net/proxy"
@@ -29,6 +33,15 @@ type DialOptions struct {
 	// set to nil, nothing will be logged.
 	Log *slog.Logger
 
+	// ICELog receives the logs of the ICE agent and the rest of the WebRTC
+	// stack, which are very verbose. If set to nil, they are discarded.
+	ICELog *slog.Logger
+
+	// Trace receives the lifecycle events of the connection, such as the
+	// offer and answer, ICE candidates and data channels. If nil, nothing
+	// is traced.
+	Trace *Tracer
+
 	// ICEServers is an array of STUN or TURN servers to use for negotiation purposes.
 	// See: https://developer.mozilla.org/en-US/docs/Web/API/RTCConfiguration/iceServers
 	ICEServers []webrtc.ICEServer
@@ -41,6 +54,29 @@ type DialOptions struct {
 
 	// TURNLocalProxyURL is the URL to proxy client TURN data through.
 	TURNLocalProxyURL *url.URL
+
+	// HTTPClient is used to dial the TURN proxy WebSocket. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// Relay skips WebRTC and carries connections over the broker WebSocket
+	// instead. It's much slower, and only meant for networks that block
+	// WebRTC entirely. Only DialWebsocket supports it.
+	Relay bool
+
+	// VerifyIdentity is called with the identity key of the listener once
+	// its answer is verified to be signed with it, and fails the dial if it
+	// returns an error. The key is nil for listeners that present no
+	// identity, such as older ones. Callers typically pin the key on first
+	// connect, and return ErrIdentityMismatch when it changes. It isn't
+	// called for relayed connections, which the broker carries itself.
+	VerifyIdentity func(key ed25519.PublicKey) error
+
+	// KeepAlive is how often the connection is pinged once established. A
+	// failed ping closes the Dialer, such as when the network changed while
+	// a laptop was asleep, so that Closed fires and callers can negotiate a
+	// new connection. Zero disables keepalives.
+	KeepAlive time.Duration
 }
 
 // DialWebsocket dials the broker with a WebSocket and negotiates a connection.
@@ -56,8 +92,10 @@ func DialWebsocket(ctx context.Context, broker string, netOpts *DialOptions, wsO
 	log := *netOpts.Log
 
 	log.Debug(ctx, "connecting to broker", slog.F("broker", broker))
+	netOpts.Trace.event("broker_connect", nil)
 	conn, resp, err := websocket.Dial(ctx, broker, wsOpts)
 	if err != nil {
+		netOpts.Trace.event("broker_connect_failed", map[string]interface{}{"error": err.Error()})
 		if resp != nil {
 			defer func() {
 				_ = resp.Body.Close()
@@ -67,6 +105,18 @@ func DialWebsocket(ctx context.Context, broker string, netOpts *DialOptions, wsO
 		return nil, fmt.Errorf("dial websocket: %w", err)
 	}
 	log.Debug(ctx, "connected to broker")
+	netOpts.Trace.event("broker_connected", nil)
+
+	if netOpts.Relay {
+		// The broker connection carries all traffic, so it must outlive ctx.
+		nconn := websocket.NetConn(context.Background(), conn, websocket.MessageBinary)
+		dialer, err := dialRelay(ctx, nconn, netOpts)
+		if err != nil {
+			_ = conn.Close(websocket.StatusInternalError, "an error occurred")
+			return nil, err
+		}
+		return dialer, nil
+	}
 
 	nconn := websocket.NetConn(ctx, conn, websocket.MessageBinary)
 	defer func() {
@@ -94,13 +144,14 @@ func Dial(ctx context.Context, conn net.Conn, options *DialOptions) (*Dialer, er
 	var turnProxy proxy.Dialer
 	if options.TURNLocalProxyURL != nil {
 		turnProxy = &turnProxyDialer{
-			baseURL: options.TURNLocalProxyURL,
-			token:   options.TURNProxyAuthToken,
+			baseURL:    options.TURNLocalProxyURL,
+			token:      options.TURNProxyAuthToken,
+			httpClient: options.HTTPClient,
 		}
 	}
 
 	log.Debug(ctx, "creating peer connection", slog.F("options", options), slog.F("turn_proxy", turnProxy))
-	rtc, err := newPeerConnection(options.ICEServers, turnProxy)
+	rtc, err := newPeerConnection(options.ICEServers, turnProxy, options.ICELog)
 	if err != nil {
 		return nil, fmt.Errorf("create peer connection: %w", err)
 	}
@@ -116,11 +167,16 @@ func Dial(ctx context.Context, conn net.Conn, options *DialOptions) (*Dialer, er
 		}
 	}()
 
+	trace := options.Trace
 	rtc.OnConnectionStateChange(func(pcs webrtc.PeerConnectionState) {
 		log.Debug(ctx, "connection state change", slog.F("state", pcs.String()))
+		trace.event("connection_state", map[string]interface{}{"state": pcs.String()})
+	})
+	rtc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		trace.event("ice_connection_state", map[string]interface{}{"state": state.String()})
 	})
 
-	flushCandidates := proxyICECandidates(rtc, conn)
+	flushCandidates := proxyICECandidates(rtc, conn, trace)
 
 	log.Debug(ctx, "creating control channel", slog.F("proto", controlChannel))
 	ctrl, err := rtc.CreateDataChannel(controlChannel, &webrtc.DataChannelInit{
@@ -136,6 +192,7 @@ func Dial(ctx context.Context, conn net.Conn, options *DialOptions) (*Dialer, er
 		return nil, fmt.Errorf("create offer: %w", err)
 	}
 	log.Debug(ctx, "created offer", slog.F("offer", offer))
+	trace.sdp("offer", offer.Type.String(), offer.SDP)
 	err = rtc.SetLocalDescription(offer)
 	if err != nil {
 		return nil, fmt.Errorf("set local offer: %w", err)
@@ -164,15 +221,22 @@ func Dial(ctx context.Context, conn net.Conn, options *DialOptions) (*Dialer, er
 	flushCandidates()
 
 	dialer := &Dialer{
-		log:         log,
-		conn:        conn,
-		ctrl:        ctrl,
-		rtc:         rtc,
-		connClosers: []io.Closer{ctrl},
+		log:            log,
+		trace:          trace,
+		conn:           conn,
+		ctrl:           ctrl,
+		rtc:            rtc,
+		offerSDP:       offer.SDP,
+		verifyIdentity: options.VerifyIdentity,
+		connClosers:    []io.Closer{ctrl},
+		closed:         make(chan struct{}),
 	}
 
 	// This is on a separate line so the defer above catches it.
 	err = dialer.negotiate(ctx)
+	if err == nil {
+		go dialer.keepAlive(options.KeepAlive)
+	}
 	return dialer, err
 }
 
@@ -181,14 +245,25 @@ func Dial(ctx context.Context, conn net.Conn, options *DialOptions) (*Dialer, er
 // should be proxied with a Listener.
 type Dialer struct {
 	log    slog.Logger
+	trace  *Tracer
 	conn   net.Conn
 	ctrl   *webrtc.DataChannel
 	ctrlrw datachannel.ReadWriteCloser
 	rtc    *webrtc.PeerConnection
+	// relay is set instead of rtc when connections are relayed over the
+	// broker.
+	relay *yamux.Session
+	// offerSDP is checked to be what the listener answered, when
+	// verifyIdentity is set.
+	offerSDP       string
+	verifyIdentity func(key ed25519.PublicKey) error
 
 	connClosers    []io.Closer
 	connClosersMut sync.Mutex
 	pingMut        sync.Mutex
+
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 func (d *Dialer) negotiate(ctx context.Context) (err error) {
@@ -215,12 +290,25 @@ func (d *Dialer) negotiate(ctx context.Context) (err error) {
 			errCh <- fmt.Errorf("wait for connection to open: %w", err)
 			return
 		}
+		if pair, err := d.Candidates(); err == nil && pair != nil {
+			d.trace.event("connected", map[string]interface{}{
+				"local_type":  pair.Local.Typ.String(),
+				"remote_type": pair.Remote.Typ.String(),
+				"protocol":    pair.Local.Protocol.String(),
+			})
+		} else {
+			d.trace.event("connected", nil)
+		}
 
 		d.rtc.OnConnectionStateChange(func(pcs webrtc.PeerConnectionState) {
+			d.trace.event("connection_state", map[string]interface{}{"state": pcs.String()})
 			if pcs == webrtc.PeerConnectionStateConnected {
 				d.log.Debug(ctx, "connected")
 				return
 			}
+			if pcs == webrtc.PeerConnectionStateFailed || pcs == webrtc.PeerConnectionStateClosed {
+				d.markClosed()
+			}
 
 			// Close connections opened when RTC was alive.
 			d.log.Warn(ctx, "closing connections due to connection state change", slog.F("pcs", pcs.String()))
@@ -255,6 +343,7 @@ func (d *Dialer) negotiate(ctx context.Context) (err error) {
 			}
 
 			d.log.Debug(ctx, "adding remote ICE candidate", slog.F("c", c))
+			d.trace.candidate("remote_candidate", c.Candidate)
 			err = d.rtc.AddICECandidate(c)
 			if err != nil {
 				return fmt.Errorf("accept ice candidate: %s: %w", msg.Candidate, err)
@@ -264,12 +353,17 @@ func (d *Dialer) negotiate(ctx context.Context) (err error) {
 
 		if msg.Answer != nil {
 			d.log.Debug(ctx, "received answer", slog.F("a", *msg.Answer))
+			d.trace.sdp("answer", msg.Answer.Type.String(), msg.Answer.SDP)
+			if err := d.checkIdentity(msg); err != nil {
+				return err
+			}
 			err = d.rtc.SetRemoteDescription(*msg.Answer)
 			if err != nil {
 				return fmt.Errorf("set answer: %w", err)
 			}
 
 			for _, candidate := range pendingCandidates {
+				d.trace.candidate("remote_candidate", candidate.Candidate)
 				err = d.rtc.AddICECandidate(candidate)
 				if err != nil {
 					return fmt.Errorf("accept pending ice candidate: %s: %w", candidate.Candidate, err)
@@ -281,6 +375,7 @@ func (d *Dialer) negotiate(ctx context.Context) (err error) {
 
 		if msg.Error != "" {
 			d.log.Debug(ctx, "got error from peer", slog.F("err", msg.Error))
+			d.trace.event("peer_error", map[string]interface{}{"error": msg.Error})
 			return fmt.Errorf("error from peer: %v", msg.Error)
 		}
 
@@ -290,9 +385,12 @@ func (d *Dialer) negotiate(ctx context.Context) (err error) {
 	return <-errCh
 }
 
-// ActiveConnections returns the amount of active connections.
+// activeConnections returns the amount of active connections.
 // DialContext opens a connection, and close will end it.
 func (d *Dialer) activeConnections() int {
+	if d.relay != nil {
+		return d.relay.NumStreams()
+	}
 	stats, ok := d.rtc.GetStats().GetConnectionStats(d.rtc)
 	if !ok {
 		return -1
@@ -303,18 +401,108 @@ func (d *Dialer) activeConnections() int {
 
 // Candidates returns the candidate pair that was chosen for the connection.
 func (d *Dialer) Candidates() (*webrtc.ICECandidatePair, error) {
+	if d.relay != nil {
+		return nil, errors.New("connections are relayed over the broker")
+	}
 	return d.rtc.SCTP().Transport().ICETransport().GetSelectedCandidatePair()
 }
 
+// Containers returns the names of the containers that can be dialed with
+// ContainerNetwork.
+func (d *Dialer) Containers(ctx context.Context) ([]string, error) {
+	conn, err := d.DialContext(ctx, "containers", "")
+	if err != nil {
+		// Agents that predate containers reject the protocol as an
+		// invalid address.
+		if strings.HasPrefix(err.Error(), "invalid dial address") {
+			return nil, fmt.Errorf("list containers, the agent may not support containers: %w", err)
+		}
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+	defer conn.Close()
+
+	var names []string
+	err = json.NewDecoder(conn).Decode(&names)
+	if err != nil {
+		return nil, fmt.Errorf("read containers: %w", err)
+	}
+	return names, nil
+}
+
 // Close closes the RTC connection.
 // All data channels dialed will be closed.
 func (d *Dialer) Close() error {
 	d.log.Debug(context.Background(), "close called")
+	d.trace.event("close", nil)
+	d.markClosed()
+	if d.relay != nil {
+		_ = d.relay.Close()
+		return d.conn.Close()
+	}
 	return d.rtc.Close()
 }
 
+// Closed is closed once the connection is gone for good, whether the Dialer
+// was closed, a keepalive failed or ICE gave up on the connection. A
+// disconnected connection that may still recover doesn't close it.
+func (d *Dialer) Closed() <-chan struct{} {
+	return d.closed
+}
+
+func (d *Dialer) markClosed() {
+	d.closeOnce.Do(func() {
+		close(d.closed)
+	})
+}
+
+// keepAlive pings the connection every interval until it's closed, closing
+// it when a ping fails.
+func (d *Dialer) keepAlive(interval time.Duration) {
+	if d.relay != nil {
+		// yamux keeps the session alive on its own.
+		go func() {
+			select {
+			case <-d.relay.CloseChan():
+				d.markClosed()
+			case <-d.closed:
+			}
+		}()
+	}
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.closed:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := d.Ping(ctx)
+		cancel()
+		if err != nil {
+			d.log.Warn(ctx, "keepalive failed, closing the connection", slog.Error(err))
+			d.trace.event("keepalive_failed", map[string]interface{}{"error": err.Error()})
+			_ = d.Close()
+			return
+		}
+	}
+}
+
+// Relayed reports whether connections are relayed over the broker instead of
+// WebRTC.
+func (d *Dialer) Relayed() bool {
+	return d.relay != nil
+}
+
 // Ping sends a ping through the control channel.
 func (d *Dialer) Ping(ctx context.Context) error {
+	if d.relay != nil {
+		_, err := d.relay.Ping()
+		return err
+	}
 	if d.ctrl.ReadyState() == webrtc.DataChannelStateClosed || d.ctrl.ReadyState() == webrtc.DataChannelStateClosing {
 		return webrtc.ErrConnectionClosed
 	}
@@ -359,6 +547,9 @@ func (d *Dialer) Ping(ctx context.Context) error {
 
 // DialContext dials the network and address on the remote listener.
 func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.relay != nil {
+		return d.dialRelayed(ctx, network, address)
+	}
 	proto := fmt.Sprintf("%s:%s", network, address)
 	ctx = slog.With(ctx, slog.F("proto", proto))
 
@@ -370,6 +561,10 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.
 	if err != nil {
 		return nil, fmt.Errorf("create data channel: %w", err)
 	}
+	d.trace.event("channel_open", map[string]interface{}{"proto": proto})
+	dc.OnClose(func() {
+		d.trace.event("channel_close", map[string]interface{}{"proto": proto})
+	})
 
 	d.connClosersMut.Lock()
 	d.connClosers = append(d.connClosers, dc)
@@ -401,19 +596,14 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.
 			return
 		}
 		d.log.Debug(ctx, "dial response", slog.F("res", res))
+		if res.Err != "" {
+			d.trace.event("channel_dial_failed", map[string]interface{}{"proto": proto, "code": res.Code, "error": res.Err})
+		}
 		if res.Err == "" {
 			close(errCh)
 			return
 		}
-		err := errors.New(res.Err)
-		if res.Code == CodeDialErr {
-			err = &net.OpError{
-				Op:  res.Op,
-				Net: res.Net,
-				Err: err,
-			}
-		}
-		errCh <- err
+		errCh <- res.err()
 	}()
 
 	select {
@@ -438,3 +628,22 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.
 	d.log.Debug(ctx, "dial channel ready")
 	return c, nil
 }
+
+// checkIdentity verifies the identity the listener answered with.
+func (d *Dialer) checkIdentity(msg BrokerMessage) error {
+	if d.verifyIdentity == nil {
+		return nil
+	}
+	var key ed25519.PublicKey
+	if msg.IdentityKey != nil {
+		err := verifyIdentity(msg.IdentityKey, msg.IdentitySignature, d.offerSDP, msg.Answer.SDP)
+		if err != nil {
+			return fmt.Errorf("verify listener identity: %w", err)
+		}
+		key = msg.IdentityKey
+	}
+	if err := d.verifyIdentity(key); err != nil {
+		return fmt.Errorf("verify listener identity: %w", err)
+	}
+	return nil
+}
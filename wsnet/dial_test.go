@@ -2,11 +2,13 @@ package wsnet
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
@@ -110,6 +112,65 @@ func TestDial(t *testing.T) {
 		assert.ErrorIs(t, err, io.EOF)
 	})
 
+	t.Run("KeepAlive", func(t *testing.T) {
+		t.Parallel()
+		log := slogtest.Make(t, nil)
+
+		connectAddr, listenAddr := createDumbBroker(t)
+		l, err := Listen(context.Background(), log, listenAddr, "")
+		require.NoError(t, err)
+		defer l.Close()
+
+		turnAddr, closeTurn := createTURNServer(t, ice.SchemeTypeTURN)
+		dialer, err := DialWebsocket(context.Background(), connectAddr, &DialOptions{
+			Log: &log,
+			ICEServers: []webrtc.ICEServer{{
+				URLs:           []string{fmt.Sprintf("turn:%s", turnAddr)},
+				Username:       "example",
+				Credential:     testPass,
+				CredentialType: webrtc.ICECredentialTypePassword,
+			}},
+			KeepAlive: 50 * time.Millisecond,
+		}, nil)
+		require.NoError(t, err)
+
+		select {
+		case <-dialer.Closed():
+			t.Fatal("closed while the connection is alive")
+		case <-time.After(200 * time.Millisecond):
+		}
+		closeTurn()
+		select {
+		case <-dialer.Closed():
+		case <-time.After(15 * time.Second):
+			t.Fatal("keepalive didn't close the lost connection")
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		t.Parallel()
+		log := slogtest.Make(t, nil)
+
+		connectAddr, listenAddr := createDumbBroker(t)
+		l, err := Listen(context.Background(), log, listenAddr, "")
+		require.NoError(t, err)
+		defer l.Close()
+
+		dialer, err := DialWebsocket(context.Background(), connectAddr, &DialOptions{
+			Log: &log,
+		}, nil)
+		require.NoError(t, err)
+
+		require.NoError(t, dialer.Close())
+		select {
+		case <-dialer.Closed():
+		case <-time.After(time.Second):
+			t.Fatal("Closed didn't fire on Close")
+		}
+		// Closing twice must not panic.
+		_ = dialer.Close()
+	})
+
 	t.Run("OPError", func(t *testing.T) {
 		t.Parallel()
 		log := slogtest.Make(t, nil)
@@ -167,6 +228,238 @@ func TestDial(t *testing.T) {
 		assert.Equal(t, msg, rec)
 	})
 
+	t.Run("Proxy Unix", func(t *testing.T) {
+		t.Parallel()
+		log := slogtest.Make(t, nil)
+
+		listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "test.sock"))
+		require.NoError(t, err)
+
+		msg := []byte("Hello!")
+		go func() {
+			conn, err := listener.Accept()
+			require.NoError(t, err)
+
+			_, _ = conn.Write(msg)
+		}()
+
+		connectAddr, listenAddr := createDumbBroker(t)
+		l, err := Listen(context.Background(), log, listenAddr, "")
+		require.NoError(t, err)
+		defer l.Close()
+
+		dialer, err := DialWebsocket(context.Background(), connectAddr, &DialOptions{
+			Log: &log,
+		}, nil)
+		require.NoError(t, err)
+
+		conn, err := dialer.DialContext(context.Background(), "unix", listener.Addr().String())
+		require.NoError(t, err)
+
+		rec := make([]byte, len(msg))
+		_, err = conn.Read(rec)
+		require.NoError(t, err)
+
+		assert.Equal(t, msg, rec)
+	})
+
+	t.Run("Proxy Container", func(t *testing.T) {
+		t.Parallel()
+		log := slogtest.Make(t, nil)
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		msg := []byte("Hello!")
+		go func() {
+			conn, err := listener.Accept()
+			require.NoError(t, err)
+
+			_, _ = conn.Write(msg)
+		}()
+
+		connectAddr, listenAddr := createDumbBroker(t)
+		l, err := ListenWithOptions(context.Background(), log, listenAddr, "", &ListenOptions{
+			Containers: map[string]string{
+				"tools": listener.Addr().String(),
+				"db":    "/run/db/ssh.sock",
+			},
+		})
+		require.NoError(t, err)
+		defer l.Close()
+
+		dialer, err := DialWebsocket(context.Background(), connectAddr, &DialOptions{
+			Log: &log,
+		}, nil)
+		require.NoError(t, err)
+
+		names, err := dialer.Containers(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"db", "tools"}, names)
+
+		_, err = dialer.DialContext(context.Background(), ContainerNetwork, "missing")
+		assert.Error(t, err)
+
+		conn, err := dialer.DialContext(context.Background(), ContainerNetwork, "tools")
+		require.NoError(t, err)
+
+		rec := make([]byte, len(msg))
+		_, err = conn.Read(rec)
+		require.NoError(t, err)
+
+		assert.Equal(t, msg, rec)
+	})
+
+	t.Run("Identity", func(t *testing.T) {
+		t.Parallel()
+		log := slogtest.Make(t, nil)
+
+		key, err := GenerateIdentityKey()
+		require.NoError(t, err)
+		connectAddr, listenAddr := createDumbBroker(t)
+		l, err := ListenWithOptions(context.Background(), log, listenAddr, "", &ListenOptions{
+			IdentityKey: key,
+		})
+		require.NoError(t, err)
+		defer l.Close()
+
+		var presented ed25519.PublicKey
+		dialer, err := DialWebsocket(context.Background(), connectAddr, &DialOptions{
+			Log: &log,
+			VerifyIdentity: func(key ed25519.PublicKey) error {
+				presented = key
+				return nil
+			},
+		}, nil)
+		require.NoError(t, err)
+		defer dialer.Close()
+		assert.Equal(t, key.Public(), presented)
+
+		_, err = DialWebsocket(context.Background(), connectAddr, &DialOptions{
+			Log: &log,
+			VerifyIdentity: func(key ed25519.PublicKey) error {
+				return ErrIdentityMismatch
+			},
+		}, nil)
+		assert.True(t, errors.Is(err, ErrIdentityMismatch))
+	})
+
+	t.Run("Relay", func(t *testing.T) {
+		t.Parallel()
+		log := slogtest.Make(t, nil)
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					_, _ = io.Copy(conn, conn)
+				}()
+			}
+		}()
+		defer listener.Close()
+
+		connectAddr, listenAddr := createDumbBroker(t)
+		l, err := ListenWithOptions(context.Background(), log, listenAddr, "", &ListenOptions{
+			Containers: map[string]string{"tools": listener.Addr().String()},
+		})
+		require.NoError(t, err)
+		defer l.Close()
+
+		dialer, err := DialWebsocket(context.Background(), connectAddr, &DialOptions{
+			Log:   &log,
+			Relay: true,
+		}, nil)
+		require.NoError(t, err)
+		defer dialer.Close()
+		assert.True(t, dialer.Relayed())
+		require.NoError(t, dialer.Ping(context.Background()))
+
+		for _, target := range []struct{ network, address string }{
+			{"tcp", listener.Addr().String()},
+			{ContainerNetwork, "tools"},
+		} {
+			conn, err := dialer.DialContext(context.Background(), target.network, target.address)
+			require.NoError(t, err)
+			msg := []byte("Hello!")
+			_, err = conn.Write(msg)
+			require.NoError(t, err)
+			rec := make([]byte, len(msg))
+			_, err = io.ReadFull(conn, rec)
+			require.NoError(t, err)
+			assert.Equal(t, msg, rec)
+			assert.Equal(t, target.address, conn.RemoteAddr().String())
+			require.NoError(t, conn.Close())
+		}
+
+		stats := dialer.Stats()
+		assert.True(t, stats.Relayed)
+		assert.Empty(t, stats.CandidatePair)
+		assert.Greater(t, stats.BytesSent, uint64(0))
+		assert.Greater(t, stats.BytesReceived, uint64(0))
+
+		names, err := dialer.Containers(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tools"}, names)
+
+		_, err = dialer.DialContext(context.Background(), "tcp", "localhost:1")
+		var opErr *net.OpError
+		assert.ErrorAs(t, err, &opErr)
+	})
+
+	t.Run("UDP", func(t *testing.T) {
+		t.Parallel()
+		log := slogtest.Make(t, nil)
+
+		// The echo server answers each datagram with one of its own.
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer pc.Close()
+		go func() {
+			buf := make([]byte, maxMessageLength)
+			for {
+				n, addr, err := pc.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				_, _ = pc.WriteTo(buf[:n], addr)
+			}
+		}()
+
+		connectAddr, listenAddr := createDumbBroker(t)
+		l, err := Listen(context.Background(), log, listenAddr, "")
+		require.NoError(t, err)
+		defer l.Close()
+
+		for _, relay := range []bool{false, true} {
+			dialer, err := DialWebsocket(context.Background(), connectAddr, &DialOptions{
+				Log:   &log,
+				Relay: relay,
+			}, nil)
+			require.NoError(t, err)
+
+			conn, err := dialer.DialContext(context.Background(), "udp", pc.LocalAddr().String())
+			require.NoError(t, err)
+			// Datagrams must not be merged or split, including over the
+			// relay's byte stream.
+			for _, msg := range []string{"first", "second datagram"} {
+				_, err = conn.Write([]byte(msg))
+				require.NoError(t, err)
+				rec := make([]byte, 64)
+				n, err := conn.Read(rec)
+				require.NoError(t, err)
+				assert.Equal(t, msg, string(rec[:n]), "relay: %v", relay)
+			}
+			require.NoError(t, conn.Close())
+			_ = dialer.Close()
+		}
+	})
+
 	// Expect that we'd get an EOF on the server closing.
 	t.Run("EOF on Close", func(t *testing.T) {
 		t.Parallel()
@@ -289,6 +582,12 @@ func TestDial(t *testing.T) {
 		assert.Equal(t, 2, dialer.activeConnections())
 		_ = conn.Close()
 		assert.Equal(t, 1, dialer.activeConnections())
+
+		stats := dialer.Stats()
+		assert.False(t, stats.Relayed)
+		assert.Equal(t, 1, stats.ActiveConnections)
+		assert.NotEmpty(t, stats.CandidatePair)
+		assert.Greater(t, stats.BytesSent, uint64(0))
 	})
 
 	t.Run("Close Listeners on Disconnect", func(t *testing.T) {
@@ -1,3 +1,69 @@
 // Package wsnet handles client and server ends of Workspace networking
 // negotiations and protocol.
+//
+// It's the library "coder tunnel", "coder ssh" and the workspace agent use
+// to reach into workspaces, and is meant to be embedded by other Go programs
+// too, such as IDE plugins that need a connection to a workspace port.
+//
+// # Dialing
+//
+// A Dialer is negotiated through the broker of the workspace, whose address
+// is given by ConnectEndpoint. DialWebsocket connects to it and returns a
+// Dialer, whose DialContext opens connections to any network and address
+// inside the workspace, as net.Conn:
+//
+//	dialer, err := wsnet.DialWebsocket(ctx, wsnet.ConnectEndpoint(baseURL, workspaceID, token), &wsnet.DialOptions{
+//		ICEServers:         iceServers, // from coder.Client.ICEServers
+//		TURNProxyAuthToken: token,
+//		TURNRemoteProxyURL: baseURL,
+//		TURNLocalProxyURL:  baseURL,
+//	}, nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer dialer.Close()
+//	conn, err := dialer.DialContext(ctx, "tcp", "localhost:8080")
+//
+// A Dialer carries any number of connections over a single peer-to-peer
+// WebRTC connection, over IPv4 or IPv6, whichever connects directly on the
+// networks of both ends. Where WebRTC is blocked entirely, DialOptions.Relay
+// carries them over the broker WebSocket instead. Dialer.Stats describes the
+// connection, and DialerCache shares Dialers between callers.
+//
+// Dialer.Listen works the other way around: it listens on a loopback port
+// or unix socket inside the workspace, and returns a net.Listener accepting
+// the connections made to it, such as to expose a local database.
+//
+// # Listening
+//
+// Listen, or ListenWithOptions, is the other end: it runs in the workspace,
+// accepts Dialers from the broker at ListenEndpoint, and proxies their
+// connections to the local network. It reconnects to the broker when the
+// connection drops, as often as ListenOptions.NextReconnect allows.
+//
+// Listeners with ListenOptions.IdentityKey sign their answers with it, and
+// DialOptions.VerifyIdentity lets dialers pin that identity, so that the
+// broker can't answer in place of the listener and intercept WebRTC traffic.
+//
+// The deployment can push an AgentConfig to running listeners over the
+// broker connection, such as to change their log level or restrict the ports
+// dialers can reach, and ListenOptions.OnConfig applies it without a restart.
+// ListenOptions.Metrics counts the sessions and traffic of a listener.
+//
+// See the examples directory for a complete program forwarding a local port
+// to a workspace.
+//
+// # Compatibility
+//
+// The exported identifiers of this package follow the compatibility promise
+// of the module's versioning: they are not removed or changed incompatibly
+// within a major version, though fields may be added to option and stats
+// structs, so construct those with field names. Dialers of this version can
+// connect to listeners of older versions, and the reverse, with features
+// that need both ends to support them, such as relaying, the container
+// network and Dialer.Listen, failing with an error rather than hanging.
+//
+// BrokerMessage, DialPolicy, AgentConfig and DialChannelResponse describe
+// the wire protocol, and are exported for implementations of the other end
+// rather than for use by Dialer and listener callers.
 package wsnet
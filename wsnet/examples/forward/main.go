@@ -0,0 +1,123 @@
+// Command forward is an example of embedding wsnet: it forwards a local TCP
+// port to a port inside a Coder workspace, like a minimal "coder tunnel".
+//
+//	CODER_URL=https://coder.example.com CODER_TOKEN=... go run ./wsnet/examples/forward -workspace backend -remote localhost:8080
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+
+	"cdr.dev/coder-cli/coder-sdk"
+	"cdr.dev/coder-cli/wsnet"
+)
+
+func main() {
+	var (
+		workspaceName = flag.String("workspace", "", "name of your workspace to forward to")
+		remote        = flag.String("remote", "localhost:8080", "address to dial inside the workspace")
+		local         = flag.String("local", "127.0.0.1:8080", "local address to listen on")
+	)
+	flag.Parse()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+	if err := forward(ctx, *workspaceName, *local, *remote); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func forward(ctx context.Context, workspaceName, local, remote string) error {
+	baseURL, err := url.Parse(os.Getenv("CODER_URL"))
+	if err != nil {
+		return fmt.Errorf("parse CODER_URL: %w", err)
+	}
+	token := os.Getenv("CODER_TOKEN")
+	client, err := coder.NewClient(coder.ClientOptions{BaseURL: baseURL, Token: token})
+	if err != nil {
+		return err
+	}
+
+	workspace, err := findWorkspace(ctx, client, workspaceName)
+	if err != nil {
+		return err
+	}
+	iceServers, err := client.ICEServers(ctx)
+	if err != nil {
+		return fmt.Errorf("get ICE servers: %w", err)
+	}
+
+	// One Dialer carries every forwarded connection.
+	dialer, err := wsnet.DialWebsocket(ctx, wsnet.ConnectEndpoint(baseURL, workspace.ID, token), &wsnet.DialOptions{
+		ICEServers:         iceServers,
+		TURNProxyAuthToken: token,
+		TURNRemoteProxyURL: baseURL,
+		TURNLocalProxyURL:  baseURL,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("dial workspace: %w", err)
+	}
+	defer dialer.Close()
+
+	listener, err := net.Listen("tcp", local)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+	log.Printf("forwarding %s to %s in workspace %s", listener.Addr(), remote, workspace.Name)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			stats := dialer.Stats()
+			log.Printf("done: sent %d bytes, received %d bytes", stats.BytesSent, stats.BytesReceived)
+			return nil
+		}
+		go func() {
+			defer conn.Close()
+			remoteConn, err := dialer.DialContext(ctx, "tcp", remote)
+			if err != nil {
+				log.Printf("dial %s: %v", remote, err)
+				return
+			}
+			defer remoteConn.Close()
+			go func() { _, _ = io.Copy(remoteConn, conn) }()
+			_, _ = io.Copy(conn, remoteConn)
+		}()
+	}
+}
+
+// findWorkspace returns the workspace of the authenticated user with the
+// given name.
+func findWorkspace(ctx context.Context, client coder.Client, name string) (*coder.Workspace, error) {
+	me, err := client.Me(ctx)
+	if err != nil {
+		return nil, err
+	}
+	workspaces, err := client.Workspaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range workspaces {
+		if w.UserID == me.ID && w.Name == name {
+			return &w, nil
+		}
+	}
+	return nil, fmt.Errorf("workspace %q not found", name)
+}
@@ -0,0 +1,88 @@
+package wsnet
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Listeners prove their identity to dialers by signing their answer, along
+// with the offer it answers, with a persistent identity key. The DTLS
+// fingerprints in the offer and answer bind the WebRTC connection to them, so
+// a broker that can't sign for the listener can't answer in its place and
+// relay the traffic, as long as dialers check the key against the one they
+// pinned on first connect.
+//
+// Relayed connections are carried by the broker itself, so identities don't
+// protect them.
+
+// identityContext separates identity signatures from other uses of the key.
+const identityContext = "wsnet-identity-v1\n"
+
+// ErrIdentityMismatch is returned by DialOptions.VerifyIdentity callbacks when
+// the listener presents another identity than the one pinned.
+var ErrIdentityMismatch = errors.New("listener identity does not match the pinned identity")
+
+// GenerateIdentityKey returns a new identity key for a listener.
+func GenerateIdentityKey() (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	return key, err
+}
+
+// MarshalIdentityKey encodes an identity key as a PEM PKCS #8 block.
+func MarshalIdentityKey(key ed25519.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParseIdentityKey decodes an identity key encoded by MarshalIdentityKey.
+func ParseIdentityKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("no PEM private key found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("identity key is a %T, not an ed25519 key", key)
+	}
+	return edKey, nil
+}
+
+// IdentityFingerprint returns the fingerprint of an identity in the format of
+// OpenSSH, such as "SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s".
+func IdentityFingerprint(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// signIdentity signs the answer to the offer.
+func signIdentity(key ed25519.PrivateKey, offerSDP, answerSDP string) (publicKey, signature []byte) {
+	return key.Public().(ed25519.PublicKey), ed25519.Sign(key, identityMessage(offerSDP, answerSDP))
+}
+
+// verifyIdentity checks that the answer to the offer is signed by the key.
+func verifyIdentity(publicKey, signature []byte, offerSDP, answerSDP string) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("invalid identity key")
+	}
+	if !ed25519.Verify(publicKey, identityMessage(offerSDP, answerSDP), signature) {
+		return errors.New("invalid identity signature")
+	}
+	return nil
+}
+
+func identityMessage(offerSDP, answerSDP string) []byte {
+	return []byte(identityContext + offerSDP + "\n" + answerSDP)
+}
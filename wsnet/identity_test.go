@@ -0,0 +1,32 @@
+package wsnet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentity(t *testing.T) {
+	t.Parallel()
+
+	key, err := GenerateIdentityKey()
+	require.NoError(t, err)
+	encoded, err := MarshalIdentityKey(key)
+	require.NoError(t, err)
+	parsed, err := ParseIdentityKey(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, key, parsed)
+	_, err = ParseIdentityKey([]byte("not a key"))
+	assert.Error(t, err)
+
+	pub, sig := signIdentity(key, "offer", "answer")
+	assert.NoError(t, verifyIdentity(pub, sig, "offer", "answer"))
+	assert.Error(t, verifyIdentity(pub, sig, "broker offer", "answer"), "offer replaced")
+	assert.Error(t, verifyIdentity(pub, sig, "offer", "broker answer"), "answer replaced")
+	assert.Error(t, verifyIdentity(pub[:8], sig, "offer", "answer"), "truncated key")
+
+	assert.True(t, strings.HasPrefix(IdentityFingerprint(pub), "SHA256:"))
+	assert.Len(t, IdentityFingerprint(pub), len("SHA256:")+43)
+}
@@ -2,12 +2,16 @@ package wsnet
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"net/url"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -29,6 +33,14 @@ const (
 	CodeBadAddressErr = "bad_address_error"
 )
 
+// ContainerNetwork is the network used to dial the SSH server of another
+// container of the workspace by name, such as a tooling sidecar.
+const ContainerNetwork = "container"
+
+// containersProtocol is the protocol of the data channel that lists the
+// containers known to the listener.
+const containersProtocol = "containers:"
+
 var connectionRetryInterval = time.Second
 
 // DialChannelResponse is used to notify a dial channel of a
@@ -42,12 +54,123 @@ type DialChannelResponse struct {
 	Op  string
 }
 
+// err returns the error described by the response, or nil.
+func (r DialChannelResponse) err() error {
+	if r.Err == "" {
+		return nil
+	}
+	err := errors.New(r.Err)
+	if r.Code == CodeDialErr {
+		err = &net.OpError{
+			Op:  r.Op,
+			Net: r.Net,
+			Err: err,
+		}
+	}
+	return err
+}
+
+// ListenOptions are configurable options for a wsnet listener.
+type ListenOptions struct {
+	// HTTPClient is used to dial the broker and the TURN proxy. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// Containers maps the names of the other containers of the workspace to
+	// the address of their SSH server, either "host:port" or the absolute
+	// path of a unix socket. Dialers reach them with the "container" network.
+	Containers map[string]string
+
+	// IdentityKey is the persistent key the listener proves its identity
+	// to dialers with, so they can detect a broker answering in its place.
+	// If nil, no identity is presented. See GenerateIdentityKey.
+	IdentityKey ed25519.PrivateKey
+
+	// OnConfig is called with the configuration pushed by the deployment,
+	// see AgentConfig. The listener applies AllowedPorts itself, once
+	// OnConfig accepts the configuration. If it returns an error, nothing
+	// is applied and the error is sent back.
+	OnConfig func(AgentConfig) error
+
+	// Metrics, if set, counts the activity of the listener, such as its
+	// sessions and the bytes carried.
+	Metrics *ListenerMetrics
+
+	// NextReconnect returns how long to wait before the attempt to
+	// reconnect to the broker after losing the connection, counting from 1,
+	// or false to give up. If nil, the listener retries every second, for
+	// ever.
+	NextReconnect func(attempt int) (wait time.Duration, ok bool)
+
+	// OnStateChange, if set, is called as the connection to the broker
+	// changes state. It must not block.
+	OnStateChange func(ListenerStateChange)
+}
+
+// ListenerState is the state of the connection of a listener to the broker.
+type ListenerState string
+
+// States of ListenerStateChange.
+const (
+	// ListenerConnected is entered once the listener connects to the broker.
+	ListenerConnected ListenerState = "connected"
+	// ListenerDisconnected is entered when the connection to the broker is
+	// lost, with the error that ended it.
+	ListenerDisconnected ListenerState = "disconnected"
+	// ListenerReconnecting is entered before each attempt to reconnect,
+	// with how long the listener waits before it.
+	ListenerReconnecting ListenerState = "reconnecting"
+	// ListenerGaveUp is entered when ListenOptions.NextReconnect gives up.
+	// The listener no longer accepts dialers, and should be closed.
+	ListenerGaveUp ListenerState = "gave_up"
+)
+
+// ListenerStateChange describes a change of the state of the connection of a
+// listener to the broker.
+type ListenerStateChange struct {
+	State ListenerState
+	// Attempt counts the attempts to reconnect since the connection was
+	// lost. It's 0 for the first connection.
+	Attempt int
+	// Wait is how long the listener waits before reconnecting.
+	Wait time.Duration
+	// Err is why the connection was lost, or why the last attempt to
+	// reconnect failed.
+	Err error
+}
+
 // Listen connects to the broker proxies connections to the local net.
 // Close will end all RTC connections.
 func Listen(ctx context.Context, log slog.Logger, broker string, turnProxyAuthToken string) (io.Closer, error) {
+	return ListenWithOptions(ctx, log, broker, turnProxyAuthToken, nil)
+}
+
+// ListenWithOptions is like Listen, with configurable options.
+func ListenWithOptions(ctx context.Context, log slog.Logger, broker string, turnProxyAuthToken string, options *ListenOptions) (io.Closer, error) {
+	if options == nil {
+		options = &ListenOptions{}
+	}
+	if options.OnConfig == nil {
+		options.OnConfig = func(AgentConfig) error { return nil }
+	}
+	if options.NextReconnect == nil {
+		options.NextReconnect = func(int) (time.Duration, bool) {
+			return connectionRetryInterval, true
+		}
+	}
+	if options.OnStateChange == nil {
+		options.OnStateChange = func(ListenerStateChange) {}
+	}
 	l := &listener{
 		log:                log,
 		broker:             broker,
+		httpClient:         options.HTTPClient,
+		containers:         options.Containers,
+		identityKey:        options.IdentityKey,
+		onConfig:           options.OnConfig,
+		metrics:            options.Metrics,
+		nextReconnect:      options.NextReconnect,
+		onStateChange:      options.OnStateChange,
 		connClosers:        make([]io.Closer, 0),
 		closed:             make(chan struct{}, 1),
 		turnProxyAuthToken: turnProxyAuthToken,
@@ -60,6 +183,8 @@ func Listen(ctx context.Context, log slog.Logger, broker string, turnProxyAuthTo
 	if err != nil {
 		return nil, err
 	}
+	l.metrics.setConnected(true)
+	l.onStateChange(ListenerStateChange{State: ListenerConnected})
 	go func() {
 		for {
 			err := <-ch
@@ -73,24 +198,16 @@ func Listen(ctx context.Context, log slog.Logger, broker string, turnProxyAuthTo
 
 			if err != nil {
 				l.log.Warn(ctx, "disconnected from broker", slog.Error(err))
+				l.metrics.setConnected(false)
+				l.onStateChange(ListenerStateChange{State: ListenerDisconnected, Err: err})
 
 				// If we hit an EOF, then the connection to the broker
-				// was interrupted. We'll take a short break then dial
-				// again.
-				ticker := time.NewTicker(connectionRetryInterval)
-				for {
-					select {
-					case <-ticker.C:
-						ch, err = l.dial(ctx)
-					case <-ctx.Done():
-						err = ctx.Err()
-					}
-					if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-						break
-					}
-					l.log.Warn(ctx, "connecting to broker failed", slog.Error(err))
+				// was interrupted. We'll take a break then dial again.
+				ch, err = l.reconnect(ctx, err)
+				if err != nil {
+					return
 				}
-				ticker.Stop()
+				l.metrics.reconnected()
 			}
 			l.log.Info(ctx, "connected to broker")
 		}
@@ -98,9 +215,62 @@ func Listen(ctx context.Context, log slog.Logger, broker string, turnProxyAuthTo
 	return l, nil
 }
 
+// reconnect dials the broker until it connects, waiting before each attempt
+// as long as the reconnect policy says. It returns an error once the policy
+// gives up, ctx is done or the listener is closed.
+func (l *listener) reconnect(ctx context.Context, lastErr error) (<-chan error, error) {
+	for attempt := 1; ; attempt++ {
+		wait, ok := l.nextReconnect(attempt)
+		if !ok {
+			err := fmt.Errorf("gave up reconnecting to the broker after %d attempts: %w", attempt-1, lastErr)
+			l.log.Error(ctx, "gave up reconnecting to broker", slog.F("attempts", attempt-1), slog.Error(lastErr))
+			l.onStateChange(ListenerStateChange{State: ListenerGaveUp, Attempt: attempt - 1, Err: err})
+			return nil, err
+		}
+		l.onStateChange(ListenerStateChange{State: ListenerReconnecting, Attempt: attempt, Wait: wait, Err: lastErr})
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-l.closed:
+			timer.Stop()
+			return nil, errors.New("listener closed")
+		}
+
+		ch, err := l.dial(ctx)
+		if err == nil {
+			l.onStateChange(ListenerStateChange{State: ListenerConnected, Attempt: attempt})
+			return ch, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		l.log.Warn(ctx, "connecting to broker failed", slog.F("attempt", attempt), slog.Error(err))
+		lastErr = err
+	}
+}
+
 type listener struct {
 	broker             string
 	turnProxyAuthToken string
+	httpClient         *http.Client
+	containers         map[string]string
+	identityKey        ed25519.PrivateKey
+	onConfig           func(AgentConfig) error
+	metrics            *ListenerMetrics
+	nextReconnect      func(attempt int) (time.Duration, bool)
+	onStateChange      func(ListenerStateChange)
+
+	allowedPorts    []DialPolicy
+	allowedPortsMut sync.RWMutex
+
+	// reverseConns are the connections accepted by reverse listeners that
+	// wait for their dialer to pick them up, by ID.
+	reverseConns    map[string]net.Conn
+	reverseConnsMut sync.Mutex
 
 	log            slog.Logger
 	ws             *websocket.Conn
@@ -116,7 +286,7 @@ func (l *listener) dial(ctx context.Context) (<-chan error, error) {
 		_ = l.ws.Close(websocket.StatusNormalClosure, "new connection inbound")
 	}
 
-	conn, resp, err := websocket.Dial(ctx, l.broker, nil)
+	conn, resp, err := websocket.Dial(ctx, l.broker, &websocket.DialOptions{HTTPClient: l.httpClient})
 	if err != nil {
 		if resp != nil {
 			return nil, coder.NewHTTPError(resp)
@@ -198,6 +368,15 @@ func (l *listener) negotiate(ctx context.Context, conn net.Conn) {
 		}
 		l.log.Debug(ctx, "received broker message", slog.F("msg", msg))
 
+		if msg.Relay {
+			l.relay(ctx, conn, decoder.Buffered(), msg)
+			return
+		}
+		if msg.Config != nil {
+			l.applyConfig(ctx, conn, *msg.Config)
+			return
+		}
+
 		if msg.Candidate != "" {
 			c := webrtc.ICECandidateInit{
 				Candidate: msg.Candidate,
@@ -244,11 +423,12 @@ func (l *listener) negotiate(ctx context.Context, conn net.Conn) {
 					return
 				}
 				turnProxy = &turnProxyDialer{
-					baseURL: u,
-					token:   l.turnProxyAuthToken,
+					baseURL:    u,
+					token:      l.turnProxyAuthToken,
+					httpClient: l.httpClient,
 				}
 			}
-			rtc, err = newPeerConnection(msg.Servers, turnProxy)
+			rtc, err = newPeerConnection(msg.Servers, turnProxy, nil)
 			if err != nil {
 				closeError(err)
 				return
@@ -256,10 +436,23 @@ func (l *listener) negotiate(ctx context.Context, conn net.Conn) {
 			l.connClosersMut.Lock()
 			l.connClosers = append(l.connClosers, rtc)
 			l.connClosersMut.Unlock()
+			// State changes are handled concurrently, so the session is
+			// ended at most once, and never started again after.
+			var (
+				pc           = rtc
+				endSession   func()
+				sessionEnded bool
+				sessionMut   sync.Mutex
+			)
 			rtc.OnConnectionStateChange(func(pcs webrtc.PeerConnectionState) {
 				l.log.Info(ctx, "connection state change", slog.F("state", pcs.String()))
 				switch pcs {
 				case webrtc.PeerConnectionStateConnected:
+					sessionMut.Lock()
+					if !sessionEnded && endSession == nil {
+						endSession = l.metrics.startSession(candidateType(pc))
+					}
+					sessionMut.Unlock()
 					return
 				case webrtc.PeerConnectionStateConnecting:
 					// Safe to close the negotiating WebSocket.
@@ -267,6 +460,17 @@ func (l *listener) negotiate(ctx context.Context, conn net.Conn) {
 					return
 				}
 
+				// Dialers closing their connection don't tell the listener,
+				// which only notices it disconnected.
+				if pcs != webrtc.PeerConnectionStateNew {
+					sessionMut.Lock()
+					sessionEnded = true
+					if endSession != nil {
+						endSession()
+					}
+					sessionMut.Unlock()
+				}
+
 				// Close connections opened when RTC was alive.
 				connClosersMut.Lock()
 				defer connClosersMut.Unlock()
@@ -276,7 +480,7 @@ func (l *listener) negotiate(ctx context.Context, conn net.Conn) {
 				connClosers = make([]io.Closer, 0)
 			})
 
-			flushCandidates := proxyICECandidates(rtc, conn)
+			flushCandidates := proxyICECandidates(rtc, conn, nil)
 			rtc.OnDataChannel(l.handle(ctx, msg, &connClosers, &connClosersMut))
 
 			l.log.Debug(ctx, "set remote description", slog.F("offer", *msg.Offer))
@@ -303,6 +507,9 @@ func (l *listener) negotiate(ctx context.Context, conn net.Conn) {
 			bmsg := &BrokerMessage{
 				Answer: rtc.LocalDescription(),
 			}
+			if l.identityKey != nil {
+				bmsg.IdentityKey, bmsg.IdentitySignature = signIdentity(l.identityKey, msg.Offer.SDP, bmsg.Answer.SDP)
+			}
 			data, err := json.Marshal(bmsg)
 			if err != nil {
 				closeError(fmt.Errorf("marshal: %w", err))
@@ -395,34 +602,27 @@ func (l *listener) handle(ctx context.Context, msg BrokerMessage, connClosers *[
 				}
 			}
 
-			network, addr, err := msg.getAddress(dc.Protocol())
-			if err != nil {
-				init.Code = CodeBadAddressErr
-				init.Err = err.Error()
-				var policyErr notPermittedByPolicyErr
-				if errors.As(err, &policyErr) {
-					init.Code = CodePermissionErr
-				}
+			if dc.Protocol() == containersProtocol {
 				sendInitMessage()
+				// The dialer closes the channel once it has read the list.
+				_ = json.NewEncoder(rw).Encode(l.containerNames())
 				return
 			}
-
-			l.log.Debug(ctx, "dialing remote address", slog.F("network", network), slog.F("addr", addr))
-			nc, err := net.Dial(network, addr)
-			if err != nil {
-				l.log.Debug(ctx, "failed to dial remote address")
-				init.Code = CodeDialErr
-				init.Err = err.Error()
-				if op, ok := err.(*net.OpError); ok {
-					init.Net = op.Net
-					init.Op = op.Op
-				}
+			if strings.HasPrefix(dc.Protocol(), reverseListenNetwork+":") {
+				defer dc.Close()
+				l.listenReverse(ctx, msg, dc.Protocol(), rw)
+				return
 			}
+			var nc net.Conn
+			nc, init = l.dialProtocol(ctx, msg, dc.Protocol())
 			sendInitMessage()
 			if init.Err != "" {
 				return
 			}
 
+			nc, done := l.metrics.conn(nc)
+			defer done()
+
 			// Must wrap the data channel inside this connection
 			// for buffering from the dialed endpoint to the client.
 			l.log.Debug(ctx, "data channel initialized, tunnelling")
@@ -446,6 +646,105 @@ func (l *listener) handle(ctx context.Context, msg BrokerMessage, connClosers *[
 	}
 }
 
+// dialProtocol dials the address of a data channel or relay stream protocol,
+// such as "tcp:localhost:22". If the dial fails, the returned response
+// describes the error.
+func (l *listener) dialProtocol(ctx context.Context, msg BrokerMessage, protocol string) (net.Conn, DialChannelResponse) {
+	var init DialChannelResponse
+	if id := strings.TrimPrefix(protocol, reverseAcceptNetwork+":"); id != protocol {
+		nc := l.takeReverseConn(id)
+		if nc == nil {
+			init.Code = CodeBadAddressErr
+			init.Err = fmt.Sprintf("no accepted connection %q is waiting to be picked up", id)
+		}
+		return nc, init
+	}
+	protocol, err := l.resolveContainer(protocol)
+	if err != nil {
+		init.Code = CodeBadAddressErr
+		init.Err = err.Error()
+		return nil, init
+	}
+
+	network, addr, init := l.checkProtocol(msg, protocol)
+	if init.Err != "" {
+		return nil, init
+	}
+
+	l.log.Debug(ctx, "dialing remote address", slog.F("network", network), slog.F("addr", addr))
+	nc, err := net.Dial(network, addr)
+	if err != nil {
+		l.log.Debug(ctx, "failed to dial remote address")
+		init.Code = CodeDialErr
+		init.Err = err.Error()
+		if op, ok := err.(*net.OpError); ok {
+			init.Net = op.Net
+			init.Op = op.Op
+		}
+		return nil, init
+	}
+	return nc, init
+}
+
+// checkProtocol parses the address of a protocol and checks that the dial
+// policies of the dialer and of the deployment permit it. If not, the
+// returned response describes the error.
+func (l *listener) checkProtocol(msg BrokerMessage, protocol string) (network, addr string, init DialChannelResponse) {
+	network, addr, err := msg.getAddress(protocol)
+	if err != nil {
+		init.Code = CodeBadAddressErr
+		init.Err = err.Error()
+		var policyErr notPermittedByPolicyErr
+		if errors.As(err, &policyErr) {
+			init.Code = CodePermissionErr
+		}
+		return "", "", init
+	}
+	if err := l.permitted(protocol); err != nil {
+		init.Code = CodePermissionErr
+		init.Err = err.Error()
+		return "", "", init
+	}
+	return network, addr, init
+}
+
+// resolveContainer replaces a "container:<name>" protocol by the protocol of
+// the address registered for the container. Other protocols are returned
+// unchanged.
+func (l *listener) resolveContainer(protocol string) (string, error) {
+	name := strings.TrimPrefix(protocol, ContainerNetwork+":")
+	if name == protocol {
+		return protocol, nil
+	}
+	addr, ok := l.containers[name]
+	if !ok {
+		return "", fmt.Errorf("no container named %q, known containers: %q", name, l.containerNames())
+	}
+	if strings.HasPrefix(addr, "/") {
+		return "unix:" + addr, nil
+	}
+	return "tcp:" + addr, nil
+}
+
+// candidateType returns the type of the local ICE candidate the connection
+// uses, such as "host" or "relay".
+func candidateType(rtc *webrtc.PeerConnection) string {
+	pair, err := rtc.SCTP().Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil || pair == nil {
+		return "unknown"
+	}
+	return pair.Local.Typ.String()
+}
+
+func (l *listener) containerNames() []string {
+	names := make([]string, 0, len(l.containers))
+	for name := range l.containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Close closes the broker socket and all created RTC connections.
 func (l *listener) Close() error {
 	l.log.Info(context.Background(), "listener closed")
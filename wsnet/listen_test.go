@@ -2,12 +2,20 @@ package wsnet
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"nhooyr.io/websocket"
 )
@@ -49,3 +57,216 @@ func TestListen(t *testing.T) {
 		<-connCh
 	})
 }
+
+func TestListenReconnectPolicy(t *testing.T) {
+	t.Parallel()
+
+	var (
+		accepted = make(chan *websocket.Conn, 1)
+		dials    int32
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the first connection is accepted, as if the broker went
+		// down after it.
+		if atomic.AddInt32(&dials, 1) > 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		accepted <- ws
+	}))
+	defer s.Close()
+
+	var (
+		changes   []ListenerStateChange
+		changesMu sync.Mutex
+		gaveUp    = make(chan struct{})
+	)
+	l, err := ListenWithOptions(context.Background(), slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}), s.URL, "", &ListenOptions{
+		NextReconnect: func(attempt int) (time.Duration, bool) {
+			return time.Duration(attempt) * time.Millisecond, attempt <= 2
+		},
+		OnStateChange: func(change ListenerStateChange) {
+			changesMu.Lock()
+			defer changesMu.Unlock()
+			changes = append(changes, change)
+			if change.State == ListenerGaveUp {
+				close(gaveUp)
+			}
+		},
+	})
+	require.NoError(t, err)
+	defer l.Close()
+
+	conn := <-accepted
+	require.NoError(t, conn.Close(websocket.StatusGoingAway, ""))
+	select {
+	case <-gaveUp:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the listener to give up")
+	}
+
+	changesMu.Lock()
+	defer changesMu.Unlock()
+	var states []ListenerState
+	for _, change := range changes {
+		states = append(states, change.State)
+	}
+	assert.Equal(t, []ListenerState{
+		ListenerConnected, ListenerDisconnected, ListenerReconnecting, ListenerReconnecting, ListenerGaveUp,
+	}, states)
+	assert.Equal(t, 2, changes[3].Attempt)
+	assert.Equal(t, 2*time.Millisecond, changes[3].Wait)
+	assert.Error(t, changes[3].Err, "the failed attempt is reported")
+	assert.Contains(t, changes[4].Err.Error(), "after 2 attempts")
+	assert.EqualValues(t, 3, atomic.LoadInt32(&dials))
+}
+
+func TestListenConfig(t *testing.T) {
+	t.Parallel()
+	log := slogtest.Make(t, nil)
+
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	var (
+		pushed    []AgentConfig
+		pushedMut sync.Mutex
+	)
+	connectAddr, listenAddr := createDumbBroker(t)
+	l, err := ListenWithOptions(context.Background(), log, listenAddr, "", &ListenOptions{
+		OnConfig: func(config AgentConfig) error {
+			if config.LogLevel == "loud" {
+				return errors.New("invalid log level")
+			}
+			pushedMut.Lock()
+			defer pushedMut.Unlock()
+			pushed = append(pushed, config)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	defer l.Close()
+
+	push := func(config AgentConfig) BrokerMessage {
+		ws, _, err := websocket.Dial(context.Background(), connectAddr, nil)
+		require.NoError(t, err)
+		conn := websocket.NetConn(context.Background(), ws, websocket.MessageBinary)
+		defer conn.Close()
+		require.NoError(t, json.NewEncoder(conn).Encode(&BrokerMessage{Config: &config}))
+		var resp BrokerMessage
+		require.NoError(t, json.NewDecoder(conn).Decode(&resp))
+		return resp
+	}
+	dial := func() error {
+		dialer, err := DialWebsocket(context.Background(), connectAddr, &DialOptions{Log: &log, Relay: true}, nil)
+		require.NoError(t, err)
+		defer dialer.Close()
+		conn, err := dialer.DialContext(context.Background(), "tcp", target.Addr().String())
+		if err == nil {
+			_ = conn.Close()
+		}
+		return err
+	}
+
+	require.NoError(t, dial())
+
+	resp := push(AgentConfig{LogLevel: "loud", AllowedPorts: []DialPolicy{{Port: 22}}})
+	assert.Equal(t, "invalid log level", resp.Error)
+	require.NoError(t, dial(), "rejected configuration must not apply")
+
+	resp = push(AgentConfig{LogLevel: "info", AllowedPorts: []DialPolicy{{Port: 22}}})
+	assert.Empty(t, resp.Error)
+	pushedMut.Lock()
+	require.Len(t, pushed, 1)
+	assert.Equal(t, "info", pushed[0].LogLevel)
+	pushedMut.Unlock()
+	err = dial()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not permitted")
+
+	resp = push(AgentConfig{})
+	assert.Empty(t, resp.Error)
+	require.Error(t, dial(), "allowed ports are kept when not pushed")
+
+	resp = push(AgentConfig{AllowedPorts: []DialPolicy{}})
+	assert.Empty(t, resp.Error)
+	require.NoError(t, dial())
+}
+
+func TestListenMetrics(t *testing.T) {
+	t.Parallel()
+	log := slogtest.Make(t, nil)
+
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	for _, relay := range []bool{false, true} {
+		relay := relay
+		t.Run(fmt.Sprintf("relay=%v", relay), func(t *testing.T) {
+			metrics := &ListenerMetrics{}
+			connectAddr, listenAddr := createDumbBroker(t)
+			l, err := ListenWithOptions(context.Background(), log, listenAddr, "", &ListenOptions{Metrics: metrics})
+			require.NoError(t, err)
+			assert.True(t, metrics.Stats().Connected)
+
+			dialer, err := DialWebsocket(context.Background(), connectAddr, &DialOptions{Log: &log, Relay: relay}, nil)
+			require.NoError(t, err)
+			conn, err := dialer.DialContext(context.Background(), "tcp", target.Addr().String())
+			require.NoError(t, err)
+			_, err = conn.Write([]byte("hello"))
+			require.NoError(t, err)
+			_, err = io.ReadFull(conn, make([]byte, 5))
+			require.NoError(t, err)
+
+			stats := metrics.Stats()
+			assert.EqualValues(t, 1, stats.Sessions)
+			assert.EqualValues(t, 1, stats.ActiveSessions)
+			assert.EqualValues(t, 1, stats.ActiveConnections)
+			assert.EqualValues(t, 5, stats.BytesSent)
+			assert.EqualValues(t, 5, stats.BytesReceived)
+			if relay {
+				assert.Equal(t, map[string]int{RelayedCandidateType: 1}, stats.CandidateTypes)
+			} else {
+				assert.Equal(t, map[string]int{"host": 1}, stats.CandidateTypes)
+			}
+
+			require.NoError(t, conn.Close())
+			require.Eventually(t, func() bool {
+				return metrics.Stats().ActiveConnections == 0
+			}, 5*time.Second, 10*time.Millisecond)
+			_ = dialer.Close()
+			require.NoError(t, l.Close())
+			require.Eventually(t, func() bool {
+				return metrics.Stats().ActiveSessions == 0
+			}, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+}
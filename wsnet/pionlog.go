@@ -0,0 +1,46 @@
+package wsnet
+
+import (
+	"context"
+	"fmt"
+
+	"cdr.dev/slog"
+	"github.com/pion/logging"
+)
+
+// pionLoggerFactory routes the logs of the WebRTC stack to a slog.Logger.
+// Trace and debug logs are both logged at the debug level.
+type pionLoggerFactory struct {
+	log slog.Logger
+}
+
+func (f pionLoggerFactory) NewLogger(scope string) logging.LeveledLogger {
+	return pionLogger{log: f.log.Named(scope)}
+}
+
+type pionLogger struct {
+	log slog.Logger
+}
+
+var _ logging.LeveledLogger = pionLogger{}
+
+func (l pionLogger) Trace(msg string) { l.log.Debug(context.Background(), msg) }
+func (l pionLogger) Tracef(format string, args ...interface{}) {
+	l.Trace(fmt.Sprintf(format, args...))
+}
+func (l pionLogger) Debug(msg string) { l.log.Debug(context.Background(), msg) }
+func (l pionLogger) Debugf(format string, args ...interface{}) {
+	l.Debug(fmt.Sprintf(format, args...))
+}
+func (l pionLogger) Info(msg string) { l.log.Info(context.Background(), msg) }
+func (l pionLogger) Infof(format string, args ...interface{}) {
+	l.Info(fmt.Sprintf(format, args...))
+}
+func (l pionLogger) Warn(msg string) { l.log.Warn(context.Background(), msg) }
+func (l pionLogger) Warnf(format string, args ...interface{}) {
+	l.Warn(fmt.Sprintf(format, args...))
+}
+func (l pionLogger) Error(msg string) { l.log.Error(context.Background(), msg) }
+func (l pionLogger) Errorf(format string, args ...interface{}) {
+	l.Error(fmt.Sprintf(format, args...))
+}
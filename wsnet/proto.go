@@ -17,9 +17,11 @@ type DialPolicy struct {
 	Network string `json:"network"`
 	// Host is the IP or hostname of the address. It should not contain the
 	// port.If empty, it applies to all hosts. "localhost", [::1], and any IPv4
-	// address under "127.0.0.0/8" can be used interchangeably.
+	// address under "127.0.0.0/8" can be used interchangeably. For the "unix"
+	// network, Host is the socket path.
 	Host string `json:"address"`
-	// If port is 0, it applies to all ports.
+	// If port is 0, it applies to all ports. Unix sockets have no port, so
+	// only policies with port 0 apply to them.
 	Port uint16 `json:"port"`
 }
 
@@ -47,6 +49,10 @@ func (p DialPolicy) permits(network, host string, port uint16) bool {
 //
 // The listener should respond with an offer, then both
 // sides can begin exchanging candidates.
+//
+// Alternatively, dialers set Relay to carry connections over
+// the broker itself. The listener acknowledges with Relay set,
+// see relay.go.
 type BrokerMessage struct {
 	// Dialer -> Listener
 	Offer        *webrtc.SessionDescription `json:"offer"`
@@ -60,9 +66,18 @@ type BrokerMessage struct {
 	// Listener -> Dialer
 	Error  string                     `json:"error"`
 	Answer *webrtc.SessionDescription `json:"answer"`
+	// IdentityKey and IdentitySignature are sent with the Answer by
+	// listeners with an identity key, see identity.go.
+	IdentityKey       []byte `json:"identity_key,omitempty"`
+	IdentitySignature []byte `json:"identity_signature,omitempty"`
 
 	// Bidirectional
 	Candidate string `json:"candidate"`
+	Relay     bool   `json:"relay,omitempty"`
+
+	// Broker -> Listener
+	// Config is pushed on a stream of its own, see AgentConfig.
+	Config *AgentConfig `json:"config,omitempty"`
 }
 
 // getAddress parses the data channel's protocol into an address suitable for
@@ -73,6 +88,9 @@ func (msg BrokerMessage) getAddress(protocol string) (netwk, addr string, err er
 	if len(parts) != 2 {
 		return "", "", fmt.Errorf("invalid dial address: %v", protocol)
 	}
+	if parts[0] == "unix" {
+		return msg.getUnixAddress(protocol, parts[1])
+	}
 	host, port, err := net.SplitHostPort(parts[1])
 	if err != nil {
 		return "", "", fmt.Errorf("invalid dial address: %v", protocol)
@@ -109,6 +127,24 @@ func (msg BrokerMessage) getAddress(protocol string) (netwk, addr string, err er
 	return "", "", fmt.Errorf("connections are not permitted to %q by policy", protocol)
 }
 
+// getUnixAddress verifies that the BrokerMessage permits connecting to the
+// unix socket at path.
+func (msg BrokerMessage) getUnixAddress(protocol, path string) (netwk, addr string, err error) {
+	if !strings.HasPrefix(path, "/") {
+		return "", "", fmt.Errorf("invalid dial address %q path: must be absolute", protocol)
+	}
+	if len(msg.Policies) == 0 {
+		return "unix", path, nil
+	}
+	for _, p := range msg.Policies {
+		if p.permits("unix", path, 0) {
+			return "unix", path, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("connections are not permitted to %q by policy", protocol)
+}
+
 // canonicalizeHost converts all representations of "localhost" to "localhost".
 func canonicalizeHost(addr string) string {
 	addr = strings.TrimPrefix(addr, "[")
@@ -219,6 +219,29 @@ func Test_BrokerMessage(t *testing.T) {
 				}
 			}
 		})
+
+		t.Run("Unix", func(t *testing.T) {
+			const path = "/var/run/docker.sock"
+			protocol := formatAddress("unix", path)
+
+			var msg BrokerMessage
+			gotNetwork, gotAddr, err := msg.getAddress(protocol)
+			assert.Success(t, "got address", err)
+			assert.Equal(t, "networks equal", "unix", gotNetwork)
+			assert.Equal(t, "addresses equal", path, gotAddr)
+
+			_, _, err = msg.getAddress(formatAddress("unix", "docker.sock"))
+			assert.ErrorContains(t, "relative path", err, "absolute")
+
+			msg.Policies = []DialPolicy{dialPolicy("tcp", "localhost", 0), dialPolicy("unix", "/tmp/other.sock", 0)}
+			_, _, err = msg.getAddress(protocol)
+			assert.ErrorContains(t, "not permitted", err, "not permitted")
+
+			msg.Policies = append(msg.Policies, dialPolicy("unix", path, 0))
+			_, gotAddr, err = msg.getAddress(protocol)
+			assert.Success(t, "permitted by policy", err)
+			assert.Equal(t, "addresses equal", path, gotAddr)
+		})
 	})
 }
 
@@ -0,0 +1,321 @@
+package wsnet
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"cdr.dev/slog"
+	"github.com/hashicorp/yamux"
+)
+
+// Relaying carries connections over the broker WebSocket instead of WebRTC,
+// for networks that block WebRTC entirely, including TURN. It's much slower,
+// since every byte goes through the broker.
+//
+// The dialer sends a BrokerMessage with Relay set, and the listener answers
+// with the same. Both sides then run a yamux session over the broker
+// connection. Each stream starts with the protocol to dial as a JSON string,
+// such as "tcp:localhost:22", which the listener answers with a
+// DialChannelResponse before proxying.
+//
+// Streams are ordered bytes, unlike the unordered data channels of udp dials
+// which carry a datagram per message, so the datagrams of udp streams are
+// framed with their length, see datagramConn.
+
+// relayAcceptTimeout is how long the dialer waits for the listener to accept
+// relaying. Listeners that don't support it never answer.
+var relayAcceptTimeout = 15 * time.Second
+
+func relayConfig() *yamux.Config {
+	config := yamux.DefaultConfig()
+	config.LogOutput = io.Discard
+	return config
+}
+
+// relayConn is a net.Conn whose reads start with data that was buffered
+// while decoding the messages that preceded it.
+type relayConn struct {
+	net.Conn
+	r    io.Reader
+	addr net.Addr
+}
+
+func (c *relayConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *relayConn) RemoteAddr() net.Addr {
+	if c.addr != nil {
+		return c.addr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// datagramConn carries datagrams over a relayed stream, each prefixed with
+// its length as a big-endian uint16.
+type datagramConn struct {
+	net.Conn
+}
+
+// Read reads a datagram. Like a datagram socket, the part of it that doesn't
+// fit in b is discarded.
+func (c *datagramConn) Read(b []byte) (int, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(c.Conn, size[:]); err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint16(size[:]))
+	if n <= len(b) {
+		return io.ReadFull(c.Conn, b[:n])
+	}
+	if _, err := io.ReadFull(c.Conn, b); err != nil {
+		return 0, err
+	}
+	_, err := io.CopyN(io.Discard, c.Conn, int64(n-len(b)))
+	return len(b), err
+}
+
+// Write writes b as a single datagram.
+func (c *datagramConn) Write(b []byte) (int, error) {
+	if len(b) > maxMessageLength {
+		return 0, fmt.Errorf("outbound packet larger than maximum message size: %d", maxMessageLength)
+	}
+	frame := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(frame, uint16(len(b)))
+	copy(frame[2:], b)
+	if _, err := c.Conn.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// dialRelay asks the listener to relay connections over conn.
+func dialRelay(ctx context.Context, conn net.Conn, options *DialOptions) (*Dialer, error) {
+	log := *options.Log
+	trace := options.Trace
+	// Every relayed byte goes through conn, so counting it gives the Stats.
+	conn = &countingConn{Conn: conn}
+
+	req, err := json.Marshal(&BrokerMessage{Relay: true})
+	if err != nil {
+		return nil, fmt.Errorf("marshal relay message: %w", err)
+	}
+	log.Debug(ctx, "requesting relay")
+	trace.event("relay_request", nil)
+	_, err = conn.Write(req)
+	if err != nil {
+		return nil, fmt.Errorf("write relay message: %w", err)
+	}
+
+	decoder := json.NewDecoder(conn)
+	errCh := make(chan error, 1)
+	go func() {
+		var msg BrokerMessage
+		err := decoder.Decode(&msg)
+		switch {
+		case err != nil:
+			errCh <- fmt.Errorf("read relay answer: %w", err)
+		case msg.Error != "":
+			trace.event("peer_error", map[string]interface{}{"error": msg.Error})
+			errCh <- fmt.Errorf("error from peer: %v", msg.Error)
+		case !msg.Relay:
+			errCh <- fmt.Errorf("unhandled message: %+v", msg)
+		default:
+			errCh <- nil
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, relayAcceptTimeout)
+	defer cancel()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		_ = conn.Close()
+		return nil, fmt.Errorf("the listener did not accept relaying, it may be too old: %w", ctx.Err())
+	}
+
+	session, err := yamux.Client(&relayConn{Conn: conn, r: io.MultiReader(decoder.Buffered(), conn)}, relayConfig())
+	if err != nil {
+		return nil, fmt.Errorf("create multiplex: %w", err)
+	}
+	log.Debug(ctx, "relaying connections over the broker")
+	trace.event("connected", map[string]interface{}{"relay": true})
+
+	dialer := &Dialer{
+		log:    log,
+		trace:  trace,
+		conn:   conn,
+		relay:  session,
+		closed: make(chan struct{}),
+	}
+	go dialer.keepAlive(options.KeepAlive)
+	return dialer, nil
+}
+
+// dialRelayed opens a relayed stream to the address.
+func (d *Dialer) dialRelayed(ctx context.Context, network, address string) (net.Conn, error) {
+	proto := fmt.Sprintf("%s:%s", network, address)
+	ctx = slog.With(ctx, slog.F("proto", proto))
+
+	d.log.Debug(ctx, "opening relay stream")
+	stream, err := d.relay.OpenStream()
+	if err != nil {
+		return nil, fmt.Errorf("open relay stream: %w", err)
+	}
+	d.trace.event("channel_open", map[string]interface{}{"proto": proto, "relay": true})
+
+	// Messages are written without the trailing newline of json.Encoder,
+	// which would otherwise be proxied as data.
+	req, err := json.Marshal(proto)
+	if err == nil {
+		_, err = stream.Write(req)
+	}
+	if err != nil {
+		_ = stream.Close()
+		return nil, fmt.Errorf("write dial request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	decoder := json.NewDecoder(stream)
+	errCh := make(chan error, 1)
+	go func() {
+		var res DialChannelResponse
+		err := decoder.Decode(&res)
+		if err != nil {
+			errCh <- fmt.Errorf("read dial response: %w", err)
+			return
+		}
+		d.log.Debug(ctx, "dial response", slog.F("res", res))
+		if res.Err != "" {
+			d.trace.event("channel_dial_failed", map[string]interface{}{"proto": proto, "code": res.Code, "error": res.Err})
+		}
+		errCh <- res.err()
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			_ = stream.Close()
+			return nil, err
+		}
+	case <-ctx.Done():
+		_ = stream.Close()
+		return nil, ctx.Err()
+	}
+
+	var conn net.Conn = &relayConn{
+		Conn: stream,
+		r:    io.MultiReader(decoder.Buffered(), stream),
+		addr: &net.UnixAddr{
+			Name: address,
+			Net:  network,
+		},
+	}
+	if network == "udp" {
+		conn = &datagramConn{Conn: conn}
+	}
+	return conn, nil
+}
+
+// relay serves the dialer's relayed streams over conn. buffered holds what
+// was read from conn past the relay message.
+func (l *listener) relay(ctx context.Context, conn net.Conn, buffered io.Reader, msg BrokerMessage) {
+	l.log.Info(ctx, "relaying connections over the broker")
+	ack, err := json.Marshal(&BrokerMessage{Relay: true})
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	_, err = conn.Write(ack)
+	if err != nil {
+		l.log.Warn(ctx, "failed to accept relay", slog.Error(err))
+		_ = conn.Close()
+		return
+	}
+
+	session, err := yamux.Server(&relayConn{Conn: conn, r: io.MultiReader(buffered, conn)}, relayConfig())
+	if err != nil {
+		l.log.Warn(ctx, "failed to create relay multiplex", slog.Error(err))
+		_ = conn.Close()
+		return
+	}
+	defer session.Close()
+	l.connClosersMut.Lock()
+	l.connClosers = append(l.connClosers, session)
+	l.connClosersMut.Unlock()
+	defer l.metrics.startSession(RelayedCandidateType)()
+
+	for {
+		stream, err := session.Accept()
+		if err != nil {
+			l.log.Debug(ctx, "relay closed", slog.Error(err))
+			return
+		}
+		go l.relayStream(ctx, msg, stream)
+	}
+}
+
+func (l *listener) relayStream(ctx context.Context, msg BrokerMessage, stream net.Conn) {
+	defer stream.Close()
+
+	decoder := json.NewDecoder(stream)
+	var proto string
+	err := decoder.Decode(&proto)
+	if err != nil {
+		l.log.Debug(ctx, "failed to read relay dial request", slog.Error(err))
+		return
+	}
+	ctx = slog.With(ctx, slog.F("relay_proto", proto))
+	write := func(v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = stream.Write(data)
+		return err
+	}
+
+	if proto == containersProtocol {
+		_ = write(&DialChannelResponse{})
+		_ = write(l.containerNames())
+		return
+	}
+	if strings.HasPrefix(proto, reverseListenNetwork+":") {
+		l.listenReverse(ctx, msg, proto, &relayConn{Conn: stream, r: io.MultiReader(decoder.Buffered(), stream)})
+		return
+	}
+
+	nc, init := l.dialProtocol(ctx, msg, proto)
+	err = write(&init)
+	if err != nil || init.Err != "" {
+		if nc != nil {
+			_ = nc.Close()
+		}
+		return
+	}
+	defer nc.Close()
+	nc, done := l.metrics.conn(nc)
+	defer done()
+
+	l.log.Debug(ctx, "relay stream initialized, tunnelling")
+	var conn net.Conn = &relayConn{Conn: stream, r: io.MultiReader(decoder.Buffered(), stream)}
+	if strings.HasPrefix(proto, "udp:") {
+		conn = &datagramConn{Conn: conn}
+	}
+	go func() {
+		defer stream.Close()
+		_, _ = io.Copy(conn, nc)
+	}()
+	_, _ = io.Copy(nc, conn)
+}
@@ -0,0 +1,269 @@
+package wsnet
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"cdr.dev/slog"
+)
+
+// Reverse listening exposes a port of the dialer's machine inside the
+// workspace, such as a local license server or database.
+//
+// The dialer opens a channel whose protocol is "listen:" followed by the
+// protocol to listen on, such as "listen:tcp:localhost:5432". The listener
+// answers with a DialChannelResponse, then writes a reverseAccept for every
+// connection it accepts, until the dialer closes the channel. The dialer
+// picks each connection up by opening a channel whose protocol is "accept:"
+// followed by its ID, which the listener proxies like a dialed address.
+//
+// Listeners only listen on loopback addresses and unix sockets, so that the
+// dialer's port isn't exposed beyond the workspace, and apply the dial
+// policies to them too.
+
+const (
+	reverseListenNetwork = "listen"
+	reverseAcceptNetwork = "accept"
+)
+
+// reverseAcceptTimeout is how long a connection accepted by a reverse
+// listener waits for the dialer to pick it up before it's closed.
+var reverseAcceptTimeout = 10 * time.Second
+
+// reverseAccept announces a connection accepted by a reverse listener.
+type reverseAccept struct {
+	ID string `json:"id"`
+}
+
+// Listen asks the listener to listen on the network and address inside the
+// workspace, and returns a net.Listener accepting the connections made to
+// it. The network is "tcp" with an address on a loopback interface, such as
+// "localhost:5432", or "unix" with the absolute path of a socket.
+//
+// Closing the net.Listener stops listening in the workspace. It's closed
+// with the Dialer too.
+func (d *Dialer) Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return nil, fmt.Errorf("listen on %q: only tcp and unix are supported", network)
+	}
+	ctrl, err := d.DialContext(ctx, reverseListenNetwork, network+":"+address)
+	if err != nil {
+		// Listeners that predate reverse listening reject the protocol as
+		// an invalid address.
+		if strings.HasPrefix(err.Error(), "invalid dial address") {
+			return nil, fmt.Errorf("listen, the agent may not support reverse tunnels: %w", err)
+		}
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	l := &reverseListener{
+		dialer: d,
+		ctrl:   ctrl,
+		addr: &net.UnixAddr{
+			Name: address,
+			Net:  network,
+		},
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+// reverseListener is the dialer's end of a reverse listener.
+type reverseListener struct {
+	dialer *Dialer
+	ctrl   net.Conn
+	addr   net.Addr
+	conns  chan net.Conn
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	// err is why the listener closed, set before closed is.
+	err error
+}
+
+// run picks up the connections the listener announces until the channel
+// closes.
+func (l *reverseListener) run() {
+	decoder := json.NewDecoder(l.ctrl)
+	for {
+		var msg reverseAccept
+		err := decoder.Decode(&msg)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("the workspace stopped listening")
+			}
+			l.close(fmt.Errorf("read accepted connection: %w", err))
+			return
+		}
+		go l.pickUp(msg.ID)
+	}
+}
+
+func (l *reverseListener) pickUp(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), reverseAcceptTimeout)
+	defer cancel()
+	conn, err := l.dialer.DialContext(ctx, reverseAcceptNetwork, id)
+	if err != nil {
+		l.dialer.log.Warn(ctx, "failed to pick up an accepted connection", slog.F("addr", l.addr), slog.Error(err))
+		return
+	}
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		_ = conn.Close()
+	}
+}
+
+func (l *reverseListener) close(err error) {
+	l.closeOnce.Do(func() {
+		l.err = err
+		close(l.closed)
+		_ = l.ctrl.Close()
+	})
+}
+
+// Accept waits for the next connection made to the address in the
+// workspace.
+func (l *reverseListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, l.err
+	}
+}
+
+// Close stops listening in the workspace.
+func (l *reverseListener) Close() error {
+	l.close(errors.New("listener closed"))
+	return nil
+}
+
+// Addr returns the address listened on in the workspace.
+func (l *reverseListener) Addr() net.Addr {
+	return l.addr
+}
+
+// listenReverse serves the "listen:" channel of a dialer over rw: it listens
+// on the protocol, answers with a DialChannelResponse and announces every
+// accepted connection, until the dialer closes rw.
+func (l *listener) listenReverse(ctx context.Context, msg BrokerMessage, protocol string, rw io.ReadWriteCloser) {
+	defer rw.Close()
+	write := func(v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = rw.Write(data)
+		return err
+	}
+
+	ln, init := l.listenProtocol(ctx, msg, strings.TrimPrefix(protocol, reverseListenNetwork+":"))
+	err := write(&init)
+	if err != nil || init.Err != "" {
+		if ln != nil {
+			_ = ln.Close()
+		}
+		return
+	}
+	defer ln.Close()
+	l.log.Info(ctx, "listening for the dialer", slog.F("addr", ln.Addr()))
+
+	go func() {
+		// The dialer closes the channel to stop listening.
+		_, _ = io.Copy(io.Discard, rw)
+		_ = ln.Close()
+	}()
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			l.log.Info(ctx, "stopped listening for the dialer", slog.Error(err))
+			return
+		}
+		id := l.addReverseConn(nc)
+		l.log.Debug(ctx, "accepted a connection for the dialer", slog.F("id", id), slog.F("remote_addr", nc.RemoteAddr()))
+		if err := write(&reverseAccept{ID: id}); err != nil {
+			l.log.Debug(ctx, "failed to announce an accepted connection", slog.Error(err))
+			return
+		}
+	}
+}
+
+// listenProtocol listens on the address of a protocol, such as
+// "tcp:localhost:5432". If listening fails, the returned response describes
+// the error.
+func (l *listener) listenProtocol(ctx context.Context, msg BrokerMessage, protocol string) (net.Listener, DialChannelResponse) {
+	network, addr, init := l.checkProtocol(msg, protocol)
+	if init.Err != "" {
+		return nil, init
+	}
+	if network != "unix" {
+		host, _, _ := net.SplitHostPort(addr)
+		if canonicalizeHost(host) != "localhost" {
+			init.Code = CodePermissionErr
+			init.Err = fmt.Sprintf("reverse tunnels only listen on loopback addresses, not %q", host)
+			return nil, init
+		}
+	}
+
+	l.log.Debug(ctx, "listening on address", slog.F("network", network), slog.F("addr", addr))
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		init.Code = CodeDialErr
+		init.Err = err.Error()
+		if op, ok := err.(*net.OpError); ok {
+			init.Net = op.Net
+			init.Op = op.Op
+		}
+		return nil, init
+	}
+	return ln, init
+}
+
+// addReverseConn holds a connection accepted by a reverse listener until the
+// dialer picks it up, and returns its ID.
+func (l *listener) addReverseConn(nc net.Conn) string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	id := hex.EncodeToString(b[:])
+
+	l.reverseConnsMut.Lock()
+	if l.reverseConns == nil {
+		l.reverseConns = make(map[string]net.Conn)
+	}
+	l.reverseConns[id] = nc
+	l.reverseConnsMut.Unlock()
+
+	time.AfterFunc(reverseAcceptTimeout, func() {
+		if nc := l.takeReverseConn(id); nc != nil {
+			_ = nc.Close()
+		}
+	})
+	return id
+}
+
+// takeReverseConn returns the accepted connection with the ID, or nil if
+// there's none waiting.
+func (l *listener) takeReverseConn(id string) net.Conn {
+	l.reverseConnsMut.Lock()
+	defer l.reverseConnsMut.Unlock()
+	nc, ok := l.reverseConns[id]
+	if !ok {
+		return nil
+	}
+	delete(l.reverseConns, id)
+	return nc
+}
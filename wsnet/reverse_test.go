@@ -0,0 +1,76 @@
+package wsnet
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseListen(t *testing.T) {
+	t.Parallel()
+	log := slogtest.Make(t, nil)
+
+	connectAddr, listenAddr := createDumbBroker(t)
+	l, err := Listen(context.Background(), log, listenAddr, "")
+	require.NoError(t, err)
+	defer l.Close()
+
+	for _, relay := range []bool{false, true} {
+		dialer, err := DialWebsocket(context.Background(), connectAddr, &DialOptions{
+			Log:   &log,
+			Relay: relay,
+		}, nil)
+		require.NoError(t, err)
+
+		_, err = dialer.Listen(context.Background(), "tcp", "0.0.0.0:0")
+		assert.Error(t, err, "only loopback addresses, relay: %v", relay)
+
+		path := filepath.Join(t.TempDir(), "reverse.sock")
+		ln, err := dialer.Listen(context.Background(), "unix", path)
+		require.NoError(t, err)
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					b := make([]byte, 5)
+					if _, err := conn.Read(b); err == nil {
+						_, _ = conn.Write(append([]byte("local "), b...))
+					}
+				}()
+			}
+		}()
+
+		// Connections made in the workspace reach the dialer's machine.
+		for i := 0; i < 2; i++ {
+			conn, err := net.Dial("unix", path)
+			require.NoError(t, err)
+			_, err = conn.Write([]byte("hello"))
+			require.NoError(t, err)
+			b, err := ioutil.ReadAll(conn)
+			require.NoError(t, err)
+			assert.Equal(t, "local hello", string(b), "relay: %v", relay)
+			_ = conn.Close()
+		}
+
+		require.NoError(t, ln.Close())
+		assert.Eventually(t, func() bool {
+			conn, err := net.Dial("unix", path)
+			if err == nil {
+				_ = conn.Close()
+			}
+			return err != nil
+		}, 5*time.Second, 10*time.Millisecond, "closing stops listening, relay: %v", relay)
+		_ = dialer.Close()
+	}
+}
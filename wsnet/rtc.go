@@ -8,10 +8,12 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"cdr.dev/slog"
 	"github.com/pion/dtls/v2"
 	"github.com/pion/ice/v2"
 	"github.com/pion/logging"
@@ -61,33 +63,35 @@ func dialICEURL(server webrtc.ICEServer, rawURL string, options *DialICEOptions)
 	if err != nil {
 		return err
 	}
+	// Servers are reached over whichever address family works, racing IPv6
+	// against IPv4 for TCP, so they can be checked from IPv6-only networks.
 	var (
 		tcpConn        net.Conn
 		udpConn        net.PacketConn
-		turnServerAddr = fmt.Sprintf("%s:%d", url.Host, url.Port)
+		turnServerAddr = iceServerAddr(url)
 	)
 	switch {
 	case url.Scheme == ice.SchemeTypeTURN || url.Scheme == ice.SchemeTypeSTUN:
 		switch url.Proto {
 		case ice.ProtoTypeUDP:
-			udpConn, err = net.ListenPacket("udp4", "0.0.0.0:0")
+			udpConn, err = net.ListenPacket("udp", ":0")
 		case ice.ProtoTypeTCP:
-			tcpConn, err = net.Dial("tcp4", turnServerAddr)
+			tcpConn, err = net.Dial("tcp", turnServerAddr)
 		}
 	case url.Scheme == ice.SchemeTypeTURNS || url.Scheme == ice.SchemeTypeSTUNS:
 		switch url.Proto {
 		case ice.ProtoTypeUDP:
-			udpAddr, resErr := net.ResolveUDPAddr("udp4", turnServerAddr)
+			udpAddr, resErr := net.ResolveUDPAddr("udp", turnServerAddr)
 			if resErr != nil {
 				return resErr
 			}
-			dconn, dialErr := dtls.Dial("udp4", udpAddr, &dtls.Config{
+			dconn, dialErr := dtls.Dial("udp", udpAddr, &dtls.Config{
 				InsecureSkipVerify: options.InsecureSkipVerify,
 			})
 			err = dialErr
 			udpConn = turn.NewSTUNConn(dconn)
 		case ice.ProtoTypeTCP:
-			tcpConn, err = tls.Dial("tcp4", turnServerAddr, &tls.Config{
+			tcpConn, err = tls.Dial("tcp", turnServerAddr, &tls.Config{
 				InsecureSkipVerify: options.InsecureSkipVerify,
 			})
 		}
@@ -154,18 +158,33 @@ func dialICEURL(server webrtc.ICEServer, rawURL string, options *DialICEOptions)
 	return nil
 }
 
+// iceServerAddr returns the host:port address of the ICE server, bracketing
+// IPv6 literals such as the one of "stun:[2001:db8::1]:3478".
+func iceServerAddr(url *ice.URL) string {
+	return net.JoinHostPort(url.Host, strconv.Itoa(url.Port))
+}
+
 // Generalizes creating a new peer connection with consistent options.
-func newPeerConnection(servers []webrtc.ICEServer, dialer proxy.Dialer) (*webrtc.PeerConnection, error) {
+// If iceLog is non-nil, it receives the logs of the ICE agent and the rest of the WebRTC stack.
+func newPeerConnection(servers []webrtc.ICEServer, dialer proxy.Dialer, iceLog *slog.Logger) (*webrtc.PeerConnection, error) {
 	se := webrtc.SettingEngine{}
-	se.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	// Candidates of both address families are gathered, so peers on
+	// IPv6-only networks connect directly instead of over TURN. ICE checks
+	// the pairs of both families at once, like happy eyeballs, so a family
+	// that's broken on a dual-stack network doesn't hold up connecting.
+	se.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4, webrtc.NetworkTypeUDP6})
 	se.SetSrflxAcceptanceMinWait(0)
 	se.DetachDataChannels()
 	// If the disconnect and keep-alive timeouts are too closely related, we'll
 	// experience "random" connection failures.
 	se.SetICETimeouts(time.Second*5, time.Second*25, time.Second*2)
-	lf := logging.NewDefaultLoggerFactory()
-	lf.DefaultLogLevel = logging.LogLevelDisabled
-	se.LoggerFactory = lf
+	if iceLog != nil {
+		se.LoggerFactory = pionLoggerFactory{log: *iceLog}
+	} else {
+		lf := logging.NewDefaultLoggerFactory()
+		lf.DefaultLogLevel = logging.LogLevelDisabled
+		se.LoggerFactory = lf
+	}
 
 	// Enables tunneling of TURN traffic through an arbitrary proxy.
 	// We proxy TURN over a WebSocket to reduce deployment complexity.
@@ -201,12 +220,13 @@ func newPeerConnection(servers []webrtc.ICEServer, dialer proxy.Dialer) (*webrtc
 }
 
 // Proxies ICE candidates using the protocol to a writer.
-func proxyICECandidates(conn *webrtc.PeerConnection, w io.Writer) func() {
+func proxyICECandidates(conn *webrtc.PeerConnection, w io.Writer, trace *Tracer) func() {
 	var (
 		mut     sync.Mutex
 		queue   = []*webrtc.ICECandidate{}
 		flushed = false
 		write   = func(i *webrtc.ICECandidate) {
+			trace.candidate("local_candidate", i.ToJSON().Candidate)
 			b, _ := json.Marshal(&BrokerMessage{
 				Candidate: i.ToJSON().Candidate,
 			})
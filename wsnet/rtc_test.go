@@ -81,3 +81,22 @@ func TestDialICE(t *testing.T) {
 		}
 	})
 }
+
+func TestICEServerAddr(t *testing.T) {
+	t.Parallel()
+
+	for rawURL, want := range map[string]string{
+		"stun:stun.l.google.com:19302":           "stun.l.google.com:19302",
+		"turn:203.0.113.7:3478?transport=tcp":    "203.0.113.7:3478",
+		"stun:[2001:db8::1]:3478":                "[2001:db8::1]:3478",
+		"turns:[2001:db8::1]:5349?transport=tcp": "[2001:db8::1]:5349",
+	} {
+		url, err := ice.ParseURL(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := iceServerAddr(url); got != want {
+			t.Errorf("iceServerAddr(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
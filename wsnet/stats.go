@@ -0,0 +1,219 @@
+package wsnet
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Stats describes the connection of a Dialer.
+type Stats struct {
+	// Relayed reports whether connections are relayed over the broker
+	// instead of WebRTC.
+	Relayed bool
+	// ActiveConnections is the number of connections opened with
+	// DialContext that are still open.
+	ActiveConnections int
+	// BytesSent and BytesReceived count the bytes carried for all
+	// connections, including protocol overhead.
+	BytesSent     uint64
+	BytesReceived uint64
+	// CandidatePair is the ICE candidate pair the connection uses, such as
+	// "udp4 host 10.0.0.2:51234 <-> udp4 srflx 203.0.113.7:3478", or a
+	// udp6 pair on IPv6 networks. It's empty when relayed.
+	CandidatePair string
+}
+
+// Stats returns the current statistics of the connection.
+func (d *Dialer) Stats() Stats {
+	stats := Stats{
+		Relayed:           d.relay != nil,
+		ActiveConnections: d.activeConnections(),
+	}
+	if d.relay != nil {
+		if c, ok := d.conn.(*countingConn); ok {
+			stats.BytesSent = atomic.LoadUint64(&c.sent)
+			stats.BytesReceived = atomic.LoadUint64(&c.received)
+		}
+		return stats
+	}
+
+	if transport, ok := d.rtc.GetStats()["iceTransport"].(webrtc.TransportStats); ok {
+		stats.BytesSent = transport.BytesSent
+		stats.BytesReceived = transport.BytesReceived
+	}
+	if pair, err := d.Candidates(); err == nil && pair != nil {
+		stats.CandidatePair = pair.String()
+	}
+	return stats
+}
+
+// countingConn counts the bytes read from and written to a net.Conn.
+type countingConn struct {
+	// The counters come first to be 64-bit aligned for atomic access.
+	sent     uint64
+	received uint64
+	net.Conn
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.received, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.sent, uint64(n))
+	return n, err
+}
+
+// ListenerMetrics counts the activity of a listener, see
+// ListenOptions.Metrics. Its zero value is ready to use, and its methods are
+// safe to call concurrently and on a nil *ListenerMetrics.
+type ListenerMetrics struct {
+	// The counters come first to be 64-bit aligned for atomic access.
+	reconnects        uint64
+	sessions          uint64
+	bytesSent         uint64
+	bytesReceived     uint64
+	activeSessions    int64
+	activeConnections int64
+	connected         int32
+
+	mut sync.Mutex
+	// candidateTypes counts the active sessions by how they're connected.
+	candidateTypes map[string]int
+}
+
+// ListenerStats describes the activity of a listener.
+type ListenerStats struct {
+	// Connected reports whether the listener is connected to the broker.
+	Connected bool `json:"connected"`
+	// Reconnects counts the times the listener reconnected to the broker
+	// after losing its connection.
+	Reconnects uint64 `json:"reconnects"`
+	// Sessions counts the dialers that connected, and ActiveSessions is the
+	// number of them still connected.
+	Sessions       uint64 `json:"sessions"`
+	ActiveSessions int64  `json:"active_sessions"`
+	// ActiveConnections is the number of connections dialers have open.
+	ActiveConnections int64 `json:"active_connections"`
+	// BytesSent and BytesReceived count the bytes carried to and from
+	// dialers over their connections.
+	BytesSent     uint64 `json:"bytes_sent"`
+	BytesReceived uint64 `json:"bytes_received"`
+	// CandidateTypes counts the active sessions by the type of the local ICE
+	// candidate they use, such as "host", "srflx" or "relay", or by
+	// RelayedCandidateType when they're relayed over the broker.
+	CandidateTypes map[string]int `json:"candidate_types"`
+}
+
+// RelayedCandidateType is the candidate type of ListenerStats.CandidateTypes
+// for sessions relayed over the broker.
+const RelayedCandidateType = "broker"
+
+// Stats returns the current activity of the listener.
+func (m *ListenerMetrics) Stats() ListenerStats {
+	stats := ListenerStats{CandidateTypes: map[string]int{}}
+	if m == nil {
+		return stats
+	}
+	stats.Connected = atomic.LoadInt32(&m.connected) == 1
+	stats.Reconnects = atomic.LoadUint64(&m.reconnects)
+	stats.Sessions = atomic.LoadUint64(&m.sessions)
+	stats.ActiveSessions = atomic.LoadInt64(&m.activeSessions)
+	stats.ActiveConnections = atomic.LoadInt64(&m.activeConnections)
+	stats.BytesSent = atomic.LoadUint64(&m.bytesSent)
+	stats.BytesReceived = atomic.LoadUint64(&m.bytesReceived)
+	m.mut.Lock()
+	for typ, n := range m.candidateTypes {
+		stats.CandidateTypes[typ] = n
+	}
+	m.mut.Unlock()
+	return stats
+}
+
+// setConnected records whether the listener is connected to the broker.
+func (m *ListenerMetrics) setConnected(connected bool) {
+	if m == nil {
+		return
+	}
+	var v int32
+	if connected {
+		v = 1
+	}
+	atomic.StoreInt32(&m.connected, v)
+}
+
+func (m *ListenerMetrics) reconnected() {
+	if m == nil {
+		return
+	}
+	atomic.AddUint64(&m.reconnects, 1)
+	m.setConnected(true)
+}
+
+// startSession records a dialer connecting with the candidate type, and
+// returns the func recording it leaving, which may be called more than once.
+func (m *ListenerMetrics) startSession(candidateType string) (end func()) {
+	if m == nil {
+		return func() {}
+	}
+	atomic.AddUint64(&m.sessions, 1)
+	atomic.AddInt64(&m.activeSessions, 1)
+	m.mut.Lock()
+	if m.candidateTypes == nil {
+		m.candidateTypes = make(map[string]int)
+	}
+	m.candidateTypes[candidateType]++
+	m.mut.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(&m.activeSessions, -1)
+			m.mut.Lock()
+			m.candidateTypes[candidateType]--
+			if m.candidateTypes[candidateType] <= 0 {
+				delete(m.candidateTypes, candidateType)
+			}
+			m.mut.Unlock()
+		})
+	}
+}
+
+// conn counts the connection as active until the returned func is called,
+// and the bytes carried over it: those read from nc are sent to the dialer.
+func (m *ListenerMetrics) conn(nc net.Conn) (net.Conn, func()) {
+	if m == nil {
+		return nc, func() {}
+	}
+	atomic.AddInt64(&m.activeConnections, 1)
+	var once sync.Once
+	return &meteredConn{Conn: nc, m: m}, func() {
+		once.Do(func() {
+			atomic.AddInt64(&m.activeConnections, -1)
+		})
+	}
+}
+
+// meteredConn counts the bytes carried over a connection of a listener.
+type meteredConn struct {
+	net.Conn
+	m *ListenerMetrics
+}
+
+func (c *meteredConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.m.bytesSent, uint64(n))
+	return n, err
+}
+
+func (c *meteredConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.m.bytesReceived, uint64(n))
+	return n, err
+}
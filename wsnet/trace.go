@@ -0,0 +1,154 @@
+package wsnet
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer writes the lifecycle events of a connection as JSON lines, in a
+// form suitable for attaching to support tickets. A nil *Tracer discards
+// everything.
+type Tracer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	start  time.Time
+	redact bool
+}
+
+// NewTracer returns a Tracer writing to w. If redact is true, the addresses
+// in ICE candidates and session descriptions are replaced by a description
+// of the kind of address they were. The ICE credentials are always redacted.
+func NewTracer(w io.Writer, redact bool) *Tracer {
+	return &Tracer{w: w, start: time.Now(), redact: redact}
+}
+
+// traceEvent is a single line of a trace.
+type traceEvent struct {
+	Time    time.Time              `json:"time"`
+	Elapsed string                 `json:"elapsed"`
+	Event   string                 `json:"event"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+func (t *Tracer) event(name string, fields map[string]interface{}) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Tracing is best effort and must never break the connection.
+	_ = json.NewEncoder(t.w).Encode(traceEvent{
+		Time:    now.UTC(),
+		Elapsed: now.Sub(t.start).String(),
+		Event:   name,
+		Fields:  fields,
+	})
+}
+
+func (t *Tracer) candidate(name, candidate string) {
+	if t == nil {
+		return
+	}
+	t.event(name, map[string]interface{}{"candidate": redactCandidate(candidate, t.redact)})
+}
+
+func (t *Tracer) sdp(name, typ, sdp string) {
+	if t == nil {
+		return
+	}
+	t.event(name, map[string]interface{}{"type": typ, "sdp": redactSDP(sdp, t.redact)})
+}
+
+// redactedCredential replaces the ICE username fragments and passwords.
+const redactedCredential = "<redacted>"
+
+// redactCandidate replaces the username fragment of an ICE candidate
+// attribute, as defined in RFC 8839 section 5.1, and its connection and
+// related addresses if addresses is true.
+func redactCandidate(candidate string, addresses bool) string {
+	fields := strings.Fields(candidate)
+	// foundation component transport priority address port typ type ...
+	if addresses && len(fields) > 4 {
+		fields[4] = redactAddress(fields[4])
+	}
+	for i := 6; i < len(fields)-1; i++ {
+		switch {
+		case fields[i] == "ufrag":
+			fields[i+1] = redactedCredential
+		case fields[i] == "raddr" && addresses:
+			fields[i+1] = redactAddress(fields[i+1])
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// redactSDP redacts the ICE credentials of a session description, and the
+// addresses in its candidate, connection and origin lines if addresses is
+// true.
+func redactSDP(sdp string, addresses bool) string {
+	lines := strings.Split(sdp, "\r\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "a=ice-ufrag:"):
+			lines[i] = "a=ice-ufrag:" + redactedCredential
+		case strings.HasPrefix(line, "a=ice-pwd:"):
+			lines[i] = "a=ice-pwd:" + redactedCredential
+		case strings.HasPrefix(line, "a=candidate:"):
+			lines[i] = "a=" + redactCandidate(strings.TrimPrefix(line, "a="), addresses)
+		case addresses && (strings.HasPrefix(line, "c=") || strings.HasPrefix(line, "o=")):
+			fields := strings.Fields(line)
+			fields[len(fields)-1] = redactAddress(fields[len(fields)-1])
+			lines[i] = strings.Join(fields, " ")
+		}
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// redactAddress describes addr without revealing it, keeping what's needed
+// to debug connectivity: whether it's loopback, private or public.
+func redactAddress(addr string) string {
+	if strings.HasSuffix(addr, ".local") {
+		return "<redacted-mdns>"
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "<redacted-hostname>"
+	}
+	family := "ipv6"
+	if ip.To4() != nil {
+		family = "ipv4"
+	}
+	switch {
+	case ip.IsUnspecified():
+		return addr
+	case ip.IsLoopback():
+		return "<redacted-loopback-" + family + ">"
+	case isPrivateIP(ip):
+		return "<redacted-private-" + family + ">"
+	default:
+		return "<redacted-public-" + family + ">"
+	}
+}
+
+var privateNetworks = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "169.254.0.0/16", "fc00::/7", "fe80::/10"} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+func isPrivateIP(ip net.IP) bool {
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
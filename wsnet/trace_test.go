@@ -0,0 +1,116 @@
+package wsnet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactCandidate(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		candidate string
+		expected  string
+	}{
+		{
+			candidate: "candidate:1 1 udp 2130706431 192.168.1.20 54321 typ host",
+			expected:  "candidate:1 1 udp 2130706431 <redacted-private-ipv4> 54321 typ host",
+		},
+		{
+			candidate: "candidate:2 1 udp 1694498815 203.0.113.7 40000 typ srflx raddr 10.0.0.4 rport 54321",
+			expected:  "candidate:2 1 udp 1694498815 <redacted-public-ipv4> 40000 typ srflx raddr <redacted-private-ipv4> rport 54321",
+		},
+		{
+			candidate: "candidate:3 1 udp 2130706431 2001:db8::1 5000 typ host",
+			expected:  "candidate:3 1 udp 2130706431 <redacted-public-ipv6> 5000 typ host",
+		},
+		{
+			candidate: "candidate:4 1 udp 2130706431 3f1c2d4e-aaaa.local 5000 typ host",
+			expected:  "candidate:4 1 udp 2130706431 <redacted-mdns> 5000 typ host",
+		},
+		{
+			candidate: "candidate:5 1 tcp 2130706431 127.0.0.1 9 typ host tcptype active",
+			expected:  "candidate:5 1 tcp 2130706431 <redacted-loopback-ipv4> 9 typ host tcptype active",
+		},
+		{
+			candidate: "candidate:6 1 udp 2130706431 192.168.1.20 54321 typ host ufrag Fh3k",
+			expected:  "candidate:6 1 udp 2130706431 <redacted-private-ipv4> 54321 typ host ufrag <redacted>",
+		},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, redactCandidate(c.candidate, true))
+	}
+	// The credentials are redacted even when the addresses aren't.
+	assert.Equal(t,
+		"candidate:1 1 udp 2130706431 192.168.1.20 54321 typ host ufrag <redacted>",
+		redactCandidate("candidate:1 1 udp 2130706431 192.168.1.20 54321 typ host ufrag Fh3k", false),
+	)
+}
+
+func TestRedactSDP(t *testing.T) {
+	t.Parallel()
+
+	sdp := strings.Join([]string{
+		"v=0",
+		"o=- 123 2 IN IP4 198.51.100.2",
+		"c=IN IP4 0.0.0.0",
+		"a=ice-ufrag:Fh3k",
+		"a=ice-pwd:9SeUXw7bYTmZOtWpmFCqLDkV",
+		"a=candidate:1 1 udp 2130706431 192.168.1.20 54321 typ host",
+		"",
+	}, "\r\n")
+	redacted := redactSDP(sdp, true)
+	assert.Contains(t, redacted, "a=ice-ufrag:<redacted>\r\n")
+	assert.Contains(t, redacted, "a=ice-pwd:<redacted>\r\n")
+	assert.NotContains(t, redacted, "198.51.100.2")
+	assert.NotContains(t, redacted, "192.168.1.20")
+	assert.Contains(t, redacted, "o=- 123 2 IN IP4 <redacted-public-ipv4>\r\n")
+	assert.Contains(t, redacted, "c=IN IP4 0.0.0.0\r\n")
+	assert.Contains(t, redacted, "a=candidate:1 1 udp 2130706431 <redacted-private-ipv4> 54321 typ host\r\n")
+
+	unredacted := redactSDP(sdp, false)
+	assert.NotContains(t, unredacted, "Fh3k")
+	assert.NotContains(t, unredacted, "9SeUXw7bYTmZOtWpmFCqLDkV")
+	assert.Contains(t, unredacted, "o=- 123 2 IN IP4 198.51.100.2\r\n")
+}
+
+func TestTracer(t *testing.T) {
+	t.Parallel()
+	log := slogtest.Make(t, nil)
+
+	connectAddr, listenAddr := createDumbBroker(t)
+	l, err := Listen(context.Background(), log, listenAddr, "")
+	require.NoError(t, err)
+	defer l.Close()
+
+	var buf bytes.Buffer
+	tracer := NewTracer(&buf, true)
+	dialer, err := DialWebsocket(context.Background(), connectAddr, &DialOptions{
+		Log:   &log,
+		Trace: tracer,
+	}, nil)
+	require.NoError(t, err)
+	err = dialer.Close()
+	require.NoError(t, err)
+
+	// State changes may still be traced after Close.
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	var events []string
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var ev traceEvent
+		require.NoError(t, decoder.Decode(&ev))
+		events = append(events, ev.Event)
+	}
+	for _, name := range []string{"broker_connect", "broker_connected", "offer", "answer", "connected", "close"} {
+		assert.Contains(t, events, name)
+	}
+}